@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// achievedWindow is the window over which the effective frequency is
+// measured with the APERF and MPERF registers.
+const achievedWindow = time.Second
+
+var (
+	// skipSampling does not sample the achieved frequencies after applying
+	skipSampling bool
+	// readMSR reads a model-specific register of a CPU
+	readMSR = actuator.ReadMSR
+)
+
+// achievedFrequency summarizes the frequencies the CPUs ran at after a
+// decision, in kHz.
+type achievedFrequency struct {
+	// Source is aperf/mperf for the average effective frequency over
+	// achievedWindow, or scaling_cur_freq for the current frequency the
+	// kernel reports
+	Source string `json:"source"`
+	Min    int    `json:"minKhz"`
+	Avg    int    `json:"avgKhz"`
+	Max    int    `json:"maxKhz"`
+}
+
+// sampleAchieved records the frequencies the CPUs that accepted the
+// decision achieve. The effective frequencies are measured where the msr
+// driver is available, otherwise scaling_cur_freq is read.
+func sampleAchieved(ctx context.Context, decision *Decision) {
+	if skipSampling || simulate || decision == nil || len(decision.Summary.Succeeded) == 0 {
+		return
+	}
+	cpus := decision.Summary.Succeeded
+	frequencies, err := effectiveFrequencies(ctx, cpus)
+	source := "aperf/mperf"
+	if err != nil {
+		frequencies, source = currentFrequencies(cpus), "scaling_cur_freq"
+	}
+	if len(frequencies) == 0 {
+		return
+	}
+	achieved := &achievedFrequency{Source: source, Min: frequencies[0], Max: frequencies[0]}
+	sum := 0
+	for _, f := range frequencies {
+		achieved.Min, achieved.Max = min(achieved.Min, f), max(achieved.Max, f)
+		sum += f
+	}
+	achieved.Avg = sum / len(frequencies)
+	decision.Achieved = achieved
+}
+
+// currentFrequencies reads scaling_cur_freq of the CPUs that have it.
+func currentFrequencies(cpus []int) []int {
+	var frequencies []int
+	for _, cpu := range cpus {
+		content, err := actuator.ReadFile(sysfs, cpuPath(cpu, "cpufreq", "scaling_cur_freq"))
+		if err != nil {
+			continue
+		}
+		if f, err := strconv.Atoi(strings.TrimSpace(content)); err == nil {
+			frequencies = append(frequencies, f)
+		}
+	}
+	return frequencies
+}
+
+// effectiveFrequencies measures the average frequency of the CPUs while they
+// ran over achievedWindow: the base frequency times the increment of APERF
+// over that of MPERF. It fails when a register cannot be read.
+func effectiveFrequencies(ctx context.Context, cpus []int) ([]int, error) {
+	read := func() ([][2]uint64, error) {
+		counters := make([][2]uint64, len(cpus))
+		for i, cpu := range cpus {
+			var err error
+			if counters[i][0], err = readMSR(cpu, actuator.MSRAPERF); err != nil {
+				return nil, err
+			}
+			if counters[i][1], err = readMSR(cpu, actuator.MSRMPERF); err != nil {
+				return nil, err
+			}
+		}
+		return counters, nil
+	}
+	before, err := read()
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(achievedWindow):
+	}
+	after, err := read()
+	if err != nil {
+		return nil, err
+	}
+	var frequencies []int
+	for i, cpu := range cpus {
+		base := baseFrequency(cpu)
+		aperf, mperf := after[i][0]-before[i][0], after[i][1]-before[i][1]
+		// An idle CPU does not count and has no effective frequency
+		if base == 0 || mperf == 0 {
+			continue
+		}
+		frequencies = append(frequencies, int(float64(base)*float64(aperf)/float64(mperf)))
+	}
+	return frequencies, nil
+}
+
+// baseFrequency returns the base frequency of the CPU, the maximum
+// frequency when the driver does not tell it, or 0.
+func baseFrequency(cpu int) int {
+	for _, name := range []string{"base_frequency", "cpuinfo_max_freq"} {
+		content, err := actuator.ReadFile(sysfs, cpuPath(cpu, "cpufreq", name))
+		if err != nil {
+			continue
+		}
+		if f, err := strconv.Atoi(strings.TrimSpace(content)); err == nil {
+			return f
+		}
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// countingMSR is a fake of the APERF and MPERF registers advancing by the
+// step of the CPU at every read.
+type countingMSR struct {
+	mu sync.Mutex
+	// steps maps the CPUs to the increments of APERF and MPERF
+	steps map[int][2]uint64
+	reads map[int][2]uint64
+}
+
+func (m *countingMSR) read(cpu int, register int64) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	step, ok := m.steps[cpu]
+	if !ok {
+		return 0, errors.New("no such device")
+	}
+	i := 0
+	if register == actuator.MSRMPERF {
+		i = 1
+	}
+	reads := m.reads[cpu]
+	// The counters start high, so that they are not compared with zero
+	value := uint64(1)<<40 + reads[i]*step[i]
+	reads[i]++
+	m.reads[cpu] = reads
+	return value, nil
+}
+
+func TestAchievedEffective(t *testing.T) {
+	runOnMocks(t, trend(time.Now(), 10))
+	captureLogs(t)
+	setGlobal(t, &skipSampling, false)
+	files := sysfsFiles(2)
+	files[cpuPath(0, "cpufreq", "base_frequency")] = "2400000\n"
+	// Without base_frequency, the maximum frequency is the base
+	files[cpuPath(1, "cpufreq", "cpuinfo_max_freq")] = "2400000\n"
+	useSysfs(t, actuator.NewMemFS(files))
+	msr := &countingMSR{steps: map[int][2]uint64{0: {1.5e9, 2e9}, 1: {2.6e9, 2e9}}, reads: make(map[int][2]uint64)}
+	setGlobal(t, &readMSR, msr.read)
+
+	result := runCycle(context.Background())
+	want := achievedFrequency{Source: "aperf/mperf", Min: 1800000, Avg: 2460000, Max: 3120000}
+	if result.Decision == nil || result.Decision.Achieved == nil || *result.Decision.Achieved != want {
+		t.Fatalf("achieved %+v, want %+v", result.Decision.Achieved, want)
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	for _, line := range []string{`epcp_achieved_frequency_khz{stat="min"} 1.8e+06`, `epcp_achieved_frequency_khz{stat="avg"} 2.46e+06`, `epcp_achieved_frequency_khz{stat="max"} 3.12e+06`} {
+		if !strings.Contains(exposition.String(), line+"\n") {
+			t.Errorf("no %s in the metrics:\n%s", line, exposition.String())
+		}
+	}
+
+	// A CPU idle during the window has no effective frequency
+	msr.steps[1] = [2]uint64{0, 0}
+	frequencies, err := effectiveFrequencies(context.Background(), []int{0, 1})
+	if err != nil || len(frequencies) != 1 || frequencies[0] != 1800000 {
+		t.Errorf("frequencies %v, %v, want cpu0 only", frequencies, err)
+	}
+}
+
+func TestAchievedCurrent(t *testing.T) {
+	runOnMocks(t, trend(time.Now(), 10))
+	captureLogs(t)
+	setGlobal(t, &skipSampling, false)
+	// Without the msr driver the frequencies the kernel reports are read
+	setGlobal(t, &readMSR, func(int, int64) (uint64, error) { return 0, errors.New("no such file or directory") })
+	files := sysfsFiles(2)
+	files[cpuPath(0, "cpufreq", "scaling_cur_freq")] = "799000\n"
+	files[cpuPath(1, "cpufreq", "scaling_cur_freq")] = "801000\n"
+	useSysfs(t, actuator.NewMemFS(files))
+	result := runCycle(context.Background())
+	want := achievedFrequency{Source: "scaling_cur_freq", Min: 799000, Avg: 800000, Max: 801000}
+	if result.Decision == nil || result.Decision.Achieved == nil || *result.Decision.Achieved != want {
+		t.Errorf("achieved %+v, want %+v", result.Decision.Achieved, want)
+	}
+
+	// The sampling can be skipped
+	setGlobal(t, &skipSampling, true)
+	if result := runCycle(context.Background()); result.Decision == nil || result.Decision.Achieved != nil {
+		t.Errorf("achieved %+v with the sampling skipped, want none", result.Decision.Achieved)
+	}
+}
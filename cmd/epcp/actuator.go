@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// frequencyActuator applies the frequency decisions, see selectActuator. The
+// sysfs actuator needs Linux; elsewhere only the simulation is used.
+var frequencyActuator actuator.Actuator = actuator.Sysfs{FS: actuator.OSFS{}}
+
+// applyWorkers write the CPUs concurrently, actuator.DefaultWorkers when 0.
+var applyWorkers int
+
+// selectActuator returns the actuator for the configuration and platform.
+func selectActuator() actuator.Actuator {
+	switch {
+	case dryRun:
+		return actuator.Simulation{Logf: infoLogger.Printf}
+	case simulate:
+		return actuator.Simulation{FS: sysfs, Logf: infoLogger.Printf}
+	case applyHelper != "" || applySocket != "":
+		return actuator.Helper{Command: applyHelper, Socket: applySocket}
+	}
+	return actuator.Sysfs{FS: sysfs, Workers: applyWorkers}
+}
+
+// cpufreqAvailable reports whether any CPU exposes a cpufreq interface.
+func cpufreqAvailable() bool {
+	return actuator.CPUFreqAvailable(sysfs, sysfsRoot)
+}
+
+// enableSimulation replaces sysfs with a simulated cpufreq tree.
+func enableSimulation() {
+	simulate = true
+	sysfs = actuator.SimulatedTree(sysfsRoot, len(hostCPUs()))
+}
+
+// wouldScale records in last the factor a tuner of guests, containers or
+// units scales by in a dry run or a simulation, 0 when it restores them, and
+// reports whether it changed. Those touch nothing, not even to read what is
+// set, so the factor stands for it.
+func wouldScale(last *float64, factor float64, scaled bool) bool {
+	if !scaled {
+		factor = 0
+	}
+	changed := *last != factor
+	*last = factor
+	return changed
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// hostStatus is the view of a node in the aggregated status.
+type hostStatus struct {
+	Target    string     `json:"target"`
+	Band      string     `json:"band,omitempty"`
+	Price     *float64   `json:"price,omitempty"`
+	Frequency int        `json:"frequency,omitempty"`
+	Applied   int        `json:"appliedCpus"`
+	LastCycle *time.Time `json:"lastCycle,omitempty"`
+	CycleAge  string     `json:"cycleAge,omitempty"`
+	// Error tells why the node could not be polled
+	Error string `json:"error,omitempty"`
+}
+
+// aggregateResponse is the aggregated status of the nodes.
+type aggregateResponse struct {
+	Polled time.Time    `json:"polled"`
+	Hosts  []hostStatus `json:"hosts"`
+}
+
+// aggregator polls the status endpoints of the targets, keeping the last
+// aggregated status between the polls.
+type aggregator struct {
+	targets []string
+	client  *http.Client
+
+	mu   sync.Mutex
+	last aggregateResponse
+}
+
+func aggregateFlags(flags *flag.FlagSet) {
+	flags.String("targets", "", "`file` listing the status endpoints of the nodes, one host:port or URL per line (required)")
+	flags.Duration("timeout", 5*time.Second, "`duration` to wait for each node")
+	flags.Duration("refresh", 30*time.Second, "`duration` between the polls when serving")
+	flags.String("listen", "", "`address` to serve the aggregated status on (default print it once)")
+	flags.String("format", "table", "format of the printed status, table or json")
+}
+
+func runAggregate(flags *flag.FlagSet) exitCode {
+	value := func(name string) string { return flags.Lookup(name).Value.String() }
+	format := value("format")
+	if format != "table" && format != "json" {
+		errorLogger.Printf("Unknown format %q, expected table or json.\n", format)
+		return exitUsage
+	}
+	if value("targets") == "" {
+		errorLogger.Println("No --targets file given.")
+		return exitUsage
+	}
+	targets, err := readTargets(value("targets"))
+	if err != nil {
+		errorLogger.Printf("Error reading the targets: %s\n", err.Error())
+		return exitFailure
+	}
+	timeout := flags.Lookup("timeout").Value.(flag.Getter).Get().(time.Duration)
+	refresh := flags.Lookup("refresh").Value.(flag.Getter).Get().(time.Duration)
+	if timeout <= 0 || refresh <= 0 {
+		errorLogger.Println("The --timeout and --refresh must be positive.")
+		return exitUsage
+	}
+	a := &aggregator{targets: targets, client: newHTTPClient(nil, timeout)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trapSignals(cancel)
+	a.poll(ctx)
+	addr := value("listen")
+	if addr == "" {
+		if err := printAggregate(os.Stdout, a.snapshot(), format == "json"); err != nil {
+			errorLogger.Printf("Error writing the status: %s\n", err.Error())
+			return exitFailure
+		}
+		return exitOK
+	}
+	go func() {
+		ticker := time.NewTicker(refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.poll(ctx)
+			}
+		}
+	}()
+	serveHTTP(ctx, "aggregated status", addr, a.handler())
+	return exitOK
+}
+
+// readTargets reads the status endpoints of a targets file, skipping the
+// empty lines and # comments. A host:port means its /status over HTTP.
+func readTargets(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var targets []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		target := strings.TrimSpace(line)
+		if target == "" {
+			continue
+		}
+		if !strings.Contains(target, "://") {
+			target = "http://" + target + "/status"
+		}
+		targets = append(targets, target)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s lists no targets", path)
+	}
+	return targets, nil
+}
+
+// poll polls the targets concurrently and replaces the aggregated status.
+func (a *aggregator) poll(ctx context.Context) {
+	res := aggregateResponse{Polled: time.Now(), Hosts: make([]hostStatus, len(a.targets))}
+	var wg sync.WaitGroup
+	for i, target := range a.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res.Hosts[i] = a.pollHost(ctx, target)
+		}()
+	}
+	wg.Wait()
+	a.mu.Lock()
+	a.last = res
+	a.mu.Unlock()
+}
+
+// pollHost returns the status of the node, or the error polling it.
+func (a *aggregator) pollHost(ctx context.Context, target string) hostStatus {
+	host := hostStatus{Target: target}
+	snapshot, err := a.fetchStatus(ctx, target)
+	if err != nil {
+		host.Error = err.Error()
+		return host
+	}
+	if d := snapshot.Decision; d != nil {
+		host.Band, host.Frequency, host.Applied = d.Band, d.Frequency, len(d.Summary.Succeeded)
+	}
+	if n := len(snapshot.Prices); n != 0 {
+		price := snapshot.Prices[n-1]
+		host.Price = &price
+	}
+	if t := snapshot.LastCycle; t != nil {
+		host.LastCycle = t
+		host.CycleAge = time.Since(*t).Round(time.Second).String()
+	}
+	return host
+}
+
+// fetchStatus reads the status of the node at the endpoint.
+func (a *aggregator) fetchStatus(ctx context.Context, endpoint string) (*statusResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status endpoint returned %s", resp.Status)
+	}
+	snapshot := new(statusResponse)
+	if err := json.NewDecoder(resp.Body).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("decoding the status: %w", err)
+	}
+	return snapshot, nil
+}
+
+// snapshot returns the last aggregated status.
+func (a *aggregator) snapshot() aggregateResponse {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.last
+}
+
+func (a *aggregator) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.snapshot())
+	})
+	return mux
+}
+
+// printAggregate writes the aggregated status as a table, or as JSON.
+func printAggregate(w io.Writer, res aggregateResponse, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(res)
+	}
+	text := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "TARGET\tBAND\t%s\tFREQUENCY\tAPPLIED\tLAST CYCLE\tERROR\n", display.column())
+	for _, h := range res.Hosts {
+		price, frequency := "-", "-"
+		if h.Price != nil {
+			price = display.value(*h.Price)
+		}
+		if h.Frequency != 0 {
+			frequency = fmt.Sprint(h.Frequency)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", h.Target, text(h.Band), price, frequency, h.Applied, text(h.CycleAge), text(h.Error))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// statusServer starts a status endpoint of a node answering with res.
+func statusServer(t *testing.T, res statusResponse) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestReadTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets")
+	content := "# compute nodes\nnode1:9100\n\n  https://node2.example.org/epcp/status  # behind a proxy\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	targets, err := readTargets(path)
+	if err != nil || strings.Join(targets, " ") != "http://node1:9100/status https://node2.example.org/epcp/status" {
+		t.Errorf("targets %q, %v", targets, err)
+	}
+	if err := os.WriteFile(path, []byte("# none yet\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readTargets(path); err == nil || !strings.Contains(err.Error(), "lists no targets") {
+		t.Errorf("error %v, want no targets", err)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	lastCycle := time.Now().Add(-90 * time.Second)
+	cheap := statusServer(t, statusResponse{
+		Prices:    []float64{80, 60.5},
+		Decision:  &Decision{Band: policy.Cheap, Frequency: 3200000, Summary: applySummary{Succeeded: []int{0, 1, 2, 3}}},
+		LastCycle: &lastCycle,
+	})
+	expensive := statusServer(t, statusResponse{
+		Prices:   []float64{120},
+		Decision: &Decision{Band: policy.Expensive, Frequency: 800000, Summary: applySummary{Succeeded: []int{0, 1}}},
+	})
+	// A node that has not run a cycle yet
+	starting := statusServer(t, statusResponse{})
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	targets := []string{cheap.URL + "/status", expensive.URL + "/status", starting.URL + "/status", unreachable.URL + "/status", broken.URL + "/status"}
+	a := &aggregator{targets: targets, client: &http.Client{Timeout: 5 * time.Second}}
+	a.poll(context.Background())
+	res := a.snapshot()
+	if len(res.Hosts) != len(targets) {
+		t.Fatalf("hosts %+v, want %d", res.Hosts, len(targets))
+	}
+	for i, host := range res.Hosts {
+		if host.Target != targets[i] {
+			t.Errorf("host %d: target %s, want %s", i, host.Target, targets[i])
+		}
+	}
+	if h := res.Hosts[0]; h.Band != policy.Cheap || h.Frequency != 3200000 || h.Applied != 4 || h.Price == nil || *h.Price != 60.5 ||
+		h.LastCycle == nil || !h.LastCycle.Equal(lastCycle) || h.CycleAge != "1m30s" || h.Error != "" {
+		t.Errorf("cheap node %+v", h)
+	}
+	if h := res.Hosts[1]; h.Band != policy.Expensive || h.Applied != 2 || *h.Price != 120 || h.LastCycle != nil || h.Error != "" {
+		t.Errorf("expensive node %+v", h)
+	}
+	if h := res.Hosts[2]; h.Band != "" || h.Price != nil || h.Error != "" {
+		t.Errorf("starting node %+v", h)
+	}
+	if h := res.Hosts[3]; h.Error == "" || h.Band != "" {
+		t.Errorf("unreachable node %+v", h)
+	}
+	if h := res.Hosts[4]; h.Error != "status endpoint returned 503 Service Unavailable" {
+		t.Errorf("broken node %+v", h)
+	}
+
+	// The aggregated status is served as it was last polled
+	code, body := get(t, a.handler(), "/status")
+	var served aggregateResponse
+	if err := json.Unmarshal([]byte(body), &served); code != http.StatusOK || err != nil || len(served.Hosts) != len(targets) || served.Hosts[1].Band != policy.Expensive {
+		t.Errorf("/status: %d %s, %v", code, body, err)
+	}
+
+	var table strings.Builder
+	if err := printAggregate(&table, res, false); err != nil {
+		t.Fatal(err)
+	}
+	// The targets are of varying lengths, so the columns are compared
+	rows := make(map[string]string)
+	for _, line := range strings.Split(table.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) != 0 {
+			rows[fields[0]] = strings.Join(fields[1:], " ")
+		}
+	}
+	for target, want := range map[string]string{
+		"TARGET":                  "BAND PRICE (EUR/MWh) FREQUENCY APPLIED LAST CYCLE ERROR",
+		cheap.URL + "/status":     "cheap 60.50 3200000 4 1m30s -",
+		expensive.URL + "/status": "expensive 120.00 800000 2 - -",
+		broken.URL + "/status":    "- - - 0 - status endpoint returned 503 Service Unavailable",
+	} {
+		if rows[target] != want {
+			t.Errorf("row of %s: %q, want %q:\n%s", target, rows[target], want, table.String())
+		}
+	}
+
+	// The command prints the status once
+	path := filepath.Join(t.TempDir(), "targets")
+	hosts := strings.TrimPrefix(cheap.URL, "http://") + "\n" + unreachable.URL + "/status\n"
+	if err := os.WriteFile(path, []byte(hosts), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, exit := runEpcp(t, "aggregate", "--targets", path, "--format", "json")
+	if err := json.Unmarshal([]byte(out), &served); exit != exitOK || err != nil || len(served.Hosts) != 2 || served.Hosts[0].Band != policy.Cheap || served.Hosts[1].Error == "" {
+		t.Errorf("exit code %d:\n%s", exit, out)
+	}
+}
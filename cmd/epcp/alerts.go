@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// webhookNotifier posts alerts to a Slack-compatible or Matrix webhook when
+// the price crosses the thresholds or OTE flags an emergency.
+type webhookNotifier struct {
+	url       string
+	format    string
+	statusURL string
+	high      *float64
+	low       *float64
+	period    time.Duration
+	// channel is the channel alerted on, see priceChannel, empty for the
+	// electricity prices
+	channel string
+
+	// failed are the alerts whose sending failed in the queue, see update
+	mu     sync.Mutex
+	failed []failedAlert
+}
+
+// failedAlert is an alert that could not be sent, sent at, with the state it
+// replaced, sent before if firing.
+type failedAlert struct {
+	name       string
+	active     bool
+	at, before time.Time
+	firing     bool
+}
+
+var notifier *webhookNotifier
+
+// alertConditions returns the alerts and whether each of them is active.
+func (n *webhookNotifier) alertConditions(price float64, emergency bool) map[string]bool {
+	conditions := map[string]bool{"emergency": emergency}
+	if n.high != nil {
+		conditions["price-high"] = policy.Compare(price, *n.high) > 0
+	}
+	if n.low != nil {
+		conditions["price-low"] = policy.Compare(price, *n.low) < 0
+	}
+	return conditions
+}
+
+func (n *webhookNotifier) message(alert string, active bool, price float64, band, runID string) string {
+	hostname, _ := os.Hostname()
+	var text string
+	switch {
+	case alert == "emergency" && active:
+		text = fmt.Sprintf("OTE reports an emergency on the day-ahead market, price %s, band %s on %s", display.price(price), band, hostname)
+	case alert == "price-high" && active:
+		text = fmt.Sprintf("Price %s is above %s, band %s on %s", display.price(price), display.price(*n.high), band, hostname)
+	case alert == "price-low" && active:
+		text = fmt.Sprintf("Price %s is below %s, band %s on %s", display.price(price), display.price(*n.low), band, hostname)
+	default:
+		text = fmt.Sprintf("Resolved %s: price %s, band %s on %s", alert, display.price(price), band, hostname)
+	}
+	if statusURL := n.statusLink(hostname); statusURL != "" {
+		text += " (" + statusURL + ")"
+	}
+	if runID != "" {
+		text += " [run " + runID + "]"
+	}
+	if n.channel != "" {
+		text = n.channel + ": " + text
+	}
+	return text
+}
+
+// statusLink returns the configured status URL or one derived from EPCP_LISTEN.
+func (n *webhookNotifier) statusLink(hostname string) string {
+	if n.statusURL != "" || listenAddress == "" {
+		return n.statusURL
+	}
+	_, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return ""
+	}
+	return "http://" + net.JoinHostPort(hostname, port) + "/status"
+}
+
+func (n *webhookNotifier) post(ctx context.Context, text string) error {
+	body := map[string]string{"text": text}
+	if n.format == "matrix" {
+		body = map[string]string{"msgtype": "m.text", "body": text}
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", n.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("status %s", res.Status)
+	}
+	return nil
+}
+
+// notify sends new alerts, repeats active ones once per period and sends a
+// recovery message when a condition clears. The alerts of a channel are
+// remembered apart from those of the electricity prices, prefixed with its
+// name.
+func (n *webhookNotifier) notify(ctx context.Context, now time.Time, price float64, band string, emergency bool) {
+	conditions := n.alertConditions(price, emergency)
+	names := make([]string, 0, len(conditions))
+	for name := range conditions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		active := conditions[name]
+		key := name
+		if n.channel != "" {
+			key = n.channel + "/" + name
+		}
+		n.update(ctx, now, key, active, func() string {
+			return n.message(name, active, price, band, runIDFrom(ctx))
+		})
+	}
+}
+
+// update sends the alert name when it becomes active, once per period while
+// it stays active and once when it clears. The alerts sent are remembered in
+// the state file so that one-shot runs deduplicate as well. In daemon mode
+// the alerts are sent through webhookQueue and remembered when enqueued;
+// those that fail are forgotten again at the next update, so that they are
+// sent again.
+func (n *webhookNotifier) update(ctx context.Context, now time.Time, name string, active bool, message func() string) {
+	if state.Alerts == nil {
+		state.Alerts = make(map[string]time.Time)
+	}
+	n.restoreFailed()
+	sent, firing := state.Alerts[name]
+	if active && firing && now.Sub(sent) < n.period {
+		return
+	}
+	if !active && !firing {
+		return
+	}
+	if active {
+		state.Alerts[name] = now
+	} else {
+		delete(state.Alerts, name)
+	}
+	text := message()
+	webhookQueue.send(ctx, notification{
+		send: func(ctx context.Context) error {
+			if err := n.post(ctx, text); err != nil {
+				return err
+			}
+			infoLog(ctx).Printf("Sent %s alert (active: %t)\n", name, active)
+			return nil
+		},
+		failed: func(err error) {
+			errorLog(ctx).Printf("Error sending %s alert: %s\n", name, err.Error())
+			n.mu.Lock()
+			n.failed = append(n.failed, failedAlert{name: name, active: active, at: now, before: sent, firing: firing})
+			n.mu.Unlock()
+		},
+	})
+	if webhookQueue == nil {
+		n.restoreFailed()
+	}
+}
+
+// restoreFailed restores the state the failed alerts replaced, unless it
+// changed since.
+func (n *webhookNotifier) restoreFailed() {
+	n.mu.Lock()
+	failed := n.failed
+	n.failed = nil
+	n.mu.Unlock()
+	for _, f := range failed {
+		// The alert was updated again since
+		if sent, firing := state.Alerts[f.name]; firing != f.active || f.active && !sent.Equal(f.at) {
+			continue
+		}
+		if f.firing {
+			state.Alerts[f.name] = f.before
+		} else {
+			delete(state.Alerts, f.name)
+		}
+	}
+}
+
+// schemaMessage describes the OTE response that could not be decoded, or
+// the recovery when err is nil.
+func (n *webhookNotifier) schemaMessage(err error, runID string) string {
+	hostname, _ := os.Hostname()
+	text := "OTE prices can be decoded again on " + hostname
+	if err != nil {
+		text = fmt.Sprintf("OTE response cannot be decoded, the service may have changed, on %s: %s", hostname, err.Error())
+	}
+	if runID != "" {
+		text += " [run " + runID + "]"
+	}
+	return text
+}
+
+// sendAlerts evaluates the alerts after a cycle. Responses that cannot be
+// decoded are alerted at once, as they will not go away without a fix.
+func sendAlerts(ctx context.Context, result *cycleResult) {
+	if notifier == nil {
+		return
+	}
+	if schema := e.Is(result.FetchErr, ote.ErrDecode); schema || result.FetchErr == nil {
+		notifier.update(ctx, cycleClock.Now(), "schema", schema, func() string {
+			return notifier.schemaMessage(result.FetchErr, runIDFrom(ctx))
+		})
+	}
+	if maxStaleness != 0 && len(result.Points) != 0 {
+		notifier.update(ctx, cycleClock.Now(), "stale-prices", result.Stale, func() string {
+			return staleMessage(result.Stale, runIDFrom(ctx))
+		})
+	}
+	if result.Decision == nil || len(result.Prices) == 0 {
+		return
+	}
+	today := ote.Day(cycleClock.Now())
+	emergency, err := GetDamIndexE(ctx, today, today)
+	if err != nil {
+		errorLog(ctx).Printf("Error getting the emergency flag: %s\n", err.Error())
+		_, emergency = state.Alerts["emergency"]
+	}
+	price := result.Prices[len(result.Prices)-1]
+	notifier.notify(ctx, cycleClock.Now(), price, result.Decision.Band, emergency)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhook is a test server recording the messages posted to it, answering
+// with status.
+type webhook struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	messages []map[string]string
+}
+
+func newWebhook(t *testing.T) *webhook {
+	t.Helper()
+	w := &webhook{status: http.StatusOK}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var message map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("webhook: invalid request, %v", err)
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.messages = append(w.messages, message)
+		rw.WriteHeader(w.status)
+	}))
+	t.Cleanup(w.Close)
+	return w
+}
+
+// received returns the messages posted since the last call.
+func (w *webhook) received() []map[string]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	messages := w.messages
+	w.messages = nil
+	return messages
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	logs := captureLogs(t)
+	hook := newWebhook(t)
+	useStateDir(t, t.TempDir())
+	setGlobal(t, &state, new(State))
+	setGlobal(t, &webhookQueue, nil)
+	setGlobal(t, &listenAddress, "")
+	high := 120.0
+	n := &webhookNotifier{url: hook.URL, statusURL: "http://node1:9100/status", high: &high, period: time.Hour}
+	ctx := context.Background()
+	start := time.Date(2024, time.October, 1, 10, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name  string
+		after time.Duration
+		price float64
+		// want is the text posted, if any
+		want []string
+	}{
+		{"firing", 0, 150, []string{"Price 150", "above 120", "band expensive", "(http://node1:9100/status)"}},
+		{"suppressed", 10 * time.Minute, 160, nil},
+		{"repeated after the period", time.Hour, 155, []string{"Price 155", "above 120"}},
+		{"recovery", time.Hour + time.Minute, 100, []string{"Resolved price-high", "price 100"}},
+		{"no repeated recovery", 2 * time.Hour, 90, nil},
+	}
+	for _, step := range steps {
+		n.notify(ctx, start.Add(step.after), step.price, "expensive", false)
+		messages := hook.received()
+		if step.want == nil {
+			if len(messages) != 0 {
+				t.Errorf("%s: posted %v, want nothing", step.name, messages)
+			}
+			continue
+		}
+		if len(messages) != 1 {
+			t.Fatalf("%s: posted %v, want one message", step.name, messages)
+		}
+		for _, want := range step.want {
+			if !strings.Contains(messages[0]["text"], want) {
+				t.Errorf("%s: %q lacks %q", step.name, messages[0]["text"], want)
+			}
+		}
+	}
+
+	// The alerts sent survive a one-shot run through the state file
+	n.notify(ctx, start, 150, "expensive", true)
+	if messages := hook.received(); len(messages) != 2 {
+		t.Fatalf("emergency at a high price: posted %v, want two messages", messages)
+	}
+	if err := saveState(); err != nil {
+		t.Fatal(err)
+	}
+	state = new(State)
+	loadState()
+	n.notify(ctx, start.Add(time.Minute), 150, "expensive", true)
+	if messages := hook.received(); len(messages) != 0 {
+		t.Errorf("after reloading the state: posted %v, want nothing", messages)
+	}
+
+	// A failed alert is sent again at the next cycle
+	hook.mu.Lock()
+	hook.status = http.StatusInternalServerError
+	hook.mu.Unlock()
+	n.notify(ctx, start.Add(2*time.Minute), 100, "cheap", false)
+	if messages := hook.received(); len(messages) != 2 || !strings.Contains(logs.String(), "Error sending emergency alert") {
+		t.Errorf("failing webhook: posted %v:\n%s", messages, logs)
+	}
+	hook.mu.Lock()
+	hook.status = http.StatusOK
+	hook.mu.Unlock()
+	n.notify(ctx, start.Add(3*time.Minute), 100, "cheap", false)
+	if messages := hook.received(); len(messages) != 2 || !strings.HasPrefix(messages[0]["text"], "Resolved emergency") {
+		t.Errorf("after the failure: posted %v, want the recoveries again", messages)
+	}
+	if len(state.Alerts) != 0 {
+		t.Errorf("alerts %v left after the recovery", state.Alerts)
+	}
+}
+
+func TestWebhookMatrix(t *testing.T) {
+	captureLogs(t)
+	hook := newWebhook(t)
+	setGlobal(t, &state, new(State))
+	setGlobal(t, &webhookQueue, nil)
+	setGlobal(t, &listenAddress, "")
+	low := 50.0
+	n := &webhookNotifier{url: hook.URL, format: "matrix", low: &low, period: time.Hour}
+	n.notify(withRunID(context.Background(), "01J9"), time.Now(), 20, "cheap", false)
+	messages := hook.received()
+	if len(messages) != 1 || messages[0]["msgtype"] != "m.text" || messages[0]["text"] != "" {
+		t.Fatalf("posted %v, want a Matrix message", messages)
+	}
+	if body := messages[0]["body"]; !strings.HasPrefix(body, "Price 20") || !strings.Contains(body, "below 50") || !strings.HasSuffix(body, "[run 01J9]") {
+		t.Errorf("message %q", body)
+	}
+}
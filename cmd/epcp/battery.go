@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/battery"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// batteryTimeout bounds reading the state of charge.
+const batteryTimeout = 5 * time.Second
+
+var (
+	// batterySource overrides the band with the state of charge, see
+	// BatteryConfig; it is nil without a battery
+	batterySource battery.Source
+	// batteryHigh and batteryLow are the thresholds in percent
+	batteryHigh, batteryLow float64
+	// batteryUnavailable is set while the state of charge cannot be read,
+	// so that it is reported once
+	batteryUnavailable bool
+)
+
+func newBatterySource(c BatteryConfig) battery.Source {
+	if c.URL == "" {
+		return nil
+	}
+	source, err := battery.New(c.URL, c.Field, newHTTPClient(nil, batteryTimeout))
+	if err != nil {
+		// Validate rejects such URLs
+		errorLogger.Printf("Error configuring the battery: %s\n", err.Error())
+	}
+	return source
+}
+
+// adjustForBattery overrides the band of the decision with the state of
+// charge of the battery: charged above batteryHigh the hour is cheap, as the
+// battery covers it, and below batteryLow expensive to spare it. While the
+// state of charge cannot be read, the decision is left to the prices.
+func adjustForBattery(ctx context.Context, decision *Decision) {
+	if batterySource == nil || decision == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, batteryTimeout)
+	defer cancel()
+	soc, err := batterySource.StateOfCharge(ctx)
+	if err != nil {
+		if !batteryUnavailable {
+			errorLog(ctx).Printf("WARNING: the battery state of charge is unavailable, deciding on the prices alone: %s\n", err.Error())
+		}
+		batteryUnavailable = true
+		return
+	}
+	if batteryUnavailable {
+		infoLog(ctx).Println("The battery state of charge is available again")
+		batteryUnavailable = false
+	}
+	decision.StateOfCharge = &soc
+	band := decision.Band
+	switch {
+	case soc >= batteryHigh:
+		band = policy.Cheap
+	case soc <= batteryLow:
+		band = policy.Expensive
+	}
+	if band == decision.Band {
+		return
+	}
+	infoLog(ctx).Printf("Battery at %.0f%%, deciding the %s band instead of %s\n", soc, band, decision.Band)
+	decision.setBand(band, availableFrequencies())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/battery"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestBattery(t *testing.T) {
+	var mu sync.Mutex
+	soc := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if soc == "" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"battery": {"soc": ` + soc + `}}`))
+	}))
+	defer server.Close()
+	source, err := battery.New(server.URL, "battery.soc", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &batterySource, source)
+	setGlobal(t, &batteryHigh, 80)
+	setGlobal(t, &batteryLow, 20)
+	setGlobal(t, &batteryUnavailable, false)
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		// step is the trend of the prices, rising for the expensive band
+		step float64
+		soc  string
+		band string
+		// frequency is the scaling_max_freq applied
+		frequency string
+		log       string
+	}{
+		{"charged at expensive prices", 10, "95", policy.Cheap, "3200000", "Battery at 95%, deciding the cheap band instead of expensive"},
+		{"in between", 10, "50", policy.Expensive, "800000", ""},
+		{"depleted at cheap prices", -10, "10", policy.Expensive, "800000", "Battery at 10%, deciding the expensive band instead of cheap"},
+		{"unavailable", 10, "", policy.Expensive, "800000", "WARNING: the battery state of charge is unavailable, deciding on the prices alone: HTTP status 503"},
+		{"still unavailable", -10, "", policy.Cheap, "3200000", ""},
+		{"available again", 10, "90", policy.Cheap, "3200000", "The battery state of charge is available again"},
+	}
+	for _, test := range tests {
+		tree := runOnMocks(t, trend(now, test.step))
+		logs := captureLogs(t)
+		mu.Lock()
+		soc = test.soc
+		mu.Unlock()
+		result := runCycle(context.Background())
+		if result.Decision == nil || result.Decision.Band != test.band {
+			t.Fatalf("%s: decision %+v, want the %s band", test.name, result.Decision, test.band)
+		}
+		if got := readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")); got != test.frequency {
+			t.Errorf("%s: scaling_max_freq %s, want %s", test.name, got, test.frequency)
+		}
+		if (result.Decision.StateOfCharge != nil) != (test.soc != "") {
+			t.Errorf("%s: state of charge %v recorded, want %q", test.name, result.Decision.StateOfCharge, test.soc)
+		}
+		if test.log != "" && !strings.Contains(logs.String(), test.log) {
+			t.Errorf("%s: %q not logged:\n%s", test.name, test.log, logs)
+		}
+		if test.log == "" && strings.Contains(logs.String(), "attery") {
+			t.Errorf("%s: logged the battery:\n%s", test.name, logs)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+var (
+	// bootGrace is how long after the boot the decisions lowering the
+	// frequencies are not applied; 0 disables the grace period
+	bootGrace time.Duration
+	// readUptime returns how long the node has been up, replaced in tests
+	readUptime = procUptime
+)
+
+// procUptime reads the uptime of the node from /proc/uptime.
+func procUptime() (time.Duration, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	field, _, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+	seconds, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected /proc/uptime %q", data)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// adjustForBootGrace keeps the node at full speed right after its boot, when
+// configuration management, image pulls and RAID resyncs need it whatever
+// the prices: during bootGrace, a decision lowering the frequencies is
+// marked and not applied, while those raising them apply as usual.
+func adjustForBootGrace(ctx context.Context, decision *Decision) {
+	if bootGrace == 0 || decision == nil || decision.suspended() || !scalesDown(decision) {
+		return
+	}
+	uptime, err := readUptime()
+	if err != nil {
+		errorLog(ctx).Printf("Error reading the uptime, ignoring the boot grace period: %s\n", err.Error())
+		return
+	}
+	if uptime >= bootGrace {
+		return
+	}
+	infoLog(ctx).Printf("Up for %s, within the boot grace period of %s\n", uptime.Round(time.Second), bootGrace)
+	decision.BootGrace = true
+	if decision.Reason != "" {
+		decision.Reason += ", boot-grace"
+	} else {
+		decision.Reason = "boot-grace"
+	}
+}
+
+// scalesDown reports whether the decision runs any CPU below the full speed.
+func scalesDown(decision *Decision) bool {
+	if decision.Band == policy.Expensive {
+		return true
+	}
+	full := policy.Frequency(policy.Cheap, availableFrequencies())
+	if decision.Frequency < full {
+		return true
+	}
+	for _, frequency := range decision.Nodes {
+		if frequency < full {
+			return true
+		}
+	}
+	return false
+}
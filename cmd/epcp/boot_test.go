@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestBootGrace(t *testing.T) {
+	tests := []struct {
+		name   string
+		grace  time.Duration
+		uptime time.Duration
+		err    error
+		// step is that of the trend of the prices, positive for the
+		// expensive band
+		step float64
+		// inGrace is whether the decision is suppressed, applied the
+		// scaling_max_freq after the cycle
+		inGrace bool
+		applied string
+		log     string
+	}{
+		{"inside", 10 * time.Minute, 5 * time.Minute, nil, 10, true, "3200000", "Up for 5m0s, within the boot grace period of 10m0s"},
+		{"outside", 10 * time.Minute, 15 * time.Minute, nil, 10, false, "800000", ""},
+		{"at the end", 10 * time.Minute, 10 * time.Minute, nil, 10, false, "800000", ""},
+		{"zero grace", 0, time.Minute, nil, 10, false, "800000", ""},
+		// Scaling up applies as usual
+		{"cheap inside", 10 * time.Minute, 5 * time.Minute, nil, -10, false, "3200000", ""},
+		{"unknown uptime", 10 * time.Minute, 0, e.New("no /proc"), 10, false, "800000", "Error reading the uptime, ignoring the boot grace period: no /proc"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := runOnMocks(t, trend(time.Now(), test.step))
+			logs := captureLogs(t)
+			setGlobal(t, &bootGrace, test.grace)
+			reads := 0
+			setGlobal(t, &readUptime, func() (time.Duration, error) {
+				reads++
+				return test.uptime, test.err
+			})
+
+			d := runCycle(context.Background()).Decision
+			if d == nil || d.BootGrace != test.inGrace || (d.Reason == "boot-grace") != test.inGrace {
+				t.Fatalf("decision %+v, want in the grace period %t", d, test.inGrace)
+			}
+			if test.inGrace && d.Band != policy.Expensive {
+				t.Errorf("band %s in the grace period, want the expensive band kept", d.Band)
+			}
+			for cpu := range 2 {
+				if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != test.applied {
+					t.Errorf("cpu%d: scaling_max_freq %s, want %s", cpu, got, test.applied)
+				}
+			}
+			if test.log != "" && !strings.Contains(logs.String(), test.log) {
+				t.Errorf("logs without %q:\n%s", test.log, logs)
+			}
+			if test.grace == 0 && reads != 0 {
+				t.Errorf("uptime read %d times without a grace period", reads)
+			}
+		})
+	}
+}
+
+func TestBootGraceReason(t *testing.T) {
+	captureLogs(t)
+	setGlobal(t, &bootGrace, 10*time.Minute)
+	setGlobal(t, &readUptime, func() (time.Duration, error) { return time.Minute, nil })
+	d := &Decision{Band: policy.Expensive, Frequency: 800000, Reason: "forecast"}
+	adjustForBootGrace(context.Background(), d)
+	if !d.BootGrace || d.Reason != "forecast, boot-grace" {
+		t.Errorf("decision in the grace period %t with the reason %q, want %q", d.BootGrace, d.Reason, "forecast, boot-grace")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/forecast"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// bootstrapProgress is how many days the bootstrap goes through between its
+// progress logs.
+const bootstrapProgress = 5
+
+// bootstrapDays is how many days of day-ahead prices the daemon backfills an
+// empty history with on its first start, see SourceConfig; 0 disables it.
+var bootstrapDays int
+
+// bootstrapCounts counts what a bootstrap did with the days.
+type bootstrapCounts struct {
+	fetched, skipped, missing, prices int
+}
+
+// bootstrapRange returns the first and the last of the days days before the
+// day of now.
+func bootstrapRange(now time.Time, days int) (from, to string, err error) {
+	today := ote.Day(now)
+	if from, err = ote.AddDays(today, -days); err != nil {
+		return "", "", err
+	}
+	to, err = ote.AddDays(today, -1)
+	return from, to, err
+}
+
+// historyHas reports whether the history has the prices of all the hours of
+// the day, or has compacted them.
+func historyHas(day string, hours int) bool {
+	if state.DailyPrices[day] != nil {
+		return true
+	}
+	for hour := 1; hour <= hours; hour++ {
+		start, err := ote.HourStart(day, hour)
+		if err != nil {
+			return false
+		}
+		if _, ok := state.History[start.Unix()]; !ok && state.HourlyPrices[start.Unix()] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// bootstrapHistory backfills the history with the day-ahead prices of the
+// days days before today, a day a request so that the rate limiter of the
+// source spaces them. The days whose hours are all in the history already
+// are skipped and the state is saved after each day fetched, so that an
+// interrupted bootstrap resumes where it stopped; state.Bootstrap holds the
+// days of a bootstrap until it completes, for the daemon to resume it. Days
+// without prices, or with too many of them quarantined, are left out. The
+// source is to fetch the prices in EUR, those of the history, see
+// SourceConfig.oteClient.
+func bootstrapHistory(ctx context.Context, source *ote.Client, days int) (bootstrapCounts, error) {
+	var counts bootstrapCounts
+	from, to, err := bootstrapRange(cycleClock.Now(), days)
+	if err != nil {
+		return counts, err
+	}
+	if state.History == nil {
+		state.History = make(forecast.History)
+	}
+	if state.HistoryVolumes == nil {
+		state.HistoryVolumes = make(forecast.History)
+	}
+	state.Bootstrap = days
+	done := 0
+	err = ote.EachDay(from, to, func(day string, hours int) error {
+		if err := bootstrapDay(ctx, source, day, hours, &counts); err != nil {
+			return err
+		}
+		if done++; done%bootstrapProgress == 0 && done < days {
+			infoLogger.Printf("Bootstrapped %d of %d days: %s\n", done, days, counts)
+		}
+		return nil
+	})
+	if err != nil {
+		return counts, err
+	}
+	state.Bootstrap = 0
+	return counts, saveState()
+}
+
+// bootstrapDay adds the day-ahead prices of the day to the history and saves
+// the state, unless the history has them already.
+func bootstrapDay(ctx context.Context, source *ote.Client, day string, hours int, counts *bootstrapCounts) error {
+	if historyHas(day, hours) {
+		counts.skipped++
+		return nil
+	}
+	var points []ote.PricePoint
+	err := source.StreamDamPrices(ctx, day, day, func(p ote.PricePoint) error {
+		points = append(points, p)
+		return nil
+	})
+	if err == nil {
+		points, err = quarantinePrices(ctx, points)
+	}
+	switch {
+	case e.Is(err, ote.ErrNoData) || e.Is(err, errQuarantined):
+		errorLogger.Printf("WARNING: left the day-ahead prices of %s out of the history: %s\n", day, err.Error())
+		counts.missing++
+		return nil
+	case err != nil:
+		return fmt.Errorf("fetching the day-ahead prices of %s: %w", day, err)
+	}
+	counts.fetched++
+	counts.prices += importPrices(state.History, state.HistoryVolumes, points, false).inserted
+	return saveState()
+}
+
+// bootstrapDaemon backfills the history on the first start of the daemon,
+// when it is empty and bootstrapDays is set, or resumes an interrupted
+// bootstrap, before the first cycle.
+func bootstrapDaemon(ctx context.Context) {
+	days := state.Bootstrap
+	if days == 0 && len(state.History) == 0 {
+		days = bootstrapDays
+	}
+	if days == 0 || dryRun {
+		return
+	}
+	infoLogger.Printf("Bootstrapping the history with the day-ahead prices of the last %d days\n", days)
+	counts, err := bootstrapHistory(ctx, effectiveConfig.Source.oteClient(), days)
+	if err != nil {
+		errorLogger.Printf("Error bootstrapping the history, resuming on the next start: %s\n", err.Error())
+		return
+	}
+	infoLogger.Printf("Bootstrapped the history: %s\n", counts)
+}
+
+func (c bootstrapCounts) String() string {
+	return fmt.Sprintf("%d days fetched, %d already in the history, %d without prices, %d prices added",
+		c.fetched, c.skipped, c.missing, c.prices)
+}
+
+func bootstrapFlags(flags *flag.FlagSet) {
+	flags.Int("days", historyDays, "number of `days` before today to backfill")
+	envVar(flags, "wsdl", "EPCP_WSDL", "string", "`URL` of the OTE public data service")
+	envVar(flags, "state-dir", "EPCP_STATE_DIR", "string", "`directory` of the state file")
+	envVar(flags, "lock-wait", "EPCP_LOCK_WAIT", "duration", "`duration` to wait for another instance")
+}
+
+// runBootstrap backfills the history with the day-ahead prices of the last
+// days, so that the forecasts and the reports have prices from the start.
+// Run again after an interruption, it resumes where it stopped.
+func runBootstrap(flags *flag.FlagSet) exitCode {
+	days, _ := strconv.Atoi(flags.Lookup("days").Value.String())
+	if days < 1 {
+		errorLogger.Println("At least one day must be backfilled.")
+		return exitUsage
+	}
+	if dryRun {
+		from, to, err := bootstrapRange(cycleClock.Now(), days)
+		if err != nil {
+			errorLogger.Printf("Error computing the days: %s\n", err.Error())
+			return exitFailure
+		}
+		fmt.Printf("Would backfill the history with the day-ahead prices of %s to %s.\n", from, to)
+		return exitOK
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trapSignals(cancel)
+	lock, code := acquireLock(ctx)
+	if lock == nil {
+		return code
+	}
+	defer lock.Release()
+	loadState()
+	counts, err := bootstrapHistory(ctx, effectiveConfig.Source.oteClient(), days)
+	fmt.Printf("Bootstrapped the history: %s.\n", counts)
+	if err != nil {
+		errorLogger.Printf("Error bootstrapping the history, run again to resume: %s\n", err.Error())
+		return exitFetchFailed
+	}
+	if days > historyDays {
+		infoLogger.Printf("WARNING: the history keeps %d days of hourly prices, the first cycle of the next day compacts the older ones into daily statistics.\n", historyDays)
+	}
+	return exitOK
+}
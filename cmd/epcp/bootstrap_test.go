@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+// bootstrapServer is a mock server with the day-ahead prices of 2024-09-01
+// to 2024-09-30 but those of 2024-09-25, in EUR or in CZK at 25 CZK/EUR,
+// failing the requests from the
+// failFrom-th on when set. It counts the requests.
+type bootstrapServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	failFrom int
+	requests int
+}
+
+func newBootstrapServer(t *testing.T) *bootstrapServer {
+	t.Helper()
+	var points []ote.PricePoint
+	err := ote.EachDay("2024-09-01", "2024-09-30", func(day string, hours int) error {
+		if day != "2024-09-25" {
+			prices := make([]float64, hours)
+			for i := range prices {
+				prices[i] = float64(80 + i)
+			}
+			points = append(points, otetest.Points(day, 1, prices...)...)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := otetest.NewCurrencyServer(points, 25)
+	t.Cleanup(mock.Close)
+	target, err := url.Parse(mock.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	s := new(bootstrapServer)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		fail := s.failFrom > 0 && s.requests >= s.failFrom
+		s.mu.Unlock()
+		if fail {
+			w.Header().Set("Content-Type", "text/xml")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(otetest.FaultResponse("soapenv:Server", "maintenance"))
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// served returns the number of requests and forgets them.
+func (s *bootstrapServer) served() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.requests
+	s.requests = 0
+	return n
+}
+
+// bootstrapOnMocks points the bootstrap on 2024-10-01 at the server, with an
+// empty state in a temporary directory.
+func bootstrapOnMocks(t *testing.T, server *bootstrapServer) {
+	t.Helper()
+	dir := t.TempDir()
+	setGlobal(t, &stateDir, dir)
+	setGlobal(t, &state, new(State))
+	setGlobal[clock](t, &cycleClock, &fixedClock{time.Date(2024, time.October, 1, 12, 0, 0, 0, ote.Location())})
+	setGlobal(t, &oteLimiter, &spacingLimiter{})
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	config := *effectiveConfig
+	config.Source.WSDL = server.URL
+	config.State.Dir = dir
+	setGlobal(t, &effectiveConfig, &config)
+}
+
+// savedState returns the state saved in the state file.
+func savedState(t *testing.T) *State {
+	t.Helper()
+	live := state
+	defer func() { state = live }()
+	state = new(State)
+	loadState()
+	return state
+}
+
+func TestBootstrap(t *testing.T) {
+	server := newBootstrapServer(t)
+	bootstrapOnMocks(t, server)
+	logs := captureLogs(t)
+	interval := 20 * time.Millisecond
+	oteLimiter.setInterval(interval)
+
+	started := time.Now()
+	counts, err := bootstrapHistory(context.Background(), effectiveConfig.Source.oteClient(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (bootstrapCounts{fetched: 9, missing: 1, prices: 9 * 24}); counts != want {
+		t.Errorf("counts %+v, want %+v", counts, want)
+	}
+	// A request a day, spaced by the rate limiter
+	if n := server.served(); n != 10 {
+		t.Errorf("%d requests, want 10", n)
+	}
+	if took := time.Since(started); took < 9*interval {
+		t.Errorf("bootstrapped in %s, want the requests spaced by %s", took, interval)
+	}
+
+	saved := savedState(t)
+	if len(saved.History) != 9*24 || saved.Bootstrap != 0 {
+		t.Fatalf("saved %d prices, bootstrap %d, want 216 and none left", len(saved.History), saved.Bootstrap)
+	}
+	for day, want := range map[string]bool{"2024-09-20": false, "2024-09-21": true, "2024-09-25": false, "2024-09-30": true, "2024-10-01": false} {
+		hours, err := ote.HoursIn(day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := historyHas(day, hours); got != want {
+			t.Errorf("%s in the history %t, want %t", day, got, want)
+		}
+	}
+	start, err := ote.HourStart("2024-09-30", 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The history is in EUR/MWh
+	if price := saved.History[start.Unix()]; price != 103 {
+		t.Errorf("price of 2024-09-30 hour 24 %v, want 103 EUR", price)
+	}
+	for _, want := range []string{
+		"Bootstrapped 5 of 10 days: 4 days fetched, 0 already in the history, 1 without prices, 96 prices added\n",
+		"WARNING: left the day-ahead prices of 2024-09-25 out of the history: ",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs without %q:\n%s", want, logs)
+		}
+	}
+	if strings.Contains(logs.String(), "Bootstrapped 10 of 10") {
+		t.Errorf("progress logged at the end:\n%s", logs)
+	}
+
+	// Bootstrapping again fetches only the day without prices
+	counts, err = bootstrapHistory(context.Background(), effectiveConfig.Source.oteClient(), 10)
+	if want := (bootstrapCounts{skipped: 9, missing: 1}); err != nil || counts != want {
+		t.Errorf("counts %+v, %v the second time, want %+v", counts, err, want)
+	}
+	if n := server.served(); n != 1 {
+		t.Errorf("%d requests the second time, want 1", n)
+	}
+}
+
+func TestBootstrapResumes(t *testing.T) {
+	server := newBootstrapServer(t)
+	bootstrapOnMocks(t, server)
+	logs := captureLogs(t)
+	setGlobal(t, &bootstrapDays, 0)
+
+	// Interrupted by the failing fourth request
+	server.failFrom = 4
+	counts, err := bootstrapHistory(context.Background(), effectiveConfig.Source.oteClient(), 10)
+	if err == nil || !strings.HasPrefix(err.Error(), "fetching the day-ahead prices of 2024-09-24: ") {
+		t.Fatalf("error %v, want that of 2024-09-24", err)
+	}
+	if want := (bootstrapCounts{fetched: 3, prices: 3 * 24}); counts != want {
+		t.Errorf("counts %+v, want %+v", counts, want)
+	}
+	saved := savedState(t)
+	if len(saved.History) != 3*24 || saved.Bootstrap != 10 {
+		t.Fatalf("saved %d prices, bootstrap %d, want 72 and 10 days to resume", len(saved.History), saved.Bootstrap)
+	}
+
+	// The daemon restarts on the saved state and resumes with the day that
+	// failed, although the history is no longer empty
+	server.failFrom = 0
+	server.served()
+	state = saved
+	bootstrapDaemon(context.Background())
+	if n := server.served(); n != 7 {
+		t.Errorf("%d requests resuming, want 7", n)
+	}
+	saved = savedState(t)
+	if len(saved.History) != 9*24 || saved.Bootstrap != 0 {
+		t.Errorf("saved %d prices, bootstrap %d after resuming, want 216 and none left", len(saved.History), saved.Bootstrap)
+	}
+	want := "Bootstrapped the history: 6 days fetched, 3 already in the history, 1 without prices, 144 prices added\n"
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("logs without %q:\n%s", want, logs)
+	}
+
+	// Once complete, the next start bootstraps nothing
+	bootstrapDaemon(context.Background())
+	if n := server.served(); n != 0 {
+		t.Errorf("%d requests on the next start, want none", n)
+	}
+}
+
+func TestBootstrapFirstStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    int
+		history bool
+		want    int
+	}{
+		{"empty history", 3, false, 3},
+		{"disabled", 0, false, 0},
+		{"history kept", 3, true, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newBootstrapServer(t)
+			bootstrapOnMocks(t, server)
+			captureLogs(t)
+			setGlobal(t, &bootstrapDays, test.days)
+			if test.history {
+				state.History = map[int64]float64{time.Date(2024, time.October, 1, 10, 0, 0, 0, time.UTC).Unix(): 90}
+			}
+			bootstrapDaemon(context.Background())
+			if n := server.served(); n != test.want {
+				t.Errorf("%d requests, want %d", n, test.want)
+			}
+		})
+	}
+}
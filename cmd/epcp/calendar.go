@@ -0,0 +1,34 @@
+package main
+
+import (
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/calendar"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+var (
+	// dayCalendar tells the type of the days, see CalendarConfig
+	dayCalendar, _ = calendar.New(nil)
+	// dayPolicies override cyclePolicy by type of day, see PolicyConfig
+	dayPolicies map[string]policy.Policy
+)
+
+// dayType returns the type of the day of t in the market timezone.
+func dayType(t time.Time) string {
+	return dayCalendar.DayType(inMarketTime(t))
+}
+
+// inMarketTime returns t in the market timezone.
+func inMarketTime(t time.Time) time.Time {
+	return t.In(ote.Location())
+}
+
+// dayPolicy returns the policy deciding on days of the type.
+func dayPolicy(dayType string) policy.Policy {
+	if p, ok := dayPolicies[dayType]; ok {
+		return p
+	}
+	return cyclePolicy
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// electricityChannel names the prices of the source, which the actuators
+// follow, among the channels.
+const electricityChannel = "electricity"
+
+// channelName matches the names of the channels.
+var channelName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// priceChannel decides a band on the prices of another market, e.g. gas,
+// only to alert on them, see ChannelConfig.
+type priceChannel struct {
+	name     string
+	source   ote.PriceSource
+	policy   policy.Policy
+	notifier *webhookNotifier
+}
+
+// channels are the configured channels next to the electricity prices.
+var channels []*priceChannel
+
+// channelStatus is the outcome of the last cycle of a channel in /status.
+type channelStatus struct {
+	Time   time.Time `json:"time"`
+	Prices []float64 `json:"prices"`
+	// Band is empty when no band could be decided, see Error
+	Band  string `json:"band,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// runChannels decides the bands of the channels on the prices of the window
+// of the cycle and alerts on them, after the electricity prices were decided
+// on and applied. A channel that fails does not keep the others from
+// running; the electricity prices are recorded as a channel as well, so that
+// /status and the metrics show all of them alike.
+func runChannels(ctx context.Context, times *Times, result *cycleResult) {
+	if len(channels) == 0 {
+		return
+	}
+	electricity := channelStatus{Time: cycleClock.Now(), Prices: result.Prices}
+	if result.Decision != nil {
+		electricity.Band = result.Decision.Band
+	}
+	if result.FetchErr != nil {
+		electricity.Error = result.FetchErr.Error()
+	}
+	recordChannel(electricityChannel, electricity)
+	for _, ch := range channels {
+		recordChannel(ch.name, ch.run(ctx, times))
+	}
+}
+
+// run fetches the prices of the window, decides the band of the channel on
+// them and sends its alerts.
+func (ch *priceChannel) run(ctx context.Context, times *Times) channelStatus {
+	s := channelStatus{Time: cycleClock.Now()}
+	points, err := ote.FetchWindow(ctx, ch.source, times.start, times.end)
+	if err == nil && len(points) == 0 {
+		err = ote.ErrNoData
+	}
+	if err != nil {
+		errorLog(ctx).Printf("Error fetching the prices of the %s channel: %s\n", ch.name, err.Error())
+		s.Error = err.Error()
+		return s
+	}
+	s.Prices = ote.Prices(points)
+	price := s.Prices[len(s.Prices)-1]
+	if s.Band, err = ch.policy.Band(s.Prices); err != nil {
+		errorLog(ctx).Printf("Error deciding the band of the %s channel: %s\n", ch.name, err.Error())
+		s.Error = err.Error()
+		return s
+	}
+	infoLog(ctx).Printf("The %s channel is in the %s band at %s\n", ch.name, s.Band, display.price(price))
+	if ch.notifier != nil {
+		ch.notifier.notify(ctx, cycleClock.Now(), price, s.Band, false)
+	}
+	return s
+}
+
+// recordChannel shows the outcome of the channel in /status and the metrics,
+// labelled by channel.
+func recordChannel(name string, s channelStatus) {
+	status.setChannel(name, s)
+	if len(s.Prices) == 0 {
+		metrics.addCounter("epcp_channel_fetch_failures_total", "Number of cycles without prices by channel.", 1, "channel", name)
+	} else {
+		metrics.setGauge("epcp_channel_price", "Last price by channel.", s.Prices[len(s.Prices)-1], "channel", name)
+		metrics.setGauge("epcp_channel_last_fetch_timestamp_seconds", "Time of the last successful price fetch by channel.",
+			float64(s.Time.Unix()), "channel", name)
+	}
+	for _, band := range []string{policy.Cheap, policy.Expensive} {
+		value := 0.0
+		if band == s.Band {
+			value = 1
+		}
+		metrics.setGauge("epcp_channel_band", "Price band of the last cycle by channel.", value, "channel", name, "band", band)
+	}
+}
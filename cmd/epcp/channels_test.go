@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// twoChannels configures a gas channel on falling prices alerting above 450
+// to the webhook, and a heat channel whose source has no prices.
+func twoChannels(t *testing.T, now time.Time) *webhook {
+	t.Helper()
+	hook := newWebhook(t)
+	setGlobal(t, &webhookQueue, nil)
+	setGlobal(t, &listenAddress, "")
+	high := 450.0
+	setGlobal(t, &channels, []*priceChannel{
+		{name: "gas", source: trend(now, -10), policy: policy.Trend{},
+			notifier: &webhookNotifier{url: hook.URL, format: "slack", high: &high, period: time.Hour, channel: "gas"}},
+		{name: "heat", source: otetest.NewFake(), policy: policy.Trend{}},
+	})
+	return hook
+}
+
+// channelStatuses returns the channels of /status.
+func channelStatuses(t *testing.T) map[string]channelStatus {
+	t.Helper()
+	_, body := get(t, statusHandler(time.Hour), "/status")
+	var res statusResponse
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatal(err)
+	}
+	return res.Channels
+}
+
+func TestChannels(t *testing.T) {
+	now := time.Now()
+	tree := runOnMocks(t, trend(now, 10))
+	logs := captureLogs(t)
+	setGlobal(t, &status, &cycleStatus{started: now, frequencies: make(map[int]int)})
+	hook := twoChannels(t, now)
+
+	result := runCycle(context.Background())
+	// The actuators follow the electricity prices alone
+	if result.Decision == nil || result.Decision.Band != policy.Expensive {
+		t.Fatalf("decision %+v, want the expensive band of the electricity prices", result.Decision)
+	}
+	if got := readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")); got != "800000" {
+		t.Errorf("scaling_max_freq %s, want 800000", got)
+	}
+
+	channels := channelStatuses(t)
+	if s := channels[electricityChannel]; s.Band != policy.Expensive || len(s.Prices) != 4 || s.Error != "" {
+		t.Errorf("electricity channel %+v", s)
+	}
+	if s := channels["gas"]; s.Band != policy.Cheap || len(s.Prices) != 4 || s.Error != "" {
+		t.Errorf("gas channel %+v, want the cheap band", s)
+	}
+	if s := channels["heat"]; s.Band != "" || len(s.Prices) != 0 || !strings.Contains(s.Error, ote.ErrNoData.Error()) {
+		t.Errorf("heat channel %+v, want the error", s)
+	}
+	if messages := hook.received(); len(messages) != 1 || !strings.HasPrefix(messages[0]["text"], "gas: ") {
+		t.Errorf("posted %v, want the alert of the gas channel", messages)
+	}
+	if _, ok := state.Alerts["gas/price-high"]; !ok || len(state.Alerts) != 1 {
+		t.Errorf("alerts %v, want that of the gas channel apart", state.Alerts)
+	}
+	for _, want := range []string{
+		"The gas channel is in the cheap band at ",
+		"Error fetching the prices of the heat channel: ",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs without %q:\n%s", want, logs)
+		}
+	}
+
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	for _, want := range []string{
+		`epcp_channel_band{channel="electricity",band="expensive"} 1`,
+		`epcp_channel_band{channel="gas",band="cheap"} 1`,
+		`epcp_channel_band{channel="gas",band="expensive"} 0`,
+		`epcp_channel_band{channel="heat",band="cheap"} 0`,
+		`epcp_channel_fetch_failures_total{channel="heat"} 1`,
+		`epcp_channel_price{channel="gas"} `,
+	} {
+		if !strings.Contains(exposition.String(), want) {
+			t.Errorf("metrics without %s:\n%s", want, exposition.String())
+		}
+	}
+	if strings.Contains(exposition.String(), `epcp_channel_fetch_failures_total{channel="gas"}`) {
+		t.Errorf("failures counted on the gas channel:\n%s", exposition.String())
+	}
+}
+
+func TestChannelsIsolation(t *testing.T) {
+	now := time.Now()
+	// The electricity prices fail
+	tree := runOnMocks(t, otetest.NewFake())
+	captureLogs(t)
+	setGlobal(t, &status, &cycleStatus{started: now, frequencies: make(map[int]int)})
+	hook := twoChannels(t, now)
+
+	result := runCycle(context.Background())
+	if result.SafeMode != causeNoData {
+		t.Errorf("safe mode %q, want %s", result.SafeMode, causeNoData)
+	}
+	if got := readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")); got != "3200000" {
+		t.Errorf("scaling_max_freq %s, want the frequencies held", got)
+	}
+	channels := channelStatuses(t)
+	if s := channels[electricityChannel]; len(s.Prices) != 0 || !strings.Contains(s.Error, ote.ErrNoData.Error()) {
+		t.Errorf("electricity channel %+v, want the error", s)
+	}
+	if s := channels["gas"]; s.Band != policy.Cheap || s.Error != "" {
+		t.Errorf("gas channel %+v, want it decided regardless", s)
+	}
+	if messages := hook.received(); len(messages) != 1 {
+		t.Errorf("posted %v, want the alert of the gas channel", messages)
+	}
+
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	for _, want := range []string{
+		`epcp_channel_fetch_failures_total{channel="electricity"} 1`,
+		`epcp_channel_band{channel="gas",band="cheap"} 1`,
+	} {
+		if !strings.Contains(exposition.String(), want) {
+			t.Errorf("metrics without %s:\n%s", want, exposition.String())
+		}
+	}
+}
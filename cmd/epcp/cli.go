@@ -0,0 +1,619 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/burn"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+	"github.com/CERIT-SC/epcp-simulator/internal/pricefile"
+	"github.com/CERIT-SC/epcp-simulator/internal/store"
+	"github.com/CERIT-SC/epcp-simulator/internal/synthetic"
+)
+
+// command is a subcommand of epcp. Its flags override the environment
+// variables they mirror, which in turn override the --config file.
+type command struct {
+	name    string
+	summary string
+	// flags registers the flags of the command.
+	flags func(flags *flag.FlagSet)
+	// run runs the command with its parsed flags.
+	run func(flags *flag.FlagSet) exitCode
+	// raw commands parse their arguments themselves.
+	raw func(args []string) int
+	// standalone commands run before the configuration is loaded.
+	standalone bool
+	// report commands print their result to stdout, so logs go to stderr.
+	report bool
+}
+
+var commands = []*command{
+	{name: "fetch", summary: "fetch the recent intraday prices and print them", flags: fetchFlags, run: runFetch, report: true},
+	{name: "prices", summary: "chart the prices of a window with the alert thresholds and the band decided", flags: pricesFlags, run: runPrices, report: true},
+	{name: "scale", summary: "run one cycle: fetch prices, decide and apply the frequency", flags: cycleFlags, run: func(*flag.FlagSet) exitCode { return runCycles(false) }},
+	{name: "daemon", summary: "run a cycle every interval", flags: daemonFlags, run: func(*flag.FlagSet) exitCode { return runCycles(true) }},
+	{name: "classad", summary: "print the band as HTCondor machine ad attributes for STARTD_CRON", flags: fetchFlags, run: runClassAd, report: true},
+	{name: "plan", summary: "print the band schedule from the day-ahead prices", flags: planFlags, run: runPlan, report: true},
+	{name: "backtest", summary: "replay the decisions over the intraday prices of a past day", flags: backtestFlags, run: runBacktest, report: true},
+	{name: "simulate", summary: "run the daemon loop on a simulated clock over --from to --to", flags: simulateFlags, run: runSimulate, report: true},
+	{name: "montecarlo", summary: "evaluate a policy over perturbations of the prices of a past day", flags: montecarloFlags, run: runMontecarlo, report: true},
+	{name: "synth", summary: "generate synthetic prices for the file source", flags: synthCommandFlags, run: runSynth, report: true},
+	{name: "burn", summary: "load CPUs to show the effect of scaling on power meters", flags: burnFlags, run: runBurn},
+	{name: "restore", summary: "restore the frequencies recorded before the first change and undo the other actuators", flags: restoreFlags, run: runRestore},
+	{name: "cpus", summary: "print the cpufreq state of the CPUs from sysfs, without fetching prices", flags: cpusFlags, run: runCPUs, report: true},
+	{name: "decisions", summary: "print the decisions of the decision log, filtered by time, band and reason", flags: decisionsFlags, run: runDecisions, report: true},
+	{name: "report", summary: "print the hours, energy and cost of a month or week from the decision log", flags: reportFlags, run: runReport, report: true},
+	{name: "aggregate", summary: "poll the status endpoints of several nodes and print or serve them merged", flags: aggregateFlags, run: runAggregate, report: true},
+	{name: "bootstrap", summary: "backfill the history with the day-ahead prices of the last days", flags: bootstrapFlags, run: runBootstrap},
+	{name: "history", summary: "import prices into the history or compact it, see epcp history -h", raw: runHistory},
+	{name: "ctl", summary: "control a running daemon, see epcp ctl -h", raw: runCtl},
+	{name: "config", summary: "validate the configuration file or dump the effective configuration", raw: runConfig, standalone: true},
+	{name: "apply-helper", summary: "privileged helper doing the sysfs writes, see epcp apply-helper -h", raw: runApplyHelper, standalone: true},
+}
+
+var (
+	dryRun        bool
+	skipPreflight bool
+)
+
+// run parses the command line and runs the subcommand. Without one, a single
+// cycle is run, or the daemon when EPCP_INTERVAL is set.
+func run() exitCode {
+	global := flag.NewFlagSet("epcp", flag.ContinueOnError)
+	logLevel := global.String("log-level", "info", "log level, info or error")
+	global.StringVar(&configPath, "config", "", "YAML or TOML configuration `file`")
+	global.BoolVar(&dryRun, "dry-run", false, "decide, but only log the writes instead of doing them")
+	global.BoolVar(&skipPreflight, "skip-preflight", false, "do not check sysfs writability and the actuators before fetching prices")
+	showVersion := global.Bool("version", false, "print the version and exit")
+	global.Usage = func() { usage(global) }
+	if err := global.Parse(os.Args[1:]); err != nil {
+		return parseExitCode(err)
+	}
+	if *showVersion {
+		fmt.Println(getBuildInfo())
+		return exitOK
+	}
+	if *logLevel != "info" && *logLevel != "error" {
+		fmt.Fprintf(global.Output(), "invalid log level %q\n", *logLevel)
+		global.Usage()
+		return exitUsage
+	}
+	var cmd *command
+	if global.NArg() != 0 {
+		for _, c := range commands {
+			if c.name == global.Arg(0) {
+				cmd = c
+			}
+		}
+		if cmd == nil {
+			fmt.Fprintf(global.Output(), "unknown command %q\n", global.Arg(0))
+			global.Usage()
+			return exitUsage
+		}
+	}
+	if cmd != nil && cmd.standalone {
+		return exitCode(cmd.raw(global.Args()[1:]))
+	}
+	flags := flag.NewFlagSet("epcp", flag.ContinueOnError)
+	if cmd != nil && cmd.raw == nil {
+		flags = flag.NewFlagSet("epcp "+cmd.name, flag.ContinueOnError)
+		cmd.flags(flags)
+		flags.Usage = func() {
+			fmt.Fprintf(flags.Output(), "Usage: epcp [global flags] %s [flags]\n\nFlags:\n", cmd.name)
+			flags.PrintDefaults()
+		}
+		if err := flags.Parse(global.Args()[1:]); err != nil {
+			return parseExitCode(err)
+		}
+		if flags.NArg() != 0 {
+			fmt.Fprintf(flags.Output(), "unexpected argument %q\n", flags.Arg(0))
+			flags.Usage()
+			return exitUsage
+		}
+	}
+	if cmd != nil && cmd.report {
+		infoLogger.SetOutput(os.Stderr)
+	}
+	if err := configure(); err != nil {
+		errorLogger.Printf("Invalid configuration, not starting:\n%s\n", err.Error())
+		return exitConfig
+	}
+	if *logLevel == "error" {
+		infoLogger.SetOutput(io.Discard)
+	}
+	switch {
+	case cmd == nil:
+		return runCycles(cycleInterval > 0)
+	case cmd.raw != nil:
+		return exitCode(cmd.raw(global.Args()[1:]))
+	}
+	return cmd.run(flags)
+}
+
+// usage prints the commands and the global flags.
+func usage(global *flag.FlagSet) {
+	out := global.Output()
+	fmt.Fprintln(out, "Usage: epcp [global flags] [command] [flags]")
+	fmt.Fprintln(out, "\nWithout a command, one cycle is run, or the daemon when EPCP_INTERVAL is set.")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-14s%s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(out, "\nGlobal flags:")
+	global.PrintDefaults()
+}
+
+// parseExitCode is the exit code after a flag parsing error; -h is not one.
+func parseExitCode(err error) exitCode {
+	if e.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+// envFlag is a flag that sets the environment variable env, so that it takes
+// precedence over it. Its kind, "string", "bool" or "duration", is checked
+// when parsing; booleans are stored as "1" or "0".
+type envFlag struct {
+	env  string
+	kind string
+}
+
+func (f *envFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return getenv(f.env)
+}
+
+func (f *envFlag) Set(value string) error {
+	switch f.kind {
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		value = "0"
+		if b {
+			value = "1"
+		}
+	case "duration":
+		if _, err := time.ParseDuration(value); err != nil {
+			return err
+		}
+	}
+	return os.Setenv(f.env, value)
+}
+
+func (f *envFlag) IsBoolFlag() bool {
+	return f.kind == "bool"
+}
+
+// envVar registers the flag name overriding the environment variable env.
+func envVar(flags *flag.FlagSet, name, env, kind, usage string) {
+	flags.Var(&envFlag{env: env, kind: kind}, name, usage+" ($"+env+")")
+}
+
+func sourceFlags(flags *flag.FlagSet) {
+	envVar(flags, "source", "EPCP_SOURCE", "string", "where the prices come from, ote (default), file, synthetic, peer or profile")
+	envVar(flags, "wsdl", "EPCP_WSDL", "string", "`URL` of the OTE public data service")
+	envVar(flags, "price-file", "EPCP_PRICE_FILE", "string", "CSV or JSON `file` of the prices of the file source")
+	envVar(flags, "peer-url", "EPCP_PEER_URL", "string", "`URL` of the prices endpoint of the leader of the peer source")
+	synthFlags(flags)
+}
+
+func synthFlags(flags *flag.FlagSet) {
+	envVar(flags, "synth-base", "EPCP_SYNTH_BASE", "string", "mean `price` of the synthetic source (default 100)")
+	envVar(flags, "synth-amplitude", "EPCP_SYNTH_AMPLITUDE", "string", "daily swing of the synthetic `price` (default 40)")
+	envVar(flags, "synth-peak-hour", "EPCP_SYNTH_PEAK_HOUR", "string", "`hour` of the day the synthetic price peaks (default 18)")
+	envVar(flags, "synth-noise", "EPCP_SYNTH_NOISE", "string", "standard deviation of the synthetic price noise (default 5)")
+	envVar(flags, "synth-spikes", "EPCP_SYNTH_SPIKES", "string", "`probability` of a synthetic price spike in an hour (default 0.01)")
+	envVar(flags, "synth-seed", "EPCP_SYNTH_SEED", "string", "`seed` of the synthetic prices")
+}
+
+func synthCommandFlags(flags *flag.FlagSet) {
+	synthFlags(flags)
+	flags.String("date", "", "first day to generate as YYYY-MM-DD (default today)")
+	flags.Int("days", 7, "number of days to generate")
+	flags.String("out", "", "CSV `file` to write, consumable by the file source (default stdout)")
+}
+
+func fetchFlags(flags *flag.FlagSet) {
+	envVar(flags, "hours", "EPCP_HOURS", "string", "`hours` of price history to fetch, as a number or a duration, 1h to 168h")
+	sourceFlags(flags)
+}
+
+func cycleFlags(flags *flag.FlagSet) {
+	fetchFlags(flags)
+	restoreFlags(flags)
+	envVar(flags, "decision-log", "EPCP_DECISION_LOG", "string", "`file` to append the decisions to as JSON lines")
+	envVar(flags, "lock-wait", "EPCP_LOCK_WAIT", "duration", "`duration` to wait for another instance")
+	envVar(flags, "jitter", "EPCP_JITTER", "duration", "maximum host-specific `delay` before fetching")
+	envVar(flags, "strict", "EPCP_STRICT", "bool", "fail when any CPU rejects the frequency")
+	envVar(flags, "require-sysfs", "EPCP_REQUIRE_SYSFS", "bool", "fail instead of simulating without cpufreq")
+	envVar(flags, "restore-on-exit", "EPCP_RESTORE_ON_EXIT", "bool", "restore the original frequencies when the daemon stops or a run fails")
+	envVar(flags, "textfile", "EPCP_TEXTFILE", "string", "`file` to write the metrics to for the textfile collector")
+}
+
+func daemonFlags(flags *flag.FlagSet) {
+	cycleFlags(flags)
+	envVar(flags, "interval", "EPCP_INTERVAL", "duration", "`duration` between cycles (default 1h)")
+	envVar(flags, "eval-offset", "EPCP_EVAL_OFFSET", "duration", "`duration` into each interval to run the cycles at")
+	envVar(flags, "listen", "EPCP_LISTEN", "string", "`address` of the status endpoint")
+	envVar(flags, "serve-prices", "EPCP_SERVE_PRICES", "bool", "serve the fetched prices to followers on /prices of the status endpoint")
+	envVar(flags, "debug-listen", "EPCP_DEBUG_LISTEN", "string", "`address` of the pprof and expvar endpoint")
+	envVar(flags, "control-socket", "EPCP_CONTROL_SOCKET", "string", "`path` of the control socket")
+}
+
+func planFlags(flags *flag.FlagSet) {
+	sourceFlags(flags)
+	flags.String("date", "", "day of the schedule as YYYY-MM-DD (default tomorrow)")
+}
+
+func backtestFlags(flags *flag.FlagSet) {
+	planFlags(flags)
+	flags.Lookup("date").Usage = "day to replay as YYYY-MM-DD (default yesterday)"
+	flags.Int("window", 4, "number of hourly prices each decision is based on")
+	flags.String("policies", "", "comma-separated `policies` to compare instead of replaying the decisions")
+	flags.String("format", "table", "format of the comparison, table or json")
+}
+
+func burnFlags(flags *flag.FlagSet) {
+	flags.String("cpus", "", "`list` of CPUs to load, e.g. 0-3,6 (default all)")
+	flags.Duration("duration", 0, "how long to load the CPUs (default until interrupted)")
+	flags.Float64("load", 100, "target utilization of each CPU in `percent`")
+}
+
+func restoreFlags(flags *flag.FlagSet) {
+	envVar(flags, "sysfs-root", "EPCP_SYSFS_ROOT", "string", "`directory` where sysfs is mounted (default /sys)")
+	envVar(flags, "state-dir", "EPCP_STATE_DIR", "string", "`directory` of the state file")
+	envVar(flags, "apply-helper", "EPCP_APPLY_HELPER", "string", "helper `command` doing the sysfs writes")
+	envVar(flags, "apply-socket", "EPCP_APPLY_SOCKET", "string", "`socket` of the helper doing the sysfs writes")
+}
+
+// prepare acquires the lock, selects the actuator and loads the state for
+// the cycles. The returned lock is nil when they must not run.
+func prepare(ctx context.Context) (*store.Lock, exitCode) {
+	lock, code := acquireLock(ctx)
+	if lock == nil {
+		return nil, code
+	}
+	if !cpufreqAvailable() {
+		if requireSysfs {
+			errorLogger.Println("No cpufreq interface found and EPCP_REQUIRE_SYSFS=1, exiting.")
+			lock.Release()
+			return nil, exitPreflight
+		}
+		infoLogger.Println("No cpufreq interface found, only simulating frequency changes.")
+		enableSimulation()
+	}
+	frequencyActuator = selectActuator()
+	if !skipPreflight && !simulate && !dryRun {
+		if err := preflight(); err != nil {
+			errorLogger.Printf("Preflight checks failed (use --skip-preflight to ignore):\n%s\n", err.Error())
+			lock.Release()
+			return nil, exitPreflight
+		}
+	}
+	loadState()
+	openDecisionLog()
+	return lock, exitOK
+}
+
+// acquireLock acquires the lock of the state, waiting up to lockWait. The
+// returned lock is nil when it was not acquired, with exitOK when ctx was
+// cancelled meanwhile, e.g. by SIGTERM.
+func acquireLock(ctx context.Context) (*store.Lock, exitCode) {
+	lock, err := store.Acquire(ctx, lockFile(), lockWait)
+	switch {
+	case err == nil:
+		return lock, exitOK
+	case e.Is(err, store.ErrLocked):
+		errorLogger.Printf("Lock %s is held by another instance, exiting.\n", lockFile())
+		return nil, exitLocked
+	case ctx.Err() != nil:
+		infoLogger.Printf("Stopped waiting for lock %s, exiting.\n", lockFile())
+		return nil, exitOK
+	}
+	errorLogger.Printf("Error acquiring lock %s: %s\n", lockFile(), err.Error())
+	return nil, exitFailure
+}
+
+// runCycles runs one cycle, or the daemon.
+func runCycles(daemon bool) exitCode {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := trapSignals(cancel)
+	info := getBuildInfo()
+	infoLogger.Printf("Starting %s\n", info)
+	recordBuildInfo(info)
+	infoLogger.Printf("Configuration: %s\n", configBanner(effectiveConfig))
+	logTimezone()
+	lock, code := prepare(ctx)
+	if lock == nil {
+		return code
+	}
+	defer lock.Release()
+	if daemon {
+		if cycleInterval <= 0 {
+			cycleInterval = time.Hour
+		}
+		runDaemon(ctx, cycleInterval)
+	} else if sleepJitter(ctx) {
+		ready := false
+		result := runCycle(ctx)
+		notifyCycle(result, &ready)
+		code = result.exitCode()
+	}
+	if sig := signals.received(); sig != nil {
+		code = signalExitCode(sig)
+	}
+	// A one-shot run keeps the frequencies it applied unless it failed or
+	// was interrupted
+	shutdown(restoreOnExit && (daemon || code != exitOK))
+	return code
+}
+
+func runFetch(*flag.FlagSet) exitCode {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trapSignals(cancel)
+	points, err := getElectrictyPrices(ctx, getTimeRange())
+	if e.Is(err, ote.ErrNoData) {
+		errorLogger.Println("No prices available for the window.")
+		return exitInsufficientData
+	}
+	if err != nil {
+		errorLogger.Printf("Error fetching prices: %s\n", err.Error())
+		return exitFetchFailed
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "DATE\tHOUR\t%s\tVOLUME\tPROVISIONAL\n", display.column())
+	for _, p := range points {
+		provisional := ""
+		if p.Provisional {
+			provisional = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%.1f\t%s\n", p.Date, p.Hour, display.value(p.Price), p.Volume, provisional)
+	}
+	w.Flush()
+	return exitOK
+}
+
+func runClassAd(*flag.FlagSet) exitCode {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trapSignals(cancel)
+	points, err := getElectrictyPrices(ctx, getTimeRange())
+	if err != nil && !e.Is(err, ote.ErrNoData) {
+		errorLogger.Printf("Error fetching prices: %s\n", err.Error())
+		return exitFetchFailed
+	}
+	prices := ote.Prices(points)
+	settled := settledPoints(points)
+	decision := decideFrequency(ctx, adjustForSolar(ctx, settled))
+	if decision == nil {
+		return exitInsufficientData
+	}
+	logTrend(ctx, decision)
+	adjustForProvisional(decision, settled)
+	adjustForBattery(ctx, decision)
+	if err := writeClassAd(os.Stdout, decision, lastPrice(&cycleResult{Prices: prices})); err != nil {
+		errorLogger.Printf("Error writing the machine ad: %s\n", err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
+
+// dateFlag returns the date flag, or the day offset days from today.
+func dateFlag(flags *flag.FlagSet, offset int) (string, error) {
+	date := flags.Lookup("date").Value.String()
+	if date == "" {
+		return ote.AddDays(ote.Day(time.Now()), offset)
+	}
+	_, err := time.Parse(time.DateOnly, date)
+	return date, err
+}
+
+func runPlan(flags *flag.FlagSet) exitCode {
+	date, err := dateFlag(flags, 1)
+	if err != nil {
+		errorLogger.Printf("Error parsing date: %s\n", err.Error())
+		return exitUsage
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trapSignals(cancel)
+	prices, err := getDamPriceE(ctx, date, date)
+	if e.Is(err, ote.ErrNoData) {
+		errorLogger.Printf("Day-ahead prices for %s are not published yet.\n", date)
+		return exitInsufficientData
+	}
+	if err != nil {
+		errorLogger.Printf("Error fetching day-ahead prices: %s\n", err.Error())
+		return exitFetchFailed
+	}
+	schedule := newDamSchedule(date, prices)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "HOUR\t%s\tBAND\n", display.column())
+	for i, price := range schedule.Prices {
+		// The prices are of the trading hours 1 to 23, 24 or 25 of the day
+		start, _ := ote.HourStart(date, i+1)
+		fmt.Fprintf(w, "%s\t%s\t%s\n", start.In(ote.Location()).Format("15:04"), display.value(price), schedule.Bands[i])
+	}
+	w.Flush()
+	return exitOK
+}
+
+// backtestPrices fetches the intraday prices of the day to replay, at least
+// window of them.
+func backtestPrices(ctx context.Context, date string, window int) ([]ote.PricePoint, exitCode) {
+	if !simulate && !cpufreqAvailable() {
+		enableSimulation()
+	}
+	hours, _ := ote.HoursIn(date)
+	start, _ := ote.HourStart(date, 1)
+	end, _ := ote.HourStart(date, hours)
+	points, err := getElectrictyPrices(ctx, &Times{start: start, end: end})
+	if err != nil && !e.Is(err, ote.ErrNoData) {
+		errorLogger.Printf("Error fetching prices: %s\n", err.Error())
+		return nil, exitFetchFailed
+	}
+	if len(points) < window {
+		errorLogger.Printf("Only %d prices available for %s.\n", len(points), date)
+		return nil, exitInsufficientData
+	}
+	return points, exitOK
+}
+
+func runBacktest(flags *flag.FlagSet) exitCode {
+	date, err := dateFlag(flags, -1)
+	if err != nil {
+		errorLogger.Printf("Error parsing date: %s\n", err.Error())
+		return exitUsage
+	}
+	window, _ := strconv.Atoi(flags.Lookup("window").Value.String())
+	if window < 2 {
+		errorLogger.Println("The window must be at least 2 prices.")
+		return exitUsage
+	}
+	format := flags.Lookup("format").Value.String()
+	if format != "table" && format != "json" {
+		errorLogger.Printf("Unknown format %q, expected table or json.\n", format)
+		return exitUsage
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trapSignals(cancel)
+	points, code := backtestPrices(ctx, date, window)
+	if code != exitOK {
+		return code
+	}
+	prices := ote.Prices(points)
+	if names := flags.Lookup("policies").Value.String(); names != "" {
+		comparisons, err := comparePolicies(strings.Split(names, ","), prices, window, backtestMachine())
+		if err != nil {
+			errorLogger.Printf("Error selecting the policies: %s\n", err.Error())
+			return exitUsage
+		}
+		if err := printComparisons(os.Stdout, comparisons, format == "json"); err != nil {
+			errorLogger.Printf("Error writing the comparison: %s\n", err.Error())
+			return exitFailure
+		}
+		return exitOK
+	}
+	expensive, decided := 0, 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "HOUR\t%s\tBAND\tFREQUENCY\n", display.column())
+	for i := window - 1; i < len(points); i++ {
+		decision := decideFrequency(ctx, prices[i-window+1:i+1])
+		if decision == nil {
+			fmt.Fprintf(w, "%d\t%s\tcannot decide\t-\n", points[i].Hour, display.value(points[i].Price))
+			continue
+		}
+		decided++
+		if decision.Band == policy.Expensive {
+			expensive++
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\n", points[i].Hour, display.value(points[i].Price), decision.Band, decision.Frequency)
+	}
+	w.Flush()
+	fmt.Printf("%d of %d hours expensive\n", expensive, decided)
+	return exitOK
+}
+
+func runSynth(flags *flag.FlagSet) exitCode {
+	date, err := dateFlag(flags, 0)
+	if err != nil {
+		errorLogger.Printf("Error parsing date: %s\n", err.Error())
+		return exitUsage
+	}
+	days, _ := strconv.Atoi(flags.Lookup("days").Value.String())
+	if days < 1 {
+		errorLogger.Println("At least one day must be generated.")
+		return exitUsage
+	}
+	last, _ := ote.AddDays(date, days-1)
+	source := synthetic.New(effectiveConfig.Source.Synthetic.params())
+	points, err := source.DamPrices(context.Background(), date, last)
+	if err != nil {
+		errorLogger.Printf("Error generating prices: %s\n", err.Error())
+		return exitFailure
+	}
+	out := os.Stdout
+	if path := flags.Lookup("out").Value.String(); path != "" {
+		if out, err = os.Create(path); err != nil {
+			errorLogger.Printf("Error creating %s: %s\n", path, err.Error())
+			return exitFailure
+		}
+		defer out.Close()
+	}
+	if err := pricefile.WriteCSV(out, points); err != nil {
+		errorLogger.Printf("Error writing prices: %s\n", err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runBurn(flags *flag.FlagSet) exitCode {
+	cpus := hostCPUs()
+	if list := flags.Lookup("cpus").Value.String(); list != "" {
+		var err error
+		if cpus, err = burn.ParseCPUs(list); err != nil {
+			errorLogger.Printf("Error parsing --cpus: %s\n", err.Error())
+			return exitUsage
+		}
+	}
+	duration, _ := time.ParseDuration(flags.Lookup("duration").Value.String())
+	load, _ := strconv.ParseFloat(flags.Lookup("load").Value.String(), 64)
+	if duration < 0 || load <= 0 || load > 100 {
+		errorLogger.Println("The duration must not be negative and the load must be 1 to 100 percent.")
+		return exitUsage
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := trapSignals(cancel)
+	if duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+	infoLogger.Printf("Loading CPUs %v to %g%%\n", cpus, load)
+	if err := burn.Run(ctx, cpus, load); err != nil {
+		errorLogger.Printf("Error pinning the load, running unpinned: %s\n", err.Error())
+	}
+	if sig := signals.received(); sig != nil {
+		return signalExitCode(sig)
+	}
+	return exitOK
+}
+
+func runRestore(*flag.FlagSet) exitCode {
+	lock, code := prepare(context.Background())
+	if lock == nil {
+		return code
+	}
+	defer lock.Release()
+	defer closeDecisionLog()
+	if len(state.OriginalFrequencies) == 0 {
+		infoLogger.Println("No original frequencies recorded, restoring the other actuators only.")
+	}
+	restoreActuators()
+	if dryRun {
+		return exitOK
+	}
+	if err := saveState(); err != nil {
+		errorLogger.Printf("Error saving state file: %s\n", err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+	"github.com/CERIT-SC/epcp-simulator/internal/store"
+)
+
+// useStateDir makes the test keep its state and lock in dir.
+func useStateDir(t *testing.T, dir string) {
+	t.Helper()
+	config := *effectiveConfig
+	config.State.Dir = dir
+	setGlobal(t, &effectiveConfig, &config)
+	setGlobal(t, &stateDir, dir)
+}
+
+func TestAcquireLock(t *testing.T) {
+	tests := []struct {
+		name string
+		// held holds the lock for the length of the test
+		held bool
+		wait time.Duration
+		// cancel cancels the context while waiting
+		cancel bool
+		// notDir makes the state directory a file
+		notDir bool
+		want   exitCode
+		locked bool
+	}{
+		{name: "free", want: exitOK, locked: true},
+		{name: "held", held: true, wait: 200 * time.Millisecond, want: exitLocked},
+		{name: "interrupted", held: true, wait: time.Minute, cancel: true, want: exitOK},
+		{name: "unopenable", notDir: true, want: exitFailure},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if test.notDir {
+				dir = filepath.Join(dir, "state")
+				if err := os.WriteFile(dir, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+				dir = filepath.Join(dir, "epcp")
+			}
+			useStateDir(t, dir)
+			setGlobal(t, &lockWait, test.wait)
+			if test.held {
+				held, err := store.Acquire(context.Background(), lockFile(), 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer held.Release()
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if test.cancel {
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+			start := time.Now()
+			lock, code := acquireLock(ctx)
+			if lock != nil {
+				lock.Release()
+			}
+			if code != test.want || (lock != nil) != test.locked {
+				t.Errorf("got lock %t and exit code %d, want %t and %d", lock != nil, code, test.locked, test.want)
+			}
+			if elapsed := time.Since(start); test.cancel && elapsed > 10*time.Second {
+				t.Errorf("returned %s after the cancellation", elapsed)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	setGlobal(t, &os.Stdout, devNull)
+	setGlobal(t, &os.Stderr, devNull)
+	setGlobal(t, &configPath, "")
+	setGlobal(t, &dryRun, false)
+	setGlobal(t, &skipPreflight, false)
+	tests := []struct {
+		args []string
+		want exitCode
+	}{
+		{[]string{"-version"}, exitOK},
+		{[]string{"-h"}, exitOK},
+		{[]string{"-unknown"}, exitUsage},
+		{[]string{"-log-level", "debug"}, exitUsage},
+		{[]string{"unknown"}, exitUsage},
+		{[]string{"plan", "-h"}, exitOK},
+		{[]string{"plan", "-unknown"}, exitUsage},
+		{[]string{"plan", "tomorrow"}, exitUsage},
+		{[]string{"daemon", "-interval", "hourly"}, exitUsage},
+		{[]string{"scale", "-strict=maybe"}, exitUsage},
+		{[]string{"-config", filepath.Join(t.TempDir(), "missing.yaml"), "plan"}, exitConfig},
+	}
+	for _, test := range tests {
+		setGlobal(t, &os.Args, append([]string{"epcp"}, test.args...))
+		if code := run(); code != test.want {
+			t.Errorf("epcp %v: exit code %d, want %d", test.args, code, test.want)
+		}
+	}
+}
+
+func TestEnvFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		env  map[string]string
+		// fails means the arguments are rejected
+		fails bool
+	}{
+		{args: []string{"-hours", "6"}, env: map[string]string{"EPCP_HOURS": "6"}},
+		{args: []string{"-strict"}, env: map[string]string{"EPCP_STRICT": "1"}},
+		{args: []string{"-strict=false", "-require-sysfs=true"}, env: map[string]string{"EPCP_STRICT": "0", "EPCP_REQUIRE_SYSFS": "1"}},
+		{args: []string{"-lock-wait", "30s", "-state-dir=/var/lib/epcp"}, env: map[string]string{"EPCP_LOCK_WAIT": "30s", "EPCP_STATE_DIR": "/var/lib/epcp"}},
+		{args: []string{"-interval", "15m", "-listen", ":9100"}, env: map[string]string{"EPCP_INTERVAL": "15m", "EPCP_LISTEN": ":9100"}},
+		{args: []string{"-interval", "hourly"}, fails: true},
+		{args: []string{"-strict=maybe"}, fails: true},
+	}
+	for _, test := range tests {
+		// The variables set by the flags are restored after the test
+		for _, env := range []string{"EPCP_HOURS", "EPCP_STRICT", "EPCP_REQUIRE_SYSFS", "EPCP_LOCK_WAIT", "EPCP_STATE_DIR", "EPCP_INTERVAL", "EPCP_LISTEN"} {
+			t.Setenv(env, "unset")
+		}
+		flags := flag.NewFlagSet("epcp daemon", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		daemonFlags(flags)
+		err := flags.Parse(test.args)
+		if (err != nil) != test.fails {
+			t.Errorf("%v: got error %v, want one %t", test.args, err, test.fails)
+			continue
+		}
+		for env, want := range test.env {
+			if got := os.Getenv(env); got != want {
+				t.Errorf("%v: %s=%q, want %q", test.args, env, got, want)
+			}
+		}
+	}
+	// The flags take the values of the environment as defaults
+	t.Setenv("EPCP_HOURS", "12")
+	flags := flag.NewFlagSet("epcp", flag.ContinueOnError)
+	fetchFlags(flags)
+	if got := flags.Lookup("hours").Value.String(); got != "12" {
+		t.Errorf("-hours is %q with EPCP_HOURS=12, want %q", got, "12")
+	}
+}
+
+func TestPrepareWithoutCpufreq(t *testing.T) {
+	tests := []struct {
+		requireSysfs bool
+		want         exitCode
+	}{
+		{false, exitOK},
+		{true, exitPreflight},
+	}
+	for _, test := range tests {
+		logs := captureLogs(t)
+		useStateDir(t, t.TempDir())
+		// An empty sysfs, as in a container
+		useSysfs(t, actuator.OSFS{})
+		setGlobal(t, &sysfsRoot, t.TempDir())
+		setGlobal(t, &simulate, false)
+		setGlobal(t, &dryRun, false)
+		setGlobal(t, &decisionLog, "")
+		setGlobal(t, &requireSysfs, test.requireSysfs)
+		lock, code := prepare(context.Background())
+		if lock != nil {
+			lock.Release()
+		}
+		if code != test.want || (lock != nil) != (test.want == exitOK) {
+			t.Errorf("EPCP_REQUIRE_SYSFS=%t: got lock %t and exit code %d, want %d", test.requireSysfs, lock != nil, code, test.want)
+		}
+		if test.requireSysfs {
+			if simulate || !strings.Contains(logs.String(), "No cpufreq interface found and EPCP_REQUIRE_SYSFS=1") {
+				t.Errorf("EPCP_REQUIRE_SYSFS=1: simulating %t, want a fatal error:\n%s", simulate, logs)
+			}
+			continue
+		}
+		// The decisions are applied to a simulated tree
+		if _, ok := frequencyActuator.(actuator.Simulation); !simulate || !ok {
+			t.Fatalf("simulating %t with actuator %T, want the simulation", simulate, frequencyActuator)
+		}
+		decision := applyDecision(context.Background(), &Decision{Band: policy.Expensive, Frequency: 800000})
+		if len(decision.Summary.Succeeded) == 0 || len(decision.Summary.Failed) != 0 {
+			t.Errorf("summary %s, want every CPU scaled", decision.Summary)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// clock tells the time the cycles and everything scheduled with them follow.
+// The simulate command replaces the real clock with a simulated one.
+type clock interface {
+	Now() time.Time
+	// After sends the time on the channel once d has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+var cycleClock clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// simulatedClock runs speed times faster than the real time, starting at
+// now. Its timers fire in order, and only once all its waiters, the goroutines
+// using it, wait for one, so that they see exactly the time they were
+// scheduled at however fast the clock runs. Once the next timer would reach
+// end, stop is called instead.
+type simulatedClock struct {
+	mu      sync.Mutex
+	waiting *sync.Cond
+	now     time.Time
+	end     time.Time
+	speed   float64
+	waiters int
+	stop    func()
+	timers  []simulatedTimer
+}
+
+type simulatedTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// newSimulatedClock returns a running simulated clock, see simulatedClock.
+func newSimulatedClock(now, end time.Time, speed float64, waiters int, stop func()) *simulatedClock {
+	c := &simulatedClock{now: now, end: end, speed: speed, waiters: waiters, stop: stop}
+	c.waiting = sync.NewCond(&c.mu)
+	go c.run()
+	return c
+}
+
+func (c *simulatedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *simulatedClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, simulatedTimer{at: c.now.Add(max(d, 0)), ch: ch})
+	c.waiting.Signal()
+	return ch
+}
+
+// run fires the timers in the order of their time, each after the real time
+// corresponding to the simulated one passed.
+func (c *simulatedClock) run() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		for len(c.timers) < c.waiters {
+			c.waiting.Wait()
+		}
+		next := 0
+		for i, t := range c.timers {
+			if t.at.Before(c.timers[next].at) {
+				next = i
+			}
+		}
+		t := c.timers[next]
+		if !t.at.Before(c.end) {
+			c.stop()
+			return
+		}
+		// Nobody can add a timer while all the waiters wait
+		c.mu.Unlock()
+		time.Sleep(time.Duration(float64(t.at.Sub(c.now)) / c.speed))
+		c.mu.Lock()
+		c.timers = append(c.timers[:next], c.timers[next+1:]...)
+		c.now = t.at
+		t.ch <- t.at
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/CERIT-SC/epcp-simulator/internal/coalesce"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// coalescedSource coalesces the requests for the prices within each cycle,
+// see coalesce.Source.
+var coalescedSource *coalesce.Source
+
+// coalescingSource returns the source sharing the overlapping requests of a
+// cycle to source.
+func coalescingSource(source ote.PriceSource) ote.PriceSource {
+	s := coalesce.New(source)
+	s.OnShared = func(market string) {
+		metrics.addCounter("epcp_price_requests_coalesced_total", "Number of price requests served by another request of the cycle.", 1, "market", market)
+	}
+	coalescedSource = s
+	return s
+}
+
+// resetCoalescing starts a new cycle of coalesced requests, so that each
+// cycle fetches the prices afresh.
+func resetCoalescing() {
+	if coalescedSource != nil {
+		coalescedSource.Reset()
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+func TestCoalescingSource(t *testing.T) {
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	setGlobal(t, &coalescedSource, nil)
+	upstream := otetest.NewFake().AddImPrices(otetest.Points("2024-10-01", 1, 10, 20, 30), nil)
+	source := coalescingSource(upstream)
+	ctx := context.Background()
+	for _, hours := range [][2]int{{1, 3}, {2, 3}, {1, 1}} {
+		if _, err := source.ImPrices(ctx, "2024-10-01", hours[0], hours[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	if !strings.Contains(exposition.String(), `epcp_price_requests_coalesced_total{market="intraday"} 2`+"\n") || len(upstream.Calls()) != 1 {
+		t.Errorf("%d calls, metrics:\n%s", len(upstream.Calls()), exposition.String())
+	}
+
+	// Each cycle fetches afresh
+	resetCoalescing()
+	if _, err := source.ImPrices(ctx, "2024-10-01", 1, 1); err != nil || len(upstream.Calls()) != 2 {
+		t.Errorf("%d calls after the reset, %v, want another", len(upstream.Calls()), err)
+	}
+}
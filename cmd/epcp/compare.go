@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// policyComparison is how a policy fared over the prices of a backtest. The
+// energy and the cost are estimated with the machine model of the
+// simulations, the cost from the price of each hour.
+type policyComparison struct {
+	Policy string `json:"policy"`
+	// Hours maps the bands to the number of hours decided in them
+	Hours   map[string]int `json:"hours"`
+	Energy  float64        `json:"energyKwh"`
+	Cost    float64        `json:"cost"`
+	Changes int            `json:"changes"`
+	// Throttled counts the hours below the highest frequency
+	Throttled int `json:"throttledHours"`
+	// MaxThrottled is the longest run of hours below the highest frequency
+	MaxThrottled int `json:"maxThrottledHours"`
+}
+
+// backtestMachine is the simulated machine with the frequencies of the CPUs.
+func backtestMachine() MachineConfig {
+	machine := defaultMachine()
+	if frequencies := availableFrequencies(); len(frequencies) != 0 {
+		machine.Frequencies = frequencies
+	}
+	return machine
+}
+
+// replayDayHours returns the number of hours of the days of the prices
+// replayed: the prices of a single day of 23 to 25 hours, as those of a
+// backtest, are one day, longer series days of 24 hours.
+func replayDayHours(prices []float64) int {
+	if len(prices) <= 25 {
+		return max(len(prices), 1)
+	}
+	return 24
+}
+
+// comparePolicy replays the decisions of p over the prices, each based on
+// the window of prices up to the hour. Peak shaving plans on the prices of
+// the whole day instead, throttling at most its budget of hours a day, as
+// the cycles do, see adjustForPeakShaving. The machine starts at its
+// highest frequency; a nil p keeps it there.
+func comparePolicy(name string, p policy.Policy, prices []float64, window int, machine MachineConfig) policyComparison {
+	highest := 0
+	for _, f := range machine.Frequencies {
+		highest = max(highest, f)
+	}
+	c := policyComparison{Policy: name, Hours: make(map[string]int)}
+	frequency, throttled := highest, 0
+	shaving, planned := p.(policy.PeakShaving)
+	dayHours, day, shaved := replayDayHours(prices), -1, []int(nil)
+	for i := window - 1; i < len(prices); i++ {
+		band := policy.Cheap
+		switch {
+		case planned:
+			if i/dayHours != day {
+				day, shaved = i/dayHours, nil
+			}
+			start := day * dayHours
+			if shaving.Shave(prices[start:min(start+dayHours, len(prices))], i-start, shaved) {
+				band = policy.Expensive
+				shaved = append(shaved, i-start)
+			}
+		case p != nil:
+			var err error
+			if band, err = p.Band(prices[i-window+1 : i+1]); err != nil {
+				continue
+			}
+		}
+		c.Hours[band]++
+		next := policy.Frequency(band, machine.Frequencies)
+		if next != frequency {
+			c.Changes++
+		}
+		frequency = next
+		if frequency < highest {
+			c.Throttled++
+			throttled++
+			c.MaxThrottled = max(c.MaxThrottled, throttled)
+		} else {
+			throttled = 0
+		}
+		energy := machine.watts(frequency) / 1000
+		c.Energy += energy
+		// The prices are per MWh
+		c.Cost += energy * prices[i] / 1000
+	}
+	return c
+}
+
+// namedPolicy returns the policy name, with the parameters of the
+// configuration when it is the configured one.
+func namedPolicy(name string) (policy.Policy, error) {
+	config := PolicyConfig{Name: name}
+	if name == effectiveConfig.Policy.Name {
+		config.Parameters = effectiveConfig.Policy.Parameters
+	}
+	return config.policy()
+}
+
+// comparePolicies compares the named policies over the prices, followed by
+// always running at the highest frequency.
+func comparePolicies(names []string, prices []float64, window int, machine MachineConfig) ([]policyComparison, error) {
+	var comparisons []policyComparison
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		p, err := namedPolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		comparisons = append(comparisons, comparePolicy(name, p, prices, window, machine))
+	}
+	return append(comparisons, comparePolicy("always-max", nil, prices, window, machine)), nil
+}
+
+// printComparisons writes the comparisons as a table or, when asJSON, as a
+// JSON array.
+func printComparisons(w io.Writer, comparisons []policyComparison, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(comparisons)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "POLICY\t"+strings.ToUpper(policy.Cheap)+"\t"+strings.ToUpper(policy.Expensive)+"\tENERGY\tCOST\tCHANGES\tMAX THROTTLED")
+	for _, c := range comparisons {
+		fmt.Fprintf(tw, "%s\t%d h\t%d h\t%.3f kWh\t%.4f\t%d\t%d h\n", c.Policy, c.Hours[policy.Cheap], c.Hours[policy.Expensive],
+			c.Energy, c.Cost, c.Changes, c.MaxThrottled)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// tinyPrices rise from 10 to 60 and fall back to 5, see testdata/tiny.yaml.
+var tinyPrices = []float64{10, 20, 30, 40, 50, 60, 50, 40, 30, 20, 10, 5}
+
+// tinyMachine is a single CPU drawing 10 W at 2 GHz and 1.25 W at 1 GHz.
+var tinyMachine = MachineConfig{CPUs: 1, Frequencies: []int{1000000, 2000000}, MaxWatts: 10}
+
+func TestComparePolicies(t *testing.T) {
+	config := *effectiveConfig
+	config.Policy = PolicyConfig{Name: "threshold", Parameters: map[string]float64{"price": 35}}
+	setGlobal(t, &effectiveConfig, &config)
+
+	comparisons, err := comparePolicies([]string{"trend", " peak_shaving", "linear", "threshold"}, tinyPrices, 4, tinyMachine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The windows of four prices up to 40 to 50, 60, 50 are expensive, then
+	// cheap: 4 hours at 1 GHz between 2 changes and 5 at 2 GHz
+	trend := policyComparison{Policy: "trend", Hours: map[string]int{policy.Cheap: 5, policy.Expensive: 4},
+		Energy: 0.055, Cost: 0.00105 + 0.00025, Changes: 2, Throttled: 4, MaxThrottled: 4}
+	// Peak shaving throttles the 4 most expensive hours of the day, its
+	// default budget, and the line through the windows rises up to the same
+	// hours; the prices above 35, 40 to 60 to 40, are 5 hours
+	shaving, linear := trend, trend
+	shaving.Policy, linear.Policy = "peak_shaving", "linear"
+	threshold := policyComparison{Policy: "threshold", Hours: map[string]int{policy.Cheap: 4, policy.Expensive: 5},
+		Energy: 0.04625, Cost: 0.0003 + 0.00065, Changes: 2, Throttled: 5, MaxThrottled: 5}
+	want := []policyComparison{trend, shaving, linear, threshold,
+		{Policy: "always-max", Hours: map[string]int{policy.Cheap: 9}, Energy: 0.09, Cost: 0.00305}}
+	if len(comparisons) != len(want) {
+		t.Fatalf("got %d comparisons, want %d", len(comparisons), len(want))
+	}
+	for i, c := range comparisons {
+		if !approxEqual(c.Energy, want[i].Energy) || !approxEqual(c.Cost, want[i].Cost) {
+			t.Errorf("%s: %.4f kWh costing %.5f, want %.4f kWh costing %.5f", c.Policy, c.Energy, c.Cost, want[i].Energy, want[i].Cost)
+		}
+		c.Energy, c.Cost = want[i].Energy, want[i].Cost
+		if !reflect.DeepEqual(c, want[i]) {
+			t.Errorf("got %+v, want %+v", c, want[i])
+		}
+	}
+	// The threshold saves the most, then the trend, over always running at
+	// the highest frequency
+	if t3, tr, max := comparisons[3], comparisons[0], comparisons[len(comparisons)-1]; t3.Cost >= tr.Cost || tr.Cost >= max.Cost || tr.Energy >= max.Energy {
+		t.Errorf("threshold %+v, trend %+v and always-max %+v not in order of cost", t3, tr, max)
+	}
+
+	// Hours without enough prices to decide are skipped
+	if c := comparePolicy("trend", policy.Trend{}, tinyPrices, 1, tinyMachine); len(c.Hours) != 0 || c.Energy != 0 {
+		t.Errorf("single price windows: %+v, want no hours", c)
+	}
+	if _, err := comparePolicies([]string{"oracle"}, tinyPrices, 4, tinyMachine); err == nil {
+		t.Error("unknown policy: no error")
+	}
+
+	var table, asJSON bytes.Buffer
+	if err := printComparisons(&table, comparisons, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := "trend         5 h    4 h        0.055 kWh  0.0013  2        4 h\n"; !strings.Contains(table.String(), want) {
+		t.Errorf("table lacks %q:\n%s", want, table.String())
+	}
+	if err := printComparisons(&asJSON, comparisons, true); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []policyComparison
+	if err := json.Unmarshal(asJSON.Bytes(), &decoded); err != nil || !reflect.DeepEqual(decoded, comparisons) {
+		t.Errorf("JSON %s decodes as %+v, %v", asJSON.String(), decoded, err)
+	}
+}
+
+func TestComparePeakShaving(t *testing.T) {
+	config := *effectiveConfig
+	config.Policy = PolicyConfig{Name: "peak_shaving", Parameters: map[string]float64{"budget": 2}}
+	setGlobal(t, &effectiveConfig, &config)
+
+	// Two days of 24 hours, each rising and falling twice
+	day := slices.Concat(tinyPrices, tinyPrices)
+	prices := slices.Concat(day, day)
+	comparisons, err := comparePolicies([]string{"trend", "peak_shaving"}, prices, 4, tinyMachine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trend, shaving := comparisons[0], comparisons[1]
+	// Trend throttles more hours than the budget, peak shaving 2 a day, the
+	// two peaks of 60 of each day
+	if trend.Throttled <= 2*2 {
+		t.Fatalf("trend throttles %d hours, want more than the budget", trend.Throttled)
+	}
+	if shaving.Throttled != 2*2 || shaving.Hours[policy.Expensive] != 2*2 || shaving.MaxThrottled != 1 {
+		t.Errorf("peak shaving: %+v, want 2 hours throttled a day", shaving)
+	}
+	for i, prices := range [][]float64{day, prices[:24], prices[24:]} {
+		if c := comparePolicy("peak_shaving", policy.PeakShaving{Budget: 2}, prices, 4, tinyMachine); c.Throttled > 2 {
+			t.Errorf("day %d: %d hours throttled, want at most 2", i, c.Throttled)
+		}
+	}
+	if shaving.Energy >= comparisons[2].Energy || shaving.Energy <= trend.Energy {
+		t.Errorf("peak shaving uses %.4f kWh, want between trend %.4f and always-max %.4f", shaving.Energy, trend.Energy, comparisons[2].Energy)
+	}
+}
+
+// approxEqual reports whether the floats are equal but for rounding errors.
+func approxEqual(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// condorUpdateTimeout bounds condor_update_machine_ad.
+const condorUpdateTimeout = 30 * time.Second
+
+var (
+	condorPrefix = "Epcp"
+	// condorUpdate is the command updating the machine ad, run with the ad
+	// file after each band change when set.
+	condorUpdate string
+	condorBand   string
+)
+
+// classAdAttribute matches the valid ClassAd attribute names.
+var classAdAttribute = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// writeClassAd writes the attributes of the decision and the price in the
+// ClassAd syntax of STARTD_CRON output, each prefixed with condorPrefix. The
+// frequency is left out when unknown.
+func writeClassAd(w io.Writer, decision *Decision, price float64) error {
+	ad := fmt.Sprintf("%sPriceBand = %q\n%sPrice = %.2f\n", condorPrefix, decision.Band, condorPrefix, price)
+	if decision.Frequency != 0 {
+		ad += fmt.Sprintf("%sFrequency = %d\n", condorPrefix, decision.Frequency)
+	}
+	_, err := io.WriteString(w, ad)
+	return err
+}
+
+// updateClassAd publishes the band to the machine ad with condorUpdate when
+// it changed since the last cycle.
+func updateClassAd(ctx context.Context, result *cycleResult) {
+	decision := result.Decision
+	if condorUpdate == "" || decision == nil || decision.Band == condorBand {
+		return
+	}
+	if dryRun || simulate {
+		infoLog(ctx).Printf("Would update the machine ad with band %s\n", decision.Band)
+		condorBand = decision.Band
+		return
+	}
+	f, err := os.CreateTemp("", "epcp-ad-")
+	if err != nil {
+		errorLog(ctx).Printf("Error creating the machine ad file: %s\n", err.Error())
+		return
+	}
+	defer os.Remove(f.Name())
+	err = writeClassAd(f, decision, lastPrice(result))
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		errorLog(ctx).Printf("Error writing the machine ad file: %s\n", err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), condorUpdateTimeout)
+	defer cancel()
+	args := append(strings.Fields(condorUpdate), f.Name())
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		errorLog(ctx).Printf("Error updating the machine ad: %s: %s\n", err.Error(), strings.TrimSpace(string(output)))
+		return
+	}
+	infoLog(ctx).Printf("Machine ad updated with band %s\n", decision.Band)
+	condorBand = decision.Band
+}
+
+// lastPrice returns the latest price of the cycle, or 0 without any.
+func lastPrice(result *cycleResult) float64 {
+	if len(result.Prices) == 0 {
+		return 0
+	}
+	return result.Prices[len(result.Prices)-1]
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// classAdLine matches an attribute of a machine ad with a string or number
+// value.
+var classAdLine = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]* = ("[^"\\]*"|-?[0-9]+(\.[0-9]+)?)$`)
+
+// checkClassAd checks the syntax of the machine ad and returns its attributes.
+func checkClassAd(t *testing.T, ad string) map[string]string {
+	t.Helper()
+	attributes := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(ad, "\n"), "\n") {
+		if !classAdLine.MatchString(line) {
+			t.Errorf("invalid attribute %q", line)
+			continue
+		}
+		name, value, _ := strings.Cut(line, " = ")
+		attributes[name] = value
+	}
+	return attributes
+}
+
+func TestWriteClassAd(t *testing.T) {
+	setGlobal(t, &condorPrefix, "Price_")
+	var ad bytes.Buffer
+	if err := writeClassAd(&ad, &Decision{Band: policy.Expensive, Frequency: 800000}, 120.456); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"Price_PriceBand": `"expensive"`, "Price_Price": "120.46", "Price_Frequency": "800000"}
+	if got := checkClassAd(t, ad.String()); len(got) != len(want) {
+		t.Errorf("attributes %v, want %v", got, want)
+	} else {
+		for name, value := range want {
+			if got[name] != value {
+				t.Errorf("%s = %s, want %s", name, got[name], value)
+			}
+		}
+	}
+
+	// An unknown frequency is left out
+	ad.Reset()
+	if err := writeClassAd(&ad, &Decision{Band: policy.Cheap}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkClassAd(t, ad.String()); len(got) != 2 || got["Price_PriceBand"] != `"cheap"` {
+		t.Errorf("attributes %v, want the band and the price", got)
+	}
+}
+
+func TestClassAdCommand(t *testing.T) {
+	t.Setenv("EPCP_SOURCE", "synthetic")
+	t.Setenv("EPCP_CONDOR_PREFIX", "Cerit")
+	out, code := runEpcp(t, "classad")
+	if code != exitOK {
+		t.Fatalf("exit code %d:\n%s", code, out)
+	}
+	if band := checkClassAd(t, out)["CeritPriceBand"]; band != `"cheap"` && band != `"expensive"` {
+		t.Errorf("band %s in:\n%s", band, out)
+	}
+}
+
+func TestUpdateClassAd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub is a shell script")
+	}
+	logs := captureLogs(t)
+	dir := t.TempDir()
+	// The stub records its arguments and the ad file it is given
+	stub := filepath.Join(dir, "condor_update_machine_ad")
+	script := "#!/bin/sh\necho \"$@\" >> " + filepath.Join(dir, "args") + "\ncat \"$2\" >> " + filepath.Join(dir, "ads") + "\n"
+	if err := os.WriteFile(stub, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &condorUpdate, stub+" -pool")
+	setGlobal(t, &condorBand, "")
+	setGlobal(t, &condorPrefix, "Epcp")
+	setGlobal(t, &dryRun, false)
+	setGlobal(t, &simulate, false)
+	cycle := func(band string) {
+		updateClassAd(context.Background(), &cycleResult{Prices: []float64{95}, Decision: &Decision{Band: band, Frequency: 800000}})
+	}
+
+	// The ad is updated on band changes only
+	cycle(policy.Expensive)
+	cycle(policy.Expensive)
+	cycle(policy.Cheap)
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(args)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "-pool ") {
+		t.Fatalf("invoked with %q, want twice with -pool and the ad file", lines)
+	}
+	// The ad file is removed afterwards
+	if _, err := os.Stat(strings.TrimPrefix(lines[0], "-pool ")); !os.IsNotExist(err) {
+		t.Errorf("ad file %s left behind: %v", lines[0], err)
+	}
+	ads, err := os.ReadFile(filepath.Join(dir, "ads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(ads), "EpcpPriceBand = \"expensive\"\nEpcpPrice = 95.00\nEpcpFrequency = 800000\nEpcpPriceBand = \"cheap\"\nEpcpPrice = 95.00\nEpcpFrequency = 800000\n"; got != want {
+		t.Errorf("ads %q, want %q", got, want)
+	}
+
+	// A failed update is retried at the next cycle
+	setGlobal(t, &condorUpdate, filepath.Join(dir, "missing"))
+	cycle(policy.Expensive)
+	if condorBand != policy.Cheap || !strings.Contains(logs.String(), "Error updating the machine ad") {
+		t.Errorf("failed update: band %s:\n%s", condorBand, logs)
+	}
+}
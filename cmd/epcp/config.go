@@ -0,0 +1,1503 @@
+package main
+
+import (
+	"bytes"
+	e "errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/calendar"
+	"github.com/CERIT-SC/epcp-simulator/internal/forecast"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+	"github.com/CERIT-SC/epcp-simulator/internal/pricefile"
+	"github.com/CERIT-SC/epcp-simulator/internal/profile"
+	"github.com/CERIT-SC/epcp-simulator/internal/solar"
+	"github.com/CERIT-SC/epcp-simulator/internal/synthetic"
+)
+
+// Config is the structured configuration loaded with --config from a YAML or
+// TOML file. Environment variables override its scalar fields, see bindings.
+type Config struct {
+	Source    SourceConfig     `yaml:"source,omitempty" toml:"source,omitempty"`
+	Policy    PolicyConfig     `yaml:"policy,omitempty" toml:"policy,omitempty"`
+	Calendar  CalendarConfig   `yaml:"calendar,omitempty" toml:"calendar,omitempty"`
+	Actuators []ActuatorConfig `yaml:"actuators,omitempty" toml:"actuators,omitempty"`
+	Apply     ApplyConfig      `yaml:"apply,omitempty" toml:"apply,omitempty"`
+	Schedule  ScheduleConfig   `yaml:"schedule,omitempty" toml:"schedule,omitempty"`
+	Scheduler SchedulerConfig  `yaml:"scheduler,omitempty" toml:"scheduler,omitempty"`
+	Battery   BatteryConfig    `yaml:"battery,omitempty" toml:"battery,omitempty"`
+	Solar     SolarConfig      `yaml:"solar,omitempty" toml:"solar,omitempty"`
+	State     StateConfig      `yaml:"state,omitempty" toml:"state,omitempty"`
+	Outputs   OutputsConfig    `yaml:"outputs,omitempty" toml:"outputs,omitempty"`
+	Channels  []ChannelConfig  `yaml:"channels,omitempty" toml:"channels,omitempty"`
+}
+
+// SourceConfig configures where the prices come from: the OTE service, or
+// a price file or generated prices for offline runs.
+type SourceConfig struct {
+	Type      string          `yaml:"type,omitempty" toml:"type,omitempty"`
+	WSDL      string          `yaml:"wsdl,omitempty" toml:"wsdl,omitempty"`
+	PriceFile string          `yaml:"price_file,omitempty" toml:"price_file,omitempty"`
+	Synthetic SyntheticConfig `yaml:"synthetic,omitempty" toml:"synthetic,omitempty"`
+	Hours     string          `yaml:"hours,omitempty" toml:"hours,omitempty"`
+	// Forecast names the model predicting the prices from the history when
+	// they cannot be fetched, persistence or weekly_median
+	Forecast             string `yaml:"forecast,omitempty" toml:"forecast,omitempty"`
+	ForecastConservative bool   `yaml:"forecast_conservative,omitempty" toml:"forecast_conservative,omitempty"`
+	// Peer is the leader the peer source reads the intraday prices from
+	Peer PeerConfig `yaml:"peer,omitempty" toml:"peer,omitempty"`
+	// Failover lists the sources, instead of Type, in order of priority,
+	// see failover.Source. A source failing FailoverFailures times in a row
+	// (3 by default) is skipped until FailoverProbe (10m by default) passed.
+	Failover         []string `yaml:"failover,omitempty" toml:"failover,omitempty"`
+	FailoverFailures int      `yaml:"failover_failures,omitempty" toml:"failover_failures,omitempty"`
+	FailoverProbe    string   `yaml:"failover_probe,omitempty" toml:"failover_probe,omitempty"`
+	// Units maps the sources to the unit of their prices of both markets,
+	// EUR/MWh by default, or EUR/kWh, CZK/MWh or CZK/kWh converted with the
+	// EurCzk exchange rate; OTE serves EUR/MWh
+	Units  map[string]string `yaml:"units,omitempty" toml:"units,omitempty"`
+	EurCzk *float64          `yaml:"eur_czk,omitempty" toml:"eur_czk,omitempty"`
+	// MaxStaleness is how much older than expected, an hour after the end
+	// of its hour, the newest price may be; StaleAction, safe (default) to
+	// fall back to the safe mode or conservative, tells what to do with the
+	// decisions on older prices
+	MaxStaleness string `yaml:"max_staleness,omitempty" toml:"max_staleness,omitempty"`
+	StaleAction  string `yaml:"stale_action,omitempty" toml:"stale_action,omitempty"`
+	// IgnoreProvisional leaves the price of the hour still trading out of
+	// the decisions; otherwise ProvisionalWeight, 1 by default, weights it
+	// against the price of the hour before
+	IgnoreProvisional bool     `yaml:"ignore_provisional,omitempty" toml:"ignore_provisional,omitempty"`
+	ProvisionalWeight *float64 `yaml:"provisional_weight,omitempty" toml:"provisional_weight,omitempty"`
+	// ProfileFile is the CSV of the typical day the profile source serves,
+	// the embedded one by default; ProfileFallback decides on it when no
+	// prices can be fetched, cached or forecast
+	ProfileFile     string `yaml:"profile_file,omitempty" toml:"profile_file,omitempty"`
+	ProfileFallback bool   `yaml:"profile_fallback,omitempty" toml:"profile_fallback,omitempty"`
+	// PriceMin and PriceMax bound the plausible prices in EUR/MWh, -9999
+	// and 9999 by default; the prices outside are quarantined in
+	// QuarantineFile, quarantine.jsonl in the state directory by default,
+	// and a fetch with more than QuarantineFraction (0.5 by default) of its
+	// prices quarantined fails
+	PriceMin           *float64 `yaml:"price_min,omitempty" toml:"price_min,omitempty"`
+	PriceMax           *float64 `yaml:"price_max,omitempty" toml:"price_max,omitempty"`
+	QuarantineFraction *float64 `yaml:"quarantine_fraction,omitempty" toml:"quarantine_fraction,omitempty"`
+	QuarantineFile     string   `yaml:"quarantine_file,omitempty" toml:"quarantine_file,omitempty"`
+	// RateLimit spaces the requests to OTE, 1s by default; BootstrapDays
+	// are the days of day-ahead prices the daemon backfills an empty history
+	// with on its first start, see bootstrapHistory
+	RateLimit     string `yaml:"rate_limit,omitempty" toml:"rate_limit,omitempty"`
+	BootstrapDays int    `yaml:"bootstrap_days,omitempty" toml:"bootstrap_days,omitempty"`
+	// priceFile holds the prices of PriceFile Validate read, which are
+	// those served, so that the file is read once
+	priceFile *pricefile.Source
+}
+
+// priceFactor returns the factor converting the prices of the source to
+// EUR/MWh. The factor applies to the prices of both markets, so the OTE
+// source, serving both in EUR/MWh, see oteClient, takes no other unit.
+func (c SourceConfig) priceFactor(name string) (float64, error) {
+	unit := c.Units[name]
+	if unit == "" {
+		return 1, nil
+	}
+	if name == "ote" && unit != "EUR/MWh" {
+		return 0, fmt.Errorf("the prices of OTE are in EUR/MWh, not %s", unit)
+	}
+	currency, energy, _ := strings.Cut(unit, "/")
+	factor := 1.0
+	switch currency {
+	case "EUR":
+	case "CZK":
+		if c.EurCzk == nil || *c.EurCzk <= 0 {
+			return 0, fmt.Errorf("%s needs the source.eur_czk exchange rate", unit)
+		}
+		factor /= *c.EurCzk
+	default:
+		return 0, fmt.Errorf("unknown unit %q, expected EUR/MWh, EUR/kWh, CZK/MWh or CZK/kWh", unit)
+	}
+	switch energy {
+	case "MWh":
+	case "kWh":
+		factor *= 1000
+	default:
+		return 0, fmt.Errorf("unknown unit %q, expected EUR/MWh, EUR/kWh, CZK/MWh or CZK/kWh", unit)
+	}
+	return factor, nil
+}
+
+// priceBounds returns the sanity bounds of the prices.
+func (c SourceConfig) priceBounds() (float64, float64) {
+	low, high := defaultPriceMin, defaultPriceMax
+	if c.PriceMin != nil {
+		low = *c.PriceMin
+	}
+	if c.PriceMax != nil {
+		high = *c.PriceMax
+	}
+	return low, high
+}
+
+// ChannelConfig is a market decided on next to the electricity prices, e.g.
+// gas, see priceChannel. Each cycle its Source, a price file or generated
+// prices, and the name and the parameters of its Policy decide a band of its
+// own, which only drives its Webhook alerts; the actuators follow the
+// electricity prices alone.
+type ChannelConfig struct {
+	Name    string        `yaml:"name" toml:"name"`
+	Source  SourceConfig  `yaml:"source,omitempty" toml:"source,omitempty"`
+	Policy  PolicyConfig  `yaml:"policy,omitempty" toml:"policy,omitempty"`
+	Webhook WebhookConfig `yaml:"webhook,omitempty" toml:"webhook,omitempty"`
+}
+
+// PeerConfig configures the peer source, reading the intraday prices from
+// the prices endpoint of a leader, see peer.Source.
+type PeerConfig struct {
+	URL string `yaml:"url,omitempty" toml:"url,omitempty"`
+	// MaxAge is how long ago the leader may have fetched the prices, 90m by
+	// default
+	MaxAge string `yaml:"max_age,omitempty" toml:"max_age,omitempty"`
+	// Key is shared by the leader, signing the prices it serves with it,
+	// and the followers, rejecting prices not signed with it or
+	// PreviousKey, which is accepted while the key is rotated
+	Key         string `yaml:"key,omitempty" toml:"key,omitempty"`
+	PreviousKey string `yaml:"previous_key,omitempty" toml:"previous_key,omitempty"`
+}
+
+// SyntheticConfig shapes the prices of the synthetic source, see
+// synthetic.Params. Unset fields take synthetic.DefaultParams.
+type SyntheticConfig struct {
+	Base      *float64 `yaml:"base,omitempty" toml:"base,omitempty"`
+	Amplitude *float64 `yaml:"amplitude,omitempty" toml:"amplitude,omitempty"`
+	PeakHour  *float64 `yaml:"peak_hour,omitempty" toml:"peak_hour,omitempty"`
+	Noise     *float64 `yaml:"noise,omitempty" toml:"noise,omitempty"`
+	Spikes    *float64 `yaml:"spikes,omitempty" toml:"spikes,omitempty"`
+	Seed      int      `yaml:"seed,omitempty" toml:"seed,omitempty"`
+}
+
+// params returns the parameters of the synthetic source.
+func (c SyntheticConfig) params() synthetic.Params {
+	params := synthetic.DefaultParams
+	set := func(param *float64, value *float64) {
+		if value != nil {
+			*param = *value
+		}
+	}
+	set(&params.Base, c.Base)
+	set(&params.Amplitude, c.Amplitude)
+	set(&params.PeakHour, c.PeakHour)
+	set(&params.Noise, c.Noise)
+	set(&params.Spikes, c.Spikes)
+	params.Seed = int64(c.Seed)
+	return params
+}
+
+// priceSource returns the configured source of the prices.
+func (c SourceConfig) priceSource() (ote.PriceSource, error) {
+	if len(c.Failover) != 0 {
+		return c.failoverSource()
+	}
+	switch c.Type {
+	case "file":
+		if c.priceFile != nil {
+			return c.priceFile, nil
+		}
+		source, err := pricefile.Load(c.PriceFile)
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	case "synthetic":
+		return synthetic.New(c.Synthetic.params()), nil
+	case "profile":
+		source, err := profileSource(c.ProfileFile)
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	case "peer":
+		maxAge, err := time.ParseDuration(c.Peer.MaxAge)
+		if err != nil {
+			maxAge = defaultPeerMaxAge
+		}
+		return peerSource(c.Peer.URL, maxAge, c.oteClient()), nil
+	}
+	return c.oteClient(), nil
+}
+
+// oteClient returns the client of the OTE service. It fetches the day-ahead
+// prices in EUR, as the intraday ones are, rather than in CZK by default.
+func (c SourceConfig) oteClient() *ote.Client {
+	endpoint := c.WSDL
+	if endpoint == "" {
+		endpoint = ote.DefaultEndpoint
+	}
+	return ote.NewClient(ote.WithEndpoint(endpoint), ote.WithUserAgent("epcp/"+getBuildInfo().Version),
+		ote.WithCurrency("EUR"), ote.WithHTTPClient(newHTTPClient(nil, 0)), ote.WithDriftHandler(warnSchemaDrift),
+		ote.WithCallHandler(logOTECall), ote.WithRateLimiter(oteLimiter))
+}
+
+// PolicyConfig selects the policy deciding the frequency and its parameters.
+// DayTypes override them on workdays, weekends or holidays, see
+// calendar.DayTypes.
+type PolicyConfig struct {
+	Name       string                   `yaml:"name,omitempty" toml:"name,omitempty"`
+	Parameters map[string]float64       `yaml:"parameters,omitempty" toml:"parameters,omitempty"`
+	DayTypes   map[string]DayTypeConfig `yaml:"day_types,omitempty" toml:"day_types,omitempty"`
+	// Metric is the expression of the decision metric the policy decides
+	// on instead of the prices, see metricSeries
+	Metric string `yaml:"metric,omitempty" toml:"metric,omitempty"`
+	// SafeMode, hold (default), max or min, is what the cycles decide when
+	// they cannot decide from the prices, see adjustForSafeMode
+	SafeMode string `yaml:"safe_mode,omitempty" toml:"safe_mode,omitempty"`
+}
+
+// DayTypeConfig overrides the policy on a type of day. An unset Name keeps
+// the policy, Parameters are merged over its parameters.
+type DayTypeConfig struct {
+	Name       string             `yaml:"name,omitempty" toml:"name,omitempty"`
+	Parameters map[string]float64 `yaml:"parameters,omitempty" toml:"parameters,omitempty"`
+}
+
+// policy returns the configured policy, the trend policy by default.
+func (c PolicyConfig) policy() (policy.Policy, error) {
+	if c.Name == "" {
+		return policy.Trend{}, nil
+	}
+	return policy.New(c.Name, c.Parameters)
+}
+
+// dayType returns the policy configured for the type of day.
+func (c PolicyConfig) dayType(dayType string) PolicyConfig {
+	override, ok := c.DayTypes[dayType]
+	if !ok {
+		return c
+	}
+	name, parameters := c.Name, make(map[string]float64)
+	if override.Name == "" || override.Name == c.Name {
+		maps.Copy(parameters, c.Parameters)
+	} else {
+		name = override.Name
+	}
+	maps.Copy(parameters, override.Parameters)
+	return PolicyConfig{Name: name, Parameters: parameters}
+}
+
+// dayPolicies returns the policies overriding the configured one by type of
+// day.
+func (c PolicyConfig) dayPolicies() (map[string]policy.Policy, error) {
+	policies := make(map[string]policy.Policy, len(c.DayTypes))
+	for dayType := range c.DayTypes {
+		p, err := c.dayType(dayType).policy()
+		if err != nil {
+			return nil, err
+		}
+		policies[dayType] = p
+	}
+	return policies, nil
+}
+
+// CalendarConfig adds Holidays to the Czech public holidays, as YYYY-MM-DD
+// for a single day or MM-DD for every year.
+type CalendarConfig struct {
+	Holidays []string `yaml:"holidays,omitempty" toml:"holidays,omitempty"`
+}
+
+// ActuatorConfig selects how the decisions are applied: sysfs, helper or
+// simulation for the frequencies, and in addition redfish for the platform
+// power limit of the chassis at URL, in watts per band, libvirt for the CPU
+// shares of the guest Domains, scaled per band by Shares with virsh run as
+// Command, docker for the CPU limits of the containers with Label, scaled
+// likewise through the Docker API at Socket, and systemd for the CPU quotas
+// of the slices, services and scopes of Units, scaled likewise over D-Bus.
+// The enabled actuators apply the decisions in the order they are listed,
+// the frequencies first unless a frequency actuator is listed.
+type ActuatorConfig struct {
+	Type     string             `yaml:"type" toml:"type"`
+	Disabled bool               `yaml:"disabled,omitempty" toml:"disabled,omitempty"`
+	Command  string             `yaml:"command,omitempty" toml:"command,omitempty"`
+	Socket   string             `yaml:"socket,omitempty" toml:"socket,omitempty"`
+	URL      string             `yaml:"url,omitempty" toml:"url,omitempty"`
+	Username string             `yaml:"username,omitempty" toml:"username,omitempty"`
+	Password string             `yaml:"password,omitempty" toml:"password,omitempty"`
+	Insecure bool               `yaml:"insecure,omitempty" toml:"insecure,omitempty"`
+	Caps     map[string]int     `yaml:"caps,omitempty" toml:"caps,omitempty"`
+	Domains  []string           `yaml:"domains,omitempty" toml:"domains,omitempty"`
+	Shares   map[string]float64 `yaml:"shares,omitempty" toml:"shares,omitempty"`
+	Label    string             `yaml:"label,omitempty" toml:"label,omitempty"`
+	Units    []string           `yaml:"units,omitempty" toml:"units,omitempty"`
+}
+
+// extraActuators are the actuator types applied next to the frequency one.
+var extraActuators = map[string]bool{"redfish": true, "libvirt": true, "docker": true, "systemd": true}
+
+// ApplyConfig configures how failures to apply a decision are handled.
+type ApplyConfig struct {
+	Strict        bool   `yaml:"strict,omitempty" toml:"strict,omitempty"`
+	RequireSysfs  bool   `yaml:"require_sysfs,omitempty" toml:"require_sysfs,omitempty"`
+	RestoreOnExit bool   `yaml:"restore_on_exit,omitempty" toml:"restore_on_exit,omitempty"`
+	SysfsRoot     string `yaml:"sysfs_root,omitempty" toml:"sysfs_root,omitempty"`
+	Reconcile     bool   `yaml:"reconcile,omitempty" toml:"reconcile,omitempty"`
+	SkipSampling  bool   `yaml:"skip_sampling,omitempty" toml:"skip_sampling,omitempty"`
+	// Workers write the CPUs concurrently, a quarter of the CPUs by default
+	Workers int `yaml:"workers,omitempty" toml:"workers,omitempty"`
+	// BootGrace is how long after the boot of the node the decisions
+	// lowering the frequencies are not applied, see adjustForBootGrace
+	BootGrace string `yaml:"boot_grace,omitempty" toml:"boot_grace,omitempty"`
+	// Targets map the bands to their frequency on each CPU, min, max, a
+	// percentage of its maximum like "60%" or a frequency with its unit
+	// like "2400MHz", see frequencyTarget
+	Targets map[string]string `yaml:"targets,omitempty" toml:"targets,omitempty"`
+	// NUMA maps the NUMA nodes, by number, to their frequencies
+	NUMA map[string]NUMANodeConfig `yaml:"numa,omitempty" toml:"numa,omitempty"`
+	// Floors map ranges of the day, "HH:MM-HH:MM" in the market timezone,
+	// to the minimum frequency in kHz decided in them, whatever the band
+	Floors map[string]int `yaml:"floors,omitempty" toml:"floors,omitempty"`
+}
+
+// NUMANodeConfig sets the frequencies of the CPUs of a NUMA node: the
+// frequency in kHz of the bands listed in Bands, and for the others the
+// frequency of the band plus Offset, e.g. -800000 to throttle the node
+// running the batch work harder.
+type NUMANodeConfig struct {
+	Offset int            `yaml:"offset,omitempty" toml:"offset,omitempty"`
+	Bands  map[string]int `yaml:"bands,omitempty" toml:"bands,omitempty"`
+}
+
+// ScheduleConfig configures when the cycles run and the day-ahead watch.
+type ScheduleConfig struct {
+	Interval string `yaml:"interval,omitempty" toml:"interval,omitempty"`
+	// EvalOffset moves the cycles of the daemon into the interval, e.g. 4m
+	// to decide at hh:04 once the price of the hour before has settled, see
+	// evalOffset
+	EvalOffset  string `yaml:"eval_offset,omitempty" toml:"eval_offset,omitempty"`
+	Jitter      string `yaml:"jitter,omitempty" toml:"jitter,omitempty"`
+	DamStart    string `yaml:"dam_watch_start,omitempty" toml:"dam_watch_start,omitempty"`
+	DamDeadline string `yaml:"dam_watch_deadline,omitempty" toml:"dam_watch_deadline,omitempty"`
+	DamPoll     string `yaml:"dam_watch_poll,omitempty" toml:"dam_watch_poll,omitempty"`
+	// Maintenance lists the windows scaling is suspended in, as
+	// "[days ]HH:MM-HH:MM" in the market timezone, e.g. "02:00-04:00" or
+	// "sat,sun 22:00-06:00"; MaintenanceFrequency is forced in them, in kHz,
+	// or the frequencies are held without it
+	Maintenance          []string `yaml:"maintenance,omitempty" toml:"maintenance,omitempty"`
+	MaintenanceFrequency int      `yaml:"maintenance_frequency,omitempty" toml:"maintenance_frequency,omitempty"`
+	// Ramp is how long before a band transition planned by the day-ahead
+	// schedule the daemon steps the frequencies towards the next band, in
+	// RampSteps (5 by default) steps, see planRamp
+	Ramp      string `yaml:"ramp,omitempty" toml:"ramp,omitempty"`
+	RampSteps int    `yaml:"ramp_steps,omitempty" toml:"ramp_steps,omitempty"`
+}
+
+// SchedulerConfig configures draining the node in the batch system, e.g.
+// Slurm or PBS, during the expensive hours. The commands are run with
+// /bin/sh after substituting $HOST, $BAND and $PRICE.
+type SchedulerConfig struct {
+	DrainCommand  string `yaml:"drain_command,omitempty" toml:"drain_command,omitempty"`
+	ResumeCommand string `yaml:"resume_command,omitempty" toml:"resume_command,omitempty"`
+	Timeout       string `yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+}
+
+// BatteryConfig configures the battery storage overriding the price band: a
+// state of charge of at least High percent makes the hour cheap, at most Low
+// percent expensive. URL is nut://host/ups or the URL of a JSON document
+// holding the state of charge at Field.
+type BatteryConfig struct {
+	URL   string   `yaml:"url,omitempty" toml:"url,omitempty"`
+	Field string   `yaml:"field,omitempty" toml:"field,omitempty"`
+	High  *float64 `yaml:"high,omitempty" toml:"high,omitempty"`
+	Low   *float64 `yaml:"low,omitempty" toml:"low,omitempty"`
+}
+
+// thresholds returns the high and low thresholds, 80 and 20 % by default.
+func (c BatteryConfig) thresholds() (float64, float64) {
+	high, low := 80.0, 20.0
+	if c.High != nil {
+		high = *c.High
+	}
+	if c.Low != nil {
+		low = *c.Low
+	}
+	return high, low
+}
+
+// SolarConfig describes the on-site PV plant whose forecast production,
+// consumed by a load of LoadKW, lowers the prices, see solar.Site. It is
+// enabled by KWp.
+type SolarConfig struct {
+	Latitude    float64 `yaml:"latitude,omitempty" toml:"latitude,omitempty"`
+	Longitude   float64 `yaml:"longitude,omitempty" toml:"longitude,omitempty"`
+	Declination float64 `yaml:"declination,omitempty" toml:"declination,omitempty"`
+	Azimuth     float64 `yaml:"azimuth,omitempty" toml:"azimuth,omitempty"`
+	KWp         float64 `yaml:"kwp,omitempty" toml:"kwp,omitempty"`
+	LoadKW      float64 `yaml:"load_kw,omitempty" toml:"load_kw,omitempty"`
+}
+
+// StateConfig configures the state directory, the instance lock and how
+// long the history of the prices is kept: the prices for HistoryDays, 8 by
+// default and at least the 7 the forecasts read, then the means of their
+// hours for HistoryHourlyDays, 90 by default, then the statistics of their
+// days for HistoryDailyDays, forever when 0, see compactHistory.
+type StateConfig struct {
+	Dir               string `yaml:"dir,omitempty" toml:"dir,omitempty"`
+	LockWait          string `yaml:"lock_wait,omitempty" toml:"lock_wait,omitempty"`
+	HistoryDays       int    `yaml:"history_days,omitempty" toml:"history_days,omitempty"`
+	HistoryHourlyDays int    `yaml:"history_hourly_days,omitempty" toml:"history_hourly_days,omitempty"`
+	HistoryDailyDays  int    `yaml:"history_daily_days,omitempty" toml:"history_daily_days,omitempty"`
+}
+
+// OutputsConfig configures the logs, endpoints and exporters.
+type OutputsConfig struct {
+	DecisionLog   string        `yaml:"decision_log,omitempty" toml:"decision_log,omitempty"`
+	Textfile      string        `yaml:"textfile,omitempty" toml:"textfile,omitempty"`
+	Listen        string        `yaml:"listen,omitempty" toml:"listen,omitempty"`
+	DebugListen   string        `yaml:"debug_listen,omitempty" toml:"debug_listen,omitempty"`
+	ControlSocket string        `yaml:"control_socket,omitempty" toml:"control_socket,omitempty"`
+	OTLPEndpoint  string        `yaml:"otlp_endpoint,omitempty" toml:"otlp_endpoint,omitempty"`
+	Log           LogConfig     `yaml:"log,omitempty" toml:"log,omitempty"`
+	Influx        InfluxConfig  `yaml:"influx,omitempty" toml:"influx,omitempty"`
+	Webhook       WebhookConfig `yaml:"webhook,omitempty" toml:"webhook,omitempty"`
+	MQTT          MQTTConfig    `yaml:"mqtt,omitempty" toml:"mqtt,omitempty"`
+	Condor        CondorConfig  `yaml:"condor,omitempty" toml:"condor,omitempty"`
+	Sensor        SensorConfig  `yaml:"sensor,omitempty" toml:"sensor,omitempty"`
+	DBus          string        `yaml:"dbus,omitempty" toml:"dbus,omitempty"`
+	// ServePrices serves the fetched prices to the followers of the peer
+	// source on /prices of the status endpoint
+	ServePrices bool `yaml:"serve_prices,omitempty" toml:"serve_prices,omitempty"`
+	// RAPL measures the energy of the CPU packages per band, see
+	// accountEnergy
+	RAPL bool `yaml:"rapl,omitempty" toml:"rapl,omitempty"`
+	// PriceUnit and Locale are how the logs, tables and messages show the
+	// prices, see priceDisplay
+	PriceUnit string `yaml:"price_unit,omitempty" toml:"price_unit,omitempty"`
+	Locale    string `yaml:"locale,omitempty" toml:"locale,omitempty"`
+	// NotifyQueue bounds the notifications waiting for the webhook and the
+	// MQTT broker each in daemon mode, see notifyQueue
+	NotifyQueue int `yaml:"notify_queue,omitempty" toml:"notify_queue,omitempty"`
+	// Report writes the cost report of each period once it is over, see
+	// writePeriodReport
+	Report ReportConfig `yaml:"report,omitempty" toml:"report,omitempty"`
+}
+
+// ReportConfig configures the cost reports written at the end of each period,
+// see epcp report.
+type ReportConfig struct {
+	// Dir receives the reports; empty to write none
+	Dir string `yaml:"dir,omitempty" toml:"dir,omitempty"`
+	// Period is month (default) or week
+	Period string `yaml:"period,omitempty" toml:"period,omitempty"`
+	// Format is md (default) or json
+	Format string `yaml:"format,omitempty" toml:"format,omitempty"`
+}
+
+// LogConfig configures the log file, see setupLogFile.
+type LogConfig struct {
+	File    string `yaml:"file,omitempty" toml:"file,omitempty"`
+	MaxSize string `yaml:"max_size,omitempty" toml:"max_size,omitempty"`
+	// MaxBackups is how many rotated files are kept, 5 when unset and none
+	// when 0
+	MaxBackups *int `yaml:"max_backups,omitempty" toml:"max_backups,omitempty"`
+}
+
+// InfluxConfig configures the InfluxDB export.
+type InfluxConfig struct {
+	File   string `yaml:"file,omitempty" toml:"file,omitempty"`
+	URL    string `yaml:"url,omitempty" toml:"url,omitempty"`
+	Org    string `yaml:"org,omitempty" toml:"org,omitempty"`
+	Bucket string `yaml:"bucket,omitempty" toml:"bucket,omitempty"`
+	Token  string `yaml:"token,omitempty" toml:"token,omitempty"`
+	Batch  int    `yaml:"batch,omitempty" toml:"batch,omitempty"`
+}
+
+// WebhookConfig configures the webhook alerts.
+type WebhookConfig struct {
+	URL       string   `yaml:"url,omitempty" toml:"url,omitempty"`
+	Format    string   `yaml:"format,omitempty" toml:"format,omitempty"`
+	StatusURL string   `yaml:"status_url,omitempty" toml:"status_url,omitempty"`
+	PriceHigh *float64 `yaml:"price_high,omitempty" toml:"price_high,omitempty"`
+	PriceLow  *float64 `yaml:"price_low,omitempty" toml:"price_low,omitempty"`
+	Period    string   `yaml:"period,omitempty" toml:"period,omitempty"`
+}
+
+// MQTTConfig configures the MQTT publishing.
+type MQTTConfig struct {
+	URL         string `yaml:"url,omitempty" toml:"url,omitempty"`
+	Username    string `yaml:"username,omitempty" toml:"username,omitempty"`
+	Password    string `yaml:"password,omitempty" toml:"password,omitempty"`
+	TopicPrefix string `yaml:"topic_prefix,omitempty" toml:"topic_prefix,omitempty"`
+}
+
+// CondorConfig configures the HTCondor machine ad attributes, see epcp
+// classad. UpdateCommand is run with the ad file after each band change.
+type CondorConfig struct {
+	Prefix        string `yaml:"prefix,omitempty" toml:"prefix,omitempty"`
+	UpdateCommand string `yaml:"update_command,omitempty" toml:"update_command,omitempty"`
+}
+
+// SensorConfig protects the /sensor endpoint of the status server with a
+// bearer Token and allows browsers from CORSOrigin, e.g. * or the URL of
+// Home Assistant, to read it.
+type SensorConfig struct {
+	Token      string `yaml:"token,omitempty" toml:"token,omitempty"`
+	CORSOrigin string `yaml:"cors_origin,omitempty" toml:"cors_origin,omitempty"`
+}
+
+// configPath is the file given with --config.
+var configPath string
+
+// loadConfig reads the configuration from path, by its extension as YAML or
+// TOML. Unknown keys are errors.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !e.Is(err, io.EOF) {
+			return nil, err
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), config)
+		if err != nil {
+			return nil, err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) != 0 {
+			return nil, fmt.Errorf("unknown keys %v", undecoded)
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration format %q, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	return config, nil
+}
+
+// binding ties a scalar field at path, a *string, *bool, *int, **int or
+// **float64, to the environment variable env overriding it.
+type binding struct {
+	path  string
+	env   string
+	field any
+}
+
+func (c *Config) bindings() []binding {
+	return []binding{
+		{"source.type", "EPCP_SOURCE", &c.Source.Type},
+		{"source.wsdl", "EPCP_WSDL", &c.Source.WSDL},
+		{"source.price_file", "EPCP_PRICE_FILE", &c.Source.PriceFile},
+		{"source.synthetic.base", "EPCP_SYNTH_BASE", &c.Source.Synthetic.Base},
+		{"source.synthetic.amplitude", "EPCP_SYNTH_AMPLITUDE", &c.Source.Synthetic.Amplitude},
+		{"source.synthetic.peak_hour", "EPCP_SYNTH_PEAK_HOUR", &c.Source.Synthetic.PeakHour},
+		{"source.synthetic.noise", "EPCP_SYNTH_NOISE", &c.Source.Synthetic.Noise},
+		{"source.synthetic.spikes", "EPCP_SYNTH_SPIKES", &c.Source.Synthetic.Spikes},
+		{"source.synthetic.seed", "EPCP_SYNTH_SEED", &c.Source.Synthetic.Seed},
+		{"source.hours", "EPCP_HOURS", &c.Source.Hours},
+		{"source.forecast", "EPCP_FORECAST", &c.Source.Forecast},
+		{"source.forecast_conservative", "EPCP_FORECAST_CONSERVATIVE", &c.Source.ForecastConservative},
+		{"source.failover_failures", "EPCP_FAILOVER_FAILURES", &c.Source.FailoverFailures},
+		{"source.failover_probe", "EPCP_FAILOVER_PROBE", &c.Source.FailoverProbe},
+		{"source.eur_czk", "EPCP_EUR_CZK", &c.Source.EurCzk},
+		{"source.max_staleness", "EPCP_MAX_STALENESS", &c.Source.MaxStaleness},
+		{"source.stale_action", "EPCP_STALE_ACTION", &c.Source.StaleAction},
+		{"source.ignore_provisional", "EPCP_IGNORE_PROVISIONAL", &c.Source.IgnoreProvisional},
+		{"source.provisional_weight", "EPCP_PROVISIONAL_WEIGHT", &c.Source.ProvisionalWeight},
+		{"source.profile_file", "EPCP_PROFILE_FILE", &c.Source.ProfileFile},
+		{"source.profile_fallback", "EPCP_PROFILE_FALLBACK", &c.Source.ProfileFallback},
+		{"source.price_min", "EPCP_PRICE_MIN", &c.Source.PriceMin},
+		{"source.price_max", "EPCP_PRICE_MAX", &c.Source.PriceMax},
+		{"source.quarantine_fraction", "EPCP_QUARANTINE_FRACTION", &c.Source.QuarantineFraction},
+		{"source.quarantine_file", "EPCP_QUARANTINE_FILE", &c.Source.QuarantineFile},
+		{"source.rate_limit", "EPCP_RATE_LIMIT", &c.Source.RateLimit},
+		{"source.bootstrap_days", "EPCP_BOOTSTRAP_DAYS", &c.Source.BootstrapDays},
+		{"policy.safe_mode", "EPCP_SAFE_MODE", &c.Policy.SafeMode},
+		{"policy.metric", "EPCP_DECISION_METRIC", &c.Policy.Metric},
+		{"source.peer.url", "EPCP_PEER_URL", &c.Source.Peer.URL},
+		{"source.peer.max_age", "EPCP_PEER_MAX_AGE", &c.Source.Peer.MaxAge},
+		{"source.peer.key", "EPCP_PEER_KEY", &c.Source.Peer.Key},
+		{"source.peer.previous_key", "EPCP_PEER_PREVIOUS_KEY", &c.Source.Peer.PreviousKey},
+		{"apply.strict", "EPCP_STRICT", &c.Apply.Strict},
+		{"apply.require_sysfs", "EPCP_REQUIRE_SYSFS", &c.Apply.RequireSysfs},
+		{"apply.restore_on_exit", "EPCP_RESTORE_ON_EXIT", &c.Apply.RestoreOnExit},
+		{"apply.sysfs_root", "EPCP_SYSFS_ROOT", &c.Apply.SysfsRoot},
+		{"apply.reconcile", "EPCP_RECONCILE", &c.Apply.Reconcile},
+		{"apply.skip_sampling", "EPCP_SKIP_SAMPLING", &c.Apply.SkipSampling},
+		{"apply.workers", "EPCP_APPLY_WORKERS", &c.Apply.Workers},
+		{"apply.boot_grace", "EPCP_BOOT_GRACE", &c.Apply.BootGrace},
+		{"schedule.interval", "EPCP_INTERVAL", &c.Schedule.Interval},
+		{"schedule.eval_offset", "EPCP_EVAL_OFFSET", &c.Schedule.EvalOffset},
+		{"schedule.jitter", "EPCP_JITTER", &c.Schedule.Jitter},
+		{"schedule.ramp", "EPCP_RAMP", &c.Schedule.Ramp},
+		{"schedule.ramp_steps", "EPCP_RAMP_STEPS", &c.Schedule.RampSteps},
+		{"schedule.dam_watch_start", "EPCP_DAM_WATCH_START", &c.Schedule.DamStart},
+		{"schedule.dam_watch_deadline", "EPCP_DAM_WATCH_DEADLINE", &c.Schedule.DamDeadline},
+		{"schedule.dam_watch_poll", "EPCP_DAM_WATCH_POLL", &c.Schedule.DamPoll},
+		{"schedule.maintenance_frequency", "EPCP_MAINTENANCE_FREQUENCY", &c.Schedule.MaintenanceFrequency},
+		{"scheduler.drain_command", "EPCP_DRAIN_COMMAND", &c.Scheduler.DrainCommand},
+		{"scheduler.resume_command", "EPCP_RESUME_COMMAND", &c.Scheduler.ResumeCommand},
+		{"scheduler.timeout", "EPCP_DRAIN_TIMEOUT", &c.Scheduler.Timeout},
+		{"battery.url", "EPCP_BATTERY_URL", &c.Battery.URL},
+		{"battery.field", "EPCP_BATTERY_FIELD", &c.Battery.Field},
+		{"battery.high", "EPCP_BATTERY_HIGH", &c.Battery.High},
+		{"battery.low", "EPCP_BATTERY_LOW", &c.Battery.Low},
+		{"state.dir", "EPCP_STATE_DIR", &c.State.Dir},
+		{"state.lock_wait", "EPCP_LOCK_WAIT", &c.State.LockWait},
+		{"state.history_days", "EPCP_HISTORY_DAYS", &c.State.HistoryDays},
+		{"state.history_hourly_days", "EPCP_HISTORY_HOURLY_DAYS", &c.State.HistoryHourlyDays},
+		{"state.history_daily_days", "EPCP_HISTORY_DAILY_DAYS", &c.State.HistoryDailyDays},
+		{"outputs.decision_log", "EPCP_DECISION_LOG", &c.Outputs.DecisionLog},
+		{"outputs.textfile", "EPCP_TEXTFILE", &c.Outputs.Textfile},
+		{"outputs.listen", "EPCP_LISTEN", &c.Outputs.Listen},
+		{"outputs.debug_listen", "EPCP_DEBUG_LISTEN", &c.Outputs.DebugListen},
+		{"outputs.control_socket", "EPCP_CONTROL_SOCKET", &c.Outputs.ControlSocket},
+		{"outputs.serve_prices", "EPCP_SERVE_PRICES", &c.Outputs.ServePrices},
+		{"outputs.rapl", "EPCP_RAPL", &c.Outputs.RAPL},
+		{"outputs.price_unit", "EPCP_PRICE_UNIT", &c.Outputs.PriceUnit},
+		{"outputs.locale", "EPCP_LOCALE", &c.Outputs.Locale},
+		{"outputs.notify_queue", "EPCP_NOTIFY_QUEUE", &c.Outputs.NotifyQueue},
+		{"outputs.report.dir", "EPCP_REPORT_DIR", &c.Outputs.Report.Dir},
+		{"outputs.report.period", "EPCP_REPORT_PERIOD", &c.Outputs.Report.Period},
+		{"outputs.report.format", "EPCP_REPORT_FORMAT", &c.Outputs.Report.Format},
+		{"outputs.otlp_endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT", &c.Outputs.OTLPEndpoint},
+		{"outputs.log.file", "EPCP_LOG_FILE", &c.Outputs.Log.File},
+		{"outputs.log.max_size", "EPCP_LOG_MAX_SIZE", &c.Outputs.Log.MaxSize},
+		{"outputs.log.max_backups", "EPCP_LOG_MAX_BACKUPS", &c.Outputs.Log.MaxBackups},
+		{"outputs.influx.file", "EPCP_INFLUX_FILE", &c.Outputs.Influx.File},
+		{"outputs.influx.url", "EPCP_INFLUX_URL", &c.Outputs.Influx.URL},
+		{"outputs.influx.org", "EPCP_INFLUX_ORG", &c.Outputs.Influx.Org},
+		{"outputs.influx.bucket", "EPCP_INFLUX_BUCKET", &c.Outputs.Influx.Bucket},
+		{"outputs.influx.token", "EPCP_INFLUX_TOKEN", &c.Outputs.Influx.Token},
+		{"outputs.influx.batch", "EPCP_INFLUX_BATCH", &c.Outputs.Influx.Batch},
+		{"outputs.webhook.url", "EPCP_WEBHOOK_URL", &c.Outputs.Webhook.URL},
+		{"outputs.webhook.format", "EPCP_WEBHOOK_FORMAT", &c.Outputs.Webhook.Format},
+		{"outputs.webhook.status_url", "EPCP_STATUS_URL", &c.Outputs.Webhook.StatusURL},
+		{"outputs.webhook.price_high", "EPCP_ALERT_PRICE_HIGH", &c.Outputs.Webhook.PriceHigh},
+		{"outputs.webhook.price_low", "EPCP_ALERT_PRICE_LOW", &c.Outputs.Webhook.PriceLow},
+		{"outputs.webhook.period", "EPCP_ALERT_PERIOD", &c.Outputs.Webhook.Period},
+		{"outputs.mqtt.url", "EPCP_MQTT_URL", &c.Outputs.MQTT.URL},
+		{"outputs.mqtt.username", "EPCP_MQTT_USERNAME", &c.Outputs.MQTT.Username},
+		{"outputs.mqtt.password", "EPCP_MQTT_PASSWORD", &c.Outputs.MQTT.Password},
+		{"outputs.mqtt.topic_prefix", "EPCP_MQTT_TOPIC_PREFIX", &c.Outputs.MQTT.TopicPrefix},
+		{"outputs.condor.prefix", "EPCP_CONDOR_PREFIX", &c.Outputs.Condor.Prefix},
+		{"outputs.condor.update_command", "EPCP_CONDOR_UPDATE_COMMAND", &c.Outputs.Condor.UpdateCommand},
+		{"outputs.sensor.token", "EPCP_SENSOR_TOKEN", &c.Outputs.Sensor.Token},
+		{"outputs.sensor.cors_origin", "EPCP_SENSOR_CORS_ORIGIN", &c.Outputs.Sensor.CORSOrigin},
+		{"outputs.dbus", "EPCP_DBUS", &c.Outputs.DBus},
+	}
+}
+
+// mergeEnv overrides the fields with the environment variables that are set,
+// resulting in the effective configuration. It returns the variables that
+// do not parse.
+func (c *Config) mergeEnv() error {
+	var errs []error
+	for _, b := range c.bindings() {
+		value := getenv(b.env)
+		if value == "" {
+			continue
+		}
+		var err error
+		switch field := b.field.(type) {
+		case *string:
+			*field = value
+		case *bool:
+			*field, err = strconv.ParseBool(value)
+		case *int:
+			*field, err = strconv.Atoi(value)
+		case **int:
+			var n int
+			n, err = strconv.Atoi(value)
+			*field = &n
+		case **float64:
+			var f float64
+			f, err = strconv.ParseFloat(value, 64)
+			*field = &f
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s=%s: invalid value", b.env, value))
+		}
+	}
+	helper, socket := getenv("EPCP_APPLY_HELPER"), getenv("EPCP_APPLY_SOCKET")
+	if helper != "" || socket != "" {
+		// The helper takes the place of the frequency actuator in the order
+		helperActuator := ActuatorConfig{Type: "helper", Command: helper, Socket: socket}
+		i := slices.IndexFunc(c.Actuators, func(a ActuatorConfig) bool { return !extraActuators[a.Type] })
+		c.Actuators = slices.DeleteFunc(c.Actuators, func(a ActuatorConfig) bool { return !extraActuators[a.Type] })
+		c.Actuators = slices.Insert(c.Actuators, max(i, 0), helperActuator)
+	}
+	return e.Join(errs...)
+}
+
+// label names the field at path together with its environment variable.
+func (c *Config) label(path string) string {
+	for _, b := range c.bindings() {
+		if b.path == path {
+			return path + " (" + b.env + ")"
+		}
+	}
+	return path
+}
+
+// Validate checks every field of the configuration and returns all the
+// problems found.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(path string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", c.label(path), fmt.Sprintf(format, args...)))
+	}
+	duration := func(path, value string, min time.Duration) time.Duration {
+		if value == "" {
+			return 0
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			fail(path, "invalid duration %q", value)
+		} else if d < min {
+			fail(path, "must be at least %s", min)
+		}
+		return d
+	}
+	clock := func(path, value string) (time.Duration, bool) {
+		if value == "" {
+			return 0, false
+		}
+		d, err := parseClock(value)
+		if err != nil {
+			fail(path, "invalid time of day %q, expected HH:MM", value)
+		}
+		return d, err == nil
+	}
+	address := func(path, value string, schemes ...string) {
+		if value == "" {
+			return
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" || !slices.Contains(schemes, u.Scheme) {
+			fail(path, "invalid URL %q, expected %s://host...", value, strings.Join(schemes, ":// or "))
+		}
+	}
+
+	source := func(path, name string) {
+		switch name {
+		case "", "ote", "synthetic", "profile":
+		case "file":
+			if c.Source.PriceFile == "" {
+				fail("source.price_file", "required by the file source")
+			} else if source, err := pricefile.Load(c.Source.PriceFile); err != nil {
+				fail("source.price_file", "%s", err.Error())
+			} else {
+				c.Source.priceFile = source
+			}
+		case "peer":
+			if c.Source.Peer.URL == "" {
+				fail("source.peer.url", "required by the peer source")
+			}
+		default:
+			fail(path, "unknown source %q, expected ote, file, synthetic, peer or profile", name)
+		}
+	}
+	source("source.type", c.Source.Type)
+	if len(c.Source.Failover) != 0 && c.Source.Type != "" {
+		fail("source.type", "conflicts with source.failover, which lists the sources")
+	}
+	for i, name := range c.Source.Failover {
+		if name == "" || slices.Contains(c.Source.Failover[:i], name) {
+			fail("source.failover", "empty or repeated source %q", name)
+			continue
+		}
+		source("source.failover", name)
+	}
+	if c.Source.ProfileFile != "" {
+		if _, err := profile.Load(c.Source.ProfileFile); err != nil {
+			fail("source.profile_file", "%s", err.Error())
+		}
+	}
+	if c.Source.FailoverFailures < 0 {
+		fail("source.failover_failures", "must not be negative")
+	}
+	duration("source.failover_probe", c.Source.FailoverProbe, time.Second)
+	for _, name := range sortedKeys(c.Source.Units) {
+		if _, err := c.Source.priceFactor(name); err != nil {
+			fail("source.units", "%s: %s", name, err.Error())
+		}
+	}
+	if r := c.Source.EurCzk; r != nil && *r <= 0 {
+		fail("source.eur_czk", "must be positive")
+	}
+	duration("source.max_staleness", c.Source.MaxStaleness, time.Minute)
+	if w := c.Source.ProvisionalWeight; w != nil && (*w < 0 || *w > 1) {
+		fail("source.provisional_weight", "must be between 0 and 1, got %g", *w)
+	}
+	if low, high := c.Source.priceBounds(); low >= high {
+		fail("source.price_max", "must be above source.price_min, got %g and %g", high, low)
+	}
+	if f := c.Source.QuarantineFraction; f != nil && (*f < 0 || *f > 1) {
+		fail("source.quarantine_fraction", "must be between 0 and 1, got %g", *f)
+	}
+	duration("source.rate_limit", c.Source.RateLimit, 0)
+	if c.Source.BootstrapDays < 0 {
+		fail("source.bootstrap_days", "must not be negative")
+	}
+	if a := c.Source.StaleAction; a != "" && a != staleSafe && a != staleConservative {
+		fail("source.stale_action", "unknown action %q, expected safe or conservative", a)
+	}
+	address("source.peer.url", c.Source.Peer.URL, "http", "https")
+	duration("source.peer.max_age", c.Source.Peer.MaxAge, time.Second)
+	if c.Source.Peer.PreviousKey != "" && c.Source.Peer.Key == "" {
+		fail("source.peer.previous_key", "is only accepted next to source.peer.key")
+	}
+	if f := c.Source.Forecast; f != "" && forecast.Models[f] == nil {
+		fail("source.forecast", "unknown model %q, expected persistence or weekly_median", f)
+	}
+	synth := c.Source.Synthetic.params()
+	if synth.Amplitude < 0 {
+		fail("source.synthetic.amplitude", "must not be negative")
+	}
+	if synth.PeakHour < 0 || synth.PeakHour >= 24 {
+		fail("source.synthetic.peak_hour", "must be an hour of the day, 0 to 24")
+	}
+	if synth.Noise < 0 {
+		fail("source.synthetic.noise", "must not be negative")
+	}
+	if synth.Spikes < 0 || synth.Spikes > 1 {
+		fail("source.synthetic.spikes", "must be a probability, 0 to 1")
+	}
+	address("source.wsdl", c.Source.WSDL, "http", "https")
+	if c.Source.Hours != "" {
+		if _, err := parseHistoryWindow(c.Source.Hours); err != nil {
+			fail("source.hours", "%s", err.Error())
+		}
+	}
+	if c.Policy.Name != "" {
+		accepted, ok := policy.Parameters[c.Policy.Name]
+		if !ok {
+			fail("policy.name", "unknown policy %q", c.Policy.Name)
+		}
+		for name := range c.Policy.Parameters {
+			if ok && !slices.Contains(accepted, name) {
+				fail("policy.parameters", "unknown parameter %q of policy %s", name, c.Policy.Name)
+				ok = false
+			}
+		}
+		if _, err := c.Policy.policy(); ok && err != nil {
+			fail("policy.parameters", "%s", err.Error())
+		}
+	}
+	if c.Policy.Metric != "" {
+		if _, err := parseDecisionMetric(c.Policy.Metric); err != nil {
+			fail("policy.metric", "%s", err.Error())
+		}
+	}
+	if m := c.Policy.SafeMode; m != "" && m != safeHold && m != safeMax && m != safeMin {
+		fail("policy.safe_mode", "unknown safe mode %q, expected hold, max or min", m)
+	}
+	for dayType, override := range c.Policy.DayTypes {
+		path := "policy.day_types." + dayType
+		if !slices.Contains(calendar.DayTypes, dayType) {
+			fail(path, "unknown day type %q, expected one of %s", dayType, strings.Join(calendar.DayTypes, ", "))
+			continue
+		}
+		name := c.Policy.dayType(dayType).Name
+		if name == "" {
+			name = "trend"
+		}
+		accepted, ok := policy.Parameters[name]
+		if !ok && override.Name != "" {
+			fail(path+".name", "unknown policy %q", override.Name)
+		}
+		for parameter := range override.Parameters {
+			if ok && !slices.Contains(accepted, parameter) {
+				fail(path+".parameters", "unknown parameter %q of policy %s", parameter, name)
+				ok = false
+			}
+		}
+		if _, err := c.Policy.dayType(dayType).policy(); ok && err != nil {
+			fail(path+".parameters", "%s", err.Error())
+		}
+	}
+	if _, err := calendar.New(c.Calendar.Holidays); err != nil {
+		fail("calendar.holidays", "%s", err.Error())
+	}
+	if c.Apply.Workers < 0 {
+		fail("apply.workers", "must not be negative")
+	}
+	duration("apply.boot_grace", c.Apply.BootGrace, 0)
+	if c.Apply.SysfsRoot != "" && !filepath.IsAbs(c.Apply.SysfsRoot) {
+		fail("apply.sysfs_root", "must be an absolute path")
+	}
+	for _, band := range sortedKeys(c.Apply.Targets) {
+		if band != policy.Cheap && band != policy.Expensive {
+			fail("apply.targets", "unknown band %q, expected %s or %s", band, policy.Cheap, policy.Expensive)
+		} else if _, err := parseTarget(c.Apply.Targets[band]); err != nil {
+			fail("apply.targets."+band, "%s", err.Error())
+		}
+	}
+	for node, n := range c.Apply.NUMA {
+		path := "apply.numa." + node
+		if i, err := strconv.Atoi(node); err != nil || i < 0 {
+			fail(path, "invalid NUMA node %q, expected its number", node)
+		}
+		for band, frequency := range n.Bands {
+			if band != policy.Cheap && band != policy.Expensive {
+				fail(path+".bands", "unknown band %q, expected %s or %s", band, policy.Cheap, policy.Expensive)
+			} else if frequency <= 0 {
+				fail(path+".bands", "the frequency of the %s band must be positive kHz", band)
+			}
+		}
+	}
+	_, floorErrs := parseFloors(c.Apply.Floors)
+	for _, err := range floorErrs {
+		fail("apply.floors", "%s", err.Error())
+	}
+	for name, frequency := range c.Apply.Floors {
+		if frequency <= 0 {
+			fail("apply.floors", "the floor of %s must be positive kHz", name)
+		}
+	}
+	types, frequency := make(map[string]int), 0
+	for _, a := range c.Actuators {
+		if a.Disabled {
+			continue
+		}
+		if types[a.Type]++; !extraActuators[a.Type] {
+			frequency++
+		}
+	}
+	if frequency > 1 || types["redfish"] > 1 || types["libvirt"] > 1 || types["docker"] > 1 || types["systemd"] > 1 {
+		fail("actuators", "only one frequency actuator and one of each other type are supported")
+	}
+	for i, a := range c.Actuators {
+		path := fmt.Sprintf("actuators[%d]", i)
+		switch a.Type {
+		case "sysfs", "simulation":
+		case "helper":
+			if a.Command == "" && a.Socket == "" {
+				fail(path, "the helper needs a command or a socket")
+			}
+		case "redfish":
+			if a.URL == "" {
+				fail(path+".url", "the redfish actuator needs the URL of the chassis")
+			}
+			address(path+".url", a.URL, "http", "https")
+			for band, watts := range a.Caps {
+				if band != policy.Cheap && band != policy.Expensive {
+					fail(path+".caps", "unknown band %q, expected %s or %s", band, policy.Cheap, policy.Expensive)
+				} else if watts <= 0 {
+					fail(path+".caps", "the cap of the %s band must be positive watts", band)
+				}
+			}
+		case "libvirt", "docker", "systemd":
+			if a.Type == "libvirt" && len(a.Domains) == 0 {
+				fail(path+".domains", "the libvirt actuator needs the domains to tune")
+			}
+			if a.Type == "systemd" && len(a.Units) == 0 {
+				fail(path+".units", "the systemd actuator needs the units to tune")
+			}
+			for _, unit := range a.Units {
+				if a.Type == "systemd" && !slices.Contains([]string{".slice", ".service", ".scope"}, filepath.Ext(unit)) {
+					fail(path+".units", "%q is not a slice, service or scope", unit)
+				}
+			}
+			if a.Type == "docker" && a.Socket != "" && !filepath.IsAbs(a.Socket) {
+				fail(path+".socket", "must be an absolute path")
+			}
+			for band, factor := range a.Shares {
+				if band != policy.Cheap && band != policy.Expensive {
+					fail(path+".shares", "unknown band %q, expected %s or %s", band, policy.Cheap, policy.Expensive)
+				} else if factor <= 0 || factor > 1 {
+					fail(path+".shares", "the shares of the %s band must be a factor above 0 and at most 1", band)
+				}
+			}
+		default:
+			fail(path+".type", "unknown actuator %q", a.Type)
+		}
+	}
+	interval := duration("schedule.interval", c.Schedule.Interval, 0)
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	if offset := duration("schedule.eval_offset", c.Schedule.EvalOffset, 0); offset >= min(interval, time.Hour) {
+		fail("schedule.eval_offset", "must be below the interval and an hour, got %s", offset)
+	}
+	duration("schedule.jitter", c.Schedule.Jitter, 0)
+	if ramp := duration("schedule.ramp", c.Schedule.Ramp, 0); ramp >= min(interval, time.Hour) {
+		fail("schedule.ramp", "must be below the interval and an hour, got %s", ramp)
+	}
+	if c.Schedule.RampSteps < 0 {
+		fail("schedule.ramp_steps", "must not be negative")
+	}
+	duration("schedule.dam_watch_poll", c.Schedule.DamPoll, time.Minute)
+	start, okStart := clock("schedule.dam_watch_start", c.Schedule.DamStart)
+	deadline, okDeadline := clock("schedule.dam_watch_deadline", c.Schedule.DamDeadline)
+	if !okStart {
+		start = 13 * time.Hour
+	}
+	if !okDeadline {
+		deadline = 16 * time.Hour
+	}
+	if start >= deadline {
+		fail("schedule.dam_watch_deadline", "must be after the start of the watch")
+	}
+	for _, window := range c.Schedule.Maintenance {
+		if _, err := parseMaintenanceWindow(window); err != nil {
+			fail("schedule.maintenance", "%s", err.Error())
+		}
+	}
+	if c.Schedule.MaintenanceFrequency < 0 {
+		fail("schedule.maintenance_frequency", "must not be negative")
+	}
+	if (c.Scheduler.DrainCommand == "") != (c.Scheduler.ResumeCommand == "") {
+		fail("scheduler.resume_command", "the drain and the resume command must be set together")
+	}
+	duration("scheduler.timeout", c.Scheduler.Timeout, time.Second)
+	address("battery.url", c.Battery.URL, "nut", "http", "https")
+	if u, err := url.Parse(c.Battery.URL); err == nil && u.Scheme == "nut" && strings.Trim(u.Path, "/") == "" {
+		fail("battery.url", "no UPS in %q, expected nut://host/ups", c.Battery.URL)
+	}
+	if high, low := c.Battery.thresholds(); low < 0 || high > 100 || low >= high {
+		fail("battery.high", "the thresholds must be percentages with low below high")
+	}
+	if s := c.Solar; s.KWp < 0 {
+		fail("solar.kwp", "must be positive")
+	} else if s.KWp > 0 {
+		if s.Latitude < -90 || s.Latitude > 90 || s.Longitude < -180 || s.Longitude > 180 {
+			fail("solar.latitude", "the location must be latitude and longitude in degrees")
+		}
+		if s.Declination < 0 || s.Declination > 90 {
+			fail("solar.declination", "must be 0 to 90 degrees")
+		}
+		if s.Azimuth < -180 || s.Azimuth > 180 {
+			fail("solar.azimuth", "must be -180 to 180 degrees from the south")
+		}
+		if s.LoadKW <= 0 {
+			fail("solar.load_kw", "the load consuming the production must be positive kW")
+		}
+	}
+	duration("state.lock_wait", c.State.LockWait, 0)
+	if d := c.State.HistoryDays; d != 0 && d < forecastDays {
+		fail("state.history_days", "must be at least %d, the days the forecasts read, got %d", forecastDays, d)
+	}
+	hourlyDays := c.State.HistoryHourlyDays
+	if hourlyDays == 0 {
+		hourlyDays = 90
+	}
+	if d := c.State.HistoryHourlyDays; d != 0 && d < max(c.State.HistoryDays, 8) {
+		fail("state.history_hourly_days", "must be at least state.history_days, got %d", d)
+	}
+	if d := c.State.HistoryDailyDays; d < 0 || d != 0 && d < max(c.State.HistoryDays, 8, hourlyDays) {
+		fail("state.history_daily_days", "must be 0, to keep the daily statistics for ever, or at least state.history_hourly_days")
+	}
+	if c.Outputs.Log.MaxSize != "" {
+		if _, err := parseSize(c.Outputs.Log.MaxSize); err != nil {
+			fail("outputs.log.max_size", "invalid size %q, expected bytes with an optional K, M or G suffix", c.Outputs.Log.MaxSize)
+		}
+	}
+	if c.Outputs.Log.MaxBackups != nil && *c.Outputs.Log.MaxBackups < 0 {
+		fail("outputs.log.max_backups", "must not be negative")
+	}
+	address("outputs.otlp_endpoint", c.Outputs.OTLPEndpoint, "http", "https")
+	address("outputs.influx.url", c.Outputs.Influx.URL, "http", "https")
+	if c.Outputs.Influx.Batch < 0 {
+		fail("outputs.influx.batch", "must be at least 1")
+	}
+	webhook := func(path string, w WebhookConfig) {
+		address(path+".url", w.URL, "http", "https")
+		address(path+".status_url", w.StatusURL, "http", "https")
+		if f := w.Format; f != "" && f != "slack" && f != "matrix" {
+			fail(path+".format", "unknown format %q, expected slack or matrix", f)
+		}
+		if high, low := w.PriceHigh, w.PriceLow; high != nil && low != nil && *low >= *high {
+			fail(path+".price_low", "must be below the high price %g", *high)
+		}
+		duration(path+".period", w.Period, time.Nanosecond)
+	}
+	webhook("outputs.webhook", c.Outputs.Webhook)
+	address("outputs.mqtt.url", c.Outputs.MQTT.URL, "mqtt", "mqtts", "tcp", "ssl")
+	if c.Outputs.NotifyQueue < 0 {
+		fail("outputs.notify_queue", "must be at least 1")
+	}
+	if p := c.Outputs.Report.Period; p != "" && p != "month" && p != "week" {
+		fail("outputs.report.period", "unknown period %q, expected month or week", p)
+	}
+	if f := c.Outputs.Report.Format; f != "" && f != "md" && f != "json" {
+		fail("outputs.report.format", "unknown format %q, expected md or json", f)
+	}
+	if c.Outputs.Report.Dir != "" && c.Outputs.DecisionLog == "" {
+		fail("outputs.report.dir", "needs outputs.decision_log")
+	}
+	if p := c.Outputs.Condor.Prefix; p != "" && !classAdAttribute.MatchString(p) {
+		fail("outputs.condor.prefix", "invalid ClassAd attribute name %q", p)
+	}
+	if (c.Outputs.Sensor.Token != "" || c.Outputs.Sensor.CORSOrigin != "") && c.Outputs.Listen == "" {
+		fail("outputs.sensor", "the sensor is served by the status server, which needs outputs.listen")
+	}
+	if c.Outputs.ServePrices && c.Outputs.Listen == "" {
+		fail("outputs.serve_prices", "the prices are served by the status server, which needs outputs.listen")
+	}
+	if _, err := newPriceDisplay(c.Outputs.PriceUnit, "", c.Source.EurCzk); err != nil {
+		fail("outputs.price_unit", "%s", err.Error())
+	}
+	if _, err := newPriceDisplay("", c.Outputs.Locale, nil); err != nil {
+		fail("outputs.locale", "%s", err.Error())
+	}
+	if b := c.Outputs.DBus; b != "" && b != "system" && b != "session" {
+		fail("outputs.dbus", "unknown bus %q, expected system or session", b)
+	}
+	channels := map[string]bool{electricityChannel: true}
+	for i, ch := range c.Channels {
+		path := fmt.Sprintf("channels[%d]", i)
+		if !channelName.MatchString(ch.Name) {
+			fail(path+".name", "invalid name %q, expected lowercase letters, digits, - and _", ch.Name)
+		} else if channels[ch.Name] {
+			fail(path+".name", "repeated or reserved name %q", ch.Name)
+		}
+		channels[ch.Name] = true
+		switch ch.Source.Type {
+		case "synthetic":
+		case "file":
+			if ch.Source.PriceFile == "" {
+				fail(path+".source.price_file", "required by the file source")
+			} else if source, err := pricefile.Load(ch.Source.PriceFile); err != nil {
+				fail(path+".source.price_file", "%s", err.Error())
+			} else {
+				c.Channels[i].Source.priceFile = source
+			}
+		default:
+			fail(path+".source.type", "unknown source %q, expected file or synthetic", ch.Source.Type)
+		}
+		if p := ch.Policy; len(p.DayTypes) != 0 || p.Metric != "" || p.SafeMode != "" {
+			fail(path+".policy", "a channel takes only the name and the parameters of its policy")
+		}
+		if _, ok := policy.Parameters[ch.Policy.Name]; ch.Policy.Name != "" && !ok {
+			fail(path+".policy.name", "unknown policy %q", ch.Policy.Name)
+		} else if _, err := ch.Policy.policy(); err != nil {
+			fail(path+".policy.parameters", "%s", err.Error())
+		}
+		webhook(path+".webhook", ch.Webhook)
+	}
+	return e.Join(errs...)
+}
+
+// parseHistoryWindow parses how far into the past the prices are fetched,
+// either a number of hours or a duration. The sign is ignored, so "3", "-3"
+// and "3h" all mean the last three hours.
+func parseHistoryWindow(value string) (time.Duration, error) {
+	window, err := time.ParseDuration(value)
+	if hours, errHours := strconv.Atoi(value); errHours == nil {
+		window, err = time.Duration(hours)*time.Hour, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid hours %q, expected a number of hours or a duration", value)
+	}
+	if window < 0 {
+		window = -window
+	}
+	if window < time.Hour || window > 168*time.Hour {
+		return 0, fmt.Errorf("%s is out of range, expected 1h to 168h", window)
+	}
+	return window, nil
+}
+
+// parseClock parses a HH:MM time of day.
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// effectiveConfig is the configuration in use, see configure.
+var effectiveConfig = &Config{}
+
+// configure loads the --config file, merges the environment into it and
+// validates the result before setting up the program from it.
+func configure() error {
+	config, err := effective()
+	if err != nil {
+		return err
+	}
+	if err := config.apply(); err != nil {
+		return err
+	}
+	effectiveConfig = config
+	configView = newConfigView(config)
+	return nil
+}
+
+// effective returns the validated configuration of the --config file and
+// the environment.
+func effective() (*Config, error) {
+	config := &Config{}
+	if configPath != "" {
+		var err error
+		if config, err = loadConfig(configPath); err != nil {
+			return nil, fmt.Errorf("%s: %w", configPath, err)
+		}
+	}
+	if err := e.Join(config.mergeEnv(), config.Validate()); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// apply sets up the program from the validated configuration. It fails only
+// when a source cannot be set up.
+func (c *Config) apply() error {
+	duration := func(value string, fallback time.Duration) time.Duration {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+		return fallback
+	}
+	or := func(value, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+	setupLogFile(c.Outputs.Log)
+	historyWindow = 3 * time.Hour
+	if window, err := parseHistoryWindow(c.Source.Hours); err == nil {
+		historyWindow = window
+	}
+	forecastName, forecastConservative = c.Source.Forecast, c.Source.ForecastConservative
+	maxStaleness = duration(c.Source.MaxStaleness, 0)
+	staleAction = staleSafe
+	if c.Source.StaleAction != "" {
+		staleAction = c.Source.StaleAction
+	}
+	ignoreProvisional = c.Source.IgnoreProvisional
+	priceMin, priceMax = c.Source.priceBounds()
+	quarantineFraction, quarantineFile = 0.5, c.Source.QuarantineFile
+	if c.Source.QuarantineFraction != nil {
+		quarantineFraction = *c.Source.QuarantineFraction
+	}
+	profileFallback, profileFile = c.Source.ProfileFallback, c.Source.ProfileFile
+	oteLimiter.setInterval(duration(c.Source.RateLimit, time.Second))
+	bootstrapDays = c.Source.BootstrapDays
+	provisionalWeight = 1
+	if c.Source.ProvisionalWeight != nil {
+		provisionalWeight = *c.Source.ProvisionalWeight
+	}
+	decisionMetric = nil
+	if c.Policy.Metric != "" {
+		decisionMetric, _ = parseDecisionMetric(c.Policy.Metric)
+	}
+	safeMode = safeHold
+	if c.Policy.SafeMode != "" {
+		safeMode = c.Policy.SafeMode
+	}
+	peerKeys = nil
+	for _, key := range []string{c.Source.Peer.Key, c.Source.Peer.PreviousKey} {
+		if key != "" {
+			peerKeys = append(peerKeys, []byte(key))
+		}
+	}
+	// The price files were loaded by Validate already
+	var err error
+	if priceSource, err = c.Source.priceSource(); err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	priceSource = coalescingSource(priceSource)
+	cyclePolicy, _ = c.Policy.policy()
+	dayPolicies, _ = c.Policy.dayPolicies()
+	dayCalendar, _ = calendar.New(c.Calendar.Holidays)
+	cycleInterval = duration(c.Schedule.Interval, 0)
+	evalOffset = duration(c.Schedule.EvalOffset, 0)
+	jitter = duration(c.Schedule.Jitter, 0)
+	rampDuration, rampSteps = duration(c.Schedule.Ramp, 0), 5
+	if c.Schedule.RampSteps > 0 {
+		rampSteps = c.Schedule.RampSteps
+	}
+	damWatchStart, damWatchEnd = 13*time.Hour, 16*time.Hour
+	if start, err := parseClock(c.Schedule.DamStart); err == nil {
+		damWatchStart = start
+	}
+	if end, err := parseClock(c.Schedule.DamDeadline); err == nil {
+		damWatchEnd = end
+	}
+	damWatchPoll = duration(c.Schedule.DamPoll, 5*time.Minute)
+	maintenanceWindows = nil
+	for _, window := range c.Schedule.Maintenance {
+		if w, err := parseMaintenanceWindow(window); err == nil {
+			maintenanceWindows = append(maintenanceWindows, w)
+		}
+	}
+	maintenanceFrequency = c.Schedule.MaintenanceFrequency
+	drainCommand, resumeCommand = c.Scheduler.DrainCommand, c.Scheduler.ResumeCommand
+	drainTimeout = duration(c.Scheduler.Timeout, 30*time.Second)
+	batterySource = newBatterySource(c.Battery)
+	batteryHigh, batteryLow = c.Battery.thresholds()
+	if s := c.Solar; s.KWp > 0 {
+		solarSite = &solar.Site{Latitude: s.Latitude, Longitude: s.Longitude, Declination: s.Declination, Azimuth: s.Azimuth, KWp: s.KWp}
+		solarLoad = s.LoadKW
+	}
+	stateDir = or(c.State.Dir, "/var/lib/epcp")
+	lockWait = duration(c.State.LockWait, 0)
+	historyDays, historyHourlyDays, historyDailyDays = 8, 90, c.State.HistoryDailyDays
+	if c.State.HistoryDays != 0 {
+		historyDays = c.State.HistoryDays
+	}
+	if c.State.HistoryHourlyDays != 0 {
+		historyHourlyDays = c.State.HistoryHourlyDays
+	}
+	strict = c.Apply.Strict
+	requireSysfs = c.Apply.RequireSysfs
+	restoreOnExit = c.Apply.RestoreOnExit
+	reconcile = c.Apply.Reconcile
+	skipSampling = c.Apply.SkipSampling
+	applyWorkers = c.Apply.Workers
+	bootGrace = duration(c.Apply.BootGrace, 0)
+	bandTargets = make(map[string]frequencyTarget)
+	for band, text := range c.Apply.Targets {
+		if target, err := parseTarget(text); err == nil {
+			bandTargets[band] = target
+		}
+	}
+	numaNodes = make(map[int]NUMANodeConfig)
+	for node, n := range c.Apply.NUMA {
+		i, _ := strconv.Atoi(node)
+		numaNodes[i] = n
+	}
+	frequencyFloors, _ = parseFloors(c.Apply.Floors)
+	sysfsRoot = or(c.Apply.SysfsRoot, "/sys")
+	actuatorPipeline = newActuatorPipeline(c.Actuators)
+	for _, a := range c.Actuators {
+		if a.Disabled {
+			continue
+		}
+		switch a.Type {
+		case "helper":
+			applyHelper, applySocket = a.Command, a.Socket
+		case "simulation":
+			enableSimulation()
+		case "redfish":
+			powerCap = newPowerCap(a)
+		case "libvirt":
+			guestShares = newGuestTuner(a)
+		case "docker":
+			containerLimits = newContainerTuner(a)
+		case "systemd":
+			unitQuotas = newUnitTuner(a)
+		}
+	}
+	decisionLog = c.Outputs.DecisionLog
+	textfile = c.Outputs.Textfile
+	listenAddress = c.Outputs.Listen
+	debugListen = c.Outputs.DebugListen
+	servePrices = c.Outputs.ServePrices
+	measureEnergy = c.Outputs.RAPL
+	display, _ = newPriceDisplay(c.Outputs.PriceUnit, c.Outputs.Locale, c.Source.EurCzk)
+	priceThreshold = c.Outputs.Webhook.PriceHigh
+	controlSocket = c.Outputs.ControlSocket
+	otlpEndpoint = c.Outputs.OTLPEndpoint
+	if i := c.Outputs.Influx; i.File != "" || i.URL != "" {
+		influx = &influxExporter{file: i.File, url: i.URL, org: i.Org, bucket: i.Bucket, token: i.Token, batch: max(i.Batch, 1)}
+	}
+	notifyQueueSize = 16
+	reportDir, reportWeekly = c.Outputs.Report.Dir, c.Outputs.Report.Period == "week"
+	reportFormat = or(c.Outputs.Report.Format, "md")
+	if c.Outputs.NotifyQueue > 0 {
+		notifyQueueSize = c.Outputs.NotifyQueue
+	}
+	newNotifier := func(w WebhookConfig) *webhookNotifier {
+		if w.URL == "" {
+			return nil
+		}
+		return &webhookNotifier{url: w.URL, format: or(w.Format, "slack"), statusURL: w.StatusURL,
+			high: w.PriceHigh, low: w.PriceLow, period: duration(w.Period, 6*time.Hour)}
+	}
+	notifier = newNotifier(c.Outputs.Webhook)
+	channels = nil
+	for _, ch := range c.Channels {
+		source, err := ch.Source.priceSource()
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+		p, _ := ch.Policy.policy()
+		channel := &priceChannel{name: ch.Name, source: source, policy: p, notifier: newNotifier(ch.Webhook)}
+		if channel.notifier != nil {
+			channel.notifier.channel = ch.Name
+		}
+		channels = append(channels, channel)
+	}
+	condorPrefix = or(c.Outputs.Condor.Prefix, "Epcp")
+	condorUpdate = c.Outputs.Condor.UpdateCommand
+	sensorToken, sensorOrigin = c.Outputs.Sensor.Token, c.Outputs.Sensor.CORSOrigin
+	dbusBus = c.Outputs.DBus
+	if m := c.Outputs.MQTT; m.URL != "" {
+		prefix := m.TopicPrefix
+		if prefix == "" {
+			hostname, _ := os.Hostname()
+			prefix = "epcp/" + hostname
+		}
+		var err error
+		if mqtt, err = newMQTTClient(m.URL, m.Username, m.Password, prefix); err != nil {
+			errorLogger.Printf("Error parsing MQTT broker URL %s: %s. Not publishing.\n", m.URL, err.Error())
+		}
+	}
+	return nil
+}
+
+// runConfig validates the --config file or dumps the effective configuration.
+func runConfig(args []string) int {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	format := flags.String("format", "yaml", "format of the dump, yaml or toml")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: epcp --config file config validate|dump [--format yaml|toml]")
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return int(exitUsage)
+	}
+	action := args[0]
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 0 || (*format != "yaml" && *format != "toml") {
+		flags.Usage()
+		return int(exitUsage)
+	}
+	// Keep stdout for the dump
+	infoLogger.SetOutput(os.Stderr)
+	config, err := effective()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%s\n", err.Error())
+		return int(exitConfig)
+	}
+	switch action {
+	case "validate":
+		if configPath == "" {
+			fmt.Fprintln(os.Stderr, "No configuration file given with --config.")
+			return int(exitUsage)
+		}
+		fmt.Printf("%s: ok\n", configPath)
+	case "dump":
+		if *format == "toml" {
+			err = toml.NewEncoder(os.Stdout).Encode(config)
+		} else {
+			encoder := yaml.NewEncoder(os.Stdout)
+			encoder.SetIndent(2)
+			err = encoder.Encode(config)
+		}
+		if err != nil {
+			errorLogger.Printf("Error encoding configuration: %s\n", err.Error())
+			return 1
+		}
+	default:
+		flags.Usage()
+		return int(exitUsage)
+	}
+	return 0
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+func TestValidate(t *testing.T) {
+	priceLow, priceHigh, fraction := 500.0, 100.0, 1.5
+	tests := []struct {
+		name   string
+		config Config
+		// want are the parts of the error, none for a valid configuration
+		want []string
+	}{
+		{name: "empty"},
+		{name: "complete", config: Config{
+			Source:   SourceConfig{Type: "ote", WSDL: "https://www.ote-cr.cz/services/PublicDataService", Hours: "6"},
+			Policy:   PolicyConfig{Name: "trend", SafeMode: "max"},
+			Apply:    ApplyConfig{Workers: 4, BootGrace: "10m", SysfsRoot: "/host/sys", Targets: map[string]string{"cheap": "max", "expensive": "60%"}},
+			Schedule: ScheduleConfig{Interval: "15m", EvalOffset: "4m", DamStart: "13:00", DamDeadline: "15:30"},
+			State:    StateConfig{LockWait: "30s"},
+		}},
+		{name: "unknown source", config: Config{Source: SourceConfig{Type: "nordpool"}},
+			want: []string{`source.type (EPCP_SOURCE): unknown source "nordpool"`}},
+		{name: "file source without a file", config: Config{Source: SourceConfig{Type: "file"}},
+			want: []string{"source.price_file (EPCP_PRICE_FILE): required by the file source"}},
+		{name: "missing price file", config: Config{Source: SourceConfig{Type: "file", PriceFile: filepath.Join(t.TempDir(), "missing.csv")}},
+			want: []string{"source.price_file (EPCP_PRICE_FILE): ", "missing.csv"}},
+		{name: "peer source without a URL", config: Config{Source: SourceConfig{Type: "peer"}},
+			want: []string{"source.peer.url", "required by the peer source"}},
+		{name: "previous peer key alone", config: Config{Source: SourceConfig{Peer: PeerConfig{PreviousKey: "old secret"}}},
+			want: []string{"source.peer.previous_key (EPCP_PEER_PREVIOUS_KEY): is only accepted next to source.peer.key"}},
+		{name: "failover next to a type", config: Config{Source: SourceConfig{Type: "ote", Failover: []string{"ote", "ote"}}},
+			want: []string{"conflicts with source.failover", `empty or repeated source "ote"`}},
+		{name: "WSDL", config: Config{Source: SourceConfig{WSDL: "www.ote-cr.cz"}},
+			want: []string{`source.wsdl (EPCP_WSDL): invalid URL "www.ote-cr.cz"`}},
+		{name: "hours", config: Config{Source: SourceConfig{Hours: "1000h"}},
+			want: []string{"source.hours (EPCP_HOURS): "}},
+		{name: "unknown policy", config: Config{Policy: PolicyConfig{Name: "oracle"}},
+			want: []string{`unknown policy "oracle"`}},
+		{name: "unknown policy parameter", config: Config{Policy: PolicyConfig{Name: "trend", Parameters: map[string]float64{"speed": 1}}},
+			want: []string{`policy.parameters: unknown parameter "speed" of policy trend`}},
+		{name: "safe mode", config: Config{Policy: PolicyConfig{SafeMode: "off"}},
+			want: []string{`unknown safe mode "off"`}},
+		{name: "day type", config: Config{Policy: PolicyConfig{DayTypes: map[string]DayTypeConfig{"someday": {}}}},
+			want: []string{`policy.day_types.someday: unknown day type "someday"`}},
+		{name: "apply", config: Config{Apply: ApplyConfig{Workers: -1, SysfsRoot: "sys", Targets: map[string]string{"normal": "max"}}},
+			want: []string{"apply.workers (EPCP_APPLY_WORKERS): must not be negative", "apply.sysfs_root (EPCP_SYSFS_ROOT): must be an absolute path", `unknown band "normal"`}},
+		{name: "floors", config: Config{Apply: ApplyConfig{Floors: map[string]int{"22:00-06:00": 1600000, "05:00-07:00": 0}}},
+			want: []string{"apply.floors: range 22:00-06:00 overlaps 05:00-07:00", "apply.floors: the floor of 05:00-07:00 must be positive kHz"}},
+		{name: "targets", config: Config{Apply: ApplyConfig{Targets: map[string]string{"cheap": "max", "expensive": "2400", "peak": "60%"}}},
+			want: []string{`apply.targets.expensive: invalid target "2400", expected min, max, a percentage or a frequency in kHz, MHz or GHz`,
+				`apply.targets: unknown band "peak", expected cheap or expensive`}},
+		{name: "decision metric", config: Config{Policy: PolicyConfig{Metric: "0.7*price_pctl + 0.3*carbon_pctl"}},
+			want: []string{`policy.metric (EPCP_DECISION_METRIC): unknown identifier "carbon_pctl", expected one of price, price_ewma, price_pctl at offset 21 of "0.7*price_pctl + 0.3*carbon_pctl"`}},
+		{name: "price display", config: Config{Outputs: OutputsConfig{PriceUnit: "CZK/kWh", Locale: "fr"}},
+			want: []string{"outputs.price_unit (EPCP_PRICE_UNIT): CZK/kWh needs the source.eur_czk exchange rate",
+				`outputs.locale (EPCP_LOCALE): unknown locale "fr", expected one of cs, de, en, sk`}},
+		{name: "sanity bounds", config: Config{Source: SourceConfig{PriceMin: &priceLow, PriceMax: &priceHigh, QuarantineFraction: &fraction}},
+			want: []string{"source.price_max (EPCP_PRICE_MAX): must be above source.price_min, got 100 and 500",
+				"source.quarantine_fraction (EPCP_QUARANTINE_FRACTION): must be between 0 and 1, got 1.5"}},
+		{name: "NUMA", config: Config{Apply: ApplyConfig{NUMA: map[string]NUMANodeConfig{"first": {}, "1": {Bands: map[string]int{"expensive": 0}}}}},
+			want: []string{`apply.numa.first: invalid NUMA node "first"`, "apply.numa.1.bands: the frequency of the expensive band must be positive kHz"}},
+		{name: "two frequency actuators", config: Config{Actuators: []ActuatorConfig{{Type: "sysfs"}, {Type: "simulation"}}},
+			want: []string{"actuators: only one frequency actuator"}},
+		{name: "a disabled frequency actuator", config: Config{Actuators: []ActuatorConfig{{Type: "sysfs", Disabled: true}, {Type: "simulation"}}}},
+		{name: "actuators", config: Config{Actuators: []ActuatorConfig{{Type: "helper"}, {Type: "redfish"}, {Type: "systemd", Units: []string{"batch"}}, {Type: "fan"}}},
+			want: []string{"actuators[0]: the helper needs a command or a socket", "actuators[1].url: the redfish actuator needs the URL",
+				`actuators[2].units: "batch" is not a slice, service or scope`, `actuators[3].type: unknown actuator "fan"`}},
+		{name: "durations", config: Config{Schedule: ScheduleConfig{Interval: "hourly", Jitter: "-"}, State: StateConfig{LockWait: "1 minute"}},
+			want: []string{`schedule.interval (EPCP_INTERVAL): invalid duration "hourly"`, `schedule.jitter (EPCP_JITTER): invalid duration "-"`, `state.lock_wait (EPCP_LOCK_WAIT): invalid duration "1 minute"`}},
+		{name: "offset past the interval", config: Config{Schedule: ScheduleConfig{Interval: "15m", EvalOffset: "20m"}},
+			want: []string{"must be below the interval and an hour, got 20m0s"}},
+		{name: "day-ahead watch", config: Config{Schedule: ScheduleConfig{DamStart: "16:00", DamDeadline: "1pm"}},
+			want: []string{`schedule.dam_watch_deadline (EPCP_DAM_WATCH_DEADLINE): invalid time of day "1pm"`, "schedule.dam_watch_deadline (EPCP_DAM_WATCH_DEADLINE): must be after the start of the watch"}},
+		{name: "scheduler commands", config: Config{Scheduler: SchedulerConfig{DrainCommand: "scontrol update state=drain"}},
+			want: []string{"the drain and the resume command must be set together"}},
+		{name: "battery", config: Config{Battery: BatteryConfig{URL: "nut://ups.example.org"}},
+			want: []string{`no UPS in "nut://ups.example.org"`}},
+		{name: "outputs", config: Config{Outputs: OutputsConfig{Report: ReportConfig{Period: "day", Dir: "/var/lib/epcp/reports"}}},
+			want: []string{`unknown period "day"`, "outputs.report.dir (EPCP_REPORT_DIR): needs outputs.decision_log"}},
+		{name: "channels", config: Config{Channels: []ChannelConfig{
+			{Name: "Gas", Source: SourceConfig{Type: "synthetic"}},
+			{Name: "electricity", Source: SourceConfig{Type: "ote"}},
+			{Name: "heat", Source: SourceConfig{Type: "file"}, Policy: PolicyConfig{Name: "trend", SafeMode: "max"}, Webhook: WebhookConfig{URL: "hooks.example.org"}},
+		}},
+			want: []string{`channels[0].name: invalid name "Gas"`, `channels[1].name: repeated or reserved name "electricity"`,
+				`channels[1].source.type: unknown source "ote", expected file or synthetic`, "channels[2].source.price_file: required by the file source",
+				"channels[2].policy: a channel takes only the name and the parameters of its policy", `channels[2].webhook.url: invalid URL "hooks.example.org"`}},
+		{name: "history", config: Config{State: StateConfig{HistoryDays: 5, HistoryHourlyDays: 6, HistoryDailyDays: 4}},
+			want: []string{"state.history_days (EPCP_HISTORY_DAYS): must be at least 7, the days the forecasts read, got 5",
+				"state.history_hourly_days (EPCP_HISTORY_HOURLY_DAYS): must be at least state.history_days, got 6",
+				"state.history_daily_days (EPCP_HISTORY_DAILY_DAYS): must be 0, to keep the daily statistics for ever, or at least state.history_hourly_days"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Validate()
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Errorf("got error %v, want none", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want one containing %q", test.want)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("got error %q, want one containing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPriceFileReadOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.csv")
+	prices := "time,price\n2024-03-04T00:00:00+01:00,61.5\n"
+	if err := os.WriteFile(path, []byte(prices), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{Source: SourceConfig{Type: "file", PriceFile: path}}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	// The prices served are those Validate checked
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	source, err := config.Source.priceSource()
+	if err != nil {
+		t.Fatalf("price source after Validate: %s", err)
+	}
+	points, err := source.ImPrices(context.Background(), "2024-03-04", 1, 1)
+	if err != nil || len(points) != 1 || points[0].Price != 61.5 {
+		t.Errorf("got %v, %v, want the price 61.5 of the file", points, err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, example := range []string{"epcp.yaml", "epcp.toml"} {
+		t.Run(example, func(t *testing.T) {
+			config, err := loadConfig(filepath.Join("..", "..", "examples", example))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := config.Validate(); err != nil {
+				t.Errorf("invalid example: %s", err)
+			}
+			// The dump of the configuration loads back into the same
+			for _, format := range []string{"yaml", "toml"} {
+				var dump bytes.Buffer
+				if format == "toml" {
+					err = toml.NewEncoder(&dump).Encode(config)
+				} else {
+					err = yaml.NewEncoder(&dump).Encode(config)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				path := filepath.Join(t.TempDir(), "epcp."+format)
+				if err := os.WriteFile(path, dump.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				loaded, err := loadConfig(path)
+				if err != nil {
+					t.Fatalf("loading the %s dump: %s\n%s", format, err, dump.String())
+				}
+				if !reflect.DeepEqual(loaded, config) {
+					t.Errorf("%s round trip:\n%+v\nwant\n%+v", format, loaded, config)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"epcp.yaml", "source:\n  tyep: ote\n", "field tyep not found"},
+		{"epcp.yaml", "polcy:\n  name: trend\n", "field polcy not found"},
+		{"epcp.toml", "[source]\ntyep = \"ote\"\n", "unknown keys [source.tyep]"},
+		{"epcp.json", "{}", `unknown configuration format ".json"`},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), test.name)
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s %q: got error %v, want one containing %q", test.name, test.content, err, test.want)
+		}
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	captureLogs(t)
+	path := filepath.Join(t.TempDir(), "epcp.yaml")
+	content := "source:\n  hours: 3\nschedule:\n  interval: 1h\n  jitter: 2m\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &configPath, path)
+	// The environment overrides the file, the legacy names included
+	t.Setenv("EPCP_INTERVAL", "15m")
+	t.Setenv("HOURS", "6")
+	config, err := effective()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Schedule.Interval != "15m" || config.Source.Hours != "6" || config.Schedule.Jitter != "2m" {
+		t.Errorf("interval %s, hours %s and jitter %s, want 15m and 6 from the environment and 2m from the file",
+			config.Schedule.Interval, config.Source.Hours, config.Schedule.Jitter)
+	}
+	t.Setenv("EPCP_INTERVAL", "hourly")
+	if _, err := effective(); err == nil || !strings.Contains(err.Error(), `schedule.interval (EPCP_INTERVAL): invalid duration "hourly"`) {
+		t.Errorf("invalid interval: got error %v", err)
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	captureLogs(t)
+	setGlobal(t, &configPath, filepath.Join("..", "..", "examples", "epcp.toml"))
+	t.Setenv("EPCP_JITTER", "5m")
+	run := func(args ...string) (int, string) {
+		out, err := os.CreateTemp(t.TempDir(), "stdout")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer out.Close()
+		stdout := os.Stdout
+		os.Stdout = out
+		code := runConfig(args)
+		os.Stdout = stdout
+		content, err := os.ReadFile(out.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code, string(content)
+	}
+
+	if code, out := run("validate"); code != 0 || !strings.HasSuffix(out, "epcp.toml: ok\n") {
+		t.Errorf("validate: exit code %d, %q", code, out)
+	}
+	// The dump is the effective configuration
+	code, out := run("dump", "--format", "yaml")
+	if code != 0 {
+		t.Fatalf("dump: exit code %d", code)
+	}
+	path := filepath.Join(t.TempDir(), "effective.yaml")
+	if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil || config.Schedule.Jitter != "5m" {
+		t.Errorf("dump loads as %+v, %v, want the jitter of the environment:\n%s", config, err, out)
+	}
+	if code, _ := run("dump", "--format", "json"); code != int(exitUsage) {
+		t.Errorf("dump as JSON: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestParseHistoryWindow(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		// err is part of the error, none if the value is valid
+		err string
+	}{
+		{value: "3", want: 3 * time.Hour},
+		{value: "-3", want: 3 * time.Hour},
+		{value: "3h", want: 3 * time.Hour},
+		{value: "-3h", want: 3 * time.Hour},
+		{value: "180m", want: 3 * time.Hour},
+		{value: "1", want: time.Hour},
+		{value: "168", want: 168 * time.Hour},
+		{value: "0", err: "0s is out of range, expected 1h to 168h"},
+		{value: "30m", err: "30m0s is out of range"},
+		{value: "169h", err: "169h0m0s is out of range"},
+		{value: "three", err: `invalid hours "three"`},
+		{value: "", err: `invalid hours ""`},
+	}
+	for _, test := range tests {
+		got, err := parseHistoryWindow(test.value)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseHistoryWindow(%q) = %s, %v, want an error containing %q", test.value, got, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseHistoryWindow(%q) = %s, %v, want %s", test.value, got, err, test.want)
+		}
+	}
+
+	// The window always reaches into the past
+	now := time.Date(2024, time.October, 1, 10, 30, 0, 0, time.UTC)
+	window, _ := parseHistoryWindow("3h")
+	if times := timeRange(now, window); !times.start.Equal(now.Add(-3*time.Hour)) || !times.end.Equal(now) {
+		t.Errorf("timeRange over 3h from %s to %s, want from %s", times.start, times.end, now.Add(-3*time.Hour))
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces the secrets in the configuration shown.
+const redacted = "REDACTED"
+
+// configView is the effective configuration in /status, with the defaults
+// filled in and the secrets redacted, see configure.
+var configView map[string]any
+
+// withDefaults returns the configuration with the defaults apply falls back
+// on filled in, for showing it.
+func (c Config) withDefaults() Config {
+	or := func(value *string, fallback string) {
+		if *value == "" {
+			*value = fallback
+		}
+	}
+	float := func(value **float64, fallback float64) {
+		if *value == nil {
+			*value = &fallback
+		}
+	}
+	if len(c.Source.Failover) == 0 {
+		or(&c.Source.Type, "ote")
+	} else {
+		c.Source.FailoverFailures = max(c.Source.FailoverFailures, 3)
+		or(&c.Source.FailoverProbe, "10m")
+	}
+	or(&c.Source.Hours, historyWindow.String())
+	or(&c.Source.StaleAction, staleSafe)
+	float(&c.Source.ProvisionalWeight, 1)
+	low, high := c.Source.priceBounds()
+	float(&c.Source.PriceMin, low)
+	float(&c.Source.PriceMax, high)
+	float(&c.Source.QuarantineFraction, 0.5)
+	or(&c.Source.RateLimit, "1s")
+	if c.Source.Peer.URL != "" {
+		or(&c.Source.Peer.MaxAge, "90m")
+	}
+	or(&c.Policy.Name, "trend")
+	or(&c.Policy.SafeMode, safeHold)
+	if !slices.ContainsFunc(c.Actuators, func(a ActuatorConfig) bool { return !extraActuators[a.Type] }) {
+		c.Actuators = append([]ActuatorConfig{{Type: "sysfs"}}, c.Actuators...)
+	}
+	or(&c.Apply.SysfsRoot, "/sys")
+	or(&c.Schedule.DamStart, "13:00")
+	or(&c.Schedule.DamDeadline, "16:00")
+	or(&c.Schedule.DamPoll, "5m")
+	if c.Schedule.Ramp != "" && c.Schedule.RampSteps == 0 {
+		c.Schedule.RampSteps = 5
+	}
+	if c.Scheduler.DrainCommand != "" {
+		or(&c.Scheduler.Timeout, "30s")
+	}
+	if c.Battery.URL != "" {
+		high, low := c.Battery.thresholds()
+		float(&c.Battery.High, high)
+		float(&c.Battery.Low, low)
+	}
+	or(&c.State.Dir, "/var/lib/epcp")
+	if c.State.HistoryDays == 0 {
+		c.State.HistoryDays = 8
+	}
+	if c.State.HistoryHourlyDays == 0 {
+		c.State.HistoryHourlyDays = 90
+	}
+	or(&c.Source.QuarantineFile, filepath.Join(c.State.Dir, "quarantine.jsonl"))
+	or(&c.Outputs.PriceUnit, "EUR/MWh")
+	or(&c.Outputs.Locale, "en")
+	c.Outputs.NotifyQueue = notifyQueueSize
+	if c.Outputs.Influx.File != "" || c.Outputs.Influx.URL != "" {
+		c.Outputs.Influx.Batch = max(c.Outputs.Influx.Batch, 1)
+	}
+	if c.Outputs.Webhook.URL != "" {
+		or(&c.Outputs.Webhook.Format, "slack")
+		or(&c.Outputs.Webhook.Period, "6h")
+	}
+	if c.Outputs.MQTT.URL != "" {
+		hostname, _ := os.Hostname()
+		or(&c.Outputs.MQTT.TopicPrefix, "epcp/"+hostname)
+	}
+	if c.Outputs.Report.Dir != "" {
+		or(&c.Outputs.Report.Period, "month")
+		or(&c.Outputs.Report.Format, "md")
+	}
+	or(&c.Outputs.Condor.Prefix, "Epcp")
+	c.Channels = slices.Clone(c.Channels)
+	for i := range c.Channels {
+		ch := &c.Channels[i]
+		or(&ch.Policy.Name, "trend")
+		if ch.Webhook.URL != "" {
+			or(&ch.Webhook.Format, "slack")
+			or(&ch.Webhook.Period, "6h")
+		}
+	}
+	return c
+}
+
+// redacted returns the configuration without its secrets: the keys, tokens
+// and passwords, the passwords and queries of the URLs, and the paths of the
+// webhook URLs, which carry their tokens.
+func (c Config) redacted() Config {
+	secret := func(value *string) {
+		if *value != "" {
+			*value = redacted
+		}
+	}
+	secret(&c.Source.Peer.Key)
+	secret(&c.Source.Peer.PreviousKey)
+	secret(&c.Outputs.Influx.Token)
+	secret(&c.Outputs.MQTT.Password)
+	secret(&c.Outputs.Sensor.Token)
+	for _, u := range []*string{&c.Source.WSDL, &c.Source.Peer.URL, &c.Battery.URL, &c.Outputs.OTLPEndpoint,
+		&c.Outputs.Influx.URL, &c.Outputs.MQTT.URL} {
+		*u = redactURL(*u, false)
+	}
+	c.Outputs.Webhook.URL = redactURL(c.Outputs.Webhook.URL, true)
+	c.Outputs.Webhook.StatusURL = redactURL(c.Outputs.Webhook.StatusURL, false)
+	c.Actuators = slices.Clone(c.Actuators)
+	for i := range c.Actuators {
+		secret(&c.Actuators[i].Password)
+		c.Actuators[i].URL = redactURL(c.Actuators[i].URL, false)
+	}
+	c.Channels = slices.Clone(c.Channels)
+	for i := range c.Channels {
+		c.Channels[i].Webhook.URL = redactURL(c.Channels[i].Webhook.URL, true)
+		c.Channels[i].Webhook.StatusURL = redactURL(c.Channels[i].Webhook.StatusURL, false)
+	}
+	return c
+}
+
+// redactURL redacts the password and the query values of the URL, and its
+// path with path.
+func redactURL(value string, path bool) string {
+	u, err := url.Parse(value)
+	if err != nil || value == "" {
+		return value
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query[key] = []string{redacted}
+		}
+		u.RawQuery = query.Encode()
+	}
+	if path && strings.Trim(u.Path, "/") != "" {
+		u.Path, u.RawPath = "/"+redacted, ""
+	}
+	return u.String()
+}
+
+// newConfigView returns the configuration as shown in /status: by the names
+// of the configuration file, with the defaults filled in and the secrets
+// redacted.
+func newConfigView(c *Config) map[string]any {
+	view := make(map[string]any)
+	data, err := yaml.Marshal(c.withDefaults().redacted())
+	if err == nil {
+		err = yaml.Unmarshal(data, &view)
+	}
+	if err != nil {
+		errorLogger.Printf("Error encoding the configuration: %s\n", err.Error())
+	}
+	return view
+}
+
+// configBanner summarizes the configuration in a line, logged at startup.
+func configBanner(c *Config) string {
+	d := c.withDefaults()
+	source := d.Source.Type
+	if len(d.Source.Failover) != 0 {
+		source = "failover " + strings.Join(d.Source.Failover, ",")
+	}
+	fields := []string{
+		"source " + source + " over " + historyWindow.String(),
+		"policy " + d.Policy.Name + formatParameters(d.Policy.Parameters),
+	}
+	if d.Policy.Metric != "" {
+		fields = append(fields, "metric "+d.Policy.Metric)
+	}
+	fields = append(fields, "safe mode "+d.Policy.SafeMode)
+	if maxStaleness > 0 {
+		fields = append(fields, "max staleness "+maxStaleness.String())
+	}
+	if w := d.Outputs.Webhook; w.PriceHigh != nil || w.PriceLow != nil {
+		fields = append(fields, "alerts"+formatThreshold("above", w.PriceHigh)+formatThreshold("below", w.PriceLow))
+	}
+	if d.Battery.URL != "" {
+		fields = append(fields, fmt.Sprintf("battery %g-%g %%", *d.Battery.Low, *d.Battery.High))
+	}
+	var actuators []string
+	for _, a := range d.Actuators {
+		if !a.Disabled {
+			actuators = append(actuators, a.Type)
+		}
+	}
+	fields = append(fields, "actuators "+strings.Join(actuators, ","))
+	cpus := "all CPUs"
+	if len(d.Apply.NUMA) != 0 {
+		cpus = "NUMA nodes " + strings.Join(sortedKeys(d.Apply.NUMA), ",")
+	}
+	fields = append(fields, cpus)
+	for _, ch := range d.Channels {
+		fields = append(fields, "channel "+ch.Name+" on "+ch.Source.Type+" with policy "+ch.Policy.Name+formatParameters(ch.Policy.Parameters))
+	}
+	schedule := "one-shot"
+	if cycleInterval > 0 {
+		schedule = "every " + cycleInterval.String()
+		if evalOffset > 0 {
+			schedule += " at +" + evalOffset.String()
+		}
+	}
+	if len(d.Schedule.Maintenance) != 0 {
+		schedule += ", maintenance " + strings.Join(d.Schedule.Maintenance, ",")
+	}
+	return strings.Join(append(fields, schedule), "; ")
+}
+
+func formatParameters(parameters map[string]float64) string {
+	if len(parameters) == 0 {
+		return ""
+	}
+	var pairs []string
+	for _, name := range sortedKeys(parameters) {
+		pairs = append(pairs, fmt.Sprintf("%s=%g", name, parameters[name]))
+	}
+	return " (" + strings.Join(pairs, ", ") + ")"
+}
+
+func formatThreshold(name string, price *float64) string {
+	if price == nil {
+		return ""
+	}
+	return " " + name + " " + display.price(*price)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// containerTimeout bounds the requests of a cycle to the Docker daemon.
+const containerTimeout = 10 * time.Second
+
+// containerLimits scales the CPU limits of the labelled Docker containers per
+// band, see ActuatorConfig; it is nil without a docker actuator.
+var containerLimits *containerTuner
+
+type containerTuner struct {
+	docker *actuator.Docker
+	label  string
+	// factors maps the bands to the factor of the original limits, none for
+	// the bands running the containers unchanged
+	factors map[string]float64
+	// simulated is the factor of a dry run or a simulation, see wouldScale
+	simulated float64
+}
+
+func newContainerTuner(a ActuatorConfig) *containerTuner {
+	t := &containerTuner{docker: &actuator.Docker{Socket: a.Socket, Wrap: wrapRunID}, label: a.Label, factors: a.Shares}
+	if t.docker.Socket == "" {
+		t.docker.Socket = "/var/run/docker.sock"
+	}
+	if t.label == "" {
+		t.label = "epcp.throttle=true"
+	}
+	return t
+}
+
+// applyContainerLimits scales the limits of the labelled containers for the
+// decided band, or restores them when the band has no factor. The containers
+// are listed every cycle, so that new ones are picked up. A failing
+// container does not keep the others from being tuned. It reports whether it
+// set any limits.
+func applyContainerLimits(ctx context.Context, result *cycleResult) (bool, error) {
+	if containerLimits == nil || paused.Load() || result.Decision.suspended() {
+		return false, nil
+	}
+	factor, scaled := containerLimits.factors[result.Decision.Band]
+	if dryRun || simulate {
+		if !wouldScale(&containerLimits.simulated, factor, scaled) {
+			return false, nil
+		}
+		if scaled {
+			infoLog(ctx).Printf("Would scale the CPU limits of the containers labelled %s by %g\n", containerLimits.label, factor)
+		} else {
+			infoLog(ctx).Printf("Would restore the CPU limits of the containers labelled %s\n", containerLimits.label)
+		}
+		return true, nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), containerTimeout)
+	defer cancel()
+	ids, err := containerLimits.docker.Containers(ctx, containerLimits.label)
+	if err != nil {
+		errorLog(ctx).Printf("Error listing the containers labelled %s: %s\n", containerLimits.label, err.Error())
+		return false, err
+	}
+	containerLimits.forget(ids)
+	failed, written := 0, false
+	for _, id := range ids {
+		var set bool
+		if scaled {
+			set, err = containerLimits.scale(ctx, id, factor)
+		} else {
+			set, err = containerLimits.restore(ctx, id)
+		}
+		if err != nil {
+			failed++
+		}
+		written = written || set
+	}
+	if failed != 0 {
+		return written, fmt.Errorf("%d of %d containers failed", failed, len(ids))
+	}
+	return written, nil
+}
+
+// restoreContainerLimits writes back the original limits of the containers,
+// on exit.
+func restoreContainerLimits() {
+	if containerLimits == nil || dryRun || simulate {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), containerTimeout)
+	defer cancel()
+	for id := range state.OriginalLimits {
+		containerLimits.restore(ctx, id)
+	}
+}
+
+// forget drops the records of the containers that are gone.
+func (t *containerTuner) forget(running []string) {
+	present := make(map[string]bool, len(running))
+	for _, id := range running {
+		present[id] = true
+	}
+	for id := range state.OriginalLimits {
+		if !present[id] {
+			delete(state.OriginalLimits, id)
+		}
+	}
+}
+
+// scale sets the limits of the container to its original limits scaled by
+// factor, recording them first. The limits the container has are read every
+// time, so that limits set already, e.g. by an earlier run, are not set
+// again. It reports whether it set them.
+func (t *containerTuner) scale(ctx context.Context, id string, factor float64) (bool, error) {
+	current, err := t.limits(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	original, ok := state.OriginalLimits[id]
+	if !ok {
+		original = current
+		if state.OriginalLimits == nil {
+			state.OriginalLimits = make(map[string]actuator.ContainerLimits)
+		}
+		state.OriginalLimits[id] = original
+	}
+	limits := original.Scaled(factor, len(hostCPUs()))
+	if current.CPUs() == limits.CPUs() {
+		return false, nil
+	}
+	if err := t.docker.Update(ctx, id, limits); err != nil {
+		errorLog(ctx).Printf("Error limiting the CPUs of container %s: %s\n", shortID(id), err.Error())
+		return false, err
+	}
+	infoLog(ctx).Printf("Scaled the CPU limits of container %s by %g\n", shortID(id), factor)
+	return true, nil
+}
+
+// restore sets the limits of the container back to the recorded original,
+// unless it has them already, reporting whether it set them.
+func (t *containerTuner) restore(ctx context.Context, id string) (bool, error) {
+	original, ok := state.OriginalLimits[id]
+	if !ok {
+		return false, nil
+	}
+	current, err := t.limits(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	changed := current.CPUs() != original.CPUs()
+	if changed {
+		if err := t.docker.Update(ctx, id, original.Restoring()); err != nil {
+			errorLogger.Printf("Error restoring the CPU limits of container %s: %s\n", shortID(id), err.Error())
+			return false, err
+		}
+		infoLogger.Printf("Restored the CPU limits of container %s\n", shortID(id))
+	}
+	delete(state.OriginalLimits, id)
+	return changed, nil
+}
+
+// limits returns the limits the container has.
+func (t *containerTuner) limits(ctx context.Context, id string) (actuator.ContainerLimits, error) {
+	limits, err := t.docker.Limits(ctx, id)
+	if err != nil {
+		errorLog(ctx).Printf("Error reading the CPU limits of container %s: %s\n", shortID(id), err.Error())
+	}
+	return limits, err
+}
+
+// shortID abbreviates the container ID like the docker command does.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,218 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// dockerAPI is a fake Docker API on a unix socket serving the running
+// containers with their limits, recording and applying the updates.
+type dockerAPI struct {
+	socket string
+	mu     sync.Mutex
+	// containers maps the IDs of the labelled containers to their limits
+	containers map[string]actuator.ContainerLimits
+	// failing is a container refusing the updates
+	failing string
+	updates []string
+	// runIDs are the X-EPCP-Run-ID headers of the requests
+	runIDs []string
+}
+
+func newDockerAPI(t *testing.T) *dockerAPI {
+	t.Helper()
+	// The path of a unix socket is short, so not under the test directory
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	d := &dockerAPI{socket: filepath.Join(dir, "docker.sock"), containers: make(map[string]actuator.ContainerLimits)}
+	listener, err := net.Listen("unix", d.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.runIDs = append(d.runIDs, r.Header.Get("X-EPCP-Run-ID"))
+		path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/containers/json":
+			if filters := r.URL.Query().Get("filters"); filters != `{"label":["epcp.throttle=true"]}` {
+				t.Errorf("listed with filters %q", filters)
+			}
+			var list []map[string]string
+			for id := range d.containers {
+				list = append(list, map[string]string{"Id": id})
+			}
+			json.NewEncoder(w).Encode(list)
+		case len(path) == 3 && r.Method == http.MethodGet && path[2] == "json":
+			json.NewEncoder(w).Encode(map[string]any{"HostConfig": d.containers[path[1]]})
+		case len(path) == 3 && r.Method == http.MethodPost && path[2] == "update":
+			var update map[string]any
+			json.NewDecoder(r.Body).Decode(&update)
+			if path[1] == d.failing {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"message":"cannot update a stopped container"}`))
+				return
+			}
+			data, _ := json.Marshal(update)
+			d.updates = append(d.updates, path[1]+" "+string(data))
+			var limits actuator.ContainerLimits
+			json.Unmarshal(data, &limits)
+			if limits.CPUQuota < 0 {
+				// The quota removed
+				limits = actuator.ContainerLimits{}
+			}
+			d.containers[path[1]] = limits
+			w.Write([]byte(`{"Warnings":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return d
+}
+
+// updated returns the updates since the last call, sorted.
+func (d *dockerAPI) updated() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	updates := d.updates
+	d.updates = nil
+	slices.Sort(updates)
+	return updates
+}
+
+// start adds a running container with the label.
+func (d *dockerAPI) start(id string, limits actuator.ContainerLimits) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.containers[id] = limits
+}
+
+// stop removes the container.
+func (d *dockerAPI) stop(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.containers, id)
+}
+
+func TestContainerLimits(t *testing.T) {
+	captureLogs(t)
+	simulatedSysfs(t, 4)
+	api := newDockerAPI(t)
+	setGlobal(t, &containerLimits, newContainerTuner(ActuatorConfig{Type: "docker", Socket: api.socket, Shares: map[string]float64{policy.Expensive: 0.5}}))
+	setGlobal(t, &state, new(State))
+	setGlobal(t, &dryRun, false)
+	setGlobal(t, &simulate, false)
+	cycle := func(band string) error {
+		_, err := applyContainerLimits(context.Background(), &cycleResult{Decision: &Decision{Time: time.Now(), Band: band}})
+		return err
+	}
+	check := func(step string, want ...string) {
+		t.Helper()
+		if got := api.updated(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: updates %q, want %q", step, got, want)
+		}
+	}
+
+	api.start("batch1", actuator.ContainerLimits{NanoCPUs: 2e9})
+	api.start("batch2", actuator.ContainerLimits{})
+	if err := cycle(policy.Expensive); err != nil {
+		t.Fatal(err)
+	}
+	check("expensive", `batch1 {"NanoCpus":1000000000}`, `batch2 {"CpuPeriod":100000,"CpuQuota":200000}`)
+	cycle(policy.Expensive)
+	check("expensive again")
+	// The limits set are read back, also by the tuner of another run
+	setGlobal(t, &containerLimits, newContainerTuner(ActuatorConfig{Type: "docker", Socket: api.socket, Shares: map[string]float64{policy.Expensive: 0.5}}))
+	cycle(policy.Expensive)
+	check("expensive in another run")
+
+	// A new container is picked up, and a failing one does not keep the
+	// others from being limited
+	api.start("batch3", actuator.ContainerLimits{CPUQuota: 50000, CPUPeriod: 50000})
+	api.start("stopped", actuator.ContainerLimits{NanoCPUs: 1e9})
+	api.mu.Lock()
+	api.failing = "stopped"
+	api.mu.Unlock()
+	if err := cycle(policy.Expensive); err == nil || err.Error() != "1 of 4 containers failed" {
+		t.Errorf("new containers: got error %v, want the stopped one failing", err)
+	}
+	check("new containers", `batch3 {"CpuPeriod":50000,"CpuQuota":25000}`)
+
+	// The limits are restored when the prices recover
+	api.stop("stopped")
+	if err := cycle(policy.Cheap); err != nil {
+		t.Fatal(err)
+	}
+	check("cheap", `batch1 {"NanoCpus":2000000000}`, `batch2 {"CpuPeriod":100000,"CpuQuota":-1}`, `batch3 {"CpuPeriod":50000,"CpuQuota":50000}`)
+	if len(state.OriginalLimits) != 0 {
+		t.Errorf("originals %v after restoring, want none", state.OriginalLimits)
+	}
+
+	// and on exit
+	cycle(policy.Expensive)
+	api.updated()
+	restoreContainerLimits()
+	check("exit", `batch1 {"NanoCpus":2000000000}`, `batch2 {"CpuPeriod":100000,"CpuQuota":-1}`, `batch3 {"CpuPeriod":50000,"CpuQuota":50000}`)
+}
+
+func TestContainerRunID(t *testing.T) {
+	captureLogs(t)
+	simulatedSysfs(t, 4)
+	api := newDockerAPI(t)
+	setGlobal(t, &containerLimits, newContainerTuner(ActuatorConfig{Type: "docker", Socket: api.socket, Shares: map[string]float64{policy.Expensive: 0.5}}))
+	setGlobal(t, &state, new(State))
+	setGlobal(t, &dryRun, false)
+	setGlobal(t, &simulate, false)
+	api.start("batch1", actuator.ContainerLimits{NanoCPUs: 2e9})
+	ctx := withRunID(context.Background(), "01J9")
+	if _, err := applyContainerLimits(ctx, &cycleResult{Decision: &Decision{Time: time.Now(), Band: policy.Expensive}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.runIDs) == 0 || slices.ContainsFunc(api.runIDs, func(runID string) bool { return runID != "01J9" }) {
+		t.Errorf("requests to Docker sent the run IDs %q, want 01J9", api.runIDs)
+	}
+}
+
+func TestContainerLimitsDryRun(t *testing.T) {
+	captureLogs(t)
+	simulatedSysfs(t, 4)
+	api := newDockerAPI(t)
+	setGlobal(t, &containerLimits, newContainerTuner(ActuatorConfig{Type: "docker", Socket: api.socket, Shares: map[string]float64{policy.Expensive: 0.5}}))
+	setGlobal(t, &state, new(State))
+	setGlobal(t, &dryRun, true)
+	api.start("batch1", actuator.ContainerLimits{NanoCPUs: 2e9})
+	for i, test := range []struct {
+		band    string
+		applied bool
+	}{{policy.Cheap, false}, {policy.Expensive, true}, {policy.Expensive, false}, {policy.Cheap, true}} {
+		applied, err := applyContainerLimits(context.Background(), &cycleResult{Decision: &Decision{Time: time.Now(), Band: test.band}})
+		if applied != test.applied || err != nil {
+			t.Errorf("cycle %d, %s: applied %t, %v, want %t", i, test.band, applied, err, test.applied)
+		}
+	}
+	if len(api.runIDs) != 0 {
+		t.Errorf("%d requests to Docker in a dry run", len(api.runIDs))
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// paused stops decisions from being applied while set.
+var paused atomic.Bool
+
+// controlCommand is a command that the daemon loop has to execute itself.
+type controlCommand struct {
+	name string
+	done chan struct{}
+}
+
+// controlCommands is consumed by the daemon loop.
+var controlCommands = make(chan controlCommand)
+
+type controlResponse struct {
+	Status *statusResponse `json:"status,omitempty"`
+	Result string          `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// controlSocketPath returns the control socket, in the state directory by default.
+func controlSocketPath() string {
+	if controlSocket != "" {
+		return controlSocket
+	}
+	return filepath.Join(stateDir, "control.sock")
+}
+
+// serveControl accepts operator commands on the unix control socket.
+func serveControl(path string, done <-chan struct{}) {
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		errorLogger.Printf("Error listening on control socket: %s\n", err.Error())
+		return
+	}
+	go func() {
+		<-done
+		listener.Close()
+	}()
+	if err := os.Chmod(path, 0660); err != nil {
+		errorLogger.Printf("Error setting control socket permissions: %s\n", err.Error())
+		listener.Close()
+		return
+	}
+	infoLogger.Printf("Listening for commands on %s\n", path)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(time.Minute))
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil && err != io.EOF {
+				return
+			}
+			json.NewEncoder(conn).Encode(handleControl(strings.TrimSpace(line), done))
+		}()
+	}
+}
+
+func handleControl(command string, done <-chan struct{}) controlResponse {
+	switch command {
+	case "status":
+		s := status.snapshot()
+		return controlResponse{Status: &s}
+	case "pause":
+		paused.Store(true)
+		infoLogger.Println("Paused applying decisions")
+		return controlResponse{Result: "paused"}
+	case "resume":
+		paused.Store(false)
+		infoLogger.Println("Resumed applying decisions")
+		return controlResponse{Result: "resumed"}
+	case "run-now", "restore":
+		cmd := controlCommand{name: command, done: make(chan struct{})}
+		select {
+		case controlCommands <- cmd:
+		case <-done:
+			return controlResponse{Error: "shutting down"}
+		}
+		<-cmd.done
+		if command == "restore" {
+			return controlResponse{Result: "restored, paused"}
+		}
+		return controlResponse{Result: "cycle finished"}
+	}
+	return controlResponse{Error: fmt.Sprintf("unknown command %q", command)}
+}
+
+// runControlCommand executes a command that needs the daemon loop.
+func runControlCommand(cmd controlCommand, run func()) {
+	defer close(cmd.done)
+	switch cmd.name {
+	case "run-now":
+		infoLogger.Println("Running a cycle on request")
+		run()
+	case "restore":
+		paused.Store(true)
+		restoreActuators()
+		infoLogger.Println("Restored what the actuators set, paused applying decisions")
+	}
+}
+
+// runCtl sends a command to the control socket of a running daemon.
+func runCtl(args []string) int {
+	flags := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	socket := flags.String("socket", "", "control socket of the daemon")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: epcp ctl [--socket path] status|pause|resume|run-now|restore")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	path := *socket
+	if path == "" {
+		path = controlSocketPath()
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		errorLogger.Printf("Error connecting to %s: %s\n", path, err.Error())
+		return 1
+	}
+	defer conn.Close()
+	fmt.Fprintln(conn, flags.Arg(0))
+	res := controlResponse{}
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		errorLogger.Printf("Error reading response: %s\n", err.Error())
+		return 1
+	}
+	if res.Error != "" {
+		fmt.Fprintln(os.Stderr, res.Error)
+		return 1
+	}
+	if res.Status != nil {
+		out, _ := json.MarshalIndent(res.Status, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	fmt.Println(res.Result)
+	return 0
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// ctl runs epcp ctl with the arguments, returning its exit code and output.
+func ctl(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = out, out
+	code := runCtl(args)
+	os.Stdout, os.Stderr = stdout, stderr
+	content, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(content)
+}
+
+func TestControlSocket(t *testing.T) {
+	tree := runOnMocks(t, trend(time.Now(), 10))
+	captureLogs(t)
+	setGlobal(t, &status, &cycleStatus{started: time.Now(), frequencies: make(map[int]int)})
+	setGlobal(t, &jitter, 0)
+	setGlobal(t, &evalOffset, 0)
+	t.Cleanup(func() { paused.Store(false) })
+	socket := filepath.Join(t.TempDir(), "control.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cycles := make(chan *cycleResult, 10)
+	stopped := make(chan struct{})
+	go serveControl(socket, ctx.Done())
+	go func() {
+		defer close(stopped)
+		runLoop(ctx, time.Hour, nil, func(result *cycleResult) { cycles <- result })
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	select {
+	case <-cycles:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no cycle run")
+	}
+	// The socket is listening once its permissions are set
+	var info os.FileInfo
+	var err error
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		info, err = os.Stat(socket)
+		if err == nil && info.Mode().Perm() == 0660 || time.Now().After(deadline) {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0660 {
+		t.Errorf("control socket permissions %o, want 660", perm)
+	}
+
+	code, out := ctl(t, "--socket", socket, "status")
+	var s statusResponse
+	if err := json.Unmarshal([]byte(out), &s); code != 0 || err != nil || s.Decision == nil || s.Frequencies[0] != 800000 {
+		t.Errorf("status: exit code %d, %v:\n%s", code, err, out)
+	}
+
+	if code, out := ctl(t, "--socket", socket, "pause"); code != 0 || out != "paused\n" || !paused.Load() {
+		t.Errorf("pause: exit code %d, %q, paused %t", code, out, paused.Load())
+	}
+	// A cycle run while paused decides without applying
+	writes := len(tree.Writes())
+	if code, out := ctl(t, "--socket", socket, "run-now"); code != 0 || out != "cycle finished\n" {
+		t.Errorf("run-now: exit code %d, %q", code, out)
+	}
+	if result := <-cycles; result.Decision == nil {
+		t.Error("run-now: no decision")
+	}
+	if n := len(tree.Writes()); n != writes {
+		t.Errorf("run-now while paused: %d writes", n-writes)
+	}
+	if code, out := ctl(t, "--socket", socket, "resume"); code != 0 || out != "resumed\n" || paused.Load() {
+		t.Errorf("resume: exit code %d, %q, paused %t", code, out, paused.Load())
+	}
+
+	if code, out := ctl(t, "--socket", socket, "restore"); code != 0 || out != "restored, paused\n" || !paused.Load() {
+		t.Errorf("restore: exit code %d, %q, paused %t", code, out, paused.Load())
+	}
+	for cpu := 0; cpu < 2; cpu++ {
+		if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != "3200000" {
+			t.Errorf("cpu%d: scaling_max_freq %s after restore, want the original 3200000", cpu, got)
+		}
+	}
+
+	if code, out := ctl(t, "--socket", socket, "reboot"); code != 1 || !strings.Contains(out, `unknown command "reboot"`) {
+		t.Errorf("reboot: exit code %d, %q", code, out)
+	}
+	if code, _ := ctl(t, "--socket", filepath.Join(t.TempDir(), "missing.sock"), "status"); code != 1 {
+		t.Errorf("missing socket: exit code %d, want 1", code)
+	}
+}
+
+func TestControlRestore(t *testing.T) {
+	tree := runOnMocks(t, trend(time.Now(), 10))
+	captureLogs(t)
+	bmc, patched, _ := powerLimitBMC(t)
+	config := ActuatorConfig{Type: "redfish", URL: bmc.URL + "/redfish/v1/Chassis/1", Username: "root", Password: "calvin",
+		Caps: map[string]int{policy.Expensive: 400}}
+	setGlobal(t, &powerCap, newPowerCap(config))
+	setGlobal(t, &dryRun, false)
+	setGlobal(t, &simulate, false)
+	t.Cleanup(func() { paused.Store(false) })
+	if _, err := applyPowerCap(context.Background(), &cycleResult{Decision: &Decision{Time: time.Now(), Band: policy.Expensive}}); err != nil {
+		t.Fatal(err)
+	}
+	runCycle(context.Background())
+	patched()
+
+	// Like a shutdown, restore undoes what every actuator set
+	runControlCommand(controlCommand{name: "restore", done: make(chan struct{})}, nil)
+	if got := readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")); got != "3200000" {
+		t.Errorf("scaling_max_freq %s after restore, want the original 3200000", got)
+	}
+	if got := patched(); len(got) != 1 || got[0] != `{"ControlMode":"Disabled"}` {
+		t.Errorf("PATCH bodies %q after restore, want the power limit removed", got)
+	}
+	if !paused.Load() {
+		t.Error("not paused after restore")
+	}
+}
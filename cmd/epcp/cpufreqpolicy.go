@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+var (
+	// cpufreqPolicies maps the cpufreq policy directories to the CPUs their
+	// affected_cpus lists, read once
+	cpufreqPolicies     map[string][]int
+	cpufreqPoliciesOnce sync.Once
+)
+
+// readCPUFreqPolicies returns the cpufreq policies shared by the CPUs, empty
+// where the kernel does not expose the policy directories.
+func readCPUFreqPolicies() map[string][]int {
+	cpufreqPoliciesOnce.Do(func() {
+		cpufreqPolicies = make(map[string][]int)
+		paths, err := sysfs.Glob(sysfsPath("devices", "system", "cpu", "cpufreq", "policy*", "affected_cpus"))
+		if err != nil {
+			errorLogger.Printf("Error listing the cpufreq policies: %s\n", err.Error())
+			return
+		}
+		for _, path := range paths {
+			content, err := actuator.ReadFile(sysfs, path)
+			if err != nil {
+				errorLogger.Printf("Error reading the CPUs of %s: %s\n", filepath.Dir(path), err.Error())
+				continue
+			}
+			var cpus []int
+			for _, field := range strings.Fields(content) {
+				if cpu, err := strconv.Atoi(field); err == nil {
+					cpus = append(cpus, cpu)
+				}
+			}
+			cpufreqPolicies[filepath.Dir(path)] = cpus
+		}
+	})
+	return cpufreqPolicies
+}
+
+// frequencyWrite sets the frequency of CPUs with a single write, to their
+// shared cpufreq policy or to a single CPU.
+type frequencyWrite struct {
+	cpus  []int
+	write actuator.Write
+}
+
+// frequencyWrites returns the writes setting the CPUs to their targets: one
+// per cpufreq policy whose CPUs among them share a target, one per CPU for
+// the others and where the kernel exposes no policies.
+func frequencyWrites(cpus []int, targets map[int]int) []frequencyWrite {
+	var writes []frequencyWrite
+	grouped := make(map[int]bool)
+	policies := readCPUFreqPolicies()
+	for _, dir := range sortedKeys(policies) {
+		var members []int
+		for _, cpu := range policies[dir] {
+			if _, ok := targets[cpu]; ok {
+				members = append(members, cpu)
+			}
+		}
+		if len(members) == 0 || slices.ContainsFunc(members, func(cpu int) bool { return targets[cpu] != targets[members[0]] }) {
+			continue
+		}
+		for _, cpu := range members {
+			grouped[cpu] = true
+		}
+		writes = append(writes, frequencyWrite{cpus: members,
+			write: actuator.Write{Path: filepath.Join(dir, "scaling_max_freq"), Value: strconv.Itoa(targets[members[0]])}})
+	}
+	for _, cpu := range cpus {
+		if !grouped[cpu] {
+			writes = append(writes, frequencyWrite{cpus: []int{cpu},
+				write: actuator.Write{Path: cpuPath(cpu, "cpufreq", "scaling_max_freq"), Value: strconv.Itoa(targets[cpu])}})
+		}
+	}
+	return writes
+}
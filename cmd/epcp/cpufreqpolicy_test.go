@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// policyFiles adds to files the cpufreq policies of the CPUs, each sharing
+// the policy of its first CPU.
+func policyFiles(files map[string]string, policies ...[]int) map[string]string {
+	for _, cpus := range policies {
+		dir := fmt.Sprintf("/sys/devices/system/cpu/cpufreq/policy%d", cpus[0])
+		affected := ""
+		for _, cpu := range cpus {
+			affected += fmt.Sprintf("%d ", cpu)
+		}
+		files[dir+"/affected_cpus"] = affected + "\n"
+		files[dir+"/scaling_max_freq"] = "3200000\n"
+	}
+	return files
+}
+
+func TestFrequencyWrites(t *testing.T) {
+	const policy0, policy2 = "/sys/devices/system/cpu/cpufreq/policy0/scaling_max_freq", "/sys/devices/system/cpu/cpufreq/policy2/scaling_max_freq"
+	tests := []struct {
+		name     string
+		policies [][]int
+		targets  map[int]int
+		// want maps the paths written to the CPUs they set
+		want map[string][]int
+	}{
+		{
+			name:    "no policies",
+			targets: map[int]int{0: 800000, 1: 800000, 2: 800000, 3: 800000},
+			want: map[string][]int{cpuPath(0, "cpufreq", "scaling_max_freq"): {0}, cpuPath(1, "cpufreq", "scaling_max_freq"): {1},
+				cpuPath(2, "cpufreq", "scaling_max_freq"): {2}, cpuPath(3, "cpufreq", "scaling_max_freq"): {3}},
+		},
+		{
+			name:     "shared",
+			policies: [][]int{{0, 1}, {2, 3}},
+			targets:  map[int]int{0: 800000, 1: 800000, 2: 1600000, 3: 1600000},
+			want:     map[string][]int{policy0: {0, 1}, policy2: {2, 3}},
+		},
+		{
+			// A policy whose CPUs have different targets is written per CPU
+			name:     "split",
+			policies: [][]int{{0, 1}, {2, 3}},
+			targets:  map[int]int{0: 800000, 1: 800000, 2: 1600000, 3: 2400000},
+			want: map[string][]int{policy0: {0, 1},
+				cpuPath(2, "cpufreq", "scaling_max_freq"): {2}, cpuPath(3, "cpufreq", "scaling_max_freq"): {3}},
+		},
+		{
+			name:     "per-CPU policies",
+			policies: [][]int{{0}, {1}},
+			targets:  map[int]int{0: 800000, 1: 800000},
+			want: map[string][]int{policy0: {0},
+				"/sys/devices/system/cpu/cpufreq/policy1/scaling_max_freq": {1}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useSysfs(t, actuator.NewMemFS(policyFiles(sysfsFiles(4), test.policies...)))
+			var cpus []int
+			for cpu := range test.targets {
+				cpus = append(cpus, cpu)
+			}
+			slices.Sort(cpus)
+			writes := frequencyWrites(cpus, test.targets)
+			if len(writes) != len(test.want) {
+				t.Errorf("got %d writes, want %d", len(writes), len(test.want))
+			}
+			for _, w := range writes {
+				if want, ok := test.want[w.write.Path]; !ok || !slices.Equal(w.cpus, want) {
+					t.Errorf("write to %s sets CPUs %v, want %v", w.write.Path, w.cpus, want)
+				}
+				if w.write.Value != fmt.Sprint(test.targets[w.cpus[0]]) {
+					t.Errorf("write to %s of %s, want %d", w.write.Path, w.write.Value, test.targets[w.cpus[0]])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyDecisionPolicies(t *testing.T) {
+	tree := actuator.NewMemFS(policyFiles(sysfsFiles(4), []int{0, 1}, []int{2, 3}))
+	useSysfs(t, tree)
+	decision := applyDecision(context.Background(), &Decision{Band: policy.Expensive, Frequency: 800000})
+	var paths []string
+	for _, w := range tree.Writes() {
+		paths = append(paths, w.Path)
+	}
+	slices.Sort(paths)
+	if want := []string{"/sys/devices/system/cpu/cpufreq/policy0/scaling_max_freq", "/sys/devices/system/cpu/cpufreq/policy2/scaling_max_freq"}; !slices.Equal(paths, want) {
+		t.Errorf("written %v, want %v", paths, want)
+	}
+	// Each CPU is accounted once, through its policy
+	if want := []int{0, 1, 2, 3}; !slices.Equal(decision.Summary.Succeeded, want) {
+		t.Errorf("succeeded %v, want %v", decision.Summary.Succeeded, want)
+	}
+
+	// The policies already at the frequency are not written again
+	decision = applyDecision(context.Background(), &Decision{Band: policy.Expensive, Frequency: 800000})
+	if writes := len(tree.Writes()); writes != 2 {
+		t.Errorf("%d writes after applying the same decision, want 2", writes)
+	}
+	if want := []int{0, 1, 2, 3}; !slices.Equal(decision.Summary.Unchanged, want) {
+		t.Errorf("unchanged %v, want %v", decision.Summary.Unchanged, want)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// cpuState is the cpufreq state of a CPU as read from sysfs. The frequencies
+// are in kHz, 0 and the strings empty where sysfs does not show them.
+type cpuState struct {
+	CPU      int    `json:"cpu"`
+	Online   bool   `json:"online"`
+	Managed  bool   `json:"managed"`
+	Driver   string `json:"driver,omitempty"`
+	Governor string `json:"governor,omitempty"`
+	InfoMin  int    `json:"cpuinfoMinKhz,omitempty"`
+	InfoMax  int    `json:"cpuinfoMaxKhz,omitempty"`
+	Min      int    `json:"scalingMinKhz,omitempty"`
+	Max      int    `json:"scalingMaxKhz,omitempty"`
+	Current  int    `json:"currentKhz,omitempty"`
+	// EPP is the energy performance preference of drivers like intel_pstate
+	// and amd-pstate
+	EPP string `json:"epp,omitempty"`
+}
+
+func cpusFlags(flags *flag.FlagSet) {
+	envVar(flags, "sysfs-root", "EPCP_SYSFS_ROOT", "string", "`directory` where sysfs is mounted (default /sys)")
+	flags.String("format", "table", "format of the output, table or json")
+}
+
+func runCPUs(flags *flag.FlagSet) exitCode {
+	format := flags.Lookup("format").Value.String()
+	if format != "table" && format != "json" {
+		errorLogger.Printf("Unknown format %q, expected table or json.\n", format)
+		return exitUsage
+	}
+	states, err := readCPUStates()
+	if err != nil {
+		errorLogger.Printf("Error listing the CPUs: %s\n", err.Error())
+		return exitFailure
+	}
+	if err := printCPUStates(os.Stdout, states, format == "json"); err != nil {
+		errorLogger.Printf("Error writing the CPUs: %s\n", err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
+
+// readCPUStates reads the state of the CPUs visible in sysfs, in order.
+func readCPUStates() ([]cpuState, error) {
+	paths, err := sysfs.Glob(sysfsPath("devices", "system", "cpu", "cpu[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	managed := hostCPUs()
+	var states []cpuState
+	for _, path := range paths {
+		cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "cpu"))
+		if err != nil {
+			continue
+		}
+		read := func(name string) string {
+			content, _ := actuator.ReadFile(sysfs, cpuPath(cpu, "cpufreq", name))
+			return strings.TrimSpace(content)
+		}
+		frequency := func(name string) int {
+			f, _ := strconv.Atoi(read(name))
+			return f
+		}
+		states = append(states, cpuState{
+			CPU:      cpu,
+			Online:   cpuOnline(cpu),
+			Managed:  slices.Contains(managed, cpu),
+			Driver:   read("scaling_driver"),
+			Governor: read("scaling_governor"),
+			InfoMin:  frequency("cpuinfo_min_freq"),
+			InfoMax:  frequency("cpuinfo_max_freq"),
+			Min:      frequency("scaling_min_freq"),
+			Max:      frequency("scaling_max_freq"),
+			Current:  frequency("scaling_cur_freq"),
+			EPP:      read("energy_performance_preference"),
+		})
+	}
+	slices.SortFunc(states, func(a, b cpuState) int { return a.CPU - b.CPU })
+	return states, nil
+}
+
+// printCPUStates writes the states as a table, or as JSON.
+func printCPUStates(w io.Writer, states []cpuState, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(states)
+	}
+	text := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	frequency := func(f int) string {
+		if f == 0 {
+			return "-"
+		}
+		return strconv.Itoa(f)
+	}
+	yes := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CPU\tONLINE\tMANAGED\tDRIVER\tGOVERNOR\tCPUINFO MIN\tCPUINFO MAX\tSCALING MIN\tSCALING MAX\tCURRENT\tEPP")
+	for _, s := range states {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.CPU, yes(s.Online), yes(s.Managed), text(s.Driver), text(s.Governor),
+			frequency(s.InfoMin), frequency(s.InfoMax), frequency(s.Min), frequency(s.Max), frequency(s.Current), text(s.EPP))
+	}
+	return tw.Flush()
+}
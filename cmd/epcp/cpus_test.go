@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+func TestCPUs(t *testing.T) {
+	root := tempSysfs(t, 3)
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// cpu1 is offline and does not report its frequency
+	write(actuator.CPUPath(root, 1, "online"), "0\n")
+	if err := os.Remove(actuator.CPUPath(root, 1, "cpufreq", "scaling_cur_freq")); err != nil {
+		t.Fatal(err)
+	}
+	// cpu2 runs intel_pstate with a preference
+	for name, content := range map[string]string{
+		"scaling_driver":                "intel_pstate\n",
+		"scaling_governor":              "powersave\n",
+		"scaling_cur_freq":              "1234567\n",
+		"energy_performance_preference": "balance_power\n",
+	} {
+		write(actuator.CPUPath(root, 2, "cpufreq", name), content)
+	}
+	// cpu10 is not present, e.g. in a container, and has no cpufreq
+	write(actuator.CPUPath(root, 10, "online"), "1\n")
+
+	for _, format := range []string{"table", "json"} {
+		t.Run(format, func(t *testing.T) {
+			out, code := runEpcp(t, "cpus", "--sysfs-root", root, "--format", format)
+			if code != exitOK {
+				t.Fatalf("exit code %d:\n%s", code, out)
+			}
+			golden := filepath.Join("testdata", "cpus-"+format+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(out), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != string(want) {
+				t.Errorf("output differs from %s, run the tests with -update if intended:\n%s", golden, out)
+			}
+		})
+	}
+
+	if out, code := runEpcp(t, "cpus", "--sysfs-root", root, "--format", "csv"); code != exitUsage {
+		t.Errorf("exit code %d with an unknown format, want %d:\n%s", code, exitUsage, out)
+	}
+}
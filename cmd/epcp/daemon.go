@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// cycleResult is what a cycle fetched and decided; it is passed to the outputs.
+type cycleResult struct {
+	Points        []ote.PricePoint
+	Prices        []float64
+	FetchErr      error
+	FetchDuration time.Duration
+	Decision      *Decision
+	// Stale is set when the newest price was older than expected, see
+	// checkStaleness
+	Stale bool
+	// SafeMode is the cause of the safe mode decision, if any, see
+	// adjustForSafeMode
+	SafeMode string
+}
+
+// exitCode classifies the outcome of the cycle for one-shot runs.
+func (r *cycleResult) exitCode() exitCode {
+	switch {
+	case e.Is(r.FetchErr, ote.ErrNoData):
+		return exitInsufficientData
+	case r.FetchErr != nil:
+		return exitFetchFailed
+	case r.Decision == nil || r.SafeMode == causeNoData || r.SafeMode == causePolicyError:
+		return exitInsufficientData
+	case len(r.Decision.Summary.Failed) != 0 && (strict || len(r.Decision.Summary.Succeeded) == 0):
+		return exitApplyFailed
+	}
+	return exitOK
+}
+
+// runCycle fetches the prices for the configured window and scales the CPUs
+// accordingly, saving the state at the end.
+func runCycle(ctx context.Context) *cycleResult {
+	trace := newCycleTrace()
+	ctx = withRunID(ctx, trace.runID)
+	defer exportTrace(ctx, trace)
+
+	checkDrift(ctx)
+	resetCoalescing()
+	times := getTimeRange()
+	start := time.Now()
+	result := new(cycleResult)
+	result.Points, result.FetchErr = fetchPrices(ctx, times)
+	result.FetchDuration = time.Since(start)
+	trace.record("fetch", start)
+	result.Prices = ote.Prices(result.Points)
+	start = time.Now()
+	settled := settledPoints(result.Points)
+	// The points of a failed fetch are those of the days before the failed
+	// one, see ote.FetchWindow, too few to decide on
+	if result.FetchErr == nil {
+		result.Decision = decideFrequency(ctx, adjustForSolar(ctx, settled))
+	}
+	logTrend(ctx, result.Decision)
+	adjustForProvisional(result.Decision, settled)
+	adjustForPeakShaving(ctx, result.Decision, settled)
+	adjustForForecast(ctx, result)
+	adjustForProfile(result)
+	adjustForBattery(ctx, result.Decision)
+	checkStaleness(ctx, result)
+	adjustForSafeMode(ctx, result)
+	clampToFloor(ctx, result.Decision)
+	adjustForBootGrace(ctx, result.Decision)
+	adjustForMaintenance(ctx, result.Decision)
+	trace.record("decide", start)
+	accountEnergy(ctx, result)
+	if result.Decision != nil {
+		result.Decision.RunID = trace.runID
+		if len(result.Prices) != 0 {
+			price := lastPrice(result)
+			result.Decision.Price = &price
+		}
+		if result.FetchErr != nil {
+			result.Decision.FetchError = result.FetchErr.Error()
+		}
+		start = time.Now()
+		runActuators(ctx, result)
+		trace.record("apply", start)
+		sampleAchieved(ctx, result.Decision)
+	}
+	status.update(result)
+	recordCycleMetrics(result)
+	if result.Decision != nil {
+		logDecision(ctx, result.Decision)
+	}
+	writePeriodReport(ctx)
+	drainNode(ctx, result)
+	updateClassAd(ctx, result)
+	emitBandChanged(ctx, result)
+	publishMQTT(ctx, result)
+	sendAlerts(ctx, result)
+	runChannels(ctx, times, result)
+	writeInflux(ctx, result)
+	if textfile != "" {
+		if err := writeTextfile(textfile); err != nil {
+			errorLog(ctx).Printf("Error writing metrics to %s: %s\n", textfile, err.Error())
+		}
+	}
+	if err := saveState(); err != nil {
+		errorLog(ctx).Printf("Error saving state file: %s\n", err.Error())
+	}
+	return result
+}
+
+// fetchPrices fetches the prices of the window, quarantining the implausible
+// ones. When OTE cannot be reached, the prices of the last fetch are used
+// while they are younger than the window; otherwise the forecast or the
+// price profile, when configured, stand in for the prices. A fetch with too
+// many prices quarantined fails as it is, for the cycle to fall back to the
+// safe mode.
+func fetchPrices(ctx context.Context, times *Times) ([]ote.PricePoint, error) {
+	points, err := getElectrictyPrices(ctx, times)
+	if err == nil {
+		points, err = quarantinePrices(ctx, points)
+	}
+	if err == nil {
+		trackRevisions(ctx, points)
+		state.Prices = &priceCache{Time: cycleClock.Now(), Points: points}
+		fetchedPrices.set(state.Prices.Time, points)
+		recordHistory(ctx, points)
+		return points, nil
+	}
+	// Too many implausible prices are a fault of the market data, which the
+	// forecasts and the profile would only hide: the cycle falls back to
+	// the safe mode instead
+	if e.Is(err, errQuarantined) {
+		return points, err
+	}
+	cache := state.Prices
+	if ote.IsNetwork(err) && cache != nil && cycleClock.Now().Sub(cache.Time) <= historyWindow {
+		errorLog(ctx).Printf("OTE cannot be reached, using the prices fetched at %s\n", cache.Time.Format(time.RFC3339))
+		return cache.Points, nil
+	}
+	if forecasted := forecastPrices(times); len(forecasted) != 0 {
+		errorLog(ctx).Printf("WARNING: no prices available (%s), using the %s forecast\n", err.Error(), forecastName)
+		return forecasted, nil
+	}
+	if profileFallback {
+		if profiled := profilePrices(ctx, times); len(profiled) != 0 {
+			errorLog(ctx).Printf("WARNING: no prices available (%s), using the price profile\n", err.Error())
+			return profiled, nil
+		}
+	}
+	return points, err
+}
+
+// notifyCycle reports the outcome of a cycle to systemd.
+func notifyCycle(result *cycleResult, ready *bool) {
+	decision := result.Decision
+	if decision == nil {
+		return
+	}
+	if !*ready {
+		if err := sdNotify("READY=1"); err != nil {
+			errorLogger.Printf("Error notifying systemd: %s\n", err.Error())
+		}
+		*ready = true
+	}
+	status := fmt.Sprintf("STATUS=Band %s, scaling_max_freq %d kHz", decision.Band, decision.Frequency)
+	if err := sdNotify(status); err != nil {
+		errorLogger.Printf("Error notifying systemd: %s\n", err.Error())
+	}
+}
+
+// evalOffset is how far into each interval the daemon runs its cycles, see
+// ScheduleConfig. The prices of an hour settle a few minutes after it ends,
+// so the provisional and staleness checks allow for it too.
+var evalOffset time.Duration
+
+// nextCycle returns the time of the next cycle aligned to the interval,
+// offset into it.
+func nextCycle(now time.Time, interval, offset time.Duration) time.Time {
+	return now.Add(-offset).Truncate(interval).Add(interval + offset)
+}
+
+// runDaemon runs a cycle every interval. Watchdog pings are sent from the same
+// loop so that systemd restarts the daemon when a cycle hangs.
+func runDaemon(ctx context.Context, interval time.Duration) {
+	ready := false
+	var watchdog <-chan time.Time
+	if wi := sdWatchdogInterval(); wi > 0 {
+		ticker := time.NewTicker(wi)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+	infoLogger.Printf("Running in daemon mode with interval %s\n", interval)
+	if listenAddress != "" {
+		go serveHTTP(ctx, "status", listenAddress, statusHandler(interval))
+	}
+	if debugListen != "" {
+		go serveHTTP(ctx, "debug", debugListen, debugHandler())
+	}
+	connectDBus()
+	startNotifyQueues()
+	go watchPublication(ctx)
+	go serveControl(controlSocketPath(), ctx.Done())
+	bootstrapDaemon(ctx)
+	runLoop(ctx, interval, watchdog, func(result *cycleResult) { notifyCycle(result, &ready) })
+}
+
+// runLoop runs a cycle every interval of cycleClock, aligned to it, and
+// passes the results to done until ctx is done. It also sends the watchdog
+// pings, runs the control commands and, when a cycle plans a ramp to the
+// band of the next hour, the steps of the ramp. A single timer wakes it for
+// the next step or cycle, so that the simulated clock sees one waiter.
+func runLoop(ctx context.Context, interval time.Duration, watchdog <-chan time.Time, done func(*cycleResult)) {
+	// The jitter is part of the timer so that watchdog pings continue meanwhile
+	delay := hostJitter()
+	if delay > 0 {
+		infoLogger.Printf("Cycles are delayed by %s\n", delay.Round(time.Millisecond))
+	}
+	if evalOffset > 0 {
+		infoLogger.Printf("Cycles run %s into each interval\n", evalOffset)
+	}
+	offset := evalOffset + delay
+	next := cycleClock.Now().Add(delay)
+	status.setNextCycle(next)
+	timer := cycleClock.After(delay)
+	var ramp *rampPlan
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-watchdog:
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				errorLogger.Printf("Error notifying systemd: %s\n", err.Error())
+			}
+		case cmd := <-controlCommands:
+			runControlCommand(cmd, func() {
+				done(runCycle(ctx))
+				ramp = nil
+			})
+		case <-timer:
+			switch now := cycleClock.Now(); {
+			case ramp.due(now):
+				ramp.step(ctx)
+			case !now.Before(next):
+				result := runCycle(ctx)
+				done(result)
+				now = cycleClock.Now()
+				next = nextCycle(now, interval, offset)
+				status.setNextCycle(next)
+				ramp = planRamp(ctx, result.Decision, now, next)
+			}
+			timer = cycleClock.After(ramp.wake(next).Sub(cycleClock.Now()))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// dayAheadDay holds the day-ahead prices of a day, in EUR/MWh.
+type dayAheadDay struct {
+	Date   string           `json:"date"`
+	Points []ote.PricePoint `json:"points"`
+	Min    float64          `json:"min"`
+	Max    float64          `json:"max"`
+	Mean   float64          `json:"mean"`
+}
+
+// newDayAheadDay returns the day of the points, which must not be empty.
+func newDayAheadDay(date string, points []ote.PricePoint) *dayAheadDay {
+	prices := ote.Prices(points)
+	d := &dayAheadDay{Date: date, Points: points, Min: slices.Min(prices), Max: slices.Max(prices)}
+	for _, p := range prices {
+		d.Mean += p / float64(len(prices))
+	}
+	return d
+}
+
+// dayAheadStatus is the day-ahead prices in /status, null before they are
+// published.
+type dayAheadStatus struct {
+	Today    *dayAheadDay `json:"today"`
+	Tomorrow *dayAheadDay `json:"tomorrow"`
+}
+
+// dayAhead holds the day-ahead prices of today and, once published, of
+// tomorrow, see watchPublication. The status endpoints read them outside the
+// cycles.
+var dayAhead = new(dayAheadPrices)
+
+type dayAheadPrices struct {
+	mu              sync.Mutex
+	today, tomorrow *dayAheadDay
+}
+
+// setTomorrow records the day-ahead prices of tomorrow.
+func (d *dayAheadPrices) setTomorrow(day *dayAheadDay) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tomorrow = day
+}
+
+// setToday records the day-ahead prices of today, when fetched rather than
+// rolled over from tomorrow.
+func (d *dayAheadPrices) setToday(day *dayAheadDay) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.today = day
+}
+
+// current returns the prices of today and tomorrow at now, rolling those of
+// tomorrow over into today at midnight in the market timezone.
+func (d *dayAheadPrices) current(now time.Time) dayAheadStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	today := ote.Day(now)
+	if d.tomorrow != nil && d.tomorrow.Date <= today {
+		d.today, d.tomorrow = d.tomorrow, nil
+	}
+	if d.today != nil && d.today.Date != today {
+		d.today = nil
+	}
+	return dayAheadStatus{Today: d.today, Tomorrow: d.tomorrow}
+}
+
+// recordDayAheadMetrics exports the minimum, maximum and mean day-ahead price
+// of tomorrow once published.
+func recordDayAheadMetrics() {
+	const help = "Day-ahead price of tomorrow by statistic, once published."
+	metrics.resetGauge("epcp_dam_tomorrow_price", help)
+	tomorrow := dayAhead.current(cycleClock.Now()).Tomorrow
+	if tomorrow == nil {
+		return
+	}
+	metrics.setGauge("epcp_dam_tomorrow_price", help, tomorrow.Min, "stat", "min")
+	metrics.setGauge("epcp_dam_tomorrow_price", help, tomorrow.Max, "stat", "max")
+	metrics.setGauge("epcp_dam_tomorrow_price", help, tomorrow.Mean, "stat", "mean")
+}
+
+// serveDayAhead serves the day-ahead prices of the day, today or tomorrow.
+func serveDayAhead(w http.ResponseWriter, day string) {
+	current := dayAhead.current(cycleClock.Now())
+	var prices *dayAheadDay
+	switch day {
+	case "today":
+		prices = current.Today
+	case "tomorrow":
+		prices = current.Tomorrow
+	default:
+		http.Error(w, "day must be today or tomorrow", http.StatusBadRequest)
+		return
+	}
+	if prices == nil {
+		http.Error(w, "the day-ahead prices of "+day+" are not known yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prices)
+}
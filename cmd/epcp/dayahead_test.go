@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+func TestDayAheadRollover(t *testing.T) {
+	fixed := &fixedClock{time.Date(2024, time.October, 1, 12, 0, 0, 0, ote.Location())}
+	setGlobal[clock](t, &cycleClock, fixed)
+	setGlobal(t, &dayAhead, new(dayAheadPrices))
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	setGlobal(t, &status, &cycleStatus{started: fixed.now, frequencies: make(map[int]int)})
+	handler := statusHandler(time.Hour)
+	dayAheadOf := func() (string, dayAheadStatus) {
+		t.Helper()
+		_, body := get(t, handler, "/status")
+		var res struct {
+			DayAhead json.RawMessage `json:"dayAhead"`
+		}
+		if err := json.Unmarshal([]byte(body), &res); err != nil {
+			t.Fatalf("/status: %v:\n%s", err, body)
+		}
+		var d dayAheadStatus
+		if err := json.Unmarshal(res.DayAhead, &d); err != nil {
+			t.Fatal(err)
+		}
+		return string(res.DayAhead), d
+	}
+	exposition := func() string {
+		recordDayAheadMetrics()
+		var b strings.Builder
+		metrics.write(&b)
+		return b.String()
+	}
+
+	// Null before the publication
+	if raw, _ := dayAheadOf(); raw != `{"today":null,"tomorrow":null}` {
+		t.Errorf("/status day-ahead prices %s before the publication, want null", raw)
+	}
+	for _, day := range []string{"today", "tomorrow"} {
+		if code, body := get(t, handler, "/prices?day="+day); code != http.StatusNotFound || body != "the day-ahead prices of "+day+" are not known yet\n" {
+			t.Errorf("/prices?day=%s before the publication: %d %q, want 404", day, code, body)
+		}
+	}
+	if code, _ := get(t, handler, "/prices?day=yesterday"); code != http.StatusBadRequest {
+		t.Errorf("/prices?day=yesterday: %d, want 400", code)
+	}
+	if out := exposition(); strings.Contains(out, "epcp_dam_tomorrow_price{") {
+		t.Errorf("metrics of tomorrow before the publication:\n%s", out)
+	}
+
+	prices := make([]float64, 24)
+	for i := range prices {
+		prices[i] = float64(80 + i)
+	}
+	dayAhead.setTomorrow(newDayAheadDay("2024-10-02", otetest.Points("2024-10-02", 1, prices...)))
+	_, d := dayAheadOf()
+	if d.Today != nil || d.Tomorrow == nil || d.Tomorrow.Date != "2024-10-02" || len(d.Tomorrow.Points) != 24 ||
+		d.Tomorrow.Min != 80 || d.Tomorrow.Max != 103 || d.Tomorrow.Mean != 91.5 {
+		t.Errorf("/status day-ahead prices %+v, want those of 2024-10-02", d)
+	}
+	code, body := get(t, handler, "/prices?day=tomorrow")
+	var tomorrow dayAheadDay
+	if err := json.Unmarshal([]byte(body), &tomorrow); code != http.StatusOK || err != nil || tomorrow.Date != "2024-10-02" || len(tomorrow.Points) != 24 {
+		t.Errorf("/prices?day=tomorrow: %d %v:\n%s", code, err, body)
+	}
+	out := exposition()
+	for _, want := range []string{`epcp_dam_tomorrow_price{stat="min"} 80`, `epcp_dam_tomorrow_price{stat="max"} 103`, `epcp_dam_tomorrow_price{stat="mean"} 91.5`} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics without %s:\n%s", want, out)
+		}
+	}
+
+	// Still tomorrow a minute before midnight in the market timezone
+	fixed.now = time.Date(2024, time.October, 1, 23, 59, 0, 0, ote.Location())
+	if _, d := dayAheadOf(); d.Today != nil || d.Tomorrow == nil {
+		t.Errorf("day-ahead prices %+v before midnight", d)
+	}
+	// Rolled over into today at midnight, 22:00 UTC
+	fixed.now = time.Date(2024, time.October, 1, 22, 0, 0, 0, time.UTC)
+	if _, d := dayAheadOf(); d.Tomorrow != nil || d.Today == nil || d.Today.Date != "2024-10-02" || d.Today.Max != 103 {
+		t.Errorf("day-ahead prices %+v after midnight, want those of 2024-10-02 today", d)
+	}
+	if code, _ := get(t, handler, "/prices?day=today"); code != http.StatusOK {
+		t.Errorf("/prices?day=today after midnight: %d, want 200", code)
+	}
+	if code, _ := get(t, handler, "/prices?day=tomorrow"); code != http.StatusNotFound {
+		t.Errorf("/prices?day=tomorrow after midnight: %d, want 404", code)
+	}
+	if out := exposition(); strings.Contains(out, "epcp_dam_tomorrow_price{") {
+		t.Errorf("metrics of tomorrow after the rollover:\n%s", out)
+	}
+
+	// Dropped the day after, unless published again
+	fixed.now = time.Date(2024, time.October, 3, 0, 30, 0, 0, ote.Location())
+	if raw, _ := dayAheadOf(); raw != `{"today":null,"tomorrow":null}` {
+		t.Errorf("/status day-ahead prices %s a day later, want null", raw)
+	}
+}
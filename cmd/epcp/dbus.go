@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+// The name, object and interface epcp exports on D-Bus.
+const (
+	dbusName      = "cz.cerit.Epcp"
+	dbusPath      = dbus.ObjectPath("/cz/cerit/Epcp")
+	dbusInterface = "cz.cerit.Epcp"
+)
+
+var (
+	// dbusBus is the bus epcp is exported on, system or session, or empty
+	dbusBus string
+	// dbusConn is the connection to the bus, nil when it is unavailable
+	dbusConn *dbus.Conn
+	// dbusBand is the band of the last BandChanged signal
+	dbusBand string
+)
+
+var dbusIntrospection = introspect.Node{
+	Name: string(dbusPath),
+	Interfaces: []introspect.Interface{
+		introspect.IntrospectData,
+		{
+			Name: dbusInterface,
+			Methods: []introspect.Method{{
+				Name: "GetStatus",
+				Args: []introspect.Arg{
+					{Name: "band", Type: "s", Direction: "out"},
+					{Name: "price", Type: "d", Direction: "out"},
+					{Name: "target_khz", Type: "i", Direction: "out"},
+					{Name: "updated_at", Type: "x", Direction: "out"},
+				},
+			}},
+			Signals: []introspect.Signal{{
+				Name: "BandChanged",
+				Args: []introspect.Arg{
+					{Name: "old_band", Type: "s"},
+					{Name: "new_band", Type: "s"},
+					{Name: "price", Type: "d"},
+					{Name: "timestamp", Type: "x"},
+				},
+			}},
+		},
+	},
+}
+
+// dbusObject implements the exported interface.
+type dbusObject struct{}
+
+// GetStatus returns the band, the last price, the target frequency and the
+// Unix time of the last cycle, like /sensor. The band is initializing and
+// the rest zero until the first decision.
+func (dbusObject) GetStatus() (string, float64, int32, int64, *dbus.Error) {
+	sensor := status.sensor()
+	var price float64
+	var frequency int32
+	var updated int64
+	if sensor.Price != nil {
+		price = *sensor.Price
+	}
+	if sensor.TargetKHz != nil {
+		frequency = int32(*sensor.TargetKHz)
+	}
+	if sensor.UpdatedAt != nil {
+		updated = sensor.UpdatedAt.Unix()
+	}
+	return sensor.State, price, frequency, updated, nil
+}
+
+// connectDBus exports epcp on the bus. Without a bus, or when the name is
+// taken, the signals are disabled with a warning.
+func connectDBus() {
+	if dbusBus == "" {
+		return
+	}
+	connect := dbus.ConnectSystemBus
+	if dbusBus == "session" {
+		connect = dbus.ConnectSessionBus
+	}
+	conn, err := connect()
+	if err != nil {
+		errorLogger.Printf("WARNING: the D-Bus %s bus is unavailable, not emitting signals: %s\n", dbusBus, err.Error())
+		return
+	}
+	err = conn.Export(dbusObject{}, dbusPath, dbusInterface)
+	if err == nil {
+		err = conn.Export(introspect.NewIntrospectable(&dbusIntrospection), dbusPath, "org.freedesktop.DBus.Introspectable")
+	}
+	if err == nil {
+		var reply dbus.RequestNameReply
+		reply, err = conn.RequestName(dbusName, dbus.NameFlagDoNotQueue)
+		if err == nil && reply != dbus.RequestNameReplyPrimaryOwner {
+			errorLogger.Printf("WARNING: the D-Bus name %s is owned by another process\n", dbusName)
+		}
+	}
+	if err != nil {
+		errorLogger.Printf("WARNING: cannot export %s on the D-Bus %s bus, not emitting signals: %s\n", dbusName, dbusBus, err.Error())
+		conn.Close()
+		return
+	}
+	infoLogger.Printf("Exported %s on the D-Bus %s bus\n", dbusName, dbusBus)
+	dbusConn = conn
+}
+
+// emitBandChanged signals a change of the decided band.
+func emitBandChanged(ctx context.Context, result *cycleResult) {
+	decision := result.Decision
+	if dbusConn == nil || decision == nil || decision.Band == dbusBand {
+		return
+	}
+	old := dbusBand
+	dbusBand = decision.Band
+	err := dbusConn.Emit(dbusPath, dbusInterface+".BandChanged", old, decision.Band,
+		lastPrice(result), decision.Time.Unix())
+	if err != nil {
+		errorLog(ctx).Printf("Error emitting the D-Bus signal: %s\n", err.Error())
+	}
+}
+
+// closeDBus releases the name and closes the connection, on exit.
+func closeDBus() {
+	if dbusConn == nil {
+		return
+	}
+	// The name is released with the connection
+	dbusConn.Close()
+	dbusConn = nil
+}
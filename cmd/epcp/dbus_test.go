@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// privateBus starts a dbus-daemon for the test and makes it the session bus.
+func privateBus(t *testing.T) {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("no dbus-daemon")
+	}
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	err = os.WriteFile(config, []byte(`<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:dir=`+dir+`</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*"/>
+    <allow receive_sender="*"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("starting dbus-daemon: %v", err)
+	}
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(address))
+}
+
+func TestDBus(t *testing.T) {
+	privateBus(t)
+	logs := captureLogs(t)
+	setGlobal(t, &dbusBus, "session")
+	setGlobal(t, &dbusConn, nil)
+	setGlobal(t, &dbusBand, "")
+	setGlobal(t, &status, &cycleStatus{started: time.Now(), frequencies: make(map[int]int)})
+	connectDBus()
+	if dbusConn == nil {
+		t.Fatalf("not connected:\n%s", logs)
+	}
+	defer closeDBus()
+
+	listener, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if err := listener.AddMatchSignal(dbus.WithMatchInterface(dbusInterface), dbus.WithMatchMember("BandChanged")); err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan *dbus.Signal, 10)
+	listener.Signal(signals)
+	object := listener.Object(dbusName, dbusPath)
+
+	// GetStatus reports initializing before the first decision
+	var band string
+	var price float64
+	var frequency int32
+	var updated int64
+	if err := object.Call(dbusInterface+".GetStatus", 0).Store(&band, &price, &frequency, &updated); err != nil {
+		t.Fatal(err)
+	}
+	if band != "initializing" || price != 0 || frequency != 0 || updated != 0 {
+		t.Errorf("GetStatus before the first cycle: %s %g %d %d", band, price, frequency, updated)
+	}
+
+	at := time.Date(2024, time.October, 1, 10, 0, 0, 0, time.UTC)
+	cycle := func(band string, price float64) {
+		decision := &Decision{Time: at, Band: band, Frequency: 800000}
+		emitBandChanged(context.Background(), &cycleResult{Prices: []float64{80, price}, Decision: decision})
+		status.update(&cycleResult{Prices: []float64{80, price}, Decision: decision})
+	}
+	cycle(policy.Expensive, 120.5)
+	cycle(policy.Expensive, 130)
+	cycle(policy.Cheap, 60)
+	want := [][]any{{"", "expensive", 120.5, at.Unix()}, {"expensive", "cheap", 60.0, at.Unix()}}
+	for i, w := range want {
+		select {
+		case signal := <-signals:
+			if signal.Name != dbusInterface+".BandChanged" || signal.Path != dbusPath || len(signal.Body) != 4 {
+				t.Fatalf("signal %d: %+v", i, signal)
+			}
+			for j := range w {
+				if signal.Body[j] != w[j] {
+					t.Errorf("signal %d: %v, want %v", i, signal.Body, w)
+					break
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("signal %d not received", i)
+		}
+	}
+	select {
+	case signal := <-signals:
+		t.Errorf("unexpected signal %v for an unchanged band", signal.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := object.Call(dbusInterface+".GetStatus", 0).Store(&band, &price, &frequency, &updated); err != nil {
+		t.Fatal(err)
+	}
+	if band != "cheap" || price != 60 || frequency != 800000 || updated == 0 {
+		t.Errorf("GetStatus after a cycle: %s %g %d %d", band, price, frequency, updated)
+	}
+}
+
+func TestDBusUnavailable(t *testing.T) {
+	logs := captureLogs(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path="+filepath.Join(t.TempDir(), "missing"))
+	setGlobal(t, &dbusBus, "session")
+	setGlobal(t, &dbusConn, nil)
+	setGlobal(t, &dbusBand, "")
+	connectDBus()
+	if dbusConn != nil || !strings.Contains(logs.String(), "WARNING: the D-Bus session bus is unavailable, not emitting signals") {
+		t.Errorf("connected to a missing bus:\n%s", logs)
+	}
+	// The cycles go on without the signals
+	emitBandChanged(context.Background(), &cycleResult{Decision: &Decision{Band: policy.Expensive}})
+	closeDBus()
+}
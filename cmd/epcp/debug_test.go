@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugHandler(t *testing.T) {
+	captureLogs(t)
+	setGlobal(t, &simulate, true)
+	// The status endpoint does not serve the debug handlers
+	for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
+		if code, _ := get(t, statusHandler(time.Hour), path); code != http.StatusNotFound {
+			t.Errorf("%s on the status endpoint: %d, want 404", path, code)
+		}
+	}
+	code, body := get(t, debugHandler(), "/debug/pprof/")
+	if code != http.StatusOK || !strings.Contains(body, "goroutine") {
+		t.Errorf("/debug/pprof/: %d:\n%s", code, body)
+	}
+	code, body = get(t, debugHandler(), "/debug/vars")
+	var vars map[string]any
+	if err := json.Unmarshal([]byte(body), &vars); code != http.StatusOK || err != nil || vars["goroutines"] == nil || vars["memstats"] == nil {
+		t.Errorf("/debug/vars: %d %v:\n%s", code, err, body)
+	}
+	// The goroutine and heap counts are in /status too
+	_, body = get(t, statusHandler(time.Hour), "/status")
+	var res statusResponse
+	if err := json.Unmarshal([]byte(body), &res); err != nil || res.Goroutines == 0 || res.HeapAlloc == 0 {
+		t.Errorf("/status: %v, goroutines %d, heap %d", err, res.Goroutines, res.HeapAlloc)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/CERIT-SC/epcp-simulator/internal/expr"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// priceEWMAWeight is the weight of each new price in price_ewma.
+const priceEWMAWeight = 0.3
+
+// metricSeries are the series the decision metric may combine, for each hour
+// of the window: the price, its exponentially weighted moving average and its
+// percentile rank in the window, from 0 for the lowest to 1 for the highest.
+var metricSeries = []string{"price", "price_ewma", "price_pctl"}
+
+// decisionMetric is the expression the policy decides on instead of the
+// prices, nil for the prices, see PolicyConfig.
+var decisionMetric *expr.Expr
+
+// parseDecisionMetric parses the expression of a decision metric.
+func parseDecisionMetric(src string) (*expr.Expr, error) {
+	return expr.Parse(src, metricSeries)
+}
+
+// metricValues returns the decision metric of each hour of the prices, or the
+// prices without a metric. A metric that cannot be evaluated, dividing by
+// zero, leaves the prices.
+func metricValues(prices []float64) []float64 {
+	if decisionMetric == nil || len(prices) == 0 {
+		return prices
+	}
+	values := make([]float64, len(prices))
+	ewma := prices[0]
+	for i, p := range prices {
+		ewma = priceEWMAWeight*p + (1-priceEWMAWeight)*ewma
+		v, err := decisionMetric.Eval(map[string]float64{
+			"price": p, "price_ewma": ewma, "price_pctl": percentileRank(prices, p),
+		})
+		if err != nil {
+			errorLogger.Printf("Error evaluating the decision metric %s: %s, deciding on the prices\n", decisionMetric, err.Error())
+			return prices
+		}
+		values[i] = v
+	}
+	return values
+}
+
+// percentileRank returns the share of the other prices below price, equal
+// ones counting half, 0.5 for a single price.
+func percentileRank(prices []float64, price float64) float64 {
+	if len(prices) < 2 {
+		return 0.5
+	}
+	var below float64
+	for _, p := range prices {
+		switch policy.Compare(p, price) {
+		case -1:
+			below++
+		case 0:
+			below += 0.5
+		}
+	}
+	// The price itself counted half
+	return (below - 0.5) / float64(len(prices)-1)
+}
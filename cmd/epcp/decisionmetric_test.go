@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestPercentileRank(t *testing.T) {
+	prices := []float64{10, 20, 20, 40}
+	tests := []struct {
+		price, want float64
+	}{
+		{10, 0},
+		// One price below, the other equal one counting half
+		{20, 0.5},
+		{40, 1},
+	}
+	for _, test := range tests {
+		if got := percentileRank(prices, test.price); got != test.want {
+			t.Errorf("rank of %g: %g, want %g", test.price, got, test.want)
+		}
+	}
+	if got := percentileRank([]float64{10}, 10); got != 0.5 {
+		t.Errorf("rank of a single price %g, want 0.5", got)
+	}
+}
+
+func TestMetricValues(t *testing.T) {
+	logs := captureLogs(t)
+	prices := []float64{100, 200, 150}
+	metric := func(src string) {
+		t.Helper()
+		x, err := parseDecisionMetric(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setGlobal(t, &decisionMetric, x)
+	}
+	if got := metricValues(prices); !slices.Equal(got, prices) {
+		t.Errorf("values %v without a metric, want the prices", got)
+	}
+
+	metric("price_ewma")
+	// The average starts at the first price
+	if got := metricValues(prices); !slices.Equal(got, []float64{100, 130, 136}) {
+		t.Errorf("price_ewma %v", got)
+	}
+	metric("price_pctl")
+	if got := metricValues(prices); !slices.Equal(got, []float64{0, 1, 0.5}) {
+		t.Errorf("price_pctl %v", got)
+	}
+	metric("0.5*price_pctl + price/1000")
+	if got := metricValues(prices); !slices.Equal(got, []float64{0.1, 0.7, 0.4}) {
+		t.Errorf("composite %v", got)
+	}
+
+	// A metric dividing by zero leaves the prices
+	metric("price / (price_pctl - 0.5)")
+	if got := metricValues(prices); !slices.Equal(got, prices) {
+		t.Errorf("values %v dividing by zero, want the prices", got)
+	}
+	if !strings.Contains(logs.String(), "Error evaluating the decision metric price / (price_pctl - 0.5): division by zero, deciding on the prices") {
+		t.Errorf("the error not logged:\n%s", logs)
+	}
+}
+
+func TestCompositeMetricDecision(t *testing.T) {
+	// Rising prices are expensive to the trend policy
+	runOnMocks(t, trend(time.Now(), 10))
+	captureLogs(t)
+	if d := runCycle(context.Background()).Decision; d == nil || d.Band != policy.Expensive {
+		t.Fatalf("decision %+v on the prices, want expensive", d)
+	}
+
+	// The headroom below the highest price of the window weighs more than
+	// the rising average, so the metric falls
+	config := Config{Policy: PolicyConfig{Metric: "0.7*(1 - price_pctl) + 0.3*price_ewma/1000"}}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	x, err := parseDecisionMetric(config.Policy.Metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &decisionMetric, x)
+	if d := runCycle(context.Background()).Decision; d == nil || d.Band != policy.Cheap || d.Frequency != 3200000 {
+		t.Errorf("decision %+v on the metric, want cheap", d)
+	}
+}
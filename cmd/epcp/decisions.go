@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// decisionFilter selects the decisions printed by the decisions command. Zero
+// fields select every decision.
+type decisionFilter struct {
+	from, to time.Time
+	band     string
+	reason   string
+}
+
+func decisionsFlags(flags *flag.FlagSet) {
+	envVar(flags, "decision-log", "EPCP_DECISION_LOG", "string", "JSON lines `file` of the decisions")
+	envVar(flags, "state-dir", "EPCP_STATE_DIR", "string", "`directory` of the state file, read without a decision log")
+	flags.String("from", "", "first decision time as YYYY-MM-DD, YYYY-MM-DD HH:MM in the market time zone or RFC 3339")
+	flags.String("to", "", "time the decisions end before, like --from")
+	flags.String("band", "", "only the decisions of the `band`, cheap or expensive")
+	flags.String("reason", "", "only the decisions with the `reason`: forecast, maintenance, stale, safe-mode, boot-grace, simulated or a part of their reason")
+	flags.Int("tail", 0, "only the last `n` decisions selected")
+	flags.String("format", "table", "format of the output, table or json lines")
+}
+
+func runDecisions(flags *flag.FlagSet) exitCode {
+	value := func(name string) string { return flags.Lookup(name).Value.String() }
+	format := value("format")
+	if format != "table" && format != "json" {
+		errorLogger.Printf("Unknown format %q, expected table or json.\n", format)
+		return exitUsage
+	}
+	filter := decisionFilter{band: value("band"), reason: value("reason")}
+	var err error
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &filter.from}, {"to", &filter.to}} {
+		if v := value(bound.name); v != "" {
+			if *bound.t, err = decisionTime(v); err != nil {
+				errorLogger.Printf("Error parsing --%s: %s\n", bound.name, err.Error())
+				return exitUsage
+			}
+		}
+	}
+	tail, err := strconv.Atoi(value("tail"))
+	if err != nil || tail < 0 {
+		errorLogger.Printf("Invalid --tail %q, expected a positive number.\n", value("tail"))
+		return exitUsage
+	}
+	var selected []*Decision
+	if decisionLog == "" {
+		// Without a log, only the last decision kept in the state is known
+		loadState()
+		if d := state.LastDecision; d != nil && filter.matches(d) {
+			selected = append(selected, d)
+		}
+	} else {
+		f, err := os.Open(decisionLog)
+		if err != nil {
+			errorLogger.Printf("Error opening decision log %s: %s\n", decisionLog, err.Error())
+			return exitFailure
+		}
+		var corrupted int
+		selected, corrupted, err = readDecisions(f, filter, tail)
+		f.Close()
+		if err != nil {
+			errorLogger.Printf("Error reading decision log %s: %s\n", decisionLog, err.Error())
+			return exitFailure
+		}
+		if corrupted != 0 {
+			errorLogger.Printf("WARNING: skipped %d corrupted lines of the decision log %s\n", corrupted, decisionLog)
+		}
+	}
+	if err := printDecisions(os.Stdout, selected, format == "json"); err != nil {
+		errorLogger.Printf("Error writing the decisions: %s\n", err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
+
+// decisionTime parses a day, meaning its start in the market time zone, a
+// time of the day in the market time zone as YYYY-MM-DD HH:MM, or an RFC
+// 3339 time.
+func decisionTime(value string) (time.Time, error) {
+	if _, err := time.Parse("2006-01-02 15:04", value); err == nil {
+		return time.ParseInLocation("2006-01-02 15:04", value, ote.Location())
+	}
+	return simulationTime(value)
+}
+
+// matches reports whether the filter selects the decision.
+func (f decisionFilter) matches(d *Decision) bool {
+	switch {
+	case !f.from.IsZero() && d.Time.Before(f.from):
+		return false
+	case !f.to.IsZero() && !d.Time.Before(f.to):
+		return false
+	case f.band != "" && d.Band != f.band:
+		return false
+	case f.reason != "":
+		return slices.Contains(decisionReasons(d), f.reason) ||
+			strings.Contains(strings.ToLower(d.Reason), strings.ToLower(f.reason))
+	}
+	return true
+}
+
+// decisionReasons returns the codes of the reasons marked in the decision.
+func decisionReasons(d *Decision) []string {
+	var reasons []string
+	if d.Forecast {
+		reasons = append(reasons, "forecast")
+	}
+	if d.Maintenance {
+		reasons = append(reasons, "maintenance")
+	}
+	if d.Stale {
+		reasons = append(reasons, "stale")
+	}
+	if d.SafeMode != "" {
+		reasons = append(reasons, "safe-mode")
+	}
+	if d.BootGrace {
+		reasons = append(reasons, "boot-grace")
+	}
+	if d.Simulated {
+		reasons = append(reasons, "simulated")
+	}
+	return reasons
+}
+
+// readDecisions reads the decisions of a JSON lines log selected by the
+// filter, only keeping the last tail ones unless it is 0. It counts the
+// lines that are not decisions instead of failing on them.
+func readDecisions(r io.Reader, filter decisionFilter, tail int) (selected []*Decision, corrupted int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		d := new(Decision)
+		if err := json.Unmarshal(line, d); err != nil || d.Time.IsZero() {
+			corrupted++
+			continue
+		}
+		if !filter.matches(d) {
+			continue
+		}
+		selected = append(selected, d)
+		if tail != 0 && len(selected) > 2*tail {
+			selected = slices.Delete(selected, 0, len(selected)-tail)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, corrupted, err
+	}
+	if tail != 0 && len(selected) > tail {
+		selected = selected[len(selected)-tail:]
+	}
+	return selected, corrupted, nil
+}
+
+// printDecisions writes the decisions as a table, or as JSON lines like those
+// of the log.
+func printDecisions(w io.Writer, decisions []*Decision, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		for _, d := range decisions {
+			if err := encoder.Encode(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	text := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tBAND\tFREQUENCY\tDAY\tAPPLIED\tFAILED\tMARKS\tREASON")
+	for _, d := range decisions {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%d\t%s\t%s\n", inMarketTime(d.Time).Format(time.RFC3339), d.Band, d.Frequency,
+			text(d.DayType), len(d.Summary.Succeeded), len(d.Summary.Failed), text(strings.Join(decisionReasons(d), ",")), text(d.Reason))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// decisionLogOf writes a log of hourly decisions from midnight of 1 October
+// 2024 in the market time zone for two days: expensive in the afternoons,
+// made on forecast prices at 03:00, in maintenance at 04:00, stale at 05:00,
+// plus a corrupted and a blank line. It returns the path and the decisions.
+func decisionLogOf(t *testing.T) (string, []*Decision) {
+	t.Helper()
+	start := time.Date(2024, time.October, 1, 0, 0, 0, 0, ote.Location())
+	var decisions []*Decision
+	var log strings.Builder
+	for hour := range 48 {
+		d := &Decision{Time: start.Add(time.Duration(hour) * time.Hour), Band: policy.Cheap, Frequency: 3200000, DayType: "workday"}
+		if h := hour % 24; h >= 12 && h < 18 {
+			d.Band, d.Frequency = policy.Expensive, 800000
+		}
+		switch hour % 24 {
+		case 3:
+			d.Forecast, d.Reason = true, "no prices available"
+		case 4:
+			d.Maintenance = true
+		case 5:
+			d.Stale, d.Reason = true, "Clamped to the floor"
+		}
+		decisions = append(decisions, d)
+		line, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Write(line)
+		log.WriteString("\n")
+		if hour == 10 {
+			log.WriteString("{\"time\": \"2024-10-01T10:30:00+02:00\", \"band\":\n\n")
+		}
+	}
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	if err := os.WriteFile(path, []byte(log.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, decisions
+}
+
+func TestReadDecisions(t *testing.T) {
+	path, decisions := decisionLogOf(t)
+	at := func(value string) time.Time {
+		t.Helper()
+		tm, err := decisionTime(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		name   string
+		filter decisionFilter
+		tail   int
+		// want are the first and last indexes of the ranges of the
+		// decisions selected, nil for all of them
+		want []int
+	}{
+		{"all", decisionFilter{}, 0, nil},
+		{"from a day", decisionFilter{from: at("2024-10-02")}, 0, []int{24, 47}},
+		{"to a time", decisionFilter{to: at("2024-10-01 02:00")}, 0, []int{0, 1}},
+		{"between RFC 3339 times", decisionFilter{from: at("2024-10-01T10:00:00Z"), to: at("2024-10-01T14:00:00+02:00")}, 0, []int{12, 13}},
+		{"band", decisionFilter{band: policy.Expensive}, 0, []int{12, 17, 36, 41}},
+		{"forecast", decisionFilter{reason: "forecast"}, 0, []int{3, 3, 27, 27}},
+		{"maintenance", decisionFilter{reason: "maintenance"}, 0, []int{4, 4, 28, 28}},
+		{"stale", decisionFilter{reason: "stale"}, 0, []int{5, 5, 29, 29}},
+		{"part of the reason", decisionFilter{reason: "clamped"}, 0, []int{5, 5, 29, 29}},
+		{"no match", decisionFilter{reason: "boot-grace"}, 0, []int{}},
+		{"tail", decisionFilter{}, 3, []int{45, 47}},
+		{"tail of the band", decisionFilter{band: policy.Expensive, from: at("2024-10-02")}, 2, []int{40, 41}},
+	}
+	for _, test := range tests {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected, corrupted, err := readDecisions(f, test.filter, test.tail)
+		f.Close()
+		if err != nil || corrupted != 1 {
+			t.Errorf("%s: %d corrupted lines, %v, want 1", test.name, corrupted, err)
+		}
+		want := decisions
+		if test.want != nil {
+			want = nil
+			for i := 0; i < len(test.want); i += 2 {
+				want = append(want, decisions[test.want[i]:test.want[i+1]+1]...)
+			}
+		}
+		if len(selected) != len(want) {
+			t.Errorf("%s: %d decisions, want %d", test.name, len(selected), len(want))
+			continue
+		}
+		for i, d := range selected {
+			if !d.Time.Equal(want[i].Time) {
+				t.Errorf("%s: decision %d at %s, want %s", test.name, i, d.Time, want[i].Time)
+			}
+		}
+	}
+}
+
+func TestDecisionsCommand(t *testing.T) {
+	path, _ := decisionLogOf(t)
+	out, code := runEpcp(t, "decisions", "--decision-log", path, "--band", "expensive", "--reason", "forecast")
+	if code != exitOK || out != "TIME  BAND  FREQUENCY  DAY  APPLIED  FAILED  MARKS  REASON\n" {
+		t.Errorf("exit code %d:\n%s", code, out)
+	}
+	out, code = runEpcp(t, "decisions", "--decision-log", path, "--from", "2024-10-02 03:00", "--tail", "1", "--reason", "forecast")
+	want := "TIME                       BAND   FREQUENCY  DAY      APPLIED  FAILED  MARKS     REASON\n" +
+		"2024-10-02T03:00:00+02:00  cheap  3200000    workday  0        0       forecast  no prices available\n"
+	if code != exitOK || out != want {
+		t.Errorf("exit code %d:\n%s\nwant\n%s", code, out, want)
+	}
+
+	// The JSON lines are those of the log
+	out, code = runEpcp(t, "decisions", "--decision-log", path, "--to", "2024-10-01 01:00", "--format", "json")
+	var d Decision
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); code != exitOK || len(lines) != 1 || json.Unmarshal([]byte(lines[0]), &d) != nil || d.Band != policy.Cheap {
+		t.Errorf("exit code %d:\n%s", code, out)
+	}
+
+	for _, args := range [][]string{{"--from", "yesterday"}, {"--tail", "-1"}, {"--format", "yaml"}} {
+		if out, code := runEpcp(t, append([]string{"decisions", "--decision-log", path}, args...)...); code != exitUsage {
+			t.Errorf("%v: exit code %d, want %d:\n%s", args, code, exitUsage, out)
+		}
+	}
+	if _, code := runEpcp(t, "decisions", "--decision-log", filepath.Join(t.TempDir(), "missing.jsonl")); code != exitFailure {
+		t.Errorf("exit code %d without the log, want %d", code, exitFailure)
+	}
+}
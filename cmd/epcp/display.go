@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// priceDisplay is how the logs, tables and messages show the prices, which
+// are EUR/MWh everywhere else: in the JSON outputs, the metrics and the
+// comparisons of the policies.
+type priceDisplay struct {
+	unit string
+	// currency is that of the costs, rate converts EUR to it
+	currency string
+	rate     float64
+	// factor converts EUR/MWh to the unit
+	factor   float64
+	decimals int
+	// group separates the thousands, point the decimals
+	group, point string
+}
+
+// display is the configured display of the prices, see OutputsConfig.
+var display = defaultDisplay()
+
+func defaultDisplay() priceDisplay {
+	return priceDisplay{unit: "EUR/MWh", currency: "EUR", rate: 1, factor: 1, decimals: 2, group: ",", point: "."}
+}
+
+// displayLocales are the separators of the thousands and the decimals by
+// locale.
+var displayLocales = map[string][2]string{
+	"en": {",", "."},
+	"cs": {" ", ","},
+	"sk": {" ", ","},
+	"de": {".", ","},
+}
+
+// newPriceDisplay returns the display of the prices in unit, EUR/MWh,
+// EUR/kWh, EURct/kWh, CZK/MWh or CZK/kWh converted with the eurCzk exchange
+// rate, formatted for locale, en by default.
+func newPriceDisplay(unit, locale string, eurCzk *float64) (priceDisplay, error) {
+	d := defaultDisplay()
+	if locale != "" {
+		separators, ok := displayLocales[locale]
+		if !ok {
+			return d, fmt.Errorf("unknown locale %q, expected one of %s", locale, strings.Join(sortedKeys(displayLocales), ", "))
+		}
+		d.group, d.point = separators[0], separators[1]
+	}
+	rate := 0.0
+	if eurCzk != nil {
+		rate = *eurCzk
+	}
+	switch unit {
+	case "", "EUR/MWh":
+		return d, nil
+	case "EUR/kWh":
+		d.factor, d.decimals = 0.001, 4
+	case "EURct/kWh":
+		d.factor, d.decimals = 0.1, 2
+	case "CZK/MWh", "CZK/kWh":
+		if rate <= 0 {
+			return d, fmt.Errorf("%s needs the source.eur_czk exchange rate", unit)
+		}
+		d.currency, d.rate, d.factor, d.decimals = "CZK", rate, rate, 0
+		if unit == "CZK/kWh" {
+			d.factor, d.decimals = rate/1000, 2
+		}
+	default:
+		return d, fmt.Errorf("unknown unit %q, expected EUR/MWh, EUR/kWh, EURct/kWh, CZK/MWh or CZK/kWh", unit)
+	}
+	d.unit = unit
+	return d, nil
+}
+
+// value formats the price in EUR/MWh in the unit, without it, e.g. for the
+// columns of the tables.
+func (d priceDisplay) value(price float64) string {
+	return d.number(price*d.factor, d.decimals)
+}
+
+// price formats the price in EUR/MWh with the unit.
+func (d priceDisplay) price(price float64) string {
+	return d.value(price) + " " + d.unit
+}
+
+// cost formats the cost in EUR in the currency of the unit.
+func (d priceDisplay) cost(cost float64) string {
+	return d.number(cost*d.rate, 2) + " " + d.currency
+}
+
+// column returns the heading of a column of prices.
+func (d priceDisplay) column() string {
+	return "PRICE (" + d.unit + ")"
+}
+
+// number formats v with the decimals and the separators of the locale.
+func (d priceDisplay) number(v float64, decimals int) string {
+	text := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	integer, fraction, _ := strings.Cut(text, ".")
+	var b strings.Builder
+	if v < 0 && strings.Trim(text, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, digit := range integer {
+		if i != 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(d.group)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(d.point + fraction)
+	}
+	return b.String()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPriceDisplay(t *testing.T) {
+	rate := 25.0
+	tests := []struct {
+		unit, locale string
+		// price and cost are 1234.5678 EUR/MWh and 12.5 EUR displayed
+		price, cost, column string
+	}{
+		{"", "", "1,234.57 EUR/MWh", "12.50 EUR", "PRICE (EUR/MWh)"},
+		{"EUR/MWh", "de", "1.234,57 EUR/MWh", "12,50 EUR", "PRICE (EUR/MWh)"},
+		{"EUR/kWh", "en", "1.2346 EUR/kWh", "12.50 EUR", "PRICE (EUR/kWh)"},
+		{"EURct/kWh", "sk", "123,46 EURct/kWh", "12,50 EUR", "PRICE (EURct/kWh)"},
+		{"CZK/MWh", "", "30,864 CZK/MWh", "312.50 CZK", "PRICE (CZK/MWh)"},
+		{"CZK/MWh", "cs", "30\u00a0864 CZK/MWh", "312,50 CZK", "PRICE (CZK/MWh)"},
+		{"CZK/kWh", "cs", "30,86 CZK/kWh", "312,50 CZK", "PRICE (CZK/kWh)"},
+	}
+	for _, test := range tests {
+		d, err := newPriceDisplay(test.unit, test.locale, &rate)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.unit, test.locale, err)
+			continue
+		}
+		if got := d.price(1234.5678); got != test.price {
+			t.Errorf("%s %s: price %q, want %q", test.unit, test.locale, got, test.price)
+		}
+		if got := d.cost(12.5); got != test.cost {
+			t.Errorf("%s %s: cost %q, want %q", test.unit, test.locale, got, test.cost)
+		}
+		if got := d.column(); got != test.column {
+			t.Errorf("%s %s: column %q, want %q", test.unit, test.locale, got, test.column)
+		}
+	}
+
+	d := defaultDisplay()
+	for v, want := range map[float64]string{
+		0:           "0.00",
+		-0.001:      "0.00",
+		-1234.5:     "-1,234.50",
+		999.999:     "1,000.00",
+		1234567.891: "1,234,567.89",
+	} {
+		if got := d.value(v); got != want {
+			t.Errorf("value %v: %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestPriceDisplayErrors(t *testing.T) {
+	zero := 0.0
+	tests := []struct {
+		unit, locale string
+		rate         *float64
+		want         string
+	}{
+		{"USD/MWh", "", nil, `unknown unit "USD/MWh", expected EUR/MWh, EUR/kWh, EURct/kWh, CZK/MWh or CZK/kWh`},
+		{"CZK/MWh", "", nil, "CZK/MWh needs the source.eur_czk exchange rate"},
+		{"CZK/kWh", "", &zero, "CZK/kWh needs the source.eur_czk exchange rate"},
+		{"", "fr", nil, `unknown locale "fr", expected one of cs, de, en, sk`},
+	}
+	for _, test := range tests {
+		if _, err := newPriceDisplay(test.unit, test.locale, test.rate); err == nil || err.Error() != test.want {
+			t.Errorf("%s %s: error %v, want %s", test.unit, test.locale, err, test.want)
+		}
+	}
+}
+
+func TestPriceDisplayKeepsJSON(t *testing.T) {
+	now := time.Now()
+	runOnMocks(t, priceFunc(func(time.Time) float64 { return 500 }))
+	logs := captureLogs(t)
+	setGlobal(t, &status, &cycleStatus{started: now, frequencies: make(map[int]int)})
+	rate := 25.0
+	d, err := newPriceDisplay("CZK/kWh", "cs", &rate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &display, d)
+
+	result := runCycle(context.Background())
+	if result.Decision == nil || result.Decision.Price == nil {
+		t.Fatalf("decision %+v, want one with the price", result.Decision)
+	}
+	if !strings.Contains(logs.String(), " Price: 12,50 CZK/kWh ") {
+		t.Errorf("the prices not displayed in CZK/kWh:\n%s", logs)
+	}
+
+	encoded, err := json.Marshal(result.Decision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decision struct {
+		Price float64 `json:"price"`
+	}
+	if err := json.Unmarshal(encoded, &decision); err != nil || decision.Price != 500 {
+		t.Errorf("decision %s, want the price in EUR/MWh", encoded)
+	}
+	_, body := get(t, statusHandler(time.Hour), "/status")
+	var res statusResponse
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Prices) == 0 || res.Prices[0] != 500 {
+		t.Errorf("/status prices %v, want those in EUR/MWh", res.Prices)
+	}
+}
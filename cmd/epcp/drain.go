@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+var (
+	drainCommand  string
+	resumeCommand string
+	drainTimeout  time.Duration
+)
+
+// drainNode drains the node in the batch system when the decision is
+// expensive and resumes it once the band recovers. Only a node epcp drained
+// itself is resumed, see State.Drained.
+func drainNode(ctx context.Context, result *cycleResult) {
+	decision := result.Decision
+	if drainCommand == "" || decision == nil {
+		return
+	}
+	price := lastPrice(result)
+	expensive := decision.Band == policy.Expensive
+	switch {
+	case expensive && !state.Drained:
+		if runSchedulerCommand(ctx, "drain", drainCommand, decision.Band, price) {
+			state.Drained = true
+		}
+	case !expensive && state.Drained:
+		if runSchedulerCommand(ctx, "resume", resumeCommand, decision.Band, price) {
+			state.Drained = false
+		}
+	}
+}
+
+// expandCommand substitutes $HOST, $BAND and $PRICE in the command template,
+// leaving other variables to the shell.
+func expandCommand(template, host, band string, price float64) string {
+	return os.Expand(template, func(name string) string {
+		switch name {
+		case "HOST":
+			return host
+		case "BAND":
+			return band
+		case "PRICE":
+			return fmt.Sprintf("%.2f", price)
+		}
+		return "${" + name + "}"
+	})
+}
+
+// runSchedulerCommand runs the expanded command template with /bin/sh and
+// reports whether it succeeded within drainTimeout. Dry and simulated runs
+// only log it.
+func runSchedulerCommand(ctx context.Context, action, template, band string, price float64) bool {
+	hostname, err := os.Hostname()
+	if err != nil {
+		errorLog(ctx).Printf("Error getting hostname: %s\n", err.Error())
+	}
+	command := expandCommand(template, hostname, band, price)
+	if dryRun || simulate {
+		infoLog(ctx).Printf("Would %s the node: %s\n", action, command)
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), drainTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	// Do not wait for children of the shell holding the output open
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		errorLog(ctx).Printf("Error running the %s command %q: %s: %s\n", action, command, err.Error(), strings.TrimSpace(string(output)))
+		return false
+	}
+	infoLog(ctx).Printf("Ran the %s command: %s\n", action, command)
+	return true
+}
@@ -0,0 +1,97 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestExpandCommand(t *testing.T) {
+	got := expandCommand("scontrol update nodename=$HOST state=drain reason=epcp-${BAND}-$PRICE home=$HOME", "node1", policy.Expensive, 123.456)
+	if want := "scontrol update nodename=node1 state=drain reason=epcp-expensive-123.46 home=${HOME}"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDrainNode(t *testing.T) {
+	logs := captureLogs(t)
+	hostname, _ := os.Hostname()
+	dir := t.TempDir()
+	invocations := filepath.Join(dir, "invocations")
+	// The stub fails while the file fail exists
+	stub := func(action string) string {
+		return "test ! -e " + filepath.Join(dir, "fail") + " && echo " + action + " $HOST $BAND $PRICE >> " + invocations
+	}
+	setGlobal(t, &drainCommand, stub("drain"))
+	setGlobal(t, &resumeCommand, stub("resume"))
+	setGlobal(t, &drainTimeout, 5*time.Second)
+	setGlobal(t, &dryRun, false)
+	setGlobal(t, &simulate, false)
+	setGlobal(t, &state, new(State))
+	cycle := func(band string) {
+		drainNode(context.Background(), &cycleResult{Prices: []float64{80, 120.5}, Decision: &Decision{Band: band}})
+	}
+	ran := func() []string {
+		content, err := os.ReadFile(invocations)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		os.Remove(invocations)
+		return strings.Fields(strings.ReplaceAll(string(content), "\n", " | "))
+	}
+
+	cycle(policy.Expensive)
+	if got, want := strings.Join(ran(), " "), "drain "+hostname+" expensive 120.50 |"; got != want || !state.Drained {
+		t.Errorf("expensive: ran %q, drained %t, want %q", got, state.Drained, want)
+	}
+	cycle(policy.Expensive)
+	if got := ran(); len(got) != 0 {
+		t.Errorf("expensive again: ran %v, want nothing", got)
+	}
+	cycle(policy.Cheap)
+	if got, want := strings.Join(ran(), " "), "resume "+hostname+" cheap 120.50 |"; got != want || state.Drained {
+		t.Errorf("cheap: ran %q, drained %t, want %q", got, state.Drained, want)
+	}
+	cycle(policy.Cheap)
+	if got := ran(); len(got) != 0 {
+		t.Errorf("cheap again: ran %v, want nothing", got)
+	}
+
+	// A failed drain is retried at the next cycle
+	if err := os.WriteFile(filepath.Join(dir, "fail"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cycle(policy.Expensive)
+	if state.Drained || !strings.Contains(logs.String(), "Error running the drain command") {
+		t.Errorf("failed drain: drained %t:\n%s", state.Drained, logs)
+	}
+	os.Remove(filepath.Join(dir, "fail"))
+	cycle(policy.Expensive)
+	if got := ran(); len(got) == 0 || got[0] != "drain" || !state.Drained {
+		t.Errorf("drain after the failure: ran %v, drained %t", got, state.Drained)
+	}
+
+	// A command running past the timeout fails
+	setGlobal(t, &resumeCommand, "sleep 10")
+	setGlobal(t, &drainTimeout, 100*time.Millisecond)
+	start := time.Now()
+	cycle(policy.Cheap)
+	if elapsed := time.Since(start); elapsed > 5*time.Second || !state.Drained {
+		t.Errorf("resume timing out: returned after %s, drained %t", elapsed, state.Drained)
+	}
+
+	// Dry runs only log the command
+	setGlobal(t, &dryRun, true)
+	setGlobal(t, &resumeCommand, stub("resume"))
+	cycle(policy.Cheap)
+	if got := ran(); len(got) != 0 || !state.Drained || !strings.Contains(logs.String(), "Would resume the node: ") {
+		t.Errorf("dry run: ran %v, drained %t:\n%s", got, state.Drained, logs)
+	}
+}
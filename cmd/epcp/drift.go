@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// reconcile re-asserts the targets changed by other agents, see checkDrift
+var reconcile bool
+
+// checkDrift compares scaling_max_freq of the CPUs with the frequency epcp
+// last wrote, before each cycle; both are kept in the state, so that one-shot
+// runs compare with the run before. A change by another agent, e.g. tuned,
+// thermald or an administrator, is logged and counted, and the observed
+// frequency becomes the baseline: the CPU keeps it until epcp decides
+// another frequency. With reconcile, the target is written back at once
+// instead.
+func checkDrift(ctx context.Context) {
+	if dryRun || paused.Load() {
+		return
+	}
+	var cpus []int
+	var writes []actuator.Write
+	for cpu, target := range state.AppliedTargets {
+		content, err := actuator.ReadFile(sysfs, cpuPath(cpu, "cpufreq", "scaling_max_freq"))
+		if err != nil {
+			continue
+		}
+		observed, err := strconv.Atoi(strings.TrimSpace(content))
+		if err != nil || observed == target || observed == state.ExternalFrequencies[cpu] {
+			continue
+		}
+		errorLog(ctx).Printf("WARNING: scaling_max_freq of cpu%d changed externally from %d to %d\n", cpu, target, observed)
+		metrics.addCounter("epcp_external_changes_total", "Number of frequencies found changed by another agent.", 1)
+		if reconcile {
+			cpus = append(cpus, cpu)
+			writes = append(writes, actuator.Write{Path: cpuPath(cpu, "cpufreq", "scaling_max_freq"), Value: strconv.Itoa(target)})
+		} else {
+			if state.ExternalFrequencies == nil {
+				state.ExternalFrequencies = make(map[int]int)
+			}
+			state.ExternalFrequencies[cpu] = observed
+		}
+	}
+	for i, err := range frequencyActuator.Apply(context.WithoutCancel(ctx), writes) {
+		if err != nil {
+			errorLog(ctx).Printf("Error writing frequency %s to path %s: %s\n", writes[i].Value, writes[i].Path, err.Error())
+		} else {
+			infoLog(ctx).Printf("Reasserted frequency %s of cpu%d\n", writes[i].Value, cpus[i])
+		}
+	}
+}
+
+// leftExternal reports whether the CPU keeps the frequency another agent
+// set, as the target is the one epcp wrote before. Otherwise the CPU is
+// scaled again.
+func leftExternal(cpu, target int) bool {
+	if _, ok := state.ExternalFrequencies[cpu]; !ok {
+		return false
+	}
+	if state.AppliedTargets[cpu] == target {
+		return true
+	}
+	delete(state.ExternalFrequencies, cpu)
+	return false
+}
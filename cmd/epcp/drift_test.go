@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestDrift(t *testing.T) {
+	now := time.Now()
+	tree := runOnMocks(t, trend(now, 10))
+	logs := captureLogs(t)
+	setGlobal(t, &reconcile, false)
+	maxFreq := func(cpu int) string { return readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")) }
+	cycle := func() *Decision {
+		t.Helper()
+		result := runCycle(context.Background())
+		if result.Decision == nil {
+			t.Fatalf("no decision:\n%s", logs)
+		}
+		return result.Decision
+	}
+
+	cycle()
+	if maxFreq(0) != "800000" || maxFreq(1) != "800000" {
+		t.Fatalf("scaling_max_freq %s and %s, want 800000", maxFreq(0), maxFreq(1))
+	}
+
+	// Another agent raises cpu0 between the cycles: it keeps the frequency
+	actuator.WriteFile(tree, cpuPath(0, "cpufreq", "scaling_max_freq"), "2400000")
+	decision := cycle()
+	if maxFreq(0) != "2400000" || maxFreq(1) != "800000" {
+		t.Errorf("scaling_max_freq %s and %s after the external change, want 2400000 and 800000", maxFreq(0), maxFreq(1))
+	}
+	if len(decision.Summary.External) != 1 || decision.Summary.External[0] != 0 {
+		t.Errorf("summary %+v, want cpu0 left to another agent", decision.Summary)
+	}
+	if n := strings.Count(logs.String(), "WARNING: scaling_max_freq of cpu0 changed externally from 800000 to 2400000"); n != 1 {
+		t.Errorf("the change logged %d times, want once:\n%s", n, logs)
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	if !strings.Contains(exposition.String(), "epcp_external_changes_total 1\n") {
+		t.Errorf("the change not counted:\n%s", exposition.String())
+	}
+
+	// The observed frequency is the baseline: it is not reported again
+	cycle()
+	if n := strings.Count(logs.String(), "changed externally"); n != 1 || maxFreq(0) != "2400000" {
+		t.Errorf("the change reported %d times, scaling_max_freq %s, want once and kept", n, maxFreq(0))
+	}
+
+	// until epcp decides another frequency
+	priceSource = trend(now, -10)
+	if decision := cycle(); decision.Band != policy.Cheap || maxFreq(0) != "3200000" || len(decision.Summary.External) != 0 {
+		t.Errorf("band %s, scaling_max_freq %s, summary %+v, want cpu0 scaled again", decision.Band, maxFreq(0), decision.Summary)
+	}
+	if len(state.ExternalFrequencies) != 0 {
+		t.Errorf("external frequencies %v, want none", state.ExternalFrequencies)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	tree := runOnMocks(t, trend(time.Now(), 10))
+	logs := captureLogs(t)
+	setGlobal(t, &reconcile, true)
+	runCycle(context.Background())
+	actuator.WriteFile(tree, cpuPath(1, "cpufreq", "scaling_max_freq"), "1600000")
+
+	checkDrift(context.Background())
+	if got := readSysfs(t, tree, cpuPath(1, "cpufreq", "scaling_max_freq")); got != "800000" {
+		t.Errorf("scaling_max_freq %s after reconciling, want the target 800000 back", got)
+	}
+	for _, want := range []string{"WARNING: scaling_max_freq of cpu1 changed externally from 800000 to 1600000", "Reasserted frequency 800000 of cpu1"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("%q not logged:\n%s", want, logs)
+		}
+	}
+	if len(state.ExternalFrequencies) != 0 {
+		t.Errorf("external frequencies %v, want none when reconciling", state.ExternalFrequencies)
+	}
+}
+
+func TestDriftAfterRestore(t *testing.T) {
+	for _, reconciling := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reconcile=%t", reconciling), func(t *testing.T) {
+			tree := runOnMocks(t, trend(time.Now(), 10))
+			logs := captureLogs(t)
+			setGlobal(t, &reconcile, reconciling)
+			t.Cleanup(func() { paused.Store(false) })
+			runCycle(context.Background())
+
+			// ctl restore, then ctl resume
+			runControlCommand(controlCommand{name: "restore", done: make(chan struct{})}, nil)
+			if got := readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")); got != "3200000" {
+				t.Fatalf("scaling_max_freq %s after the restore, want 3200000", got)
+			}
+			handleControl("resume", nil)
+			decision := runCycle(context.Background()).Decision
+			if strings.Contains(logs.String(), "changed externally") {
+				t.Errorf("the restore reported as an external change:\n%s", logs)
+			}
+			var exposition strings.Builder
+			metrics.write(&exposition)
+			if strings.Contains(exposition.String(), "epcp_external_changes_total") {
+				t.Errorf("the restore counted as an external change:\n%s", exposition.String())
+			}
+			for cpu := range 2 {
+				if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != "800000" {
+					t.Errorf("cpu%d: scaling_max_freq %s after resuming, want 800000 scaled again", cpu, got)
+				}
+			}
+			if decision == nil || len(decision.Summary.External) != 0 {
+				t.Errorf("decision %+v, want no CPU left to another agent", decision)
+			}
+		})
+	}
+}
+
+func TestDriftBetweenOneShotRuns(t *testing.T) {
+	tree := runOnMocks(t, trend(time.Now(), 10))
+	logs := captureLogs(t)
+	setGlobal(t, &reconcile, false)
+	if code := runCycles(false); code != exitOK {
+		t.Fatalf("exit code %d, want %d", code, exitOK)
+	}
+
+	// Another agent raises cpu0 before the next run, which starts afresh
+	actuator.WriteFile(tree, cpuPath(0, "cpufreq", "scaling_max_freq"), "2400000")
+	state = new(State)
+	if code := runCycles(false); code != exitOK {
+		t.Fatalf("exit code %d, want %d", code, exitOK)
+	}
+	if !strings.Contains(logs.String(), "WARNING: scaling_max_freq of cpu0 changed externally from 800000 to 2400000") {
+		t.Errorf("the change between the runs not logged:\n%s", logs)
+	}
+	if got := readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")); got != "2400000" {
+		t.Errorf("scaling_max_freq %s, want the 2400000 of the other agent kept", got)
+	}
+}
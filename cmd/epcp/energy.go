@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/rapl"
+)
+
+// energyDaysKept is how many days of measured energy the state keeps.
+const energyDaysKept = 8
+
+// energyTotals is the energy measured in a band and its cost.
+type energyTotals struct {
+	KWh float64 `json:"kwh"`
+	// Cost is in the currency of the prices, EUR by default
+	Cost float64 `json:"cost"`
+}
+
+// energyDays maps the market days to the energy measured per band.
+type energyDays map[string]map[string]energyTotals
+
+// energyInterval is what governed the node since the last cycle, to which the
+// energy measured until the next one is attributed.
+type energyInterval struct {
+	start time.Time
+	band  string
+	price float64
+}
+
+var (
+	// measureEnergy enables the RAPL measurement, see OutputsConfig
+	measureEnergy bool
+	raplMeter     *rapl.Meter
+	// energyCurrent is the band and price of the running interval
+	energyCurrent *energyInterval
+)
+
+// accountEnergy attributes the energy the CPU packages consumed since the last
+// cycle to the band and price decided then, accumulating kWh and cost per
+// band and market day, the day the interval started. It then starts the
+// interval of the decision of this cycle. A cycle without a decision keeps the
+// band and price of the last one. The first cycle only starts measuring.
+func accountEnergy(ctx context.Context, result *cycleResult) {
+	if !measureEnergy {
+		return
+	}
+	if raplMeter == nil {
+		zones, err := rapl.Zones(sysfs, sysfsRoot)
+		if err == nil && len(zones) == 0 {
+			err = fmt.Errorf("no RAPL package zones under %s", sysfsPath("class", "powercap"))
+		}
+		if err != nil {
+			errorLog(ctx).Printf("WARNING: cannot measure the energy, disabling it: %s\n", err.Error())
+			measureEnergy = false
+			return
+		}
+		raplMeter = &rapl.Meter{FS: sysfs, Zones: zones}
+	}
+	now := cycleClock.Now()
+	joules, ok, err := raplMeter.Sample()
+	switch {
+	case err != nil:
+		errorLog(ctx).Printf("Error reading the RAPL counters: %s\n", err.Error())
+	case ok && energyCurrent != nil:
+		addEnergy(ote.Day(energyCurrent.start), energyCurrent.band, joules/3.6e6, energyCurrent.price)
+	}
+	if decision := result.Decision; decision != nil {
+		energyCurrent = &energyInterval{start: now, band: decision.Band, price: lastPrice(result)}
+	} else if energyCurrent != nil {
+		energyCurrent.start = now
+	}
+	summarizeEnergy(ote.Day(now))
+	status.setEnergy(energyStatusOf(state.Energy))
+}
+
+// addEnergy adds the kWh consumed at price, in EUR/MWh, to the totals of
+// the band on the day.
+func addEnergy(day, band string, kwh, price float64) {
+	if state.Energy == nil {
+		state.Energy = make(map[string]map[string]*energyTotals)
+	}
+	if state.Energy[day] == nil {
+		state.Energy[day] = make(map[string]*energyTotals)
+	}
+	totals := state.Energy[day][band]
+	if totals == nil {
+		totals = new(energyTotals)
+		state.Energy[day][band] = totals
+	}
+	cost := kwh * price / 1000
+	totals.KWh += kwh
+	totals.Cost += cost
+	metrics.addCounter("epcp_energy_kwh_total", "Energy measured by RAPL by band, in kWh.", kwh, "band", band)
+	metrics.addCounter("epcp_energy_cost_total", "Cost of the energy measured by RAPL by band.", cost, "band", band)
+}
+
+// summarizeEnergy logs the totals of the days before today not summarized
+// yet, once, and drops the days beyond energyDaysKept.
+func summarizeEnergy(today string) {
+	days := sortedKeys(state.Energy)
+	for i, day := range days {
+		if i < len(days)-energyDaysKept {
+			delete(state.Energy, day)
+			continue
+		}
+		if day >= today || state.EnergySummarized >= day {
+			continue
+		}
+		infoLogger.Printf("Energy measured on %s: %s\n", day, energySummary(state.Energy[day]))
+		state.EnergySummarized = day
+	}
+}
+
+// energySummary returns the one-line summary of the totals of a day.
+func energySummary(bands map[string]*energyTotals) string {
+	var parts []string
+	var kwh, cost float64
+	for _, band := range sortedKeys(bands) {
+		t := bands[band]
+		parts = append(parts, fmt.Sprintf("%s %.3f kWh for %s", band, t.KWh, display.cost(t.Cost)))
+		kwh, cost = kwh+t.KWh, cost+t.Cost
+	}
+	return fmt.Sprintf("%.3f kWh for %s (%s)", kwh, display.cost(cost), strings.Join(parts, ", "))
+}
+
+// energyStatusOf copies the totals for the status endpoint.
+func energyStatusOf(days map[string]map[string]*energyTotals) energyDays {
+	copied := make(energyDays, len(days))
+	for day, bands := range days {
+		copied[day] = make(map[string]energyTotals, len(bands))
+		for band, t := range bands {
+			copied[day][band] = *t
+		}
+	}
+	return copied
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestAccountEnergy(t *testing.T) {
+	// The counter wraps around at 10^13 µJ, a kWh being 3.6*10^12 µJ
+	counter := actuator.Path("/sys", "class", "powercap", "intel-rapl:0", "energy_uj")
+	files := sysfsFiles(1)
+	files[actuator.Path("/sys", "class", "powercap", "intel-rapl:0", "name")] = "package-0\n"
+	files[actuator.Path("/sys", "class", "powercap", "intel-rapl:0", "max_energy_range_uj")] = "10000000000000\n"
+	files[counter] = "9000000000000\n"
+	tree := actuator.NewMemFS(files)
+	useSysfs(t, tree)
+	logs := captureLogs(t)
+	fixed := &fixedClock{}
+	setGlobal[clock](t, &cycleClock, fixed)
+	setGlobal(t, &measureEnergy, true)
+	setGlobal(t, &raplMeter, nil)
+	setGlobal(t, &energyCurrent, nil)
+	setGlobal(t, &status, &cycleStatus{started: time.Now(), frequencies: make(map[int]int)})
+
+	cycles := []struct {
+		at      string
+		counter uint64
+		// band and price are those decided, none when band is ""
+		band  string
+		price float64
+	}{
+		{"2024-10-01T22:00:00+02:00", 9000000000000, policy.Expensive, 120},
+		// 1 kWh in the expensive band, the counter wrapping around
+		{"2024-10-01T23:00:00+02:00", 2600000000000, policy.Cheap, 50},
+		// 2 kWh in the cheap band, attributed to the day the hour started
+		{"2024-10-02T00:00:00+02:00", 9800000000000, "", 0},
+		// 1 kWh still in the cheap band without a decision
+		{"2024-10-02T01:00:00+02:00", 3400000000000, "", 0},
+	}
+	for _, c := range cycles {
+		at, err := time.Parse(time.RFC3339, c.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fixed.now = at
+		if err := tree.Write(counter, []byte(strconv.FormatUint(c.counter, 10)+"\n")); err != nil {
+			t.Fatal(err)
+		}
+		result := new(cycleResult)
+		if c.band != "" {
+			result.Decision = &Decision{Time: at, Band: c.band}
+			result.Prices = []float64{c.price}
+		}
+		accountEnergy(context.Background(), result)
+	}
+
+	want := map[string]map[string]energyTotals{
+		"2024-10-01": {policy.Expensive: {KWh: 1, Cost: 0.12}, policy.Cheap: {KWh: 2, Cost: 0.1}},
+		"2024-10-02": {policy.Cheap: {KWh: 1, Cost: 0.05}},
+	}
+	if len(state.Energy) != len(want) {
+		t.Fatalf("energy of the days %v, want %v", sortedKeys(state.Energy), sortedKeys(want))
+	}
+	for day, bands := range want {
+		for band, w := range bands {
+			got := state.Energy[day][band]
+			if got == nil || !near(got.KWh, w.KWh) || !near(got.Cost, w.Cost) {
+				t.Errorf("%s %s: %+v, want %+v", day, band, got, w)
+			}
+		}
+	}
+	if got := status.snapshot().Energy; len(got) != 2 || !near(got[ote.Day(fixed.now)][policy.Cheap].KWh, 1) {
+		t.Errorf("status energy %+v", got)
+	}
+
+	// The day is summarized once the next one started
+	summary := "Energy measured on 2024-10-01: 3.000 kWh for 0.22 EUR (cheap 2.000 kWh for 0.10 EUR, expensive 1.000 kWh for 0.12 EUR)\n"
+	if n := strings.Count(logs.String(), summary); n != 1 || state.EnergySummarized != "2024-10-01" {
+		t.Errorf("summary logged %d times, summarized %q:\n%s", n, state.EnergySummarized, logs)
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	for _, want := range []string{`epcp_energy_kwh_total{band="cheap"} 3`, `epcp_energy_kwh_total{band="expensive"} 1`} {
+		if !strings.Contains(exposition.String(), want+"\n") {
+			t.Errorf("metrics without %s:\n%s", want, exposition.String())
+		}
+	}
+}
+
+func TestAccountEnergyWithoutRAPL(t *testing.T) {
+	useSysfs(t, actuator.NewMemFS(sysfsFiles(1)))
+	logs := captureLogs(t)
+	setGlobal(t, &measureEnergy, true)
+	setGlobal(t, &raplMeter, nil)
+	accountEnergy(context.Background(), new(cycleResult))
+	if measureEnergy || !strings.Contains(logs.String(), "WARNING: cannot measure the energy, disabling it: no RAPL package zones under /sys/class/powercap") {
+		t.Errorf("measuring %t:\n%s", measureEnergy, logs)
+	}
+}
+
+// near reports whether a and b differ only by rounding.
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// legacyEnv maps the settings read without the EPCP_ prefix in the past to
+// their old names, which are still accepted.
+var legacyEnv = map[string]string{
+	"EPCP_HOURS": "HOURS",
+	"EPCP_WSDL":  "WSDL",
+}
+
+var (
+	legacyWarnedMu sync.Mutex
+	legacyWarned   = map[string]bool{}
+)
+
+// getenv returns the environment variable name of a setting. When it is not
+// set, the legacy name is used with a deprecation warning, logged once.
+func getenv(name string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	legacy, ok := legacyEnv[name]
+	if !ok {
+		return ""
+	}
+	value, ok := os.LookupEnv(legacy)
+	if !ok {
+		return ""
+	}
+	legacyWarnedMu.Lock()
+	defer legacyWarnedMu.Unlock()
+	if !legacyWarned[legacy] {
+		legacyWarned[legacy] = true
+		infoLogger.Printf("%s is deprecated, use %s instead.\n", legacy, name)
+	}
+	return value
+}
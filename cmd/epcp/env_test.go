@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// unsetenv unsets the environment variable name for the length of the test.
+func unsetenv(t *testing.T, name string) {
+	t.Helper()
+	t.Setenv(name, "")
+	os.Unsetenv(name)
+}
+
+func TestGetenv(t *testing.T) {
+	logs := captureLogs(t)
+	setGlobal(t, &legacyWarned, map[string]bool{})
+
+	// The prefixed name comes first, without a warning
+	t.Setenv("EPCP_HOURS", "6")
+	t.Setenv("HOURS", "3")
+	if got := getenv("EPCP_HOURS"); got != "6" {
+		t.Errorf("EPCP_HOURS next to HOURS: got %q, want 6", got)
+	}
+	if logs.String() != "" {
+		t.Errorf("logged %q, want nothing", logs)
+	}
+
+	// The legacy name is used with a warning logged once
+	t.Setenv("EPCP_HOURS", "")
+	if got := getenv("EPCP_HOURS"); got != "" {
+		t.Errorf("empty EPCP_HOURS: got %q, want it to take precedence", got)
+	}
+	unsetenv(t, "EPCP_HOURS")
+	for i := 0; i < 3; i++ {
+		if got := getenv("EPCP_HOURS"); got != "3" {
+			t.Errorf("HOURS: got %q, want 3", got)
+		}
+	}
+	if n := strings.Count(logs.String(), "HOURS is deprecated, use EPCP_HOURS instead."); n != 1 {
+		t.Errorf("warned %d times, want once:\n%s", n, logs)
+	}
+
+	// Settings without a legacy name do not fall back
+	t.Setenv("STRICT", "1")
+	unsetenv(t, "EPCP_STRICT")
+	if got := getenv("EPCP_STRICT"); got != "" {
+		t.Errorf("EPCP_STRICT falls back to STRICT: %q", got)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+func TestNextCycle(t *testing.T) {
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, ote.Location())
+	}
+	tests := []struct {
+		name             string
+		now              time.Time
+		interval, offset time.Duration
+		want             time.Time
+	}{
+		{"on the hour", at(time.June, 12, 10, 0), time.Hour, 4 * time.Minute, at(time.June, 12, 10, 4)},
+		{"at the offset", at(time.June, 12, 10, 4), time.Hour, 4 * time.Minute, at(time.June, 12, 11, 4)},
+		{"within the hour", at(time.June, 12, 10, 30), time.Hour, 4 * time.Minute, at(time.June, 12, 11, 4)},
+		{"no offset", at(time.June, 12, 10, 30), time.Hour, 0, at(time.June, 12, 11, 0)},
+		{"quarter hours", at(time.June, 12, 10, 20), 15 * time.Minute, 4 * time.Minute, at(time.June, 12, 10, 34)},
+		{"midnight", at(time.June, 12, 23, 30), time.Hour, 4 * time.Minute, at(time.June, 13, 0, 4)},
+		// 02:00 CET is 03:00 CEST
+		{"spring forward", at(time.March, 31, 1, 30), time.Hour, 4 * time.Minute, at(time.March, 31, 3, 4)},
+		// 03:00 CEST is 02:00 CET, the hour from 02:00 repeats
+		{"fall back", at(time.October, 27, 2, 30), time.Hour, 4 * time.Minute, at(time.October, 27, 2, 30).Add(34 * time.Minute)},
+	}
+	for _, test := range tests {
+		if got := nextCycle(test.now, test.interval, test.offset); !got.Equal(test.want) {
+			t.Errorf("%s: next cycle %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEvalOffsetSchedule(t *testing.T) {
+	tests := []struct {
+		name  string
+		start time.Time
+		// want are the times of the cycles after the first, in the
+		// market time zone
+		want []string
+	}{
+		{"spring forward", time.Date(2024, time.March, 31, 0, 30, 0, 0, ote.Location()),
+			[]string{"01:04 CET", "03:04 CEST", "04:04 CEST", "05:04 CEST", "06:04 CEST"}},
+		{"fall back", time.Date(2024, time.October, 27, 0, 30, 0, 0, ote.Location()),
+			[]string{"01:04 CEST", "02:04 CEST", "02:04 CET", "03:04 CET", "04:04 CET"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runOnMocks(t, trend(test.start, 10))
+			captureLogs(t)
+			setGlobal(t, &status, &cycleStatus{started: test.start, frequencies: make(map[int]int)})
+			setGlobal(t, &jitter, 0)
+			setGlobal(t, &evalOffset, 4*time.Minute)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// The clock stops before the cycle planned after end
+			end := test.start.Add(5 * time.Hour)
+			setGlobal[clock](t, &cycleClock, newSimulatedClock(test.start, end, 1e6, 1, cancel))
+
+			var cycles []string
+			runLoop(ctx, time.Hour, nil, func(result *cycleResult) {
+				now := cycleClock.Now()
+				// The first cycle runs at the start, the next ones at the offset
+				if next := status.snapshot().NextCycle; next == nil || !next.Equal(now) {
+					t.Errorf("cycle at %s, planned at %v", now, next)
+				}
+				if now.Equal(test.start) {
+					return
+				}
+				if result.Decision == nil || !result.Decision.Time.Equal(now) {
+					t.Errorf("decision %+v of the cycle at %s", result.Decision, now)
+				}
+				cycles = append(cycles, now.In(ote.Location()).Format("15:04 MST"))
+			})
+			if len(cycles) != len(test.want) {
+				t.Fatalf("cycles at %v, want %v", cycles, test.want)
+			}
+			for i, want := range test.want {
+				if cycles[i] != want {
+					t.Errorf("cycle %d at %s, want %s", i+1, cycles[i], want)
+				}
+			}
+
+			_, body := get(t, statusHandler(time.Hour), "/status")
+			var res statusResponse
+			if err := json.Unmarshal([]byte(body), &res); err != nil {
+				t.Fatal(err)
+			}
+			if want := end.Add(34 * time.Minute); res.NextCycle == nil || !res.NextCycle.Equal(want) {
+				t.Errorf("/status next cycle %v, want %s", res.NextCycle, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+// exitCode is the exit status of the process, see README.md.
+type exitCode int
+
+const (
+	// exitOK means the prices were fetched and the decision applied, or
+	// the run was stopped while waiting for the lock.
+	exitOK exitCode = 0
+	// exitFailure means a command other than a cycle failed, or the lock
+	// could not be taken for another reason than another instance holding
+	// it, see the log.
+	exitFailure exitCode = 1
+	// exitUsage means the command line was invalid.
+	exitUsage exitCode = 2
+	// exitFetchFailed means the prices could not be fetched.
+	exitFetchFailed exitCode = 10
+	// exitApplyFailed means no CPU accepted the decided frequency, or in
+	// strict mode (EPCP_STRICT) that at least one CPU rejected it.
+	exitApplyFailed exitCode = 20
+	// exitInsufficientData means too few prices were published to decide.
+	exitInsufficientData exitCode = 30
+	// exitLocked is returned when another instance holds the lock (EX_TEMPFAIL).
+	exitLocked exitCode = 75
+	// exitPreflight is returned when the preflight checks fail (EX_NOPERM).
+	exitPreflight exitCode = 77
+	// exitConfig is returned when the configuration is invalid (EX_CONFIG).
+	exitConfig exitCode = 78
+)
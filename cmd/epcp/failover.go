@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/failover"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+const (
+	// defaultFailoverFailures mark a source unhealthy, see SourceConfig
+	defaultFailoverFailures = 3
+	// defaultFailoverProbe is how long an unhealthy source is skipped
+	defaultFailoverProbe = 10 * time.Minute
+)
+
+// sourceFailover serves the prices when source.failover lists several
+// sources, nil otherwise.
+var sourceFailover *failover.Source
+
+// sourcesStatus is the state of the failover sources in /status.
+type sourcesStatus struct {
+	Active string            `json:"active"`
+	Health []failover.Health `json:"health"`
+}
+
+// failoverSource returns the source serving the prices from the first
+// healthy of the failover sources, converted to EUR/MWh.
+func (c SourceConfig) failoverSource() (ote.PriceSource, error) {
+	var members []failover.Member
+	for _, name := range c.Failover {
+		member := c
+		member.Type, member.Failover = name, nil
+		source, err := member.priceSource()
+		if err != nil {
+			return nil, fmt.Errorf("%s source: %w", name, err)
+		}
+		factor, err := c.priceFactor(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s source: %w", name, err)
+		}
+		members = append(members, failover.Member{Name: name, Source: source, Factor: factor})
+	}
+	failures := c.FailoverFailures
+	if failures == 0 {
+		failures = defaultFailoverFailures
+	}
+	probe, err := time.ParseDuration(c.FailoverProbe)
+	if err != nil {
+		probe = defaultFailoverProbe
+	}
+	s := failover.New(members, failures, probe)
+	s.Now = func() time.Time { return cycleClock.Now() }
+	s.OnSwitch = func(from, to string, err error) {
+		if err != nil {
+			errorLogger.Printf("WARNING: the %s source failed (%s), failing over to the %s source\n", from, err.Error(), to)
+		} else {
+			infoLogger.Printf("The prices come from the %s source again instead of %s\n", to, from)
+		}
+		metrics.addCounter("epcp_source_failovers_total", "Number of switches between the price sources.", 1, "from", from, "to", to)
+	}
+	sourceFailover = s
+	return s, nil
+}
+
+// recordSourceMetrics exports the active failover source and the health of
+// each.
+func recordSourceMetrics() {
+	if sourceFailover == nil {
+		return
+	}
+	metrics.resetGauge("epcp_source_active", "Price source that served the last prices.")
+	if active := sourceFailover.Active(); active != "" {
+		metrics.setGauge("epcp_source_active", "Price source that served the last prices.", 1, "source", active)
+	}
+	for _, h := range sourceFailover.Health() {
+		healthy := 0.0
+		if h.Healthy {
+			healthy = 1
+		}
+		metrics.setGauge("epcp_source_healthy", "Whether the price source is healthy.", healthy, "source", h.Name)
+	}
+}
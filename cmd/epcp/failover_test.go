@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+func TestSourceFailover(t *testing.T) {
+	now := time.Date(2024, time.October, 1, 13, 0, 0, 0, ote.Location())
+	mock := otetest.NewServer(otetest.Points("2024-10-01", 1, 90, 95, 100))
+	defer mock.Close()
+	target, err := url.Parse(mock.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	var down atomic.Bool
+	down.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	logs := captureLogs(t)
+	fixed := &fixedClock{now}
+	setGlobal[clock](t, &cycleClock, fixed)
+	setGlobal(t, &oteLimiter, &spacingLimiter{})
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	setGlobal(t, &sourceFailover, nil)
+	config := SourceConfig{Type: "ote", WSDL: server.URL, Failover: []string{"ote", "synthetic"}, FailoverFailures: 1, FailoverProbe: "5m"}
+	source, err := config.priceSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exposition := func() string {
+		t.Helper()
+		recordSourceMetrics()
+		var b strings.Builder
+		if err := metrics.write(&b); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	// OTE is down, the synthetic prices are served
+	if points, err := source.ImPrices(context.Background(), "2024-10-01", 1, 3); err != nil || len(points) != 3 {
+		t.Fatalf("points %v, %v, want the synthetic prices", points, err)
+	}
+	if !strings.Contains(logs.String(), "WARNING: the ote source failed (") || !strings.Contains(logs.String(), "failing over to the synthetic source") {
+		t.Errorf("the failover not logged:\n%s", logs)
+	}
+	out := exposition()
+	for _, want := range []string{
+		`epcp_source_failovers_total{from="ote",to="synthetic"} 1`,
+		`epcp_source_active{source="synthetic"} 1`,
+		`epcp_source_healthy{source="ote"} 0`,
+		`epcp_source_healthy{source="synthetic"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics without %s:\n%s", want, out)
+		}
+	}
+
+	// Once it is up, OTE is probed after the configured time
+	down.Store(false)
+	fixed.now = now.Add(5 * time.Minute)
+	points, err := source.ImPrices(context.Background(), "2024-10-01", 1, 3)
+	if err != nil || len(points) != 3 || points[0].Price != 90 || points[2].Price != 100 {
+		t.Fatalf("points %v, %v, want those of OTE", points, err)
+	}
+	if !strings.Contains(logs.String(), "INFO: The prices come from the ote source again instead of synthetic") {
+		t.Errorf("the recovery not logged:\n%s", logs)
+	}
+	out = exposition()
+	for _, want := range []string{
+		`epcp_source_failovers_total{from="synthetic",to="ote"} 1`,
+		`epcp_source_active{source="ote"} 1`,
+		`epcp_source_healthy{source="ote"} 1`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics without %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `epcp_source_active{source="synthetic"}`) {
+		t.Errorf("the synthetic source still active:\n%s", out)
+	}
+}
+
+func TestFailoverMarketsInEur(t *testing.T) {
+	// OTE answers the day-ahead prices in CZK at 25 CZK/EUR unless asked
+	// for EUR
+	mock := otetest.NewCurrencyServer(otetest.Points("2024-10-01", 1, 90, 95, 100), 25)
+	defer mock.Close()
+	setGlobal(t, &oteLimiter, &spacingLimiter{})
+	setGlobal(t, &sourceFailover, nil)
+	config := SourceConfig{Type: "ote", WSDL: mock.URL, Failover: []string{"ote", "synthetic"}}
+	source, err := config.priceSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both markets are in EUR/MWh, converted by the same factor
+	intraday, err := source.ImPrices(context.Background(), "2024-10-01", 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dayAhead, err := source.DamPrices(context.Background(), "2024-10-01", "2024-10-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ote.Prices(dayAhead), ote.Prices(intraday); !slices.Equal(got, want) || want[2] != 100 {
+		t.Errorf("day-ahead prices %v, intraday %v, want both [90 95 100]", got, want)
+	}
+
+	eurCzk := 25.0
+	config.Units, config.EurCzk = map[string]string{"ote": "CZK/MWh"}, &eurCzk
+	if _, err := config.priceSource(); err == nil || !strings.Contains(err.Error(), "the prices of OTE are in EUR/MWh, not CZK/MWh") {
+		t.Errorf("OTE in CZK/MWh: error %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/fault"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+// injectFaults wraps the price source, sysfs and the clock of a simulation
+// from from to to into the faults of the scenario, see FaultConfig, timed on
+// base, the clock of the simulation. When a fault targets the prices, they
+// are served over HTTP to an OTE client, so that the client and its errors
+// are part of the run; the server serves the intraday prices of the source
+// for both markets. lift lifts the faults, before the shutdown, and closes
+// the server.
+func injectFaults(ctx context.Context, s *Scenario, from, to time.Time, base clock) (lift func(), err error) {
+	lifted := new(fault.Toggle)
+	window := func(f FaultConfig) fault.Switch {
+		at, _ := time.ParseDuration(f.At)
+		d, _ := time.ParseDuration(f.For)
+		on := fault.Window(base, from.Add(at), d)
+		return func() bool { return !lifted.On() && on() }
+	}
+	var transport http.RoundTripper = http.DefaultTransport
+	var empty []fault.Switch
+	served := false
+	for _, f := range s.Faults {
+		switch f.Target + " " + f.Mode {
+		case "prices down":
+			transport = &fault.Transport{Base: transport, Down: window(f)}
+		case "prices unavailable":
+			transport = &fault.Transport{Base: transport, Unavailable: window(f)}
+		case "prices empty":
+			empty = append(empty, window(f))
+		case "sysfs read-only":
+			sysfs = &fault.Filesystem{Filesystem: sysfs, ReadOnly: window(f)}
+		case "sysfs failing":
+			sysfs = &fault.Filesystem{Filesystem: sysfs, Failing: window(f)}
+		default:
+			jump, _ := time.ParseDuration(f.Jump)
+			cycleClock = &fault.JumpingClock{Base: cycleClock, Jump: jump, When: window(f)}
+		}
+		served = served || f.Target == "prices"
+	}
+	lift = func() { lifted.Set(true) }
+	if !served {
+		return lift, nil
+	}
+	var points []ote.PricePoint
+	err = ote.EachDay(ote.Day(from.Add(-historyWindow).AddDate(0, 0, -1)), ote.Day(to.AddDate(0, 0, 2)), func(day string, hours int) error {
+		dayPoints, err := priceSource.ImPrices(ctx, day, 1, hours)
+		if e.Is(err, ote.ErrNoData) {
+			return nil
+		}
+		points = append(points, dayPoints...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	server := otetest.NewServer(points)
+	priceSource = ote.NewClient(ote.WithEndpoint(server.URL), ote.WithHTTPClient(newHTTPClient(transport, 0)))
+	for _, on := range empty {
+		priceSource = &fault.Source{Base: priceSource, Empty: on}
+	}
+	infoLogger.Printf("Serving the prices of the simulation at %s\n", server.URL)
+	return func() {
+		lifted.Set(true)
+		server.Close()
+	}, nil
+}
+
+// invariants checks that the daemon copes with the faults of a simulation:
+// that it applies no decision made without prices other than in the safe
+// mode, changes the band at most once per cooldown and restores the
+// frequencies on shutdown. The times are those of base, the clock of the
+// simulation, whatever the faults make of it.
+type invariants struct {
+	base     clock
+	cooldown time.Duration
+	// band is that of the last decision and changed the time it changed
+	band       string
+	changed    time.Time
+	violations []string
+}
+
+func (v *invariants) violate(format string, args ...any) {
+	violation := v.base.Now().Format(time.RFC3339) + ": " + fmt.Sprintf(format, args...)
+	errorLogger.Printf("Invariant violated at %s\n", violation)
+	v.violations = append(v.violations, violation)
+}
+
+// check checks the decision of a cycle.
+func (v *invariants) check(result *cycleResult) {
+	decision := result.Decision
+	if decision == nil {
+		return
+	}
+	if len(result.Prices) == 0 && decision.SafeMode == "" {
+		v.violate("applied the %s band without prices", decision.Band)
+	}
+	now := v.base.Now()
+	if v.band != "" && decision.Band != v.band {
+		if since := now.Sub(v.changed); since < v.cooldown {
+			v.violate("changed from the %s band to the %s band %s after the previous change", v.band, decision.Band, since)
+		}
+		v.changed = now
+	}
+	v.band = decision.Band
+}
+
+// checkRestored checks that the scaling_max_freq files of the tree hold
+// their originals, read before the simulation, after the shutdown.
+func (v *invariants) checkRestored(tree actuator.Filesystem, originals map[string]string) {
+	for _, path := range sortedKeys(originals) {
+		content, err := actuator.ReadFile(tree, path)
+		if err != nil || strings.TrimSpace(content) != strings.TrimSpace(originals[path]) {
+			v.violate("%s not restored on shutdown", path)
+		}
+	}
+}
+
+// print writes the violations to w and returns exitFailure if there are
+// any.
+func (v *invariants) print(w io.Writer, faults int) exitCode {
+	if len(v.violations) == 0 {
+		if faults != 0 {
+			fmt.Fprintf(w, "%d faults injected, all invariants held\n", faults)
+		}
+		return exitOK
+	}
+	fmt.Fprintf(w, "%d invariants violated:\n", len(v.violations))
+	for _, violation := range v.violations {
+		fmt.Fprintf(w, "  %s\n", violation)
+	}
+	return exitFailure
+}
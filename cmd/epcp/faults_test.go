@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestFaultScenarios(t *testing.T) {
+	tests := []struct {
+		scenario string
+		faults   string
+	}{
+		{filepath.Join("..", "..", "examples", "scenarios", "chaos-prices.yaml"), "6"},
+		{filepath.Join("..", "..", "examples", "scenarios", "chaos-sysfs.yaml"), "3"},
+		{filepath.Join("testdata", "chaos-dst.yaml"), "7"},
+	}
+	for _, test := range tests {
+		t.Run(filepath.Base(test.scenario), func(t *testing.T) {
+			out, code := runEpcp(t, "simulate", "--scenario", test.scenario, "--speed", "10000000")
+			if code != exitOK || !strings.HasSuffix(out, test.faults+" faults injected, all invariants held\n") {
+				t.Errorf("exit code %d:\n%s", code, out)
+			}
+		})
+	}
+}
+
+func TestInvariants(t *testing.T) {
+	captureLogs(t)
+	start := time.Date(2024, time.March, 4, 0, 0, 0, 0, time.UTC)
+	base := &fixedClock{start}
+	v := &invariants{base: base, cooldown: 3 * time.Hour}
+	cycle := func(after time.Duration, band string, prices []float64, safeMode string) {
+		base.now = start.Add(after)
+		v.check(&cycleResult{Prices: prices, Decision: &Decision{Band: band, SafeMode: safeMode}})
+	}
+	prices := []float64{90, 100}
+	cycle(0, policy.Cheap, prices, "")
+	cycle(time.Hour, policy.Cheap, prices, "")
+	cycle(2*time.Hour, policy.Expensive, prices, "")
+	// The safe mode decides without prices
+	cycle(3*time.Hour, policy.Expensive, nil, safeMin)
+	cycle(4*time.Hour, policy.Cheap, nil, "")
+	cycle(5*time.Hour, policy.Cheap, prices, "")
+	cycle(6*time.Hour, policy.Cheap, prices, "")
+	v.check(&cycleResult{})
+
+	tree := simulatedSysfs(t, 2)
+	path := cpuPath(1, "cpufreq", "scaling_max_freq")
+	originals := map[string]string{cpuPath(0, "cpufreq", "scaling_max_freq"): "3200000\n", path: "2400000\n"}
+	v.checkRestored(tree, originals)
+
+	want := []string{
+		"2024-03-04T04:00:00Z: applied the cheap band without prices",
+		"2024-03-04T04:00:00Z: changed from the expensive band to the cheap band 2h0m0s after the previous change",
+		"2024-03-04T06:00:00Z: " + path + " not restored on shutdown",
+	}
+	if len(v.violations) != len(want) {
+		t.Fatalf("violations %q, want %q", v.violations, want)
+	}
+	for i := range want {
+		if v.violations[i] != want[i] {
+			t.Errorf("violation %q, want %q", v.violations[i], want[i])
+		}
+	}
+	var out strings.Builder
+	if code := v.print(&out, 1); code != exitFailure || !strings.HasPrefix(out.String(), "3 invariants violated:\n") {
+		t.Errorf("exit code %d:\n%s", code, out.String())
+	}
+}
+
+func TestCorruptedState(t *testing.T) {
+	now := time.Now()
+	tree := runOnMocks(t, trend(now, 10))
+	logs := captureLogs(t)
+	setGlobal(t, &status, &cycleStatus{started: now, frequencies: make(map[int]int)})
+	if err := os.WriteFile(stateFile(), []byte(`{"lastDecision": {"band": "cheap", "frequ`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loadState()
+	if !strings.Contains(logs.String(), "Error reading state file "+stateFile()) {
+		t.Errorf("the corrupted state not reported:\n%s", logs)
+	}
+
+	// The cycle decides on the prices, not on the remains of the state
+	result := runCycle(context.Background())
+	if result.Decision == nil || result.Decision.Band != policy.Expensive {
+		t.Fatalf("decision %+v, want the expensive band", result.Decision)
+	}
+	if got := readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")); got != "800000" {
+		t.Errorf("scaling_max_freq %s, want 800000", got)
+	}
+	if err := saveState(); err != nil {
+		t.Fatal(err)
+	}
+	saved := savedState(t)
+	if saved.LastDecision == nil || saved.LastDecision.Band != policy.Expensive {
+		t.Errorf("saved the last decision %+v, want the expensive one", saved.LastDecision)
+	}
+}
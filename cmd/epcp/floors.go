@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// frequencyFloors keep the frequency from dropping below a minimum in their
+// hours of the day, see ApplyConfig.
+var frequencyFloors []frequencyFloor
+
+// frequencyFloor is the minimum frequency in kHz in a range of the day.
+type frequencyFloor struct {
+	clockRange
+	name      string
+	frequency int
+}
+
+// parseFloors parses the floors by range of the day. Invalid ranges and
+// ranges overlapping a previous one are returned as errors.
+func parseFloors(floors map[string]int) ([]frequencyFloor, []error) {
+	var parsed []frequencyFloor
+	var errs []error
+	for _, name := range sortedKeys(floors) {
+		r, err := parseClockRange(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, f := range parsed {
+			if r.overlaps(f.clockRange) {
+				errs = append(errs, fmt.Errorf("range %s overlaps %s", name, f.name))
+			}
+		}
+		parsed = append(parsed, frequencyFloor{clockRange: r, name: name, frequency: floors[name]})
+	}
+	return parsed, errs
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// clampToFloor raises the frequencies of the decision to the floor of its
+// hour of the day, in the market timezone, noting it in the reason. The
+// decisions the safe mode holds are not applied and left as they are.
+func clampToFloor(ctx context.Context, decision *Decision) {
+	if decision == nil || decision.SafeMode == safeHold {
+		return
+	}
+	t := inMarketTime(decision.Time)
+	for _, floor := range frequencyFloors {
+		if !floor.contains(t) {
+			continue
+		}
+		clamped := false
+		if decision.Frequency < floor.frequency {
+			decision.Frequency, clamped = floor.frequency, true
+		}
+		for node, frequency := range decision.Nodes {
+			if frequency < floor.frequency {
+				decision.Nodes[node], clamped = floor.frequency, true
+			}
+		}
+		if clamped {
+			reason := fmt.Sprintf("clamped to the floor of %d kHz for %s", floor.frequency, floor.name)
+			infoLog(ctx).Printf("Frequency %s\n", reason)
+			if decision.Reason != "" {
+				reason = decision.Reason + ", " + reason
+			}
+			decision.Reason, decision.Target = reason, ""
+		}
+		return
+	}
+}
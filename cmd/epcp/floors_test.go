@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+func TestParseFloors(t *testing.T) {
+	floors, errs := parseFloors(map[string]int{"08:00-18:00": 2400000, "22:00-06:00": 1600000, "18:00-22:00": 2000000})
+	if len(errs) != 0 || len(floors) != 3 {
+		t.Fatalf("floors %v, errors %v, want three", floors, errs)
+	}
+	// The floors are in the order of their ranges
+	if floors[0].name != "08:00-18:00" || floors[0].frequency != 2400000 || floors[2].name != "22:00-06:00" {
+		t.Errorf("floors %+v, want them sorted", floors)
+	}
+
+	tests := []struct {
+		floors map[string]int
+		want   []string
+	}{
+		{map[string]int{"08:00-18:00": 1, "17:00-20:00": 1}, []string{"range 17:00-20:00 overlaps 08:00-18:00"}},
+		// Overnight ranges overlap in the morning
+		{map[string]int{"22:00-06:00": 1, "05:00-07:00": 1}, []string{"range 22:00-06:00 overlaps 05:00-07:00"}},
+		{map[string]int{"22:00-06:00": 1, "23:00-01:00": 1}, []string{"range 23:00-01:00 overlaps 22:00-06:00"}},
+		{map[string]int{"8-18": 1, "25:00-06:00": 1}, []string{"25:00-06:00", "8-18"}},
+	}
+	for _, test := range tests {
+		_, errs := parseFloors(test.floors)
+		if len(errs) != len(test.want) {
+			t.Errorf("%v: errors %v, want %q", test.floors, errs, test.want)
+			continue
+		}
+		for i, err := range errs {
+			if !strings.Contains(err.Error(), test.want[i]) {
+				t.Errorf("%v: error %q, want %q", test.floors, err, test.want[i])
+			}
+		}
+	}
+	// Adjacent ranges do not overlap
+	if _, errs := parseFloors(map[string]int{"06:00-22:00": 1, "22:00-06:00": 1}); len(errs) != 0 {
+		t.Errorf("adjacent ranges: %v", errs)
+	}
+}
+
+func TestClampToFloor(t *testing.T) {
+	logs := captureLogs(t)
+	floors, errs := parseFloors(map[string]int{"08:00-18:00": 2400000, "22:00-06:00": 1600000})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	setGlobal(t, &frequencyFloors, floors)
+	at := func(hour int) time.Time {
+		return time.Date(2024, time.October, 1, hour, 30, 0, 0, ote.Location())
+	}
+
+	tests := []struct {
+		name     string
+		decision Decision
+		want     Decision
+	}{
+		{"clamped", Decision{Time: at(9), Frequency: 800000, Target: "min"},
+			Decision{Time: at(9), Frequency: 2400000, Reason: "clamped to the floor of 2400000 kHz for 08:00-18:00"}},
+		{"above the floor", Decision{Time: at(9), Frequency: 3200000, Target: "max"},
+			Decision{Time: at(9), Frequency: 3200000, Target: "max"}},
+		{"outside the floors", Decision{Time: at(19), Frequency: 800000},
+			Decision{Time: at(19), Frequency: 800000}},
+		{"before midnight", Decision{Time: at(23), Frequency: 800000},
+			Decision{Time: at(23), Frequency: 1600000, Reason: "clamped to the floor of 1600000 kHz for 22:00-06:00"}},
+		{"after midnight", Decision{Time: at(5), Frequency: 800000, Reason: "stale prices"},
+			Decision{Time: at(5), Frequency: 1600000, Reason: "stale prices, clamped to the floor of 1600000 kHz for 22:00-06:00"}},
+		{"held by the safe mode", Decision{Time: at(9), Frequency: 800000, SafeMode: safeHold},
+			Decision{Time: at(9), Frequency: 800000, SafeMode: safeHold}},
+		// The floor is in the market timezone
+		{"in UTC", Decision{Time: at(7).UTC(), Frequency: 800000},
+			Decision{Time: at(7).UTC(), Frequency: 800000}},
+	}
+	for _, test := range tests {
+		decision := test.decision
+		clampToFloor(context.Background(), &decision)
+		if decision.Frequency != test.want.Frequency || decision.Target != test.want.Target || decision.Reason != test.want.Reason {
+			t.Errorf("%s: frequency %d, target %q, reason %q, want %d, %q, %q", test.name,
+				decision.Frequency, decision.Target, decision.Reason, test.want.Frequency, test.want.Target, test.want.Reason)
+		}
+	}
+	if !strings.Contains(logs.String(), "Frequency clamped to the floor of 2400000 kHz for 08:00-18:00") {
+		t.Errorf("the clamping not logged:\n%s", logs)
+	}
+
+	// The frequencies of NUMA nodes are clamped as well
+	decision := &Decision{Time: at(12), Frequency: 3200000, Nodes: map[int]int{0: 800000, 1: 3200000}}
+	clampToFloor(context.Background(), decision)
+	if decision.Nodes[0] != 2400000 || decision.Nodes[1] != 3200000 || decision.Reason == "" {
+		t.Errorf("nodes %v, reason %q, want node 0 clamped", decision.Nodes, decision.Reason)
+	}
+	clampToFloor(context.Background(), nil)
+}
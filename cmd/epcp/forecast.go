@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/forecast"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// forecastDays is how many days before an hour the forecasts read, see
+// forecast.WeeklyMedian.
+const forecastDays = 7
+
+var (
+	// historyDays is how many days the prices are kept in the history,
+	// historyHourlyDays their hourly means and historyDailyDays their daily
+	// statistics, forever when 0, see StateConfig
+	historyDays       = 8
+	historyHourlyDays = 90
+	historyDailyDays  int
+)
+
+var (
+	// forecastName names the model predicting the prices when none can be
+	// fetched, see SourceConfig; empty without a fallback
+	forecastName string
+	// forecastConservative decides the expensive band on forecast prices
+	forecastConservative bool
+)
+
+// recordHistory adds the market prices of the points to the history kept in
+// the state for the forecasts, when there is one, and compacts the history
+// on the first cycle of each market day, see compactHistory.
+func recordHistory(ctx context.Context, points []ote.PricePoint) {
+	if forecastName != "" {
+		if state.History == nil {
+			state.History = make(forecast.History)
+		}
+		if state.HistoryVolumes == nil {
+			state.HistoryVolumes = make(forecast.History)
+		}
+		for _, p := range points {
+			if p.Source == "" && !p.Start.IsZero() {
+				state.History.Add(p.Start, p.Price)
+				if p.Volume > 0 {
+					state.HistoryVolumes.Add(p.Start, p.Volume)
+				}
+			}
+		}
+	}
+	now := cycleClock.Now()
+	if today := ote.Day(now); state.HistoryCompacted != today {
+		if c := compactHistory(now, historyDays, historyHourlyDays, historyDailyDays); c != (historyCompaction{}) {
+			infoLog(ctx).Printf("Compacted the history: %s\n", c)
+		}
+		state.HistoryCompacted = today
+	}
+}
+
+// forecastPrices predicts the prices of the window from the history, marked
+// with ote.SourceForecast. It returns nil when no hour can be predicted.
+func forecastPrices(times *Times) []ote.PricePoint {
+	model := forecast.Models[forecastName]
+	if model == nil {
+		return nil
+	}
+	start, err := ote.HourStart(ote.HourIndex(times.start))
+	if err != nil {
+		return nil
+	}
+	end, err := ote.HourStart(ote.HourIndex(times.end))
+	if err != nil {
+		return nil
+	}
+	var points []ote.PricePoint
+	for hour := start; !hour.After(end); hour = hour.Add(time.Hour) {
+		price, ok := model(state.History, hour)
+		if !ok {
+			continue
+		}
+		date, index := ote.HourIndex(hour)
+		points = append(points, ote.PricePoint{Date: date, Hour: index, Start: hour, Price: price, Source: ote.SourceForecast})
+	}
+	return points
+}
+
+// adjustForForecast marks a decision based on forecast prices and, when
+// configured, makes it conservative by deciding the expensive band.
+func adjustForForecast(ctx context.Context, result *cycleResult) {
+	decision := result.Decision
+	if decision == nil {
+		return
+	}
+	for _, p := range result.Points {
+		if p.Source == ote.SourceForecast {
+			decision.Forecast = true
+			break
+		}
+	}
+	if !decision.Forecast {
+		return
+	}
+	metrics.addCounter("epcp_forecast_decisions_total", "Number of decisions based on forecast prices.", 1)
+	if forecastConservative && decision.Band != policy.Expensive {
+		infoLog(ctx).Println("Deciding the expensive band on forecast prices")
+		decision.setBand(policy.Expensive, availableFrequencies())
+	}
+}
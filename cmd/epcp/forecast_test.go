@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/forecast"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// unreachableSource is an ote.PriceSource that cannot be reached.
+type unreachableSource struct{}
+
+var errUnreachable = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func (unreachableSource) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	return nil, errUnreachable
+}
+
+func (unreachableSource) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	return nil, errUnreachable
+}
+
+func (unreachableSource) DamIndex(ctx context.Context, from, to string) ([]ote.DamIndex, error) {
+	return nil, errUnreachable
+}
+
+func TestForecastFallback(t *testing.T) {
+	now := time.Now()
+	runOnMocks(t, unreachableSource{})
+	logs := captureLogs(t)
+	setGlobal(t, &forecastName, "persistence")
+	setGlobal(t, &forecastConservative, false)
+	// The history of the last nine days rises hour by hour, so that the
+	// persistence of yesterday is expensive
+	history := trend(now, 10)
+	state.History = make(forecast.History)
+	for hour := now.Truncate(time.Hour); hour.After(now.AddDate(0, 0, -9)); hour = hour.Add(-time.Hour) {
+		state.History.Add(hour, history(hour))
+	}
+	// The cached prices are too old to be used
+	state.Prices = &priceCache{Time: now.Add(-2 * historyWindow), Points: []ote.PricePoint{{Price: 1}}}
+	seeded := len(state.History)
+
+	result := runCycle(context.Background())
+	if result.Decision == nil || !result.Decision.Forecast || result.Decision.Band != policy.Expensive {
+		t.Fatalf("decision %+v, want an expensive one on the forecast:\n%s", result.Decision, logs)
+	}
+	if len(result.Points) == 0 {
+		t.Fatal("no points forecast")
+	}
+	for _, p := range result.Points {
+		if p.Source != ote.SourceForecast {
+			t.Errorf("%s: source %q, want forecast", p.Start, p.Source)
+		}
+		if want := history(p.Start.AddDate(0, 0, -1)); p.Price != want {
+			t.Errorf("%s: forecast %g, want the %g of yesterday", p.Start, p.Price, want)
+		}
+	}
+	if !strings.Contains(logs.String(), "WARNING: no prices available") || !strings.Contains(logs.String(), "using the persistence forecast") {
+		t.Errorf("the forecast not logged:\n%s", logs)
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	if !strings.Contains(exposition.String(), "epcp_forecast_decisions_total 1\n") {
+		t.Errorf("the forecast decision not counted:\n%s", exposition.String())
+	}
+
+	// Forecast prices are not recorded in the history
+	if n := len(state.History); n != seeded {
+		t.Errorf("%d hours in the history, want the %d seeded", n, seeded)
+	}
+
+	// Conservatively, forecast prices are expensive whatever they are
+	state.History = make(forecast.History)
+	falling := trend(now, -10)
+	for hour := now.Truncate(time.Hour); hour.After(now.AddDate(0, 0, -9)); hour = hour.Add(-time.Hour) {
+		state.History.Add(hour, falling(hour))
+	}
+	setGlobal(t, &forecastConservative, true)
+	if result := runCycle(context.Background()); result.Decision == nil || result.Decision.Band != policy.Expensive || !result.Decision.Forecast {
+		t.Errorf("decision %+v, want a conservative one", result.Decision)
+	}
+	if !strings.Contains(logs.String(), "Deciding the expensive band on forecast prices") {
+		t.Errorf("the conservative decision not logged:\n%s", logs)
+	}
+
+	// Without any history there is no fallback
+	state.History = nil
+	if result := runCycle(context.Background()); len(result.Points) != 0 || result.exitCode() != exitFetchFailed {
+		t.Errorf("points %v with exit code %d, want none without a history", result.Points, result.exitCode())
+	}
+}
+
+func TestForecastOnlyAsFallback(t *testing.T) {
+	runOnMocks(t, trend(time.Now(), -10))
+	captureLogs(t)
+	setGlobal(t, &forecastName, "weekly_median")
+	setGlobal(t, &forecastConservative, true)
+	result := runCycle(context.Background())
+	if result.Decision == nil || result.Decision.Forecast || result.Decision.Band != policy.Cheap {
+		t.Fatalf("decision %+v, want the market prices decided on", result.Decision)
+	}
+	for _, p := range result.Points {
+		if p.Source != "" {
+			t.Errorf("%s: source %q, want the market", p.Start, p.Source)
+		}
+		if price, ok := state.History[p.Start.Unix()]; !ok || price != p.Price {
+			t.Errorf("%s: %g in the history, want the market price %g", p.Start, price, p.Price)
+		}
+	}
+}
+
+func TestForecastNotOverQuarantine(t *testing.T) {
+	now := time.Now()
+	runOnMocks(t, trend(now, -10))
+	logs := captureLogs(t)
+	setGlobal(t, &priceMax, 100.0)
+	setGlobal(t, &forecastName, "persistence")
+	setGlobal(t, &forecastConservative, false)
+	setGlobal(t, &profileFallback, true)
+	setGlobal(t, &safeMode, safeMin)
+	history := trend(now, 10)
+	state.History = make(forecast.History)
+	for hour := now.Truncate(time.Hour); hour.After(now.AddDate(0, 0, -9)); hour = hour.Add(-time.Hour) {
+		state.History.Add(hour, history(hour))
+	}
+
+	// The implausible prices fail the fetch into the safe mode, neither
+	// the forecast nor the profile standing in for them
+	result := runCycle(context.Background())
+	if !errors.Is(result.FetchErr, errQuarantined) || result.SafeMode != causeQuarantine {
+		t.Fatalf("fetch error %v, safe mode %q, want the quarantine", result.FetchErr, result.SafeMode)
+	}
+	if d := result.Decision; d == nil || d.Forecast || d.Band != policy.Expensive {
+		t.Errorf("decision %+v, want the expensive band of the safe mode", d)
+	}
+	if strings.Contains(logs.String(), "using the persistence forecast") || strings.Contains(logs.String(), "using the price profile") {
+		t.Errorf("a fallback used over the quarantine:\n%s", logs)
+	}
+}
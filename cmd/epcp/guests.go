@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// guestTimeout bounds each virsh command.
+const guestTimeout = 10 * time.Second
+
+// guestShares scales the CPU shares of libvirt guests per band, see
+// ActuatorConfig; it is nil without a libvirt actuator.
+var guestShares *guestTuner
+
+type guestTuner struct {
+	virsh   actuator.Virsh
+	domains []string
+	// factors maps the bands to the factor of the original shares, none for
+	// the bands running the guests unchanged
+	factors map[string]float64
+	// simulated is the factor of a dry run or a simulation, see wouldScale
+	simulated float64
+}
+
+func newGuestTuner(a ActuatorConfig) *guestTuner {
+	return &guestTuner{virsh: actuator.Virsh{Command: a.Command}, domains: a.Domains, factors: a.Shares}
+}
+
+// applyGuestShares scales the shares of the running domains for the decided
+// band, or restores them when the band has no factor. A failing domain does
+// not keep the others from being tuned. It reports whether it set any shares.
+func applyGuestShares(ctx context.Context, result *cycleResult) (bool, error) {
+	if guestShares == nil || paused.Load() || result.Decision.suspended() {
+		return false, nil
+	}
+	factor, scaled := guestShares.factors[result.Decision.Band]
+	if dryRun || simulate {
+		if !wouldScale(&guestShares.simulated, factor, scaled) {
+			return false, nil
+		}
+		if scaled {
+			infoLog(ctx).Printf("Would scale the CPU shares of the domains by %g\n", factor)
+		} else {
+			infoLog(ctx).Println("Would restore the CPU shares of the domains")
+		}
+		return true, nil
+	}
+	failed, written := 0, false
+	for _, domain := range guestShares.domains {
+		var set bool
+		var err error
+		if scaled {
+			set, err = guestShares.scale(ctx, domain, factor)
+		} else {
+			set, err = guestShares.restore(ctx, domain)
+		}
+		if err != nil {
+			failed++
+		}
+		written = written || set
+	}
+	if failed != 0 {
+		return written, fmt.Errorf("%d of %d domains failed", failed, len(guestShares.domains))
+	}
+	return written, nil
+}
+
+// restoreGuestShares writes back the original shares of the domains, on
+// exit.
+func restoreGuestShares(ctx context.Context) {
+	if guestShares == nil || dryRun || simulate {
+		return
+	}
+	for domain := range state.OriginalShares {
+		guestShares.restore(ctx, domain)
+	}
+}
+
+// scale sets the shares of the domain to factor times its original shares,
+// recording them first. The shares the domain has are read every time, so
+// that shares set already, e.g. by an earlier run, are not set again. It
+// reports whether it set them.
+func (t *guestTuner) scale(ctx context.Context, domain string, factor float64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), guestTimeout)
+	defer cancel()
+	current, err := t.shares(ctx, domain)
+	if err != nil || current == 0 {
+		return false, err
+	}
+	original, ok := state.OriginalShares[domain]
+	if !ok {
+		original = current
+		if state.OriginalShares == nil {
+			state.OriginalShares = make(map[string]int)
+		}
+		state.OriginalShares[domain] = original
+	}
+	shares := actuator.ScaledShares(original, factor)
+	if current == shares {
+		return false, nil
+	}
+	if err := t.virsh.SetShares(ctx, domain, shares); err != nil {
+		errorLog(ctx).Printf("Error setting the CPU shares of domain %s to %d: %s\n", domain, shares, err.Error())
+		return false, err
+	}
+	infoLog(ctx).Printf("Set the CPU shares of domain %s to %d\n", domain, shares)
+	return true, nil
+}
+
+// restore sets the shares of the domain back to the recorded original,
+// unless it has them already, reporting whether it set them.
+func (t *guestTuner) restore(ctx context.Context, domain string) (bool, error) {
+	original, ok := state.OriginalShares[domain]
+	if !ok {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), guestTimeout)
+	defer cancel()
+	current, err := t.shares(ctx, domain)
+	if err != nil || current == 0 {
+		return false, err
+	}
+	if current != original {
+		if err := t.virsh.SetShares(ctx, domain, original); err != nil {
+			errorLog(ctx).Printf("Error restoring the CPU shares of domain %s to %d: %s\n", domain, original, err.Error())
+			return false, err
+		}
+		infoLog(ctx).Printf("Restored the CPU shares of domain %s to %d\n", domain, original)
+	}
+	delete(state.OriginalShares, domain)
+	return current != original, nil
+}
+
+// shares returns the shares of the domain, 0 when it does not run.
+func (t *guestTuner) shares(ctx context.Context, domain string) (int, error) {
+	if running, err := t.running(ctx, domain); !running {
+		return 0, err
+	}
+	shares, err := t.virsh.Shares(ctx, domain)
+	if err != nil {
+		errorLog(ctx).Printf("Error reading the CPU shares of domain %s: %s\n", domain, err.Error())
+		return 0, err
+	}
+	return shares, nil
+}
+
+// running reports whether the domain runs. The live shares of a domain that
+// is shut off are gone, so its record is dropped and the next start uses the
+// shares of its definition.
+func (t *guestTuner) running(ctx context.Context, domain string) (bool, error) {
+	running, err := t.virsh.Running(ctx, domain)
+	if err != nil {
+		errorLog(ctx).Printf("Error reading the state of domain %s: %s\n", domain, err.Error())
+		return false, err
+	}
+	if !running {
+		delete(state.OriginalShares, domain)
+	}
+	return running, nil
+}
@@ -0,0 +1,204 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// stubVirsh writes a virsh keeping the state and the cpu_shares of each
+// domain in the files <domain>.state and <domain>.shares of dir, running
+// with 1024 shares by default, and recording the schedinfo --set calls in
+// dir/calls. Domains without a state file other than web and db do not
+// exist.
+func stubVirsh(t *testing.T, dir string) string {
+	t.Helper()
+	stub := filepath.Join(dir, "virsh")
+	script := `#!/bin/sh
+cd ` + dir + `
+case "$2" in
+web|db) ;;
+*) test -e "$2.state" || { echo "error: failed to get domain '$2'" >&2; exit 1; } ;;
+esac
+case "$1" in
+domstate) cat "$2.state" 2>/dev/null || echo running ;;
+schedinfo)
+	if [ "$4" = "--set" ]; then
+		echo "$*" >> calls
+		echo "${5#cpu_shares=}" > "$2.shares"
+	else
+		echo "cpu_shares     : $(cat "$2.shares" 2>/dev/null || echo 1024)"
+	fi ;;
+esac
+`
+	if err := os.WriteFile(stub, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return stub
+}
+
+func TestGuestShares(t *testing.T) {
+	logs := captureLogs(t)
+	dir := t.TempDir()
+	config := ActuatorConfig{Type: "libvirt", Command: stubVirsh(t, dir), Domains: []string{"web", "db", "missing"},
+		Shares: map[string]float64{policy.Expensive: 0.25}}
+	setGlobal(t, &guestShares, newGuestTuner(config))
+	setGlobal(t, &state, new(State))
+	setGlobal(t, &dryRun, false)
+	setGlobal(t, &simulate, false)
+	ctx := context.Background()
+	cycle := func(band string) error {
+		_, err := applyGuestShares(ctx, &cycleResult{Decision: &Decision{Time: time.Now(), Band: band}})
+		return err
+	}
+	calls := func() string {
+		content, _ := os.ReadFile(filepath.Join(dir, "calls"))
+		os.Remove(filepath.Join(dir, "calls"))
+		return string(content)
+	}
+	shares := func(domain string) string {
+		content, _ := os.ReadFile(filepath.Join(dir, domain+".shares"))
+		return strings.TrimSpace(string(content))
+	}
+
+	// A missing domain does not keep the others from being scaled
+	if err := os.WriteFile(filepath.Join(dir, "db.shares"), []byte("2000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cycle(policy.Expensive); err == nil || err.Error() != "1 of 3 domains failed" {
+		t.Errorf("expensive: got error %v, want the missing domain failing", err)
+	}
+	if shares("web") != "256" || shares("db") != "500" || state.OriginalShares["web"] != 1024 || state.OriginalShares["db"] != 2000 {
+		t.Errorf("shares %s and %s, originals %v, want 256 and 500", shares("web"), shares("db"), state.OriginalShares)
+	}
+	if !strings.Contains(logs.String(), "Error reading the state of domain missing") {
+		t.Errorf("the failing domain not logged:\n%s", logs)
+	}
+	calls()
+
+	// The shares set are read back, also by the tuner of another run
+	setGlobal(t, &guestShares, newGuestTuner(config))
+	if applied, err := applyGuestShares(ctx, &cycleResult{Decision: &Decision{Time: time.Now(), Band: policy.Expensive}}); applied || calls() != "" {
+		t.Errorf("expensive in another run: applied %t, %v, want the shares left alone", applied, err)
+	}
+
+	// The shares are set once, and a domain shut off is skipped and forgotten
+	if err := os.WriteFile(filepath.Join(dir, "db.state"), []byte("shut off\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cycle(policy.Expensive)
+	if got := calls(); got != "" {
+		t.Errorf("expensive again: set %q, want nothing", got)
+	}
+	if _, ok := state.OriginalShares["db"]; ok {
+		t.Errorf("originals %v, want db forgotten once shut off", state.OriginalShares)
+	}
+
+	// A band without a factor restores the original shares, leaving the
+	// domains without any alone, logged with the run ID of the cycle
+	if _, err := applyGuestShares(withRunID(ctx, "01J9"), &cycleResult{Decision: &Decision{Time: time.Now(), Band: policy.Cheap}}); err != nil {
+		t.Errorf("cheap: %v", err)
+	}
+	if got, want := calls(), "schedinfo web --live --set cpu_shares=1024\n"; got != want {
+		t.Errorf("cheap: set %q, want %q", got, want)
+	}
+	if want := "run=01J9 Restored the CPU shares of domain web to 1024\n"; !strings.Contains(logs.String(), want) {
+		t.Errorf("logs without %q:\n%s", want, logs)
+	}
+	if len(state.OriginalShares) != 0 {
+		t.Errorf("originals %v after restoring, want none", state.OriginalShares)
+	}
+
+	// The original shares are restored on exit
+	os.Remove(filepath.Join(dir, "db.state"))
+	cycle(policy.Expensive)
+	calls()
+	restoreGuestShares(ctx)
+	if got := calls(); !strings.Contains(got, "schedinfo web --live --set cpu_shares=1024") ||
+		!strings.Contains(got, "schedinfo db --live --set cpu_shares=500") {
+		t.Errorf("on exit: set %q, want the originals", got)
+	}
+	if len(state.OriginalShares) != 0 {
+		t.Errorf("originals %v after the exit, want none", state.OriginalShares)
+	}
+}
+
+func TestGuestSharesDryRun(t *testing.T) {
+	captureLogs(t)
+	dir := t.TempDir()
+	setGlobal(t, &guestShares, newGuestTuner(ActuatorConfig{Type: "libvirt", Command: stubVirsh(t, dir), Domains: []string{"web"},
+		Shares: map[string]float64{policy.Expensive: 0.25}}))
+	setGlobal(t, &state, new(State))
+	setGlobal(t, &dryRun, true)
+	for i, test := range []struct {
+		band    string
+		applied bool
+	}{{policy.Cheap, false}, {policy.Expensive, true}, {policy.Expensive, false}, {policy.Cheap, true}} {
+		applied, err := applyGuestShares(context.Background(), &cycleResult{Decision: &Decision{Time: time.Now(), Band: test.band}})
+		if applied != test.applied || err != nil {
+			t.Errorf("cycle %d, %s: applied %t, %v, want %t", i, test.band, applied, err, test.applied)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "calls")); err == nil {
+		t.Error("shares set in a dry run")
+	}
+}
+
+func TestRestoreWithoutFrequencies(t *testing.T) {
+	logs := captureLogs(t)
+	dir := t.TempDir()
+	useStateDir(t, dir)
+	simulatedSysfs(t, 2)
+	setGlobal(t, &skipPreflight, true)
+	setGlobal(t, &simulate, false)
+	setGlobal(t, &dryRun, false)
+	setGlobal(t, &decisionLog, "")
+	setGlobal(t, &frequencyActuator, frequencyActuator)
+	setGlobal(t, &guestShares, newGuestTuner(ActuatorConfig{Type: "libvirt", Command: stubVirsh(t, dir), Domains: []string{"web"}}))
+	if err := os.WriteFile(filepath.Join(dir, "web.shares"), []byte("256\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// An earlier run scaled the guests but recorded no frequencies
+	setGlobal(t, &state, &State{OriginalShares: map[string]int{"web": 1024}})
+	if err := saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := runRestore(nil); code != exitOK {
+		t.Fatalf("exit code %d, want %d", code, exitOK)
+	}
+	calls, _ := os.ReadFile(filepath.Join(dir, "calls"))
+	if got, want := string(calls), "schedinfo web --live --set cpu_shares=1024\n"; got != want {
+		t.Errorf("set %q, want %q", got, want)
+	}
+	if !strings.Contains(logs.String(), "No original frequencies recorded, restoring the other actuators only.") {
+		t.Errorf("logs without the frequencies missing:\n%s", logs)
+	}
+	if saved := savedState(t); len(saved.OriginalShares) != 0 {
+		t.Errorf("saved originals %v, want none after restoring", saved.OriginalShares)
+	}
+
+	// A state that cannot be saved fails the command
+	if err := os.Remove(stateFile()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(stateFile(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stateFile(), "entry"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := runRestore(nil); code != exitFailure {
+		t.Errorf("unsavable state: exit code %d, want %d", code, exitFailure)
+	}
+	if !strings.Contains(logs.String(), "Error saving state file: ") {
+		t.Errorf("the failed save not logged:\n%s", logs)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// handleHelperRequest performs the writes of one request under sysfsRoot
+// and logs the failed ones.
+func handleHelperRequest(r io.Reader, w io.Writer) error {
+	failed, err := actuator.HandleHelperRequest(sysfsRoot, r, w)
+	for _, err := range failed {
+		errorLogger.Printf("Apply helper: %s\n", err.Error())
+	}
+	return err
+}
+
+// helperPrivileged tells whether the helper runs as root or setuid, where its
+// caller must not move the sysfs root it writes under.
+var helperPrivileged = func() bool {
+	return os.Geteuid() == 0 || os.Geteuid() != os.Getuid()
+}
+
+// helperSysfsRoot returns the sysfs root the helper writes under: the one
+// requested only when the helper is not privileged, /sys otherwise.
+func helperSysfsRoot(requested string) string {
+	if requested == "/sys" || !helperPrivileged() {
+		return requested
+	}
+	errorLogger.Printf("Apply helper: ignoring the sysfs root %s, running privileged\n", requested)
+	return "/sys"
+}
+
+// runApplyHelper performs the writes requested on stdin, or on each
+// connection of a unix socket when --listen is given.
+func runApplyHelper(args []string) int {
+	flags := flag.NewFlagSet("apply-helper", flag.ContinueOnError)
+	listen := flags.String("listen", "", "unix socket to accept requests on instead of stdin")
+	if root := getenv("EPCP_SYSFS_ROOT"); root != "" {
+		sysfsRoot = root
+	}
+	flags.StringVar(&sysfsRoot, "sysfs-root", sysfsRoot, "where sysfs is mounted ($EPCP_SYSFS_ROOT)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	sysfsRoot = helperSysfsRoot(sysfsRoot)
+	if *listen == "" {
+		if err := handleHelperRequest(os.Stdin, os.Stdout); err != nil {
+			errorLogger.Printf("Apply helper: %s\n", err.Error())
+			return 1
+		}
+		return 0
+	}
+	os.Remove(*listen)
+	listener, err := net.Listen("unix", *listen)
+	if err != nil {
+		errorLogger.Printf("Apply helper: %s\n", err.Error())
+		return 1
+	}
+	defer listener.Close()
+	if err := os.Chmod(*listen, 0660); err != nil {
+		errorLogger.Printf("Apply helper: %s\n", err.Error())
+		return 1
+	}
+	infoLogger.Printf("Apply helper listening on %s\n", *listen)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			errorLogger.Printf("Apply helper: %s\n", err.Error())
+			return 1
+		}
+		go func() {
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+			if err := handleHelperRequest(conn, conn); err != nil {
+				errorLogger.Printf("Apply helper: %s\n", err.Error())
+			}
+		}()
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestHelperSysfsRoot(t *testing.T) {
+	captureLogs(t)
+	tests := []struct {
+		requested  string
+		privileged bool
+		want       string
+	}{
+		{"/sys", true, "/sys"},
+		{"/sys", false, "/sys"},
+		{"/tmp/sysfs", false, "/tmp/sysfs"},
+		{"/tmp/sysfs", true, "/sys"},
+	}
+	for _, test := range tests {
+		setGlobal(t, &helperPrivileged, func() bool { return test.privileged })
+		if got := helperSysfsRoot(test.requested); got != test.want {
+			t.Errorf("%s, privileged %t: got %s, want %s", test.requested, test.privileged, got, test.want)
+		}
+	}
+}
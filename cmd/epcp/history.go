@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/forecast"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/pricefile"
+)
+
+// importCounts counts what an import did with the prices read.
+type importCounts struct {
+	inserted, overwritten, skipped int
+}
+
+// runHistory runs the history subcommands, import and compact.
+func runHistory(args []string) int {
+	switch {
+	case len(args) != 0 && args[0] == "import":
+		return int(runHistoryImport(args[1:]))
+	case len(args) != 0 && args[0] == "compact":
+		return int(runHistoryCompact(args[1:]))
+	}
+	fmt.Fprintln(os.Stderr, "Usage: epcp [--dry-run] history import --file path [flags]")
+	fmt.Fprintln(os.Stderr, "       epcp [--dry-run] history compact [flags]")
+	return int(exitUsage)
+}
+
+// runHistoryImport imports the prices of a file into the history of the
+// forecasts. Malformed rows are reported with their lines and skipped,
+// unless --strict.
+func runHistoryImport(args []string) exitCode {
+	flags := flag.NewFlagSet("history import", flag.ContinueOnError)
+	path := flags.String("file", "", "price `file` to import")
+	format := flags.String("format", pricefile.FormatGeneric, "format of the file, ote-csv, ote-xml or generic")
+	timeColumn := flags.String("time-column", "time", "`name` of the time column of the generic format")
+	priceColumn := flags.String("price-column", "price", "`name` of the price column of the generic format")
+	volumeColumn := flags.String("volume-column", "", "`name` of the volume column of the generic format (default volume if present)")
+	timeLayout := flags.String("time-layout", time.RFC3339, "Go `layout` of the times of the generic format")
+	timezone := flags.String("timezone", ote.Timezone, "time `zone` of the times without an offset")
+	delimiter := flags.String("delimiter", "", "field `separator` (default ; for ote-csv and , for generic)")
+	duplicates := flags.String("duplicates", "skip", "prices of hours already in the history: skip or overwrite")
+	strict := flags.Bool("strict", false, "import nothing when a row is malformed")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: epcp [--dry-run] history import --file path [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if *path == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *duplicates != "skip" && *duplicates != "overwrite" {
+		errorLogger.Printf("Unknown duplicate handling %q, expected skip or overwrite.\n", *duplicates)
+		return exitUsage
+	}
+	opts := pricefile.ImportOptions{
+		Format: *format, TimeColumn: *timeColumn, PriceColumn: *priceColumn, VolumeColumn: *volumeColumn,
+		TimeLayout: *timeLayout,
+	}
+	var err error
+	if opts.Location, err = time.LoadLocation(*timezone); err != nil {
+		errorLogger.Printf("Unknown time zone %q: %s\n", *timezone, err.Error())
+		return exitUsage
+	}
+	if *delimiter != "" {
+		separator := []rune(*delimiter)
+		if len(separator) != 1 {
+			errorLogger.Printf("Invalid delimiter %q, expected a single character.\n", *delimiter)
+			return exitUsage
+		}
+		opts.Comma = separator[0]
+	}
+	f, err := os.Open(*path)
+	if err != nil {
+		errorLogger.Printf("Error opening %s: %s\n", *path, err.Error())
+		return exitFailure
+	}
+	points, rowErrs, err := pricefile.Import(f, opts)
+	f.Close()
+	if err != nil {
+		errorLogger.Printf("Error reading %s: %s\n", *path, err.Error())
+		return exitFailure
+	}
+	for _, rowErr := range rowErrs {
+		errorLogger.Printf("Malformed row in %s, %s\n", *path, rowErr.Error())
+	}
+	if *strict && len(rowErrs) != 0 {
+		errorLogger.Printf("%d malformed rows in %s, importing nothing.\n", len(rowErrs), *path)
+		return exitFailure
+	}
+
+	lock, code := acquireLock(context.Background())
+	if lock == nil {
+		return code
+	}
+	defer lock.Release()
+	loadState()
+	history, volumes := maps.Clone(state.History), maps.Clone(state.HistoryVolumes)
+	if history == nil {
+		history = make(forecast.History)
+	}
+	if volumes == nil {
+		volumes = make(forecast.History)
+	}
+	counts := importPrices(history, volumes, points, *duplicates == "overwrite")
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	} else {
+		state.History, state.HistoryVolumes = history, volumes
+		if err := saveState(); err != nil {
+			errorLogger.Printf("Error writing state file %s: %s\n", stateFile(), err.Error())
+			return exitFailure
+		}
+	}
+	fmt.Printf("%s %d prices from %s: %d inserted, %d overwritten, %d duplicates skipped, %d malformed rows.\n",
+		verb, len(points), *path, counts.inserted, counts.overwritten, counts.skipped, len(rowErrs))
+	if old := pricesBefore(points, cycleClock.Now().AddDate(0, 0, -historyDays)); old != 0 && counts.inserted+counts.overwritten != 0 {
+		infoLogger.Printf("WARNING: %d of the prices are older than the %d days of prices kept, the first cycle of the next day compacts them into hourly means.\n", old, historyDays)
+	}
+	return exitOK
+}
+
+// importPrices adds the market prices of the points to the history and
+// their volumes to volumes, in order. The prices of hours already in it,
+// including earlier points, are overwritten or skipped; those of the hours
+// compacted into hourly means or daily statistics are skipped, as they are
+// counted in them already.
+func importPrices(history, volumes forecast.History, points []ote.PricePoint, overwrite bool) importCounts {
+	var counts importCounts
+	for _, p := range points {
+		_, ok := history[p.Start.Unix()]
+		switch {
+		case state.HourlyPrices[p.Start.Truncate(time.Hour).Unix()] != nil || state.DailyPrices[ote.Day(p.Start)] != nil:
+			counts.skipped++
+			continue
+		case !ok:
+			counts.inserted++
+		case overwrite:
+			counts.overwritten++
+		default:
+			counts.skipped++
+			continue
+		}
+		history.Add(p.Start, p.Price)
+		if p.Volume > 0 {
+			volumes.Add(p.Start, p.Volume)
+		} else {
+			delete(volumes, p.Start.Unix())
+		}
+	}
+	return counts
+}
+
+// pricesBefore counts the points of hours starting before since.
+func pricesBefore(points []ote.PricePoint, since time.Time) int {
+	n := 0
+	for _, p := range points {
+		if p.Start.Before(since) {
+			n++
+		}
+	}
+	return n
+}
+
+// hourlyPrices are the mean and the volume-weighted mean (VWAP) of the
+// prices of an hour compacted out of the history, and their volume in MWh,
+// see compactHistory. The VWAP is 0 without volumes.
+type hourlyPrices struct {
+	Mean   float64 `json:"mean"`
+	VWAP   float64 `json:"vwap,omitempty"`
+	Volume float64 `json:"volume,omitempty"`
+	Points int     `json:"points"`
+}
+
+// add merges other prices of the hour.
+func (h *hourlyPrices) add(other hourlyPrices) {
+	if h.Points == 0 {
+		*h = other
+		return
+	}
+	h.Mean = (h.Mean*float64(h.Points) + other.Mean*float64(other.Points)) / float64(h.Points+other.Points)
+	h.VWAP, h.Volume = mergeVWAP(h.VWAP, h.Volume, other.VWAP, other.Volume)
+	h.Points += other.Points
+}
+
+// dailyPrices are the statistics of the hourly means of a market day
+// compacted out of the history, see compactHistory.
+type dailyPrices struct {
+	Mean   float64 `json:"mean"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	VWAP   float64 `json:"vwap,omitempty"`
+	Volume float64 `json:"volume,omitempty"`
+	Hours  int     `json:"hours"`
+}
+
+// add merges the statistics of other hours of the day.
+func (d *dailyPrices) add(other dailyPrices) {
+	if d.Hours == 0 {
+		*d = other
+		return
+	}
+	d.Mean = (d.Mean*float64(d.Hours) + other.Mean*float64(other.Hours)) / float64(d.Hours+other.Hours)
+	d.VWAP, d.Volume = mergeVWAP(d.VWAP, d.Volume, other.VWAP, other.Volume)
+	d.Min, d.Max, d.Hours = min(d.Min, other.Min), max(d.Max, other.Max), d.Hours+other.Hours
+}
+
+// mergeVWAP returns the VWAP and the volume of two sets of trades.
+func mergeVWAP(vwap, volume, otherVWAP, otherVolume float64) (float64, float64) {
+	total := volume + otherVolume
+	if total == 0 {
+		return 0, 0
+	}
+	return (vwap*volume + otherVWAP*otherVolume) / total, total
+}
+
+// historyCompaction counts what a compaction of the history did.
+type historyCompaction struct {
+	prices, hours, hourly, days, dropped int
+}
+
+func (c historyCompaction) String() string {
+	return fmt.Sprintf("%d prices compacted into %d new hours, %d hourly means into %d new days, %d days of daily statistics dropped",
+		c.prices, c.hours, c.hourly, c.days, c.dropped)
+}
+
+// compactHistory keeps the prices of the history of the last days market
+// days before that of now and compacts those of the days before into the
+// means of their hours, kept for hourlyDays days. The hourly means of the
+// days before are compacted into the statistics of their days, kept for
+// dailyDays days, forever when 0. Prices of an hour or hours of a day
+// compacted earlier are merged into its mean or statistics.
+func compactHistory(now time.Time, days, hourlyDays, dailyDays int) historyCompaction {
+	var c historyCompaction
+	local := now.In(ote.Location())
+	oldest := ote.Day(local.AddDate(0, 0, -days))
+	for start, price := range state.History {
+		if ote.Day(time.Unix(start, 0)) >= oldest {
+			continue
+		}
+		if state.HourlyPrices == nil {
+			state.HourlyPrices = make(map[int64]*hourlyPrices)
+		}
+		hour := time.Unix(start, 0).Truncate(time.Hour).Unix()
+		h := state.HourlyPrices[hour]
+		if h == nil {
+			h = new(hourlyPrices)
+			state.HourlyPrices[hour] = h
+			c.hours++
+		}
+		other := hourlyPrices{Mean: price, Points: 1}
+		if volume := state.HistoryVolumes[start]; volume > 0 {
+			other.VWAP, other.Volume = price, volume
+		}
+		h.add(other)
+		delete(state.History, start)
+		delete(state.HistoryVolumes, start)
+		c.prices++
+	}
+	oldest = ote.Day(local.AddDate(0, 0, -hourlyDays))
+	for hour, h := range state.HourlyPrices {
+		day := ote.Day(time.Unix(hour, 0))
+		if day >= oldest {
+			continue
+		}
+		if state.DailyPrices == nil {
+			state.DailyPrices = make(map[string]*dailyPrices)
+		}
+		d := state.DailyPrices[day]
+		if d == nil {
+			d = new(dailyPrices)
+			state.DailyPrices[day] = d
+			c.days++
+		}
+		d.add(dailyPrices{Mean: h.Mean, Min: h.Mean, Max: h.Mean, VWAP: h.VWAP, Volume: h.Volume, Hours: 1})
+		delete(state.HourlyPrices, hour)
+		c.hourly++
+	}
+	if dailyDays > 0 {
+		oldest = ote.Day(local.AddDate(0, 0, -dailyDays))
+		for day := range state.DailyPrices {
+			if day < oldest {
+				delete(state.DailyPrices, day)
+				c.dropped++
+			}
+		}
+	}
+	return c
+}
+
+// historyPrice returns the price of the hour starting at start from the
+// tier of the history holding it: its price or, once compacted, its hourly
+// mean, both exact, or the mean of its day once compacted further.
+func historyPrice(start time.Time) (price float64, exact, ok bool) {
+	if price, ok := state.History[start.Unix()]; ok {
+		return price, true, true
+	}
+	if h := state.HourlyPrices[start.Truncate(time.Hour).Unix()]; h != nil {
+		return h.Mean, true, true
+	}
+	if d := state.DailyPrices[ote.Day(start)]; d != nil {
+		return d.Mean, false, true
+	}
+	return 0, false, false
+}
+
+// runHistoryCompact compacts the history once, as the first cycle of each
+// day does, keeping the days of the configuration unless overridden.
+func runHistoryCompact(args []string) exitCode {
+	flags := flag.NewFlagSet("history compact", flag.ContinueOnError)
+	days := flags.Int("days", historyDays, "number of `days` of prices to keep")
+	hourlyDays := flags.Int("hourly-days", historyHourlyDays, "number of `days` of hourly means to keep")
+	dailyDays := flags.Int("daily-days", historyDailyDays, "number of `days` of daily statistics to keep, 0 for ever")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: epcp [--dry-run] history compact [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return parseExitCode(err)
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *days < forecastDays || *hourlyDays < *days || *dailyDays < 0 {
+		errorLogger.Printf("At least %d days of prices must be kept, the days the forecasts read, as many days of hourly means, and the daily days must not be negative.\n", forecastDays)
+		return exitUsage
+	}
+
+	lock, code := acquireLock(context.Background())
+	if lock == nil {
+		return code
+	}
+	defer lock.Release()
+	loadState()
+	c := compactHistory(cycleClock.Now(), *days, *hourlyDays, *dailyDays)
+	verb := "Compacted"
+	if dryRun {
+		verb = "Would compact"
+	} else if err := saveState(); err != nil {
+		errorLogger.Printf("Error writing state file %s: %s\n", stateFile(), err.Error())
+		return exitFailure
+	}
+	fmt.Printf("%s the history: %s.\n", verb, c)
+	fmt.Printf("It holds %d prices%s, the hourly means of %d hours%s and the daily statistics of %d days%s.\n",
+		len(state.History), historySpan(sortedKeys(hourDays(state.History))),
+		len(state.HourlyPrices), historySpan(sortedKeys(hourDays(state.HourlyPrices))),
+		len(state.DailyPrices), historySpan(sortedKeys(state.DailyPrices)))
+	return exitOK
+}
+
+// hourDays returns the market days of the hours of a tier of the history.
+func hourDays[V any](hours map[int64]V) map[string]bool {
+	days := make(map[string]bool)
+	for start := range hours {
+		days[ote.Day(time.Unix(start, 0))] = true
+	}
+	return days
+}
+
+// historySpan describes the sorted days as the span they cover.
+func historySpan(days []string) string {
+	if len(days) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" from %s to %s", days[0], days[len(days)-1])
+}
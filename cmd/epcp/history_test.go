@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/forecast"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/internal/store"
+)
+
+func TestHistoryImport(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("EPCP_STATE_DIR", dir)
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	history := func() forecast.History {
+		t.Helper()
+		var s State
+		if err := store.LoadJSON(filepath.Join(dir, "state.json"), &s); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return s.History
+	}
+	price := func(day string, hour int) float64 {
+		start, _ := ote.HourStart(day, hour)
+		return history()[start.Unix()]
+	}
+	report := write("report.csv", `Den;Hodina;Cena (EUR/MWh)
+4.3.2024;1;50,5
+4.3.2024;2;60
+4.3.2024;25;70
+4.3.2024;3;x
+`)
+
+	// A dry run only counts the prices
+	out, code := runEpcp(t, "--dry-run", "history", "import", "--file", report, "--format", "ote-csv")
+	if code != exitOK || !strings.Contains(out, "Would import 2 prices from "+report+": 2 inserted, 0 overwritten, 0 duplicates skipped, 2 malformed rows.") {
+		t.Errorf("exit code %d:\n%s", code, out)
+	}
+	if len(history()) != 0 {
+		t.Errorf("history %v after a dry run, want none", history())
+	}
+
+	// Strictly, a malformed row imports nothing
+	if out, code := runEpcp(t, "history", "import", "--file", report, "--format", "ote-csv", "--strict"); code != exitFailure || len(history()) != 0 {
+		t.Errorf("exit code %d, history %v, want nothing imported:\n%s", code, history(), out)
+	}
+
+	out, code = runEpcp(t, "history", "import", "--file", report, "--format", "ote-csv")
+	if code != exitOK || !strings.Contains(out, "Imported 2 prices from "+report+": 2 inserted, 0 overwritten, 0 duplicates skipped, 2 malformed rows.") {
+		t.Errorf("exit code %d:\n%s", code, out)
+	}
+	if len(history()) != 2 || price("2024-03-04", 1) != 50.5 || price("2024-03-04", 2) != 60 {
+		t.Errorf("history %v, want the first two hours of 2024-03-04", history())
+	}
+
+	// Duplicates are skipped or overwritten; the generic file is in UTC
+	generic := write("prices.csv", "start,eur\n2024-03-04 00:00,65\n2024-03-04 02:00,80\n")
+	args := []string{"history", "import", "--file", generic, "--time-column", "start", "--price-column", "eur", "--time-layout", "2006-01-02 15:04", "--timezone", "UTC"}
+	out, code = runEpcp(t, args...)
+	if code != exitOK || !strings.Contains(out, "1 inserted, 0 overwritten, 1 duplicates skipped, 0 malformed rows.") {
+		t.Errorf("exit code %d:\n%s", code, out)
+	}
+	if price("2024-03-04", 2) != 60 || price("2024-03-04", 4) != 80 {
+		t.Errorf("history %v, want the duplicate skipped", history())
+	}
+	out, code = runEpcp(t, append(args, "--duplicates", "overwrite")...)
+	if code != exitOK || !strings.Contains(out, "0 inserted, 2 overwritten, 0 duplicates skipped") || price("2024-03-04", 2) != 65 {
+		t.Errorf("exit code %d, history %v, want the duplicate overwritten:\n%s", code, history(), out)
+	}
+
+	if out, code := runEpcp(t, append(args, "--duplicates", "merge")...); code != exitUsage {
+		t.Errorf("exit code %d with unknown duplicate handling, want %d:\n%s", code, exitUsage, out)
+	}
+}
+
+// seedHistory adds the hours of the market days from from to to, including
+// both, to the history, priced ten times their index plus the month.
+func seedHistory(t *testing.T, history forecast.History, from, to time.Time) {
+	t.Helper()
+	err := ote.EachDay(ote.Day(from), ote.Day(to), func(day string, hours int) error {
+		for hour := 1; hour <= hours; hour++ {
+			start, err := ote.HourStart(day, hour)
+			if err != nil {
+				return err
+			}
+			history.Add(start, float64(10*hour+int(start.Month())))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// seededMonths sets up a state with the hourly prices of 2024-01-01 to
+// 2024-05-14 and returns the noon of 2024-05-15.
+func seededMonths(t *testing.T) time.Time {
+	t.Helper()
+	setGlobal(t, &state, &State{History: make(forecast.History)})
+	seedHistory(t, state.History, time.Date(2024, time.January, 1, 0, 0, 0, 0, ote.Location()),
+		time.Date(2024, time.May, 14, 0, 0, 0, 0, ote.Location()))
+	return time.Date(2024, time.May, 15, 12, 0, 0, 0, ote.Location())
+}
+
+// rounded rounds the mean of the statistics to cents.
+func rounded(d dailyPrices) dailyPrices {
+	d.Mean = math.Round(d.Mean*100) / 100
+	return d
+}
+
+// hourStart returns the start of the trading hour, failing the test when
+// the day has no such hour.
+func hourStart(t *testing.T, day string, hour int) time.Time {
+	t.Helper()
+	start, err := ote.HourStart(day, hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return start
+}
+
+func TestCompactHistory(t *testing.T) {
+	now := seededMonths(t)
+	state.HistoryVolumes = forecast.History{
+		hourStart(t, "2024-03-04", 1).Unix(): 10,
+		hourStart(t, "2024-03-04", 2).Unix(): 30,
+		hourStart(t, "2024-04-20", 5).Unix(): 5,
+	}
+	// The prices of 2024-01-01 to 2024-05-04, 125 days less the hour of the
+	// switch to summer time, the hourly means of those to 2024-04-14, 105
+	// days, and the daily statistics of those before 2024-02-15 dropped at
+	// once
+	want := historyCompaction{prices: 125*24 - 1, hours: 125*24 - 1, hourly: 105*24 - 1, days: 105, dropped: 45}
+	if c := compactHistory(now, 10, 30, 90); c != want {
+		t.Errorf("compaction %+v, want %+v", c, want)
+	}
+	if days := sortedKeys(hourDays(state.History)); len(state.History) != 10*24 || days[0] != "2024-05-05" || days[len(days)-1] != "2024-05-14" {
+		t.Errorf("%d prices of %v, want those of 2024-05-05 to 2024-05-14", len(state.History), days)
+	}
+	if len(state.HistoryVolumes) != 0 {
+		t.Errorf("volumes %v of compacted prices kept", state.HistoryVolumes)
+	}
+	if days := sortedKeys(hourDays(state.HourlyPrices)); len(state.HourlyPrices) != 20*24 || days[0] != "2024-04-15" || days[len(days)-1] != "2024-05-04" {
+		t.Errorf("%d hourly means of %v, want those of 2024-04-15 to 2024-05-04", len(state.HourlyPrices), days)
+	}
+	hour := hourStart(t, "2024-04-20", 5)
+	if got := state.HourlyPrices[hour.Unix()]; got == nil || *got != (hourlyPrices{Mean: 54, VWAP: 54, Volume: 5, Points: 1}) {
+		t.Errorf("hourly mean %+v, want the price with its volume", got)
+	}
+	if days := sortedKeys(state.DailyPrices); len(days) != 60 || days[0] != "2024-02-15" || days[len(days)-1] != "2024-04-14" {
+		t.Errorf("daily statistics of %v, want those of 2024-02-15 to 2024-04-14", days)
+	}
+	for day, want := range map[string]dailyPrices{
+		// The VWAP of the two hours with a volume
+		"2024-03-04": {Mean: 128, Min: 13, Max: 243, VWAP: 20.5, Volume: 40, Hours: 24},
+		"2024-03-31": {Mean: 123, Min: 13, Max: 233, Hours: 23},
+		"2024-04-14": {Mean: 129, Min: 14, Max: 244, Hours: 24},
+	} {
+		if got := state.DailyPrices[day]; got == nil || rounded(*got) != want {
+			t.Errorf("%s: statistics %+v, want %+v", day, got, want)
+		}
+	}
+
+	// Nothing left to compact the second time
+	if c := compactHistory(now, 10, 30, 90); c != (historyCompaction{}) {
+		t.Errorf("second compaction %+v, want none", c)
+	}
+	// A late price of an hour compacted is merged into its mean, without a
+	// volume not into its VWAP
+	state.History.Add(hour, 100)
+	if c := compactHistory(now, 10, 30, 90); c != (historyCompaction{prices: 1}) {
+		t.Errorf("compaction of a late price %+v, want the price merged", c)
+	}
+	if got := state.HourlyPrices[hour.Unix()]; *got != (hourlyPrices{Mean: 77, VWAP: 54, Volume: 5, Points: 2}) {
+		t.Errorf("hourly mean %+v with the late price", got)
+	}
+	// and a late hour of a day compacted into its statistics
+	state.History.Add(hourStart(t, "2024-03-04", 1), 1000)
+	if c := compactHistory(now, 10, 30, 90); c != (historyCompaction{prices: 1, hours: 1, hourly: 1}) {
+		t.Errorf("compaction of a late hour %+v, want the hour merged", c)
+	}
+	if got := state.DailyPrices["2024-03-04"]; rounded(*got) != (dailyPrices{Mean: 162.88, Min: 13, Max: 1000, VWAP: 20.5, Volume: 40, Hours: 25}) {
+		t.Errorf("statistics %+v with the late hour", got)
+	}
+
+	// Without the daily days the statistics are kept for ever
+	compactHistory(now.AddDate(1, 0, 0), 10, 30, 0)
+	if len(state.History) != 0 || len(state.HourlyPrices) != 0 || len(state.DailyPrices) != 90 {
+		t.Errorf("%d prices, %d hourly means and %d days, want all compacted and kept", len(state.History), len(state.HourlyPrices), len(state.DailyPrices))
+	}
+}
+
+func TestHistoryPrice(t *testing.T) {
+	now := seededMonths(t)
+	compactHistory(now, 10, 30, 90)
+	tests := []struct {
+		day       string
+		hour      int
+		price     float64
+		exact, ok bool
+	}{
+		{"2024-05-14", 5, 55, true, true},
+		{"2024-05-05", 1, 15, true, true},
+		// The compacted hours read their hourly mean
+		{"2024-05-04", 24, 245, true, true},
+		{"2024-04-15", 1, 14, true, true},
+		// and then the mean of their day
+		{"2024-04-14", 1, 129, false, true},
+		{"2024-03-31", 3, 123, false, true},
+		{"2024-02-01", 1, 0, false, false},
+		{"2024-05-15", 1, 0, false, false},
+	}
+	for _, test := range tests {
+		start, err := ote.HourStart(test.day, test.hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if price, exact, ok := historyPrice(start); math.Round(price*100)/100 != test.price || exact != test.exact || ok != test.ok {
+			t.Errorf("%s %d: price %v, exact %t, %t, want %v, %t, %t", test.day, test.hour, price, exact, ok, test.price, test.exact, test.ok)
+		}
+	}
+}
+
+func TestHistoryRollover(t *testing.T) {
+	now := seededMonths(t)
+	logs := captureLogs(t)
+	setGlobal(t, &forecastName, "")
+	setGlobal(t, &historyDays, 30)
+	setGlobal(t, &historyHourlyDays, 60)
+	setGlobal(t, &historyDailyDays, 90)
+	midnight := time.Date(2024, time.May, 15, 0, 5, 0, 0, ote.Location())
+	setGlobal[clock](t, &cycleClock, &fixedClock{midnight})
+	state.HistoryCompacted = "2024-05-14"
+
+	recordHistory(context.Background(), nil)
+	if state.HistoryCompacted != "2024-05-15" || len(state.History) != 30*24 {
+		t.Errorf("compacted on %s to %d hourly prices, want on 2024-05-15 to 720", state.HistoryCompacted, len(state.History))
+	}
+	if !strings.Contains(logs.String(), "Compacted the history: 2519 prices compacted into 2519 new hours, 1800 hourly means into 75 new days, 45 days of daily statistics dropped\n") {
+		t.Errorf("the compaction not logged:\n%s", logs)
+	}
+
+	// Once a day
+	seedHistory(t, state.History, time.Date(2024, time.April, 1, 0, 0, 0, 0, ote.Location()), time.Date(2024, time.April, 1, 0, 0, 0, 0, ote.Location()))
+	setGlobal[clock](t, &cycleClock, &fixedClock{now})
+	recordHistory(context.Background(), nil)
+	if len(state.History) != 31*24 {
+		t.Errorf("%d hourly prices, want the day added kept until the next day", len(state.History))
+	}
+
+	// The volumes are recorded with the prices, for the VWAPs
+	setGlobal(t, &forecastName, "persistence")
+	points := otetest.Points("2024-05-15", 12, 80, 90)
+	points[0].Volume = 12.5
+	recordHistory(context.Background(), points)
+	if v := state.HistoryVolumes; len(v) != 1 || v[points[0].Start.Unix()] != 12.5 {
+		t.Errorf("volumes %v, want the 12.5 MWh of hour 12", v)
+	}
+}
+
+func TestHistoryCompact(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("EPCP_STATE_DIR", dir)
+	path := filepath.Join(dir, "state.json")
+	load := func() *State {
+		t.Helper()
+		var s State
+		if err := store.LoadJSON(path, &s); err != nil {
+			t.Fatal(err)
+		}
+		return &s
+	}
+	// The 40 days before today, the 30 of them older than 10 days compacted
+	// into hourly means, the 25 older than 15 days into daily statistics and
+	// the 20 older than 20 days dropped
+	today := time.Now().In(ote.Location())
+	seeded := State{History: make(forecast.History)}
+	seedHistory(t, seeded.History, today.AddDate(0, 0, -40), today.AddDate(0, 0, -1))
+	prices, hourly := 0, 0
+	for start := range seeded.History {
+		switch day := ote.Day(time.Unix(start, 0)); {
+		case day < ote.Day(today.AddDate(0, 0, -15)):
+			hourly++
+			fallthrough
+		case day < ote.Day(today.AddDate(0, 0, -10)):
+			prices++
+		}
+	}
+	if err := store.SaveJSON(path, &seeded); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%d prices compacted into %d new hours, %d hourly means into 25 new days, 20 days of daily statistics dropped.\n", prices, prices, hourly)
+	args := []string{"history", "compact", "--days", "10", "--hourly-days", "15", "--daily-days", "20"}
+
+	out, code := runEpcp(t, append([]string{"--dry-run"}, args...)...)
+	if code != exitOK || !strings.Contains(out, "Would compact the history: "+want) {
+		t.Errorf("exit code %d:\n%s", code, out)
+	}
+	if s := load(); len(s.History) != len(seeded.History) || len(s.HourlyPrices) != 0 || len(s.DailyPrices) != 0 {
+		t.Errorf("%d prices, %d hourly means and %d days after a dry run, want nothing compacted", len(s.History), len(s.HourlyPrices), len(s.DailyPrices))
+	}
+
+	out, code = runEpcp(t, args...)
+	span := fmt.Sprintf(" from %s to %s, the hourly means of %d hours from %s to %s and the daily statistics of 5 days from ",
+		ote.Day(today.AddDate(0, 0, -10)), ote.Day(today.AddDate(0, 0, -1)), prices-hourly, ote.Day(today.AddDate(0, 0, -15)), ote.Day(today.AddDate(0, 0, -11)))
+	if code != exitOK || !strings.Contains(out, "Compacted the history: "+want) || !strings.Contains(out, span) {
+		t.Errorf("exit code %d:\n%s", code, out)
+	}
+	if s := load(); len(s.History) != len(seeded.History)-prices || len(s.HourlyPrices) != prices-hourly || len(s.DailyPrices) != 5 {
+		t.Errorf("%d prices, %d hourly means and %d days, want %d, %d and 5", len(s.History), len(s.HourlyPrices), len(s.DailyPrices), len(seeded.History)-prices, prices-hourly)
+	}
+
+	// The forecasts read a week of prices, and the hourly means are kept
+	// at least as long
+	for _, args := range [][]string{{"--days", "3"}, {"--days", "10", "--hourly-days", "5"}} {
+		if out, code := runEpcp(t, append([]string{"history", "compact"}, args...)...); code != exitUsage {
+			t.Errorf("exit code %d with %v, want %d:\n%s", code, args, exitUsage, out)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// influxExporter writes one point per cycle in the InfluxDB line protocol,
+// either appended to a file or via the /api/v2/write endpoint. Lines are
+// buffered until batch lines are pending and flushed on shutdown.
+// https://docs.influxdata.com/influxdb/v2/reference/syntax/line-protocol/
+type influxExporter struct {
+	mu     sync.Mutex
+	file   string
+	url    string
+	org    string
+	bucket string
+	token  string
+	batch  int
+	lines  []string
+}
+
+// influxMaxPending bounds the buffer when the server is unreachable.
+const influxMaxPending = 1000
+
+var influx *influxExporter
+
+var (
+	influxTagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+)
+
+// influxLine encodes a point; tags are written sorted by key as recommended.
+func influxLine(measurement string, tags [][2]string, fields string, t time.Time) string {
+	var b strings.Builder
+	b.WriteString(influxMeasurementEscaper.Replace(measurement))
+	for _, tag := range tags {
+		if tag[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ",%s=%s", influxTagEscaper.Replace(tag[0]), influxTagEscaper.Replace(tag[1]))
+	}
+	fmt.Fprintf(&b, " %s %d", fields, t.UnixNano())
+	return b.String()
+}
+
+// vwap returns the volume weighted average price of the points.
+func vwap(points []ote.PricePoint) float64 {
+	var sum, volume float64
+	for _, p := range points {
+		sum += p.Price * p.Volume
+		volume += p.Volume
+	}
+	if volume == 0 {
+		return 0
+	}
+	return sum / volume
+}
+
+// cycleLine encodes the cycle as an epcp point at the decision time.
+func cycleLine(result *cycleResult) string {
+	hostname, _ := os.Hostname()
+	decision := result.Decision
+	fields := fmt.Sprintf("target_khz=%di,applied_cpus=%di,fetch_ms=%di",
+		decision.Frequency, len(decision.Summary.Succeeded), result.FetchDuration.Milliseconds())
+	if len(result.Points) != 0 {
+		fields = fmt.Sprintf("price=%g,vwap=%g,", result.Prices[len(result.Prices)-1], vwap(result.Points)) + fields
+	}
+	if decision.Provisional {
+		fields += ",provisional=true"
+	}
+	if decision.RunID != "" {
+		fields += fmt.Sprintf(`,run_id="%s"`, decision.RunID)
+	}
+	tags := [][2]string{{"band", decision.Band}, {"host", hostname}, {"source", decisionSource(decision)}}
+	return influxLine("epcp", tags, fields, decision.Time)
+}
+
+// decisionSource names the source of the prices the decision was based on:
+// forecast or profile for predicted prices, else the failover source that
+// served them or the configured one.
+func decisionSource(decision *Decision) string {
+	switch {
+	case decision.Forecast:
+		return ote.SourceForecast
+	case decision.Profile:
+		return ote.SourceProfile
+	case sourceFailover != nil && sourceFailover.Active() != "":
+		return sourceFailover.Active()
+	case effectiveConfig.Source.Type != "":
+		return effectiveConfig.Source.Type
+	}
+	return "ote"
+}
+
+func (x *influxExporter) add(line string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.lines = append(x.lines, line)
+	if len(x.lines) > influxMaxPending {
+		x.lines = x.lines[len(x.lines)-influxMaxPending:]
+	}
+}
+
+func (x *influxExporter) pending() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.lines)
+}
+
+// flush writes the pending lines; they are kept for the next flush on failure.
+func (x *influxExporter) flush(ctx context.Context) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if len(x.lines) == 0 {
+		return nil
+	}
+	body := strings.Join(x.lines, "\n") + "\n"
+	var err error
+	if x.file != "" {
+		err = appendFile(x.file, body)
+	} else {
+		err = x.post(ctx, body)
+	}
+	if err == nil {
+		x.lines = nil
+	}
+	return err
+}
+
+func appendFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (x *influxExporter) post(ctx context.Context, body string) error {
+	query := url.Values{"org": {x.org}, "bucket": {x.bucket}, "precision": {"ns"}}
+	endpoint := strings.TrimSuffix(x.url, "/") + "/api/v2/write?" + query.Encode()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if x.token != "" {
+		req.Header.Set("Authorization", "Token "+x.token)
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %s", res.Status)
+	}
+	return nil
+}
+
+// writeInflux buffers the cycle point and flushes full batches.
+func writeInflux(ctx context.Context, result *cycleResult) {
+	if influx == nil || result.Decision == nil {
+		return
+	}
+	influx.add(cycleLine(result))
+	if influx.pending() < influx.batch {
+		return
+	}
+	if err := influx.flush(ctx); err != nil {
+		errorLog(ctx).Printf("Error writing to InfluxDB: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestInfluxLine(t *testing.T) {
+	at := time.Date(2024, time.October, 1, 10, 0, 0, 123, time.UTC)
+	tests := []struct {
+		measurement string
+		tags        [][2]string
+		want        string
+	}{
+		{"epcp", [][2]string{{"band", "cheap"}, {"host", "node1"}}, "epcp,band=cheap,host=node1 price=80 1727776800000000123"},
+		{"epcp", [][2]string{{"host", "rack 1,node=2"}}, `epcp,host=rack\ 1\,node\=2 price=80 1727776800000000123`},
+		{"cpu frequency,epcp", [][2]string{{"a b", "c"}}, `cpu\ frequency\,epcp,a\ b=c price=80 1727776800000000123`},
+		// Tags without a value are left out
+		{"epcp", [][2]string{{"band", ""}, {"host", "node1"}}, "epcp,host=node1 price=80 1727776800000000123"},
+	}
+	for _, test := range tests {
+		if got := influxLine(test.measurement, test.tags, "price=80", at); got != test.want {
+			t.Errorf("influxLine(%q, %v) = %q, want %q", test.measurement, test.tags, got, test.want)
+		}
+	}
+}
+
+func TestCycleLine(t *testing.T) {
+	hostname, _ := os.Hostname()
+	at := time.Date(2024, time.October, 1, 10, 0, 0, 0, time.UTC)
+	decision := &Decision{Time: at, Band: policy.Expensive, Frequency: 800000, RunID: "01J9"}
+	decision.Summary.Succeeded = []int{0, 1}
+	result := &cycleResult{
+		Points:        []ote.PricePoint{{Price: 100, Volume: 1}, {Price: 130, Volume: 3}},
+		Prices:        []float64{100, 130},
+		FetchDuration: 42 * time.Millisecond,
+		Decision:      decision,
+	}
+	want := `epcp,band=expensive,host=` + influxTagEscaper.Replace(hostname) + `,source=ote price=130,vwap=122.5,target_khz=800000i,applied_cpus=2i,fetch_ms=42i,run_id="01J9" 1727776800000000000`
+	if got := cycleLine(result); got != want {
+		t.Errorf("cycleLine = %q, want %q", got, want)
+	}
+
+	// The source is that of the prices the decision was based on
+	c := *effectiveConfig
+	c.Source.Type = "synthetic"
+	setGlobal(t, &effectiveConfig, &c)
+	if got := cycleLine(result); !strings.Contains(got, ",source=synthetic ") {
+		t.Errorf("cycleLine on the synthetic source = %q, want source=synthetic", got)
+	}
+	decision.Forecast = true
+	if got := cycleLine(result); !strings.Contains(got, ",source=forecast ") {
+		t.Errorf("cycleLine on forecast prices = %q, want source=forecast", got)
+	}
+}
+
+func TestInfluxWrite(t *testing.T) {
+	captureLogs(t)
+	var mu sync.Mutex
+	var requests []*http.Request
+	var bodies []string
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	setGlobal(t, &influx, &influxExporter{url: server.URL + "/", org: "cerit", bucket: "epcp", token: "secret", batch: 2})
+	cycle := func(band string) *cycleResult {
+		return &cycleResult{Decision: &Decision{Time: time.Now(), Band: band, Frequency: 800000}}
+	}
+
+	// The lines are batched
+	writeInflux(context.Background(), cycle(policy.Cheap))
+	if len(requests) != 0 || influx.pending() != 1 {
+		t.Fatalf("%d writes with %d lines pending, want none with 1", len(requests), influx.pending())
+	}
+	writeInflux(context.Background(), cycle(policy.Expensive))
+	if len(requests) != 1 || influx.pending() != 0 {
+		t.Fatalf("%d writes with %d lines pending, want 1 with none", len(requests), influx.pending())
+	}
+	r := requests[0]
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v2/write" || r.URL.Query().Get("org") != "cerit" ||
+		r.URL.Query().Get("bucket") != "epcp" || r.URL.Query().Get("precision") != "ns" || r.Header.Get("Authorization") != "Token secret" {
+		t.Errorf("write %s %s with authorization %q", r.Method, r.URL, r.Header.Get("Authorization"))
+	}
+	lines := strings.Split(strings.TrimSuffix(bodies[0], "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "epcp,band=cheap,") || !strings.HasPrefix(lines[1], "epcp,band=expensive,") {
+		t.Errorf("written %q, want the two cycles", bodies[0])
+	}
+
+	// The lines of a failed write are kept for the next one
+	fail = true
+	writeInflux(context.Background(), cycle(policy.Cheap))
+	writeInflux(context.Background(), cycle(policy.Cheap))
+	if influx.pending() != 2 {
+		t.Errorf("%d lines pending after a failed write, want 2", influx.pending())
+	}
+	fail = false
+	writeInflux(context.Background(), cycle(policy.Cheap))
+	if n := strings.Count(bodies[len(bodies)-1], "\n"); n != 3 || influx.pending() != 0 {
+		t.Errorf("%d lines written after the failure with %d pending, want 3 and none", n, influx.pending())
+	}
+
+	// A partial batch is flushed on shutdown
+	path := filepath.Join(t.TempDir(), "epcp.influx")
+	setGlobal(t, &influx, &influxExporter{file: path, batch: 10})
+	writeInflux(context.Background(), cycle(policy.Expensive))
+	setGlobal(t, &state, new(State))
+	setGlobal(t, &stateDir, t.TempDir())
+	setGlobal(t, &restoreOnExit, false)
+	shutdown(false)
+	content, err := os.ReadFile(path)
+	if err != nil || strings.Count(string(content), "\n") != 1 {
+		t.Errorf("file %q, %v after the shutdown, want the cycle", content, err)
+	}
+}
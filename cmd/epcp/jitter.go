@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"os"
+	"time"
+)
+
+// jitterDelay returns a delay below limit derived from the hostname, so that
+// every host keeps the same offset across runs.
+func jitterDelay(hostname string, limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(hostname))
+	return time.Duration(h.Sum64() % uint64(limit))
+}
+
+// hostJitter returns the jitter delay of this host.
+func hostJitter() time.Duration {
+	hostname, err := os.Hostname()
+	if err != nil {
+		errorLogger.Printf("Error getting hostname: %s\n", err.Error())
+	}
+	return jitterDelay(hostname, jitter)
+}
+
+// sleepJitter waits for the jitter delay and reports whether ctx is still alive.
+func sleepJitter(ctx context.Context) bool {
+	delay := hostJitter()
+	if delay == 0 {
+		return true
+	}
+	infoLogger.Printf("Waiting %s before fetching prices\n", delay.Round(time.Millisecond))
+	select {
+	case <-ctx.Done():
+		return false
+	case <-cycleClock.After(delay):
+		return true
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJitterDelay(t *testing.T) {
+	tests := []struct {
+		hostname string
+		limit    time.Duration
+		want     time.Duration
+	}{
+		{"node1.example.org", 5 * time.Minute, 4*time.Minute + 36189172704*time.Nanosecond},
+		{"node2.example.org", 5 * time.Minute, 2*time.Minute + 16279463957*time.Nanosecond},
+		{"node1.example.org", 0, 0},
+		{"node1.example.org", -time.Minute, 0},
+	}
+	for _, test := range tests {
+		// The delay of a host is the same on every run
+		for i := 0; i < 2; i++ {
+			if got := jitterDelay(test.hostname, test.limit); got != test.want {
+				t.Errorf("jitterDelay(%q, %s) = %s, want %s", test.hostname, test.limit, got, test.want)
+			}
+		}
+	}
+	for _, limit := range []time.Duration{time.Nanosecond, time.Second, time.Hour} {
+		if got := jitterDelay("node1.example.org", limit); got < 0 || got >= limit {
+			t.Errorf("jitterDelay with limit %s = %s, out of [0, %s)", limit, got, limit)
+		}
+	}
+}
+
+func TestSleepJitter(t *testing.T) {
+	logs := captureLogs(t)
+	setGlobal(t, &jitter, time.Hour)
+	if hostJitter() == 0 {
+		t.Skip("the hostname has no jitter")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if sleepJitter(ctx) {
+		t.Error("sleepJitter returned true after the cancellation")
+	}
+	if want := "Waiting " + hostJitter().Round(time.Millisecond).String(); !strings.Contains(logs.String(), want) {
+		t.Errorf("the delay not logged, want %q:\n%s", want, logs)
+	}
+
+	setGlobal(t, &jitter, 0)
+	if !sleepJitter(context.Background()) {
+		t.Error("sleepJitter without jitter returned false")
+	}
+}
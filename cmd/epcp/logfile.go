@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// rotatingFile is a log file rotated by size: path is renamed to path.1,
+// path.1 to path.2 and so on, keeping maxBackups old files. It is safe for
+// concurrent use.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error rotating log file %s: %s\n", r.path, err.Error())
+		}
+	}
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups and starts a new file; it is called with the lock held.
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	r.file = nil
+	os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxBackups))
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if r.maxBackups > 0 {
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// reopen reopens the file after it was moved away, e.g. by logrotate.
+func (r *rotatingFile) reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	return r.open()
+}
+
+// parseSize parses a size in bytes with an optional K, M or G suffix.
+func parseSize(value string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// setupLogFile redirects the loggers to the configured file, keeping errors
+// on stderr, and reopens the file on SIGUSR1.
+func setupLogFile(config LogConfig) {
+	path := config.File
+	if len(path) == 0 {
+		return
+	}
+	maxSize, maxBackups := int64(10<<20), 5
+	if size, err := parseSize(config.MaxSize); err == nil {
+		maxSize = size
+	}
+	if config.MaxBackups != nil {
+		maxBackups = *config.MaxBackups
+	}
+	file, err := openRotatingFile(path, maxSize, maxBackups)
+	if err != nil {
+		errorLogger.Printf("Error opening log file %s: %s\n", path, err.Error())
+		return
+	}
+	infoLogger.SetOutput(file)
+	errorLogger.SetOutput(io.MultiWriter(file, os.Stderr))
+	if len(reopenSignals) == 0 {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, reopenSignals...)
+	go func() {
+		for range ch {
+			if err := file.reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error reopening log file %s: %s\n", path, err.Error())
+			}
+		}
+	}()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "epcp.log")
+	file, err := openRotatingFile(path, 256, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { file.file.Close() }()
+
+	// Goroutines writing lines at once lose none of them
+	const goroutines, lines = 8, 50
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				fmt.Fprintf(file, "goroutine %d line %02d\n", g, i)
+			}
+		}()
+	}
+	wg.Wait()
+	seen := make(map[string]bool)
+	for i := 0; ; i++ {
+		name := path
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d", path, i)
+		}
+		content, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(content) > 256 {
+			t.Errorf("%s has %d bytes, want at most 256", name, len(content))
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+			if seen[line] {
+				t.Errorf("line %q written twice", line)
+			}
+			seen[line] = true
+		}
+	}
+	if len(seen) != goroutines*lines {
+		t.Errorf("%d lines written, want %d", len(seen), goroutines*lines)
+	}
+
+	// The oldest backups beyond maxBackups are removed
+	dir := t.TempDir()
+	kept, err := openRotatingFile(filepath.Join(dir, "epcp.log"), 8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { kept.file.Close() }()
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(kept, "line %d\n", i)
+	}
+	for name, want := range map[string]string{"epcp.log": "line 9\n", "epcp.log.1": "line 8\n", "epcp.log.2": "line 7\n"} {
+		if content, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(content) != want {
+			t.Errorf("%s: %q, %v, want %q", name, content, err, want)
+		}
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 3 {
+		t.Errorf("files %v, %v, want the log and 2 backups", entries, err)
+	}
+
+	// The file is reopened after it was moved away
+	if err := os.Rename(path, path+".rotated"); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.reopen(); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(file, "after reopening")
+	if content, err := os.ReadFile(path); err != nil || string(content) != "after reopening\n" {
+		t.Errorf("reopened file %q, %v", content, err)
+	}
+}
+
+func TestLogFileBackups(t *testing.T) {
+	setGlobal[[]os.Signal](t, &reopenSignals, nil)
+	tests := []struct {
+		name, config string
+		backup       bool
+	}{
+		{"default", "", true},
+		{"none", "    max_backups: 0\n", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			captureLogs(t)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "epcp.yaml")
+			content := "outputs:\n  log:\n    file: " + filepath.Join(dir, "epcp.log") + "\n    max_size: 8\n" + test.config
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := loadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setupLogFile(config.Outputs.Log)
+			infoLogger.Println("line 1")
+			infoLogger.Println("line 2")
+			if _, err := os.Stat(filepath.Join(dir, "epcp.log.1")); (err == nil) != test.backup {
+				t.Errorf("backup kept %t, want %t", err == nil, test.backup)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"512", 512},
+		{"64K", 64 << 10},
+		{"10M", 10 << 20},
+		{"1G", 1 << 30},
+		{"", 0},
+		{"0", 0},
+		{"-1M", 0},
+		{"10MB", 0},
+	}
+	for _, test := range tests {
+		got, err := parseSize(test.value)
+		if got != test.want || (err != nil) != (test.want == 0) {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", test.value, got, err, test.want)
+		}
+	}
+}
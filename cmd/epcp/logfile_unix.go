@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals make the log file to be reopened, for logrotate.
+var reopenSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// reopenSignals is empty as Windows has no SIGUSR1.
+var reopenSignals []os.Signal
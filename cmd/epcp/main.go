@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+var (
+	infoLogger    *log.Logger
+	errorLogger   *log.Logger
+	historyWindow time.Duration
+	cycleInterval time.Duration
+	stateDir      string
+	decisionLog   string
+	restoreOnExit bool
+	lockWait      time.Duration
+	listenAddress string
+	applyHelper   string
+	applySocket   string
+	requireSysfs  bool
+	strict        bool
+	otlpEndpoint  string
+	jitter        time.Duration
+	damWatchStart time.Duration
+	damWatchEnd   time.Duration
+	damWatchPoll  time.Duration
+	controlSocket string
+	debugListen   string
+	textfile      string
+	simulate      bool
+	priceSource   ote.PriceSource = ote.NewClient(ote.WithDriftHandler(warnSchemaDrift), ote.WithCallHandler(logOTECall))
+)
+
+// Times is the window of trading hours the prices are fetched for, from the
+// hour start falls in to the one end falls in.
+type Times struct {
+	start time.Time
+	end   time.Time
+}
+
+func init() {
+	infoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	errorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+// logFetchError logs an error of the ote client; missing data is expected,
+// e.g. before the prices are published, so it is logged as info.
+func logFetchError(ctx context.Context, what string, err error) {
+	if e.Is(err, ote.ErrNoData) {
+		infoLog(ctx).Printf("No %s: %s\n", what, err.Error())
+		return
+	}
+	errorLog(ctx).Printf("Error fetching %s: %s\n", what, err.Error())
+}
+
+// warnSchemaDrift warns about a response of OTE only decoded by ignoring its
+// namespaces: the prices are still used, but the service changed.
+func warnSchemaDrift(operation, drift string) {
+	errorLogger.Printf("WARNING: the schema of the OTE responses drifted, %s: %s\n", operation, drift)
+	metrics.addCounter("epcp_ote_schema_drift_total", "Number of OTE responses decoded by ignoring their namespaces.", 1, "operation", operation)
+}
+
+// logOTECall logs a request to OTE with its identifiers, to reference it
+// with OTE support.
+func logOTECall(ctx context.Context, call ote.Call) {
+	server := ""
+	if call.ServerID != "" && call.ServerID != call.RequestID {
+		server = ", server " + call.ServerID
+	}
+	if call.Err != nil {
+		infoLog(ctx).Printf("OTE %s request %s%s failed after %s\n", call.Operation, call.RequestID, server, call.Duration.Round(time.Millisecond))
+		return
+	}
+	infoLog(ctx).Printf("OTE %s request %s%s took %s\n", call.Operation, call.RequestID, server, call.Duration.Round(time.Millisecond))
+}
+
+func logPrices(ctx context.Context, points []ote.PricePoint) {
+	for _, s := range points {
+		infoLog(ctx).Printf("Date: %s Hour: %d Price: %s Volume: %.1f\n", s.Date, s.Hour, display.price(s.Price), s.Volume)
+	}
+}
+
+// Vraci hodnotu energie a cenu v EUR po hodinách z denního trhu s elektřinou pro zadané období. (pro
+// agentury)
+func getDamPriceE(ctx context.Context, startDate, endDate string) ([]float64, error) {
+	points, err := getDamPoints(ctx, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return ote.Prices(points), nil
+}
+
+// getDamPoints fetches the day-ahead prices of the days, inclusive.
+func getDamPoints(ctx context.Context, startDate, endDate string) ([]ote.PricePoint, error) {
+	points, err := priceSource.DamPrices(ctx, startDate, endDate)
+	if err != nil {
+		logFetchError(ctx, "day-ahead prices", err)
+		return nil, err
+	}
+	logPrices(ctx, points)
+	return points, nil
+}
+
+// GetDamIndexE Vraci indexy krátkodobého obchodu za elektřinu pro zadané období.
+//
+// neviem, ci to chapem spravne, ale vracia cenu za ktoru sa predala eletrina
+// na base/peak/offpeak load na ten den - je to asi blokovy trh podla
+// https://www.ote-cr.cz/cs/kratkodobe-trhy/elektrina/files-informace-vdt-vt/trh_s_elektrinou.pdf
+//
+// It logs the indexes and reports whether any day has the emergency flag set.
+func GetDamIndexE(ctx context.Context, startDate, endDate string) (bool, error) {
+	indexes, err := priceSource.DamIndex(ctx, startDate, endDate)
+	if err != nil {
+		logFetchError(ctx, "day-ahead indexes", err)
+		return false, err
+	}
+	emergency := false
+	for _, index := range indexes {
+		infoLog(ctx).Printf("Date: %s BaseLoad: %s, PeakLoad: %s, OffPeakLoad: %s\n", index.Date,
+			display.price(index.BaseLoad), display.price(index.PeakLoad), display.price(index.OffpeakLoad))
+		if index.Emergency {
+			emergency = true
+		}
+	}
+	return emergency, nil
+}
+
+// getTimeRange returns the trading hours from the one historyWindow ago up
+// to the current one.
+func getTimeRange() *Times {
+	return timeRange(cycleClock.Now(), historyWindow)
+}
+
+// timeRange returns the trading hours of the window ending at now.
+func timeRange(now time.Time, window time.Duration) *Times {
+	return &Times{start: now.Add(-window), end: now}
+}
+
+// getElectrictyPrices fetches the intraday prices of the window. The errors
+// are those of the ote package, see fetchPrices for how they are handled.
+func getElectrictyPrices(ctx context.Context, times *Times) ([]ote.PricePoint, error) {
+	infoLog(ctx).Println("------- Function Call: GetImPriceE vnitrodenna cena-------")
+	points, err := ote.FetchWindow(ctx, priceSource, times.start, times.end)
+	if err != nil {
+		logFetchError(ctx, "intraday prices", err)
+		return points, err
+	}
+	markProvisional(points, cycleClock.Now())
+	logPrices(ctx, points)
+	return points, nil
+}
+
+// Decision describes the frequency chosen for the current price trend.
+type Decision struct {
+	Time      time.Time `json:"time"`
+	Band      string    `json:"band"`
+	Frequency int       `json:"frequency"`
+	// Target is the target of the band, resolved on each CPU, see
+	// frequencyTarget
+	Target string `json:"target,omitempty"`
+	// RunID identifies the cycle in logs and outputs
+	RunID string `json:"runId,omitempty"`
+	// Summary of the CPUs that accepted the frequency
+	Summary applySummary `json:"summary"`
+	// Simulated is set when no cpufreq interface was available
+	Simulated bool `json:"simulated,omitempty"`
+	// StateOfCharge of the battery in percent, when there is one
+	StateOfCharge *float64 `json:"stateOfCharge,omitempty"`
+	// Nodes maps the configured NUMA nodes to their frequency, which their
+	// CPUs get instead of Frequency
+	Nodes map[int]int `json:"nodes,omitempty"`
+	// Achieved are the frequencies the CPUs ran at after applying
+	Achieved *achievedFrequency `json:"achieved,omitempty"`
+	// Forecast is set when the decision was based on forecast prices
+	Forecast bool `json:"forecast,omitempty"`
+	// Profile is set when the decision was based on the price profile, see
+	// profilePrices
+	Profile bool `json:"profile,omitempty"`
+	// Reason notes why the frequency differs from that of the band
+	Reason string `json:"reason,omitempty"`
+	// Maintenance is set when the decision fell in a maintenance window
+	Maintenance bool `json:"maintenance,omitempty"`
+	// Stale is set when the decision was based on stale prices, see
+	// checkStaleness
+	Stale bool `json:"stale,omitempty"`
+	// Provisional is set when the decision took the price of the hour
+	// still trading into account, see markProvisional
+	Provisional bool `json:"provisional,omitempty"`
+	// SafeMode is the safe mode the decision was made in, see
+	// adjustForSafeMode
+	SafeMode string `json:"safeMode,omitempty"`
+	// Price is the newest price the decision was made on, in EUR/MWh, see
+	// costReport
+	Price *float64 `json:"price,omitempty"`
+	// FetchError is the error of fetching the prices, with the identifiers
+	// of the failed request to OTE, see ote.ErrRequest
+	FetchError string `json:"fetchError,omitempty"`
+	// BootGrace is set when the decision lowered the frequencies during
+	// the boot grace period and was not applied, see adjustForBootGrace
+	BootGrace bool `json:"bootGrace,omitempty"`
+	// Actuators are the outcomes of the actuators that applied the
+	// decision, in order, see runActuators
+	Actuators []actuatorOutcome `json:"actuators,omitempty"`
+	// DayType is the type of the day the decision was made on, see
+	// calendar.DayTypes
+	DayType string `json:"dayType,omitempty"`
+}
+
+// cyclePolicy decides the band of the cycles, see PolicyConfig.
+var cyclePolicy policy.Policy = policy.Trend{}
+
+// decideFrequency chooses the frequency from the price trend, or returns nil
+// when there are too few prices.
+func decideFrequency(ctx context.Context, prices []float64) *Decision {
+	now := cycleClock.Now()
+	day := dayType(now)
+	band, err := dayPolicy(day).Band(metricValues(prices))
+	if err != nil {
+		infoLog(ctx).Printf("Only %d prices available, the policy cannot decide.\n", len(prices))
+		return nil
+	}
+	frequencies := availableFrequencies()
+	infoLog(ctx).Printf("Deciding on a %s\n", day)
+	decision := &Decision{Time: now, DayType: day, Simulated: simulate || dryRun}
+	decision.setBand(band, frequencies)
+	return decision
+}
+
+// logTrend logs the price trend the band of decision follows. It is logged
+// once for the cycle, not by decideFrequency, which the backtests call for
+// every hour.
+func logTrend(ctx context.Context, decision *Decision) {
+	if decision == nil {
+		return
+	}
+	if decision.Band == policy.Expensive {
+		infoLog(ctx).Println("Prices are increasing over the last three hours.")
+	} else {
+		infoLog(ctx).Println("Prices are decreasing over the last three hours.")
+	}
+}
+
+// applyDecision writes the decided frequency to the managed CPUs. It returns
+// nil when the decision was not applied because of a shutdown.
+func applyDecision(ctx context.Context, decision *Decision) *Decision {
+	// Once started, the writes are finished so that the CPUs are never left
+	// half-scaled; a shutdown requested before that skips them entirely.
+	if ctx.Err() != nil {
+		infoLog(ctx).Println("Shutting down, not applying the decision.")
+		return nil
+	}
+	if paused.Load() {
+		infoLog(ctx).Println("Paused, not applying the decision.")
+		return decision
+	}
+	if decision.Maintenance && maintenanceFrequency == 0 {
+		infoLog(ctx).Println("Scaling suppressed (maintenance window), not applying the decision.")
+		return decision
+	}
+	if decision.BootGrace {
+		infoLog(ctx).Println("Scaling down suppressed (boot grace period), not applying the decision.")
+		return decision
+	}
+	if decision.SafeMode == safeHold {
+		infoLog(ctx).Println("Safe mode holds the current frequencies, not applying the decision.")
+		return decision
+	}
+	recordOriginalFrequencies()
+	if state.AppliedTargets == nil {
+		state.AppliedTargets = make(map[int]int)
+	}
+	var cpus []int
+	targets := make(map[int]int)
+	for _, i := range hostCPUs() {
+		if !cpuOnline(i) {
+			decision.Summary.skip(i)
+			continue
+		}
+		target := decision.cpuFrequency(i)
+		if leftExternal(i, target) {
+			decision.Summary.leave(i)
+			continue
+		}
+		cpus = append(cpus, i)
+		targets[i] = target
+	}
+	// CPUs sharing a cpufreq policy are written once through it
+	grouped := frequencyWrites(cpus, targets)
+	// Rewriting the frequency the CPUs already have only churns udev, inotify
+	// watchers and the logs
+	grouped = slices.DeleteFunc(grouped, func(g frequencyWrite) bool {
+		current, err := actuator.ReadFile(sysfs, g.write.Path)
+		if err != nil || strings.TrimSpace(current) != g.write.Value {
+			return false
+		}
+		for _, cpu := range g.cpus {
+			decision.Summary.keep(cpu)
+			state.AppliedTargets[cpu] = targets[cpu]
+		}
+		metrics.addCounter("epcp_unchanged_writes_total", "Number of frequency writes skipped as the value was already set.", 1)
+		return true
+	})
+	writes := make([]actuator.Write, len(grouped))
+	for i, g := range grouped {
+		writes[i] = g.write
+	}
+	// The writes are not cancelled by ctx, see above.
+	for i, err := range frequencyActuator.Apply(context.WithoutCancel(ctx), writes) {
+		if err != nil {
+			errorLog(ctx).Printf("Error writing frequency %s to path %s: %s\n", writes[i].Value, writes[i].Path, err.Error())
+		}
+		for _, cpu := range grouped[i].cpus {
+			if err != nil {
+				decision.Summary.fail(cpu, err)
+			} else {
+				decision.Summary.succeed(cpu)
+				state.AppliedTargets[cpu] = targets[cpu]
+			}
+		}
+	}
+	slices.Sort(decision.Summary.Succeeded)
+	slices.Sort(decision.Summary.Unchanged)
+	if len(decision.Nodes) != 0 {
+		infoLog(ctx).Printf("Scaling to frequency %d, NUMA nodes to %v: %s\n", decision.Frequency, decision.Nodes, decision.Summary)
+	} else {
+		infoLog(ctx).Printf("Scaling to frequency %d: %s\n", decision.Frequency, decision.Summary)
+	}
+	return decision
+}
+
+// availableFrequencies returns the frequencies offered by the first CPU.
+func availableFrequencies() []int {
+	var frequencies []int
+	for _, frequency := range getAvailableCPUFrequencies(cpuPath(0, "cpufreq", "scaling_available_frequencies")) {
+		if f, err := strconv.Atoi(frequency); err == nil {
+			frequencies = append(frequencies, f)
+		}
+	}
+	return frequencies
+}
+
+func getAvailableCPUFrequencies(path string) []string {
+	fc, err := actuator.ReadFile(sysfs, path)
+	if err != nil {
+		errorLogger.Printf("Error reading available frequencies: %s\n", err.Error())
+		return nil
+	}
+	return strings.Fields(fc)
+}
+
+func main() {
+	os.Exit(int(run()))
+}
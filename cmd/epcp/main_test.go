@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	e "errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+func TestMain(m *testing.M) {
+	// The test binary runs as epcp itself for runEpcp
+	if os.Getenv("EPCP_TEST_MAIN") == "1" {
+		main()
+	}
+	infoLogger = log.New(io.Discard, "INFO: ", 0)
+	errorLogger = log.New(io.Discard, "ERROR: ", 0)
+	os.Exit(m.Run())
+}
+
+// runEpcp runs epcp with the arguments in a process of its own, so that the
+// commands setting up the whole program leave the tests alone. It returns
+// the standard output and the exit code; the standard error is logged.
+func runEpcp(t *testing.T, args ...string) (string, exitCode) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "EPCP_TEST_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !e.As(err, &exit) {
+		t.Fatal(err)
+	}
+	if stderr.Len() != 0 {
+		t.Logf("epcp %s:\n%s", strings.Join(args, " "), stderr.String())
+	}
+	return stdout.String(), exitCode(cmd.ProcessState.ExitCode())
+}
+
+// setGlobal sets the package variable p to v for the duration of the test.
+func setGlobal[T any](t testing.TB, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of loggers.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs returns the logs of the test, info and errors interleaved.
+func captureLogs(t testing.TB) *syncBuffer {
+	t.Helper()
+	logs := new(syncBuffer)
+	setGlobal(t, &infoLogger, log.New(logs, "INFO: ", 0))
+	setGlobal(t, &errorLogger, log.New(logs, "ERROR: ", 0))
+	return logs
+}
+
+// simulatedSysfs makes the test scale cpus simulated CPUs through a tree
+// under /sys offering the frequencies, SimulatedFrequencies by default,
+// starting from an empty state. It returns the tree.
+func simulatedSysfs(t testing.TB, cpus int, frequencies ...string) *actuator.MemFS {
+	t.Helper()
+	if len(frequencies) == 0 {
+		frequencies = actuator.SimulatedFrequencies
+	}
+	tree := actuator.SimulatedTreeWith("/sys", cpus, frequencies)
+	useSysfs(t, tree)
+	return tree
+}
+
+// useSysfs makes the test scale the CPUs of fsys, a tree under /sys,
+// starting from an empty state.
+func useSysfs(t testing.TB, fsys actuator.Filesystem) {
+	t.Helper()
+	setGlobal(t, &sysfsRoot, "/sys")
+	setGlobal(t, &sysfs, fsys)
+	setGlobal[actuator.Actuator](t, &frequencyActuator, actuator.Sysfs{FS: fsys})
+	setGlobal(t, &state, new(State))
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	forgetSysfs()
+	t.Cleanup(forgetSysfs)
+}
+
+// tempSysfs materializes a cpufreq tree of the CPUs like that of
+// sysfsFiles, with the topology and driver files of a real host, under a
+// temporary directory and makes the test scale them through the OS. It
+// returns the directory, the sysfs root of the test.
+func tempSysfs(t testing.TB, cpus int) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		actuator.Path(root, "devices", "system", "cpu", "present"):  fmt.Sprintf("0-%d\n", cpus-1),
+		actuator.Path(root, "devices", "system", "cpu", "online"):   fmt.Sprintf("0-%d\n", cpus-1),
+		actuator.Path(root, "devices", "system", "cpu", "possible"): fmt.Sprintf("0-%d\n", cpus-1),
+	}
+	for path, content := range sysfsFiles(cpus) {
+		files[actuator.Path(root, strings.TrimPrefix(path, "/sys"))] = content
+	}
+	for cpu := 0; cpu < cpus; cpu++ {
+		for name, content := range map[string]string{
+			"cpuinfo_min_freq": "800000\n",
+			"cpuinfo_max_freq": "3200000\n",
+			"scaling_cur_freq": "3200000\n",
+			"scaling_driver":   "acpi-cpufreq\n",
+			"scaling_governor": "schedutil\n",
+			"affected_cpus":    strconv.Itoa(cpu) + "\n",
+			"related_cpus":     strconv.Itoa(cpu) + "\n",
+		} {
+			files[actuator.CPUPath(root, cpu, "cpufreq", name)] = content
+		}
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	useSysfs(t, actuator.OSFS{})
+	setGlobal(t, &sysfsRoot, root)
+	return root
+}
+
+// sysfsFiles returns the files of a cpufreq tree under /sys of the CPUs
+// offering SimulatedFrequencies and running at the highest, to be extended
+// and passed to actuator.NewMemFS.
+func sysfsFiles(cpus int) map[string]string {
+	files := make(map[string]string)
+	for cpu := 0; cpu < cpus; cpu++ {
+		files[actuator.CPUPath("/sys", cpu, "cpufreq", "scaling_available_frequencies")] = "800000 1600000 2400000 3200000\n"
+		files[actuator.CPUPath("/sys", cpu, "cpufreq", "scaling_max_freq")] = "3200000\n"
+		files[actuator.CPUPath("/sys", cpu, "cpufreq", "scaling_min_freq")] = "800000\n"
+	}
+	return files
+}
+
+// forgetSysfs drops what was read once from sysfs: the NUMA topology, the
+// cpufreq policies and the frequency tables.
+func forgetSysfs() {
+	numaTopologyOnce = sync.Once{}
+	numaTopology = nil
+	cpufreqPoliciesOnce = sync.Once{}
+	cpufreqPolicies = nil
+	cpuTablesMu.Lock()
+	cpuTables = make(map[int]cpuTable)
+	cpuTablesMu.Unlock()
+}
+
+// readSysfs returns the trimmed content of the sysfs file, failing the test
+// when it cannot be read.
+func readSysfs(t testing.TB, fsys actuator.Filesystem, path string) string {
+	t.Helper()
+	content, err := actuator.ReadFile(fsys, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(content)
+}
+
+// priceFunc is an ote.PriceSource pricing every trading hour by its start,
+// for the intraday and day-ahead markets alike.
+type priceFunc func(start time.Time) float64
+
+func (f priceFunc) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	var points []ote.PricePoint
+	for hour := fromHour; hour <= toHour; hour++ {
+		start, err := ote.HourStart(day, hour)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, ote.PricePoint{Date: day, Hour: hour, Start: start, Price: f(start), Volume: 10})
+	}
+	return points, nil
+}
+
+func (f priceFunc) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	var points []ote.PricePoint
+	err := ote.EachDay(from, to, func(day string, hours int) error {
+		dayPoints, err := f.ImPrices(ctx, day, 1, hours)
+		points = append(points, dayPoints...)
+		return err
+	})
+	return points, err
+}
+
+func (f priceFunc) DamIndex(ctx context.Context, from, to string) ([]ote.DamIndex, error) {
+	return nil, ote.ErrNoData
+}
+
+// trend returns the prices of a trend through 500 EUR/MWh at now, step
+// higher each hour: expensive to the trend policy when step is positive,
+// cheap when negative.
+func trend(now time.Time, step float64) priceFunc {
+	return func(start time.Time) float64 {
+		return 500 + step*start.Sub(now).Hours()
+	}
+}
+
+func TestTrendLoggedOncePerCycle(t *testing.T) {
+	runOnMocks(t, trend(time.Now(), 10))
+	logs := captureLogs(t)
+	runCycle(context.Background())
+	if n := strings.Count(logs.String(), "Prices are increasing"); n != 1 {
+		t.Errorf("trend logged %d times in a cycle, want once:\n%s", n, logs)
+	}
+	before := len(logs.String())
+	for i := 0; i < 3; i++ {
+		decideFrequency(context.Background(), []float64{1, 2, 3, 4})
+	}
+	if strings.Contains(logs.String()[before:], "Prices are") {
+		t.Errorf("decideFrequency logged the trend:\n%s", logs.String()[before:])
+	}
+}
+
+func TestWarnSchemaDrift(t *testing.T) {
+	logs := captureLogs(t)
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	body := bytes.Replace(otetest.DamPriceResponse(otetest.Points("2024-10-01", 1, 90, 95)),
+		[]byte(`xmlns="http://www.ote-cr.cz/schema/service/public"`), []byte(`xmlns="http://www.ote-cr.cz/schema/service/public/v2"`), 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+	setGlobal[ote.PriceSource](t, &priceSource, ote.NewClient(ote.WithEndpoint(server.URL), ote.WithDriftHandler(warnSchemaDrift)))
+
+	// The prices are still used
+	for range 2 {
+		if points, err := getDamPoints(context.Background(), "2024-10-01", "2024-10-01"); err != nil || len(points) != 2 {
+			t.Fatalf("points %v, %v, want those of the drifted response", points, err)
+		}
+	}
+	if !strings.Contains(logs.String(), `WARNING: the schema of the OTE responses drifted, GetDamPriceE: the GetDamPriceEResponse element is in "http://www.ote-cr.cz/schema/service/public/v2"`) {
+		t.Errorf("the drift not logged:\n%s", logs)
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	if !strings.Contains(exposition.String(), `epcp_ote_schema_drift_total{operation="GetDamPriceE"} 2`+"\n") {
+		t.Errorf("metrics without the drift:\n%s", exposition.String())
+	}
+}
+
+func TestOTERequestID(t *testing.T) {
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(ote.RequestIDHeader))
+		w.Header().Set("X-Correlation-ID", "ote-42")
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	runOnMocks(t, ote.NewClient(ote.WithEndpoint(server.URL), ote.WithCallHandler(logOTECall)))
+	logs := captureLogs(t)
+	setGlobal(t, &safeMode, safeMax)
+
+	d := runCycle(context.Background()).Decision
+	if len(ids) != 1 || ids[0] == "" {
+		t.Fatalf("request IDs %q, want one", ids)
+	}
+	if !strings.Contains(logs.String(), "OTE GetImPriceE request "+ids[0]+", server ote-42 failed after ") {
+		t.Errorf("the request not logged:\n%s", logs)
+	}
+	// The decision log quotes the request
+	if want := "(request " + ids[0] + ", server ote-42)"; d == nil || !strings.HasSuffix(d.FetchError, want) {
+		t.Errorf("decision %+v, want the fetch error ending with %s", d, want)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// maintenanceWindows suspend scaling, see ScheduleConfig
+	maintenanceWindows []maintenanceWindow
+	// maintenanceFrequency is forced during the windows; 0 holds the
+	// frequencies the CPUs have
+	maintenanceFrequency int
+)
+
+// weekdays maps the abbreviated names of the days to them.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// maintenanceWindow is a clockRange on the days it starts on.
+type maintenanceWindow struct {
+	clockRange
+	days [7]bool
+}
+
+// parseMaintenanceWindow parses "[days ]HH:MM-HH:MM", the days a comma
+// separated list of names or ranges like mon-fri, every day without them.
+func parseMaintenanceWindow(value string) (maintenanceWindow, error) {
+	var w maintenanceWindow
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return w, fmt.Errorf("invalid window %q, expected [days ]HH:MM-HH:MM", value)
+	}
+	if len(fields) == 1 {
+		for day := range w.days {
+			w.days[day] = true
+		}
+	} else {
+		for _, days := range strings.Split(strings.ToLower(fields[0]), ",") {
+			first, last, _ := strings.Cut(days, "-")
+			if last == "" {
+				last = first
+			}
+			from, ok := weekdays[first]
+			to, okTo := weekdays[last]
+			if !ok || !okTo {
+				return w, fmt.Errorf("invalid days %q in window %q, expected e.g. mon-fri or sat,sun", days, value)
+			}
+			for day := from; ; day = (day + 1) % 7 {
+				w.days[day] = true
+				if day == to {
+					break
+				}
+			}
+		}
+	}
+	var err error
+	if w.clockRange, err = parseClockRange(fields[len(fields)-1]); err != nil {
+		return w, fmt.Errorf("invalid window %q: %w", value, err)
+	}
+	return w, nil
+}
+
+// contains reports whether t falls in the window, in the location of t.
+func (w maintenanceWindow) contains(t time.Time) bool {
+	if w.start < w.end {
+		return w.days[t.Weekday()] && w.clockRange.contains(t)
+	}
+	// Crossing midnight: the evening of a day or the morning after it
+	if sinceMidnight(t) >= w.start {
+		return w.days[t.Weekday()]
+	}
+	return w.clockRange.contains(t) && w.days[(t.Weekday()+6)%7]
+}
+
+// clockRange is a daily range of time, from start to end after midnight. A
+// range ending before it starts crosses midnight and ends the next day.
+type clockRange struct {
+	start, end time.Duration
+}
+
+// parseClockRange parses "HH:MM-HH:MM".
+func parseClockRange(value string) (clockRange, error) {
+	var r clockRange
+	start, end, ok := strings.Cut(value, "-")
+	var err error
+	if r.start, err = parseClock(start); !ok || err != nil {
+		return r, fmt.Errorf("invalid range %q, expected HH:MM-HH:MM", value)
+	}
+	if r.end, err = parseClock(end); err != nil {
+		return r, fmt.Errorf("invalid range %q, expected HH:MM-HH:MM", value)
+	}
+	if r.start == r.end {
+		return r, fmt.Errorf("empty range %q", value)
+	}
+	return r, nil
+}
+
+// contains reports whether the time of day of t falls in the range.
+func (r clockRange) contains(t time.Time) bool {
+	clock := sinceMidnight(t)
+	if r.start < r.end {
+		return clock >= r.start && clock < r.end
+	}
+	return clock >= r.start || clock < r.end
+}
+
+// overlaps reports whether the ranges share a time of day.
+func (r clockRange) overlaps(other clockRange) bool {
+	for _, a := range r.segments() {
+		for _, b := range other.segments() {
+			if a[0] < b[1] && b[0] < a[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// segments splits the range at midnight.
+func (r clockRange) segments() [][2]time.Duration {
+	if r.start < r.end {
+		return [][2]time.Duration{{r.start, r.end}}
+	}
+	return [][2]time.Duration{{r.start, 24 * time.Hour}, {0, r.end}}
+}
+
+// sinceMidnight returns the time of day of t, in its location.
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+}
+
+// inMaintenance reports whether t falls in a maintenance window, in the
+// market timezone.
+func inMaintenance(t time.Time) bool {
+	t = inMarketTime(t)
+	for _, w := range maintenanceWindows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// suspended reports whether the decision is not applied by the actuators
+// beyond the frequencies, during maintenance, when the safe mode holds or
+// during the boot grace period.
+func (d *Decision) suspended() bool {
+	return d.Maintenance || d.SafeMode == safeHold || d.BootGrace
+}
+
+// adjustForMaintenance suspends scaling during the maintenance windows: the
+// decision is marked, and either forces maintenanceFrequency or is not
+// applied at all.
+func adjustForMaintenance(ctx context.Context, decision *Decision) {
+	if decision == nil || !inMaintenance(decision.Time) {
+		return
+	}
+	decision.Maintenance = true
+	if maintenanceFrequency == 0 {
+		return
+	}
+	infoLog(ctx).Printf("Scaling suppressed (maintenance window), forcing frequency %d\n", maintenanceFrequency)
+	decision.Frequency, decision.Nodes, decision.Target = maintenanceFrequency, nil, ""
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	valid := map[string][7]bool{
+		"02:00-04:00":             {true, true, true, true, true, true, true},
+		"mon-fri 08:00-18:00":     {false, true, true, true, true, true, false},
+		"sat,sun 22:00-06:00":     {true, false, false, false, false, false, true},
+		"Fri-Mon 23:30-00:30":     {true, true, false, false, false, true, true},
+		"tue,thu-fri 12:00-13:00": {false, false, true, false, true, true, false},
+	}
+	for value, days := range valid {
+		w, err := parseMaintenanceWindow(value)
+		if err != nil || w.days != days {
+			t.Errorf("%q: days %v, %v, want %v", value, w.days, err, days)
+		}
+	}
+	for _, value := range []string{"", "02:00", "02:00-02:00", "25:00-04:00", "daily 02:00-04:00", "mon-fri", "mon 02:00-04:00 extra"} {
+		if _, err := parseMaintenanceWindow(value); err == nil {
+			t.Errorf("%q: no error", value)
+		}
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	prague := ote.Location()
+	// 1 October 2024 is a Tuesday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.October, day, hour, minute, 0, 0, prague)
+	}
+	tests := []struct {
+		window string
+		at     time.Time
+		want   bool
+	}{
+		{"02:00-04:00", at(1, 1, 59), false},
+		{"02:00-04:00", at(1, 2, 0), true},
+		{"02:00-04:00", at(1, 3, 59), true},
+		{"02:00-04:00", at(1, 4, 0), false},
+		// Crossing midnight
+		{"22:00-06:00", at(1, 23, 0), true},
+		{"22:00-06:00", at(2, 5, 59), true},
+		{"22:00-06:00", at(2, 6, 0), false},
+		{"22:00-06:00", at(1, 21, 59), false},
+		// The morning belongs to the window of the day before
+		{"mon 22:00-06:00", at(1, 5, 0), true},
+		{"mon 22:00-06:00", at(1, 23, 0), false},
+		{"tue 22:00-06:00", at(1, 5, 0), false},
+		{"tue 22:00-06:00", at(1, 23, 0), true},
+		{"tue 22:00-06:00", at(2, 1, 0), true},
+		{"sat,sun 02:00-04:00", at(5, 3, 0), true},
+		{"sat,sun 02:00-04:00", at(7, 3, 0), false},
+	}
+	for _, test := range tests {
+		w, err := parseMaintenanceWindow(test.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := w.contains(test.at); got != test.want {
+			t.Errorf("%q contains %s: %t, want %t", test.window, test.at.Format("Mon 15:04"), got, test.want)
+		}
+	}
+
+	// The windows are in the market timezone
+	w, _ := parseMaintenanceWindow("02:00-04:00")
+	setGlobal(t, &maintenanceWindows, []maintenanceWindow{w})
+	if !inMaintenance(at(1, 3, 0).UTC()) || inMaintenance(time.Date(2024, time.October, 1, 3, 0, 0, 0, time.UTC)) {
+		t.Error("the window not in the market timezone")
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	// 03:00 on Tuesday 1 October 2024, during the nightly backups
+	now := time.Date(2024, time.October, 1, 3, 0, 0, 0, ote.Location())
+	tree := runOnMocks(t, trend(now, 10))
+	logs := captureLogs(t)
+	fixed := &fixedClock{now}
+	setGlobal[clock](t, &cycleClock, fixed)
+	backups, _ := parseMaintenanceWindow("02:00-04:00")
+	setGlobal(t, &maintenanceWindows, []maintenanceWindow{backups})
+	setGlobal(t, &maintenanceFrequency, 0)
+	maxFreq := func() string { return readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")) }
+
+	// Inside the window the frequencies are held
+	result := runCycle(context.Background())
+	if result.Decision == nil || !result.Decision.Maintenance || maxFreq() != "3200000" {
+		t.Fatalf("decision %+v, scaling_max_freq %s, want the frequencies held", result.Decision, maxFreq())
+	}
+	if !strings.Contains(logs.String(), "Scaling suppressed (maintenance window), not applying the decision.") {
+		t.Errorf("the suppression not logged:\n%s", logs)
+	}
+
+	// or forced
+	setGlobal(t, &maintenanceFrequency, 2400000)
+	if result := runCycle(context.Background()); !result.Decision.Maintenance || maxFreq() != "2400000" {
+		t.Errorf("decision %+v, scaling_max_freq %s, want 2400000 forced", result.Decision, maxFreq())
+	}
+	if !strings.Contains(logs.String(), "Scaling suppressed (maintenance window), forcing frequency 2400000") {
+		t.Errorf("the forced frequency not logged:\n%s", logs)
+	}
+
+	// Outside the window the decision is applied
+	fixed.now = now.Add(time.Hour)
+	if result := runCycle(context.Background()); result.Decision == nil || result.Decision.Maintenance || maxFreq() != "800000" {
+		t.Errorf("decision %+v, scaling_max_freq %s, want the expensive 800000", result.Decision, maxFreq())
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricFamily is a gauge or counter with its samples keyed by the rendered
+// label set, and the exemplars of the counter samples keyed alike.
+type metricFamily struct {
+	help      string
+	kind      string
+	samples   map[string]float64
+	exemplars map[string]exemplar
+}
+
+// exemplar is the OpenMetrics exemplar of the last increase of a counter
+// sample, e.g. by the cycle of a run ID.
+type exemplar struct {
+	labels string
+	value  float64
+	time   time.Time
+}
+
+// metricsRegistry holds the metrics exported on /metrics and in the textfile.
+type metricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+var metrics = &metricsRegistry{families: make(map[string]*metricFamily)}
+
+var (
+	// scaleFailures counts the last cycles in a row that failed to scale
+	scaleFailures int
+	// priceThreshold is the high price alert threshold, see WebhookConfig
+	priceThreshold *float64
+)
+
+// labelString renders label name/value pairs in the exposition format.
+func labelString(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		fmt.Fprintf(&b, `%s="%s"`, labels[i], value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func (r *metricsRegistry) family(name, help, kind string) *metricFamily {
+	f, ok := r.families[name]
+	if !ok {
+		f = &metricFamily{help: help, kind: kind, samples: make(map[string]float64), exemplars: make(map[string]exemplar)}
+		r.families[name] = f
+	}
+	return f
+}
+
+// setGauge sets the gauge sample with the given label name/value pairs.
+func (r *metricsRegistry) setGauge(name, help string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, "gauge").samples[labelString(labels)] = value
+}
+
+// resetGauge removes all samples of the gauge, e.g. before setting the current band.
+func (r *metricsRegistry) resetGauge(name, help string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.family(name, help, "gauge").samples)
+}
+
+// addCounter increases the counter sample with the given label name/value pairs.
+func (r *metricsRegistry) addCounter(name, help string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.family(name, help, "counter").samples[labelString(labels)] += value
+}
+
+// addCounterExemplar increases the counter sample like addCounter and makes
+// the exemplar label name/value pairs its exemplar.
+func (r *metricsRegistry) addCounterExemplar(name, help string, value float64, exemplarLabels []string, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.family(name, help, "counter")
+	l := labelString(labels)
+	f.samples[l] += value
+	f.exemplars[l] = exemplar{labels: labelString(exemplarLabels), value: value, time: time.Now()}
+}
+
+// write renders all metrics in the Prometheus text exposition format, which
+// has no exemplars.
+func (r *metricsRegistry) write(w io.Writer) error {
+	return r.render(w, false)
+}
+
+// writeOpenMetrics renders all metrics in the OpenMetrics text format, with
+// the exemplars of the counters.
+func (r *metricsRegistry) writeOpenMetrics(w io.Writer) error {
+	if err := r.render(w, true); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
+
+func (r *metricsRegistry) render(w io.Writer, openMetrics bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		f := r.families[name]
+		// OpenMetrics names the counter families without the suffix of
+		// their samples
+		family := name
+		if openMetrics && f.kind == "counter" {
+			family = strings.TrimSuffix(name, "_total")
+		}
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family, f.help, family, f.kind); err != nil {
+			return err
+		}
+		labels := make([]string, 0, len(f.samples))
+		for l := range f.samples {
+			labels = append(labels, l)
+		}
+		slices.Sort(labels)
+		for _, l := range labels {
+			value := strconv.FormatFloat(f.samples[l], 'g', -1, 64)
+			if ex, ok := f.exemplars[l]; ok && openMetrics {
+				value += fmt.Sprintf(" # %s %s %.3f", ex.labels, strconv.FormatFloat(ex.value, 'g', -1, 64), float64(ex.time.UnixMilli())/1000)
+			}
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", name, l, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// recordCycleMetrics updates the metrics after a cycle.
+func recordCycleMetrics(result *cycleResult) {
+	prices, decision := result.Prices, result.Decision
+	now := float64(time.Now().Unix())
+	runID := ""
+	if decision != nil {
+		runID = decision.RunID
+	}
+	if runID != "" {
+		metrics.addCounterExemplar("epcp_cycles_total", "Number of cycles run.", 1, []string{"run_id", runID})
+	} else {
+		metrics.addCounter("epcp_cycles_total", "Number of cycles run.", 1)
+	}
+	metrics.setGauge("epcp_last_run_timestamp_seconds", "Time of the last cycle.", now)
+	recordSourceMetrics()
+	recordDerivedMetrics(result)
+	recordDayAheadMetrics()
+	if len(prices) == 0 {
+		metrics.addCounter("epcp_fetch_failures_total", "Number of cycles without prices.", 1)
+	} else {
+		metrics.setGauge("epcp_last_fetch_timestamp_seconds", "Time of the last successful price fetch.", now)
+		metrics.setGauge("epcp_price", "Last intraday price.", prices[len(prices)-1])
+	}
+	if decision == nil {
+		return
+	}
+	metrics.setGauge("epcp_target_frequency_khz", "Frequency chosen by the last decision.", float64(decision.Frequency))
+	summary := decision.Summary
+	metrics.setGauge("epcp_applied_cpus", "Number of CPUs that accepted the last decision.", float64(len(summary.Succeeded)))
+	metrics.setGauge("epcp_apply_cpus", "Number of CPUs by outcome of the last decision.", float64(len(summary.Succeeded)), "result", "succeeded")
+	metrics.setGauge("epcp_apply_cpus", "Number of CPUs by outcome of the last decision.", float64(len(summary.Unchanged)), "result", "unchanged")
+	metrics.setGauge("epcp_apply_cpus", "Number of CPUs by outcome of the last decision.", float64(len(summary.Failed)), "result", "failed")
+	metrics.setGauge("epcp_apply_cpus", "Number of CPUs by outcome of the last decision.", float64(len(summary.Skipped)), "result", "skipped")
+	metrics.setGauge("epcp_apply_cpus", "Number of CPUs by outcome of the last decision.", float64(len(summary.External)), "result", "external")
+	for _, class := range summary.Failed {
+		metrics.addCounter("epcp_apply_failures_total", "Number of failed per-CPU writes by error class.", 1, "class", class)
+	}
+	recordNodeMetrics(decision)
+	if a := decision.Achieved; a != nil {
+		metrics.setGauge("epcp_achieved_frequency_khz", "Frequency achieved by the CPUs after the last decision.", float64(a.Min), "stat", "min")
+		metrics.setGauge("epcp_achieved_frequency_khz", "Frequency achieved by the CPUs after the last decision.", float64(a.Avg), "stat", "avg")
+		metrics.setGauge("epcp_achieved_frequency_khz", "Frequency achieved by the CPUs after the last decision.", float64(a.Max), "stat", "max")
+	}
+	metrics.resetGauge("epcp_band", "Price band of the last decision.")
+	metrics.setGauge("epcp_band", "Price band of the last decision.", 1, "band", decision.Band)
+}
+
+// recordDerivedMetrics updates the metrics alert rules use directly, on
+// failed cycles too. The band changes are counted against the last decision,
+// which logDecision only replaces after the metrics.
+func recordDerivedMetrics(result *cycleResult) {
+	now := cycleClock.Now()
+	fetched := status.started
+	if state.Prices != nil {
+		fetched = state.Prices.Time
+	}
+	metrics.setGauge("epcp_hours_since_successful_fetch", "Hours since the prices were last fetched.", now.Sub(fetched).Hours())
+	// A cycle that wrote nothing, e.g. without prices, neither fails nor
+	// succeeds to scale
+	switch result.exitCode() {
+	case exitOK:
+		scaleFailures = 0
+	case exitApplyFailed:
+		scaleFailures++
+	}
+	metrics.setGauge("epcp_consecutive_scale_failures", "Number of the last cycles in a row that failed to scale.", float64(scaleFailures))
+	if decision, last := result.Decision, state.LastDecision; decision != nil && last != nil &&
+		decision.Band != "" && last.Band != "" && decision.Band != last.Band {
+		metrics.addCounter("epcp_band_change_total", "Number of band changes.", 1, "from", last.Band, "to", decision.Band)
+	}
+	if prices := result.Prices; priceThreshold != nil && *priceThreshold > 0 && len(prices) != 0 {
+		metrics.setGauge("epcp_price_vs_threshold_ratio", "Last price relative to the high price alert threshold.",
+			prices[len(prices)-1] / *priceThreshold)
+	}
+}
+
+// writeTextfile writes the metrics for the node_exporter textfile collector.
+// The file is replaced atomically so that a partial file is never read.
+func writeTextfile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := metrics.write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+var (
+	metricComment = regexp.MustCompile(`^# (HELP [a-zA-Z_:][a-zA-Z0-9_:]* .*|TYPE [a-zA-Z_:][a-zA-Z0-9_:]* (gauge|counter))$`)
+	metricSample  = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{[a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*"(,[a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*")*\})? (\S+)$`)
+)
+
+// checkExposition checks the metrics against the text exposition format:
+// every sample is valid and follows the TYPE of its family.
+func checkExposition(t *testing.T, content string) {
+	t.Helper()
+	if !strings.HasSuffix(content, "\n") {
+		t.Fatalf("the metrics do not end with a newline:\n%s", content)
+	}
+	typed := make(map[string]bool)
+	for i, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			if !metricComment.MatchString(line) {
+				t.Errorf("line %d: invalid comment %q", i+1, line)
+			}
+			if fields := strings.Fields(line); fields[1] == "TYPE" {
+				typed[fields[2]] = true
+			}
+			continue
+		}
+		match := metricSample.FindStringSubmatch(line)
+		if match == nil {
+			t.Errorf("line %d: invalid sample %q", i+1, line)
+			continue
+		}
+		if !typed[match[1]] {
+			t.Errorf("line %d: sample of %s before its TYPE", i+1, match[1])
+		}
+		if _, err := strconv.ParseFloat(match[len(match)-1], 64); err != nil {
+			t.Errorf("line %d: invalid value: %s", i+1, err)
+		}
+	}
+}
+
+func TestTextfile(t *testing.T) {
+	runOnMocks(t, trend(time.Now(), 10))
+	captureLogs(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "epcp.prom")
+	setGlobal(t, &textfile, path)
+	metrics.setGauge("epcp_test_info", "Labels needing escapes.", 1, "path", `C:\epcp "quoted"`+"\n")
+	start := time.Now()
+	runCycle(context.Background())
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExposition(t, string(content))
+	if !strings.Contains(string(content), `epcp_test_info{path="C:\\epcp \"quoted\"\n"} 1`) {
+		t.Errorf("label value not escaped:\n%s", content)
+	}
+	match := regexp.MustCompile(`(?m)^epcp_last_run_timestamp_seconds (\S+)$`).FindStringSubmatch(string(content))
+	if match == nil {
+		t.Fatalf("no epcp_last_run_timestamp_seconds:\n%s", content)
+	}
+	if ts, _ := strconv.ParseFloat(match[1], 64); ts < float64(start.Unix()) || ts > float64(time.Now().Unix()) {
+		t.Errorf("epcp_last_run_timestamp_seconds %s, want the time of the cycle %d", match[1], start.Unix())
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0644 {
+		t.Errorf("textfile permissions %o, want 644", perm)
+	}
+
+	// Readers never see a partial file while it is rewritten
+	for i := 0; i < 200; i++ {
+		metrics.setGauge("epcp_test_padding", "Padding the file.", float64(i), "sample", strconv.Itoa(i))
+	}
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			content, err := os.ReadFile(path)
+			if err != nil || !strings.HasSuffix(string(content), "\n") || !strings.Contains(string(content), "epcp_last_run_timestamp_seconds") {
+				t.Errorf("partial file read, %v:\n%s", err, content)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := writeTextfile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	// No temporary file is left behind
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("files %v, %v, want the textfile only", entries, err)
+	}
+}
+
+// metricValue returns the value of the sample of the metrics, with its
+// labels, or NaN when there is none.
+func metricValue(t *testing.T, sample string) float64 {
+	t.Helper()
+	var exposition strings.Builder
+	if err := metrics.write(&exposition); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(exposition.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, sample+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+	}
+	return math.NaN()
+}
+
+func TestDerivedMetrics(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 10, 0, 0, 0, ote.Location())
+	tree := runOnMocks(t, nil)
+	captureLogs(t)
+	fixed := &fixedClock{start}
+	setGlobal[clock](t, &cycleClock, fixed)
+	setGlobal(t, &status, &cycleStatus{started: start, frequencies: make(map[int]int)})
+	setGlobal(t, &scaleFailures, 0)
+	threshold := 400.0
+	setGlobal(t, &priceThreshold, &threshold)
+	readOnly := make(map[string]bool)
+	for cpu := range 2 {
+		readOnly[cpuPath(cpu, "cpufreq", "scaling_max_freq")] = true
+	}
+
+	steps := []struct {
+		name   string
+		source ote.PriceSource
+		// readOnly fails the writes of the frequencies
+		readOnly bool
+		hours    float64
+		failures float64
+		// changes are the band changes counted so far, expensive to cheap
+		// and back
+		toCheap, toExpensive float64
+	}{
+		{"expensive", trend(start, 10), false, 0, 0, math.NaN(), math.NaN()},
+		{"no prices", otetest.NewFake(), false, 1, 0, math.NaN(), math.NaN()},
+		{"no prices again", otetest.NewFake(), false, 2, 0, math.NaN(), math.NaN()},
+		{"cheap, not applied", trend(start.Add(3*time.Hour), -10), true, 0, 1, 1, math.NaN()},
+		{"no prices after the failure", otetest.NewFake(), false, 1, 1, 1, math.NaN()},
+		{"expensive again", trend(start.Add(5*time.Hour), 10), false, 0, 0, 1, 1},
+	}
+	for i, step := range steps {
+		fixed.now = start.Add(time.Duration(i) * time.Hour)
+		priceSource = step.source
+		frequencyActuator = actuator.Sysfs{FS: tree}
+		if step.readOnly {
+			frequencyActuator = actuator.Sysfs{FS: readOnlyFS{tree, readOnly}}
+		}
+		runCycle(context.Background())
+		got := []float64{
+			metricValue(t, "epcp_hours_since_successful_fetch"),
+			metricValue(t, "epcp_consecutive_scale_failures"),
+			metricValue(t, `epcp_band_change_total{from="expensive",to="cheap"}`),
+			metricValue(t, `epcp_band_change_total{from="cheap",to="expensive"}`),
+		}
+		want := []float64{step.hours, step.failures, step.toCheap, step.toExpensive}
+		for j := range want {
+			if got[j] != want[j] && !(math.IsNaN(got[j]) && math.IsNaN(want[j])) {
+				t.Errorf("%s: hours since the fetch, failures, band changes %v, want %v", step.name, got, want)
+				break
+			}
+		}
+		// The last price of each window is 500 EUR/MWh, kept without
+		// prices
+		if ratio := metricValue(t, "epcp_price_vs_threshold_ratio"); ratio != 1.25 {
+			t.Errorf("%s: price to threshold ratio %g, want 1.25", step.name, ratio)
+		}
+	}
+}
+
+func TestRunIDExemplar(t *testing.T) {
+	runOnMocks(t, trend(time.Now(), 10))
+	captureLogs(t)
+	result := runCycle(context.Background())
+	if result.Decision == nil {
+		t.Fatal("no decision")
+	}
+	server := httptest.NewServer(statusHandler(time.Hour))
+	defer server.Close()
+	scrape := func(accept string) (string, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/metrics", nil)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.Header.Get("Content-Type"), string(body)
+	}
+
+	// The run ID is an exemplar of the cycle counter in OpenMetrics
+	contentType, body := scrape("application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	if !strings.HasPrefix(contentType, "application/openmetrics-text") || !strings.HasSuffix(body, "\n# EOF\n") {
+		t.Errorf("content type %s, want OpenMetrics ending with # EOF:\n%s", contentType, body)
+	}
+	exemplar := regexp.MustCompile(`(?m)^epcp_cycles_total 1 # \{run_id="` + result.Decision.RunID + `"\} 1 \d+\.\d{3}$`)
+	if !strings.Contains(body, "# TYPE epcp_cycles counter\n") || !exemplar.MatchString(body) {
+		t.Errorf("no exemplar of run %s on the cycle counter:\n%s", result.Decision.RunID, body)
+	}
+
+	// and neither in the text format nor a label of its own
+	contentType, body = scrape("text/plain")
+	if !strings.HasPrefix(contentType, "text/plain") || strings.Contains(body, "run_id") || strings.Contains(body, "# EOF") {
+		t.Errorf("content type %s, want the text format without the run ID:\n%s", contentType, body)
+	}
+	checkExposition(t, body)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/synthetic"
+)
+
+func montecarloFlags(flags *flag.FlagSet) {
+	planFlags(flags)
+	flags.Lookup("date").Usage = "day whose prices are perturbed as YYYY-MM-DD (default yesterday)"
+	flags.Int("window", 4, "number of hourly prices each decision is based on")
+	flags.String("policy", "", "`policy` to evaluate (default the configured one)")
+	flags.String("format", "table", "format of the result, table or json")
+	flags.Int("runs", 500, "number of perturbed price series")
+	flags.Float64("noise", synthetic.DefaultParams.Noise, "standard deviation of the noise added to the prices")
+	flags.Float64("spikes", synthetic.DefaultParams.Spikes, "`probability` of a price spike in an hour")
+	flags.Int64("seed", 0, "`seed` of the perturbations")
+}
+
+// distribution holds the 5th, 50th and 95th percentile of a metric.
+type distribution struct {
+	P5  float64 `json:"p5"`
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+}
+
+// newDistribution returns the distribution of the values, which it sorts.
+func newDistribution(values []float64) distribution {
+	slices.Sort(values)
+	return distribution{P5: percentile(values, 5), P50: percentile(values, 50), P95: percentile(values, 95)}
+}
+
+// percentile interpolates the p-th percentile between the closest ranks of
+// the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := min(lower+1, len(sorted)-1)
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
+// montecarloResult is the distribution of the outcomes of a policy over the
+// perturbed prices.
+type montecarloResult struct {
+	Policy    string       `json:"policy"`
+	Runs      int          `json:"runs"`
+	Cost      distribution `json:"cost"`
+	Energy    distribution `json:"energyKwh"`
+	Throttled distribution `json:"throttledHours"`
+}
+
+// montecarlo replays the policy over runs perturbations of the prices on a
+// worker pool. Run i draws from a generator seeded with seed and i, so the
+// result depends only on the seed.
+func montecarlo(name string, prices []float64, window, runs int, noise, spikes float64, seed int64, machine MachineConfig) (*montecarloResult, error) {
+	p, err := namedPolicy(name)
+	if err != nil {
+		return nil, err
+	}
+	comparisons := make([]policyComparison, runs)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := rand.New(rand.NewPCG(uint64(seed), uint64(i)))
+				comparisons[i] = comparePolicy(name, p, synthetic.Perturb(prices, noise, spikes, r), window, machine)
+			}
+		}()
+	}
+	for i := range runs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	cost, energy, throttled := make([]float64, runs), make([]float64, runs), make([]float64, runs)
+	for i, c := range comparisons {
+		cost[i], energy[i], throttled[i] = c.Cost, c.Energy, float64(c.Throttled)
+	}
+	return &montecarloResult{Policy: name, Runs: runs, Cost: newDistribution(cost),
+		Energy: newDistribution(energy), Throttled: newDistribution(throttled)}, nil
+}
+
+// print writes the result as a table or, when asJSON, as JSON.
+func (r *montecarloResult) print(w io.Writer, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	fmt.Fprintf(w, "%d runs of %s\n", r.Runs, r.Policy)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tP5\tP50\tP95")
+	fmt.Fprintf(tw, "cost\t%.4f\t%.4f\t%.4f\n", r.Cost.P5, r.Cost.P50, r.Cost.P95)
+	fmt.Fprintf(tw, "energy kWh\t%.3f\t%.3f\t%.3f\n", r.Energy.P5, r.Energy.P50, r.Energy.P95)
+	fmt.Fprintf(tw, "throttled hours\t%.1f\t%.1f\t%.1f\n", r.Throttled.P5, r.Throttled.P50, r.Throttled.P95)
+	return tw.Flush()
+}
+
+func runMontecarlo(flags *flag.FlagSet) exitCode {
+	date, err := dateFlag(flags, -1)
+	if err != nil {
+		errorLogger.Printf("Error parsing date: %s\n", err.Error())
+		return exitUsage
+	}
+	value := func(name string) string {
+		return flags.Lookup(name).Value.String()
+	}
+	window, _ := strconv.Atoi(value("window"))
+	runs, _ := strconv.Atoi(value("runs"))
+	noise, _ := strconv.ParseFloat(value("noise"), 64)
+	spikes, _ := strconv.ParseFloat(value("spikes"), 64)
+	seed, _ := strconv.ParseInt(value("seed"), 10, 64)
+	format := value("format")
+	if window < 2 || runs < 1 || noise < 0 || spikes < 0 || spikes > 1 || (format != "table" && format != "json") {
+		errorLogger.Println("The window must be at least 2 prices, the runs at least 1, the noise not negative, the spikes a probability and the format table or json.")
+		return exitUsage
+	}
+	name := value("policy")
+	if name == "" {
+		name = effectiveConfig.Policy.Name
+	}
+	if name == "" {
+		name = "trend"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trapSignals(cancel)
+	points, code := backtestPrices(ctx, date, window)
+	if code != exitOK {
+		return code
+	}
+	result, err := montecarlo(name, ote.Prices(points), window, runs, noise, spikes, seed, backtestMachine())
+	if err != nil {
+		errorLogger.Printf("Error selecting the policy: %s\n", err.Error())
+		return exitUsage
+	}
+	if err := result.print(os.Stdout, format == "json"); err != nil {
+		errorLogger.Printf("Error writing the result: %s\n", err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
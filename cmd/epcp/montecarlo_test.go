@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestPercentile(t *testing.T) {
+	values := []float64{5, 1, 4, 2, 3}
+	got := newDistribution(values)
+	// The ranks 0.2, 2 and 3.8 of 1 to 5
+	if want := (distribution{P5: 1.2, P50: 3, P95: 4.8}); !approxEqual(got.P5, want.P5) || got.P50 != want.P50 || !approxEqual(got.P95, want.P95) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := percentile([]float64{7}, 95); got != 7 {
+		t.Errorf("percentile of one value %g, want 7", got)
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of no values %g, want 0", got)
+	}
+}
+
+func TestMontecarlo(t *testing.T) {
+	first, err := montecarlo("trend", tinyPrices, 4, 50, 10, 0.1, 42, tinyMachine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := montecarlo("trend", tinyPrices, 4, 50, 10, 0.1, 42, tinyMachine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("%+v and %+v differ with the same seed", first, second)
+	}
+	other, err := montecarlo("trend", tinyPrices, 4, 50, 10, 0.1, 43, tinyMachine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(first, other) {
+		t.Error("the same result with another seed")
+	}
+	if d := first.Cost; d.P5 > d.P50 || d.P50 > d.P95 {
+		t.Errorf("cost percentiles %+v out of order", d)
+	}
+
+	// Without perturbations every run is the comparison of the prices
+	exact, err := montecarlo("trend", tinyPrices, 4, 5, 0, 0, 1, tinyMachine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := comparePolicy("trend", policy.Trend{}, tinyPrices, 4, tinyMachine)
+	for name, d := range map[string]distribution{"cost": exact.Cost, "energy": exact.Energy, "throttled": exact.Throttled} {
+		want := map[string]float64{"cost": c.Cost, "energy": c.Energy, "throttled": float64(c.Throttled)}[name]
+		if d.P5 != want || d.P50 != want || d.P95 != want {
+			t.Errorf("%s %+v, want %g throughout", name, d, want)
+		}
+	}
+	if _, err := montecarlo("oracle", tinyPrices, 4, 5, 0, 0, 1, tinyMachine); err == nil {
+		t.Error("unknown policy: no error")
+	}
+}
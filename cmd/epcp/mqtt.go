@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Minimal MQTT 3.1.1 client publishing retained QoS 0 messages.
+// http://docs.oasis-open.org/mqtt/mqtt/v3.1.1/os/mqtt-v3.1.1-os.html
+
+const (
+	mqttKeepAlive = 60 * time.Second
+	mqttTimeout   = 5 * time.Second
+)
+
+type mqttClient struct {
+	mu       sync.Mutex
+	broker   *url.URL
+	username string
+	password string
+	prefix   string
+	conn     net.Conn
+	done     chan struct{}
+}
+
+var mqtt *mqttClient
+
+// newMQTTClient returns a client for the broker URL (mqtt:// or mqtts://).
+func newMQTTClient(broker, username, password, prefix string) (*mqttClient, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "mqtt" && u.Scheme != "mqtts" && u.Scheme != "tcp" && u.Scheme != "ssl" {
+		return nil, fmt.Errorf("unsupported MQTT scheme %q", u.Scheme)
+	}
+	return &mqttClient{broker: u, username: username, password: password, prefix: prefix}, nil
+}
+
+func (c *mqttClient) availabilityTopic() string {
+	return c.prefix + "/availability"
+}
+
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+// mqttPacket prepends the fixed header with the remaining length to body.
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// connectPacket announces the availability topic as last will.
+func (c *mqttClient) connectPacket(clientID string) []byte {
+	flags := byte(0x02 | 0x04 | 0x20) // clean session, will, will retain
+	body := append(mqttString("MQTT"), 4, 0, byte(mqttKeepAlive/time.Second>>8), byte(mqttKeepAlive/time.Second))
+	body = append(body, mqttString(clientID)...)
+	body = append(body, mqttString(c.availabilityTopic())...)
+	body = append(body, mqttString("offline")...)
+	if c.username != "" {
+		flags |= 0x80
+		body = append(body, mqttString(c.username)...)
+		if c.password != "" {
+			flags |= 0x40
+			body = append(body, mqttString(c.password)...)
+		}
+	}
+	body[7] = flags
+	return mqttPacket(0x10, body)
+}
+
+func publishPacket(topic string, payload []byte, retain bool) []byte {
+	header := byte(0x30)
+	if retain {
+		header |= 0x01
+	}
+	return mqttPacket(header, append(mqttString(topic), payload...))
+}
+
+// connect dials the broker and waits for the CONNACK.
+func (c *mqttClient) connect(ctx context.Context) error {
+	host := c.broker.Host
+	secure := c.broker.Scheme == "mqtts" || c.broker.Scheme == "ssl"
+	if c.broker.Port() == "" {
+		if secure {
+			host = net.JoinHostPort(host, "8883")
+		} else {
+			host = net.JoinHostPort(host, "1883")
+		}
+	}
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	var err error
+	if secure {
+		conn, err = (&tls.Dialer{NetDialer: dialer}).DialContext(ctx, "tcp", host)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+	}
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+	if _, err := conn.Write(c.connectPacket("epcp-" + hostname)); err != nil {
+		conn.Close()
+		return err
+	}
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		conn.Close()
+		return err
+	}
+	if ack[0] != 0x20 || ack[3] != 0 {
+		conn.Close()
+		return fmt.Errorf("broker refused connection with code %d", ack[3])
+	}
+	conn.SetDeadline(time.Time{})
+	c.conn = conn
+	c.done = make(chan struct{})
+	go c.keepAlive(conn, c.done)
+	return nil
+}
+
+// keepAlive pings the broker and drains incoming packets until the
+// connection fails or is closed.
+func (c *mqttClient) keepAlive(conn net.Conn, done chan struct{}) {
+	go func() {
+		r := bufio.NewReader(conn)
+		for {
+			if _, err := r.ReadByte(); err != nil {
+				c.mu.Lock()
+				if c.conn == conn {
+					c.closeConn()
+				}
+				c.mu.Unlock()
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(mqttKeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			if c.conn == conn {
+				c.write([]byte{0xC0, 0x00})
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// write sends a packet; it must be called with the mutex held.
+func (c *mqttClient) write(packet []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(mqttTimeout))
+	_, err := c.conn.Write(packet)
+	if err != nil {
+		c.closeConn()
+	}
+	return err
+}
+
+func (c *mqttClient) closeConn() {
+	close(c.done)
+	c.conn.Close()
+	c.conn = nil
+}
+
+// publish sends retained messages, connecting first when needed.
+func (c *mqttClient) publish(ctx context.Context, messages map[string][]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return err
+		}
+		if err := c.write(publishPacket(c.availabilityTopic(), []byte("online"), true)); err != nil {
+			return err
+		}
+	}
+	for topic, payload := range messages {
+		if err := c.write(publishPacket(c.prefix+"/"+topic, payload, true)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close marks the daemon offline and disconnects.
+func (c *mqttClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return
+	}
+	c.write(publishPacket(c.availabilityTopic(), []byte("offline"), true))
+	if c.conn != nil {
+		c.write([]byte{0xE0, 0x00})
+	}
+	if c.conn != nil {
+		c.closeConn()
+	}
+}
+
+// publishMQTT publishes the cycle outcome, through mqttQueue in daemon
+// mode. Failures are only logged.
+func publishMQTT(ctx context.Context, result *cycleResult) {
+	prices, decision := result.Prices, result.Decision
+	if mqtt == nil || decision == nil {
+		return
+	}
+	messages := map[string][]byte{
+		"band":       []byte(decision.Band),
+		"target_khz": []byte(strconv.Itoa(decision.Frequency)),
+	}
+	if len(prices) != 0 {
+		messages["price"] = []byte(strconv.FormatFloat(prices[len(prices)-1], 'f', 2, 64))
+	}
+	d, err := json.Marshal(decision)
+	if err != nil {
+		errorLog(ctx).Printf("Error encoding decision: %s\n", err.Error())
+		return
+	}
+	messages["decision"] = d
+	client := mqtt
+	mqttQueue.send(ctx, notification{
+		send: func(ctx context.Context) error { return client.publish(ctx, messages) },
+		failed: func(err error) {
+			if !e.Is(err, context.Canceled) {
+				errorLog(ctx).Printf("Error publishing to MQTT broker %s: %s\n", client.broker.Host, err.Error())
+			}
+		},
+	})
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// mqttMessage is a message published to mqttBroker.
+type mqttMessage struct {
+	topic   string
+	payload string
+	retain  bool
+}
+
+// mqttBroker is an in-process broker accepting a connection at a time,
+// answering CONNECT with returnCode and recording the packets.
+type mqttBroker struct {
+	listener   net.Listener
+	returnCode byte
+	mu         sync.Mutex
+	// connect is the body of the last CONNECT
+	connect      []byte
+	messages     []mqttMessage
+	disconnected bool
+}
+
+func newMQTTBroker(t *testing.T, returnCode byte) *mqttBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &mqttBroker{listener: listener, returnCode: returnCode}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *mqttBroker) url() string {
+	return "mqtt://" + b.listener.Addr().String()
+}
+
+// serve reads the packets of the connection until it is closed.
+func (b *mqttBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		length, shift := 0, 0
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			length |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+		b.mu.Lock()
+		switch header >> 4 {
+		case 1:
+			b.connect = body
+			conn.Write([]byte{0x20, 0x02, 0x00, b.returnCode})
+		case 3:
+			n := int(body[0])<<8 | int(body[1])
+			b.messages = append(b.messages, mqttMessage{topic: string(body[2 : 2+n]), payload: string(body[2+n:]), retain: header&0x01 != 0})
+		case 14:
+			b.disconnected = true
+		}
+		b.mu.Unlock()
+	}
+}
+
+// wait waits until the broker has received n messages, or the disconnect
+// when n is negative.
+func (b *mqttBroker) wait(t *testing.T, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		b.mu.Lock()
+		received := len(b.messages) >= n && (n >= 0 || b.disconnected)
+		b.mu.Unlock()
+		if received {
+			return
+		}
+	}
+	t.Fatalf("the broker did not receive %d messages", n)
+}
+
+// published returns the payloads last published to each topic.
+func (b *mqttBroker) published() map[string]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	published := make(map[string]string)
+	for _, m := range b.messages {
+		published[m.topic] = m.payload
+	}
+	return published
+}
+
+func TestMQTT(t *testing.T) {
+	broker := newMQTTBroker(t, 0)
+	client, err := newMQTTClient(broker.url(), "epcp", "secret", "epcp/node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &mqtt, client)
+	setGlobal(t, &mqttQueue, nil)
+	decision := &Decision{Time: time.Now(), Band: policy.Expensive, Frequency: 800000}
+	publishMQTT(context.Background(), &cycleResult{Prices: []float64{80, 95.5, 120.5}, Decision: decision})
+	// The availability, the band, the target, the price and the decision
+	broker.wait(t, 5)
+
+	broker.mu.Lock()
+	connect, messages := broker.connect, broker.messages
+	broker.mu.Unlock()
+	// The last will marks the daemon offline, with the credentials after it
+	for _, want := range []string{"MQTT", "epcp/node1/availability", "offline", "epcp", "secret"} {
+		if !strings.Contains(string(connect), want) {
+			t.Errorf("CONNECT without %q: %q", want, connect)
+		}
+	}
+	if flags := connect[7]; flags != 0x02|0x04|0x20|0x40|0x80 {
+		t.Errorf("CONNECT flags %08b, want clean session, retained will, username and password", flags)
+	}
+	if len(messages) == 0 || messages[0] != (mqttMessage{"epcp/node1/availability", "online", true}) {
+		t.Fatalf("first message %v, want the availability", messages)
+	}
+	for _, m := range messages {
+		if !m.retain {
+			t.Errorf("message to %s not retained", m.topic)
+		}
+	}
+	published := broker.published()
+	want := map[string]string{"epcp/node1/band": "expensive", "epcp/node1/target_khz": "800000", "epcp/node1/price": "120.50"}
+	for topic, payload := range want {
+		if published[topic] != payload {
+			t.Errorf("%s: %q, want %q", topic, published[topic], payload)
+		}
+	}
+	var decoded Decision
+	if err := json.Unmarshal([]byte(published["epcp/node1/decision"]), &decoded); err != nil || decoded.Band != policy.Expensive {
+		t.Errorf("decision %q: %v", published["epcp/node1/decision"], err)
+	}
+
+	// The connection is reused
+	publishMQTT(context.Background(), &cycleResult{Decision: decision})
+	client.close()
+	broker.wait(t, -1)
+	broker.mu.Lock()
+	online, disconnected := 0, broker.disconnected
+	for _, m := range broker.messages {
+		if m.topic == "epcp/node1/availability" && m.payload == "online" {
+			online++
+		}
+	}
+	broker.mu.Unlock()
+	if online != 1 {
+		t.Errorf("announced online %d times, want once", online)
+	}
+	if broker.published()["epcp/node1/availability"] != "offline" || !disconnected {
+		t.Errorf("availability %q and disconnected %t after closing, want offline and disconnected", broker.published()["epcp/node1/availability"], disconnected)
+	}
+}
+
+func TestMQTTFailures(t *testing.T) {
+	refusing := newMQTTBroker(t, 5)
+	client, err := newMQTTClient(refusing.url(), "", "", "epcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.publish(context.Background(), map[string][]byte{"band": []byte("cheap")}); err == nil || !strings.Contains(err.Error(), "code 5") {
+		t.Errorf("refused connection: got error %v", err)
+	}
+	if _, err := newMQTTClient("http://broker", "", "", "epcp"); err == nil {
+		t.Error("http broker: no error")
+	}
+
+	// A broker that cannot be reached does not affect the scaling
+	tree := runOnMocks(t, trend(time.Now(), 10))
+	logs := captureLogs(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+	unreachable, err := newMQTTClient("mqtt://"+listener.Addr().String(), "", "", "epcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &mqtt, unreachable)
+	setGlobal(t, &mqttQueue, nil)
+	result := runCycle(context.Background())
+	if result.exitCode() != exitOK || readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")) != "800000" {
+		t.Errorf("exit code %d, want the decision applied", result.exitCode())
+	}
+	if !strings.Contains(logs.String(), "Error publishing to MQTT broker") {
+		t.Errorf("the failure not logged:\n%s", logs)
+	}
+}
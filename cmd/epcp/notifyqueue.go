@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// notifyQueueSize bounds the notifications waiting for each notifier,
+	// see OutputsConfig
+	notifyQueueSize = 16
+	// notifyFlushTimeout bounds how long the queues are flushed on shutdown
+	notifyFlushTimeout = 5 * time.Second
+	// webhookQueue and mqttQueue queue the notifications in daemon mode, see
+	// startNotifyQueues; without them, the notifications are sent at once
+	webhookQueue, mqttQueue *notifyQueue
+)
+
+// errNotifyDropped is passed to the notifications dropped from a full queue
+// or left when flushing it on shutdown times out.
+var errNotifyDropped = errors.New("dropped from the notification queue")
+
+// notification is a message to send to a notifier.
+type notification struct {
+	send func(ctx context.Context) error
+	// failed, if set, is called with the error when the notification fails
+	// or is dropped; it may be called from the goroutine of the queue
+	failed func(err error)
+}
+
+// notifyQueue decouples a notifier from the cycles in daemon mode, so that a
+// slow endpoint delays neither the cycles nor the other notifiers: the
+// cycles enqueue the notifications and a goroutine of its own sends them in
+// order. The queue is bounded; when it is full, the oldest notification is
+// dropped and counted in epcp_notifications_dropped_total.
+type notifyQueue struct {
+	name string
+	size int
+
+	mu            sync.Mutex
+	notifications []notification
+	closing       bool
+	// wake is signalled when a notification is enqueued or the queue closed
+	wake chan struct{}
+	// ctx is that of the notifications sent, cancel aborts them
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newNotifyQueue returns the queue of the notifier name and starts sending
+// the notifications enqueued.
+func newNotifyQueue(name string, size int) *notifyQueue {
+	q := &notifyQueue{name: name, size: max(size, 1), wake: make(chan struct{}, 1), done: make(chan struct{})}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	go q.run()
+	return q
+}
+
+// startNotifyQueues queues the notifications of the configured notifiers.
+func startNotifyQueues() {
+	if notifier != nil {
+		webhookQueue = newNotifyQueue("webhook", notifyQueueSize)
+	}
+	if mqtt != nil {
+		mqttQueue = newNotifyQueue("mqtt", notifyQueueSize)
+	}
+}
+
+// flushNotifyQueues sends the notifications left within notifyFlushTimeout
+// altogether, on shutdown, before the state file is saved.
+func flushNotifyQueues() {
+	deadline := time.Now().Add(notifyFlushTimeout)
+	for _, q := range []*notifyQueue{webhookQueue, mqttQueue} {
+		if q != nil {
+			q.close(time.Until(deadline))
+		}
+	}
+	webhookQueue, mqttQueue = nil, nil
+	if notifier != nil {
+		notifier.restoreFailed()
+	}
+}
+
+// send enqueues the notification, carrying the run identifier of ctx, or
+// sends it at once without a queue.
+func (q *notifyQueue) send(ctx context.Context, n notification) {
+	if q == nil {
+		if err := n.send(ctx); err != nil && n.failed != nil {
+			n.failed(err)
+		}
+		return
+	}
+	runID, send := runIDFrom(ctx), n.send
+	n.send = func(ctx context.Context) error { return send(withRunID(ctx, runID)) }
+	q.mu.Lock()
+	if q.closing {
+		q.mu.Unlock()
+		q.drop(n)
+		return
+	}
+	full := len(q.notifications) >= q.size
+	var oldest notification
+	if full {
+		oldest, q.notifications = q.notifications[0], q.notifications[1:]
+	}
+	q.notifications = append(q.notifications, n)
+	q.mu.Unlock()
+	if full {
+		q.drop(oldest)
+	}
+	q.signal()
+}
+
+func (q *notifyQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// drop counts the notification dropped and reports it as failed.
+func (q *notifyQueue) drop(n notification) {
+	metrics.addCounter("epcp_notifications_dropped_total", "Number of notifications dropped from a full queue or on shutdown by notifier.", 1, "notifier", q.name)
+	if n.failed != nil {
+		n.failed(errNotifyDropped)
+	}
+}
+
+// run sends the notifications in order until the queue is closed and empty.
+func (q *notifyQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		if len(q.notifications) == 0 {
+			closing := q.closing
+			q.mu.Unlock()
+			if closing {
+				return
+			}
+			<-q.wake
+			continue
+		}
+		n := q.notifications[0]
+		q.notifications = q.notifications[1:]
+		q.mu.Unlock()
+		if err := n.send(q.ctx); err != nil && n.failed != nil {
+			if q.ctx.Err() != nil {
+				err = errNotifyDropped
+			}
+			n.failed(err)
+		}
+	}
+}
+
+// close sends the notifications left within timeout, then aborts the one
+// being sent, waits for it to return and drops the rest.
+func (q *notifyQueue) close(timeout time.Duration) {
+	q.mu.Lock()
+	q.closing = true
+	q.mu.Unlock()
+	q.signal()
+	select {
+	case <-q.done:
+	case <-time.After(timeout):
+		q.cancel()
+		q.mu.Lock()
+		left := q.notifications
+		q.notifications = nil
+		q.mu.Unlock()
+		errorLogger.Printf("Error flushing the %s notifications: %d left after %s\n", q.name, len(left), timeout)
+		for _, n := range left {
+			q.drop(n)
+		}
+		<-q.done
+	}
+	q.cancel()
+}
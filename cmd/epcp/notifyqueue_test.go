@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stalledNotifier records the notifications sent, stalling on the first
+// until released.
+type stalledNotifier struct {
+	started, release chan struct{}
+
+	mu            sync.Mutex
+	sent, dropped []int
+}
+
+func newStalledNotifier() *stalledNotifier {
+	return &stalledNotifier{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (s *stalledNotifier) notification(i int) notification {
+	return notification{
+		send: func(ctx context.Context) error {
+			if i == 0 {
+				close(s.started)
+				select {
+				case <-s.release:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.sent = append(s.sent, i)
+			return nil
+		},
+		failed: func(err error) {
+			if !e.Is(err, errNotifyDropped) {
+				panic(err)
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.dropped = append(s.dropped, i)
+		},
+	}
+}
+
+func TestNotifyQueueDrops(t *testing.T) {
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	notifier := newStalledNotifier()
+	q := newNotifyQueue("webhook", 3)
+	q.send(context.Background(), notifier.notification(0))
+	<-notifier.started
+
+	// The cycles are not held up by the stalled notifier
+	start := time.Now()
+	for i := 1; i <= 6; i++ {
+		q.send(context.Background(), notifier.notification(i))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("enqueueing took %s", elapsed)
+	}
+	close(notifier.release)
+	q.close(time.Second)
+
+	if want := []int{0, 4, 5, 6}; !slices.Equal(notifier.sent, want) {
+		t.Errorf("sent %v, want the newest in order %v", notifier.sent, want)
+	}
+	if want := []int{1, 2, 3}; !slices.Equal(notifier.dropped, want) {
+		t.Errorf("dropped %v, want the oldest %v", notifier.dropped, want)
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	if !strings.Contains(exposition.String(), `epcp_notifications_dropped_total{notifier="webhook"} 3`+"\n") {
+		t.Errorf("metrics without the drops:\n%s", exposition.String())
+	}
+}
+
+func TestNotifyQueueShutdown(t *testing.T) {
+	logs := captureLogs(t)
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	notifier := newStalledNotifier()
+	q := newNotifyQueue("mqtt", 8)
+	for i := range 3 {
+		q.send(context.Background(), notifier.notification(i))
+	}
+	<-notifier.started
+
+	// The stalled notification is aborted and the rest dropped once the
+	// flush times out
+	start := time.Now()
+	q.close(50 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("closing took %s", elapsed)
+	}
+	select {
+	case <-q.done:
+	default:
+		t.Fatal("the goroutine of the queue still runs")
+	}
+	// The stalled notification may be dropped before or after the rest
+	dropped := slices.Clone(notifier.dropped)
+	slices.Sort(dropped)
+	if len(notifier.sent) != 0 || !slices.Equal(dropped, []int{0, 1, 2}) {
+		t.Errorf("sent %v, dropped %v, want all dropped", notifier.sent, notifier.dropped)
+	}
+	if !strings.Contains(logs.String(), "Error flushing the mqtt notifications: 2 left after 50ms\n") {
+		t.Errorf("the flush not logged:\n%s", logs)
+	}
+
+	// Nothing is sent after the shutdown
+	q.send(context.Background(), notifier.notification(3))
+	if len(notifier.sent) != 0 || len(notifier.dropped) != 4 || notifier.dropped[3] != 3 {
+		t.Errorf("sent %v, dropped %v after the shutdown", notifier.sent, notifier.dropped)
+	}
+}
+
+func TestNotifyQueueFlush(t *testing.T) {
+	setGlobal(t, &webhookQueue, newNotifyQueue("webhook", 4))
+	var mu sync.Mutex
+	var runIDs []string
+	for _, id := range []string{"a", "b"} {
+		webhookQueue.send(withRunID(context.Background(), id), notification{send: func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			runIDs = append(runIDs, runIDFrom(ctx))
+			return nil
+		}})
+	}
+	flushNotifyQueues()
+	// Sent within the timeout, with the run identifiers of the cycles
+	if !slices.Equal(runIDs, []string{"a", "b"}) || webhookQueue != nil {
+		t.Errorf("run IDs %v, queue %v after the flush", runIDs, webhookQueue)
+	}
+
+	// Without a queue, sent at once
+	sent := false
+	webhookQueue.send(context.Background(), notification{send: func(context.Context) error { sent = true; return nil }})
+	if !sent {
+		t.Error("not sent without a queue")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/burn"
+)
+
+var (
+	// numaNodes sets the frequencies per NUMA node, see NUMANodeConfig
+	numaNodes map[int]NUMANodeConfig
+	// numaTopology maps the CPUs to their NUMA node, read once
+	numaTopology     map[int]int
+	numaTopologyOnce sync.Once
+)
+
+// cpuNodes returns the NUMA node of each CPU from the cpulist of the nodes,
+// empty without NUMA nodes configured or in sysfs.
+func cpuNodes() map[int]int {
+	numaTopologyOnce.Do(func() {
+		numaTopology = make(map[int]int)
+		if len(numaNodes) == 0 {
+			return
+		}
+		paths, err := sysfs.Glob(sysfsPath("devices", "system", "node", "node*", "cpulist"))
+		if err != nil {
+			errorLogger.Printf("Error listing the NUMA nodes: %s\n", err.Error())
+			return
+		}
+		for _, path := range paths {
+			node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(path)), "node"))
+			if err != nil {
+				continue
+			}
+			content, err := actuator.ReadFile(sysfs, path)
+			if err != nil {
+				errorLogger.Printf("Error reading the CPUs of NUMA node %d: %s\n", node, err.Error())
+				continue
+			}
+			// Nodes with memory only have no CPUs
+			if strings.TrimSpace(content) == "" {
+				continue
+			}
+			cpus, err := burn.ParseCPUs(strings.TrimSpace(content))
+			if err != nil {
+				errorLogger.Printf("Error reading the CPUs of NUMA node %d: %s\n", node, err.Error())
+				continue
+			}
+			for _, cpu := range cpus {
+				numaTopology[cpu] = node
+			}
+		}
+	})
+	return numaTopology
+}
+
+// nodeFrequencies returns the frequency of each configured NUMA node for the
+// band, snapped to the highest available frequency not above it.
+func nodeFrequencies(band string, available []int) map[int]int {
+	if len(numaNodes) == 0 {
+		return nil
+	}
+	frequencies := make(map[int]int, len(numaNodes))
+	for node, n := range numaNodes {
+		frequency, ok := n.Bands[band]
+		if !ok {
+			frequency = bandFrequency(band, available) + n.Offset
+		}
+		frequencies[node] = snapFrequency(frequency, available)
+	}
+	return frequencies
+}
+
+// snapFrequency returns the highest available frequency not above frequency,
+// or the lowest available one. Without available frequencies it is
+// frequency.
+func snapFrequency(frequency int, available []int) int {
+	if len(available) == 0 {
+		return frequency
+	}
+	snapped := slices.Min(available)
+	for _, f := range available {
+		if f <= frequency && f > snapped {
+			snapped = f
+		}
+	}
+	return snapped
+}
+
+// cpuFrequency returns the frequency the decision sets on the CPU: that of
+// its NUMA node, its target resolved on its own frequency table, or the
+// decided one.
+func (d *Decision) cpuFrequency(cpu int) int {
+	if node, ok := cpuNodes()[cpu]; ok {
+		if frequency, ok := d.Nodes[node]; ok {
+			return frequency
+		}
+	}
+	if target, ok := bandTargets[d.Band]; ok && d.Target == target.text {
+		return target.resolve(readCPUTable(cpu))
+	}
+	return d.Frequency
+}
+
+// recordNodeMetrics exports the frequency and the CPUs that accepted it by
+// NUMA node.
+func recordNodeMetrics(decision *Decision) {
+	if len(decision.Nodes) == 0 {
+		return
+	}
+	applied := make(map[int]int)
+	for _, cpu := range decision.Summary.Succeeded {
+		if node, ok := cpuNodes()[cpu]; ok {
+			applied[node]++
+		}
+	}
+	metrics.resetGauge("epcp_numa_target_frequency_khz", "Frequency chosen by the last decision by NUMA node.")
+	metrics.resetGauge("epcp_numa_applied_cpus", "Number of CPUs that accepted the last decision by NUMA node.")
+	for node, frequency := range decision.Nodes {
+		label := strconv.Itoa(node)
+		metrics.setGauge("epcp_numa_target_frequency_khz", "Frequency chosen by the last decision by NUMA node.", float64(frequency), "node", label)
+		metrics.setGauge("epcp_numa_applied_cpus", "Number of CPUs that accepted the last decision by NUMA node.", float64(applied[node]), "node", label)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestNUMANodes(t *testing.T) {
+	now := time.Now()
+	runOnMocks(t, trend(now, -10))
+	logs := captureLogs(t)
+	// Node 0 runs the services and node 1 the batch work; CPUs 4 and 5 are
+	// in no node and node 2 has memory only
+	files := sysfsFiles(6)
+	files[actuator.Path("/sys", "devices", "system", "node", "node0", "cpulist")] = "0-1\n"
+	files[actuator.Path("/sys", "devices", "system", "node", "node1", "cpulist")] = "2,3\n"
+	files[actuator.Path("/sys", "devices", "system", "node", "node2", "cpulist")] = "\n"
+	tree := actuator.NewMemFS(files)
+	useSysfs(t, tree)
+	setGlobal(t, &numaNodes, map[int]NUMANodeConfig{
+		0: {Bands: map[string]int{policy.Expensive: 2400000}},
+		1: {Offset: -1600000},
+	})
+	frequencies := func() []string {
+		var got []string
+		for cpu := 0; cpu < 6; cpu++ {
+			got = append(got, readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")))
+		}
+		return got
+	}
+
+	tests := []struct {
+		band  string
+		step  float64
+		nodes map[int]int
+		// want is the scaling_max_freq of each CPU
+		want []string
+	}{
+		// The offset lowers the frequency of the band, and the unmapped CPUs
+		// run at the decided one
+		{policy.Cheap, -10, map[int]int{0: 3200000, 1: 1600000},
+			[]string{"3200000", "3200000", "1600000", "1600000", "3200000", "3200000"}},
+		// The frequency of the band overrides it, and the offset does not go
+		// below the lowest frequency
+		{policy.Expensive, 10, map[int]int{0: 2400000, 1: 800000},
+			[]string{"2400000", "2400000", "800000", "800000", "800000", "800000"}},
+	}
+	for _, test := range tests {
+		priceSource = trend(now, test.step)
+		result := runCycle(context.Background())
+		if result.Decision == nil || result.Decision.Band != test.band {
+			t.Fatalf("%s: decision %+v", test.band, result.Decision)
+		}
+		if len(result.Decision.Nodes) != len(test.nodes) {
+			t.Errorf("%s: nodes %v, want %v", test.band, result.Decision.Nodes, test.nodes)
+		}
+		for node, frequency := range test.nodes {
+			if result.Decision.Nodes[node] != frequency {
+				t.Errorf("%s: nodes %v, want %v", test.band, result.Decision.Nodes, test.nodes)
+			}
+		}
+		if got := frequencies(); strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s: scaling_max_freq %v, want %v", test.band, got, test.want)
+		}
+	}
+	if !strings.Contains(logs.String(), "NUMA nodes to map[0:2400000 1:800000]") {
+		t.Errorf("the node frequencies not logged:\n%s", logs)
+	}
+
+	// The metrics are labelled by node
+	var exposition strings.Builder
+	if err := metrics.write(&exposition); err != nil {
+		t.Fatal(err)
+	}
+	checkExposition(t, exposition.String())
+	for _, want := range []string{
+		`epcp_numa_target_frequency_khz{node="0"} 2.4e+06`,
+		`epcp_numa_target_frequency_khz{node="1"} 800000`,
+		`epcp_numa_applied_cpus{node="0"} 2`,
+		`epcp_numa_applied_cpus{node="1"} 2`,
+	} {
+		if !strings.Contains(exposition.String(), want+"\n") {
+			t.Errorf("no %s in the metrics:\n%s", want, exposition.String())
+		}
+	}
+}
+
+func TestSnapFrequency(t *testing.T) {
+	available := []int{800000, 1600000, 2400000, 3200000}
+	tests := []struct{ frequency, want int }{
+		{2400000, 2400000},
+		{2000000, 1600000},
+		{5000000, 3200000},
+		{500000, 800000},
+		{-800000, 800000},
+	}
+	for _, test := range tests {
+		if got := snapFrequency(test.frequency, available); got != test.want {
+			t.Errorf("snapFrequency(%d) = %d, want %d", test.frequency, got, test.want)
+		}
+	}
+	if got := snapFrequency(2000000, nil); got != 2000000 {
+		t.Errorf("snapFrequency without frequencies = %d, want 2000000", got)
+	}
+}
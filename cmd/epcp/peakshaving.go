@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"math"
+	"slices"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// shavingBudget is the budget of the peak shaving policy consumed on a day,
+// kept in the state across restarts.
+type shavingBudget struct {
+	Date string `json:"date"`
+	// Hours are the trading hours throttled
+	Hours []int `json:"hours"`
+}
+
+// adjustForPeakShaving decides the band of the hour with the peak shaving
+// policy, when it is that of the day: the hour is throttled when it is one
+// of the most expensive hours left for the budget left, see
+// policy.PeakShaving. The day-ahead prices of the day rank the hours, the
+// intraday prices of the window replacing them as the hours trade; without
+// the day-ahead prices, the band of the window is throttled while budget is
+// left. The budget rolls over with the day.
+func adjustForPeakShaving(ctx context.Context, decision *Decision, points []ote.PricePoint) {
+	if decision == nil {
+		return
+	}
+	shaving, ok := dayPolicy(decision.DayType).(policy.PeakShaving)
+	if !ok {
+		return
+	}
+	date, hour := ote.HourIndex(decision.Time)
+	budget := state.PeakShaving
+	if budget == nil || budget.Date != date {
+		budget = &shavingBudget{Date: date}
+		state.PeakShaving = budget
+	}
+	var throttle bool
+	if dayAheadPoints := dayAheadToday(ctx, date); len(dayAheadPoints) != 0 {
+		hours, _ := ote.HoursIn(date)
+		throttled := make([]int, len(budget.Hours))
+		for i, h := range budget.Hours {
+			throttled[i] = h - 1
+		}
+		throttle = shaving.Shave(shavingPrices(date, hours, dayAheadPoints, points), hour-1, throttled)
+	} else {
+		throttle = slices.Contains(budget.Hours, hour) ||
+			decision.Band == policy.Expensive && len(budget.Hours) < shaving.Budget
+	}
+	if throttle && !slices.Contains(budget.Hours, hour) {
+		budget.Hours = append(budget.Hours, hour)
+	}
+	metrics.setGauge("epcp_peak_shaving_budget_left", "Hours of the daily budget of peak shaving left.", float64(max(shaving.Budget-len(budget.Hours), 0)))
+	band := policy.Cheap
+	if throttle {
+		band = policy.Expensive
+	}
+	if band != decision.Band {
+		infoLog(ctx).Printf("Peak shaving, %d of %d hours throttled today: deciding the %s band instead of %s\n",
+			len(budget.Hours), shaving.Budget, band, decision.Band)
+		decision.setBand(band, availableFrequencies())
+	}
+}
+
+// dayAheadToday returns the day-ahead prices of today, the date, fetching
+// them when they were not rolled over from tomorrow, or nil.
+func dayAheadToday(ctx context.Context, date string) []ote.PricePoint {
+	if today := dayAhead.current(cycleClock.Now()).Today; today != nil {
+		return today.Points
+	}
+	points, err := getDamPoints(ctx, date, date)
+	if err != nil || len(points) == 0 {
+		return nil
+	}
+	dayAhead.setToday(newDayAheadDay(date, points))
+	return points
+}
+
+// shavingPrices returns the prices of the hours of the day ranked by peak
+// shaving: those of the day-ahead points, replaced by the market prices of
+// the points of the window. Hours without a price rank the lowest.
+func shavingPrices(date string, hours int, dayAheadPoints, points []ote.PricePoint) []float64 {
+	prices := make([]float64, hours)
+	for i := range prices {
+		prices[i] = math.Inf(-1)
+	}
+	set := func(p ote.PricePoint) {
+		if day, hour := ote.HourIndex(p.Start); day == date && hour >= 1 && hour <= hours {
+			prices[hour-1] = p.Price
+		}
+	}
+	for _, p := range dayAheadPoints {
+		set(p)
+	}
+	for _, p := range points {
+		if p.Source == "" {
+			set(p)
+		}
+	}
+	return prices
+}
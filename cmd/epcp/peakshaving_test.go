@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// fixedClock is a clock standing still at now until moved.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fixedClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// shaveDay decides the hours of the day with adjustForPeakShaving, returning
+// the trading hours throttled.
+func shaveDay(t *testing.T, clock *fixedClock, day string) []int {
+	t.Helper()
+	hours, err := ote.HoursIn(day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var throttled []int
+	for hour := 1; hour <= hours; hour++ {
+		start, err := ote.HourStart(day, hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clock.now = start
+		decision := &Decision{Time: start, Band: policy.Cheap}
+		adjustForPeakShaving(context.Background(), decision, nil)
+		if decision.Band == policy.Expensive {
+			throttled = append(throttled, hour)
+		}
+	}
+	return throttled
+}
+
+func TestPeakShaving(t *testing.T) {
+	simulatedSysfs(t, 1)
+	captureLogs(t)
+	fixed := new(fixedClock)
+	setGlobal[clock](t, &cycleClock, fixed)
+	setGlobal[policy.Policy](t, &cyclePolicy, policy.PeakShaving{Budget: 2})
+	setGlobal(t, &dayAhead, new(dayAheadPrices))
+	// The day-ahead prices peak at 10:00 and 18:00, then 07:00
+	setGlobal[ote.PriceSource](t, &priceSource, priceFunc(func(start time.Time) float64 {
+		switch start.In(ote.Location()).Hour() {
+		case 10:
+			return 300
+		case 18:
+			return 250
+		case 7:
+			return 200
+		}
+		return 100
+	}))
+
+	if got, want := shaveDay(t, fixed, "2024-03-04"), []int{11, 19}; !slices.Equal(got, want) {
+		t.Errorf("throttled hours %v, want %v", got, want)
+	}
+	// The budget rolls over with the day
+	if got, want := shaveDay(t, fixed, "2024-03-05"), []int{11, 19}; !slices.Equal(got, want) {
+		t.Errorf("next day: throttled hours %v, want %v", got, want)
+	}
+	if budget := state.PeakShaving; budget.Date != "2024-03-05" || !slices.Equal(budget.Hours, []int{11, 19}) {
+		t.Errorf("budget of %s consumed by hours %v, want 2024-03-05 by [11 19]", budget.Date, budget.Hours)
+	}
+
+	// The budget consumed before a restart is kept: the hours throttled
+	// already stay so and the budget left goes to the most expensive hour
+	state.PeakShaving = &shavingBudget{Date: "2024-03-06", Hours: []int{1}}
+	if got, want := shaveDay(t, fixed, "2024-03-06"), []int{1, 11}; !slices.Equal(got, want) {
+		t.Errorf("after a restart: throttled hours %v, want %v", got, want)
+	}
+}
+
+func TestPeakShavingInEur(t *testing.T) {
+	simulatedSysfs(t, 1)
+	captureLogs(t)
+	// The day-ahead prices peak at 300 EUR at 10:00, 7500 CZK
+	prices := make([]float64, 24)
+	for i := range prices {
+		prices[i] = 100
+	}
+	prices[10] = 300
+	server := otetest.NewCurrencyServer(otetest.Points("2024-03-04", 1, prices...), 25)
+	defer server.Close()
+	config := *effectiveConfig
+	config.Source.WSDL = server.URL
+	setGlobal(t, &effectiveConfig, &config)
+	setGlobal(t, &oteLimiter, &spacingLimiter{})
+	setGlobal[ote.PriceSource](t, &priceSource, effectiveConfig.Source.oteClient())
+	start, err := ote.HourStart("2024-03-04", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal[clock](t, &cycleClock, &fixedClock{start})
+	setGlobal[policy.Policy](t, &cyclePolicy, policy.PeakShaving{Budget: 1})
+	setGlobal(t, &dayAhead, new(dayAheadPrices))
+	setGlobal(t, &state, new(State))
+
+	// The intraday price of 07:00, 350 EUR, tops the day-ahead ones in EUR
+	// and is the hour to throttle
+	decision := &Decision{Time: start, Band: policy.Cheap}
+	adjustForPeakShaving(context.Background(), decision, []ote.PricePoint{{Start: start, Price: 350}})
+	if decision.Band != policy.Expensive {
+		t.Errorf("hour 8 at 350 EUR decided %s, want it throttled over the day-ahead peak of 300 EUR", decision.Band)
+	}
+	if today := dayAhead.current(start).Today; today == nil || today.Max != 300 {
+		t.Errorf("day-ahead prices %+v, want those in EUR peaking at 300", today)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/peer"
+)
+
+const (
+	// peerTimeout bounds the requests of a follower to its leader
+	peerTimeout = 10 * time.Second
+	// defaultPeerMaxAge is how old the prices of the leader may be
+	defaultPeerMaxAge = 90 * time.Minute
+)
+
+var (
+	// servePrices serves the fetched prices to followers on /prices of the
+	// status endpoint, see OutputsConfig
+	servePrices bool
+	// peerKeys sign the served prices with the first one, and verify the
+	// prices of the leader with any of them, see PeerConfig
+	peerKeys [][]byte
+)
+
+// fetchedPrices are the prices of the last fetch, served to the followers.
+var fetchedPrices = new(sharedPrices)
+
+// sharedPrices holds the prices of the last fetch for the prices endpoint,
+// which reads them outside the cycles.
+type sharedPrices struct {
+	mu      sync.Mutex
+	payload *peer.Payload
+}
+
+// set records the prices fetched at t.
+func (s *sharedPrices) set(t time.Time, points []ote.PricePoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payload = &peer.Payload{Fetched: t, Points: points}
+}
+
+// latest returns the prices of the last fetch, or nil.
+func (s *sharedPrices) latest() *peer.Payload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payload
+}
+
+// peerSource returns the source reading the prices from the leader at url,
+// fetching them with fallback when it cannot. It is called once peerKeys are
+// set.
+func peerSource(url string, maxAge time.Duration, fallback ote.PriceSource) *peer.Source {
+	return &peer.Source{
+		URL:      url,
+		Client:   newHTTPClient(nil, peerTimeout),
+		MaxAge:   maxAge,
+		Fallback: fallback,
+		Keys:     peerKeys,
+		OnFallback: func(err error) {
+			errorLogger.Printf("WARNING: the peer cannot serve the prices, fetching them directly: %s\n", err.Error())
+		},
+	}
+}
+
+// signingKey returns the key the served prices are signed with, or nil.
+func signingKey() []byte {
+	if len(peerKeys) == 0 {
+		return nil
+	}
+	return peerKeys[0]
+}
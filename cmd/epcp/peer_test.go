@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestLeaderFollower(t *testing.T) {
+	now := time.Now()
+	// The leader sees rising prices, the fallback of the follower falling
+	// ones, so that the decisions tell where the prices came from
+	leaderSource := &countingSource{PriceSource: trend(now, 10)}
+	runOnMocks(t, leaderSource)
+	logs := captureLogs(t)
+	setGlobal(t, &fetchedPrices, new(sharedPrices))
+	setGlobal(t, &servePrices, true)
+	setGlobal(t, &status, &cycleStatus{started: now, frequencies: make(map[int]int)})
+	leader := httptest.NewServer(statusHandler(time.Hour))
+	defer leader.Close()
+
+	// Before its first fetch, the leader has nothing to serve
+	fallback := &countingSource{PriceSource: trend(now, -10)}
+	follower := peerSource(leader.URL+"/prices", defaultPeerMaxAge, fallback)
+	priceSource = follower
+	if result := runCycle(context.Background()); result.Decision == nil || result.Decision.Band != policy.Cheap || fallback.calls.Load() == 0 {
+		t.Fatalf("decision %+v after %d calls of the fallback, want it fetched directly", result.Decision, fallback.calls.Load())
+	}
+	if !strings.Contains(logs.String(), "WARNING: the peer cannot serve the prices, fetching them directly: peer returned 503 Service Unavailable") {
+		t.Errorf("the fallback not logged:\n%s", logs)
+	}
+
+	priceSource = leaderSource
+	if result := runCycle(context.Background()); result.Decision == nil || result.Decision.Band != policy.Expensive {
+		t.Fatalf("leader decision %+v, want expensive", result.Decision)
+	}
+	leaderCalls := leaderSource.calls.Load()
+
+	// The follower decides on the prices of the leader without fetching
+	priceSource = follower
+	fallback.calls.Store(0)
+	if result := runCycle(context.Background()); result.Decision == nil || result.Decision.Band != policy.Expensive {
+		t.Errorf("follower decision %+v, want expensive on the prices of the leader", result.Decision)
+	}
+	if n := fallback.calls.Load(); n != 0 || leaderSource.calls.Load() != leaderCalls {
+		t.Errorf("%d calls of the fallback, %d of the source of the leader, want none", n, leaderSource.calls.Load()-leaderCalls)
+	}
+
+	// Prices the leader fetched too long ago are not used
+	latest := fetchedPrices.latest()
+	fetchedPrices.set(now.Add(-2*time.Hour), latest.Points)
+	if result := runCycle(context.Background()); result.Decision == nil || result.Decision.Band != policy.Cheap || fallback.calls.Load() == 0 {
+		t.Errorf("decision %+v on stale prices of the leader, want them fetched directly", result.Decision)
+	}
+	if !strings.Contains(logs.String(), "the prices of the peer are stale: fetched 2h0m0s ago") {
+		t.Errorf("the stale prices not logged:\n%s", logs)
+	}
+
+	// Nor those of a leader that is down
+	fetchedPrices.set(now, latest.Points)
+	leader.Close()
+	fallback.calls.Store(0)
+	if result := runCycle(context.Background()); result.Decision == nil || result.Decision.Band != policy.Cheap || fallback.calls.Load() == 0 {
+		t.Errorf("decision %+v with the leader down, want the prices fetched directly", result.Decision)
+	}
+}
+
+func TestSignedLeader(t *testing.T) {
+	now := time.Now()
+	runOnMocks(t, trend(now, 10))
+	logs := captureLogs(t)
+	setGlobal(t, &fetchedPrices, new(sharedPrices))
+	setGlobal(t, &servePrices, true)
+	// The leader signs with the new key while accepting the previous one
+	setGlobal(t, &peerKeys, [][]byte{[]byte("new secret"), []byte("old secret")})
+	runCycle(context.Background())
+	leader := httptest.NewServer(statusHandler(time.Hour))
+	defer leader.Close()
+
+	fallback := &countingSource{PriceSource: trend(now, -10)}
+	priceSource = peerSource(leader.URL+"/prices", defaultPeerMaxAge, fallback)
+	if result := runCycle(context.Background()); result.Decision == nil || result.Decision.Band != policy.Expensive || fallback.calls.Load() != 0 {
+		t.Errorf("decision %+v, want the signed prices of the leader", result.Decision)
+	}
+
+	// A follower that only knows the previous key rejects them
+	setGlobal(t, &peerKeys, [][]byte{[]byte("old secret")})
+	priceSource = peerSource(leader.URL+"/prices", defaultPeerMaxAge, fallback)
+	if result := runCycle(context.Background()); result.Decision == nil || result.Decision.Band != policy.Cheap || fallback.calls.Load() == 0 {
+		t.Errorf("decision %+v, want the prices fetched directly", result.Decision)
+	}
+	if !strings.Contains(logs.String(), "fetching them directly: invalid signature of the prices of the peer") {
+		t.Errorf("the invalid signature not logged:\n%s", logs)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// The outcomes of an actuator.
+const (
+	outcomeApplied = "applied"
+	outcomeSkipped = "skipped"
+	outcomeFailed  = "failed"
+)
+
+// actuatorOutcome is what an actuator did with a decision.
+type actuatorOutcome struct {
+	Name string `json:"name"`
+	// Outcome is applied, skipped or failed
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// actuatorStage applies the decision of a cycle with one actuator, reporting
+// whether it applied anything.
+type actuatorStage struct {
+	name  string
+	apply func(ctx context.Context, result *cycleResult) (bool, error)
+}
+
+// actuatorPipeline is the enabled actuators in the order they apply the
+// decisions, see newActuatorPipeline.
+var actuatorPipeline = []actuatorStage{{"frequency", applyFrequencies}}
+
+// newActuatorPipeline returns the stages of the enabled actuators in the
+// order they are configured, the frequencies first unless a frequency
+// actuator is listed.
+func newActuatorPipeline(actuators []ActuatorConfig) []actuatorStage {
+	var stages []actuatorStage
+	frequency := false
+	for _, a := range actuators {
+		if !extraActuators[a.Type] {
+			frequency = true
+		}
+		if a.Disabled {
+			continue
+		}
+		switch a.Type {
+		case "redfish":
+			stages = append(stages, actuatorStage{a.Type, applyPowerCap})
+		case "libvirt":
+			stages = append(stages, actuatorStage{a.Type, applyGuestShares})
+		case "docker":
+			stages = append(stages, actuatorStage{a.Type, applyContainerLimits})
+		case "systemd":
+			stages = append(stages, actuatorStage{a.Type, applyUnitQuotas})
+		default:
+			stages = append(stages, actuatorStage{"frequency", applyFrequencies})
+		}
+	}
+	if !frequency {
+		stages = append([]actuatorStage{{"frequency", applyFrequencies}}, stages...)
+	}
+	return stages
+}
+
+// runActuators applies the decision of the cycle with the actuators in
+// order. A failing actuator does not keep the next ones from applying it;
+// the outcome of each is recorded in the decision.
+func runActuators(ctx context.Context, result *cycleResult) {
+	var outcomes []actuatorOutcome
+	for _, stage := range actuatorPipeline {
+		applied, err := stage.apply(ctx, result)
+		if result.Decision == nil {
+			// The frequencies were not applied because of a shutdown
+			return
+		}
+		outcome := actuatorOutcome{Name: stage.name, Outcome: outcomeSkipped}
+		switch {
+		case err != nil:
+			outcome.Outcome, outcome.Error = outcomeFailed, err.Error()
+			metrics.addCounter("epcp_actuator_failures_total", "Number of decisions an actuator failed to apply.", 1, "actuator", stage.name)
+		case applied:
+			outcome.Outcome = outcomeApplied
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	result.Decision.Actuators = outcomes
+	if len(outcomes) > 1 {
+		infoLog(ctx).Printf("Actuators: %s\n", actuatorsSummary(outcomes))
+	}
+}
+
+// applyFrequencies is the stage of the frequency actuator, skipped when no
+// CPU needed a write.
+func applyFrequencies(ctx context.Context, result *cycleResult) (bool, error) {
+	result.Decision = applyDecision(ctx, result.Decision)
+	if result.Decision == nil {
+		return false, nil
+	}
+	summary := result.Decision.Summary
+	written := len(summary.Succeeded) > len(summary.Unchanged)
+	if len(summary.Failed) != 0 {
+		return written, fmt.Errorf("%d CPUs failed", len(summary.Failed))
+	}
+	return written, nil
+}
+
+// actuatorsSummary returns the one-line summary of the outcomes.
+func actuatorsSummary(outcomes []actuatorOutcome) string {
+	parts := make([]string, len(outcomes))
+	for i, o := range outcomes {
+		parts[i] = o.Name + " " + o.Outcome
+		if o.Error != "" {
+			parts[i] += " (" + o.Error + ")"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestNewActuatorPipeline(t *testing.T) {
+	tests := []struct {
+		name      string
+		actuators []ActuatorConfig
+		want      string
+	}{
+		{"none", nil, "frequency"},
+		{"frequency first", []ActuatorConfig{{Type: "redfish"}, {Type: "docker"}}, "frequency redfish docker"},
+		{"listed", []ActuatorConfig{{Type: "redfish"}, {Type: "sysfs"}, {Type: "docker"}}, "redfish frequency docker"},
+		{"disabled", []ActuatorConfig{{Type: "libvirt", Disabled: true}, {Type: "systemd"}}, "frequency systemd"},
+		{"frequency disabled", []ActuatorConfig{{Type: "redfish"}, {Type: "simulation", Disabled: true}}, "redfish"},
+	}
+	for _, test := range tests {
+		var names []string
+		for _, stage := range newActuatorPipeline(test.actuators) {
+			names = append(names, stage.name)
+		}
+		if got := strings.Join(names, " "); got != test.want {
+			t.Errorf("%s: stages %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRunActuators(t *testing.T) {
+	logs := captureLogs(t)
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	var order []string
+	stage := func(name string, applied bool, err error) actuatorStage {
+		return actuatorStage{name, func(ctx context.Context, result *cycleResult) (bool, error) {
+			order = append(order, name)
+			if result.Decision.Band != policy.Expensive {
+				t.Errorf("%s: decision %+v, want that of the cycle", name, result.Decision)
+			}
+			return applied, err
+		}}
+	}
+	setGlobal(t, &actuatorPipeline, []actuatorStage{
+		stage("governor", true, nil),
+		stage("redfish", false, e.New("BMC unreachable")),
+		stage("docker", false, nil),
+	})
+
+	result := &cycleResult{Decision: &Decision{Time: time.Now(), Band: policy.Expensive, Frequency: 800000}}
+	runActuators(context.Background(), result)
+	if got := strings.Join(order, " "); got != "governor redfish docker" {
+		t.Errorf("actuators ran in order %q", got)
+	}
+	want := []actuatorOutcome{
+		{Name: "governor", Outcome: outcomeApplied},
+		{Name: "redfish", Outcome: outcomeFailed, Error: "BMC unreachable"},
+		{Name: "docker", Outcome: outcomeSkipped},
+	}
+	if got := result.Decision.Actuators; len(got) != len(want) {
+		t.Fatalf("outcomes %+v, want %+v", got, want)
+	}
+	for i, o := range result.Decision.Actuators {
+		if o != want[i] {
+			t.Errorf("outcome %d %+v, want %+v", i, o, want[i])
+		}
+	}
+	if !strings.Contains(logs.String(), "INFO: Actuators: governor applied, redfish failed (BMC unreachable), docker skipped\n") {
+		t.Errorf("the summary not logged:\n%s", logs)
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	if !strings.Contains(exposition.String(), `epcp_actuator_failures_total{actuator="redfish"} 1`+"\n") ||
+		strings.Contains(exposition.String(), `actuator="governor"`) {
+		t.Errorf("metrics:\n%s", exposition.String())
+	}
+}
+
+func TestFrequencyStage(t *testing.T) {
+	runOnMocks(t, trend(time.Now(), 10))
+	logs := captureLogs(t)
+	setGlobal(t, &actuatorPipeline, newActuatorPipeline([]ActuatorConfig{{Type: "sysfs"}}))
+	result := runCycle(context.Background())
+	if got := result.Decision.Actuators; len(got) != 1 || got[0] != (actuatorOutcome{Name: "frequency", Outcome: outcomeApplied}) {
+		t.Errorf("outcomes %+v, want the frequencies applied", got)
+	}
+	// A single actuator needs no summary
+	if strings.Contains(logs.String(), "Actuators:") {
+		t.Errorf("the summary logged for one actuator:\n%s", logs)
+	}
+	// Nothing to write the second time
+	if got := runCycle(context.Background()).Decision.Actuators; len(got) != 1 || got[0].Outcome != outcomeSkipped {
+		t.Errorf("outcomes %+v, want the frequencies skipped", got)
+	}
+}
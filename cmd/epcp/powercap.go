@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	e "errors"
+	"net/http"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// powerCapTimeout bounds each request to the BMC.
+const powerCapTimeout = 10 * time.Second
+
+// powerCap limits the platform power per band, see ActuatorConfig; it is
+// nil without a redfish actuator or once the BMC refused the limit.
+var powerCap *platformCap
+
+type platformCap struct {
+	bmc *actuator.Redfish
+	// caps maps the bands to the limit in watts, none for the others
+	caps map[string]int
+	// watts is the limit epcp set, 0 when none
+	watts int
+}
+
+func newPowerCap(a ActuatorConfig) *platformCap {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if a.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := newHTTPClient(transport, powerCapTimeout)
+	return &platformCap{bmc: &actuator.Redfish{Chassis: a.URL, Username: a.Username, Password: a.Password, Client: client}, caps: a.Caps}
+}
+
+// applyPowerCap sets the power limit of the decided band when it changed.
+func applyPowerCap(ctx context.Context, result *cycleResult) (bool, error) {
+	if powerCap == nil || paused.Load() || result.Decision.suspended() {
+		return false, nil
+	}
+	watts := powerCap.caps[result.Decision.Band]
+	if watts == powerCap.watts {
+		return false, nil
+	}
+	return true, powerCap.set(ctx, watts)
+}
+
+// clearPowerCap removes the power limit epcp set, on exit.
+func clearPowerCap() {
+	if powerCap == nil {
+		return
+	}
+	powerCap.set(context.Background(), 0)
+}
+
+// set changes the limit to watts, 0 removing it. A BMC refusing the limit
+// disables the actuator.
+func (c *platformCap) set(ctx context.Context, watts int) error {
+	if watts == c.watts {
+		return nil
+	}
+	if dryRun || simulate {
+		infoLog(ctx).Printf("Would set the platform power limit to %d W\n", watts)
+		return nil
+	}
+	// Like the frequencies, the limit is set even during a shutdown
+	err := c.bmc.SetPowerLimit(context.WithoutCancel(ctx), watts)
+	if e.Is(err, actuator.ErrReadOnly) {
+		errorLog(ctx).Println("WARNING: the BMC does not allow setting the power limit, disabling the redfish actuator.")
+		powerCap = nil
+		return err
+	}
+	if err != nil {
+		errorLog(ctx).Printf("Error setting the platform power limit to %d W: %s\n", watts, err.Error())
+		return err
+	}
+	if watts == 0 {
+		infoLog(ctx).Println("Platform power limit removed")
+	} else {
+		infoLog(ctx).Printf("Platform power limit set to %d W\n", watts)
+	}
+	c.watts = watts
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// powerLimitBMC is a Redfish stub with the PowerLimit control of chassis 1,
+// recording the PATCH bodies and refusing them as read-only once readOnly
+// is set.
+func powerLimitBMC(t *testing.T) (server *httptest.Server, patched func() []string, readOnly func()) {
+	t.Helper()
+	var mu sync.Mutex
+	var patches []string
+	refuse := false
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/redfish/v1/Chassis/1/Controls/PowerLimit" {
+			http.NotFound(w, r)
+			return
+		}
+		if user, password, _ := r.BasicAuth(); user != "root" || password != "calvin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPatch {
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		patches = append(patches, string(body))
+		if refuse {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"code":"Base.1.8.PropertyNotWritable"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	patched = func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		received := patches
+		patches = nil
+		return received
+	}
+	readOnly = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		refuse = true
+	}
+	return server, patched, readOnly
+}
+
+func TestPowerCap(t *testing.T) {
+	logs := captureLogs(t)
+	bmc, patched, readOnly := powerLimitBMC(t)
+	config := ActuatorConfig{Type: "redfish", URL: bmc.URL + "/redfish/v1/Chassis/1", Username: "root", Password: "calvin",
+		Caps: map[string]int{policy.Expensive: 400, policy.Cheap: 600}}
+	setGlobal(t, &powerCap, newPowerCap(config))
+	setGlobal(t, &dryRun, false)
+	setGlobal(t, &simulate, false)
+	ctx := context.Background()
+	cycle := func(band string) *cycleResult {
+		return &cycleResult{Decision: &Decision{Time: time.Now(), Band: band}}
+	}
+
+	// The limit of the band is set when it changes
+	for i, band := range []string{policy.Expensive, policy.Expensive, policy.Cheap} {
+		if applied, err := applyPowerCap(ctx, cycle(band)); applied != (i != 1) || err != nil {
+			t.Fatalf("%s: applied %t, %v", band, applied, err)
+		}
+	}
+	want := []string{`{"ControlMode":"Automatic","SetPoint":400}`, `{"ControlMode":"Automatic","SetPoint":600}`}
+	if got := patched(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("PATCH bodies %q, want %q", got, want)
+	}
+
+	// and removed for a band without one
+	delete(powerCap.caps, policy.Cheap)
+	applyPowerCap(ctx, cycle(policy.Cheap))
+	if got := patched(); len(got) != 1 || got[0] != `{"ControlMode":"Disabled"}` {
+		t.Errorf("PATCH bodies %q for the cheap band, want the limit removed", got)
+	}
+
+	// A suspended decision leaves the limit alone
+	suspended := cycle(policy.Expensive)
+	suspended.Decision.Maintenance = true
+	if applied, _ := applyPowerCap(ctx, suspended); applied || len(patched()) != 0 {
+		t.Errorf("maintenance: applied %t, want the limit unchanged", applied)
+	}
+
+	// The limit is cleared on exit
+	applyPowerCap(ctx, cycle(policy.Expensive))
+	patched()
+	clearPowerCap()
+	if got := patched(); len(got) != 1 || got[0] != `{"ControlMode":"Disabled"}` {
+		t.Errorf("PATCH bodies %q on exit, want the limit removed", got)
+	}
+
+	// A BMC refusing the limit disables the actuator
+	readOnly()
+	if _, err := applyPowerCap(ctx, cycle(policy.Expensive)); err == nil {
+		t.Error("read-only limit: no error")
+	}
+	if powerCap != nil || !strings.Contains(logs.String(), "WARNING: the BMC does not allow setting the power limit") {
+		t.Errorf("the actuator not disabled:\n%s", logs)
+	}
+	if applied, err := applyPowerCap(ctx, cycle(policy.Cheap)); applied || err != nil || len(patched()) != 1 {
+		t.Errorf("after disabling: applied %t, %v, want nothing sent", applied, err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// preflight verifies that the sysfs files the scaling needs exist and can be
+// opened for writing, without writing to them, and that the interfaces of
+// the other actuators enabled are there. All problems are returned at once.
+func preflight() error {
+	var errs []error
+	if _, err := sysfs.Stat(cpuPath(0, "cpufreq", "scaling_available_frequencies")); err != nil {
+		errs = append(errs, fmt.Errorf("available frequencies: %w", err))
+	}
+	for _, i := range hostCPUs() {
+		path := cpuPath(i, "cpufreq", "scaling_max_freq")
+		// Writes by the apply helper happen with its privileges
+		if applyHelper != "" || applySocket != "" {
+			if _, err := sysfs.Stat(path); err != nil {
+				errs = append(errs, fmt.Errorf("cpu%d: %w", i, err))
+			}
+			continue
+		}
+		if err := actuator.CheckWritable(sysfs, path); err != nil {
+			errs = append(errs, fmt.Errorf("cpu%d: %w", i, err))
+		}
+	}
+	return e.Join(append(errs, preflightActuators()...)...)
+}
+
+// preflightActuators verifies the interfaces of the actuators enabled next
+// to the frequencies, without changing anything: that the BMC of the redfish
+// actuator answers at its URL, virsh of the libvirt one is on the PATH, the
+// socket of the Docker daemon exists and the systemd manager is reachable
+// over D-Bus.
+func preflightActuators() []error {
+	var errs []error
+	if powerCap != nil {
+		if err := checkBMC(powerCap.bmc); err != nil {
+			errs = append(errs, fmt.Errorf("redfish: %w", err))
+		}
+	}
+	if guestShares != nil {
+		command := strings.Fields(guestShares.virsh.Command)
+		if len(command) == 0 {
+			command = []string{"virsh"}
+		}
+		if _, err := exec.LookPath(command[0]); err != nil {
+			errs = append(errs, fmt.Errorf("libvirt: %w", err))
+		}
+	}
+	if containerLimits != nil {
+		if _, err := os.Stat(containerLimits.docker.Socket); err != nil {
+			errs = append(errs, fmt.Errorf("docker: %w", err))
+		}
+	}
+	if unitQuotas != nil {
+		bus, err := connectSystemBus()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("systemd: connecting the D-Bus system bus: %w", err))
+		} else {
+			bus.Close()
+		}
+	}
+	return errs
+}
+
+// checkBMC verifies that the chassis URL of the BMC is an HTTP one and that
+// the BMC answers it, whatever the status.
+func checkBMC(bmc *actuator.Redfish) error {
+	u, err := url.Parse(bmc.Chassis)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an HTTP URL", bmc.Chassis)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), powerCapTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, bmc.Chassis, nil)
+	if err != nil {
+		return err
+	}
+	if bmc.Username != "" {
+		req.SetBasicAuth(bmc.Username, bmc.Password)
+	}
+	client := bmc.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
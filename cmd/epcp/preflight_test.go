@@ -0,0 +1,205 @@
+package main
+
+import (
+	e "errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+func TestPreflight(t *testing.T) {
+	setGlobal(t, &applyHelper, "")
+	setGlobal(t, &applySocket, "")
+	tests := []struct {
+		name string
+		// remove are removed from the files of 4 CPUs, readOnly made
+		// read-only
+		remove, readOnly []string
+		// want are the problems reported, one per line
+		want []string
+	}{
+		{name: "ok"},
+		{
+			name:     "read-only",
+			readOnly: []string{cpuPath(1, "cpufreq", "scaling_max_freq"), cpuPath(3, "cpufreq", "scaling_max_freq")},
+			want:     []string{"cpu1: open " + cpuPath(1, "cpufreq", "scaling_max_freq") + ": permission denied", "cpu3: "},
+		},
+		{
+			name:   "missing",
+			remove: []string{cpuPath(0, "cpufreq", "scaling_available_frequencies"), cpuPath(2, "cpufreq", "scaling_max_freq")},
+			want:   []string{"available frequencies: ", "cpu2: stat " + cpuPath(2, "cpufreq", "scaling_max_freq") + ": file does not exist"},
+		},
+		{
+			name:     "everything",
+			remove:   []string{cpuPath(2, "cpufreq", "scaling_max_freq")},
+			readOnly: []string{cpuPath(0, "cpufreq", "scaling_max_freq")},
+			want:     []string{"cpu0: ", "cpu2: "},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := sysfsFiles(4)
+			files["/sys/devices/system/cpu/present"] = "0-3\n"
+			for _, path := range test.remove {
+				delete(files, path)
+			}
+			readOnly := make(map[string]bool)
+			for _, path := range test.readOnly {
+				readOnly[path] = true
+			}
+			useSysfs(t, readOnlyFS{actuator.NewMemFS(files), readOnly})
+			err := preflight()
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Errorf("got error %v, want none", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("got no error, want %q", test.want)
+			}
+			// All the problems are reported at once
+			problems := strings.Split(err.Error(), "\n")
+			if len(problems) != len(test.want) {
+				t.Fatalf("got problems %q, want %q", problems, test.want)
+			}
+			for i, want := range test.want {
+				if !strings.HasPrefix(problems[i], want) {
+					t.Errorf("problem %d is %q, want %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPreflightOS(t *testing.T) {
+	setGlobal(t, &applyHelper, "")
+	setGlobal(t, &applySocket, "")
+	root := t.TempDir()
+	for path, content := range sysfsFiles(2) {
+		path = filepath.Join(root, strings.TrimPrefix(path, "/sys"))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	useSysfs(t, actuator.OSFS{})
+	setGlobal(t, &sysfsRoot, root)
+	if err := preflight(); err != nil {
+		t.Errorf("got error %v, want none", err)
+	}
+	// The directory of a CPU without cpufreq
+	if err := os.RemoveAll(filepath.Dir(cpuPath(1, "cpufreq", "scaling_max_freq"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := preflight(); !e.Is(err, fs.ErrNotExist) || !strings.HasPrefix(err.Error(), "cpu1: ") {
+		t.Errorf("got error %v, want cpu1 missing", err)
+	}
+}
+
+func TestPreflightActuators(t *testing.T) {
+	setGlobal(t, &applyHelper, "")
+	setGlobal(t, &applySocket, "")
+	files := sysfsFiles(4)
+	files["/sys/devices/system/cpu/present"] = "0-3\n"
+	useSysfs(t, actuator.NewMemFS(files))
+	bmc := httptest.NewServer(http.NotFoundHandler())
+	defer bmc.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "docker.sock")
+	if err := os.WriteFile(socket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	virsh := filepath.Join(dir, "virsh")
+	if err := os.WriteFile(virsh, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	busDown := e.New("no system bus")
+	bus := func(err error) func() (systemBus, error) {
+		return func() (systemBus, error) {
+			if err != nil {
+				return nil, err
+			}
+			return &fakeSystemd{}, nil
+		}
+	}
+
+	tests := []struct {
+		name        string
+		redfish     string
+		virsh       string
+		socket      string
+		busErr      error
+		want        []string
+		wantWrapped error
+	}{
+		{name: "ok", redfish: bmc.URL + "/redfish/v1/Chassis/1", virsh: virsh + " -c qemu:///system", socket: socket},
+		{name: "redfish URL", redfish: "bmc.example.org/Chassis/1", virsh: virsh, socket: socket,
+			want: []string{`redfish: "bmc.example.org/Chassis/1" is not an HTTP URL`}},
+		{name: "redfish unreachable", redfish: unreachable.URL, virsh: virsh, socket: socket,
+			want: []string{"redfish: Get "}},
+		{name: "virsh missing", redfish: bmc.URL, virsh: filepath.Join(dir, "missing"), socket: socket,
+			want: []string{"libvirt: exec: "}, wantWrapped: fs.ErrNotExist},
+		{name: "docker socket missing", redfish: bmc.URL, virsh: virsh, socket: filepath.Join(dir, "missing.sock"),
+			want: []string{"docker: stat " + filepath.Join(dir, "missing.sock") + ": no such file or directory"}, wantWrapped: fs.ErrNotExist},
+		{name: "system bus down", redfish: bmc.URL, virsh: virsh, socket: socket, busErr: busDown,
+			want: []string{"systemd: connecting the D-Bus system bus: no system bus"}, wantWrapped: busDown},
+		{name: "everything", redfish: "://", virsh: "", socket: filepath.Join(dir, "missing.sock"), busErr: busDown,
+			want: []string{"redfish: ", "libvirt: ", "docker: ", "systemd: "}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.virsh == "" {
+				// virsh of the default command, not on the empty PATH
+				t.Setenv("PATH", "")
+			}
+			setGlobal(t, &powerCap, newPowerCap(ActuatorConfig{Type: "redfish", URL: test.redfish}))
+			setGlobal(t, &guestShares, newGuestTuner(ActuatorConfig{Type: "libvirt", Command: test.virsh}))
+			setGlobal(t, &containerLimits, newContainerTuner(ActuatorConfig{Type: "docker", Socket: test.socket}))
+			setGlobal(t, &unitQuotas, newUnitTuner(ActuatorConfig{Type: "systemd"}))
+			setGlobal(t, &connectSystemBus, bus(test.busErr))
+			err := preflight()
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Errorf("got error %v, want none", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("got no error, want %q", test.want)
+			}
+			problems := strings.Split(err.Error(), "\n")
+			if len(problems) != len(test.want) {
+				t.Fatalf("got problems %q, want %q", problems, test.want)
+			}
+			for i, want := range test.want {
+				if !strings.HasPrefix(problems[i], want) {
+					t.Errorf("problem %d is %q, want %q", i, problems[i], want)
+				}
+			}
+			if test.wantWrapped != nil && !e.Is(err, test.wantWrapped) {
+				t.Errorf("got error %v, want it wrapping %v", err, test.wantWrapped)
+			}
+		})
+	}
+
+	// Without the actuators, only the frequencies are checked
+	setGlobal(t, &connectSystemBus, bus(busDown))
+	setGlobal(t, &powerCap, nil)
+	setGlobal(t, &guestShares, nil)
+	setGlobal(t, &containerLimits, nil)
+	setGlobal(t, &unitQuotas, nil)
+	if err := preflight(); err != nil {
+		t.Errorf("without the actuators: got error %v, want none", err)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	e "errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// barWidth is the width of the bars of the prices command, in characters.
+const barWidth = 40
+
+// sparkLevels are the characters of the sparkline, from the lowest price to
+// the highest.
+const sparkLevels = "_.-~=+*#"
+
+// priceThresholds are the alert thresholds marked on the charts, see
+// WebhookConfig.
+type priceThresholds struct {
+	High *float64 `json:"high,omitempty"`
+	Low  *float64 `json:"low,omitempty"`
+}
+
+// pricePreview is the window of prices the prices command prints, with the
+// band the policy decides on them.
+type pricePreview struct {
+	From       time.Time        `json:"from"`
+	To         time.Time        `json:"to"`
+	Points     []ote.PricePoint `json:"points"`
+	Min        float64          `json:"min"`
+	Max        float64          `json:"max"`
+	Mean       float64          `json:"mean"`
+	Thresholds priceThresholds  `json:"thresholds"`
+	// Band is empty when the policy cannot decide on the prices
+	Band string `json:"band,omitempty"`
+}
+
+func newPricePreview(times *Times, points []ote.PricePoint, thresholds priceThresholds) *pricePreview {
+	p := &pricePreview{From: times.start, To: times.end, Points: append([]ote.PricePoint{}, points...), Thresholds: thresholds}
+	prices := ote.Prices(points)
+	if len(prices) != 0 {
+		p.Min, p.Max = slices.Min(prices), slices.Max(prices)
+		for _, price := range prices {
+			p.Mean += price / float64(len(prices))
+		}
+	}
+	if band, err := dayPolicy(dayType(times.end)).Band(metricValues(ote.Prices(settledPoints(points)))); err == nil {
+		p.Band = band
+	}
+	return p
+}
+
+// scale maps the prices from lo to hi to the columns 0 to width-1. A flat
+// range maps to the last column.
+type scale struct {
+	lo, hi float64
+	width  int
+}
+
+func (s scale) column(price float64) int {
+	if s.hi <= s.lo {
+		return s.width - 1
+	}
+	c := int(math.Round((price - s.lo) / (s.hi - s.lo) * float64(s.width-1)))
+	return min(max(c, 0), s.width-1)
+}
+
+// bar draws the price as a bar from the zero axis, |, over the width of the
+// scale, with the columns of the marks drawn as : where the bar is not.
+func (s scale) bar(price float64, marks []float64) string {
+	line := []byte(strings.Repeat(" ", s.width))
+	for _, mark := range marks {
+		line[s.column(mark)] = ':'
+	}
+	zero, end := s.column(0), s.column(price)
+	for c := min(zero, end); c <= max(zero, end); c++ {
+		line[c] = '#'
+	}
+	line[zero] = '|'
+	return strings.TrimRight(string(line), " ")
+}
+
+// sparkline draws each price as one of sparkLevels, scaled from the lowest
+// price to the highest; a flat series is drawn at the middle level.
+func sparkline(prices []float64) string {
+	if len(prices) == 0 {
+		return ""
+	}
+	lo, hi := slices.Min(prices), slices.Max(prices)
+	var b strings.Builder
+	for _, price := range prices {
+		level := len(sparkLevels) / 2
+		if hi > lo {
+			level = int(math.Round((price - lo) / (hi - lo) * float64(len(sparkLevels)-1)))
+		}
+		b.WriteByte(sparkLevels[level])
+	}
+	return b.String()
+}
+
+// marks returns the thresholds set.
+func (t priceThresholds) marks() []float64 {
+	var marks []float64
+	for _, threshold := range []*float64{t.Low, t.High} {
+		if threshold != nil {
+			marks = append(marks, *threshold)
+		}
+	}
+	return marks
+}
+
+// print writes the preview as a table of the prices with their trend and
+// their bars from zero, the thresholds marked as columns of :, followed by
+// the sparkline of the series, or as JSON. The prices are in the display
+// unit in the table and in EUR/MWh in JSON.
+func (p *pricePreview) print(w io.Writer, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(p)
+	}
+	if len(p.Points) == 0 {
+		_, err := fmt.Fprintln(w, "No prices in the window.")
+		return err
+	}
+	marks := p.Thresholds.marks()
+	s := scale{lo: min(p.Min, 0), hi: max(p.Max, 0), width: barWidth}
+	for _, mark := range marks {
+		s.lo, s.hi = min(s.lo, mark), max(s.hi, mark)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "DATE\tHOUR\t%s\tTREND\tCHART\n", display.column())
+	for i, point := range p.Points {
+		trend := ""
+		if i > 0 {
+			trend = [...]string{"-", "=", "+"}[policy.Compare(point.Price, p.Points[i-1].Price)+1]
+		}
+		price := display.value(point.Price)
+		if point.Provisional {
+			price += " (provisional)"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", point.Date, point.Hour, price, trend, s.bar(point.Price, marks))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%s  min %s, mean %s, max %s\n", sparkline(ote.Prices(p.Points)), display.value(p.Min), display.value(p.Mean), display.price(p.Max))
+	var thresholds []string
+	if t := p.Thresholds.High; t != nil {
+		thresholds = append(thresholds, "high "+display.price(*t))
+	}
+	if t := p.Thresholds.Low; t != nil {
+		thresholds = append(thresholds, "low "+display.price(*t))
+	}
+	if len(thresholds) != 0 {
+		fmt.Fprintf(w, "Alert thresholds (:): %s\n", strings.Join(thresholds, ", "))
+	}
+	band := p.Band
+	if band == "" {
+		band = "none, too few prices"
+	}
+	_, err := fmt.Fprintf(w, "Band decided on these prices: %s\n", band)
+	return err
+}
+
+func pricesFlags(flags *flag.FlagSet) {
+	sourceFlags(flags)
+	flags.String("window", "", "`duration` of the window ending now, 1h to 168h (default the configured hours)")
+	flags.String("output", "table", "format of the output, table or json")
+}
+
+// runPrices prints the prices of the window ending now as a chart, to see
+// why the policy decides what it does.
+func runPrices(flags *flag.FlagSet) exitCode {
+	value := func(name string) string { return flags.Lookup(name).Value.String() }
+	output := value("output")
+	if output != "table" && output != "json" {
+		errorLogger.Printf("Unknown output %q, expected table or json.\n", output)
+		return exitUsage
+	}
+	window := historyWindow
+	if v := value("window"); v != "" {
+		var err error
+		if window, err = parseHistoryWindow(v); err != nil {
+			errorLogger.Printf("Error parsing --window: %s\n", err.Error())
+			return exitUsage
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trapSignals(cancel)
+	times := timeRange(cycleClock.Now(), window)
+	points, err := getElectrictyPrices(ctx, times)
+	if err != nil && !e.Is(err, ote.ErrNoData) {
+		errorLogger.Printf("Error fetching prices: %s\n", err.Error())
+		return exitFetchFailed
+	}
+	thresholds := priceThresholds{High: effectiveConfig.Outputs.Webhook.PriceHigh, Low: effectiveConfig.Outputs.Webhook.PriceLow}
+	if err := newPricePreview(times, points, thresholds).print(os.Stdout, output == "json"); err != nil {
+		errorLogger.Printf("Error writing the prices: %s\n", err.Error())
+		return exitFailure
+	}
+	if len(points) == 0 {
+		return exitInsufficientData
+	}
+	return exitOK
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		prices []float64
+		want   string
+	}{
+		{nil, ""},
+		{[]float64{0, 1, 2, 3, 4, 5, 6, 7}, "_.-~=+*#"},
+		{[]float64{-70, 0, -40}, "_#~"},
+		// Flat series are drawn at the middle level
+		{[]float64{80, 80, 80}, "==="},
+		{[]float64{-5}, "="},
+	}
+	for _, test := range tests {
+		if got := sparkline(test.prices); got != test.want {
+			t.Errorf("%v: sparkline %q, want %q", test.prices, got, test.want)
+		}
+	}
+}
+
+func TestPricePreviewGolden(t *testing.T) {
+	high, low, negative := 120.0, 60.0, -20.0
+	tests := []struct {
+		name        string
+		prices      []float64
+		thresholds  priceThresholds
+		provisional bool
+	}{
+		// An evening peak crossing both thresholds, the last price not
+		// yet settled
+		{"day", []float64{55, 62, 80, 104, 131, 142, 118, 90}, priceThresholds{High: &high, Low: &low}, true},
+		// A sunny noon below zero
+		{"negative", []float64{30, 4.5, -12, -40, -38.25, -5, 12, 28}, priceThresholds{Low: &negative}, false},
+		{"flat", []float64{80, 80, 80, 80}, priceThresholds{}, false},
+	}
+	for _, test := range tests {
+		points := otetest.Points("2024-06-12", 10, test.prices...)
+		points[len(points)-1].Provisional = test.provisional
+		times := &Times{start: points[0].Start, end: points[len(points)-1].Start.Add(time.Hour)}
+		for _, format := range []string{"table", "json"} {
+			t.Run(test.name+"/"+format, func(t *testing.T) {
+				var out bytes.Buffer
+				if err := newPricePreview(times, points, test.thresholds).print(&out, format == "json"); err != nil {
+					t.Fatal(err)
+				}
+				golden := filepath.Join("testdata", "prices-"+test.name+"-"+format+".golden")
+				if *update {
+					if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if out.String() != string(want) {
+					t.Errorf("preview differs from %s, run the tests with -update if intended:\n%s", golden, out.String())
+				}
+			})
+		}
+	}
+}
+
+func TestPricePreviewEmpty(t *testing.T) {
+	now := time.Now()
+	var out strings.Builder
+	if err := newPricePreview(timeRange(now, time.Hour), nil, priceThresholds{}).print(&out, false); err != nil || out.String() != "No prices in the window.\n" {
+		t.Errorf("preview %q, %v without prices", out.String(), err)
+	}
+	points := otetest.Points("2024-06-12", 10, 42)
+	p := newPricePreview(timeRange(points[0].Start.Add(time.Hour), time.Hour), points, priceThresholds{})
+	out.Reset()
+	if err := p.print(&out, false); err != nil || !strings.HasSuffix(out.String(), "Band decided on these prices: none, too few prices\n") {
+		t.Errorf("preview of one price %q, %v", out.String(), err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/profile"
+)
+
+var (
+	// profileFallback decides on the profile when no prices can be fetched,
+	// cached or forecast, see SourceConfig
+	profileFallback bool
+	// profileFile is the CSV file of the profile, the embedded one when
+	// empty
+	profileFile string
+)
+
+// profileSource returns the source of the profile of the file, or of the
+// embedded one.
+func profileSource(path string) (*profile.Source, error) {
+	if path == "" {
+		return profile.Default(), nil
+	}
+	return profile.Load(path)
+}
+
+// profilePrices returns the prices of the profile for the window, the last
+// resort of fetchPrices. It returns nil when the profile cannot be read.
+func profilePrices(ctx context.Context, times *Times) []ote.PricePoint {
+	source, err := profileSource(profileFile)
+	if err != nil {
+		errorLog(ctx).Printf("Error loading the price profile: %s\n", err.Error())
+		return nil
+	}
+	points, err := ote.FetchWindow(ctx, source, times.start, times.end)
+	if err != nil {
+		errorLog(ctx).Printf("Error pricing the window from the profile: %s\n", err.Error())
+		return nil
+	}
+	return points
+}
+
+// adjustForProfile marks a decision based on the prices of the profile.
+func adjustForProfile(result *cycleResult) {
+	decision := result.Decision
+	if decision == nil {
+		return
+	}
+	for _, p := range result.Points {
+		if p.Source == ote.SourceProfile {
+			decision.Profile = true
+			metrics.addCounter("epcp_profile_decisions_total", "Number of decisions based on the price profile.", 1)
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestProfileDrivesADay(t *testing.T) {
+	// No source has any prices
+	tree := runOnMocks(t, otetest.NewFake())
+	logs := captureLogs(t)
+	fixed := &fixedClock{}
+	setGlobal[clock](t, &cycleClock, fixed)
+	setGlobal(t, &profileFallback, true)
+
+	// The embedded profile rises in the mornings and evenings and falls
+	// at night and midday
+	expensive := map[int]bool{5: true, 6: true, 7: true, 8: true, 9: true, 15: true, 16: true, 17: true, 18: true, 19: true}
+	day := time.Date(2024, time.October, 1, 0, 0, 0, 0, ote.Location())
+	changes := 0
+	last := ""
+	for hour := range 24 {
+		fixed.now = day.Add(time.Duration(hour)*time.Hour + 30*time.Minute)
+		d := runCycle(context.Background()).Decision
+		want, applied := policy.Cheap, "3200000"
+		if expensive[hour] {
+			want, applied = policy.Expensive, "800000"
+		}
+		if d == nil || d.Band != want || !d.Profile {
+			t.Errorf("%02d:30: decision %+v, want the %s band on the profile", hour, d, want)
+			continue
+		}
+		if got := readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")); got != applied {
+			t.Errorf("%02d:30: scaling_max_freq %s, want %s", hour, got, applied)
+		}
+		if last != "" && d.Band != last {
+			changes++
+		}
+		last = d.Band
+	}
+	if changes != 4 {
+		t.Errorf("%d band changes over the day, want 4", changes)
+	}
+	if n := strings.Count(logs.String(), "), using the price profile\n"); n != 24 {
+		t.Errorf("the profile logged %d times, want every cycle:\n%s", n, logs)
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	if !strings.Contains(exposition.String(), "epcp_profile_decisions_total 24\n") {
+		t.Errorf("metrics without 24 profile decisions:\n%s", exposition.String())
+	}
+}
+
+func TestProfileOnlyAsLastResort(t *testing.T) {
+	runOnMocks(t, otetest.NewFake())
+	captureLogs(t)
+	if d := runCycle(context.Background()).Decision; d != nil && d.Profile {
+		t.Errorf("decision %+v on the profile without the fallback", d)
+	}
+
+	// The prices of the market take precedence
+	runOnMocks(t, trend(time.Now(), 10))
+	setGlobal(t, &profileFallback, true)
+	if d := runCycle(context.Background()).Decision; d == nil || d.Profile || d.Band != policy.Expensive {
+		t.Errorf("decision %+v, want that on the prices of the market", d)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+var (
+	// ignoreProvisional leaves the provisional price out of the decisions,
+	// see SourceConfig
+	ignoreProvisional bool
+	// provisionalWeight is the weight of the provisional price against that
+	// of the hour before in the decisions, 1 to decide on it as it is
+	provisionalWeight = 1.0
+)
+
+// markProvisional marks the newest market price as provisional while its
+// hour is still trading: OTE publishes the intraday price of the current hour
+// incrementally, so it may change until the hour ends and settles within the
+// evaluation offset after.
+func markProvisional(points []ote.PricePoint, now time.Time) {
+	newest := -1
+	for i, p := range points {
+		if p.Source == "" && !p.Start.IsZero() && (newest < 0 || p.Start.After(points[newest].Start)) {
+			newest = i
+		}
+	}
+	if newest >= 0 && now.Before(points[newest].Start.Add(time.Hour+evalOffset)) {
+		points[newest].Provisional = true
+	}
+}
+
+// trackRevisions compares the prices of the points with those of the last
+// fetch and counts the hours whose price changed since.
+func trackRevisions(ctx context.Context, points []ote.PricePoint) {
+	if state.Prices == nil {
+		return
+	}
+	seen := make(map[time.Time]float64, len(state.Prices.Points))
+	for _, p := range state.Prices.Points {
+		if p.Source == "" {
+			seen[p.Start] = p.Price
+		}
+	}
+	for _, p := range points {
+		price, ok := seen[p.Start]
+		if !ok || p.Source != "" || price == p.Price {
+			continue
+		}
+		infoLog(ctx).Printf("The price of hour %d on %s was revised from %s to %s\n", p.Hour, p.Date, display.price(price), display.price(p.Price))
+		metrics.addCounter("epcp_price_revisions_total", "Number of hourly prices that changed between fetches.", 1)
+	}
+}
+
+// settledPoints returns the points the policy decides on: without the
+// provisional price with ignoreProvisional, or else with it weighted towards
+// the price of the hour before by provisionalWeight.
+func settledPoints(points []ote.PricePoint) []ote.PricePoint {
+	settled := make([]ote.PricePoint, 0, len(points))
+	for i, p := range points {
+		if p.Provisional {
+			if ignoreProvisional {
+				continue
+			}
+			if i > 0 {
+				p.Price = provisionalWeight*p.Price + (1-provisionalWeight)*points[i-1].Price
+			}
+		}
+		settled = append(settled, p)
+	}
+	return settled
+}
+
+// adjustForProvisional marks a decision that took a provisional price into
+// account.
+func adjustForProvisional(decision *Decision, points []ote.PricePoint) {
+	if decision == nil {
+		return
+	}
+	for _, p := range points {
+		if p.Provisional {
+			decision.Provisional = true
+			return
+		}
+	}
+}
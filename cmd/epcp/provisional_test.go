@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestMarkProvisional(t *testing.T) {
+	hour := time.Date(2024, time.October, 1, 10, 0, 0, 0, ote.Location())
+	points := func() []ote.PricePoint {
+		return []ote.PricePoint{{Start: hour.Add(-time.Hour)}, {Start: hour}, {Start: hour.Add(time.Hour), Source: "forecast"}}
+	}
+	tests := []struct {
+		name   string
+		now    time.Time
+		offset time.Duration
+		want   bool
+	}{
+		{"trading", hour.Add(40 * time.Minute), 0, true},
+		{"ended", hour.Add(time.Hour), 0, false},
+		{"settling", hour.Add(time.Hour + 5*time.Minute), 10 * time.Minute, true},
+	}
+	for _, test := range tests {
+		setGlobal(t, &evalOffset, test.offset)
+		p := points()
+		markProvisional(p, test.now)
+		// Only the newest market price may be provisional
+		if p[0].Provisional || p[1].Provisional != test.want || p[2].Provisional {
+			t.Errorf("%s: provisional %t %t %t, want hour 11 %t", test.name, p[0].Provisional, p[1].Provisional, p[2].Provisional, test.want)
+		}
+	}
+}
+
+func TestSettledPoints(t *testing.T) {
+	points := []ote.PricePoint{{Price: 80}, {Price: 200, Provisional: true}}
+	tests := []struct {
+		ignore bool
+		weight float64
+		want   []float64
+	}{
+		{false, 1, []float64{80, 200}},
+		{false, 0.25, []float64{80, 110}},
+		{false, 0, []float64{80, 80}},
+		{true, 1, []float64{80}},
+	}
+	for _, test := range tests {
+		setGlobal(t, &ignoreProvisional, test.ignore)
+		setGlobal(t, &provisionalWeight, test.weight)
+		got := ote.Prices(settledPoints(points))
+		if len(got) != len(test.want) || got[len(got)-1] != test.want[len(test.want)-1] {
+			t.Errorf("ignore %t, weight %g: prices %v, want %v", test.ignore, test.weight, got, test.want)
+		}
+	}
+	if points[1].Price != 200 {
+		t.Errorf("the provisional price changed to %g", points[1].Price)
+	}
+}
+
+func TestProvisionalPrice(t *testing.T) {
+	// The settled hours rise and fall once; the price of the hour trading
+	// from 10:00 is revised in each cycle
+	start := time.Date(2024, time.October, 1, 10, 0, 0, 0, ote.Location())
+	settled := map[int]float64{7: 80, 8: 90, 9: 85}
+	tests := []struct {
+		name   string
+		ignore bool
+		weight float64
+		// want are the bands decided in the cycles at 10:10, 10:25 and
+		// 10:40, on the current price of 60, 200 and 70 EUR/MWh
+		want []string
+	}{
+		{"as published", false, 1, []string{policy.Cheap, policy.Expensive, policy.Cheap}},
+		{"ignored", true, 1, []string{policy.Cheap, policy.Cheap, policy.Cheap}},
+		// Weighted entirely towards 09:00, the current price is flat
+		{"weighted", false, 0, []string{policy.Cheap, policy.Cheap, policy.Cheap}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := 0.0
+			runOnMocks(t, priceFunc(func(hour time.Time) float64 {
+				if hour.Equal(start) {
+					return current
+				}
+				return settled[hour.Hour()]
+			}))
+			logs := captureLogs(t)
+			fixed := &fixedClock{}
+			setGlobal[clock](t, &cycleClock, fixed)
+			setGlobal(t, &ignoreProvisional, test.ignore)
+			setGlobal(t, &provisionalWeight, test.weight)
+
+			for i, price := range []float64{60, 200, 70} {
+				fixed.now = start.Add(time.Duration(10+15*i) * time.Minute)
+				current = price
+				result := runCycle(context.Background())
+				d := result.Decision
+				if d == nil || d.Band != test.want[i] || d.Provisional == test.ignore {
+					t.Errorf("cycle at %s: decision %+v, want %s", fixed.now.Format("15:04"), d, test.want[i])
+					continue
+				}
+				if last := result.Points[len(result.Points)-1]; !last.Provisional || last.Price != price {
+					t.Errorf("newest point %+v, want the provisional %g", last, price)
+				}
+				line, err := json.Marshal(d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.Contains(string(line), `"provisional":true`) == test.ignore {
+					t.Errorf("exported decision %s", line)
+				}
+			}
+			for _, revision := range []string{"was revised from 60.00 EUR/MWh to 200.00 EUR/MWh", "was revised from 200.00 EUR/MWh to 70.00 EUR/MWh"} {
+				if !strings.Contains(logs.String(), "The price of hour 11 on 2024-10-01 "+revision) {
+					t.Errorf("logs without the revision %q:\n%s", revision, logs)
+				}
+			}
+			var exposition strings.Builder
+			metrics.write(&exposition)
+			if !strings.Contains(exposition.String(), "epcp_price_revisions_total 2\n") {
+				t.Errorf("metrics without two revisions:\n%s", exposition.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// damSchedule holds the day-ahead prices of one day and the band of each hour.
+type damSchedule struct {
+	Date   string    `json:"date"`
+	Prices []float64 `json:"prices"`
+	Bands  []string  `json:"bands"`
+}
+
+// newDamSchedule marks the hours priced above the daily mean as expensive,
+// or with the peak shaving policy on the day, the most expensive hours of
+// its budget.
+func newDamSchedule(date string, prices []float64) *damSchedule {
+	bands := policy.Schedule(prices)
+	if start, err := ote.HourStart(date, 1); err == nil {
+		if shaving, ok := dayPolicy(dayType(start)).(policy.PeakShaving); ok {
+			bands = shaving.Schedule(prices)
+		}
+	}
+	return &damSchedule{Date: date, Prices: prices, Bands: bands}
+}
+
+// atClock returns the given time of day on the day of t.
+func atClock(t time.Time, clock time.Duration) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location()).Add(clock)
+}
+
+// watchPublication polls for the next day's day-ahead prices every day
+// between damWatchStart and damWatchEnd and generates the schedule from them;
+// the prices are kept for the status endpoints, see dayAhead.
+func watchPublication(ctx context.Context) {
+	for {
+		now := cycleClock.Now().In(ote.Location())
+		start := atClock(now, damWatchStart)
+		if !now.Before(atClock(now, damWatchEnd)) {
+			start = atClock(now.AddDate(0, 0, 1), damWatchStart)
+		}
+		if now.Before(start) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-cycleClock.After(start.Sub(now)):
+			}
+		}
+		if !pollPublication(ctx) {
+			return
+		}
+	}
+}
+
+// pollPublication polls until tomorrow's prices appear or the deadline
+// passes. It returns false when ctx is done.
+func pollPublication(ctx context.Context) bool {
+	now := cycleClock.Now().In(ote.Location())
+	deadline := atClock(now, damWatchEnd)
+	tomorrow := ote.Day(now.AddDate(0, 0, 1))
+	// Wait for the deadline so that the day is not polled again
+	waitDeadline := func() bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-cycleClock.After(deadline.Sub(cycleClock.Now())):
+			return true
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		points, err := getDamPoints(ctx, tomorrow, tomorrow)
+		if err == nil && len(points) != 0 {
+			schedule := newDamSchedule(tomorrow, ote.Prices(points))
+			status.setSchedule(schedule)
+			dayAhead.setTomorrow(newDayAheadDay(tomorrow, points))
+			recordDayAheadMetrics()
+			infoLogger.Printf("Day-ahead prices for %s published, schedule: %v\n", tomorrow, schedule.Bands)
+			return waitDeadline()
+		}
+		infoLogger.Printf("Day-ahead prices for %s not available yet (attempt %d)\n", tomorrow, attempt)
+		next := cycleClock.Now().Add(damWatchPoll)
+		if !next.Before(deadline) {
+			errorLogger.Printf("ALERT: day-ahead prices for %s were not published by %s\n", tomorrow, deadline.Format("15:04"))
+			return waitDeadline()
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-cycleClock.After(damWatchPoll):
+		}
+	}
+}
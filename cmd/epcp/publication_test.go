@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+// publishedAfter starts a mock server answering the first polls with no
+// prices, then with the points. It returns the server and the count of the
+// requests.
+func publishedAfter(t *testing.T, polls int32, points []ote.PricePoint) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	mock := otetest.NewServer(points)
+	t.Cleanup(mock.Close)
+	target, err := url.Parse(mock.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	requests := new(atomic.Int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= polls {
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write(otetest.DamPriceResponse(nil))
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestPollPublication(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 13, 0, 0, 0, ote.Location())
+	prices := make([]float64, 24)
+	for i := range prices {
+		prices[i] = float64(80 + i)
+	}
+	tests := []struct {
+		name string
+		// polls are answered without prices
+		polls   int32
+		want    int32
+		publish bool
+	}{
+		{name: "third poll", polls: 2, want: 3, publish: true},
+		// Polled every 15 minutes until 14:00
+		{name: "deadline", polls: 100, want: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			server, requests := publishedAfter(t, test.polls, otetest.Points("2024-10-02", 1, prices...))
+			setGlobal[ote.PriceSource](t, &priceSource, ote.NewClient(ote.WithEndpoint(server.URL)))
+			setGlobal(t, &damWatchEnd, 14*time.Hour)
+			setGlobal(t, &damWatchPoll, 15*time.Minute)
+			setGlobal(t, &status, &cycleStatus{started: time.Now(), frequencies: make(map[int]int)})
+			setGlobal(t, &dayAhead, new(dayAheadPrices))
+			setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+			setGlobal[clock](t, &cycleClock, newSimulatedClock(start, start.Add(24*time.Hour), 1e6, 1, func() {}))
+
+			if !pollPublication(context.Background()) {
+				t.Fatal("pollPublication returned false")
+			}
+			if n := requests.Load(); n != test.want {
+				t.Errorf("polled %d times, want %d", n, test.want)
+			}
+			// The poll returns at the deadline so that the day is not polled again
+			if now := cycleClock.Now(); !now.Equal(start.Add(time.Hour)) {
+				t.Errorf("returned at %s, want the deadline %s", now, start.Add(time.Hour))
+			}
+			schedule := status.snapshot().Schedule
+			if !test.publish {
+				if schedule != nil || !strings.Contains(logs.String(), "ALERT: day-ahead prices for 2024-10-02 were not published by 14:00") {
+					t.Errorf("schedule %v, want none and an alert:\n%s", schedule, logs)
+				}
+				return
+			}
+			if schedule == nil || schedule.Date != "2024-10-02" || len(schedule.Bands) != 24 {
+				t.Fatalf("schedule %v, want the 24 hours of 2024-10-02", schedule)
+			}
+			if tomorrow := dayAhead.current(start).Tomorrow; tomorrow == nil || len(tomorrow.Points) != 24 {
+				t.Errorf("day-ahead prices of tomorrow %v, want 24 hours", tomorrow)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// The default sanity bounds of the prices in EUR/MWh, the harmonised
+// minimum and maximum clearing prices of the European intraday market.
+const (
+	defaultPriceMin = -9999.0
+	defaultPriceMax = 9999.0
+)
+
+var (
+	// priceMin and priceMax bound the plausible prices, see SourceConfig
+	priceMin, priceMax = defaultPriceMin, defaultPriceMax
+	// quarantineFraction is the share of the prices of a fetch that may be
+	// quarantined before it fails
+	quarantineFraction = 0.5
+	// quarantineFile records the prices quarantined, by default in the state
+	// directory
+	quarantineFile string
+)
+
+// errQuarantined fails a fetch with too many implausible prices.
+var errQuarantined = e.New("too many prices quarantined")
+
+// quarantinedPrice is a line of the quarantine file. The price is a string
+// since it may not be a number.
+type quarantinedPrice struct {
+	Time   time.Time `json:"time"`
+	RunID  string    `json:"runId,omitempty"`
+	Date   string    `json:"date"`
+	Hour   int       `json:"hour"`
+	Start  time.Time `json:"start"`
+	Price  string    `json:"price"`
+	Volume float64   `json:"volume"`
+	Reason string    `json:"reason"`
+}
+
+// implausible returns why the price is outside the sanity bounds, empty if
+// it is not.
+func implausible(price float64) string {
+	switch {
+	case math.IsNaN(price) || math.IsInf(price, 0):
+		return "not a finite number"
+	case price < priceMin:
+		return fmt.Sprintf("below the minimum of %g EUR/MWh", priceMin)
+	case price > priceMax:
+		return fmt.Sprintf("above the maximum of %g EUR/MWh", priceMax)
+	}
+	return ""
+}
+
+// quarantinePrices guards the decisions against the prices a decoding bug or
+// a glitch of the source makes absurd: those outside the sanity bounds are
+// left out, logged, counted and recorded in the quarantine file. When more
+// than quarantineFraction of the points are, none are returned but
+// errQuarantined, failing the fetch.
+func quarantinePrices(ctx context.Context, points []ote.PricePoint) ([]ote.PricePoint, error) {
+	kept := make([]ote.PricePoint, 0, len(points))
+	var quarantined []quarantinedPrice
+	now := cycleClock.Now()
+	for _, p := range points {
+		reason := implausible(p.Price)
+		if reason == "" {
+			kept = append(kept, p)
+			continue
+		}
+		price := strconv.FormatFloat(p.Price, 'g', -1, 64)
+		errorLog(ctx).Printf("WARNING: quarantined the price %s EUR/MWh of hour %d on %s starting %s, volume %g MWh: %s\n",
+			price, p.Hour, p.Date, p.Start.Format(time.RFC3339), p.Volume, reason)
+		quarantined = append(quarantined, quarantinedPrice{Time: now, RunID: runIDFrom(ctx), Date: p.Date, Hour: p.Hour,
+			Start: p.Start, Price: price, Volume: p.Volume, Reason: reason})
+	}
+	metrics.setGauge("epcp_quarantined_prices", "Number of prices of the last fetch outside the sanity bounds.", float64(len(quarantined)))
+	if len(quarantined) == 0 {
+		return points, nil
+	}
+	metrics.addCounter("epcp_prices_quarantined_total", "Number of prices outside the sanity bounds left out of the decisions.", float64(len(quarantined)))
+	writeQuarantine(quarantined)
+	if len(kept) == 0 || float64(len(quarantined)) > quarantineFraction*float64(len(points)) {
+		return nil, fmt.Errorf("%w: %d of %d outside %g to %g EUR/MWh", errQuarantined, len(quarantined), len(points), priceMin, priceMax)
+	}
+	return kept, nil
+}
+
+// writeQuarantine appends the prices quarantined to the quarantine file.
+func writeQuarantine(quarantined []quarantinedPrice) {
+	path := quarantineFile
+	if path == "" {
+		path = filepath.Join(stateDir, "quarantine.jsonl")
+	}
+	var lines []byte
+	for _, q := range quarantined {
+		line, _ := json.Marshal(q)
+		lines = append(append(lines, line...), '\n')
+	}
+	if err := appendFile(path, string(lines)); err != nil {
+		errorLogger.Printf("Error writing the quarantined prices to %s: %s\n", path, err.Error())
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	e "errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// readQuarantine returns the lines of the quarantine file.
+func readQuarantine(t *testing.T, path string) []quarantinedPrice {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if e.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []quarantinedPrice
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var q quarantinedPrice
+		if err := json.Unmarshal([]byte(line), &q); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		lines = append(lines, q)
+	}
+	return lines
+}
+
+func TestQuarantinePrices(t *testing.T) {
+	logs := captureLogs(t)
+	dir := t.TempDir()
+	setGlobal(t, &stateDir, dir)
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	setGlobal(t, &priceMin, -500.0)
+	setGlobal(t, &priceMax, 3000.0)
+	fixed := &fixedClock{time.Date(2024, time.October, 1, 13, 20, 0, 0, ote.Location())}
+	setGlobal[clock](t, &cycleClock, fixed)
+
+	points := otetest.Points("2024-10-01", 1, 90, 9e12, 95, math.NaN(), -1e5, 3000, -500, math.Inf(1), 100, 110)
+	kept, err := quarantinePrices(withRunID(context.Background(), "run-1"), points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prices []float64
+	for _, p := range kept {
+		prices = append(prices, p.Price)
+	}
+	// The bounds themselves are plausible
+	if want := []float64{90, 95, 3000, -500, 100, 110}; !slices.Equal(prices, want) {
+		t.Errorf("kept %v, want %v", prices, want)
+	}
+
+	lines := readQuarantine(t, filepath.Join(dir, "quarantine.jsonl"))
+	want := []struct {
+		hour          int
+		price, reason string
+	}{
+		{2, "9e+12", "above the maximum of 3000 EUR/MWh"},
+		{4, "NaN", "not a finite number"},
+		{5, "-100000", "below the minimum of -500 EUR/MWh"},
+		{8, "+Inf", "not a finite number"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("quarantined %+v, want %d prices", lines, len(want))
+	}
+	for i, q := range lines {
+		if q.Hour != want[i].hour || q.Price != want[i].price || q.Reason != want[i].reason || q.Date != "2024-10-01" ||
+			q.RunID != "run-1" || !q.Time.Equal(fixed.now) || !q.Start.Equal(points[q.Hour-1].Start) {
+			t.Errorf("quarantined %+v, want hour %d at %s: %s", q, want[i].hour, want[i].price, want[i].reason)
+		}
+	}
+	if !strings.Contains(logs.String(), "WARNING: quarantined the price 9e+12 EUR/MWh of hour 2 on 2024-10-01 starting 2024-10-01T01:00:00+02:00, volume 0 MWh: above the maximum of 3000 EUR/MWh\n") {
+		t.Errorf("the quarantine not logged with its context:\n%s", logs)
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	for _, want := range []string{"epcp_quarantined_prices 4\n", "epcp_prices_quarantined_total 4\n"} {
+		if !strings.Contains(exposition.String(), want) {
+			t.Errorf("metrics without %s:\n%s", want, exposition.String())
+		}
+	}
+
+	// Plausible prices reset the gauge and leave the file alone
+	if kept, err := quarantinePrices(context.Background(), points[:1]); err != nil || len(kept) != 1 {
+		t.Errorf("kept %v, %v of a plausible price", kept, err)
+	}
+	exposition.Reset()
+	metrics.write(&exposition)
+	if !strings.Contains(exposition.String(), "epcp_quarantined_prices 0\n") || len(readQuarantine(t, filepath.Join(dir, "quarantine.jsonl"))) != 4 {
+		t.Errorf("metrics after plausible prices:\n%s", exposition.String())
+	}
+}
+
+func TestQuarantineThreshold(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		// absurd is the number of the four prices of the window at 9e12
+		absurd   int
+		fraction float64
+		fails    bool
+	}{
+		{0, 0.5, false},
+		{1, 0.5, false},
+		// Up to the fraction, the fetch holds
+		{2, 0.5, false},
+		{3, 0.5, true},
+		{1, 0, true},
+		{1, 0.25, false},
+		{2, 0.25, true},
+		{2, 1, false},
+		// Nothing left to decide on
+		{4, 1, true},
+	}
+	for _, test := range tests {
+		setGlobal(t, &quarantineFile, filepath.Join(t.TempDir(), "quarantine.jsonl"))
+		// The oldest prices are absurd, the newest fall
+		tree := runOnMocks(t, priceFunc(func(start time.Time) float64 {
+			if now.Sub(start).Hours() >= 4-float64(test.absurd) {
+				return 9e12
+			}
+			return 500 - 10*start.Sub(now).Hours()
+		}))
+		logs := captureLogs(t)
+		setGlobal(t, &quarantineFraction, test.fraction)
+		setGlobal(t, &safeMode, safeMin)
+
+		result := runCycle(context.Background())
+		if got := len(readQuarantine(t, quarantineFile)); got != test.absurd {
+			t.Errorf("%d of %g: %d prices quarantined", test.absurd, test.fraction, got)
+		}
+		for _, p := range result.Points {
+			if p.Price > priceMax {
+				t.Errorf("%d of %g: decided on the price %g", test.absurd, test.fraction, p.Price)
+			}
+		}
+		if !test.fails {
+			if result.FetchErr != nil || result.SafeMode != "" || result.Decision == nil || result.Decision.Band != policy.Cheap {
+				t.Errorf("%d of %g: error %v, safe mode %q, decision %+v, want the cheap band", test.absurd, test.fraction, result.FetchErr, result.SafeMode, result.Decision)
+			}
+			continue
+		}
+		if !e.Is(result.FetchErr, errQuarantined) || result.SafeMode != causeQuarantine || result.Decision == nil || result.Decision.Band != policy.Expensive {
+			t.Errorf("%d of %g: error %v, safe mode %q, decision %+v, want the quarantine safe mode", test.absurd, test.fraction, result.FetchErr, result.SafeMode, result.Decision)
+		}
+		if got := readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")); got != "800000" {
+			t.Errorf("%d of %g: scaling_max_freq %s, want the minimum of the safe mode", test.absurd, test.fraction, got)
+		}
+		if !strings.Contains(logs.String(), "WARNING: no trustworthy decision (quarantine)") || !strings.HasPrefix(result.Decision.FetchError, "too many prices quarantined: ") {
+			t.Errorf("%d of %g: fetch error %q, the failure not logged:\n%s", test.absurd, test.fraction, result.Decision.FetchError, logs)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+var (
+	// rampDuration is how long before a band transition planned by the
+	// day-ahead schedule the frequencies ramp towards the next band, see
+	// ScheduleConfig; 0 disables the ramps
+	rampDuration time.Duration
+	// rampSteps is the number of frequency steps of a ramp
+	rampSteps = 5
+)
+
+// rampStep is a frequency written on the way to the next band.
+type rampStep struct {
+	at        time.Time
+	frequency int
+	nodes     map[int]int
+}
+
+// rampPlan is the steps of the frequencies from the band of the last cycle
+// to the band the day-ahead schedule plans for the next hour. The steps are
+// not decisions: they only write the frequencies, are neither logged as
+// decisions nor counted as band changes, and the next cycle decides as
+// usual.
+type rampPlan struct {
+	from, to string
+	steps    []rampStep
+	done     int
+}
+
+// planRamp returns the ramp ahead of the hour starting before the next
+// cycle, when the day-ahead schedule plans another band for it than that
+// of the decision, or nil. A decision the safe mode, a maintenance window,
+// the boot grace period or a target made is not ramped from, nor is a band
+// with a target ramped to.
+func planRamp(ctx context.Context, decision *Decision, now, next time.Time) *rampPlan {
+	if rampDuration <= 0 || decision == nil || decision.SafeMode != "" || decision.Maintenance ||
+		decision.BootGrace || decision.Target != "" {
+		return nil
+	}
+	transition := now.Truncate(time.Hour).Add(time.Hour)
+	if transition.After(next) {
+		return nil
+	}
+	band := plannedBand(ctx, transition)
+	if _, ok := bandTargets[band]; band == "" || band == decision.Band || ok {
+		return nil
+	}
+	target := &Decision{Time: transition}
+	target.setBand(band, availableFrequencies())
+	clampToFloor(ctx, target)
+	plan := &rampPlan{from: decision.Band, to: band}
+	start := transition.Add(-rampDuration)
+	for i := 1; i <= rampSteps; i++ {
+		step := rampStep{at: start.Add(rampDuration * time.Duration(i-1) / time.Duration(rampSteps)),
+			frequency: rampFrequency(decision.Frequency, target.Frequency, i)}
+		if len(decision.Nodes) != 0 {
+			step.nodes = make(map[int]int, len(decision.Nodes))
+			for node, frequency := range decision.Nodes {
+				step.nodes[node] = rampFrequency(frequency, target.Nodes[node], i)
+			}
+		}
+		if !step.at.Before(now) {
+			plan.steps = append(plan.steps, step)
+		}
+	}
+	if len(plan.steps) == 0 {
+		return nil
+	}
+	infoLog(ctx).Printf("Ramping from the %s band to the %s band in %d steps from %s\n",
+		plan.from, plan.to, len(plan.steps), plan.steps[0].at.In(ote.Location()).Format("15:04:05"))
+	return plan
+}
+
+// plannedBand returns the band the day-ahead schedule plans for the hour
+// starting at start, empty when its prices are not known.
+func plannedBand(ctx context.Context, start time.Time) string {
+	date, hour := ote.HourIndex(start)
+	var points []ote.PricePoint
+	if date == ote.Day(cycleClock.Now()) {
+		points = dayAheadToday(ctx, date)
+	} else if tomorrow := dayAhead.current(cycleClock.Now()).Tomorrow; tomorrow != nil && tomorrow.Date == date {
+		points = tomorrow.Points
+	}
+	if hours, _ := ote.HoursIn(date); len(points) != hours {
+		return ""
+	}
+	return newDamSchedule(date, ote.Prices(points)).Bands[hour-1]
+}
+
+// rampFrequency returns the frequency of the step i of the ramp from from
+// to to, the available one nearest to the even step; the last step is to
+// itself.
+func rampFrequency(from, to, i int) int {
+	frequency, available := from+(to-from)*i/rampSteps, availableFrequencies()
+	if i >= rampSteps || len(available) == 0 {
+		return frequency
+	}
+	nearest := available[0]
+	for _, f := range available[1:] {
+		if abs(f-frequency) < abs(nearest-frequency) {
+			nearest = f
+		}
+	}
+	return nearest
+}
+
+// due reports whether the next step is due at now.
+func (r *rampPlan) due(now time.Time) bool {
+	return r != nil && r.done < len(r.steps) && !r.steps[r.done].at.After(now)
+}
+
+// wake returns the time of the next step, or next, that of the next cycle,
+// when no step is left before it.
+func (r *rampPlan) wake(next time.Time) time.Time {
+	if r != nil && r.done < len(r.steps) && r.steps[r.done].at.Before(next) {
+		return r.steps[r.done].at
+	}
+	return next
+}
+
+// step writes the frequencies of the next step, floored as the decisions
+// are.
+func (r *rampPlan) step(ctx context.Context) {
+	s := r.steps[r.done]
+	r.done++
+	decision := &Decision{Time: cycleClock.Now(), Band: r.from, Frequency: s.frequency, Nodes: s.nodes, Simulated: simulate || dryRun}
+	clampToFloor(ctx, decision)
+	infoLog(ctx).Printf("Ramp step %d of %d to the %s band\n", r.done, len(r.steps), r.to)
+	if applyDecision(ctx, decision) != nil {
+		metrics.addCounter("epcp_ramp_steps_total", "Number of frequency steps of the ramps ahead of the band transitions by band ramped to.", 1, "band", r.to)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// rampFrequencies are available at each step of a ramp of 5 steps between
+// the lowest and the highest of them.
+var rampFrequencies = []string{"800000", "1280000", "1760000", "2240000", "2720000", "3200000"}
+
+// rampDay sets the day-ahead prices of 2024-10-01 with hour 12, from 11:00,
+// cheap and the others expensive.
+func rampDay(t *testing.T) {
+	t.Helper()
+	prices := make([]float64, 24)
+	for i := range prices {
+		prices[i] = 100
+	}
+	prices[11] = 50
+	day := new(dayAheadPrices)
+	day.setToday(newDayAheadDay("2024-10-01", otetest.Points("2024-10-01", 1, prices...)))
+	setGlobal(t, &dayAhead, day)
+}
+
+// recordingActuator records the scaling_max_freq of cpu0 written and when.
+type recordingActuator struct {
+	actuator.Actuator
+	mu     sync.Mutex
+	writes []string
+}
+
+func (a *recordingActuator) Apply(ctx context.Context, writes []actuator.Write) []error {
+	a.mu.Lock()
+	for _, w := range writes {
+		if w.Path == cpuPath(0, "cpufreq", "scaling_max_freq") {
+			a.writes = append(a.writes, cycleClock.Now().In(ote.Location()).Format("15:04")+" "+w.Value)
+		}
+	}
+	a.mu.Unlock()
+	return a.Actuator.Apply(ctx, writes)
+}
+
+func TestPlanRamp(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.October, 1, hour, minute, 0, 0, ote.Location())
+	}
+	expensive := &Decision{Band: policy.Expensive, Frequency: 800000}
+	cheap := &Decision{Band: policy.Cheap, Frequency: 3200000}
+	tests := []struct {
+		name     string
+		decision *Decision
+		now      time.Time
+		next     time.Time
+		duration time.Duration
+		// want are the times and frequencies of the steps
+		want []string
+	}{
+		{"up to the cheap hour", expensive, at(10, 0), at(11, 0), 10 * time.Minute,
+			[]string{"10:50 1280000", "10:52 1760000", "10:54 2240000", "10:56 2720000", "10:58 3200000"}},
+		{"down to the expensive hour", cheap, at(11, 0), at(12, 0), 10 * time.Minute,
+			[]string{"11:50 2720000", "11:52 2240000", "11:54 1760000", "11:56 1280000", "11:58 800000"}},
+		{"longer", expensive, at(10, 0), at(11, 0), 30 * time.Minute,
+			[]string{"10:30 1280000", "10:36 1760000", "10:42 2240000", "10:48 2720000", "10:54 3200000"}},
+		{"started late", expensive, at(10, 55), at(11, 0), 10 * time.Minute, []string{"10:56 2720000", "10:58 3200000"}},
+		{"disabled", expensive, at(10, 0), at(11, 0), 0, nil},
+		{"same band", cheap, at(10, 0), at(11, 0), 10 * time.Minute, nil},
+		{"cycle before the transition", expensive, at(10, 0), at(10, 15), 10 * time.Minute, nil},
+		{"safe mode", &Decision{Band: policy.Expensive, Frequency: 800000, SafeMode: safeMin}, at(10, 0), at(11, 0), 10 * time.Minute, nil},
+		{"boot grace", &Decision{Band: policy.Expensive, Frequency: 800000, BootGrace: true}, at(10, 0), at(11, 0), 10 * time.Minute, nil},
+		// The prices of 2024-10-02 are not known
+		{"unknown day", cheap, at(23, 0), at(23, 0).Add(time.Hour), 10 * time.Minute, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			simulatedSysfs(t, 2, rampFrequencies...)
+			captureLogs(t)
+			rampDay(t)
+			setGlobal(t, &priceSource, ote.PriceSource(otetest.NewFake()))
+			setGlobal[clock](t, &cycleClock, &fixedClock{test.now})
+			setGlobal(t, &rampDuration, test.duration)
+			setGlobal(t, &rampSteps, 5)
+
+			var steps []string
+			if plan := planRamp(context.Background(), test.decision, test.now, test.next); plan != nil {
+				for _, s := range plan.steps {
+					steps = append(steps, fmt.Sprintf("%s %d", s.at.In(ote.Location()).Format("15:04"), s.frequency))
+				}
+			}
+			if !slices.Equal(steps, test.want) {
+				t.Errorf("steps %v, want %v", steps, test.want)
+			}
+		})
+	}
+}
+
+func TestRampFrequency(t *testing.T) {
+	simulatedSysfs(t, 1)
+	setGlobal(t, &rampSteps, 5)
+	// From 800000 to 3200000, the even steps are 1280000, 1760000, 2240000
+	// and 2720000
+	var got []int
+	for i := 1; i <= 5; i++ {
+		got = append(got, rampFrequency(800000, 3200000, i))
+	}
+	if want := []int{1600000, 1600000, 2400000, 2400000, 3200000}; !slices.Equal(got, want) {
+		t.Errorf("ramp %v, want %v", got, want)
+	}
+}
+
+func TestRampSchedule(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 10, 0, 0, 0, ote.Location())
+	runOnMocks(t, trend(start, 10))
+	simulatedSysfs(t, 2, rampFrequencies...)
+	logs := captureLogs(t)
+	rampDay(t)
+	recorder := &recordingActuator{Actuator: frequencyActuator}
+	setGlobal[actuator.Actuator](t, &frequencyActuator, recorder)
+	setGlobal(t, &status, &cycleStatus{started: start, frequencies: make(map[int]int)})
+	setGlobal(t, &jitter, 0)
+	setGlobal(t, &evalOffset, 0)
+	setGlobal(t, &rampDuration, 10*time.Minute)
+	setGlobal(t, &rampSteps, 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	setGlobal[clock](t, &cycleClock, newSimulatedClock(start, start.Add(90*time.Minute), 1e6, 1, cancel))
+
+	var bands []string
+	runLoop(ctx, time.Hour, nil, func(result *cycleResult) { bands = append(bands, result.Decision.Band) })
+	// The steps write the frequencies only, the next cycle decides as usual
+	want := []string{"10:00 800000", "10:50 1280000", "10:52 1760000", "10:54 2240000", "10:56 2720000", "10:58 3200000", "11:00 800000"}
+	if !slices.Equal(recorder.writes, want) {
+		t.Errorf("writes %v, want %v", recorder.writes, want)
+	}
+	if !slices.Equal(bands, []string{policy.Expensive, policy.Expensive}) {
+		t.Errorf("decided %v, want two expensive cycles", bands)
+	}
+	for _, want := range []string{
+		"Ramping from the expensive band to the cheap band in 5 steps from 10:50:00\n",
+		"Ramp step 5 of 5 to the cheap band\n",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs without %q:\n%s", want, logs)
+		}
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	if !strings.Contains(exposition.String(), `epcp_ramp_steps_total{band="cheap"} 5`+"\n") {
+		t.Errorf("metrics:\n%s", exposition.String())
+	}
+}
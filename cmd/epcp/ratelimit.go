@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// oteLimiter spaces the requests of all the OTE clients, including their
+// retries, see SourceConfig.
+var oteLimiter = &spacingLimiter{interval: time.Second}
+
+// spacingLimiter lets requests through at least interval apart, in the order
+// they wait; it implements ote.Limiter.
+type spacingLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// next is the earliest time of the next request
+	next time.Time
+}
+
+// setInterval sets the spacing of the requests, none when not positive.
+func (l *spacingLimiter) setInterval(interval time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.interval = interval
+}
+
+// Wait waits for the turn of the request, or for ctx to be done. A request
+// given up on keeps its turn.
+func (l *spacingLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := now
+	if l.next.After(now) {
+		at = l.next
+	}
+	l.next = at.Add(max(l.interval, 0))
+	l.mu.Unlock()
+	if !at.After(now) {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
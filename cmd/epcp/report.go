@@ -0,0 +1,348 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// reportReach is how long a decision stays in force in the reports when no
+// other follows it; the hours beyond are missing.
+const reportReach = 2 * time.Hour
+
+// reportSavingsDays is how many of the days saving the most the reports
+// list.
+const reportSavingsDays = 3
+
+var (
+	// reportDir receives the report of each period once it is over, see
+	// OutputsConfig; empty to write none
+	reportDir string
+	// reportWeekly reports every ISO week instead of every month
+	reportWeekly bool
+	// reportFormat is md or json
+	reportFormat = "md"
+)
+
+// reportPeriod is a month or an ISO week in the market time zone.
+type reportPeriod struct {
+	// name is YYYY-MM or YYYY-Www
+	name       string
+	start, end time.Time
+}
+
+// parseReportPeriod parses a month as YYYY-MM or an ISO week as YYYY-Www.
+func parseReportPeriod(value string) (reportPeriod, error) {
+	if year, week, ok := strings.Cut(value, "-W"); ok {
+		y, yerr := strconv.Atoi(year)
+		w, werr := strconv.Atoi(week)
+		if yerr == nil && werr == nil && len(year) == 4 && len(week) == 2 {
+			// The first ISO week is the one with the 4th of January
+			jan4 := time.Date(y, time.January, 4, 0, 0, 0, 0, ote.Location())
+			start := jan4.AddDate(0, 0, -(int(jan4.Weekday())+6)%7+7*(w-1))
+			if isoYear, isoWeek := start.ISOWeek(); isoYear == y && isoWeek == w {
+				return weekPeriod(start), nil
+			}
+		}
+		return reportPeriod{}, fmt.Errorf("invalid week %q, expected YYYY-Www", value)
+	}
+	month, err := time.ParseInLocation("2006-01", value, ote.Location())
+	if err != nil {
+		return reportPeriod{}, fmt.Errorf("invalid period %q, expected a month as YYYY-MM or a week as YYYY-Www", value)
+	}
+	return reportPeriod{name: value, start: month, end: month.AddDate(0, 1, 0)}, nil
+}
+
+// weekPeriod returns the ISO week starting on the Monday start.
+func weekPeriod(start time.Time) reportPeriod {
+	year, week := start.ISOWeek()
+	return reportPeriod{name: fmt.Sprintf("%d-W%02d", year, week), start: start, end: start.AddDate(0, 0, 7)}
+}
+
+// periodOf returns the month, or the ISO week when weekly, of t.
+func periodOf(t time.Time, weekly bool) reportPeriod {
+	t = t.In(ote.Location())
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if weekly {
+		return weekPeriod(day.AddDate(0, 0, -(int(day.Weekday())+6)%7))
+	}
+	month := day.AddDate(0, 0, 1-day.Day())
+	return reportPeriod{name: month.Format("2006-01"), start: month, end: month.AddDate(0, 1, 0)}
+}
+
+// reportTotals are the hours, the energy and the cost of a day or a period,
+// with the scaler and as if the CPUs always ran at their highest frequency.
+type reportTotals struct {
+	// Hours maps the bands to the number of hours decided in them
+	Hours          map[string]int `json:"hours"`
+	Energy         float64        `json:"energyKwh"`
+	BaselineEnergy float64        `json:"baselineEnergyKwh"`
+	Cost           float64        `json:"cost"`
+	BaselineCost   float64        `json:"baselineCost"`
+	Savings        float64        `json:"savings"`
+	// MissingHours are without a decision in force or a price
+	MissingHours int `json:"missingHours"`
+}
+
+func (t *reportTotals) add(o reportTotals) {
+	for band, hours := range o.Hours {
+		t.Hours[band] += hours
+	}
+	t.Energy += o.Energy
+	t.BaselineEnergy += o.BaselineEnergy
+	t.Cost += o.Cost
+	t.BaselineCost += o.BaselineCost
+	t.Savings += o.Savings
+	t.MissingHours += o.MissingHours
+}
+
+// reportDay is the breakdown of a market day.
+type reportDay struct {
+	Date string `json:"date"`
+	reportTotals
+}
+
+// missingDay is a day of the report lacking data, with the hours without a
+// decision in force and those without a price.
+type missingDay struct {
+	Date        string `json:"date"`
+	NoDecisions int    `json:"hoursWithoutDecision"`
+	NoPrices    int    `json:"hoursWithoutPrice"`
+}
+
+// costReport summarizes a period from the decision log, the history of the
+// prices and the power model of the simulations: the hours in each band and
+// the energy and cost estimated with the scaler and without it, per day and
+// in total. The energy is that of the machine of the simulations at full
+// load, the cost from the price of each hour in EUR/MWh.
+type costReport struct {
+	Period  string       `json:"period"`
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	Machine string       `json:"machine"`
+	Total   reportTotals `json:"total"`
+	// BiggestSavings are the dates of the days saving the most
+	BiggestSavings []string     `json:"biggestSavings"`
+	Days           []reportDay  `json:"days"`
+	Missing        []missingDay `json:"missingDays"`
+}
+
+// newCostReport returns the report of the period from the decisions, in the
+// order of the log, and the prices of the history, see historyPrice. The band
+// of an hour is that of the decision in force in its middle, its price its
+// hourly price in the history, or else the newest price that decision was
+// made on, or else the mean price of its day in the history.
+func newCostReport(period reportPeriod, decisions []*Decision, history func(time.Time) (float64, bool, bool), machine MachineConfig) *costReport {
+	highest := slices.Max(machine.Frequencies)
+	r := &costReport{Period: period.name, From: period.start, To: period.end, Total: reportTotals{Hours: make(map[string]int)},
+		Machine:        fmt.Sprintf("%d CPUs, %g to %g W each", machine.CPUs, machine.IdleWatts, machine.MaxWatts),
+		BiggestSavings: []string{}, Missing: []missingDay{}}
+	var missing []missingDay
+	next := 0
+	for hour := period.start; hour.Before(period.end); hour = hour.Add(time.Hour) {
+		if date := ote.Day(hour); len(r.Days) == 0 || r.Days[len(r.Days)-1].Date != date {
+			r.Days = append(r.Days, reportDay{Date: date, reportTotals: reportTotals{Hours: make(map[string]int)}})
+			missing = append(missing, missingDay{Date: date})
+		}
+		day, gaps := &r.Days[len(r.Days)-1], &missing[len(missing)-1]
+		middle := hour.Add(time.Hour / 2)
+		for next < len(decisions) && !decisions[next].Time.After(middle) {
+			next++
+		}
+		var decision *Decision
+		if next != 0 && middle.Sub(decisions[next-1].Time) < reportReach {
+			decision = decisions[next-1]
+		}
+		price, exact, ok := history(hour)
+		if !exact && decision != nil && decision.Price != nil {
+			price, ok = *decision.Price, true
+		}
+		switch {
+		case decision == nil:
+			gaps.NoDecisions++
+		case !ok:
+			gaps.NoPrices++
+		}
+		if decision == nil || !ok {
+			day.MissingHours++
+			continue
+		}
+		frequency := decision.Frequency
+		if frequency == 0 {
+			frequency = highest
+		}
+		energy, baseline := machine.watts(frequency)/1000, machine.watts(highest)/1000
+		day.Hours[decision.Band]++
+		day.Energy += energy
+		day.BaselineEnergy += baseline
+		// The prices are per MWh
+		day.Cost += energy * price / 1000
+		day.BaselineCost += baseline * price / 1000
+		day.Savings = day.BaselineCost - day.Cost
+	}
+	for i, d := range r.Days {
+		r.Total.add(d.reportTotals)
+		if d.MissingHours != 0 {
+			r.Missing = append(r.Missing, missing[i])
+		}
+	}
+	byDays := slices.Clone(r.Days)
+	slices.SortStableFunc(byDays, func(a, b reportDay) int { return cmp.Compare(b.Savings, a.Savings) })
+	for _, d := range byDays[:min(len(byDays), reportSavingsDays)] {
+		if d.Savings > 0 {
+			r.BiggestSavings = append(r.BiggestSavings, d.Date)
+		}
+	}
+	return r
+}
+
+// print writes the report as Markdown, or as JSON.
+func (r *costReport) print(w io.Writer, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	kwh := func(v float64) string { return display.number(v, 3) + " kWh" }
+	t := r.Total
+	fmt.Fprintf(w, "# Cost report %s\n\n", r.Period)
+	fmt.Fprintf(w, "From %s to %s, estimated for %s at full load.\n\n", r.From.Format(time.DateOnly), r.To.AddDate(0, 0, -1).Format(time.DateOnly), r.Machine)
+	fmt.Fprintln(w, "| | With epcp | Always at the highest frequency | Saved |")
+	fmt.Fprintln(w, "|---|---:|---:|---:|")
+	fmt.Fprintf(w, "| Energy | %s | %s | %s |\n", kwh(t.Energy), kwh(t.BaselineEnergy), kwh(t.BaselineEnergy-t.Energy))
+	fmt.Fprintf(w, "| Cost | %s | %s | %s |\n\n", display.cost(t.Cost), display.cost(t.BaselineCost), display.cost(t.Savings))
+	fmt.Fprintf(w, "Hours: %d %s, %d %s, %d missing.\n\n", t.Hours[policy.Cheap], policy.Cheap, t.Hours[policy.Expensive], policy.Expensive, t.MissingHours)
+	if len(r.BiggestSavings) != 0 {
+		fmt.Fprintln(w, "## Biggest savings")
+		fmt.Fprintln(w)
+		for i, date := range r.BiggestSavings {
+			for _, d := range r.Days {
+				if d.Date == date {
+					fmt.Fprintf(w, "%d. %s: %s\n", i+1, date, display.cost(d.Savings))
+				}
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "## Days")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "| Day | %s | %s | Missing | Energy | Cost | Baseline cost | Saved |\n", strings.ToUpper(policy.Cheap[:1])+policy.Cheap[1:],
+		strings.ToUpper(policy.Expensive[:1])+policy.Expensive[1:])
+	fmt.Fprintln(w, "|---|---:|---:|---:|---:|---:|---:|---:|")
+	for _, d := range r.Days {
+		fmt.Fprintf(w, "| %s | %d h | %d h | %d h | %s | %s | %s | %s |\n", d.Date, d.Hours[policy.Cheap], d.Hours[policy.Expensive],
+			d.MissingHours, kwh(d.Energy), display.cost(d.Cost), display.cost(d.BaselineCost), display.cost(d.Savings))
+	}
+	if len(r.Missing) != 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "## Missing data")
+		fmt.Fprintln(w)
+		for _, m := range r.Missing {
+			fmt.Fprintf(w, "- %s: %d hours without a decision, %d without a price\n", m.Date, m.NoDecisions, m.NoPrices)
+		}
+	}
+	return nil
+}
+
+// buildReport reads the decisions of the period from the decision log and
+// reports it with the history of the prices in the state.
+func buildReport(period reportPeriod) (*costReport, error) {
+	if decisionLog == "" {
+		return nil, fmt.Errorf("the report needs the decision log, see EPCP_DECISION_LOG")
+	}
+	f, err := os.Open(decisionLog)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	decisions, corrupted, err := readDecisions(f, decisionFilter{from: period.start.Add(-reportReach), to: period.end}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if corrupted != 0 {
+		errorLogger.Printf("WARNING: skipped %d corrupted lines of the decision log %s\n", corrupted, decisionLog)
+	}
+	return newCostReport(period, decisions, historyPrice, backtestMachine()), nil
+}
+
+func reportFlags(flags *flag.FlagSet) {
+	envVar(flags, "decision-log", "EPCP_DECISION_LOG", "string", "JSON lines `file` of the decisions")
+	envVar(flags, "state-dir", "EPCP_STATE_DIR", "string", "`directory` of the state file with the history of the prices")
+	flags.String("period", "", "month as YYYY-MM or ISO week as YYYY-Www (default the last month)")
+	flags.String("output", "md", "format of the report, md or json")
+}
+
+// runReport prints the cost report of a month or a week.
+func runReport(flags *flag.FlagSet) exitCode {
+	value := func(name string) string { return flags.Lookup(name).Value.String() }
+	output := value("output")
+	if output != "md" && output != "json" {
+		errorLogger.Printf("Unknown output %q, expected md or json.\n", output)
+		return exitUsage
+	}
+	period := periodOf(periodOf(cycleClock.Now(), false).start.AddDate(0, -1, 0), false)
+	if v := value("period"); v != "" {
+		var err error
+		if period, err = parseReportPeriod(v); err != nil {
+			errorLogger.Printf("Error parsing --period: %s\n", err.Error())
+			return exitUsage
+		}
+	}
+	loadState()
+	report, err := buildReport(period)
+	if err != nil {
+		errorLogger.Printf("Error building the report of %s: %s\n", period.name, err.Error())
+		return exitFailure
+	}
+	if err := report.print(os.Stdout, output == "json"); err != nil {
+		errorLogger.Printf("Error writing the report: %s\n", err.Error())
+		return exitFailure
+	}
+	return exitOK
+}
+
+// writePeriodReport writes the report of the period of the last cycle to
+// reportDir once a cycle falls in the next one.
+func writePeriodReport(ctx context.Context) {
+	if reportDir == "" {
+		return
+	}
+	current := periodOf(cycleClock.Now(), reportWeekly).name
+	last := state.ReportPeriod
+	state.ReportPeriod = current
+	if last == "" || last == current {
+		return
+	}
+	period, err := parseReportPeriod(last)
+	if err != nil {
+		return
+	}
+	report, err := buildReport(period)
+	if err == nil {
+		path := filepath.Join(reportDir, "epcp-report-"+period.name+"."+reportFormat)
+		var f *os.File
+		if f, err = os.Create(path); err == nil {
+			err = report.print(f, reportFormat == "json")
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err == nil {
+			infoLog(ctx).Printf("Wrote the report of %s to %s\n", period.name, path)
+			return
+		}
+	}
+	errorLog(ctx).Printf("Error writing the report of %s: %s\n", period.name, err.Error())
+}
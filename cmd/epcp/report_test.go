@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/forecast"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+	"github.com/CERIT-SC/epcp-simulator/internal/synthetic"
+)
+
+func TestParseReportPeriod(t *testing.T) {
+	tests := []struct {
+		value, name, start, end string
+	}{
+		{"2024-06", "2024-06", "2024-06-01", "2024-07-01"},
+		{"2024-12", "2024-12", "2024-12-01", "2025-01-01"},
+		{"2024-W01", "2024-W01", "2024-01-01", "2024-01-08"},
+		// The first ISO week of 2021 starts on 4 January
+		{"2021-W01", "2021-W01", "2021-01-04", "2021-01-11"},
+		{"2020-W53", "2020-W53", "2020-12-28", "2021-01-04"},
+		{"2021-W53", "", "", ""},
+		{"2024-6", "", "", ""},
+		{"June", "", "", ""},
+	}
+	for _, test := range tests {
+		period, err := parseReportPeriod(test.value)
+		if test.name == "" {
+			if err == nil {
+				t.Errorf("%s: period %+v, want an error", test.value, period)
+			}
+			continue
+		}
+		if err != nil || period.name != test.name || ote.Day(period.start) != test.start || ote.Day(period.end) != test.end {
+			t.Errorf("%s: period %+v, %v, want %s from %s to %s", test.value, period, err, test.name, test.start, test.end)
+		}
+	}
+}
+
+// seededMonth records a month of synthetic prices in the history and a
+// decision of the trend policy at 5 past each hour in the decision log,
+// leaving gaps in both.
+func seededMonth(t *testing.T) {
+	t.Helper()
+	simulatedSysfs(t, 4)
+	params := synthetic.DefaultParams
+	params.Seed = 42
+	source := synthetic.New(params)
+	points, err := source.DamPrices(context.Background(), "2024-05-31", "2024-06-30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &state, &State{History: make(forecast.History), DailyPrices: make(map[string]*dailyPrices)})
+	for _, p := range points {
+		switch ote.Day(p.Start) {
+		case "2024-06-20":
+			// Compacted into the daily statistics
+			state.DailyPrices["2024-06-20"] = &dailyPrices{Mean: 100, Min: 60, Max: 140, Hours: 24}
+		case "2024-06-21":
+			// Lost
+		default:
+			state.History.Add(p.Start, p.Price)
+		}
+	}
+
+	var log bytes.Buffer
+	frequencies := availableFrequencies()
+	for i := 3; i < len(points); i++ {
+		at := points[i].Start.Add(5 * time.Minute)
+		// The daemon was down for a morning
+		if at.After(time.Date(2024, time.June, 10, 6, 0, 0, 0, ote.Location())) && at.Before(time.Date(2024, time.June, 10, 12, 0, 0, 0, ote.Location())) {
+			continue
+		}
+		band, err := policy.Trend{}.Band(ote.Prices(points[i-3 : i+1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decision := &Decision{Time: at.UTC(), Band: band, Frequency: policy.Frequency(band, frequencies)}
+		// The decisions of the lost day carry their price
+		if ote.Day(at) == "2024-06-21" && at.Hour()%2 == 0 {
+			decision.Price = &points[i].Price
+		}
+		line, err := json.Marshal(decision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Write(append(line, '\n'))
+	}
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	if err := os.WriteFile(path, log.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &decisionLog, path)
+}
+
+func TestReportGolden(t *testing.T) {
+	seededMonth(t)
+	period, err := parseReportPeriod("2024-06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := buildReport(period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"md", "json"} {
+		t.Run(format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := report.print(&out, format == "json"); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "report-2024-06."+format+".golden")
+			if *update {
+				if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != string(want) {
+				t.Errorf("report differs from %s, run the tests with -update if intended:\n%s", golden, out.String())
+			}
+		})
+	}
+}
+
+func TestWritePeriodReport(t *testing.T) {
+	seededMonth(t)
+	logs := captureLogs(t)
+	dir := t.TempDir()
+	setGlobal(t, &reportDir, dir)
+	setGlobal(t, &reportFormat, "json")
+	path := filepath.Join(dir, "epcp-report-2024-06.json")
+	for _, now := range []time.Time{
+		time.Date(2024, time.June, 30, 22, 0, 0, 0, ote.Location()),
+		time.Date(2024, time.June, 30, 23, 0, 0, 0, ote.Location()),
+	} {
+		setGlobal[clock](t, &cycleClock, &fixedClock{now})
+		writePeriodReport(context.Background())
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("report written within the month: %v", err)
+		}
+	}
+	setGlobal[clock](t, &cycleClock, &fixedClock{time.Date(2024, time.July, 1, 0, 5, 0, 0, ote.Location())})
+	writePeriodReport(context.Background())
+	if state.ReportPeriod != "2024-07" {
+		t.Errorf("report period %q, want 2024-07", state.ReportPeriod)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "report-2024-06.json.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("report written:\n%s", got)
+	}
+	if !strings.Contains(logs.String(), "Wrote the report of 2024-06 to "+path+"\n") {
+		t.Errorf("the report not logged:\n%s", logs)
+	}
+}
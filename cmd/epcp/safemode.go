@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	e "errors"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// The safe modes, see PolicyConfig.
+const (
+	safeHold = "hold"
+	safeMax  = "max"
+	safeMin  = "min"
+)
+
+// The causes of the safe mode.
+const (
+	causeNoData      = "no-data"
+	causeQuarantine  = "quarantine"
+	causeFetch       = "fetch"
+	causeStale       = "stale"
+	causePolicyError = "policy-error"
+)
+
+// safeMode is what the cycles decide when they cannot decide from the
+// prices: safeHold keeps the current frequencies, safeMax decides the cheap
+// band for performance and safeMin the expensive band for cost.
+var safeMode = safeHold
+
+// adjustForSafeMode replaces the decision of a cycle that cannot be trusted,
+// without prices, with too many of them quarantined, see quarantinePrices,
+// with only some of them fetched before the fetch failed, on stale prices or
+// when the policy cannot decide, by that
+// of the safe mode. The decision goes through the actuators, the floors and
+// the logs like any other, its reason being safe-mode:<cause>; in hold mode
+// it keeps the band and frequencies of the last decision and is not applied.
+func adjustForSafeMode(ctx context.Context, result *cycleResult) {
+	var cause string
+	switch {
+	case result.Decision == nil && e.Is(result.FetchErr, errQuarantined):
+		cause = causeQuarantine
+	case result.Decision == nil && len(result.Prices) == 0:
+		cause = causeNoData
+	case result.Decision == nil && result.FetchErr != nil:
+		cause = causeFetch
+	case result.Decision == nil:
+		cause = causePolicyError
+	case result.Decision.Stale && staleAction == staleSafe:
+		cause = causeStale
+	default:
+		metrics.setGauge("epcp_safe_mode", "Whether the last decision was made in the safe mode.", 0)
+		return
+	}
+	result.SafeMode = cause
+	metrics.setGauge("epcp_safe_mode", "Whether the last decision was made in the safe mode.", 1)
+	metrics.addCounter("epcp_safe_mode_cycles_total", "Number of cycles decided in the safe mode by cause.", 1, "cause", cause)
+	errorLog(ctx).Printf("WARNING: no trustworthy decision (%s), deciding in the %s safe mode\n", cause, safeMode)
+	result.Decision = safeDecision(cause)
+}
+
+// safeDecision returns the decision of the safe mode for the cause.
+func safeDecision(cause string) *Decision {
+	now := cycleClock.Now()
+	decision := &Decision{Time: now, Reason: "safe-mode:" + cause, SafeMode: safeMode, Stale: cause == causeStale,
+		DayType: dayType(now), Simulated: simulate || dryRun}
+	band := policy.Cheap
+	switch safeMode {
+	case safeHold:
+		if last := state.LastDecision; last != nil {
+			decision.Band, decision.Frequency, decision.Nodes, decision.Target = last.Band, last.Frequency, last.Nodes, last.Target
+		}
+		return decision
+	case safeMin:
+		band = policy.Expensive
+	}
+	decision.setBand(band, availableFrequencies())
+	return decision
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestSafeMode(t *testing.T) {
+	now := time.Now()
+	// The failure classes, each set up on the mocks of runOnMocks
+	causes := []struct {
+		cause string
+		setup func(t *testing.T)
+	}{
+		{causeNoData, func(t *testing.T) { priceSource = otetest.NewFake() }},
+		{causeQuarantine, func(t *testing.T) { setGlobal(t, &priceMax, 100.0) }},
+		// The prices of the day before, but not of the new day
+		{causeFetch, func(t *testing.T) {
+			priceSource = otetest.NewFake().
+				AddImPrices(otetest.Points("2024-06-09", 22, 300, 200, 100), nil).
+				AddImPrices(nil, ote.ErrNoData)
+			setGlobal[clock](t, &cycleClock, &fixedClock{time.Date(2024, time.June, 10, 0, 20, 0, 0, ote.Location())})
+		}},
+		{causeStale, func(t *testing.T) {
+			priceSource = laggingSource{trend(now, -10), now.Add(-6 * time.Hour)}
+			setGlobal(t, &historyWindow, 12*time.Hour)
+			setGlobal(t, &maxStaleness, 2*time.Hour)
+			setGlobal(t, &staleAction, staleSafe)
+		}},
+		// A single price is too few for the trend policy
+		{causePolicyError, func(t *testing.T) { setGlobal(t, &historyWindow, 0) }},
+	}
+	modes := []struct {
+		mode string
+		// band is that decided, applied the scaling_max_freq after the
+		// cycle, from 2400000 decided in the cheap band before
+		band, applied string
+	}{
+		{safeHold, policy.Cheap, "2400000"},
+		{safeMax, policy.Cheap, "3200000"},
+		{safeMin, policy.Expensive, "800000"},
+	}
+	for _, c := range causes {
+		for _, m := range modes {
+			t.Run(c.cause+"/"+m.mode, func(t *testing.T) {
+				tree := runOnMocks(t, trend(now, -10))
+				logs := captureLogs(t)
+				setGlobal(t, &safeMode, m.mode)
+				for cpu := range 2 {
+					if err := tree.Write(cpuPath(cpu, "cpufreq", "scaling_max_freq"), []byte("2400000")); err != nil {
+						t.Fatal(err)
+					}
+				}
+				state.LastDecision = &Decision{Time: now.Add(-time.Hour), Band: policy.Cheap, Frequency: 2400000}
+				c.setup(t)
+
+				result := runCycle(context.Background())
+				d := result.Decision
+				if result.SafeMode != c.cause || d == nil || d.Reason != "safe-mode:"+c.cause || d.SafeMode != m.mode || d.Band != m.band {
+					t.Fatalf("safe mode %q, decision %+v, want the %s band for %s", result.SafeMode, d, m.band, c.cause)
+				}
+				if d.Stale != (c.cause == causeStale) {
+					t.Errorf("decision stale %t", d.Stale)
+				}
+				for cpu := range 2 {
+					if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != m.applied {
+						t.Errorf("cpu%d: scaling_max_freq %s, want %s", cpu, got, m.applied)
+					}
+				}
+				want := "WARNING: no trustworthy decision (" + c.cause + "), deciding in the " + m.mode + " safe mode"
+				if !strings.Contains(logs.String(), want) {
+					t.Errorf("logs without %q:\n%s", want, logs)
+				}
+				var exposition strings.Builder
+				metrics.write(&exposition)
+				for _, want := range []string{"epcp_safe_mode 1\n", `epcp_safe_mode_cycles_total{cause="` + c.cause + `"} 1` + "\n"} {
+					if !strings.Contains(exposition.String(), want) {
+						t.Errorf("metrics without %s:\n%s", want, exposition.String())
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSafeModeCleared(t *testing.T) {
+	runOnMocks(t, otetest.NewFake())
+	setGlobal(t, &safeMode, safeMin)
+	if result := runCycle(context.Background()); result.SafeMode != causeNoData {
+		t.Fatalf("safe mode %q without prices, want %s", result.SafeMode, causeNoData)
+	}
+	priceSource = trend(time.Now(), 10)
+	result := runCycle(context.Background())
+	if result.SafeMode != "" || result.Decision == nil || result.Decision.SafeMode != "" || result.Decision.Band != policy.Expensive {
+		t.Errorf("safe mode %q, decision %+v, want the decision of the policy", result.SafeMode, result.Decision)
+	}
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	if !strings.Contains(exposition.String(), "epcp_safe_mode 0\n") {
+		t.Errorf("metrics with the safe mode:\n%s", exposition.String())
+	}
+}
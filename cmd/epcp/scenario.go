@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	e "errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// offlineSources are the sources simulations can run on.
+var offlineSources = []string{"file", "synthetic", "profile"}
+
+// Scenario describes a simulation run declaratively, see
+// epcp simulate --scenario.
+type Scenario struct {
+	Name     string        `yaml:"name,omitempty"`
+	Source   SourceConfig  `yaml:"source"`
+	Policy   PolicyConfig  `yaml:"policy,omitempty"`
+	Machine  MachineConfig `yaml:"machine,omitempty"`
+	From     string        `yaml:"from,omitempty"`
+	To       string        `yaml:"to,omitempty"`
+	Interval string        `yaml:"interval,omitempty"`
+	Speed    float64       `yaml:"speed,omitempty"`
+	// Faults are injected into the simulation, see FaultConfig
+	Faults []FaultConfig `yaml:"faults,omitempty"`
+	// Cooldown is the shortest time between two band changes the
+	// invariants accept, the interval by default
+	Cooldown string `yaml:"cooldown,omitempty"`
+}
+
+// FaultConfig injects a fault into a simulation from At after its start for
+// For, or until its end. The prices go down, as when OTE cannot be reached,
+// unavailable, answering 503, or empty, published without prices; sysfs goes
+// read-only or failing; the clock jumps by Jump, forward or back.
+type FaultConfig struct {
+	Target string `yaml:"target"`
+	Mode   string `yaml:"mode,omitempty"`
+	At     string `yaml:"at"`
+	For    string `yaml:"for,omitempty"`
+	Jump   string `yaml:"jump,omitempty"`
+}
+
+// faultModes are the modes of the faults of each target.
+var faultModes = map[string][]string{
+	"prices": {"down", "unavailable", "empty"},
+	"sysfs":  {"read-only", "failing"},
+	"clock":  {"jump"},
+}
+
+// MachineConfig describes the simulated machine: its CPUs, the frequencies
+// they offer in kHz and the power each draws. A CPU draws IdleWatts plus the
+// rest up to MaxWatts growing with the cube of its frequency.
+type MachineConfig struct {
+	CPUs        int     `yaml:"cpus,omitempty"`
+	Frequencies []int   `yaml:"frequencies,omitempty"`
+	IdleWatts   float64 `yaml:"idle_watts,omitempty"`
+	MaxWatts    float64 `yaml:"max_watts,omitempty"`
+}
+
+// defaultMachine is simulated when a scenario does not describe the machine.
+func defaultMachine() MachineConfig {
+	machine := MachineConfig{CPUs: len(hostCPUs()), IdleWatts: 5, MaxWatts: 25}
+	for _, frequency := range actuator.SimulatedFrequencies {
+		f, _ := strconv.Atoi(frequency)
+		machine.Frequencies = append(machine.Frequencies, f)
+	}
+	return machine
+}
+
+// withDefaults fills the unset fields from defaultMachine.
+func (m MachineConfig) withDefaults() MachineConfig {
+	defaults := defaultMachine()
+	if m.CPUs == 0 {
+		m.CPUs = defaults.CPUs
+	}
+	if len(m.Frequencies) == 0 {
+		m.Frequencies = defaults.Frequencies
+	}
+	if m.IdleWatts == 0 && m.MaxWatts == 0 {
+		m.IdleWatts, m.MaxWatts = defaults.IdleWatts, defaults.MaxWatts
+	}
+	return m
+}
+
+// watts returns the power drawn by all the CPUs running at frequency.
+func (m MachineConfig) watts(frequency int) float64 {
+	ratio := float64(frequency) / float64(slices.Max(m.Frequencies))
+	return float64(m.CPUs) * (m.IdleWatts + (m.MaxWatts-m.IdleWatts)*math.Pow(ratio, 3))
+}
+
+// tree returns the simulated cpufreq tree of the machine.
+func (m MachineConfig) tree() *actuator.MemFS {
+	frequencies := slices.Clone(m.Frequencies)
+	slices.Sort(frequencies)
+	available := make([]string, len(frequencies))
+	for i, f := range frequencies {
+		available[i] = strconv.Itoa(f)
+	}
+	return actuator.SimulatedTreeWith(sysfsRoot, m.CPUs, available)
+}
+
+// loadScenario reads and validates the YAML scenario at path. Relative price
+// files are relative to the scenario.
+func loadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scenario{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(s); err != nil && !e.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if s.Source.PriceFile != "" && !filepath.IsAbs(s.Source.PriceFile) {
+		s.Source.PriceFile = filepath.Join(filepath.Dir(path), s.Source.PriceFile)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.Machine = s.Machine.withDefaults()
+	return s, nil
+}
+
+// Validate checks the scenario and returns all the problems found.
+func (s *Scenario) Validate() error {
+	var errs []error
+	fail := func(path string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+	config := &Config{Source: s.Source, Policy: s.Policy, Schedule: ScheduleConfig{Interval: s.Interval}}
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if !slices.Contains(offlineSources, s.Source.Type) {
+		fail("source.type", "must be file, synthetic or profile")
+	}
+	from, errFrom := simulationTime(s.From)
+	if errFrom != nil && s.From != "" {
+		fail("from", "invalid time %q, expected YYYY-MM-DD or RFC 3339", s.From)
+	}
+	if s.To != "" {
+		if to, err := simulationTime(s.To); err != nil {
+			fail("to", "invalid time %q, expected YYYY-MM-DD or RFC 3339", s.To)
+		} else if errFrom == nil && !to.After(from) {
+			fail("to", "must be after from")
+		}
+	}
+	if s.Interval != "" {
+		if d, err := time.ParseDuration(s.Interval); err == nil && d <= 0 {
+			fail("interval", "must be positive")
+		}
+	}
+	if s.Speed < 0 {
+		fail("speed", "must be positive")
+	}
+	if s.Machine.CPUs < 0 {
+		fail("machine.cpus", "must be positive")
+	}
+	for _, f := range s.Machine.Frequencies {
+		if f <= 0 {
+			fail("machine.frequencies", "must be positive, in kHz")
+			break
+		}
+	}
+	if s.Machine.IdleWatts < 0 || s.Machine.MaxWatts < s.Machine.IdleWatts {
+		fail("machine.max_watts", "must be at least idle_watts, which must not be negative")
+	}
+	for i, f := range s.Faults {
+		path := fmt.Sprintf("faults[%d]", i)
+		modes, ok := faultModes[f.Target]
+		switch {
+		case !ok:
+			fail(path+".target", "must be prices, sysfs or clock")
+		case f.Mode == "" && f.Target != "clock":
+			fail(path+".mode", "is required, one of %s", strings.Join(modes, ", "))
+		case f.Mode != "" && !slices.Contains(modes, f.Mode):
+			fail(path+".mode", "must be one of %s", strings.Join(modes, ", "))
+		}
+		if d, err := time.ParseDuration(f.At); err != nil || d < 0 {
+			fail(path+".at", "must be a duration from the start, e.g. 30h")
+		}
+		if f.For != "" {
+			if d, err := time.ParseDuration(f.For); err != nil || d <= 0 {
+				fail(path+".for", "must be a positive duration")
+			}
+		}
+		if d, err := time.ParseDuration(f.Jump); f.Target == "clock" && (err != nil || d == 0) {
+			fail(path+".jump", "must be a non-zero duration, negative to set the clock back")
+		} else if f.Target != "clock" && f.Jump != "" {
+			fail(path+".jump", "only applies to the clock")
+		}
+	}
+	if s.Cooldown != "" {
+		if d, err := time.ParseDuration(s.Cooldown); err != nil || d < 0 {
+			fail("cooldown", "must be a duration")
+		}
+	}
+	return e.Join(errs...)
+}
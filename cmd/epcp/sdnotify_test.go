@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSdNotify(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets unavailable: %s", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+
+	for _, state := range []string{"READY=1", "STATUS=expensive, 1200000 kHz", "WATCHDOG=1"} {
+		if err := sdNotify(state); err != nil {
+			t.Fatalf("sdNotify(%q): %s", state, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 256)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("reading %q: %s", state, err)
+		}
+		if got := string(buf[:n]); got != state {
+			t.Errorf("got %q, want %q", got, state)
+		}
+	}
+}
+
+func TestSdNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("sdNotify without NOTIFY_SOCKET: %s", err)
+	}
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"invalid", "", 0},
+		{"-1", "", 0},
+		{"20000000", "", 10 * time.Second},
+		{"20000000", "self", 10 * time.Second},
+		{"20000000", "1", 0},
+	}
+	for _, test := range tests {
+		pid := test.pid
+		if pid == "self" {
+			pid = strconv.Itoa(os.Getpid())
+		}
+		t.Setenv("WATCHDOG_USEC", test.usec)
+		t.Setenv("WATCHDOG_PID", pid)
+		if got := sdWatchdogInterval(); got != test.want {
+			t.Errorf("WATCHDOG_USEC=%q WATCHDOG_PID=%q: got %s, want %s", test.usec, pid, got, test.want)
+		}
+	}
+}
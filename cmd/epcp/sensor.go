@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sensorToken and sensorOrigin configure the /sensor endpoint, see
+// SensorConfig.
+var sensorToken, sensorOrigin string
+
+// sensorResponse is a flat object for the RESTful sensor of Home Assistant,
+// with the state as the value and the rest as attributes. Until the first
+// decision the state is initializing and the values are null.
+type sensorResponse struct {
+	State     string     `json:"state"`
+	Price     *float64   `json:"price"`
+	Band      *string    `json:"band"`
+	TargetKHz *int       `json:"target_khz"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// sensor returns the last price and decision.
+func (s *cycleStatus) sensor() sensorResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := sensorResponse{State: "initializing"}
+	if len(s.prices) != 0 {
+		price := s.prices[len(s.prices)-1]
+		res.Price = &price
+	}
+	if d := s.decision; d != nil {
+		band, frequency := d.Band, d.Frequency
+		res.State, res.Band, res.TargetKHz = band, &band, &frequency
+	}
+	if !s.lastCycle.IsZero() {
+		t := s.lastCycle
+		res.UpdatedAt = &t
+	}
+	return res
+}
+
+// serveSensor serves the sensor to the holders of the token, if any, and to
+// browsers from the allowed origin.
+func serveSensor(w http.ResponseWriter, r *http.Request) {
+	if sensorOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", sensorOrigin)
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		if sensorOrigin != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+	}
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodGet, http.MethodHead:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if sensorToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(sensorToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="epcp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status.sensor())
+}
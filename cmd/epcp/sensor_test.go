@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSensor(t *testing.T) {
+	runOnMocks(t, trend(time.Now(), 10))
+	captureLogs(t)
+	setGlobal(t, &simulate, true)
+	setGlobal(t, &status, &cycleStatus{started: time.Now(), frequencies: make(map[int]int)})
+	setGlobal(t, &sensorToken, "")
+	setGlobal(t, &sensorOrigin, "")
+	handler := statusHandler(time.Hour)
+	sensor := func() map[string]any {
+		t.Helper()
+		code, body := get(t, handler, "/sensor")
+		var res map[string]any
+		if err := json.Unmarshal([]byte(body), &res); code != http.StatusOK || err != nil {
+			t.Fatalf("/sensor: %d %v:\n%s", code, err, body)
+		}
+		if len(res) != 5 {
+			t.Errorf("/sensor: %d fields, want state, price, band, target_khz and updated_at:\n%s", len(res), body)
+		}
+		return res
+	}
+
+	// Before the first cycle the values are null
+	res := sensor()
+	for _, field := range []string{"price", "band", "target_khz", "updated_at"} {
+		if value, ok := res[field]; !ok || value != nil {
+			t.Errorf("/sensor before the first cycle: %s %v, want null", field, value)
+		}
+	}
+	if res["state"] != "initializing" {
+		t.Errorf("/sensor before the first cycle: state %v, want initializing", res["state"])
+	}
+
+	start := time.Now()
+	runCycle(context.Background())
+	res = sensor()
+	if res["state"] != "expensive" || res["band"] != "expensive" || res["target_khz"] != 800000.0 {
+		t.Errorf("/sensor after a cycle: %v, want the expensive band at 800000 kHz", res)
+	}
+	status.mu.Lock()
+	last := status.prices[len(status.prices)-1]
+	status.mu.Unlock()
+	if price, ok := res["price"].(float64); !ok || price != last {
+		t.Errorf("/sensor after a cycle: price %v, want the last price", res["price"])
+	}
+	if updated, ok := res["updated_at"].(string); !ok {
+		t.Errorf("/sensor after a cycle: updated_at %v", res["updated_at"])
+	} else if at, err := time.Parse(time.RFC3339Nano, updated); err != nil || at.Before(start.Truncate(time.Second)) {
+		t.Errorf("/sensor after a cycle: updated_at %s, %v, want the time of the cycle", updated, err)
+	}
+}
+
+func TestSensorAuth(t *testing.T) {
+	setGlobal(t, &status, &cycleStatus{started: time.Now(), frequencies: make(map[int]int)})
+	setGlobal(t, &sensorToken, "s3cret")
+	setGlobal(t, &sensorOrigin, "https://ha.example.org")
+	handler := statusHandler(time.Hour)
+	request := func(method, authorization string) *http.Response {
+		recorder := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/sensor", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		handler.ServeHTTP(recorder, r)
+		return recorder.Result()
+	}
+
+	tests := []struct {
+		method, authorization string
+		want                  int
+	}{
+		{http.MethodGet, "", http.StatusUnauthorized},
+		{http.MethodGet, "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodGet, "Basic czNjcmV0", http.StatusUnauthorized},
+		{http.MethodGet, "Bearer s3cret", http.StatusOK},
+		// The preflight of browsers carries no credentials
+		{http.MethodOptions, "", http.StatusNoContent},
+		{http.MethodPost, "Bearer s3cret", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		res := request(test.method, test.authorization)
+		if res.StatusCode != test.want {
+			t.Errorf("%s with %q: status %d, want %d", test.method, test.authorization, res.StatusCode, test.want)
+		}
+		if res.StatusCode == http.StatusUnauthorized && res.Header.Get("WWW-Authenticate") != `Bearer realm="epcp"` {
+			t.Errorf("%s with %q: WWW-Authenticate %q", test.method, test.authorization, res.Header.Get("WWW-Authenticate"))
+		}
+		if origin := res.Header.Get("Access-Control-Allow-Origin"); origin != "https://ha.example.org" || res.Header.Get("Vary") != "Origin" {
+			t.Errorf("%s with %q: allowed origin %q varying on %q", test.method, test.authorization, origin, res.Header.Get("Vary"))
+		}
+	}
+	if headers := request(http.MethodOptions, "").Header.Get("Access-Control-Allow-Headers"); headers != "Authorization" {
+		t.Errorf("allowed headers %q, want Authorization", headers)
+	}
+
+	// Without an origin configured, no CORS headers are sent
+	setGlobal(t, &sensorOrigin, "")
+	if origin := request(http.MethodGet, "Bearer s3cret").Header.Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("allowed origin %q, want none", origin)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// signals remembers the termination signal received by the process.
+type signals struct {
+	mu     sync.Mutex
+	signal os.Signal
+}
+
+func (s *signals) received() os.Signal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signal
+}
+
+// trapSignals cancels the context on the first SIGINT or SIGTERM so that the
+// current cycle can wind down. A second signal exits immediately.
+func trapSignals(cancel context.CancelFunc) *signals {
+	s := new(signals)
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		infoLogger.Printf("Received %s, shutting down\n", sig)
+		s.mu.Lock()
+		s.signal = sig
+		s.mu.Unlock()
+		cancel()
+		sig = <-ch
+		errorLogger.Printf("Received %s again, exiting immediately\n", sig)
+		os.Exit(int(signalExitCode(sig)))
+	}()
+	return s
+}
+
+// signalExitCode follows the shell convention of 128 + signal number.
+func signalExitCode(sig os.Signal) exitCode {
+	if s, ok := sig.(syscall.Signal); ok {
+		return exitCode(128 + int(s))
+	}
+	return 1
+}
+
+// restoreActuators undoes what the actuators set: the frequencies, the power
+// limit, the guest shares, the container limits and the unit quotas.
+func restoreActuators() {
+	restoreFrequencies()
+	clearPowerCap()
+	restoreGuestShares(context.Background())
+	restoreContainerLimits()
+	restoreUnitQuotas()
+}
+
+// shutdown undoes what the actuators set if restore is set, and flushes the
+// outputs, the decision log and the state file.
+func shutdown(restore bool) {
+	if restore {
+		restoreActuators()
+	}
+	flushNotifyQueues()
+	if mqtt != nil {
+		mqtt.close()
+	}
+	closeDBus()
+	if influx != nil {
+		if err := influx.flush(context.Background()); err != nil {
+			errorLogger.Printf("Error writing to InfluxDB: %s\n", err.Error())
+		}
+	}
+	if err := closeDecisionLog(); err != nil {
+		errorLogger.Printf("Error flushing decision log: %s\n", err.Error())
+	}
+	if err := saveState(); err != nil {
+		errorLogger.Printf("Error saving state file: %s\n", err.Error())
+	}
+}
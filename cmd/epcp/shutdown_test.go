@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestSignalExitCode(t *testing.T) {
+	tests := []struct {
+		sig  os.Signal
+		want exitCode
+	}{
+		{syscall.SIGINT, 130},
+		{syscall.SIGTERM, 143},
+		{os.Interrupt, 130},
+	}
+	for _, test := range tests {
+		if got := signalExitCode(test.sig); got != test.want {
+			t.Errorf("signalExitCode(%v) = %d, want %d", test.sig, got, test.want)
+		}
+	}
+}
+
+func TestShutdownFlushes(t *testing.T) {
+	dir := t.TempDir()
+	setGlobal(t, &stateDir, dir)
+	setGlobal(t, &decisionLog, filepath.Join(dir, "decisions.jsonl"))
+	setGlobal(t, &restoreOnExit, false)
+	setGlobal(t, &state, new(State))
+	openDecisionLog()
+	logDecision(context.Background(), &Decision{Time: time.Now(), Band: policy.Expensive, Frequency: 800000})
+
+	shutdown(false)
+	content, err := os.ReadFile(decisionLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 1 {
+		t.Errorf("%d decisions logged, want 1:\n%s", lines, content)
+	}
+	content, err = os.ReadFile(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatalf("state file not saved: %s", err)
+	}
+	saved := new(State)
+	if err := json.Unmarshal(content, saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.LastDecision == nil || saved.LastDecision.Frequency != 800000 {
+		t.Errorf("saved last decision %+v, want 800000 kHz", saved.LastDecision)
+	}
+}
+
+// runOnMocks prepares runCycles to scale two simulated CPUs on the prices
+// of source, with its state in a temporary directory, and returns the tree.
+func runOnMocks(t *testing.T, source ote.PriceSource) *actuator.MemFS {
+	t.Helper()
+	tree := simulatedSysfs(t, 2)
+	dir := t.TempDir()
+	config := *effectiveConfig
+	config.State.Dir = dir
+	setGlobal(t, &effectiveConfig, &config)
+	setGlobal(t, &stateDir, dir)
+	setGlobal(t, &skipPreflight, true)
+	setGlobal(t, &restoreOnExit, true)
+	setGlobal(t, &historyWindow, 3*time.Hour)
+	setGlobal(t, &cycleInterval, time.Hour)
+	setGlobal(t, &priceSource, source)
+	setGlobal(t, &frequencyActuator, frequencyActuator)
+	return tree
+}
+
+func TestOneShotRunKeepsTheFrequencies(t *testing.T) {
+	tree := runOnMocks(t, trend(time.Now(), 10))
+	if code := runCycles(false); code != exitOK {
+		t.Fatalf("exit code %d, want %d", code, exitOK)
+	}
+	for cpu := 0; cpu < 2; cpu++ {
+		if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != "800000" {
+			t.Errorf("cpu%d: scaling_max_freq %s after the run, want the applied 800000", cpu, got)
+		}
+	}
+}
+
+func TestFailedOneShotRunRestores(t *testing.T) {
+	tree := runOnMocks(t, trend(time.Now(), 10))
+	// The first run applies, the second fails to fetch
+	if code := runCycles(false); code != exitOK {
+		t.Fatalf("exit code %d, want %d", code, exitOK)
+	}
+	setGlobal[ote.PriceSource](t, &priceSource, otetest.NewFake())
+	setGlobal(t, &state, new(State))
+	if code := runCycles(false); code == exitOK {
+		t.Fatalf("exit code %d, want a failure", code)
+	}
+	for cpu := 0; cpu < 2; cpu++ {
+		if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != "3200000" {
+			t.Errorf("cpu%d: scaling_max_freq %s after the failed run, want the restored 3200000", cpu, got)
+		}
+	}
+}
+
+func TestFailedLastDayNotApplied(t *testing.T) {
+	// The window crosses midnight and the prices of the new day are not
+	// published yet, those of the day before are
+	source := otetest.NewFake().
+		AddImPrices(otetest.Points("2024-06-09", 22, 100, 200, 300), nil).
+		AddImPrices(nil, ote.ErrNoData)
+	tree := runOnMocks(t, source)
+	setGlobal[clock](t, &cycleClock, &fixedClock{time.Date(2024, time.June, 10, 0, 20, 0, 0, ote.Location())})
+	setGlobal(t, &state, new(State))
+	captureLogs(t)
+	result := runCycle(context.Background())
+	if code := result.exitCode(); code != exitInsufficientData {
+		t.Errorf("exit code %d, want %d", code, exitInsufficientData)
+	}
+	if len(result.Points) != 3 {
+		t.Errorf("%d points, want the 3 of the day before", len(result.Points))
+	}
+	if d := result.Decision; d != nil && d.Band != "" {
+		t.Errorf("decision %+v on the prices of a failed fetch", d)
+	}
+	for cpu := 0; cpu < 2; cpu++ {
+		if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != "3200000" {
+			t.Errorf("cpu%d: scaling_max_freq %s after the failed fetch, want the untouched 3200000", cpu, got)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTrapSignals(t *testing.T) {
+	logs := captureLogs(t)
+	// The commands run by other tests left their handlers behind, which
+	// would log the signal into a later test
+	signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := trapSignals(cancel)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("sending SIGTERM: %s", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled after SIGTERM")
+	}
+	if got := signals.received(); got != syscall.SIGTERM {
+		t.Errorf("received %v, want %v", got, syscall.SIGTERM)
+	}
+	if !strings.Contains(logs.String(), "shutting down") {
+		t.Errorf("shutdown not logged:\n%s", logs)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func simulateFlags(flags *flag.FlagSet) {
+	fetchFlags(flags)
+	envVar(flags, "interval", "EPCP_INTERVAL", "duration", "simulated `duration` between cycles (default 1h)")
+	envVar(flags, "eval-offset", "EPCP_EVAL_OFFSET", "duration", "`duration` into each interval to run the cycles at")
+	envVar(flags, "decision-log", "EPCP_DECISION_LOG", "string", "`file` to append the decisions to as JSON lines")
+	envVar(flags, "jitter", "EPCP_JITTER", "duration", "maximum host-specific `delay` of the cycles")
+	flags.String("scenario", "", "YAML `file` describing the simulation, overridden by the flags below")
+	flags.String("from", "", "simulated start as YYYY-MM-DD or an RFC 3339 time (required)")
+	flags.String("to", "", "simulated end as YYYY-MM-DD or an RFC 3339 time (default a week after --from)")
+	flags.Float64("speed", 3600, "simulated seconds per real second")
+}
+
+// simulationTime parses a day, meaning its start in the market time zone,
+// or an RFC 3339 time.
+func simulationTime(value string) (time.Time, error) {
+	if _, err := time.Parse(time.DateOnly, value); err == nil {
+		return ote.HourStart(value, 1)
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// simulationReport summarises the cycles of a simulation and the energy
+// the machine used compared to always running at its highest frequency.
+type simulationReport struct {
+	machine  MachineConfig
+	interval time.Duration
+	timeline []timelineEntry
+
+	cycles        int
+	fetchFailures int
+	undecided     int
+	bands         map[string]int
+	changes       int
+	// frequency and price are those of the last cycle
+	frequency int
+	price     float64
+	// energy in kWh and its cost, also when always at the highest frequency
+	energy, cost       float64
+	maxEnergy, maxCost float64
+}
+
+// timelineEntry is a decision of the simulation, or its absence.
+type timelineEntry struct {
+	time      time.Time
+	price     float64
+	band      string
+	frequency int
+}
+
+func newSimulationReport(machine MachineConfig, interval time.Duration) *simulationReport {
+	return &simulationReport{machine: machine, interval: interval, bands: make(map[string]int)}
+}
+
+// add accounts for a cycle. Without a decision, or one holding the
+// frequencies, the machine stays at the previous frequency, the highest one
+// initially.
+func (r *simulationReport) add(result *cycleResult) {
+	r.cycles++
+	if result.FetchErr != nil {
+		r.fetchFailures++
+	}
+	if len(result.Prices) != 0 {
+		r.price = result.Prices[len(result.Prices)-1]
+	}
+	highest := 0
+	for _, f := range r.machine.Frequencies {
+		highest = max(highest, f)
+	}
+	if r.frequency == 0 {
+		r.frequency = highest
+	}
+	entry := timelineEntry{time: cycleClock.Now(), price: r.price}
+	if decision := result.Decision; decision == nil {
+		r.undecided++
+	} else {
+		entry.time, entry.band = decision.Time, decision.Band
+		r.bands[decision.Band]++
+		// The hold safe mode leaves the frequency as it is
+		if decision.SafeMode != safeHold {
+			if decision.Frequency != r.frequency {
+				r.changes++
+			}
+			r.frequency = decision.Frequency
+		}
+	}
+	entry.frequency = r.frequency
+	r.timeline = append(r.timeline, entry)
+
+	hours := r.interval.Hours()
+	energy := r.machine.watts(r.frequency) * hours / 1000
+	maxEnergy := r.machine.watts(highest) * hours / 1000
+	// The prices are per MWh
+	r.energy += energy
+	r.cost += energy * r.price / 1000
+	r.maxEnergy += maxEnergy
+	r.maxCost += maxEnergy * r.price / 1000
+}
+
+// print writes the report to w, with the decision timeline if asked for.
+func (r *simulationReport) print(w io.Writer, timeline bool) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if timeline {
+		fmt.Fprintf(tw, "TIME\t%s\tBAND\tFREQUENCY\n", display.column())
+		for _, entry := range r.timeline {
+			band := entry.band
+			if band == "" {
+				band = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", entry.time.Format(time.RFC3339), display.value(entry.price), band, entry.frequency)
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintln(tw, "BAND\tCYCLES\tSHARE")
+	for _, band := range []string{policy.Cheap, policy.Expensive} {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f%%\n", band, r.bands[band], 100*float64(r.bands[band])/float64(max(r.cycles, 1)))
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "RUN\tENERGY\tCOST")
+	fmt.Fprintf(tw, "policy\t%.3f kWh\t%.4f\n", r.energy, r.cost)
+	fmt.Fprintf(tw, "always-max\t%.3f kWh\t%.4f\n", r.maxEnergy, r.maxCost)
+	fmt.Fprintf(tw, "saving\t%.1f%%\t%.1f%%\n", saving(r.energy, r.maxEnergy), saving(r.cost, r.maxCost))
+	tw.Flush()
+	fmt.Fprintf(w, "%d cycles, %d fetch failures, %d without a decision, %d frequency changes\n",
+		r.cycles, r.fetchFailures, r.undecided, r.changes)
+}
+
+// saving returns by how many percent value is below reference.
+func saving(value, reference float64) float64 {
+	if reference == 0 {
+		return 0
+	}
+	return 100 * (reference - value) / reference
+}
+
+// runSimulate runs the daemon loop over a past or future period on a
+// simulated clock, with the prices of the file or synthetic source and a
+// simulated machine, described by a scenario or the flags. The state file
+// and the notification outputs are left alone.
+func runSimulate(flags *flag.FlagSet) exitCode {
+	scenario := &Scenario{Source: effectiveConfig.Source, Policy: effectiveConfig.Policy, Machine: defaultMachine()}
+	if path := flags.Lookup("scenario").Value.String(); path != "" {
+		var err error
+		if scenario, err = loadScenario(path); err != nil {
+			errorLogger.Printf("Error loading scenario: %s\n", err.Error())
+			return exitConfig
+		}
+	}
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["from"] || scenario.From == "" {
+		scenario.From = flags.Lookup("from").Value.String()
+	}
+	if set["to"] {
+		scenario.To = flags.Lookup("to").Value.String()
+	}
+	if set["speed"] || scenario.Speed == 0 {
+		scenario.Speed, _ = strconv.ParseFloat(flags.Lookup("speed").Value.String(), 64)
+	}
+	if !slices.Contains(offlineSources, scenario.Source.Type) {
+		errorLogger.Println("Simulations need the file, synthetic or profile source, see --source.")
+		return exitUsage
+	}
+	from, err := simulationTime(scenario.From)
+	if err != nil {
+		errorLogger.Printf("Error parsing --from: %s\n", err.Error())
+		return exitUsage
+	}
+	to := from.AddDate(0, 0, 7)
+	if scenario.To != "" {
+		if to, err = simulationTime(scenario.To); err != nil {
+			errorLogger.Printf("Error parsing --to: %s\n", err.Error())
+			return exitUsage
+		}
+	}
+	if !to.After(from) || scenario.Speed <= 0 {
+		errorLogger.Println("The simulation must end after it starts and the speed must be positive.")
+		return exitUsage
+	}
+	if scenario.Interval != "" && !set["interval"] {
+		cycleInterval, _ = time.ParseDuration(scenario.Interval)
+	}
+	if cycleInterval <= 0 {
+		cycleInterval = time.Hour
+	}
+	if priceSource, err = scenario.Source.priceSource(); err != nil {
+		errorLogger.Printf("Error loading prices: %s\n", err.Error())
+		return exitConfig
+	}
+	if cyclePolicy, err = scenario.Policy.policy(); err != nil {
+		errorLogger.Printf("Error selecting the policy: %s\n", err.Error())
+		return exitConfig
+	}
+	if dayPolicies, err = scenario.Policy.dayPolicies(); err != nil {
+		errorLogger.Printf("Error selecting the policy: %s\n", err.Error())
+		return exitConfig
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trapSignals(cancel)
+	simulate = true
+	tree := scenario.Machine.tree()
+	originals := make(map[string]string)
+	for cpu := 0; cpu < scenario.Machine.CPUs; cpu++ {
+		path := cpuPath(cpu, "cpufreq", "scaling_max_freq")
+		originals[path], _ = actuator.ReadFile(tree, path)
+	}
+	sysfs = tree
+	// The cycle loop and the day-ahead watch wait for the clock
+	base := newSimulatedClock(from, to, scenario.Speed, 2, cancel)
+	cycleClock = base
+	lift, err := injectFaults(ctx, scenario, from, to, base)
+	if err != nil {
+		errorLogger.Printf("Error serving the prices: %s\n", err.Error())
+		return exitConfig
+	}
+	frequencyActuator = selectActuator()
+	notifier, mqtt, influx, textfile, otlpEndpoint, reportDir = nil, nil, nil, "", "", ""
+	// The battery and the solar forecast are live, not simulated
+	batterySource, solarSite = nil, nil
+	openDecisionLog()
+	defer closeDecisionLog()
+
+	infoLogger.Printf("Simulating %s from %s to %s at %gx\n", scenario.Name, from.Format(time.RFC3339), to.Format(time.RFC3339), scenario.Speed)
+	report := newSimulationReport(scenario.Machine, cycleInterval)
+	checks := &invariants{base: base, cooldown: cycleInterval}
+	if scenario.Cooldown != "" {
+		checks.cooldown, _ = time.ParseDuration(scenario.Cooldown)
+	}
+	started := time.Now()
+	go watchPublication(ctx)
+	runLoop(ctx, cycleInterval, nil, func(result *cycleResult) {
+		report.add(result)
+		checks.check(result)
+	})
+	infoLogger.Printf("Simulation finished in %s\n", time.Since(started).Round(time.Millisecond))
+	// The shutdown restores the frequencies as with apply.restore_on_exit
+	lift()
+	restoreFrequencies()
+	checks.checkRestored(tree, originals)
+	if scenario.Name != "" {
+		fmt.Printf("Scenario %s: %s to %s every %s\n\n", scenario.Name, from.Format(time.RFC3339), to.Format(time.RFC3339), cycleInterval)
+	}
+	report.print(os.Stdout, scenario.Name != "")
+	return checks.print(os.Stdout, len(scenario.Faults))
+}
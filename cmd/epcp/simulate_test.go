@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestSimulate(t *testing.T) {
+	decisionLog := filepath.Join(t.TempDir(), "decisions.jsonl")
+	out, code := runEpcp(t, "simulate", "--scenario", filepath.Join("testdata", "tiny.yaml"), "--decision-log", decisionLog)
+	if code != exitOK {
+		t.Fatalf("exit code %d:\n%s", code, out)
+	}
+
+	// Each cycle decides on the prices of the current trading hour and the
+	// three before it: rising more often than falling up to the cycle at
+	// 06:00, over 40, 50, 60 and 50, falling from 07:00 on
+	type decision struct {
+		hour      int
+		band      string
+		frequency int
+	}
+	var want []decision
+	for hour := 2; hour < 12; hour++ {
+		if hour <= 6 {
+			want = append(want, decision{hour, policy.Expensive, 1000000})
+		} else {
+			want = append(want, decision{hour, policy.Cheap, 2000000})
+		}
+	}
+	f, err := os.Open(decisionLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []decision
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var d Decision
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, decision{d.Time.In(time.FixedZone("CET", 3600)).Hour(), d.Band, d.Frequency})
+	}
+	if len(got) != len(want) {
+		t.Fatalf("decided %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("decision %d: %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// 5 h at 1.25 W and 5 h at 10 W against 10 h at 10 W; the cost is the
+	// energy at the prices of the hours, 30 to 60 and 50 expensive, 40 to
+	// 10 and 5 cheap
+	for _, line := range []string{
+		"cheap      5       50.0%",
+		"expensive  5       50.0%",
+		"policy      0.056 kWh  0.0013",
+		"always-max  0.100 kWh  0.0034",
+		"10 cycles, 0 fetch failures, 0 without a decision, 2 frequency changes",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("report lacks %q:\n%s", line, out)
+		}
+	}
+}
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestScenarioReports(t *testing.T) {
+	for _, name := range []string{"price-file", "synthetic-week"} {
+		t.Run(name, func(t *testing.T) {
+			out, code := runEpcp(t, "simulate", "--scenario", filepath.Join("..", "..", "examples", "scenarios", name+".yaml"), "--speed", "10000000")
+			if code != exitOK {
+				t.Fatalf("exit code %d:\n%s", code, out)
+			}
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(out), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != string(want) {
+				t.Errorf("report differs from %s, run the tests with -update if intended:\n%s", golden, out)
+			}
+		})
+	}
+}
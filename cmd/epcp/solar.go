@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/solar"
+)
+
+const (
+	// solarTimeout bounds fetching the forecast.
+	solarTimeout = 10 * time.Second
+	// solarRetry spaces the attempts after a failed fetch, keeping well
+	// within the rate limit of the free tier.
+	solarRetry = time.Hour
+)
+
+var (
+	// solarSite lowers the prices by the forecast production, see
+	// SolarConfig; it is nil without a PV plant
+	solarSite *solar.Site
+	// solarLoad is the power in kW consumed on site
+	solarLoad float64
+	// solarAttempt is when the forecast was last fetched unsuccessfully
+	solarAttempt time.Time
+)
+
+// solarCache holds the forecast of the day it was fetched on.
+type solarCache struct {
+	Day      string          `json:"day"`
+	Forecast *solar.Forecast `json:"forecast"`
+}
+
+// solarForecast returns the forecast of today, fetched once a day and cached
+// in the state. While it cannot be fetched, the cached forecast of an
+// earlier day is used, which covers today too; it returns nil without any.
+func solarForecast(ctx context.Context) *solar.Forecast {
+	now := cycleClock.Now()
+	day := now.Format(time.DateOnly)
+	var cached *solar.Forecast
+	if state.Solar != nil {
+		cached = state.Solar.Forecast
+		if state.Solar.Day == day {
+			return cached
+		}
+	}
+	if now.Sub(solarAttempt) < solarRetry {
+		return cached
+	}
+	ctx, cancel := context.WithTimeout(ctx, solarTimeout)
+	defer cancel()
+	forecast, err := solar.Fetch(ctx, newHTTPClient(nil, solarTimeout), "", *solarSite)
+	if err != nil {
+		if e.Is(err, solar.ErrRateLimited) {
+			errorLog(ctx).Printf("WARNING: %s, retrying in %s\n", err.Error(), solarRetry)
+		} else {
+			errorLog(ctx).Printf("Error fetching the solar forecast: %s\n", err.Error())
+		}
+		solarAttempt = now
+		return cached
+	}
+	state.Solar = &solarCache{Day: day, Forecast: forecast}
+	return forecast
+}
+
+// adjustForSolar returns the prices the policy decides on: the prices of the
+// points lowered by the value of the forecast production consumed on site.
+// Without a forecast they are the grid prices.
+func adjustForSolar(ctx context.Context, points []ote.PricePoint) []float64 {
+	prices := ote.Prices(points)
+	if solarSite == nil {
+		return prices
+	}
+	forecast := solarForecast(ctx)
+	if forecast == nil {
+		return prices
+	}
+	for i, p := range points {
+		if !p.Start.IsZero() {
+			prices[i] = solar.Adjust(p.Price, forecast.Hour(p.Start), solarLoad)
+		}
+	}
+	if n := len(points); n != 0 && prices[n-1] != points[n-1].Price {
+		infoLog(ctx).Printf("Solar production of %.1f kWh lowers the price from %s to %s\n",
+			forecast.Hour(points[n-1].Start), display.price(points[n-1].Price), display.price(prices[n-1]))
+	}
+	return prices
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/solar"
+)
+
+func TestAdjustForSolar(t *testing.T) {
+	logs := captureLogs(t)
+	now := time.Date(2024, time.June, 1, 12, 30, 0, 0, time.UTC)
+	setGlobal[clock](t, &cycleClock, &fixedClock{now})
+	setGlobal(t, &solarSite, &solar.Site{Latitude: 49.2, Longitude: 16.6, Declination: 35, KWp: 6})
+	setGlobal(t, &solarLoad, 4.0)
+	// The forecast was fetched today, and a fetch was just attempted, so
+	// none is made
+	setGlobal(t, &solarAttempt, now)
+	hour := func(h int) time.Time { return time.Date(2024, time.June, 1, h, 0, 0, 0, time.UTC) }
+	forecast := &solar.Forecast{Energy: map[int64]float64{hour(10).Unix(): 1, hour(11).Unix(): 3, hour(12).Unix(): 5}}
+	setGlobal(t, &state, &State{Solar: &solarCache{Day: "2024-06-01", Forecast: forecast}})
+	points := []ote.PricePoint{
+		{Start: hour(9), Price: 100},
+		{Start: hour(10), Price: 100},
+		{Start: hour(11), Price: 120},
+		{Start: hour(12), Price: 150},
+	}
+
+	// The production consumed on site lowers the price, down to nothing
+	// when it covers the load
+	want := []float64{100, 75, 30, 0}
+	got := adjustForSolar(context.Background(), points)
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("prices %v, want %v", got, want)
+			break
+		}
+	}
+	if !strings.Contains(logs.String(), "Solar production of 5.0 kWh lowers the price from") {
+		t.Errorf("the adjustment not logged:\n%s", logs)
+	}
+
+	// The forecast of an earlier day is used while a new one cannot be
+	// fetched, e.g. because of the rate limit
+	state.Solar.Day = "2024-05-31"
+	if got := adjustForSolar(context.Background(), points); got[2] != 30 {
+		t.Errorf("prices %v with yesterday's forecast, want it used", got)
+	}
+
+	// Without any forecast the grid prices are decided on
+	state.Solar = nil
+	if got := adjustForSolar(context.Background(), points); got[2] != 120 || got[3] != 150 {
+		t.Errorf("prices %v without a forecast, want the grid prices", got)
+	}
+	setGlobal(t, &solarSite, nil)
+	state.Solar = &solarCache{Day: "2024-06-01", Forecast: forecast}
+	if got := adjustForSolar(context.Background(), points); got[3] != 150 {
+		t.Errorf("prices %v without a PV plant, want the grid prices", got)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// intradayPublicationLag is how long after the end of an hour its intraday
+// price may be published, which the staleness does not count.
+const intradayPublicationLag = time.Hour
+
+// The actions on stale prices, see SourceConfig.
+const (
+	staleSafe         = "safe"
+	staleConservative = "conservative"
+)
+
+var (
+	// maxStaleness is how much older than expected the newest price may
+	// be; 0 disables the check
+	maxStaleness time.Duration
+	// staleAction is staleSafe or staleConservative
+	staleAction = staleSafe
+)
+
+// staleness returns how much older than expected the newest market price of
+// the points is, or false without market prices. The evaluation offset is
+// expected too, so that the staleness of the cycles at hh:MM is that of
+// those at hh:00.
+func staleness(points []ote.PricePoint, now time.Time) (time.Duration, bool) {
+	var newest time.Time
+	for _, p := range points {
+		if p.Source == "" && p.Start.After(newest) {
+			newest = p.Start
+		}
+	}
+	if newest.IsZero() {
+		return 0, false
+	}
+	return now.Sub(newest.Add(time.Hour)) - intradayPublicationLag - evalOffset, true
+}
+
+// checkStaleness guards against prices older than expected, like those of
+// the previous day served during an incident: the decision is marked stale
+// and either replaced by that of the safe mode, see adjustForSafeMode, or
+// made conservative by deciding the expensive band.
+func checkStaleness(ctx context.Context, result *cycleResult) {
+	if maxStaleness == 0 {
+		return
+	}
+	age, ok := staleness(result.Points, cycleClock.Now())
+	if !ok {
+		return
+	}
+	result.Stale = age > maxStaleness
+	stale := 0.0
+	if result.Stale {
+		stale = 1
+	}
+	metrics.setGauge("epcp_stale_prices", "Whether the prices of the last cycle were stale.", stale)
+	if !result.Stale {
+		return
+	}
+	metrics.addCounter("epcp_stale_cycles_total", "Number of cycles with stale prices.", 1)
+	errorLog(ctx).Printf("WARNING: the prices are stale, the newest is %s older than expected\n", age.Round(time.Minute))
+	decision := result.Decision
+	if decision == nil {
+		return
+	}
+	decision.Stale = true
+	if staleAction == staleConservative && decision.Band != policy.Expensive {
+		infoLog(ctx).Println("Deciding the expensive band on stale prices")
+		decision.setBand(policy.Expensive, availableFrequencies())
+	}
+}
+
+// staleMessage describes the stale prices of the cycle, or the recovery.
+func staleMessage(stale bool, runID string) string {
+	hostname, _ := os.Hostname()
+	text := "The prices are fresh again on " + hostname
+	if stale {
+		text = "The prices are stale on " + hostname + ", the newest is older than EPCP_MAX_STALENESS allows"
+	}
+	if runID != "" {
+		text += " [run " + runID + "]"
+	}
+	return text
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// laggingSource serves no prices of the hours starting after until, as OTE
+// does during some incidents.
+type laggingSource struct {
+	ote.PriceSource
+	until time.Time
+}
+
+func (s laggingSource) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	points, err := s.PriceSource.ImPrices(ctx, day, fromHour, toHour)
+	var served []ote.PricePoint
+	for _, p := range points {
+		if !p.Start.After(s.until) {
+			served = append(served, p)
+		}
+	}
+	return served, err
+}
+
+func TestStaleness(t *testing.T) {
+	now := time.Date(2024, time.October, 1, 13, 20, 0, 0, ote.Location())
+	hour := func(h int, source string) ote.PricePoint {
+		start := time.Date(2024, time.October, 1, h, 0, 0, 0, ote.Location())
+		return ote.PricePoint{Start: start, Price: 100, Source: source}
+	}
+	tests := []struct {
+		name   string
+		points []ote.PricePoint
+		offset time.Duration
+		want   time.Duration
+		ok     bool
+	}{
+		// The price of 11:00-12:00 may be published until 13:00
+		{"within the lag", []ote.PricePoint{hour(10, ""), hour(11, "")}, 0, 20 * time.Minute, true},
+		{"current hour", []ote.PricePoint{hour(13, "")}, 0, -100 * time.Minute, true},
+		{"yesterday", []ote.PricePoint{hour(11, ""), {Start: hour(11, "").Start.Add(-24 * time.Hour)}}, 0, 20 * time.Minute, true},
+		{"evaluation offset", []ote.PricePoint{hour(11, "")}, 20 * time.Minute, 0, true},
+		// Forecasts are not market prices
+		{"forecast", []ote.PricePoint{hour(9, ""), hour(12, "forecast")}, 0, 2*time.Hour + 20*time.Minute, true},
+		{"only forecasts", []ote.PricePoint{hour(12, "forecast")}, 0, 0, false},
+		{"none", nil, 0, 0, false},
+	}
+	for _, test := range tests {
+		setGlobal(t, &evalOffset, test.offset)
+		if age, ok := staleness(test.points, now); age != test.want || ok != test.ok {
+			t.Errorf("%s: staleness %s, %t, want %s, %t", test.name, age, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestStalePrices(t *testing.T) {
+	tests := []struct {
+		action string
+		// band is that decided, "" when the frequencies are held
+		band string
+		// applied is the scaling_max_freq after the cycle
+		applied string
+	}{
+		{staleSafe, "", "3200000"},
+		{staleConservative, policy.Expensive, "800000"},
+	}
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			now := time.Now()
+			tree := runOnMocks(t, laggingSource{trend(now, -10), now.Add(-6 * time.Hour)})
+			logs := captureLogs(t)
+			setGlobal(t, &historyWindow, 12*time.Hour)
+			setGlobal(t, &maxStaleness, 2*time.Hour)
+			setGlobal(t, &staleAction, test.action)
+			setGlobal(t, &safeMode, safeHold)
+
+			result := runCycle(context.Background())
+			if !result.Stale || result.Decision == nil || !result.Decision.Stale || result.Decision.Band != test.band {
+				t.Fatalf("stale %t, decision %+v, want a stale %q decision", result.Stale, result.Decision, test.band)
+			}
+			if got := readSysfs(t, tree, cpuPath(0, "cpufreq", "scaling_max_freq")); got != test.applied {
+				t.Errorf("scaling_max_freq %s, want %s", got, test.applied)
+			}
+			if !strings.Contains(logs.String(), "WARNING: the prices are stale, the newest is ") {
+				t.Errorf("the stale prices not logged:\n%s", logs)
+			}
+			var exposition strings.Builder
+			metrics.write(&exposition)
+			for _, want := range []string{"epcp_stale_prices 1\n", "epcp_stale_cycles_total 1\n"} {
+				if !strings.Contains(exposition.String(), want) {
+					t.Errorf("metrics without %s:\n%s", want, exposition.String())
+				}
+			}
+
+			// Fresh prices clear the gauge and decide as usual
+			priceSource = trend(now, -10)
+			result = runCycle(context.Background())
+			if result.Stale || result.Decision == nil || result.Decision.Stale || result.Decision.Band != policy.Cheap {
+				t.Errorf("stale %t, decision %+v on fresh prices", result.Stale, result.Decision)
+			}
+			exposition.Reset()
+			metrics.write(&exposition)
+			if !strings.Contains(exposition.String(), "epcp_stale_prices 0\n") || !strings.Contains(exposition.String(), "epcp_stale_cycles_total 1\n") {
+				t.Errorf("metrics after fresh prices:\n%s", exposition.String())
+			}
+		})
+	}
+}
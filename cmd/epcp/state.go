@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/forecast"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/store"
+)
+
+// State is persisted in the state directory between runs.
+type State struct {
+	// OriginalFrequencies holds scaling_max_freq of each CPU before it was
+	// first scaled, so that it can be restored.
+	OriginalFrequencies map[int]int `json:"originalFrequencies,omitempty"`
+	// AppliedTargets maps the CPUs to the frequency epcp last wrote and
+	// ExternalFrequencies those another agent changed to the observed one,
+	// so that one-shot runs detect the changes between them, see checkDrift.
+	AppliedTargets      map[int]int `json:"appliedTargets,omitempty"`
+	ExternalFrequencies map[int]int `json:"externalFrequencies,omitempty"`
+	LastDecision        *Decision   `json:"lastDecision,omitempty"`
+	// Prices are the last fetched prices, used while OTE cannot be reached.
+	Prices *priceCache `json:"prices,omitempty"`
+	// Alerts maps the active alerts to the time they were last sent.
+	Alerts map[string]time.Time `json:"alerts,omitempty"`
+	// Drained is set while the node is drained by the drain command, so
+	// that only a node epcp drained is resumed.
+	Drained bool `json:"drained,omitempty"`
+	// OriginalShares holds the cpu_shares of each libvirt domain before it
+	// was first scaled, so that it can be restored.
+	OriginalShares map[string]int `json:"originalShares,omitempty"`
+	// OriginalLimits holds the CPU limits of each Docker container before
+	// they were first scaled, by container ID.
+	OriginalLimits map[string]actuator.ContainerLimits `json:"originalLimits,omitempty"`
+	// OriginalQuotas holds the CPUQuotaPerSecUSec of each systemd unit
+	// before it was first scaled, actuator.NoQuota for none.
+	OriginalQuotas map[string]uint64 `json:"originalQuotas,omitempty"`
+	// Solar is the last fetched solar forecast, see solarForecast.
+	Solar *solarCache `json:"solar,omitempty"`
+	// History holds the prices of the last days for the forecasts and the
+	// reports and HistoryVolumes their volumes; HourlyPrices the means of
+	// the older hours, DailyPrices the statistics of the days older still by
+	// market day, see compactHistory, and HistoryCompacted the day it last
+	// ran.
+	History          forecast.History        `json:"history,omitempty"`
+	HistoryVolumes   forecast.History        `json:"historyVolumes,omitempty"`
+	HourlyPrices     map[int64]*hourlyPrices `json:"hourlyPrices,omitempty"`
+	DailyPrices      map[string]*dailyPrices `json:"dailyPrices,omitempty"`
+	HistoryCompacted string                  `json:"historyCompacted,omitempty"`
+	// Energy maps the market days to the energy measured by RAPL per band,
+	// see accountEnergy; EnergySummarized is the last day logged.
+	Energy           map[string]map[string]*energyTotals `json:"energy,omitempty"`
+	EnergySummarized string                              `json:"energySummarized,omitempty"`
+	// ReportPeriod is the period of the last cycle, see writePeriodReport.
+	ReportPeriod string `json:"reportPeriod,omitempty"`
+	// Bootstrap is the number of days of a bootstrap of the history underway,
+	// see bootstrapHistory.
+	Bootstrap int `json:"bootstrap,omitempty"`
+	// PeakShaving is the budget of the peak shaving policy consumed today,
+	// see adjustForPeakShaving.
+	PeakShaving *shavingBudget `json:"peakShaving,omitempty"`
+}
+
+// priceCache holds the prices of the last successful fetch.
+type priceCache struct {
+	Time   time.Time        `json:"time"`
+	Points []ote.PricePoint `json:"points"`
+}
+
+var (
+	state     = new(State)
+	decisions *store.Log
+)
+
+func stateFile() string {
+	return filepath.Join(stateDir, "state.json")
+}
+
+// lockFile returns the lock file path, in the state directory if configured.
+func lockFile() string {
+	if effectiveConfig.State.Dir != "" {
+		return filepath.Join(stateDir, "epcp.lock")
+	}
+	return "/run/epcp.lock"
+}
+
+// loadState reads the state file; a missing file yields an empty state.
+func loadState() {
+	err := store.LoadJSON(stateFile(), state)
+	if e.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		errorLogger.Printf("Error reading state file %s: %s\n", stateFile(), err.Error())
+	}
+}
+
+// saveState writes the state file atomically.
+func saveState() error {
+	return store.SaveJSON(stateFile(), state)
+}
+
+// openDecisionLog opens the JSON lines decision log for appending if configured.
+func openDecisionLog() {
+	if decisionLog == "" {
+		return
+	}
+	l, err := store.OpenLog(decisionLog)
+	if err != nil {
+		errorLogger.Printf("Error opening decision log %s: %s\n", decisionLog, err.Error())
+		return
+	}
+	decisions = l
+}
+
+// logDecision appends the decision to the decision log and remembers it in the state.
+func logDecision(ctx context.Context, decision *Decision) {
+	state.LastDecision = decision
+	if decisions == nil {
+		return
+	}
+	if err := decisions.Append(decision); err != nil {
+		errorLog(ctx).Printf("Error writing decision log: %s\n", err.Error())
+	}
+}
+
+// closeDecisionLog flushes buffered decisions to disk.
+func closeDecisionLog() error {
+	if decisions == nil {
+		return nil
+	}
+	return decisions.Close()
+}
+
+// recordOriginalFrequencies remembers the current scaling_max_freq of every
+// CPU unless it was recorded by a previous run.
+func recordOriginalFrequencies() {
+	if len(state.OriginalFrequencies) != 0 {
+		return
+	}
+	state.OriginalFrequencies = make(map[int]int)
+	for _, i := range hostCPUs() {
+		content, err := actuator.ReadFile(sysfs, cpuPath(i, "cpufreq", "scaling_max_freq"))
+		if err != nil {
+			continue
+		}
+		if f, err := strconv.Atoi(strings.TrimSpace(content)); err == nil {
+			state.OriginalFrequencies[i] = f
+		}
+	}
+}
+
+// restoreFrequencies writes back the recorded original frequencies. The
+// targets epcp wrote and those other agents set are forgotten, so that
+// checkDrift does not take the restored frequencies for external changes.
+func restoreFrequencies() {
+	var cpus []int
+	var writes []actuator.Write
+	for cpu, frequency := range state.OriginalFrequencies {
+		cpus = append(cpus, cpu)
+		writes = append(writes, actuator.Write{Path: cpuPath(cpu, "cpufreq", "scaling_max_freq"), Value: strconv.Itoa(frequency)})
+	}
+	for i, err := range frequencyActuator.Apply(context.Background(), writes) {
+		if err != nil {
+			errorLogger.Printf("Error writing frequency %s to path %s: %s\n", writes[i].Value, writes[i].Path, err.Error())
+		} else {
+			infoLogger.Printf("Restored cpu%d to frequency %s\n", cpus[i], writes[i].Value)
+		}
+	}
+	state.OriginalFrequencies = nil
+	state.AppliedTargets = nil
+	state.ExternalFrequencies = nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/peer"
+)
+
+// cycleStatus is the in-memory view of the daemon served by the status
+// endpoints. Handlers only read it and never trigger OTE calls.
+type cycleStatus struct {
+	mu          sync.Mutex
+	started     time.Time
+	lastCycle   time.Time
+	lastFetch   time.Time
+	nextCycle   time.Time
+	prices      []float64
+	decision    *Decision
+	frequencies map[int]int
+	schedule    *damSchedule
+	energy      energyDays
+	channels    map[string]channelStatus
+}
+
+var status = &cycleStatus{started: time.Now(), frequencies: make(map[int]int)}
+
+// update records the outcome of a finished cycle.
+func (s *cycleStatus) update(result *cycleResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCycle = time.Now()
+	if len(result.Prices) != 0 {
+		s.lastFetch = s.lastCycle
+		s.prices = result.Prices
+	}
+	if decision := result.Decision; decision != nil {
+		s.decision = decision
+		for _, cpu := range decision.Summary.Succeeded {
+			s.frequencies[cpu] = decision.cpuFrequency(cpu)
+		}
+	}
+}
+
+// setEnergy records the energy measured by RAPL.
+func (s *cycleStatus) setEnergy(energy energyDays) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.energy = energy
+}
+
+// setNextCycle records when the daemon runs the next cycle.
+func (s *cycleStatus) setNextCycle(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextCycle = t
+}
+
+// setChannel records the outcome of the last cycle of the channel.
+func (s *cycleStatus) setChannel(name string, channel channelStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.channels == nil {
+		s.channels = make(map[string]channelStatus)
+	}
+	s.channels[name] = channel
+}
+
+// setSchedule records the day-ahead schedule of the next day.
+func (s *cycleStatus) setSchedule(schedule *damSchedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule = schedule
+}
+
+type statusResponse struct {
+	Prices      []float64    `json:"prices"`
+	Decision    *Decision    `json:"decision"`
+	Frequencies map[int]int  `json:"frequencies"`
+	LastCycle   *time.Time   `json:"lastCycle"`
+	LastFetch   *time.Time   `json:"lastFetch"`
+	FetchAge    string       `json:"fetchAge,omitempty"`
+	Schedule    *damSchedule `json:"schedule,omitempty"`
+	// DayAhead are the day-ahead prices of today and tomorrow, see
+	// watchPublication
+	DayAhead dayAheadStatus `json:"dayAhead"`
+	// NextCycle is when the daemon runs the next cycle, with the offset and
+	// the jitter, see runLoop
+	NextCycle *time.Time `json:"nextCycle,omitempty"`
+	// Sources is the state of the failover sources, if configured
+	Sources *sourcesStatus `json:"sources,omitempty"`
+	// Channels are the outcomes of the last cycle by channel, electricity
+	// included, when channels are configured, see runChannels
+	Channels map[string]channelStatus `json:"channels,omitempty"`
+	// Energy is the energy measured by RAPL per day and band
+	Energy     energyDays `json:"energy,omitempty"`
+	Goroutines int        `json:"goroutines"`
+	HeapAlloc  uint64     `json:"heapAlloc"`
+	Build      buildInfo  `json:"build"`
+	// Timezone is how the market timezone was resolved, see logTimezone
+	Timezone timezoneStatus `json:"timezone"`
+	// Config is the effective configuration, see newConfigView
+	Config map[string]any `json:"config"`
+}
+
+func (s *cycleStatus) snapshot() statusResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := statusResponse{
+		Prices:      append([]float64(nil), s.prices...),
+		Decision:    s.decision,
+		Frequencies: make(map[int]int, len(s.frequencies)),
+		Schedule:    s.schedule,
+		Energy:      s.energy,
+		DayAhead:    dayAhead.current(cycleClock.Now()),
+		Goroutines:  runtime.NumGoroutine(),
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	res.HeapAlloc = mem.HeapAlloc
+	res.Build = getBuildInfo()
+	res.Timezone = getTimezoneStatus()
+	res.Config = configView
+	for cpu, f := range s.frequencies {
+		res.Frequencies[cpu] = f
+	}
+	if len(s.channels) != 0 {
+		res.Channels = maps.Clone(s.channels)
+	}
+	if sourceFailover != nil {
+		res.Sources = &sourcesStatus{Active: sourceFailover.Active(), Health: sourceFailover.Health()}
+	}
+	if !s.lastCycle.IsZero() {
+		t := s.lastCycle
+		res.LastCycle = &t
+	}
+	if !s.nextCycle.IsZero() {
+		t := s.nextCycle
+		res.NextCycle = &t
+	}
+	if !s.lastFetch.IsZero() {
+		t := s.lastFetch
+		res.LastFetch = &t
+		res.FetchAge = time.Since(t).Round(time.Second).String()
+	}
+	return res
+}
+
+// healthy reports why the daemon is unhealthy, or nil.
+func (s *cycleStatus) healthy(interval time.Duration) error {
+	s.mu.Lock()
+	last := s.lastCycle
+	if last.IsZero() {
+		last = s.started
+	}
+	s.mu.Unlock()
+	if age := time.Since(last); age > 2*interval {
+		return fmt.Errorf("last cycle %s ago", age.Round(time.Second))
+	}
+	if simulate {
+		return nil
+	}
+	path := cpuPath(0, "cpufreq", "scaling_max_freq")
+	if err := actuator.Writable(path); err != nil {
+		return fmt.Errorf("%s is not writable: %w", path, err)
+	}
+	return nil
+}
+
+func statusHandler(interval time.Duration) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := status.healthy(interval); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		// Only OpenMetrics carries the exemplars
+		if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+			metrics.writeOpenMetrics(w)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.write(w)
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status.snapshot())
+	})
+	mux.HandleFunc("/sensor", serveSensor)
+	prices := peer.Handler(fetchedPrices.latest, interval, signingKey())
+	mux.HandleFunc("/prices", func(w http.ResponseWriter, r *http.Request) {
+		if day := r.URL.Query().Get("day"); day != "" && r.Method == http.MethodGet {
+			serveDayAhead(w, day)
+			return
+		}
+		if !servePrices {
+			http.NotFound(w, r)
+			return
+		}
+		prices.ServeHTTP(w, r)
+	})
+	return mux
+}
+
+// serveHTTP serves handler on addr until ctx is done.
+func serveHTTP(ctx context.Context, name, addr string, handler http.Handler) {
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	infoLogger.Printf("Serving %s on %s\n", name, addr)
+	if err := server.ListenAndServe(); err != nil && !e.Is(err, http.ErrServerClosed) {
+		errorLogger.Printf("Error serving %s: %s\n", name, err.Error())
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// countingSource is a price source counting the calls to the wrapped one.
+type countingSource struct {
+	ote.PriceSource
+	calls atomic.Int32
+}
+
+func (s *countingSource) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	s.calls.Add(1)
+	return s.PriceSource.ImPrices(ctx, day, fromHour, toHour)
+}
+
+func (s *countingSource) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	s.calls.Add(1)
+	return s.PriceSource.DamPrices(ctx, from, to)
+}
+
+// get returns the status code and the body of the response of handler to a
+// GET of path.
+func get(t *testing.T, handler http.Handler, path string) (int, string) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	body, err := io.ReadAll(recorder.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recorder.Code, string(body)
+}
+
+func TestStatusEndpoints(t *testing.T) {
+	source := &countingSource{PriceSource: trend(time.Now(), 10)}
+	runOnMocks(t, source)
+	captureLogs(t)
+	setGlobal(t, &simulate, true)
+	setGlobal(t, &status, &cycleStatus{started: time.Now(), frequencies: make(map[int]int)})
+	handler := statusHandler(time.Hour)
+
+	// Healthy before the first cycle, within the interval of the start
+	if code, body := get(t, handler, "/healthz"); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("/healthz before the first cycle: %d %q, want 200 ok", code, body)
+	}
+	code, body := get(t, handler, "/status")
+	var res statusResponse
+	if err := json.Unmarshal([]byte(body), &res); code != http.StatusOK || err != nil {
+		t.Fatalf("/status: %d %v:\n%s", code, err, body)
+	}
+	if res.Build != getBuildInfo() {
+		t.Errorf("/status build %+v, want %+v", res.Build, getBuildInfo())
+	}
+	if res.Decision != nil || res.LastCycle != nil || len(res.Prices) != 0 {
+		t.Errorf("/status before the first cycle: decision %v at %v of %v, want none", res.Decision, res.LastCycle, res.Prices)
+	}
+
+	runCycle(context.Background())
+	calls := source.calls.Load()
+	code, body = get(t, handler, "/status")
+	res = statusResponse{}
+	if err := json.Unmarshal([]byte(body), &res); code != http.StatusOK || err != nil {
+		t.Fatalf("/status: %d %v:\n%s", code, err, body)
+	}
+	if res.Decision == nil || res.Decision.Band != policy.Expensive || res.LastCycle == nil || res.LastFetch == nil {
+		t.Errorf("/status after a cycle: decision %v at %v, want expensive:\n%s", res.Decision, res.LastCycle, body)
+	}
+	if len(res.Prices) == 0 || res.Frequencies[0] != 800000 || res.Frequencies[1] != 800000 {
+		t.Errorf("/status after a cycle: prices %v, frequencies %v, want CPUs 0 and 1 at 800000", res.Prices, res.Frequencies)
+	}
+	get(t, handler, "/healthz")
+	if n := source.calls.Load(); n != calls {
+		t.Errorf("the endpoints called OTE %d times", n-calls)
+	}
+
+	// Unhealthy once the cycles stop for two intervals
+	status.mu.Lock()
+	status.lastCycle = time.Now().Add(-3 * time.Hour)
+	status.mu.Unlock()
+	if code, body := get(t, handler, "/healthz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "last cycle 3h0m0s ago") {
+		t.Errorf("/healthz after the cycles stopped: %d %q, want 503", code, body)
+	}
+}
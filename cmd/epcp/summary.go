@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// applySummary aggregates the per-CPU outcome of applying a decision.
+type applySummary struct {
+	Succeeded []int `json:"succeeded"`
+	// Unchanged CPUs, also among Succeeded, already had the frequency and
+	// were not written
+	Unchanged []int `json:"unchanged,omitempty"`
+	// Failed maps the CPUs that rejected the write to the error class
+	Failed map[int]string `json:"failed,omitempty"`
+	// Skipped CPUs are offline
+	Skipped []int `json:"skipped,omitempty"`
+	// External CPUs keep the frequency another agent set, see checkDrift
+	External []int `json:"external,omitempty"`
+}
+
+func (s *applySummary) succeed(cpu int) {
+	s.Succeeded = append(s.Succeeded, cpu)
+}
+
+func (s *applySummary) keep(cpu int) {
+	s.succeed(cpu)
+	s.Unchanged = append(s.Unchanged, cpu)
+}
+
+func (s *applySummary) fail(cpu int, err error) {
+	if s.Failed == nil {
+		s.Failed = make(map[int]string)
+	}
+	s.Failed[cpu] = actuator.ErrorClass(err)
+}
+
+func (s *applySummary) skip(cpu int) {
+	s.Skipped = append(s.Skipped, cpu)
+}
+
+func (s *applySummary) leave(cpu int) {
+	s.External = append(s.External, cpu)
+}
+
+// String returns the one-line summary logged after applying a decision.
+func (s applySummary) String() string {
+	line := fmt.Sprintf("%d succeeded, %d failed, %d skipped", len(s.Succeeded), len(s.Failed), len(s.Skipped))
+	if len(s.Unchanged) != 0 {
+		line = fmt.Sprintf("%d succeeded (%d unchanged), %d failed, %d skipped", len(s.Succeeded), len(s.Unchanged), len(s.Failed), len(s.Skipped))
+	}
+	if len(s.External) != 0 {
+		line += fmt.Sprintf(", %d left to another agent", len(s.External))
+	}
+	if len(s.Failed) == 0 {
+		return line
+	}
+	classes := make(map[string][]int)
+	for cpu, class := range s.Failed {
+		classes[class] = append(classes[class], cpu)
+	}
+	var parts []string
+	for class, cpus := range classes {
+		slices.Sort(cpus)
+		parts = append(parts, fmt.Sprintf("%s: %v", class, cpus))
+	}
+	slices.Sort(parts)
+	return line + " (" + strings.Join(parts, ", ") + ")"
+}
+
+// cpuOnline reports whether the CPU is online; CPUs without the online file
+// (usually cpu0) cannot be taken offline.
+func cpuOnline(cpu int) bool {
+	content, err := actuator.ReadFile(sysfs, cpuPath(cpu, "online"))
+	if err != nil {
+		return true
+	}
+	return strings.TrimSpace(content) != "0"
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// readOnlyFS fails the writes of the read-only paths with EACCES, as the
+// files of CPUs whose frequency the firmware controls do.
+type readOnlyFS struct {
+	actuator.Filesystem
+	readOnly map[string]bool
+}
+
+func (f readOnlyFS) Write(path string, data []byte) error {
+	if f.readOnly[path] {
+		return &fs.PathError{Op: "open", Path: path, Err: syscall.EACCES}
+	}
+	return f.Filesystem.Write(path, data)
+}
+
+func (f readOnlyFS) Stat(path string) (fs.FileInfo, error) {
+	info, err := f.Filesystem.Stat(path)
+	if err != nil || !f.readOnly[path] {
+		return info, err
+	}
+	return readOnlyInfo{info}, nil
+}
+
+// readOnlyInfo is the fs.FileInfo of a read-only file.
+type readOnlyInfo struct {
+	fs.FileInfo
+}
+
+func (readOnlyInfo) Mode() fs.FileMode {
+	return 0444
+}
+
+func TestApplyDecisionScalesEveryCPU(t *testing.T) {
+	tree := simulatedSysfs(t, 4)
+	decision := &Decision{Band: policy.Expensive, Frequency: 800000}
+	applyDecision(context.Background(), decision)
+
+	for cpu := 0; cpu < 4; cpu++ {
+		if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != "800000" {
+			t.Errorf("cpu%d: scaling_max_freq %s, want 800000", cpu, got)
+		}
+	}
+	if want := []int{0, 1, 2, 3}; !slices.Equal(decision.Summary.Succeeded, want) {
+		t.Errorf("succeeded %v, want %v", decision.Summary.Succeeded, want)
+	}
+	if len(state.OriginalFrequencies) != 4 {
+		t.Errorf("recorded the original frequencies of %v, want all 4 CPUs", state.OriginalFrequencies)
+	}
+
+	restoreFrequencies()
+	for cpu := 0; cpu < 4; cpu++ {
+		if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != "3200000" {
+			t.Errorf("cpu%d: restored %s, want 3200000", cpu, got)
+		}
+	}
+}
+
+func TestApplySummary(t *testing.T) {
+	files := sysfsFiles(4)
+	files[actuator.CPUPath("/sys", 3, "online")] = "0\n"
+	useSysfs(t, readOnlyFS{actuator.NewMemFS(files), map[string]bool{
+		actuator.CPUPath("/sys", 1, "cpufreq", "scaling_max_freq"): true,
+	}})
+
+	decision := &Decision{Band: policy.Expensive, Frequency: 1600000}
+	applyDecision(context.Background(), decision)
+	summary := decision.Summary
+	if want := []int{0, 2}; !slices.Equal(summary.Succeeded, want) {
+		t.Errorf("succeeded %v, want %v", summary.Succeeded, want)
+	}
+	if want := map[int]string{1: "permission"}; len(summary.Failed) != 1 || summary.Failed[1] != want[1] {
+		t.Errorf("failed %v, want %v", summary.Failed, want)
+	}
+	if want := []int{3}; !slices.Equal(summary.Skipped, want) {
+		t.Errorf("skipped %v, want %v", summary.Skipped, want)
+	}
+	if got, want := summary.String(), "2 succeeded, 1 failed, 1 skipped (permission: [1])"; got != want {
+		t.Errorf("summary %q, want %q", got, want)
+	}
+
+	result := &cycleResult{Prices: []float64{1, 2, 3}, Decision: decision}
+	if code := result.exitCode(); code != exitOK {
+		t.Errorf("exit code %d with some CPUs scaled, want %d", code, exitOK)
+	}
+	setGlobal(t, &strict, true)
+	if code := result.exitCode(); code != exitApplyFailed {
+		t.Errorf("exit code %d with a failed CPU in strict mode, want %d", code, exitApplyFailed)
+	}
+}
+
+func TestApplySummaryNoCPUScaled(t *testing.T) {
+	summary := applySummary{Failed: map[int]string{0: "missing", 1: "permission", 2: "permission"}}
+	result := &cycleResult{Prices: []float64{1, 2, 3}, Decision: &Decision{Summary: summary}}
+	if code := result.exitCode(); code != exitApplyFailed {
+		t.Errorf("exit code %d with no CPU scaled, want %d", code, exitApplyFailed)
+	}
+	if got, want := summary.String(), "0 succeeded, 3 failed, 0 skipped (missing: [0], permission: [1 2])"; got != want {
+		t.Errorf("summary %q, want %q", got, want)
+	}
+}
+
+func TestApplyDecisionSkipsUnchanged(t *testing.T) {
+	tree := simulatedSysfs(t, 4)
+	logs := captureLogs(t)
+	applyDecision(context.Background(), &Decision{Band: policy.Expensive, Frequency: 800000})
+	if n := len(tree.Writes()); n != 4 {
+		t.Fatalf("%d writes, want 4", n)
+	}
+	unchanged := func(want string) {
+		t.Helper()
+		var exposition strings.Builder
+		metrics.write(&exposition)
+		if !strings.Contains(exposition.String(), "epcp_unchanged_writes_total "+want+"\n") {
+			t.Errorf("metrics without %s unchanged writes:\n%s", want, exposition.String())
+		}
+	}
+
+	// A cycle deciding the same frequency writes nothing
+	decision := applyDecision(context.Background(), &Decision{Band: policy.Expensive, Frequency: 800000})
+	if n := len(tree.Writes()); n != 4 {
+		t.Errorf("%d writes on a no-op cycle, want none", n-4)
+	}
+	if want := []int{0, 1, 2, 3}; !slices.Equal(decision.Summary.Unchanged, want) || !slices.Equal(decision.Summary.Succeeded, want) {
+		t.Errorf("unchanged %v, succeeded %v, want %v", decision.Summary.Unchanged, decision.Summary.Succeeded, want)
+	}
+	if got, want := decision.Summary.String(), "4 succeeded (4 unchanged), 0 failed, 0 skipped"; got != want {
+		t.Errorf("summary %q, want %q", got, want)
+	}
+	if !strings.Contains(logs.String(), "Scaling to frequency 800000: 4 succeeded (4 unchanged), 0 failed, 0 skipped\n") {
+		t.Errorf("the summary not logged:\n%s", logs)
+	}
+	unchanged("4")
+
+	// Only the CPU another agent changed is written again
+	if err := tree.Write(cpuPath(2, "cpufreq", "scaling_max_freq"), []byte("2400000")); err != nil {
+		t.Fatal(err)
+	}
+	before := len(tree.Writes())
+	decision = applyDecision(context.Background(), &Decision{Band: policy.Expensive, Frequency: 800000})
+	if writes := tree.Writes()[before:]; len(writes) != 1 || writes[0].Path != cpuPath(2, "cpufreq", "scaling_max_freq") {
+		t.Errorf("writes %v, want only cpu2", writes)
+	}
+	if want := []int{0, 1, 3}; !slices.Equal(decision.Summary.Unchanged, want) {
+		t.Errorf("unchanged %v, want %v", decision.Summary.Unchanged, want)
+	}
+	unchanged("7")
+}
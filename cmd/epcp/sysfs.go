@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/burn"
+)
+
+var (
+	// sysfsRoot is where sysfs is mounted, /sys unless EPCP_SYSFS_ROOT is set.
+	sysfsRoot = "/sys"
+	// sysfs is the filesystem the sysfs files are accessed through, replaced
+	// by a simulated tree when no cpufreq interface is available.
+	sysfs actuator.Filesystem = actuator.OSFS{}
+)
+
+// sysfsPath returns the path of a sysfs file given relative to sysfsRoot.
+func sysfsPath(elem ...string) string {
+	return actuator.Path(sysfsRoot, elem...)
+}
+
+// cpuPath returns the path of a file in the sysfs directory of the CPU,
+// e.g. cpuPath(0, "cpufreq", "scaling_max_freq").
+func cpuPath(cpu int, elem ...string) string {
+	return actuator.CPUPath(sysfsRoot, cpu, elem...)
+}
+
+// hostCPUs returns the numbers of the CPUs present on the host, which are
+// the CPUs scaled. Unlike runtime.NumCPU, they include the CPUs outside the
+// affinity mask or cpuset of the process, and may not be contiguous. They
+// are read from the present file, or listed from the cpuN directories
+// without it; without sysfs, as on other platforms, they are cpu0 to cpuN-1
+// of runtime.NumCPU.
+func hostCPUs() []int {
+	if content, err := actuator.ReadFile(sysfs, sysfsPath("devices", "system", "cpu", "present")); err == nil {
+		if cpus, err := burn.ParseCPUs(strings.TrimSpace(content)); err == nil {
+			return cpus
+		}
+	}
+	paths, _ := sysfs.Glob(sysfsPath("devices", "system", "cpu", "cpu[0-9]*"))
+	var cpus []int
+	for _, path := range paths {
+		if cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "cpu")); err == nil {
+			cpus = append(cpus, cpu)
+		}
+	}
+	if len(cpus) == 0 {
+		for cpu := range runtime.NumCPU() {
+			cpus = append(cpus, cpu)
+		}
+	}
+	slices.Sort(cpus)
+	return cpus
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// sparseSysfsFiles returns the files of sysfsFiles of the given CPUs only.
+func sparseSysfsFiles(cpus ...int) map[string]string {
+	all := sysfsFiles(slices.Max(cpus) + 1)
+	files := make(map[string]string)
+	for _, cpu := range cpus {
+		for _, name := range []string{"scaling_available_frequencies", "scaling_max_freq", "scaling_min_freq"} {
+			path := actuator.CPUPath("/sys", cpu, "cpufreq", name)
+			files[path] = all[path]
+		}
+	}
+	return files
+}
+
+func TestHostCPUs(t *testing.T) {
+	tests := []struct {
+		name    string
+		cpus    []int
+		present string
+		want    []int
+	}{
+		{"present", []int{0, 1, 2, 3}, "0-3\n", []int{0, 1, 2, 3}},
+		{"present list", []int{0, 1, 4, 6, 7}, "0-1,4,6-7\n", []int{0, 1, 4, 6, 7}},
+		{"directories", []int{0, 2, 5}, "", []int{0, 2, 5}},
+		{"invalid present", []int{0, 3}, "none\n", []int{0, 3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := sparseSysfsFiles(test.cpus...)
+			// The cpufreq and cpuidle directories are not CPUs
+			files["/sys/devices/system/cpu/cpufreq/boost"] = "1\n"
+			files["/sys/devices/system/cpu/cpuidle/current_driver"] = "intel_idle\n"
+			if test.present != "" {
+				files["/sys/devices/system/cpu/present"] = test.present
+			}
+			useSysfs(t, actuator.NewMemFS(files))
+			if got := hostCPUs(); !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyDecisionNonContiguousCPUs(t *testing.T) {
+	files := sparseSysfsFiles(0, 2, 5)
+	files["/sys/devices/system/cpu/present"] = "0,2,5\n"
+	tree := actuator.NewMemFS(files)
+	useSysfs(t, tree)
+
+	decision := &Decision{Band: policy.Expensive, Frequency: 800000}
+	applyDecision(context.Background(), decision)
+	for _, cpu := range []int{0, 2, 5} {
+		if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != "800000" {
+			t.Errorf("cpu%d: scaling_max_freq %s, want 800000", cpu, got)
+		}
+	}
+	if want := []int{0, 2, 5}; !slices.Equal(decision.Summary.Succeeded, want) {
+		t.Errorf("succeeded %v, want %v", decision.Summary.Succeeded, want)
+	}
+	if len(decision.Summary.Failed) != 0 {
+		t.Errorf("failed %v, want none", decision.Summary.Failed)
+	}
+}
+
+func TestSysfsRoot(t *testing.T) {
+	root := tempSysfs(t, 4)
+	if got, want := sysfsPath("class", "powercap"), filepath.Join(root, "class", "powercap"); got != want {
+		t.Errorf("sysfsPath = %s, want %s", got, want)
+	}
+	if got := hostCPUs(); !slices.Equal(got, []int{0, 1, 2, 3}) {
+		t.Errorf("host CPUs %v, want 0 to 3", got)
+	}
+
+	decision := &Decision{Band: policy.Expensive, Frequency: 800000}
+	applyDecision(context.Background(), decision)
+	for cpu := 0; cpu < 4; cpu++ {
+		content, err := os.ReadFile(actuator.CPUPath(root, cpu, "cpufreq", "scaling_max_freq"))
+		if err != nil || strings.TrimSpace(string(content)) != "800000" {
+			t.Errorf("cpu%d: scaling_max_freq %q, %v under the root, want 800000", cpu, content, err)
+		}
+	}
+	if len(decision.Summary.Succeeded) != 4 {
+		t.Errorf("succeeded %v, want the 4 CPUs", decision.Summary.Succeeded)
+	}
+}
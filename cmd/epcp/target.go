@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// frequencyTarget is a frequency relative to the hardware of each CPU, so
+// that the same configuration fits machines with different frequency tables:
+// min, max, a percentage of cpuinfo_max_freq, or an absolute frequency with
+// its unit, kHz, MHz or GHz.
+type frequencyTarget struct {
+	text string
+	// percent of the maximum, for the percentage targets
+	percent float64
+	// khz is the absolute frequency, for those with a unit
+	khz int
+}
+
+// cpuTable is the frequency table of a CPU.
+type cpuTable struct {
+	min, max  int
+	available []int
+}
+
+var (
+	// bandTargets maps the bands to their target, see ApplyConfig; the
+	// bands without one get the lowest or highest available frequency
+	bandTargets map[string]frequencyTarget
+	// cpuTables caches the frequency table of each CPU, read once
+	cpuTables   = make(map[int]cpuTable)
+	cpuTablesMu sync.Mutex
+)
+
+// parseTarget parses min, max, a percentage like 60% or a frequency like
+// 2400000kHz, 2400MHz or 2.4GHz. A bare number is rejected for its missing
+// unit.
+func parseTarget(text string) (frequencyTarget, error) {
+	t := frequencyTarget{text: text}
+	value := strings.TrimSpace(strings.ToLower(text))
+	switch value {
+	case "min":
+		t.percent = 0
+		return t, nil
+	case "max":
+		t.percent = 100
+		return t, nil
+	}
+	if number, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return t, fmt.Errorf("invalid percentage %q, expected above 0%% and at most 100%%", text)
+		}
+		t.percent = percent
+		return t, nil
+	}
+	for _, unit := range []struct {
+		suffix string
+		khz    float64
+	}{{"khz", 1}, {"mhz", 1e3}, {"ghz", 1e6}} {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			f, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil || f <= 0 {
+				return t, fmt.Errorf("invalid frequency %q", text)
+			}
+			t.percent, t.khz = -1, int(math.Round(f*unit.khz))
+			return t, nil
+		}
+	}
+	return t, fmt.Errorf("invalid target %q, expected min, max, a percentage or a frequency in kHz, MHz or GHz", text)
+}
+
+// resolve returns the frequency of the target on a CPU with the table: the
+// percentage of its maximum, or the absolute frequency, within its limits and
+// snapped to the nearest available frequency.
+func (t frequencyTarget) resolve(table cpuTable) int {
+	frequency := t.khz
+	if t.percent >= 0 {
+		frequency = int(math.Round(float64(table.max) * t.percent / 100))
+	}
+	if table.max != 0 {
+		frequency = min(max(frequency, table.min), table.max)
+	}
+	return nearestFrequency(frequency, table.available)
+}
+
+// nearestFrequency returns the available frequency nearest to frequency, the
+// higher of two as near, or frequency without available frequencies.
+func nearestFrequency(frequency int, available []int) int {
+	if len(available) == 0 {
+		return frequency
+	}
+	nearest := available[0]
+	for _, f := range available[1:] {
+		d, best := abs(f-frequency), abs(nearest-frequency)
+		if d < best || d == best && f > nearest {
+			nearest = f
+		}
+	}
+	return nearest
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// readCPUTable returns the frequency table of the CPU from sysfs, cached.
+func readCPUTable(cpu int) cpuTable {
+	cpuTablesMu.Lock()
+	defer cpuTablesMu.Unlock()
+	if table, ok := cpuTables[cpu]; ok {
+		return table
+	}
+	frequency := func(name string) int {
+		content, _ := actuator.ReadFile(sysfs, cpuPath(cpu, "cpufreq", name))
+		f, _ := strconv.Atoi(strings.TrimSpace(content))
+		return f
+	}
+	table := cpuTable{min: frequency("cpuinfo_min_freq"), max: frequency("cpuinfo_max_freq")}
+	content, _ := actuator.ReadFile(sysfs, cpuPath(cpu, "cpufreq", "scaling_available_frequencies"))
+	for _, field := range strings.Fields(content) {
+		if f, err := strconv.Atoi(field); err == nil {
+			table.available = append(table.available, f)
+		}
+	}
+	if table.max == 0 && len(table.available) != 0 {
+		table.min, table.max = policy.Frequency(policy.Expensive, table.available), policy.Frequency(policy.Cheap, table.available)
+	}
+	cpuTables[cpu] = table
+	return table
+}
+
+// bandFrequency returns the frequency of the band on the first CPU: that of
+// its target, or the lowest available frequency for the expensive band and
+// the highest for the others.
+func bandFrequency(band string, available []int) int {
+	if target, ok := bandTargets[band]; ok {
+		return target.resolve(readCPUTable(0))
+	}
+	return policy.Frequency(band, available)
+}
+
+// setBand makes the decision decide the band, with its frequencies.
+func (d *Decision) setBand(band string, available []int) {
+	d.Band = band
+	d.Frequency = bandFrequency(band, available)
+	d.Nodes = nodeFrequencies(band, available)
+	d.Target = ""
+	if target, ok := bandTargets[band]; ok {
+		d.Target = target.text
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// The frequency tables of two machines of a mixed fleet.
+var (
+	tableA = cpuTable{min: 800000, max: 3200000, available: []int{800000, 1600000, 2400000, 3200000}}
+	tableB = cpuTable{min: 1000000, max: 3700000, available: []int{1000000, 1500000, 2200000, 2900000, 3700000}}
+)
+
+func TestParseTarget(t *testing.T) {
+	for _, text := range []string{"min", "MAX", "60%", "100 %", "2400000kHz", "2400MHz", "2.4GHz", " 1.8 ghz"} {
+		if _, err := parseTarget(text); err != nil {
+			t.Errorf("%q: %v", text, err)
+		}
+	}
+	for _, text := range []string{"", "2400", "0%", "101%", "-5%", "fast%", "0MHz", "2.4THz"} {
+		if _, err := parseTarget(text); err == nil {
+			t.Errorf("%q accepted", text)
+		}
+	}
+}
+
+func TestResolveTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		// a and b are the frequencies resolved on the machines
+		a, b int
+	}{
+		{"min", 800000, 1000000},
+		{"max", 3200000, 3700000},
+		{"60%", 1600000, 2200000},
+		// 1850000 is as near to 1500000 as to 2200000 on B
+		{"50%", 1600000, 2200000},
+		{"2.4GHz", 2400000, 2200000},
+		{"1800MHz", 1600000, 1500000},
+		// Beyond the limits of A
+		{"3700000kHz", 3200000, 3700000},
+	}
+	for _, test := range tests {
+		target, err := parseTarget(test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, b := target.resolve(tableA), target.resolve(tableB); a != test.a || b != test.b {
+			t.Errorf("%s: %d and %d, want %d and %d", test.target, a, b, test.a, test.b)
+		}
+	}
+}
+
+func TestApplyTargets(t *testing.T) {
+	// A node with a CPU of each machine
+	files := make(map[string]string)
+	for cpu, table := range []cpuTable{tableA, tableB} {
+		files[actuator.CPUPath("/sys", cpu, "cpufreq", "cpuinfo_min_freq")] = strconv.Itoa(table.min) + "\n"
+		files[actuator.CPUPath("/sys", cpu, "cpufreq", "cpuinfo_max_freq")] = strconv.Itoa(table.max) + "\n"
+		available := ""
+		for _, f := range table.available {
+			available += strconv.Itoa(f) + " "
+		}
+		files[actuator.CPUPath("/sys", cpu, "cpufreq", "scaling_available_frequencies")] = available + "\n"
+		files[actuator.CPUPath("/sys", cpu, "cpufreq", "scaling_max_freq")] = strconv.Itoa(table.max) + "\n"
+		files[actuator.CPUPath("/sys", cpu, "cpufreq", "scaling_min_freq")] = strconv.Itoa(table.min) + "\n"
+	}
+	tree := actuator.NewMemFS(files)
+	useSysfs(t, tree)
+	sixty, err := parseTarget("60%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setGlobal(t, &bandTargets, map[string]frequencyTarget{policy.Expensive: sixty})
+
+	decision := new(Decision)
+	decision.setBand(policy.Expensive, availableFrequencies())
+	if decision.Target != "60%" || decision.Frequency != 1600000 {
+		t.Errorf("decision %+v, want 60%% resolved on cpu0", decision)
+	}
+	applyDecision(context.Background(), decision)
+	for cpu, want := range []string{"1600000", "2200000"} {
+		if got := readSysfs(t, tree, cpuPath(cpu, "cpufreq", "scaling_max_freq")); got != want {
+			t.Errorf("cpu%d: scaling_max_freq %s, want %s", cpu, got, want)
+		}
+	}
+
+	// The band without a target runs at the highest available frequency
+	decision.setBand(policy.Cheap, availableFrequencies())
+	applyDecision(context.Background(), decision)
+	if decision.Target != "" || decision.Frequency != 3200000 {
+		t.Errorf("decision %+v, want the highest frequency", decision)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import "github.com/CERIT-SC/epcp-simulator/internal/ote"
+
+// timezoneStatus is how the market timezone was resolved, in /status.
+type timezoneStatus struct {
+	Name       string `json:"name"`
+	Resolution string `json:"resolution"`
+}
+
+func getTimezoneStatus() timezoneStatus {
+	how, _ := ote.Resolution()
+	return timezoneStatus{Name: ote.Timezone, Resolution: how}
+}
+
+// logTimezone logs how the market timezone was resolved when the system
+// time zone database lacks it, prominently when only the EU rules are left:
+// they hold for the recent years, but not for the history before them.
+func logTimezone() {
+	how, err := ote.Resolution()
+	switch how {
+	case ote.ResolutionEmbedded:
+		infoLogger.Printf("Using the embedded time zone database for %s (%s)\n", ote.Timezone, err.Error())
+	case ote.ResolutionFixed:
+		errorLogger.Printf("WARNING: no time zone database has %s (%s), assuming CET/CEST by the EU rules; install tzdata\n", ote.Timezone, err.Error())
+	}
+}
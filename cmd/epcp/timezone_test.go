@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+func TestTimezoneStatus(t *testing.T) {
+	logs := captureLogs(t)
+	setGlobal(t, &status, &cycleStatus{started: time.Now(), frequencies: make(map[int]int)})
+	_, body := get(t, statusHandler(time.Hour), "/status")
+	var res statusResponse
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatalf("/status: %v:\n%s", err, body)
+	}
+	how, _ := ote.Resolution()
+	if want := (timezoneStatus{Name: ote.Timezone, Resolution: how}); res.Timezone != want {
+		t.Errorf("/status timezone %+v, want %+v", res.Timezone, want)
+	}
+
+	// Resolved from the system, nothing to warn about
+	logTimezone()
+	if how == ote.ResolutionSystem && logs.String() != "" {
+		t.Errorf("logged the system time zone:\n%s", logs)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type runIDKey struct{}
+
+// cycleLoggers are infoLogger and errorLogger of a cycle, see withRunID.
+type cycleLoggers struct {
+	info, errors *log.Logger
+}
+
+type cycleLoggersKey struct{}
+
+// withRunID returns a context carrying the run identifier of a cycle, and
+// loggers adding it to the prefix of the lines logged in the cycle, see
+// infoLog and errorLog. The package loggers are left alone, as other
+// goroutines log through them meanwhile.
+func withRunID(ctx context.Context, runID string) context.Context {
+	ctx = context.WithValue(ctx, runIDKey{}, runID)
+	derive := func(l *log.Logger) *log.Logger {
+		return log.New(l.Writer(), l.Prefix()+"run="+runID+" ", l.Flags())
+	}
+	return context.WithValue(ctx, cycleLoggersKey{}, cycleLoggers{info: derive(infoLogger), errors: derive(errorLogger)})
+}
+
+// infoLog returns the info logger of the cycle of ctx, infoLogger outside
+// of a cycle.
+func infoLog(ctx context.Context) *log.Logger {
+	if loggers, ok := ctx.Value(cycleLoggersKey{}).(cycleLoggers); ok {
+		return loggers.info
+	}
+	return infoLogger
+}
+
+// errorLog returns the error logger of the cycle of ctx, errorLogger
+// outside of a cycle.
+func errorLog(ctx context.Context) *log.Logger {
+	if loggers, ok := ctx.Value(cycleLoggersKey{}).(cycleLoggers); ok {
+		return loggers.errors
+	}
+	return errorLogger
+}
+
+// runIDFrom returns the run identifier carried by ctx, if any.
+func runIDFrom(ctx context.Context) string {
+	runID, _ := ctx.Value(runIDKey{}).(string)
+	return runID
+}
+
+// runIDTransport adds the run identifier of the request context as the
+// X-EPCP-Run-ID header to the requests it passes to base.
+type runIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t runIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if runID := runIDFrom(req.Context()); runID != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("X-EPCP-Run-ID", runID)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// wrapRunID wraps transport in a runIDTransport, for the clients dialing
+// their own way, such as the one of Docker.
+func wrapRunID(transport http.RoundTripper) http.RoundTripper {
+	return runIDTransport{base: transport}
+}
+
+// newHTTPClient returns a client sending the requests through transport,
+// http.DefaultTransport when nil, with the run identifier of their context.
+// Every outgoing client is made by it.
+func newHTTPClient(transport http.RoundTripper, timeout time.Duration) *http.Client {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &http.Client{Transport: wrapRunID(transport), Timeout: timeout}
+}
+
+// httpClient does the requests of the outputs, which limit them through
+// their context.
+var httpClient = newHTTPClient(nil, 0)
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ulidMu   sync.Mutex
+	lastULID [16]byte
+)
+
+// newULID returns a ULID: 48 bits of milliseconds followed by 80 random bits.
+// Within a millisecond, or when the clock steps back, the last ULID is
+// incremented instead, so the ULIDs are monotonic as the spec suggests.
+// https://github.com/ulid/spec
+func newULID(t time.Time) [16]byte {
+	var id [16]byte
+	ms := uint64(t.UnixMilli())
+	binary.BigEndian.PutUint16(id[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	ulidMu.Lock()
+	defer ulidMu.Unlock()
+	if bytes.Compare(id[:6], lastULID[:6]) > 0 {
+		rand.Read(id[6:])
+	} else {
+		id = lastULID
+		// An overflow of the random bits carries into the milliseconds
+		for i := len(id) - 1; i >= 0; i-- {
+			id[i]++
+			if id[i] != 0 {
+				break
+			}
+		}
+	}
+	lastULID = id
+	return id
+}
+
+// encodeULID returns the 26 character Crockford base32 form of the ULID.
+func encodeULID(id [16]byte) string {
+	var b strings.Builder
+	// 128 bits are encoded as 130 bits with two leading zero bits
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+	for i := 25; i >= 0; i-- {
+		shift := uint(i * 5)
+		var v uint64
+		switch {
+		case shift >= 64:
+			v = hi >> (shift - 64)
+		case shift > 59:
+			v = hi<<(64-shift) | lo>>shift
+		default:
+			v = lo >> shift
+		}
+		b.WriteByte(crockford[v&31])
+	}
+	return b.String()
+}
+
+// span is a timed phase of a cycle.
+type span struct {
+	name  string
+	id    [8]byte
+	start time.Time
+	end   time.Time
+}
+
+// cycleTrace collects the spans of one cycle; the ULID doubles as trace ID.
+type cycleTrace struct {
+	id    [16]byte
+	runID string
+	start time.Time
+	spans []span
+}
+
+func newCycleTrace() *cycleTrace {
+	now := time.Now()
+	id := newULID(now)
+	return &cycleTrace{id: id, runID: encodeULID(id), start: now}
+}
+
+func (t *cycleTrace) record(name string, start time.Time) {
+	s := span{name: name, start: start, end: time.Now()}
+	rand.Read(s.id[:])
+	t.spans = append(t.spans, s)
+}
+
+// exportTrace sends the spans to the OTLP/HTTP endpoint in the JSON encoding
+// when OTEL_EXPORTER_OTLP_ENDPOINT is set.
+// https://opentelemetry.io/docs/specs/otlp/#otlphttp
+func exportTrace(ctx context.Context, t *cycleTrace) {
+	if otlpEndpoint == "" {
+		return
+	}
+	hostname, _ := os.Hostname()
+	var root [8]byte
+	rand.Read(root[:])
+	traceID := hex.EncodeToString(t.id[:])
+	spans := []map[string]any{{
+		"traceId": traceID, "spanId": hex.EncodeToString(root[:]), "name": "cycle", "kind": 1,
+		"startTimeUnixNano": strconv.FormatInt(t.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(time.Now().UnixNano(), 10),
+		"attributes":        []map[string]any{{"key": "epcp.run_id", "value": map[string]string{"stringValue": t.runID}}},
+	}}
+	for _, s := range t.spans {
+		spans = append(spans, map[string]any{
+			"traceId": traceID, "spanId": hex.EncodeToString(s.id[:]), "parentSpanId": hex.EncodeToString(root[:]),
+			"name": s.name, "kind": 1,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		})
+	}
+	payload, err := json.Marshal(map[string]any{"resourceSpans": []any{map[string]any{
+		"resource": map[string]any{"attributes": []map[string]any{
+			{"key": "service.name", "value": map[string]string{"stringValue": "epcp-simulator"}},
+			{"key": "host.name", "value": map[string]string{"stringValue": hostname}},
+		}},
+		"scopeSpans": []any{map[string]any{"scope": map[string]string{"name": "epcp"}, "spans": spans}},
+	}}})
+	if err != nil {
+		errorLog(ctx).Printf("Error encoding trace: %s\n", err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	endpoint := strings.TrimSuffix(otlpEndpoint, "/") + "/v1/traces"
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		errorLog(ctx).Printf("Error exporting trace: %s\n", err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := httpClient.Do(req)
+	if err == nil {
+		res.Body.Close()
+		if res.StatusCode/100 != 2 {
+			err = fmt.Errorf("status %s", res.Status)
+		}
+	}
+	if err != nil {
+		errorLog(ctx).Printf("Error exporting trace: %s\n", err.Error())
+	}
+}
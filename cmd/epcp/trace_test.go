@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ulidTime decodes the milliseconds of the 10 leading characters of a ULID.
+func ulidTime(t *testing.T, ulid string) time.Time {
+	t.Helper()
+	var ms int64
+	for _, c := range ulid[:10] {
+		i := strings.IndexRune(crockford, c)
+		if i < 0 {
+			t.Fatalf("%s: %q is not a Crockford base32 character", ulid, c)
+		}
+		ms = ms<<5 | int64(i)
+	}
+	return time.UnixMilli(ms)
+}
+
+func TestULID(t *testing.T) {
+	now := time.Now()
+	// Within a millisecond, then with the clock stepping back and forth
+	times := []time.Time{now, now, now, now.Add(-time.Second), now, now.Add(time.Millisecond), now.Add(time.Second)}
+	for i := 0; i < 1000; i++ {
+		times = append(times, now.Add(time.Second))
+	}
+	previous := ""
+	for i, at := range times {
+		ulid := encodeULID(newULID(at))
+		if len(ulid) != 26 {
+			t.Fatalf("%s has %d characters, want 26", ulid, len(ulid))
+		}
+		if ulid[0] > '7' {
+			t.Errorf("%s overflows 128 bits", ulid)
+		}
+		if ulid <= previous {
+			t.Errorf("ULID %d %s does not sort after %s", i, ulid, previous)
+		}
+		if got := ulidTime(t, ulid); got.Before(at.Truncate(time.Millisecond)) || got.Sub(at) > time.Second {
+			t.Errorf("%s encodes %s, want %s", ulid, got, at)
+		}
+		previous = ulid
+	}
+}
+
+func TestRunID(t *testing.T) {
+	runOnMocks(t, trend(time.Now(), 10))
+	logs := captureLogs(t)
+	result := runCycle(context.Background())
+	if result.Decision == nil || len(result.Decision.RunID) != 26 {
+		t.Fatalf("decision %+v, want one with a ULID as run ID", result.Decision)
+	}
+	runID := result.Decision.RunID
+	// A goroutine logging after the cycle does not get its run ID
+	infoLogger.Println("background")
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("the cycle logged nothing:\n%s", logs)
+	}
+	for _, line := range lines[:len(lines)-1] {
+		if !strings.Contains(line, "run="+runID+" ") {
+			t.Errorf("cycle line %q lacks run=%s", line, runID)
+		}
+	}
+	if last := lines[len(lines)-1]; last != "INFO: background" {
+		t.Errorf("line logged after the cycle %q, want %q", last, "INFO: background")
+	}
+	ctx := withRunID(context.Background(), runID)
+	if runIDFrom(ctx) != runID || infoLog(ctx) == infoLogger || errorLog(ctx) == errorLogger {
+		t.Errorf("context of run %s carries run ID %q and the package loggers", runID, runIDFrom(ctx))
+	}
+	if infoLog(context.Background()) != infoLogger || errorLog(context.Background()) != errorLogger {
+		t.Error("context outside of a cycle does not carry the package loggers")
+	}
+}
+
+func TestRunIDHeader(t *testing.T) {
+	var runIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runIDs = append(runIDs, r.Header.Get("X-EPCP-Run-ID"))
+	}))
+	defer server.Close()
+	clients := map[string]*http.Client{
+		"outputs": httpClient,
+		"peer":    newHTTPClient(nil, peerTimeout),
+		"redfish": newPowerCap(ActuatorConfig{Type: "redfish", URL: server.URL, Insecure: true}).bmc.Client,
+	}
+	for name, client := range clients {
+		runIDs = nil
+		for _, ctx := range []context.Context{withRunID(context.Background(), "01J9"), context.Background()} {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("%s client: %s", name, err)
+			}
+			res.Body.Close()
+		}
+		if want := []string{"01J9", ""}; !slices.Equal(runIDs, want) {
+			t.Errorf("%s client sent the run IDs %q, want %q", name, runIDs, want)
+		}
+	}
+}
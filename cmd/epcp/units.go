@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// unitTimeout bounds the requests of a cycle to the systemd manager.
+const unitTimeout = 10 * time.Second
+
+var (
+	// unitQuotas scales the CPU quotas of the systemd units per band, see
+	// ActuatorConfig; it is nil without a systemd actuator
+	unitQuotas *unitTuner
+	// connectSystemBus connects the system bus, replaced in tests
+	connectSystemBus = dbusSystemBus
+)
+
+// systemBus is the connection to the system bus the systemd actuator uses;
+// *dbus.Conn implements it.
+type systemBus interface {
+	actuator.SystemdBus
+	Close() error
+}
+
+func dbusSystemBus() (systemBus, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+type unitTuner struct {
+	systemd actuator.Systemd
+	// conn is the connection to the system bus, nil until connected
+	conn  systemBus
+	units []string
+	// factors maps the bands to the factor of the original quotas, none for
+	// the bands running the units unchanged
+	factors map[string]float64
+	// simulated is the factor of a dry run or a simulation, see wouldScale
+	simulated float64
+	// unknown holds the units systemd has no definition of, reported once
+	unknown map[string]bool
+}
+
+func newUnitTuner(a ActuatorConfig) *unitTuner {
+	return &unitTuner{units: a.Units, factors: a.Shares, unknown: make(map[string]bool)}
+}
+
+// applyUnitQuotas scales the quotas of the units for the decided band, or
+// restores them when the band has no factor. The system bus is connected on
+// the first use and again after a failure; a failing unit does not keep the
+// others from being tuned, and the units systemd does not know are skipped.
+// It reports whether it set any quotas.
+func applyUnitQuotas(ctx context.Context, result *cycleResult) (bool, error) {
+	if unitQuotas == nil || paused.Load() || result.Decision.suspended() {
+		return false, nil
+	}
+	factor, scaled := unitQuotas.factors[result.Decision.Band]
+	if dryRun || simulate {
+		if !wouldScale(&unitQuotas.simulated, factor, scaled) {
+			return false, nil
+		}
+		if scaled {
+			infoLog(ctx).Printf("Would scale the CPU quotas of the systemd units by %g\n", factor)
+		} else {
+			infoLog(ctx).Println("Would restore the CPU quotas of the systemd units")
+		}
+		return true, nil
+	}
+	if err := unitQuotas.connect(); err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unitTimeout)
+	defer cancel()
+	failed, written := 0, false
+	for _, unit := range unitQuotas.units {
+		if unitQuotas.conn == nil {
+			// The connection failed on a previous unit
+			failed++
+			continue
+		}
+		var set bool
+		var err error
+		if scaled {
+			set, err = unitQuotas.scale(ctx, unit, factor)
+		} else {
+			set, err = unitQuotas.restore(ctx, unit)
+		}
+		if err != nil && !e.Is(err, actuator.ErrUnknownUnit) {
+			failed++
+		}
+		written = written || set
+	}
+	if failed != 0 {
+		return written, fmt.Errorf("%d of %d units failed", failed, len(unitQuotas.units))
+	}
+	return written, nil
+}
+
+// restoreUnitQuotas writes back the original quotas of the units, on exit.
+func restoreUnitQuotas() {
+	if unitQuotas == nil || dryRun || simulate || len(state.OriginalQuotas) == 0 || unitQuotas.connect() != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), unitTimeout)
+	defer cancel()
+	for unit := range state.OriginalQuotas {
+		if unitQuotas.conn == nil {
+			return
+		}
+		unitQuotas.restore(ctx, unit)
+	}
+}
+
+// connect connects the system bus unless it is connected.
+func (t *unitTuner) connect() error {
+	if t.conn != nil {
+		return nil
+	}
+	conn, err := connectSystemBus()
+	if err != nil {
+		errorLogger.Printf("Error connecting the D-Bus system bus: %s\n", err.Error())
+		return err
+	}
+	t.conn, t.systemd.Bus = conn, conn
+	return nil
+}
+
+// failed handles an error of systemd about the unit, reporting a unit it
+// does not know once and dropping the connection on an error other than a
+// reply of systemd, so that the next cycle connects again.
+func (t *unitTuner) failed(unit, action string, err error) error {
+	switch {
+	case e.Is(err, actuator.ErrUnknownUnit):
+		if !t.unknown[unit] {
+			errorLogger.Printf("WARNING: systemd does not know the unit %s, skipping it\n", unit)
+			t.unknown[unit] = true
+		}
+		delete(state.OriginalQuotas, unit)
+		return err
+	case !e.As(err, new(dbus.Error)):
+		t.conn.Close()
+		t.conn, t.systemd.Bus = nil, nil
+	}
+	errorLogger.Printf("Error %s the CPU quota of unit %s: %s\n", action, unit, err.Error())
+	return err
+}
+
+// scale sets the quota of the unit to its original quota scaled by factor,
+// recording it first. The quota the unit has is read every time, so that a
+// quota set already, e.g. by an earlier run, is not set again. It reports
+// whether it set the quota.
+func (t *unitTuner) scale(ctx context.Context, unit string, factor float64) (bool, error) {
+	current, err := t.systemd.Quota(ctx, unit)
+	if err != nil {
+		return false, t.failed(unit, "reading", err)
+	}
+	delete(t.unknown, unit)
+	original, ok := state.OriginalQuotas[unit]
+	if !ok {
+		original = current
+		if state.OriginalQuotas == nil {
+			state.OriginalQuotas = make(map[string]uint64)
+		}
+		state.OriginalQuotas[unit] = original
+	}
+	quota := actuator.ScaledQuota(original, factor, len(hostCPUs()))
+	if current == quota {
+		return false, nil
+	}
+	if err := t.systemd.SetQuota(ctx, unit, quota); err != nil {
+		return false, t.failed(unit, "setting", err)
+	}
+	infoLog(ctx).Printf("Scaled the CPU quota of unit %s by %g\n", unit, factor)
+	return true, nil
+}
+
+// restore sets the quota of the unit back to the recorded original, unless
+// it has it already, reporting whether it set it.
+func (t *unitTuner) restore(ctx context.Context, unit string) (bool, error) {
+	original, ok := state.OriginalQuotas[unit]
+	if !ok {
+		return false, nil
+	}
+	current, err := t.systemd.Quota(ctx, unit)
+	if err != nil {
+		return false, t.failed(unit, "reading", err)
+	}
+	if current != original {
+		if err := t.systemd.SetQuota(ctx, unit, original); err != nil {
+			return false, t.failed(unit, "restoring", err)
+		}
+		infoLogger.Printf("Restored the CPU quota of unit %s\n", unit)
+	}
+	delete(state.OriginalQuotas, unit)
+	return current != original, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+// fakeSystemd stands in for the systemd manager on the system bus, with the
+// CPUQuotaPerSecUSec of its units. It sets the quotas and records the calls
+// setting them as the unit, the runtime flag and the properties.
+type fakeSystemd struct {
+	quotas map[string]uint64
+	// notFound are loaded without a definition
+	notFound map[string]bool
+	calls    []string
+	// err fails every call when set
+	err    error
+	closed int
+}
+
+func (b *fakeSystemd) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	return &fakeUnitObject{bus: b, path: path}
+}
+
+func (b *fakeSystemd) Close() error {
+	b.closed++
+	return nil
+}
+
+// setCalls returns the calls setting the quotas and forgets them.
+func (b *fakeSystemd) setCalls() []string {
+	calls := b.calls
+	b.calls = nil
+	return calls
+}
+
+type fakeUnitObject struct {
+	dbus.BusObject
+	bus  *fakeSystemd
+	path dbus.ObjectPath
+}
+
+func (o *fakeUnitObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...any) *dbus.Call {
+	b := o.bus
+	if b.err != nil {
+		return &dbus.Call{Err: b.err}
+	}
+	noSuchUnit := func(unit string) *dbus.Call {
+		return &dbus.Call{Err: dbus.Error{Name: "org.freedesktop.systemd1.NoSuchUnit", Body: []any{"Unit " + unit + " not found."}}}
+	}
+	switch method {
+	case "org.freedesktop.systemd1.Manager.LoadUnit":
+		return &dbus.Call{Body: []any{dbus.ObjectPath("/org/freedesktop/systemd1/unit/" + args[0].(string))}}
+	case "org.freedesktop.DBus.Properties.Get":
+		unit := strings.TrimPrefix(string(o.path), "/org/freedesktop/systemd1/unit/")
+		iface, name := args[0].(string), args[1].(string)
+		switch {
+		case name == "LoadState" && iface == "org.freedesktop.systemd1.Unit":
+			state := "loaded"
+			if b.notFound[unit] {
+				state = "not-found"
+			}
+			return &dbus.Call{Body: []any{dbus.MakeVariant(state)}}
+		case name == "CPUQuotaPerSecUSec" && iface == unitInterfaces[unit]:
+			return &dbus.Call{Body: []any{dbus.MakeVariant(b.quotas[unit])}}
+		}
+		return &dbus.Call{Err: dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownProperty", Body: []any{iface + "." + name}}}
+	case "org.freedesktop.systemd1.Manager.SetUnitProperties":
+		unit := args[0].(string)
+		if _, ok := b.quotas[unit]; !ok {
+			return noSuchUnit(unit)
+		}
+		b.calls = append(b.calls, fmt.Sprintf("%s %t %v", unit, args[1], args[2]))
+		quota := reflect.ValueOf(args[2]).Index(0).FieldByName("Value").Interface().(dbus.Variant)
+		b.quotas[unit] = quota.Value().(uint64)
+		return &dbus.Call{}
+	}
+	return &dbus.Call{Err: dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownMethod", Body: []any{method}}}
+}
+
+// unitInterfaces are the interfaces of the cgroup properties of the units of
+// the fake.
+var unitInterfaces = map[string]string{
+	"batch.slice": "org.freedesktop.systemd1.Slice",
+	"db.service":  "org.freedesktop.systemd1.Service",
+}
+
+// unitsOnFake tunes batch.slice, without a quota, db.service, with a quota of
+// two CPUs, and ghost.slice, unknown to systemd, on a fake of 4 CPUs, halving
+// their quotas in the expensive band. It returns the fake and the count of
+// the connections.
+func unitsOnFake(t *testing.T) (*fakeSystemd, *int) {
+	t.Helper()
+	simulatedSysfs(t, 4)
+	bus := &fakeSystemd{quotas: map[string]uint64{"batch.slice": actuator.NoQuota, "db.service": 2000000}, notFound: map[string]bool{"ghost.slice": true}}
+	connections := new(int)
+	setGlobal(t, &connectSystemBus, func() (systemBus, error) {
+		*connections++
+		return bus, nil
+	})
+	setGlobal(t, &unitQuotas, newUnitTuner(ActuatorConfig{Type: "systemd", Units: []string{"batch.slice", "ghost.slice", "db.service"},
+		Shares: map[string]float64{policy.Expensive: 0.5}}))
+	return bus, connections
+}
+
+func TestUnitQuotas(t *testing.T) {
+	bus, connections := unitsOnFake(t)
+	logs := captureLogs(t)
+	cycle := func(band string) (bool, error) {
+		return applyUnitQuotas(context.Background(), &cycleResult{Decision: &Decision{Time: time.Now(), Band: band}})
+	}
+
+	applied, err := cycle(policy.Expensive)
+	if !applied || err != nil {
+		t.Fatalf("applied %t, %v in the expensive band", applied, err)
+	}
+	// Runtime only, the unit without a quota gets half of the 4 CPUs
+	want := []string{"batch.slice true [{CPUQuotaPerSecUSec @t 2000000}]", "db.service true [{CPUQuotaPerSecUSec @t 1000000}]"}
+	if calls := bus.setCalls(); !slices.Equal(calls, want) {
+		t.Errorf("calls %q, want %q", calls, want)
+	}
+	if got := state.OriginalQuotas; len(got) != 2 || got["batch.slice"] != actuator.NoQuota || got["db.service"] != 2000000 {
+		t.Errorf("original quotas %v", got)
+	}
+
+	// Set already
+	if applied, err := cycle(policy.Expensive); applied || err != nil {
+		t.Errorf("applied %t, %v in the expensive band again", applied, err)
+	}
+	if calls := bus.setCalls(); len(calls) != 0 {
+		t.Errorf("calls %q in the expensive band again", calls)
+	}
+	if n := strings.Count(logs.String(), "WARNING: systemd does not know the unit ghost.slice, skipping it\n"); n != 1 {
+		t.Errorf("the unknown unit reported %d times, want once:\n%s", n, logs)
+	}
+	// The quotas set are read back, also by the tuner of another run
+	tuner := newUnitTuner(ActuatorConfig{Type: "systemd", Units: unitQuotas.units, Shares: unitQuotas.factors})
+	tuner.unknown, tuner.conn, tuner.systemd = unitQuotas.unknown, unitQuotas.conn, unitQuotas.systemd
+	setGlobal(t, &unitQuotas, tuner)
+	if applied, err := cycle(policy.Expensive); applied || err != nil || len(bus.setCalls()) != 0 {
+		t.Errorf("applied %t, %v in the expensive band in another run, want the quotas left alone", applied, err)
+	}
+
+	// The cheap band has no factor and restores the originals
+	if applied, err := cycle(policy.Cheap); !applied || err != nil {
+		t.Errorf("applied %t, %v in the cheap band", applied, err)
+	}
+	want = []string{"batch.slice true [{CPUQuotaPerSecUSec @t 18446744073709551615}]", "db.service true [{CPUQuotaPerSecUSec @t 2000000}]"}
+	if calls := bus.setCalls(); !slices.Equal(calls, want) {
+		t.Errorf("calls %q in the cheap band, want %q", calls, want)
+	}
+	if len(state.OriginalQuotas) != 0 {
+		t.Errorf("original quotas %v kept after restoring them", state.OriginalQuotas)
+	}
+
+	// And so does the exit
+	cycle(policy.Expensive)
+	bus.setCalls()
+	restoreUnitQuotas()
+	calls := bus.setCalls()
+	slices.Sort(calls)
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls %q on exit, want %q", calls, want)
+	}
+	if *connections != 1 || bus.closed != 0 {
+		t.Errorf("connected %d times, closed %d times, want a single connection", *connections, bus.closed)
+	}
+}
+
+func TestUnitQuotasFailures(t *testing.T) {
+	bus, connections := unitsOnFake(t)
+	logs := captureLogs(t)
+	cycle := func() (bool, error) {
+		return applyUnitQuotas(context.Background(), &cycleResult{Decision: &Decision{Time: time.Now(), Band: policy.Expensive}})
+	}
+
+	// An error of systemd fails the unit only
+	bus.err = dbus.Error{Name: "org.freedesktop.DBus.Error.AccessDenied", Body: []any{"Access denied"}}
+	if _, err := cycle(); err == nil || err.Error() != "3 of 3 units failed" {
+		t.Errorf("error %v, want all the units failed", err)
+	}
+	if bus.closed != 0 {
+		t.Errorf("connection closed on an error of systemd")
+	}
+	// A broken connection fails the units left and is connected again
+	bus.err = e.New("connection reset")
+	if _, err := cycle(); err == nil || err.Error() != "3 of 3 units failed" {
+		t.Errorf("error %v, want all the units failed", err)
+	}
+	if bus.closed != 1 {
+		t.Errorf("connection closed %d times, want once", bus.closed)
+	}
+	if !strings.Contains(logs.String(), "Error reading the CPU quota of unit batch.slice: ") {
+		t.Errorf("the failure not logged:\n%s", logs)
+	}
+	bus.err = nil
+	if applied, err := cycle(); !applied || err != nil || *connections != 2 {
+		t.Errorf("applied %t, %v after %d connections, want the units tuned on a new connection", applied, err, *connections)
+	}
+	if calls := bus.setCalls(); len(calls) != 2 {
+		t.Errorf("calls %q after reconnecting", calls)
+	}
+}
+
+func TestUnitQuotasNotApplied(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision *Decision
+		dryRun   bool
+	}{
+		{"dry run", &Decision{Band: policy.Expensive}, true},
+		{"maintenance", &Decision{Band: policy.Expensive, Maintenance: true}, false},
+		{"safe mode", &Decision{Band: policy.Expensive, SafeMode: safeHold}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bus, connections := unitsOnFake(t)
+			captureLogs(t)
+			setGlobal(t, &dryRun, test.dryRun)
+			applyUnitQuotas(context.Background(), &cycleResult{Decision: test.decision})
+			if *connections != 0 || len(bus.setCalls()) != 0 {
+				t.Errorf("connected %d times with calls, want none", *connections)
+			}
+		})
+	}
+}
+
+func TestUnitQuotasDryRun(t *testing.T) {
+	bus, connections := unitsOnFake(t)
+	captureLogs(t)
+	setGlobal(t, &dryRun, true)
+	for i, test := range []struct {
+		band    string
+		applied bool
+	}{{policy.Cheap, false}, {policy.Expensive, true}, {policy.Expensive, false}, {policy.Cheap, true}} {
+		applied, err := applyUnitQuotas(context.Background(), &cycleResult{Decision: &Decision{Time: time.Now(), Band: test.band}})
+		if applied != test.applied || err != nil {
+			t.Errorf("cycle %d, %s: applied %t, %v, want %t", i, test.band, applied, err, test.applied)
+		}
+	}
+	if *connections != 0 || len(bus.setCalls()) != 0 {
+		t.Errorf("connected %d times with calls in a dry run, want none", *connections)
+	}
+}
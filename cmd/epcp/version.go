@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set when building, e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)" ./cmd/epcp
+//
+// Without them, the module version and VCS stamp of the binary are used.
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
+// buildInfo identifies the running build.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+}
+
+// getBuildInfo returns the build information set by -ldflags, filling what
+// is missing from debug.ReadBuildInfo.
+func getBuildInfo() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, Date: buildDate, GoVersion: runtime.Version()}
+	dirty := false
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.Date == "":
+				info.Date = s.Value
+			case s.Key == "vcs.modified" && commit == "":
+				dirty = s.Value == "true"
+			}
+		}
+	}
+	if dirty && info.Commit != "" {
+		info.Commit += "-dirty"
+	}
+	if info.Version == "" || info.Version == "(devel)" {
+		info.Version = "devel"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+// String formats the build as "epcp 1.2.0 (commit 0123abc…, built 2024-01-01T00:00:00Z, go1.22.0)".
+func (b buildInfo) String() string {
+	return fmt.Sprintf("epcp %s (commit %s, built %s, %s)", b.Version, b.Commit, b.Date, b.GoVersion)
+}
+
+// recordBuildInfo exports the build as the constant epcp_build_info metric.
+func recordBuildInfo(info buildInfo) {
+	metrics.setGauge("epcp_build_info", "Build of the running epcp.", 1,
+		"version", info.Version, "commit", info.Commit, "build_date", info.Date, "goversion", info.GoVersion)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestBuildInfo(t *testing.T) {
+	setGlobal(t, &version, "1.2.0")
+	setGlobal(t, &commit, "0123abc")
+	setGlobal(t, &buildDate, "2024-01-01T00:00:00Z")
+	info := getBuildInfo()
+	want := "epcp 1.2.0 (commit 0123abc, built 2024-01-01T00:00:00Z, " + runtime.Version() + ")"
+	if got := info.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	// Without -ldflags, the build information of the binary is used
+	version, commit, buildDate = "", "", ""
+	info = getBuildInfo()
+	wantVersion, wantCommit := "devel", "unknown"
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			wantVersion = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" {
+				wantCommit = s.Value
+			}
+		}
+	}
+	if info.Version != wantVersion || !strings.HasPrefix(info.Commit, wantCommit) || info.Date == "" || info.GoVersion != runtime.Version() {
+		t.Errorf("got %+v, want version %s and commit %s", info, wantVersion, wantCommit)
+	}
+
+	setGlobal(t, &metrics, &metricsRegistry{families: make(map[string]*metricFamily)})
+	recordBuildInfo(buildInfo{Version: "1.2.0", Commit: "0123abc", Date: "2024-01-01T00:00:00Z", GoVersion: "go1.22.0"})
+	var exposition strings.Builder
+	metrics.write(&exposition)
+	if want := `epcp_build_info{version="1.2.0",commit="0123abc",build_date="2024-01-01T00:00:00Z",goversion="go1.22.0"} 1`; !strings.Contains(exposition.String(), want) {
+		t.Errorf("metrics lack %s:\n%s", want, exposition.String())
+	}
+}
@@ -0,0 +1,56 @@
+// Command embed shows the public API of the packages under pkg: it fetches
+// a window of intraday prices from a stand-in of the OTE service and decides
+// the band of the latest hour with the trend policy. Point -endpoint at the
+// service to use the real prices instead.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/pkg/ote"
+	"github.com/CERIT-SC/epcp-simulator/pkg/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/pkg/policy"
+	"github.com/CERIT-SC/epcp-simulator/pkg/pricing"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", "", "`URL` of the OTE service, a stand-in serving made-up prices by default")
+	flag.Parse()
+	to := time.Now()
+	from := to.Add(-3 * time.Hour)
+	if *endpoint == "" {
+		server := otetest.NewServer(madeUpPrices(from, to))
+		defer server.Close()
+		*endpoint = server.URL
+	}
+
+	client := ote.NewClient(ote.WithEndpoint(*endpoint), ote.WithTimeout(30*time.Second))
+	points, err := ote.FetchWindow(context.Background(), client, from, to)
+	if err != nil {
+		log.Fatalf("Error fetching the prices: %s", err)
+	}
+	for _, p := range points {
+		fmt.Printf("%s hour %d: %.2f EUR/MWh\n", p.Date, p.Hour, p.Price)
+	}
+
+	decision, err := policy.Decide(policy.Trend{}, points)
+	if err != nil {
+		log.Fatalf("Error deciding: %s", err)
+	}
+	fmt.Printf("The hour from %s is %s at %.2f EUR/MWh\n",
+		decision.Time.In(ote.Location()).Format("15:04"), decision.Band, decision.Price)
+}
+
+// madeUpPrices returns rising prices of the trading hours of the window.
+func madeUpPrices(from, to time.Time) []pricing.PricePoint {
+	var points []pricing.PricePoint
+	for t, price := from.Truncate(time.Hour), 80.0; !t.After(to); t, price = t.Add(time.Hour), price+7.5 {
+		date, hour := ote.HourIndex(t)
+		points = append(points, pricing.PricePoint{Date: date, Hour: hour, Start: t, Price: price})
+	}
+	return points
+}
@@ -0,0 +1,153 @@
+// Package actuator applies frequency decisions by writing to sysfs, directly,
+// through a privileged helper or only in simulation.
+package actuator
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The registers counting the cycles at the base and at the actual
+// frequency while the CPU runs; the ratio of their increments is the
+// effective frequency relative to the base one.
+const (
+	MSRMPERF = 0xE7
+	MSRAPERF = 0xE8
+)
+
+// Write is a single value written to a sysfs file.
+type Write struct {
+	Path  string `json:"path"`
+	Value string `json:"value"`
+}
+
+// Actuator performs the writes of a decision and returns one error per write.
+type Actuator interface {
+	Apply(ctx context.Context, writes []Write) []error
+}
+
+// Path returns the path of a sysfs file given relative to root, where sysfs
+// is mounted.
+func Path(root string, elem ...string) string {
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+// CPUPath returns the path of a file in the sysfs directory of the CPU,
+// e.g. CPUPath("/sys", 0, "cpufreq", "scaling_max_freq").
+func CPUPath(root string, cpu int, elem ...string) string {
+	return Path(root, append([]string{"devices", "system", "cpu", "cpu" + strconv.Itoa(cpu)}, elem...)...)
+}
+
+// Sysfs writes to sysfs directly, the CPUs concurrently with Workers
+// workers, DefaultWorkers without them.
+type Sysfs struct {
+	FS      Filesystem
+	Workers int
+}
+
+func (a Sysfs) Apply(ctx context.Context, writes []Write) []error {
+	return ApplyConcurrently(writes, a.Workers, func(w Write) error {
+		return WriteFile(a.FS, w.Path, w.Value)
+	})
+}
+
+// DefaultWorkers returns the number of workers writing the CPUs
+// concurrently, a quarter of the CPUs.
+func DefaultWorkers() int {
+	return max(runtime.NumCPU()/4, 1)
+}
+
+// cpuPattern matches the sysfs directory of a CPU or a cpufreq policy in a
+// path.
+var cpuPattern = regexp.MustCompile(`/(cpu|policy)[0-9]+(/|$)`)
+
+// ApplyConcurrently performs the writes with write, by up to workers at a
+// time, DefaultWorkers when not positive. The writes to a CPU or a cpufreq
+// policy are performed one after the other in their order, e.g. the minimum
+// before the maximum frequency, and so are those to neither; the CPUs are
+// written concurrently.
+// It returns the error of each write; a failing write stops none of the
+// others.
+func ApplyConcurrently(writes []Write, workers int, write func(Write) error) []error {
+	if workers <= 0 {
+		workers = DefaultWorkers()
+	}
+	var order []string
+	groups := make(map[string][]int)
+	for i, w := range writes {
+		cpu := strings.Trim(cpuPattern.FindString(w.Path), "/")
+		if _, ok := groups[cpu]; !ok {
+			order = append(order, cpu)
+		}
+		groups[cpu] = append(groups[cpu], i)
+	}
+	errs := make([]error, len(writes))
+	queue := make(chan []int)
+	var wg sync.WaitGroup
+	for range min(workers, len(order)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range queue {
+				for _, i := range group {
+					errs[i] = write(writes[i])
+				}
+			}
+		}()
+	}
+	for _, cpu := range order {
+		queue <- groups[cpu]
+	}
+	close(queue)
+	wg.Wait()
+	return errs
+}
+
+// Simulation logs the writes it would have done with Logf and, given FS, a
+// simulated tree, does them there.
+type Simulation struct {
+	FS   Filesystem
+	Logf func(format string, args ...any)
+}
+
+func (a Simulation) Apply(ctx context.Context, writes []Write) []error {
+	errs := make([]error, len(writes))
+	for i, w := range writes {
+		if a.Logf != nil {
+			a.Logf("Simulating write of %s to %s\n", w.Value, w.Path)
+		}
+		if a.FS != nil {
+			errs[i] = WriteFile(a.FS, w.Path, w.Value)
+		}
+	}
+	return errs
+}
+
+// SimulatedFrequencies are the available frequencies of SimulatedTree.
+var SimulatedFrequencies = []string{"800000", "1600000", "2400000", "3200000"}
+
+// SimulatedTree returns a cpufreq tree under root of the given number of
+// CPUs, running at the highest of SimulatedFrequencies.
+func SimulatedTree(root string, cpus int) *MemFS {
+	return SimulatedTreeWith(root, cpus, SimulatedFrequencies)
+}
+
+// SimulatedTreeWith returns a cpufreq tree under root of the given number of
+// CPUs offering the frequencies, given in ascending order, and running at the
+// highest of them.
+func SimulatedTreeWith(root string, cpus int, frequencies []string) *MemFS {
+	files := make(map[string]string)
+	available := strings.Join(frequencies, " ")
+	highest := frequencies[len(frequencies)-1]
+	for cpu := 0; cpu < cpus; cpu++ {
+		files[CPUPath(root, cpu, "cpufreq", "scaling_available_frequencies")] = available + "\n"
+		files[CPUPath(root, cpu, "cpufreq", "scaling_max_freq")] = highest + "\n"
+		files[CPUPath(root, cpu, "cpufreq", "scaling_min_freq")] = frequencies[0] + "\n"
+	}
+	return NewMemFS(files)
+}
@@ -0,0 +1,162 @@
+package actuator_test
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+func TestApplyConcurrently(t *testing.T) {
+	const cpus, workers, latency = 16, 8, 20 * time.Millisecond
+	var writes []actuator.Write
+	for cpu := 0; cpu < cpus; cpu++ {
+		writes = append(writes,
+			actuator.Write{Path: actuator.CPUPath("/sys", cpu, "cpufreq", "scaling_min_freq"), Value: "800000"},
+			actuator.Write{Path: actuator.CPUPath("/sys", cpu, "cpufreq", "scaling_max_freq"), Value: "2400000"})
+	}
+	failing := writes[7].Path
+	var mu sync.Mutex
+	active, peak := 0, 0
+	written := make(map[string][]string)
+	start := time.Now()
+	errs := actuator.ApplyConcurrently(writes, workers, func(w actuator.Write) error {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		dir := filepath.Dir(filepath.Dir(w.Path))
+		written[dir] = append(written[dir], w.Value)
+		mu.Unlock()
+		time.Sleep(latency)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		if w.Path == failing {
+			return fs.ErrPermission
+		}
+		return nil
+	})
+	elapsed := time.Since(start)
+	// Serially, the writes take cpus*2*latency
+	if serial := time.Duration(len(writes)) * latency; elapsed > serial/2 {
+		t.Errorf("the writes took %s, serially %s", elapsed, serial)
+	}
+	if peak > workers {
+		t.Errorf("%d writes at a time, want at most %d", peak, workers)
+	}
+	if len(errs) != len(writes) {
+		t.Fatalf("got %d errors, want one per write, %d", len(errs), len(writes))
+	}
+	for i, err := range errs {
+		if want := writes[i].Path == failing; (err != nil) != want {
+			t.Errorf("write %d to %s: got error %v, want one %t", i, writes[i].Path, err, want)
+		}
+	}
+	// The writes to a CPU keep their order, the minimum before the maximum
+	for dir, values := range written {
+		if len(values) != 2 || values[0] != "800000" || values[1] != "2400000" {
+			t.Errorf("%s written %v, want [800000 2400000]", dir, values)
+		}
+	}
+}
+
+func TestApplyConcurrentlyOneWorker(t *testing.T) {
+	var writes []actuator.Write
+	for cpu := 0; cpu < 4; cpu++ {
+		writes = append(writes, actuator.Write{Path: actuator.CPUPath("/sys", cpu, "cpufreq", "scaling_max_freq"), Value: fmt.Sprint(cpu)})
+	}
+	var order []string
+	errs := actuator.ApplyConcurrently(writes, 1, func(w actuator.Write) error {
+		order = append(order, w.Value)
+		return nil
+	})
+	if len(errs) != 4 || fmt.Sprint(order) != "[0 1 2 3]" {
+		t.Errorf("one worker wrote %v with errors %v, want [0 1 2 3] in order", order, errs)
+	}
+}
+
+// clampFS is a Filesystem writing clamped in place of the values written to
+// its files, as the kernel does for frequencies out of the limits.
+type clampFS struct {
+	*actuator.MemFS
+	clamped string
+}
+
+func (c clampFS) Write(path string, data []byte) error {
+	return c.MemFS.Write(path, []byte(c.clamped))
+}
+
+func TestWriteFile(t *testing.T) {
+	path := actuator.CPUPath("/sys", 0, "cpufreq", "scaling_max_freq")
+	tests := []struct {
+		name  string
+		fsys  actuator.Filesystem
+		path  string
+		want  error
+		class string
+	}{
+		{name: "applied", fsys: actuator.SimulatedTree("/sys", 1), path: path},
+		{name: "missing", fsys: actuator.SimulatedTree("/sys", 1), path: actuator.CPUPath("/sys", 1, "cpufreq", "scaling_max_freq"), want: fs.ErrNotExist, class: "missing"},
+		{name: "clamped", fsys: clampFS{actuator.SimulatedTree("/sys", 1), "3200000\n"}, path: path, want: actuator.ErrNotApplied, class: "not-applied"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := actuator.WriteFile(test.fsys, test.path, "2400000")
+			if !e.Is(err, test.want) || (test.want == nil) != (err == nil) {
+				t.Fatalf("got error %v, want %v", err, test.want)
+			}
+			if err != nil {
+				if class := actuator.ErrorClass(err); class != test.class {
+					t.Errorf("error class %s, want %s", class, test.class)
+				}
+				return
+			}
+			if got, _ := actuator.ReadFile(test.fsys, test.path); got != "2400000" {
+				t.Errorf("%s reads %q after the write, want 2400000", test.path, got)
+			}
+		})
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&fs.PathError{Op: "open", Path: "scaling_max_freq", Err: syscall.EACCES}, "permission"},
+		{&fs.PathError{Op: "write", Path: "scaling_max_freq", Err: syscall.EINVAL}, "invalid"},
+		{&fs.PathError{Op: "write", Path: "scaling_max_freq", Err: syscall.EBUSY}, "busy"},
+		{fmt.Errorf("cpu0: %w", actuator.ErrNotApplied), "not-applied"},
+		{e.New("helper crashed"), "other"},
+	}
+	for _, test := range tests {
+		if got := actuator.ErrorClass(test.err); got != test.want {
+			t.Errorf("ErrorClass(%v) = %s, want %s", test.err, got, test.want)
+		}
+	}
+}
+
+func TestSysfsApply(t *testing.T) {
+	tree := actuator.SimulatedTree("/sys", 4)
+	var writes []actuator.Write
+	for cpu := 0; cpu < 4; cpu++ {
+		writes = append(writes, actuator.Write{Path: actuator.CPUPath("/sys", cpu, "cpufreq", "scaling_max_freq"), Value: "1600000"})
+	}
+	writes = append(writes, actuator.Write{Path: actuator.CPUPath("/sys", 4, "cpufreq", "scaling_max_freq"), Value: "1600000"})
+	errs := actuator.Sysfs{FS: tree, Workers: 2}.Apply(context.Background(), writes)
+	for i, err := range errs {
+		if want := i == 4; (err != nil) != want {
+			t.Errorf("write %d: got error %v, want one %t", i, err, want)
+		}
+	}
+	if got := len(tree.Writes()); got != 4 {
+		t.Errorf("%d writes to the tree, want 4", got)
+	}
+}
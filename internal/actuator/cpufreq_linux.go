@@ -0,0 +1,19 @@
+//go:build linux
+
+package actuator
+
+import (
+	"syscall"
+)
+
+// CPUFreqAvailable reports whether any CPU under root exposes a cpufreq
+// interface.
+func CPUFreqAvailable(fsys Filesystem, root string) bool {
+	matches, err := fsys.Glob(Path(root, "devices", "system", "cpu", "cpu[0-9]*", "cpufreq"))
+	return err == nil && len(matches) != 0
+}
+
+// Writable checks that path may be written without opening it.
+func Writable(path string) error {
+	return syscall.Access(path, 2) // W_OK
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package actuator
+
+import (
+	e "errors"
+)
+
+// CPUFreqAvailable is always false outside Linux, so the frequency changes
+// are only simulated.
+func CPUFreqAvailable(fsys Filesystem, root string) bool {
+	return false
+}
+
+func Writable(path string) error {
+	return e.New("cpufreq is only supported on Linux")
+}
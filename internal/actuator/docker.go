@@ -0,0 +1,158 @@
+package actuator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultPeriod is the CFS period in microseconds Docker uses by default.
+const DefaultPeriod = 100000
+
+// Docker limits the CPUs of containers through the Docker API.
+type Docker struct {
+	// Socket is the unix socket of the Docker daemon
+	Socket string
+	// Wrap, if set, wraps the transport dialing Socket, e.g. to add headers
+	Wrap   func(http.RoundTripper) http.RoundTripper
+	client *http.Client
+}
+
+// ContainerLimits are the CPU limits of a container as in its HostConfig.
+// None of them is set for a container using all the CPUs.
+type ContainerLimits struct {
+	NanoCPUs  int64 `json:"NanoCpus,omitempty"`
+	CPUQuota  int64 `json:"CpuQuota,omitempty"`
+	CPUPeriod int64 `json:"CpuPeriod,omitempty"`
+}
+
+// Scaled returns the limits scaled by factor, keeping how the container is
+// limited. A container using all the cpus gets a quota of the CPUs scaled.
+func (l ContainerLimits) Scaled(factor float64, cpus int) ContainerLimits {
+	switch {
+	case l.NanoCPUs > 0:
+		return ContainerLimits{NanoCPUs: max(int64(float64(l.NanoCPUs)*factor), 1e7)}
+	case l.CPUQuota > 0:
+		return ContainerLimits{CPUQuota: max(int64(float64(l.CPUQuota)*factor), 1000), CPUPeriod: l.period()}
+	}
+	return ContainerLimits{CPUQuota: max(int64(float64(cpus*DefaultPeriod)*factor), 1000), CPUPeriod: DefaultPeriod}
+}
+
+// Restoring returns the update restoring the limits over a scaled copy; a
+// quota of -1 removes the quota.
+func (l ContainerLimits) Restoring() ContainerLimits {
+	switch {
+	case l.NanoCPUs > 0:
+		return ContainerLimits{NanoCPUs: l.NanoCPUs}
+	case l.CPUQuota > 0:
+		return ContainerLimits{CPUQuota: l.CPUQuota, CPUPeriod: l.period()}
+	}
+	return ContainerLimits{CPUQuota: -1, CPUPeriod: DefaultPeriod}
+}
+
+// CPUs returns the number of CPUs the limits allow, 0 for all of them, so
+// that limits set through NanoCPUs and through a quota compare.
+func (l ContainerLimits) CPUs() float64 {
+	switch {
+	case l.NanoCPUs > 0:
+		return float64(l.NanoCPUs) / 1e9
+	case l.CPUQuota > 0:
+		return float64(l.CPUQuota) / float64(l.period())
+	}
+	return 0
+}
+
+func (l ContainerLimits) period() int64 {
+	if l.CPUPeriod > 0 {
+		return l.CPUPeriod
+	}
+	return DefaultPeriod
+}
+
+// Containers returns the IDs of the running containers with the label,
+// given as name=value or name.
+func (d *Docker) Containers(ctx context.Context, label string) ([]string, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label}})
+	if err != nil {
+		return nil, err
+	}
+	var containers []struct {
+		ID string `json:"Id"`
+	}
+	if err := d.do(ctx, http.MethodGet, "/containers/json?filters="+url.QueryEscape(string(filters)), nil, &containers); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(containers))
+	for i, c := range containers {
+		ids[i] = c.ID
+	}
+	return ids, nil
+}
+
+// Limits returns the CPU limits of the container.
+func (d *Docker) Limits(ctx context.Context, id string) (ContainerLimits, error) {
+	var container struct {
+		HostConfig ContainerLimits
+	}
+	err := d.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/json", nil, &container)
+	return container.HostConfig, err
+}
+
+// Update changes the CPU limits of the container to the set fields of limits.
+func (d *Docker) Update(ctx context.Context, id string, limits ContainerLimits) error {
+	return d.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/update", limits, nil)
+}
+
+// do sends the request with the JSON body, if any, and decodes the response
+// into result, if any.
+func (d *Docker) do(ctx context.Context, method, path string, body, result any) error {
+	if d.client == nil {
+		var transport http.RoundTripper = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", d.Socket)
+			},
+		}
+		if d.Wrap != nil {
+			transport = d.Wrap(transport)
+		}
+		d.client = &http.Client{Transport: transport}
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://docker"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var message struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&message)
+		return fmt.Errorf("%s %s: HTTP status %d: %s", method, strings.SplitN(path, "?", 2)[0], resp.StatusCode, message.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
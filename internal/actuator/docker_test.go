@@ -0,0 +1,130 @@
+package actuator_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+func TestContainerLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    actuator.ContainerLimits
+		scaled    actuator.ContainerLimits
+		restoring actuator.ContainerLimits
+		cpus      float64
+	}{
+		{"nano CPUs", actuator.ContainerLimits{NanoCPUs: 2e9},
+			actuator.ContainerLimits{NanoCPUs: 5e8}, actuator.ContainerLimits{NanoCPUs: 2e9}, 2},
+		{"quota", actuator.ContainerLimits{CPUQuota: 50000, CPUPeriod: 50000},
+			actuator.ContainerLimits{CPUQuota: 12500, CPUPeriod: 50000}, actuator.ContainerLimits{CPUQuota: 50000, CPUPeriod: 50000}, 1},
+		{"quota with the default period", actuator.ContainerLimits{CPUQuota: 200000},
+			actuator.ContainerLimits{CPUQuota: 50000, CPUPeriod: actuator.DefaultPeriod}, actuator.ContainerLimits{CPUQuota: 200000, CPUPeriod: actuator.DefaultPeriod}, 2},
+		{"unlimited", actuator.ContainerLimits{},
+			actuator.ContainerLimits{CPUQuota: 200000, CPUPeriod: actuator.DefaultPeriod}, actuator.ContainerLimits{CPUQuota: -1, CPUPeriod: actuator.DefaultPeriod}, 0},
+	}
+	for _, test := range tests {
+		if got := test.limits.CPUs(); got != test.cpus {
+			t.Errorf("%s: %g CPUs, want %g", test.name, got, test.cpus)
+		}
+		if got := test.limits.Scaled(0.25, 8); got != test.scaled {
+			t.Errorf("%s: scaled %+v, want %+v", test.name, got, test.scaled)
+		}
+		if got := test.limits.Restoring(); got != test.restoring {
+			t.Errorf("%s: restoring %+v, want %+v", test.name, got, test.restoring)
+		}
+	}
+	// The limits do not drop to nothing
+	if got := (actuator.ContainerLimits{NanoCPUs: 1e8}).Scaled(0.01, 8); got.NanoCPUs != 1e7 {
+		t.Errorf("scaled %+v, want the minimum of 0.01 CPUs", got)
+	}
+	if got := (actuator.ContainerLimits{CPUQuota: 10000}).Scaled(0.01, 8); got.CPUQuota != 1000 {
+		t.Errorf("scaled %+v, want the minimum quota of 1 ms", got)
+	}
+}
+
+// dockerSocket serves handler on a unix socket, returning its path.
+func dockerSocket(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the Docker API is served on a unix socket")
+	}
+	// The path of a unix socket is short, so not under the test directory
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return path
+}
+
+func TestDocker(t *testing.T) {
+	var updates []string
+	socket := dockerSocket(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/containers/json":
+			var filters map[string][]string
+			if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil || len(filters) != 1 ||
+				len(filters["label"]) != 1 || filters["label"][0] != "epcp.throttle=true" {
+				t.Errorf("listed with filters %q, %v", r.URL.Query().Get("filters"), err)
+			}
+			w.Write([]byte(`[{"Id":"4f2a9c1e7b3d","Names":["/batch"]},{"Id":"9e8d7c6b5a4f"}]`))
+		case r.Method == http.MethodGet && r.URL.Path == "/containers/4f2a9c1e7b3d/json":
+			w.Write([]byte(`{"Id":"4f2a9c1e7b3d","HostConfig":{"NanoCpus":0,"CpuQuota":150000,"CpuPeriod":100000,"Memory":0}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/containers/4f2a9c1e7b3d/update":
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("update with content type %q", r.Header.Get("Content-Type"))
+			}
+			updates = append(updates, string(body))
+			w.Write([]byte(`{"Warnings":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such container: gone"}`))
+		}
+	}))
+	d := &actuator.Docker{Socket: socket}
+	ctx := context.Background()
+
+	ids, err := d.Containers(ctx, "epcp.throttle=true")
+	if err != nil || len(ids) != 2 || ids[0] != "4f2a9c1e7b3d" || ids[1] != "9e8d7c6b5a4f" {
+		t.Errorf("containers %v, %v", ids, err)
+	}
+	limits, err := d.Limits(ctx, "4f2a9c1e7b3d")
+	if err != nil || limits != (actuator.ContainerLimits{CPUQuota: 150000, CPUPeriod: 100000}) {
+		t.Errorf("limits %+v, %v", limits, err)
+	}
+	if err := d.Update(ctx, "4f2a9c1e7b3d", limits.Scaled(0.5, 4)); err != nil {
+		t.Error(err)
+	}
+	if err := d.Update(ctx, "4f2a9c1e7b3d", actuator.ContainerLimits{}.Restoring()); err != nil {
+		t.Error(err)
+	}
+	want := []string{`{"CpuQuota":75000,"CpuPeriod":100000}`, `{"CpuQuota":-1,"CpuPeriod":100000}`}
+	if strings.Join(updates, "\n") != strings.Join(want, "\n") {
+		t.Errorf("updates %q, want %q", updates, want)
+	}
+
+	if err := d.Update(ctx, "gone", limits); err == nil || err.Error() != "POST /containers/gone/update: HTTP status 404: No such container: gone" {
+		t.Errorf("missing container: got error %v", err)
+	}
+}
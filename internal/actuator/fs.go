@@ -0,0 +1,228 @@
+package actuator
+
+import (
+	e "errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Filesystem is how the sysfs files are accessed, so that the simulation
+// and tests can run on an in-memory tree instead.
+type Filesystem interface {
+	Read(path string) ([]byte, error)
+	// Write replaces the content of an existing file, as sysfs files
+	// cannot be created.
+	Write(path string, data []byte) error
+	Glob(pattern string) ([]string, error)
+	Stat(path string) (fs.FileInfo, error)
+}
+
+// OSFS is the real Filesystem.
+type OSFS struct{}
+
+func (OSFS) Read(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (OSFS) Write(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (OSFS) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (OSFS) Stat(path string) (fs.FileInfo, error) {
+	return os.Stat(path)
+}
+
+// MemFS is an in-memory Filesystem that records the writes.
+type MemFS struct {
+	mu     sync.Mutex
+	files  map[string][]byte
+	writes []Write
+}
+
+// NewMemFS returns a MemFS with the given files and their parent directories.
+func NewMemFS(files map[string]string) *MemFS {
+	m := &MemFS{files: make(map[string][]byte)}
+	for path, content := range files {
+		m.files[filepath.Clean(path)] = []byte(content)
+	}
+	return m
+}
+
+func (m *MemFS) Read(path string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	content, ok := m.files[filepath.Clean(path)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	return slices.Clone(content), nil
+}
+
+func (m *MemFS) Write(path string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	if _, ok := m.files[path]; !ok {
+		return &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	m.files[path] = slices.Clone(data)
+	m.writes = append(m.writes, Write{Path: path, Value: string(data)})
+	return nil
+}
+
+// paths returns the files and directories of the tree.
+func (m *MemFS) paths() map[string]bool {
+	paths := make(map[string]bool)
+	for path := range m.files {
+		paths[path] = false
+		for dir := filepath.Dir(path); !paths[dir]; dir = filepath.Dir(dir) {
+			paths[dir] = true
+			if dir == filepath.Dir(dir) {
+				break
+			}
+		}
+	}
+	return paths
+}
+
+func (m *MemFS) Glob(pattern string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var matches []string
+	for path := range m.paths() {
+		ok, err := filepath.Match(pattern, path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, path)
+		}
+	}
+	slices.Sort(matches)
+	return matches, nil
+}
+
+func (m *MemFS) Stat(path string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	if content, ok := m.files[path]; ok {
+		return memFileInfo{name: filepath.Base(path), size: int64(len(content))}, nil
+	}
+	if m.paths()[path] {
+		return memFileInfo{name: filepath.Base(path), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+}
+
+// Writes returns the writes done so far.
+func (m *MemFS) Writes() []Write {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.writes)
+}
+
+type memFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return i.dir }
+func (i memFileInfo) Sys() any           { return nil }
+
+func (i memFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ErrNotApplied is returned when a written value does not read back.
+var ErrNotApplied = e.New("value not applied")
+
+// ReadFile returns the content of path; unlike an empty file, a missing one
+// is an error.
+func ReadFile(fsys Filesystem, path string) (string, error) {
+	content, err := fsys.Read(path)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// WriteFile writes the value to path and reads it back, as the kernel may
+// refuse or clamp the value without failing the write.
+func WriteFile(fsys Filesystem, path, value string) error {
+	if err := fsys.Write(path, []byte(value)); err != nil {
+		return err
+	}
+	content, err := ReadFile(fsys, path)
+	if err != nil {
+		return fmt.Errorf("verifying %s: %w", path, err)
+	}
+	if got := strings.TrimSpace(content); got != strings.TrimSpace(value) {
+		return fmt.Errorf("%s reads %s: %w", path, got, ErrNotApplied)
+	}
+	return nil
+}
+
+// CheckWritable checks that path may be written in fsys without writing to
+// it: on the real filesystem by opening it for writing, elsewhere by its
+// permissions.
+func CheckWritable(fsys Filesystem, path string) error {
+	if _, ok := fsys.(OSFS); ok {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0222 == 0 {
+		return &fs.PathError{Op: "open", Path: path, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+// ErrorClass groups write errors by their likely cause.
+func ErrorClass(err error) string {
+	switch {
+	case e.Is(err, fs.ErrPermission):
+		return "permission"
+	case e.Is(err, fs.ErrNotExist):
+		return "missing"
+	case e.Is(err, syscall.EINVAL):
+		return "invalid"
+	case e.Is(err, syscall.EBUSY):
+		return "busy"
+	case e.Is(err, ErrNotApplied):
+		return "not-applied"
+	}
+	return "other"
+}
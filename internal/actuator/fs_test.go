@@ -0,0 +1,78 @@
+package actuator_test
+
+import (
+	e "errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+func TestFilesystems(t *testing.T) {
+	files := map[string]string{
+		"cpu0/cpufreq/scaling_max_freq": "3200000\n",
+		"cpu0/cpufreq/empty":            "",
+		"cpu1/cpufreq/scaling_max_freq": "3200000\n",
+	}
+	dir := t.TempDir()
+	memFiles := make(map[string]string)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		memFiles[path] = content
+	}
+	filesystems := map[string]actuator.Filesystem{"OSFS": actuator.OSFS{}, "MemFS": actuator.NewMemFS(memFiles)}
+
+	for name, fsys := range filesystems {
+		t.Run(name, func(t *testing.T) {
+			// A missing file is an error, unlike an empty one
+			if content, err := actuator.ReadFile(fsys, filepath.Join(dir, "cpu0", "cpufreq", "empty")); err != nil || content != "" {
+				t.Errorf("empty file: %q, %v, want no content and no error", content, err)
+			}
+			if _, err := actuator.ReadFile(fsys, filepath.Join(dir, "cpu0", "cpufreq", "missing")); !e.Is(err, fs.ErrNotExist) {
+				t.Errorf("missing file: got error %v, want fs.ErrNotExist", err)
+			}
+			// Files are replaced, never created
+			path := filepath.Join(dir, "cpu0", "cpufreq", "scaling_max_freq")
+			if err := fsys.Write(path, []byte("800000")); err != nil {
+				t.Fatal(err)
+			}
+			if content, err := actuator.ReadFile(fsys, path); err != nil || content != "800000" {
+				t.Errorf("after the write: %q, %v, want 800000", content, err)
+			}
+			if err := fsys.Write(filepath.Join(dir, "cpu0", "cpufreq", "created"), []byte("1")); !e.Is(err, fs.ErrNotExist) {
+				t.Errorf("writing a missing file: got error %v, want fs.ErrNotExist", err)
+			}
+
+			matches, err := fsys.Glob(filepath.Join(dir, "cpu*", "cpufreq", "scaling_max_freq"))
+			want := []string{filepath.Join(dir, "cpu0", "cpufreq", "scaling_max_freq"), filepath.Join(dir, "cpu1", "cpufreq", "scaling_max_freq")}
+			if err != nil || !slices.Equal(matches, want) {
+				t.Errorf("Glob = %v, %v, want %v", matches, err, want)
+			}
+			if info, err := fsys.Stat(filepath.Join(dir, "cpu1")); err != nil || !info.IsDir() {
+				t.Errorf("Stat of a directory: %v, %v", info, err)
+			}
+			if info, err := fsys.Stat(path); err != nil || info.IsDir() || info.Name() != "scaling_max_freq" {
+				t.Errorf("Stat of a file: %v, %v", info, err)
+			}
+			if _, err := fsys.Stat(filepath.Join(dir, "cpu2")); !e.Is(err, fs.ErrNotExist) {
+				t.Errorf("Stat of a missing directory: got error %v, want fs.ErrNotExist", err)
+			}
+		})
+	}
+
+	// MemFS records the writes that succeeded
+	mem := filesystems["MemFS"].(*actuator.MemFS)
+	want := []actuator.Write{{Path: filepath.Join(dir, "cpu0", "cpufreq", "scaling_max_freq"), Value: "800000"}}
+	if got := mem.Writes(); !slices.Equal(got, want) {
+		t.Errorf("writes %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+package actuator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// HelperRequest is read by the apply helper from stdin or its socket.
+type HelperRequest struct {
+	Writes []Write `json:"writes"`
+}
+
+// HelperResponse holds one error message per write, empty on success.
+type HelperResponse struct {
+	Errors []string `json:"errors"`
+}
+
+// The helper runs privileged, so it only writes these files under its sysfs
+// root with plain numbers.
+var (
+	helperPathPattern  = regexp.MustCompile(`^/devices/system/cpu/(cpu[0-9]+/cpufreq|cpufreq/policy[0-9]+)/scaling_(max|min)_freq$`)
+	helperValuePattern = regexp.MustCompile(`^[0-9]{1,10}$`)
+)
+
+const helperRequestLimit = 1 << 20
+
+// ValidateWrite checks that the helper may do the write under root.
+func ValidateWrite(root string, w Write) error {
+	rel, ok := strings.CutPrefix(filepath.ToSlash(w.Path), filepath.ToSlash(root))
+	if filepath.Clean(w.Path) != w.Path || !ok || !helperPathPattern.MatchString(rel) {
+		return fmt.Errorf("path %q is not allowed", w.Path)
+	}
+	if !helperValuePattern.MatchString(w.Value) {
+		return fmt.Errorf("value %q is not allowed", w.Value)
+	}
+	return nil
+}
+
+// resolveWrite returns the path of the write with its symlinks resolved,
+// checking that it is still under the CPUs of root, as the cpufreq links of
+// sysfs are, so that no link leads the helper out of sysfs.
+func resolveWrite(root string, w Write) (string, error) {
+	cpus, err := filepath.EvalSymlinks(filepath.Join(root, "devices", "system", "cpu"))
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(w.Path)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(path, cpus+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q leads out of %s", w.Path, cpus)
+	}
+	return path, nil
+}
+
+// HandleHelperRequest validates and performs the writes of one request read
+// from r under root, writes the response to w and returns the failed writes.
+func HandleHelperRequest(root string, r io.Reader, w io.Writer) ([]error, error) {
+	req := new(HelperRequest)
+	decoder := json.NewDecoder(io.LimitReader(r, helperRequestLimit))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return nil, err
+	}
+	var failed []error
+	res := HelperResponse{Errors: make([]string, len(req.Writes))}
+	errs := ApplyConcurrently(req.Writes, 0, func(write Write) error {
+		if err := ValidateWrite(root, write); err != nil {
+			return err
+		}
+		path, err := resolveWrite(root, write)
+		if err != nil {
+			return err
+		}
+		return WriteFile(OSFS{}, path, write.Value)
+	})
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+			res.Errors[i] = err.Error()
+		}
+	}
+	return failed, json.NewEncoder(w).Encode(res)
+}
+
+// Helper sends the writes to the apply helper, started as Command or
+// listening on Socket.
+type Helper struct {
+	Command string
+	Socket  string
+}
+
+func (h Helper) Apply(ctx context.Context, writes []Write) []error {
+	errs := make([]error, len(writes))
+	res, err := h.call(ctx, HelperRequest{Writes: writes})
+	if err == nil && len(res.Errors) != len(writes) {
+		err = fmt.Errorf("apply helper returned %d results for %d writes", len(res.Errors), len(writes))
+	}
+	for i := range writes {
+		switch {
+		case err != nil:
+			errs[i] = err
+		case res.Errors[i] != "":
+			errs[i] = e.New(res.Errors[i])
+		}
+	}
+	return errs
+}
+
+func (h Helper) call(ctx context.Context, req HelperRequest) (*HelperResponse, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	if h.Socket != "" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", h.Socket)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		if _, err := conn.Write(payload); err != nil {
+			return nil, err
+		}
+		out, err = io.ReadAll(io.LimitReader(conn, helperRequestLimit))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		command := strings.Fields(h.Command)
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Stderr = os.Stderr
+		out, err = cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("apply helper: %w", err)
+		}
+	}
+	res := new(HelperResponse)
+	if err := json.Unmarshal(out, res); err != nil {
+		return nil, fmt.Errorf("apply helper response: %w", err)
+	}
+	return res, nil
+}
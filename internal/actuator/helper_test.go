@@ -0,0 +1,193 @@
+package actuator_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+func TestValidateWrite(t *testing.T) {
+	tests := []struct {
+		path, value string
+		ok          bool
+	}{
+		{"/sys/devices/system/cpu/cpu0/cpufreq/scaling_max_freq", "800000", true},
+		{"/sys/devices/system/cpu/cpu17/cpufreq/scaling_min_freq", "3200000", true},
+		{"/sys/devices/system/cpu/cpufreq/policy4/scaling_max_freq", "800000", true},
+		{"/sys/devices/system/cpu/cpu0/cpufreq/scaling_governor", "powersave", false},
+		{"/sys/devices/system/cpu/cpu0/cpufreq/scaling_max_freq", "800000\n", false},
+		{"/sys/devices/system/cpu/cpu0/cpufreq/scaling_max_freq", "-1", false},
+		{"/sys/devices/system/cpu/cpu0/cpufreq/scaling_max_freq", "12345678901", false},
+		{"/sys/devices/system/cpu/cpu0/cpufreq/scaling_max_freq", "", false},
+		{"/sys/devices/system/cpu/cpu0/cpufreq/../../../../../etc/passwd", "0", false},
+		{"/sys/devices/system/cpu/cpu0/../cpu1/cpufreq/scaling_max_freq", "800000", false},
+		{"/sysfs/devices/system/cpu/cpu0/cpufreq/scaling_max_freq", "800000", false},
+		{"/etc/devices/system/cpu/cpu0/cpufreq/scaling_max_freq", "800000", false},
+		{"devices/system/cpu/cpu0/cpufreq/scaling_max_freq", "800000", false},
+		{"/sys/devices/system/cpu/cpu0/cpufreq/scaling_max_freq/", "800000", false},
+	}
+	for _, test := range tests {
+		err := actuator.ValidateWrite("/sys", actuator.Write{Path: test.path, Value: test.value})
+		if (err == nil) != test.ok {
+			t.Errorf("%s=%q: got error %v, want one %t", test.path, test.value, err, !test.ok)
+		}
+	}
+}
+
+// helperRoot returns a sysfs root with the scaling_max_freq file of the
+// CPUs.
+func helperRoot(t *testing.T, cpus int) string {
+	t.Helper()
+	root := t.TempDir()
+	for cpu := 0; cpu < cpus; cpu++ {
+		path := actuator.CPUPath(root, cpu, "cpufreq", "scaling_max_freq")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("3200000\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestHandleHelperRequest(t *testing.T) {
+	root := helperRoot(t, 2)
+	outside := filepath.Join(t.TempDir(), "outside")
+	if err := os.WriteFile(outside, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	req := actuator.HelperRequest{Writes: []actuator.Write{
+		{Path: actuator.CPUPath(root, 0, "cpufreq", "scaling_max_freq"), Value: "800000"},
+		{Path: outside, Value: "800000"},
+		{Path: actuator.CPUPath(root, 1, "cpufreq", "scaling_max_freq"), Value: "1600000"},
+		{Path: actuator.CPUPath(root, 2, "cpufreq", "scaling_max_freq"), Value: "1600000"},
+	}}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	failed, err := actuator.HandleHelperRequest(root, bytes.NewReader(payload), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res actuator.HelperResponse
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+		t.Fatalf("response %q: %s", out.String(), err)
+	}
+	if len(res.Errors) != 4 || res.Errors[0] != "" || !strings.Contains(res.Errors[1], "is not allowed") || res.Errors[2] != "" || res.Errors[3] == "" {
+		t.Errorf("errors %q, want the second and the fourth write failed", res.Errors)
+	}
+	if len(failed) != 2 {
+		t.Errorf("%d failed writes returned, want 2", len(failed))
+	}
+	for cpu, want := range []string{"800000", "1600000"} {
+		if got, _ := os.ReadFile(actuator.CPUPath(root, cpu, "cpufreq", "scaling_max_freq")); string(got) != want {
+			t.Errorf("cpu%d: scaling_max_freq %q, want %q", cpu, got, want)
+		}
+	}
+	if got, _ := os.ReadFile(outside); string(got) != "keep" {
+		t.Errorf("the file outside of the root written: %q", got)
+	}
+
+	// Requests not of the protocol are rejected as a whole
+	for _, payload := range []string{`{"writes": [{"path": "x", "value": "1", "mode": "append"}]}`, `{"writes": `, `[]`} {
+		out.Reset()
+		if _, err := actuator.HandleHelperRequest(root, strings.NewReader(payload), &out); err == nil || out.Len() != 0 {
+			t.Errorf("request %s: got error %v and response %q, want an error only", payload, err, out.String())
+		}
+	}
+}
+
+func TestHelperSymlinkEscape(t *testing.T) {
+	root := helperRoot(t, 1)
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "scaling_max_freq"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// cpu1 leads out of the root, cpu2 to a policy as sysfs links them
+	policy := filepath.Join(root, "devices", "system", "cpu", "cpufreq", "policy2")
+	if err := os.MkdirAll(policy, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(policy, "scaling_max_freq"), []byte("3200000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for cpu, target := range map[int]string{1: outside, 2: "../cpufreq/policy2"} {
+		dir := filepath.Join(root, "devices", "system", "cpu", fmt.Sprintf("cpu%d", cpu))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, filepath.Join(dir, "cpufreq")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	payload, err := json.Marshal(actuator.HelperRequest{Writes: []actuator.Write{
+		{Path: actuator.CPUPath(root, 1, "cpufreq", "scaling_max_freq"), Value: "800000"},
+		{Path: actuator.CPUPath(root, 2, "cpufreq", "scaling_max_freq"), Value: "800000"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	failed, err := actuator.HandleHelperRequest(root, bytes.NewReader(payload), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || !strings.Contains(failed[0].Error(), "leads out of") {
+		t.Errorf("failed writes %v, want the one through cpu1", failed)
+	}
+	if got, _ := os.ReadFile(filepath.Join(outside, "scaling_max_freq")); string(got) != "keep" {
+		t.Errorf("the file out of the root written: %q", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(policy, "scaling_max_freq")); string(got) != "800000" {
+		t.Errorf("policy2: scaling_max_freq %q, want 800000", got)
+	}
+}
+
+func TestHelperSocket(t *testing.T) {
+	root := helperRoot(t, 2)
+	socket := filepath.Join(t.TempDir(), "helper.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			actuator.HandleHelperRequest(root, conn, conn)
+			conn.Close()
+		}
+	}()
+	writes := []actuator.Write{
+		{Path: actuator.CPUPath(root, 0, "cpufreq", "scaling_max_freq"), Value: "800000"},
+		{Path: actuator.CPUPath(root, 1, "cpufreq", "scaling_governor"), Value: "powersave"},
+	}
+	errs := actuator.Helper{Socket: socket}.Apply(context.Background(), writes)
+	if len(errs) != 2 || errs[0] != nil || errs[1] == nil {
+		t.Errorf("got errors %v, want the second write failed", errs)
+	}
+	if got, _ := os.ReadFile(writes[0].Path); string(got) != "800000" {
+		t.Errorf("scaling_max_freq %q, want 800000", got)
+	}
+	// The writes fail together when the helper is not there
+	listener.Close()
+	for i, err := range (actuator.Helper{Socket: socket}).Apply(context.Background(), writes) {
+		if err == nil {
+			t.Errorf("write %d without the helper: no error", i)
+		}
+	}
+}
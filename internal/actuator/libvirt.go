@@ -0,0 +1,77 @@
+package actuator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Virsh tunes the CPU shares of libvirt guests with virsh schedinfo.
+type Virsh struct {
+	// Command is virsh with its global options, e.g.
+	// "virsh -c qemu:///system"; virsh by default
+	Command string
+}
+
+// MinShares and MaxShares bound the cpu_shares libvirt accepts.
+const (
+	MinShares = 2
+	MaxShares = 262144
+)
+
+// ScaledShares returns the original shares scaled by factor within the
+// bounds libvirt accepts.
+func ScaledShares(original int, factor float64) int {
+	shares := int(math.Round(float64(original) * factor))
+	return min(max(shares, MinShares), MaxShares)
+}
+
+// Running reports whether the domain is running or paused, as opposed to
+// shut off or crashed.
+func (v Virsh) Running(ctx context.Context, domain string) (bool, error) {
+	output, err := v.run(ctx, "domstate", domain)
+	if err != nil {
+		return false, err
+	}
+	state := strings.TrimSpace(output)
+	return state == "running" || state == "paused", nil
+}
+
+// Shares returns the cpu_shares of the running domain.
+func (v Virsh) Shares(ctx context.Context, domain string) (int, error) {
+	output, err := v.run(ctx, "schedinfo", domain, "--live")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(name) == "cpu_shares" {
+			return strconv.Atoi(strings.TrimSpace(value))
+		}
+	}
+	return 0, fmt.Errorf("no cpu_shares in the scheduler parameters of %s", domain)
+}
+
+// SetShares sets the cpu_shares of the running domain.
+func (v Virsh) SetShares(ctx context.Context, domain string, shares int) error {
+	_, err := v.run(ctx, "schedinfo", domain, "--live", "--set", "cpu_shares="+strconv.Itoa(shares))
+	return err
+}
+
+func (v Virsh) run(ctx context.Context, args ...string) (string, error) {
+	command := strings.Fields(v.Command)
+	if len(command) == 0 {
+		command = []string{"virsh"}
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], append(command[1:], args...)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("virsh %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,90 @@
+package actuator_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+func TestScaledShares(t *testing.T) {
+	tests := []struct {
+		original int
+		factor   float64
+		want     int
+	}{
+		{1024, 0.5, 512},
+		{1024, 1, 1024},
+		{1000, 0.333, 333},
+		{1000, 0.3335, 334},
+		{1024, 0, actuator.MinShares},
+		{3, 0.1, actuator.MinShares},
+		{200000, 2, actuator.MaxShares},
+	}
+	for _, test := range tests {
+		if got := actuator.ScaledShares(test.original, test.factor); got != test.want {
+			t.Errorf("ScaledShares(%d, %g) = %d, want %d", test.original, test.factor, got, test.want)
+		}
+	}
+}
+
+func TestVirsh(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub virsh is a shell script")
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	stub := filepath.Join(dir, "virsh")
+	script := `#!/bin/sh
+echo "$*" >> ` + calls + `
+shift 2
+case "$1 $2" in
+"domstate web") echo running ;;
+"domstate db") echo "shut off" ;;
+"schedinfo web")
+	echo "Scheduler      : posix"
+	echo "cpu_shares     : 1024"
+	echo "vcpu_period    : 100000" ;;
+*) echo "error: failed to get domain '$2'" >&2; exit 1 ;;
+esac
+`
+	if err := os.WriteFile(stub, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	v := actuator.Virsh{Command: stub + " -c qemu:///system"}
+	ctx := context.Background()
+
+	if running, err := v.Running(ctx, "web"); !running || err != nil {
+		t.Errorf("web: running %t, %v", running, err)
+	}
+	if running, err := v.Running(ctx, "db"); running || err != nil {
+		t.Errorf("db: running %t, %v, want shut off", running, err)
+	}
+	if _, err := v.Running(ctx, "missing"); err == nil || !strings.Contains(err.Error(), "failed to get domain 'missing'") {
+		t.Errorf("missing domain: got error %v", err)
+	}
+	if shares, err := v.Shares(ctx, "web"); shares != 1024 || err != nil {
+		t.Errorf("web: shares %d, %v, want 1024", shares, err)
+	}
+	if err := v.SetShares(ctx, "web", 512); err != nil {
+		t.Error(err)
+	}
+
+	content, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `-c qemu:///system domstate web
+-c qemu:///system domstate db
+-c qemu:///system domstate missing
+-c qemu:///system schedinfo web --live
+-c qemu:///system schedinfo web --live --set cpu_shares=512
+`
+	if string(content) != want {
+		t.Errorf("virsh called with\n%s\nwant\n%s", content, want)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package actuator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// ReadMSR reads the model-specific register of the CPU through the msr
+// driver, which needs the msr module and root.
+func ReadMSR(cpu int, register int64) (uint64, error) {
+	f, err := os.Open(fmt.Sprintf("/dev/cpu/%d/msr", cpu))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var buf [8]byte
+	if _, err := f.ReadAt(buf[:], register); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
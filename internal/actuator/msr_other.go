@@ -0,0 +1,10 @@
+//go:build !linux
+
+package actuator
+
+import e "errors"
+
+// ReadMSR is not supported.
+func ReadMSR(cpu int, register int64) (uint64, error) {
+	return 0, e.ErrUnsupported
+}
@@ -0,0 +1,125 @@
+package actuator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrReadOnly is returned when the BMC does not allow setting the power
+// limit.
+var ErrReadOnly = e.New("the power limit is read-only")
+
+// Redfish limits the power of a chassis, including its fans, PSUs and
+// memory, through the Redfish service of its BMC. It uses the PowerLimit
+// control of the chassis when there is one and the PowerControl of its
+// deprecated Power resource otherwise.
+type Redfish struct {
+	// Chassis is the URL of the chassis, e.g.
+	// https://bmc.example.org/redfish/v1/Chassis/1
+	Chassis  string
+	Username string
+	Password string
+	Client   *http.Client
+	// control is the URL of the PowerLimit control once discovered, or of
+	// the Power resource
+	control string
+	legacy  bool
+}
+
+// SetPowerLimit limits the chassis to watts, or removes the limit when watts
+// is 0.
+func (r *Redfish) SetPowerLimit(ctx context.Context, watts int) error {
+	if r.control == "" {
+		if err := r.discover(ctx); err != nil {
+			return err
+		}
+	}
+	var body any
+	switch {
+	case r.legacy:
+		limit := map[string]any{"LimitInWatts": nil}
+		if watts != 0 {
+			limit["LimitInWatts"] = watts
+		}
+		body = map[string]any{"PowerControl": []any{map[string]any{"PowerLimit": limit}}}
+	case watts != 0:
+		body = map[string]any{"ControlMode": "Automatic", "SetPoint": watts}
+	default:
+		body = map[string]any{"ControlMode": "Disabled"}
+	}
+	status, response, err := r.do(ctx, http.MethodPatch, r.control, body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status < 300:
+		return nil
+	case status == http.StatusMethodNotAllowed,
+		status == http.StatusBadRequest && (strings.Contains(response, "PropertyNotWritable") || strings.Contains(response, "ReadOnly")):
+		return ErrReadOnly
+	}
+	return fmt.Errorf("setting the power limit: HTTP status %d", status)
+}
+
+// discover finds the resource holding the power limit of the chassis.
+func (r *Redfish) discover(ctx context.Context) error {
+	chassis := strings.TrimSuffix(r.Chassis, "/")
+	status, _, err := r.do(ctx, http.MethodGet, chassis+"/Controls/PowerLimit", nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		r.control = chassis + "/Controls/PowerLimit"
+		return nil
+	}
+	status, _, err = r.do(ctx, http.MethodGet, chassis+"/Power", nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("no power limit found at %s: HTTP status %d", chassis, status)
+	}
+	r.control, r.legacy = chassis+"/Power", true
+	return nil
+}
+
+// do sends the request with the JSON body, if any, and returns the status
+// and the response body.
+func (r *Redfish) do(ctx context.Context, method, url string, body any) (int, string, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, "", err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return 0, "", err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.Username != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, string(data), err
+}
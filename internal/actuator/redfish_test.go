@@ -0,0 +1,130 @@
+package actuator_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// redfishBMC is a Redfish stub serving a chassis with the PowerLimit
+// control, or with the legacy Power resource only, recording the PATCH
+// bodies.
+type redfishBMC struct {
+	*httptest.Server
+	legacy bool
+	// readOnly is the response to the PATCH requests when not empty
+	readOnly string
+	mu       sync.Mutex
+	patches  []string
+}
+
+func newRedfishBMC(t *testing.T, legacy bool) *redfishBMC {
+	t.Helper()
+	b := &redfishBMC{legacy: legacy}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "root" || password != "calvin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		control := "/redfish/v1/Chassis/1/Controls/PowerLimit"
+		if b.legacy {
+			control = "/redfish/v1/Chassis/1/Power"
+		}
+		if r.URL.Path != control {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Write([]byte("{}"))
+		case http.MethodPatch:
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get("Content-Type") != "application/json" || !json.Valid(body) {
+				t.Errorf("invalid PATCH %q", body)
+			}
+			b.mu.Lock()
+			b.patches = append(b.patches, string(body))
+			b.mu.Unlock()
+			if b.readOnly != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(b.readOnly))
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+// patched returns the PATCH bodies received since the last call.
+func (b *redfishBMC) patched() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	patches := b.patches
+	b.patches = nil
+	return patches
+}
+
+func TestRedfish(t *testing.T) {
+	tests := []struct {
+		name   string
+		legacy bool
+		// want is the body of the PATCH setting 450 W and of the one
+		// removing the limit
+		want [2]string
+	}{
+		{"PowerLimit control", false, [2]string{`{"ControlMode":"Automatic","SetPoint":450}`, `{"ControlMode":"Disabled"}`}},
+		{"legacy Power resource", true, [2]string{
+			`{"PowerControl":[{"PowerLimit":{"LimitInWatts":450}}]}`,
+			`{"PowerControl":[{"PowerLimit":{"LimitInWatts":null}}]}`,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bmc := newRedfishBMC(t, test.legacy)
+			r := &actuator.Redfish{Chassis: bmc.URL + "/redfish/v1/Chassis/1/", Username: "root", Password: "calvin"}
+			if err := r.SetPowerLimit(context.Background(), 450); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.SetPowerLimit(context.Background(), 0); err != nil {
+				t.Fatal(err)
+			}
+			if patches := bmc.patched(); len(patches) != 2 || patches[0] != test.want[0] || patches[1] != test.want[1] {
+				t.Errorf("PATCH bodies %q, want %q", patches, test.want)
+			}
+		})
+	}
+}
+
+func TestRedfishErrors(t *testing.T) {
+	bmc := newRedfishBMC(t, false)
+	r := &actuator.Redfish{Chassis: bmc.URL + "/redfish/v1/Chassis/1", Username: "root", Password: "wrong"}
+	if err := r.SetPowerLimit(context.Background(), 450); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("wrong password: got error %v", err)
+	}
+	r = &actuator.Redfish{Chassis: bmc.URL + "/redfish/v1/Chassis/2", Username: "root", Password: "calvin"}
+	if err := r.SetPowerLimit(context.Background(), 450); err == nil || !strings.Contains(err.Error(), "no power limit") {
+		t.Errorf("unknown chassis: got error %v", err)
+	}
+
+	bmc.readOnly = `{"error":{"@Message.ExtendedInfo":[{"MessageId":"Base.1.8.PropertyNotWritable"}]}}`
+	r = &actuator.Redfish{Chassis: bmc.URL + "/redfish/v1/Chassis/1", Username: "root", Password: "calvin"}
+	if err := r.SetPowerLimit(context.Background(), 450); !errors.Is(err, actuator.ErrReadOnly) {
+		t.Errorf("read-only limit: got error %v, want ErrReadOnly", err)
+	}
+	bmc.readOnly = `{"error":{"code":"Base.1.8.PropertyValueOutOfRange"}}`
+	if err := r.SetPowerLimit(context.Background(), 45000); err == nil || errors.Is(err, actuator.ErrReadOnly) {
+		t.Errorf("limit out of range: got error %v, want another error", err)
+	}
+}
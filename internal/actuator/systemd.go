@@ -0,0 +1,126 @@
+package actuator
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	systemdName    = "org.freedesktop.systemd1"
+	systemdPath    = dbus.ObjectPath("/org/freedesktop/systemd1")
+	systemdManager = systemdName + ".Manager"
+	propertiesGet  = "org.freedesktop.DBus.Properties.Get"
+)
+
+// NoQuota is the CPUQuotaPerSecUSec of a unit without a CPU quota.
+const NoQuota = math.MaxUint64
+
+// MinQuota is the lowest quota set, 1% of a CPU in microseconds per second.
+const MinQuota = 10000
+
+// ErrUnknownUnit is returned for a unit systemd has no definition of.
+var ErrUnknownUnit = e.New("unknown unit")
+
+// SystemdBus is the part of a D-Bus connection Systemd uses; *dbus.Conn
+// implements it.
+type SystemdBus interface {
+	Object(dest string, path dbus.ObjectPath) dbus.BusObject
+}
+
+// Systemd sets the CPU quotas of slices, services and scopes through the
+// D-Bus API of the systemd manager.
+type Systemd struct {
+	// Bus is the connection to the system bus
+	Bus SystemdBus
+}
+
+// unitProperty is a property set by SetUnitProperties, a(sv) on the bus.
+type unitProperty struct {
+	Name  string
+	Value dbus.Variant
+}
+
+// ScaledQuota returns the quota in microseconds per second scaled by factor.
+// A unit without a quota gets a quota of the CPUs scaled.
+func ScaledQuota(original uint64, factor float64, cpus int) uint64 {
+	if original == NoQuota {
+		original = uint64(cpus) * 1000000
+	}
+	return max(uint64(float64(original)*factor), MinQuota)
+}
+
+// Quota returns the CPUQuotaPerSecUSec of the unit, NoQuota when it has
+// none, or ErrUnknownUnit when systemd has no definition of it.
+func (s Systemd) Quota(ctx context.Context, unit string) (uint64, error) {
+	path, err := s.load(ctx, unit)
+	if err != nil {
+		return 0, err
+	}
+	var quota uint64
+	if err := s.property(ctx, path, unitInterface(unit), "CPUQuotaPerSecUSec", &quota); err != nil {
+		return 0, fmt.Errorf("reading the CPU quota of %s: %w", unit, err)
+	}
+	return quota, nil
+}
+
+// SetQuota sets the CPUQuotaPerSecUSec of the unit at runtime, so that it
+// does not persist over a reboot; NoQuota removes the quota.
+func (s Systemd) SetQuota(ctx context.Context, unit string, quota uint64) error {
+	properties := []unitProperty{{"CPUQuotaPerSecUSec", dbus.MakeVariant(quota)}}
+	err := s.Bus.Object(systemdName, systemdPath).CallWithContext(ctx, systemdManager+".SetUnitProperties", 0,
+		unit, true, properties).Err
+	if err != nil {
+		return fmt.Errorf("setting the CPU quota of %s: %w", unit, unknownUnit(err))
+	}
+	return nil
+}
+
+// load loads the unit and returns its object path.
+func (s Systemd) load(ctx context.Context, unit string) (dbus.ObjectPath, error) {
+	var path dbus.ObjectPath
+	err := s.Bus.Object(systemdName, systemdPath).CallWithContext(ctx, systemdManager+".LoadUnit", 0, unit).Store(&path)
+	if err != nil {
+		return "", fmt.Errorf("loading %s: %w", unit, unknownUnit(err))
+	}
+	var loadState string
+	if err := s.property(ctx, path, systemdName+".Unit", "LoadState", &loadState); err != nil {
+		return "", fmt.Errorf("reading the load state of %s: %w", unit, err)
+	}
+	if loadState == "not-found" {
+		return "", fmt.Errorf("%s: %w", unit, ErrUnknownUnit)
+	}
+	return path, nil
+}
+
+func (s Systemd) property(ctx context.Context, path dbus.ObjectPath, iface, name string, value any) error {
+	var v dbus.Variant
+	if err := s.Bus.Object(systemdName, path).CallWithContext(ctx, propertiesGet, 0, iface, name).Store(&v); err != nil {
+		return err
+	}
+	return v.Store(value)
+}
+
+// unitInterface returns the interface of the cgroup properties of the unit,
+// e.g. org.freedesktop.systemd1.Slice for a slice.
+func unitInterface(unit string) string {
+	kind := unit[strings.LastIndexByte(unit, '.')+1:]
+	if kind == "" {
+		return systemdName + ".Unit"
+	}
+	return systemdName + "." + strings.ToUpper(kind[:1]) + kind[1:]
+}
+
+// unknownUnit maps the error of systemd for a unit it does not know to
+// ErrUnknownUnit.
+func unknownUnit(err error) error {
+	var dbusErr dbus.Error
+	if e.As(err, &dbusErr) && dbusErr.Name == systemdName+".NoSuchUnit" {
+		return fmt.Errorf("%w: %s", ErrUnknownUnit, dbusErr.Error())
+	}
+	return err
+}
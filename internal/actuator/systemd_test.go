@@ -0,0 +1,28 @@
+package actuator_test
+
+import (
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+func TestScaledQuota(t *testing.T) {
+	tests := []struct {
+		original uint64
+		factor   float64
+		cpus     int
+		want     uint64
+	}{
+		{2000000, 0.5, 4, 1000000},
+		{2000000, 1, 4, 2000000},
+		{actuator.NoQuota, 0.5, 4, 2000000},
+		{actuator.NoQuota, 0.25, 1, 250000},
+		{2000000, 0, 4, actuator.MinQuota},
+		{15000, 0.5, 4, actuator.MinQuota},
+	}
+	for _, test := range tests {
+		if got := actuator.ScaledQuota(test.original, test.factor, test.cpus); got != test.want {
+			t.Errorf("ScaledQuota(%d, %g, %d) = %d, want %d", test.original, test.factor, test.cpus, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Package battery reads the state of charge of the battery storage of a site,
+// from a NUT server or from a JSON HTTP endpoint.
+package battery
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Source provides the state of charge of a battery in percent.
+type Source interface {
+	StateOfCharge(ctx context.Context) (float64, error)
+}
+
+// New returns the source at address: nut://host[:port]/ups for a NUT server,
+// or an http or https URL of a JSON document holding the state of charge at
+// the dot-separated field.
+func New(address, field string, client *http.Client) (Source, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "nut":
+		ups := strings.Trim(u.Path, "/")
+		if ups == "" {
+			return nil, fmt.Errorf("no UPS in %s, expected nut://host/ups", address)
+		}
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "3493")
+		}
+		return &NUT{Address: host, UPS: ups}, nil
+	case "http", "https":
+		return &HTTP{URL: address, Field: field, Client: client}, nil
+	}
+	return nil, fmt.Errorf("unsupported battery source %s, expected nut, http or https", address)
+}
+
+// NUT reads battery.charge of a UPS from upsd, the server of Network UPS
+// Tools, with its text protocol like upsc.
+type NUT struct {
+	// Address is the host:port of upsd
+	Address string
+	UPS     string
+}
+
+func (n *NUT) StateOfCharge(ctx context.Context) (float64, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.Address)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if _, err := fmt.Fprintf(conn, "GET VAR %s battery.charge\n", n.UPS); err != nil {
+		return 0, err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.WriteString(conn, "LOGOUT\n")
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "ERR ") {
+		return 0, fmt.Errorf("upsd: %s", strings.TrimPrefix(line, "ERR "))
+	}
+	prefix := fmt.Sprintf("VAR %s battery.charge ", n.UPS)
+	if !strings.HasPrefix(line, prefix) {
+		return 0, fmt.Errorf("unexpected upsd response %q", line)
+	}
+	return strconv.ParseFloat(strings.Trim(strings.TrimPrefix(line, prefix), `"`), 64)
+}
+
+// HTTP reads the state of charge from a JSON document, e.g. of a battery
+// management system.
+type HTTP struct {
+	URL string
+	// Field is the dot-separated path to the state of charge in the
+	// document, soc by default
+	Field  string
+	Client *http.Client
+}
+
+func (h *HTTP) StateOfCharge(ctx context.Context) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+	var document any
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&document); err != nil {
+		return 0, err
+	}
+	field := h.Field
+	if field == "" {
+		field = "soc"
+	}
+	value := document
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return 0, fmt.Errorf("no field %s in the document", field)
+		}
+		if value, ok = object[key]; !ok {
+			return 0, fmt.Errorf("no field %s in the document", field)
+		}
+	}
+	switch soc := value.(type) {
+	case float64:
+		return soc, nil
+	case string:
+		return strconv.ParseFloat(soc, 64)
+	}
+	return 0, fmt.Errorf("field %s is not a number", field)
+}
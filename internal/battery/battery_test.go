@@ -0,0 +1,129 @@
+package battery_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/battery"
+)
+
+// upsd serves the NUT text protocol with the battery.charge of the UPS ups,
+// returning its address.
+func upsd(t *testing.T, charge string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				switch line := scanner.Text(); line {
+				case "GET VAR ups battery.charge":
+					conn.Write([]byte("VAR ups battery.charge \"" + charge + "\"\n"))
+				case "LOGOUT":
+					conn.Write([]byte("OK Goodbye\n"))
+				default:
+					if strings.HasPrefix(line, "GET VAR ") {
+						conn.Write([]byte("ERR UNKNOWN-UPS\n"))
+					}
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestNUT(t *testing.T) {
+	address := upsd(t, "87.5")
+	source, err := battery.New("nut://"+address+"/ups", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if soc, err := source.StateOfCharge(context.Background()); soc != 87.5 || err != nil {
+		t.Errorf("state of charge %g, %v, want 87.5", soc, err)
+	}
+	missing := &battery.NUT{Address: address, UPS: "other"}
+	if _, err := missing.StateOfCharge(context.Background()); err == nil || err.Error() != "upsd: UNKNOWN-UPS" {
+		t.Errorf("unknown UPS: got error %v", err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bms":
+			w.Write([]byte(`{"soc": 64, "battery": {"status": {"soc": "71.5"}, "name": "rack"}}`))
+		case "/invalid":
+			w.Write([]byte(`{"soc": `))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	tests := []struct {
+		path, field string
+		want        float64
+		err         string
+	}{
+		{"/bms", "", 64, ""},
+		{"/bms", "battery.status.soc", 71.5, ""},
+		{"/bms", "battery.charge", 0, "no field battery.charge in the document"},
+		{"/bms", "soc.value", 0, "no field soc.value in the document"},
+		{"/bms", "battery.status", 0, "field battery.status is not a number"},
+		{"/invalid", "", 0, "unexpected EOF"},
+		{"/missing", "", 0, "HTTP status 404"},
+	}
+	for _, test := range tests {
+		source, err := battery.New(server.URL+test.path, test.field, server.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		soc, err := source.StateOfCharge(context.Background())
+		if soc != test.want || (err == nil) != (test.err == "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("%s %s: state of charge %g, %v, want %g, %q", test.path, test.field, soc, err, test.want, test.err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		address string
+		want    battery.Source
+	}{
+		{"nut://ups.example.org/ups", &battery.NUT{Address: "ups.example.org:3493", UPS: "ups"}},
+		{"nut://ups.example.org:3500/ups", &battery.NUT{Address: "ups.example.org:3500", UPS: "ups"}},
+		{"nut://ups.example.org", nil},
+		{"https://bms.example.org/api", &battery.HTTP{URL: "https://bms.example.org/api"}},
+		{"modbus://bms.example.org", nil},
+	}
+	for _, test := range tests {
+		source, err := battery.New(test.address, "", nil)
+		switch want := test.want.(type) {
+		case nil:
+			if err == nil {
+				t.Errorf("%s: got %+v, want an error", test.address, source)
+			}
+		case *battery.NUT:
+			if got, ok := source.(*battery.NUT); !ok || *got != *want || err != nil {
+				t.Errorf("%s: got %+v, %v, want %+v", test.address, source, err, want)
+			}
+		case *battery.HTTP:
+			if got, ok := source.(*battery.HTTP); !ok || got.URL != want.URL || err != nil {
+				t.Errorf("%s: got %+v, %v, want %+v", test.address, source, err, want)
+			}
+		}
+	}
+}
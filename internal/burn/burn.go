@@ -0,0 +1,88 @@
+// Package burn loads CPUs to a target utilization, to make the effect of
+// frequency scaling visible on power meters in demos.
+package burn
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Period is the length of a duty cycle: busy for the load's share of it and
+// idle for the rest.
+const Period = 100 * time.Millisecond
+
+// ParseCPUs parses a CPU list like the kernel's, e.g. "0-3,6", into the
+// sorted CPU numbers.
+func ParseCPUs(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(first)
+		to := from
+		if err == nil && isRange {
+			to, err = strconv.Atoi(last)
+		}
+		if err != nil || from < 0 || to < from {
+			return nil, fmt.Errorf("invalid CPU list %q, expected e.g. 0-3,6", list)
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	slices.Sort(cpus)
+	return slices.Compact(cpus), nil
+}
+
+// Duty splits the period into the busy and the idle time for the load in
+// percent, clamped to 0 to 100.
+func Duty(load float64, period time.Duration) (busy, idle time.Duration) {
+	load = min(max(load, 0), 100)
+	busy = time.Duration(float64(period) * load / 100)
+	return busy, period - busy
+}
+
+// Run loads each of the CPUs to load percent until ctx is done, from a
+// goroutine pinned to it where the platform allows. It returns the errors
+// pinning the goroutines, which keep running unpinned.
+func Run(ctx context.Context, cpus []int, load float64) error {
+	busy, idle := Duty(load, Period)
+	var wg sync.WaitGroup
+	errs := make([]error, len(cpus))
+	for i, cpu := range cpus {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			if err := pin(cpu); err != nil {
+				errs[i] = fmt.Errorf("pinning to CPU %d: %w", cpu, err)
+			}
+			spin(ctx, busy, idle)
+		}()
+	}
+	wg.Wait()
+	return e.Join(errs...)
+}
+
+// spin alternates busy looping for busy and sleeping for idle until ctx is
+// done.
+func spin(ctx context.Context, busy, idle time.Duration) {
+	for ctx.Err() == nil {
+		for end := time.Now().Add(busy); time.Now().Before(end); {
+		}
+		if idle == 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(idle):
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package burn_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/burn"
+)
+
+func TestParseCPUs(t *testing.T) {
+	tests := []struct {
+		list string
+		want []int
+	}{
+		{"0", []int{0}},
+		{"0-3", []int{0, 1, 2, 3}},
+		{"6, 0-2,1", []int{0, 1, 2, 6}},
+		{"4-4", []int{4}},
+		{"", nil},
+		{"3-1", nil},
+		{"-1", nil},
+		{"0-", nil},
+		{"a", nil},
+	}
+	for _, test := range tests {
+		got, err := burn.ParseCPUs(test.list)
+		if (err != nil) != (test.want == nil) || !slices.Equal(got, test.want) {
+			t.Errorf("ParseCPUs(%q) = %v, %v, want %v", test.list, got, err, test.want)
+		}
+	}
+}
+
+func TestDuty(t *testing.T) {
+	tests := []struct {
+		load       float64
+		busy, idle time.Duration
+	}{
+		{70, 70 * time.Millisecond, 30 * time.Millisecond},
+		{100, 100 * time.Millisecond, 0},
+		{0.5, 500 * time.Microsecond, 99500 * time.Microsecond},
+		{150, 100 * time.Millisecond, 0},
+		{-5, 0, 100 * time.Millisecond},
+	}
+	for _, test := range tests {
+		busy, idle := burn.Duty(test.load, burn.Period)
+		if busy != test.busy || idle != test.idle {
+			t.Errorf("Duty(%g) = %s busy, %s idle, want %s and %s", test.load, busy, idle, test.busy, test.idle)
+		}
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*burn.Period)
+	defer cancel()
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Pinning may be refused in containers; the load runs unpinned then
+		burn.Run(ctx, []int{0}, 10)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was done")
+	}
+	if elapsed := time.Since(start); elapsed < 3*burn.Period {
+		t.Errorf("Run returned after %s, before the context was done", elapsed)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package burn
+
+import "golang.org/x/sys/unix"
+
+// cpuSet returns the affinity mask of the CPU alone.
+func cpuSet(cpu int) unix.CPUSet {
+	var set unix.CPUSet
+	set.Set(cpu)
+	return set
+}
+
+// pin restricts the calling thread to the CPU.
+func pin(cpu int) error {
+	set := cpuSet(cpu)
+	return unix.SchedSetaffinity(0, &set)
+}
@@ -0,0 +1,12 @@
+package burn
+
+import "testing"
+
+func TestCPUSet(t *testing.T) {
+	for _, cpu := range []int{0, 5, 63, 64, 1023} {
+		set := cpuSet(cpu)
+		if !set.IsSet(cpu) || set.Count() != 1 {
+			t.Errorf("cpuSet(%d) has %d CPUs, CPU %d set: %t", cpu, set.Count(), cpu, set.IsSet(cpu))
+		}
+	}
+}
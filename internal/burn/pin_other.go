@@ -0,0 +1,10 @@
+//go:build !linux
+
+package burn
+
+import e "errors"
+
+// pin is not supported; the goroutines run wherever they are scheduled.
+func pin(cpu int) error {
+	return e.ErrUnsupported
+}
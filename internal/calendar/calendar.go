@@ -0,0 +1,97 @@
+// Package calendar tells workdays from weekends and Czech public holidays,
+// on which the prices are structurally lower.
+package calendar
+
+import (
+	"fmt"
+	"time"
+)
+
+// The types of days.
+const (
+	Workday = "workday"
+	Weekend = "weekend"
+	Holiday = "holiday"
+)
+
+// DayTypes lists the types of days.
+var DayTypes = []string{Workday, Weekend, Holiday}
+
+// Holidays are the Czech public holidays falling on the same date every
+// year, as MM-DD. Good Friday and Easter Monday move with Easter.
+var Holidays = []string{
+	"01-01", // Restoration Day of the Independent Czech State, New Year's Day
+	"05-01", // Labour Day
+	"05-08", // Liberation Day
+	"07-05", // Saints Cyril and Methodius Day
+	"07-06", // Jan Hus Day
+	"09-28", // St. Wenceslas Day
+	"10-28", // Independent Czechoslovak State Day
+	"11-17", // Struggle for Freedom and Democracy Day
+	"12-24", // Christmas Eve
+	"12-25", // Christmas Day
+	"12-26", // St. Stephen's Day
+}
+
+// Calendar tells the type of days from Holidays, Easter and extra holidays.
+type Calendar struct {
+	// yearly holds the holidays as MM-DD, dates the one-off ones as
+	// YYYY-MM-DD
+	yearly map[string]bool
+	dates  map[string]bool
+}
+
+// New returns the calendar of the Czech holidays with the extra ones, given
+// as YYYY-MM-DD for a single day or MM-DD for every year.
+func New(extra []string) (*Calendar, error) {
+	c := &Calendar{yearly: make(map[string]bool), dates: make(map[string]bool)}
+	for _, day := range Holidays {
+		c.yearly[day] = true
+	}
+	for _, day := range extra {
+		if _, err := time.Parse("2006-01-02", day); err == nil {
+			c.dates[day] = true
+		} else if _, err := time.Parse("01-02", day); err == nil {
+			c.yearly[day] = true
+		} else {
+			return nil, fmt.Errorf("invalid holiday %q, expected YYYY-MM-DD or MM-DD", day)
+		}
+	}
+	return c, nil
+}
+
+// DayType returns the type of the day of t in its location. A holiday on a
+// weekend is a holiday.
+func (c *Calendar) DayType(t time.Time) string {
+	if c.yearly[t.Format("01-02")] || c.dates[t.Format("2006-01-02")] {
+		return Holiday
+	}
+	easter := Easter(t.Year())
+	for _, offset := range []int{-2, 1} {
+		day := easter.AddDate(0, 0, offset)
+		if t.Month() == day.Month() && t.Day() == day.Day() {
+			return Holiday
+		}
+	}
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return Weekend
+	}
+	return Workday
+}
+
+// Easter returns the date of Easter Sunday of the Gregorian year, at
+// midnight UTC.
+func Easter(year int) time.Time {
+	// The anonymous Gregorian algorithm
+	a, b, c := year%19, year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,86 @@
+package calendar_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/calendar"
+)
+
+func TestEaster(t *testing.T) {
+	tests := []struct {
+		year int
+		want string
+	}{
+		{2019, "2019-04-21"},
+		{2024, "2024-03-31"},
+		{2025, "2025-04-20"},
+		{2038, "2038-04-25"},
+		{2285, "2285-03-22"},
+	}
+	for _, test := range tests {
+		if got := calendar.Easter(test.year).Format(time.DateOnly); got != test.want {
+			t.Errorf("Easter(%d) = %s, want %s", test.year, got, test.want)
+		}
+	}
+}
+
+func TestDayType(t *testing.T) {
+	c, err := calendar.New([]string{"2024-11-18", "12-31"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		day  string
+		want string
+	}{
+		// The week of Easter 2024
+		{"2024-03-28", calendar.Workday},
+		{"2024-03-29", calendar.Holiday},
+		{"2024-03-30", calendar.Weekend},
+		{"2024-03-31", calendar.Weekend},
+		{"2024-04-01", calendar.Holiday},
+		{"2024-04-02", calendar.Workday},
+		// Easter 2025 falls in April
+		{"2025-04-18", calendar.Holiday},
+		{"2025-04-21", calendar.Holiday},
+		{"2025-03-28", calendar.Workday},
+		// A holiday on a weekend
+		{"2024-09-28", calendar.Holiday},
+		{"2024-12-24", calendar.Holiday},
+		// The extra holidays, once and every year
+		{"2024-11-18", calendar.Holiday},
+		{"2025-11-18", calendar.Workday},
+		{"2024-12-31", calendar.Holiday},
+		{"2025-12-31", calendar.Holiday},
+	}
+	for _, test := range tests {
+		day, err := time.ParseInLocation(time.DateOnly, test.day, prague)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// From the first to the last minute, on the DST days too
+		last := time.Date(day.Year(), day.Month(), day.Day(), 23, 59, 0, 0, prague)
+		for _, at := range []time.Time{day, last} {
+			if got := c.DayType(at); got != test.want {
+				t.Errorf("DayType(%s) = %s, want %s", at, got, test.want)
+			}
+		}
+	}
+	// The day is that of the location of the time
+	if got := c.DayType(time.Date(2024, time.March, 28, 23, 30, 0, 0, time.UTC).In(prague)); got != calendar.Holiday {
+		t.Errorf("Good Friday 00:30 in Prague: got %s, want %s", got, calendar.Holiday)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, extra := range []string{"2024-13-01", "31-12", "tomorrow", "2024-02-30"} {
+		if _, err := calendar.New([]string{extra}); err == nil {
+			t.Errorf("holiday %q: no error", extra)
+		}
+	}
+}
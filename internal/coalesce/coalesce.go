@@ -0,0 +1,172 @@
+// Package coalesce shares the requests of several components for the prices
+// of overlapping windows, so that a cycle calls the source once per market.
+//
+// Concurrent requests for a window within that of a pending request wait for
+// it instead of calling the source. A request overlapping windows fetched
+// earlier in the cycle fetches their union, so that the later requests of the
+// cycle are served from it. The results are sliced to the window of each
+// request. Errors are shared with the waiting requests but not kept.
+package coalesce
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// The markets, see Source.OnShared.
+const (
+	MarketIntraday = "intraday"
+	MarketDayAhead = "day-ahead"
+	MarketDamIndex = "dam-index"
+)
+
+// Source is an ote.PriceSource coalescing the requests to its source.
+type Source struct {
+	source ote.PriceSource
+	// OnShared, if set, is called when a request of the market is served
+	// without calling the source
+	OnShared func(market string)
+
+	intraday group[int, ote.PricePoint]
+	dayAhead group[string, ote.PricePoint]
+	damIndex group[string, ote.DamIndex]
+}
+
+var _ ote.PriceSource = (*Source)(nil)
+
+// New returns the source coalescing the requests to source.
+func New(source ote.PriceSource) *Source {
+	return &Source{source: source}
+}
+
+// Reset forgets the windows fetched so far, e.g. at the start of a cycle;
+// the pending requests are still shared.
+func (s *Source) Reset() {
+	s.intraday.reset()
+	s.dayAhead.reset()
+	s.damIndex.reset()
+}
+
+// ImPrices returns the intraday prices of the hours of the day.
+func (s *Source) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	points, shared, err := s.intraday.do(ctx, day, fromHour, toHour,
+		func(from, to int) ([]ote.PricePoint, error) { return s.source.ImPrices(ctx, day, from, to) },
+		func(p ote.PricePoint) int { return p.Hour })
+	s.shared(MarketIntraday, shared)
+	return points, err
+}
+
+// DamPrices returns the day-ahead prices of the days.
+func (s *Source) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	points, shared, err := s.dayAhead.do(ctx, "", from, to,
+		func(from, to string) ([]ote.PricePoint, error) { return s.source.DamPrices(ctx, from, to) },
+		func(p ote.PricePoint) string { return dateOnly(p.Date) })
+	s.shared(MarketDayAhead, shared)
+	return points, err
+}
+
+// DamIndex returns the day-ahead indexes of the days.
+func (s *Source) DamIndex(ctx context.Context, from, to string) ([]ote.DamIndex, error) {
+	indexes, shared, err := s.damIndex.do(ctx, "", from, to,
+		func(from, to string) ([]ote.DamIndex, error) { return s.source.DamIndex(ctx, from, to) },
+		func(i ote.DamIndex) string { return dateOnly(i.Date) })
+	s.shared(MarketDamIndex, shared)
+	return indexes, err
+}
+
+func (s *Source) shared(market string, shared bool) {
+	if shared && s.OnShared != nil {
+		s.OnShared(market)
+	}
+}
+
+// dateOnly returns the date without the time zone offset it may come with.
+func dateOnly(date string) string {
+	return date[:min(len(date), len(time.DateOnly))]
+}
+
+// call is a request to the source for the window from..to, inclusive.
+type call[B cmp.Ordered, T any] struct {
+	from, to B
+	done     chan struct{}
+	// result and err are set once done is closed
+	result []T
+	err    error
+}
+
+// group coalesces the requests of a market, by key, e.g. the day.
+type group[B cmp.Ordered, T any] struct {
+	mu    sync.Mutex
+	calls map[string][]*call[B, T]
+}
+
+func (g *group[B, T]) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls = nil
+}
+
+// do returns the items of the window from..to, at bound of each, and
+// whether they were served by another request. fetch calls the source.
+func (g *group[B, T]) do(ctx context.Context, key string, from, to B, fetch func(from, to B) ([]T, error), bound func(T) B) ([]T, bool, error) {
+	g.mu.Lock()
+	for _, c := range g.calls[key] {
+		if c.from <= from && to <= c.to {
+			g.mu.Unlock()
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				return nil, true, ctx.Err()
+			}
+			return slice(c.result, from, to, bound), true, c.err
+		}
+	}
+	c := &call[B, T]{from: from, to: to, done: make(chan struct{})}
+	for _, done := range g.calls[key] {
+		// The pending calls cannot be extended any more
+		if isDone(done) && done.from <= to && from <= done.to {
+			c.from, c.to = min(c.from, done.from), max(c.to, done.to)
+		}
+	}
+	if g.calls == nil {
+		g.calls = make(map[string][]*call[B, T])
+	}
+	g.calls[key] = append(g.calls[key], c)
+	g.mu.Unlock()
+
+	c.result, c.err = fetch(c.from, c.to)
+	if c.err != nil {
+		g.mu.Lock()
+		if calls := g.calls[key]; calls != nil {
+			g.calls[key] = slices.DeleteFunc(calls, func(other *call[B, T]) bool { return other == c })
+		}
+		g.mu.Unlock()
+	}
+	close(c.done)
+	return slice(c.result, from, to, bound), false, c.err
+}
+
+func isDone[B cmp.Ordered, T any](c *call[B, T]) bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// slice returns a copy of the items within from..to.
+func slice[B cmp.Ordered, T any](items []T, from, to B, bound func(T) B) []T {
+	var sliced []T
+	for _, item := range items {
+		if b := bound(item); from <= b && b <= to {
+			sliced = append(sliced, item)
+		}
+	}
+	return sliced
+}
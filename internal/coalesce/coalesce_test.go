@@ -0,0 +1,180 @@
+package coalesce_test
+
+import (
+	"context"
+	e "errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/coalesce"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+// gatedSource serves the intraday prices of 24 hours once its gate is
+// open, counting the calls.
+type gatedSource struct {
+	*otetest.Fake
+	gate  chan struct{}
+	calls atomic.Int32
+}
+
+func (s *gatedSource) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	s.calls.Add(1)
+	<-s.gate
+	var prices []float64
+	for hour := fromHour; hour <= toHour; hour++ {
+		prices = append(prices, float64(hour))
+	}
+	return otetest.Points(day, fromHour, prices...), nil
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	upstream := &gatedSource{Fake: otetest.NewFake(), gate: make(chan struct{})}
+	s := coalesce.New(upstream)
+	var shared atomic.Int32
+	s.OnShared = func(market string) {
+		if market == coalesce.MarketIntraday {
+			shared.Add(1)
+		}
+	}
+	ctx := context.Background()
+
+	// The whole day is requested first, then windows within it and the
+	// whole day again
+	whole := make(chan []ote.PricePoint)
+	go func() {
+		points, _ := s.ImPrices(ctx, "2024-10-01", 1, 24)
+		whole <- points
+	}()
+	// Until the first request is pending
+	for upstream.calls.Load() == 0 {
+		runtime.Gosched()
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			from, to := 1+i%4, 8+i%4
+			if i%5 == 0 {
+				from, to = 1, 24
+			}
+			points, err := s.ImPrices(ctx, "2024-10-01", from, to)
+			if err == nil && (len(points) != to-from+1 || points[0].Hour != from || points[len(points)-1].Price != float64(to)) {
+				err = e.New("wrong window")
+			}
+			if err != nil {
+				errs <- err
+			}
+		}()
+	}
+	close(upstream.gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if points := <-whole; len(points) != 24 {
+		t.Errorf("%d points of the first request, want 24", len(points))
+	}
+	if n := upstream.calls.Load(); n != 1 {
+		t.Errorf("%d upstream calls, want 1", n)
+	}
+	if n := shared.Load(); n != 20 {
+		t.Errorf("%d requests shared, want 20", n)
+	}
+}
+
+func TestOverlappingWindows(t *testing.T) {
+	upstream := otetest.NewFake().
+		AddImPrices(otetest.Points("2024-10-01", 1, 10, 20, 30, 40), nil).
+		AddImPrices(otetest.Points("2024-10-01", 1, 10, 20, 30, 40, 50, 60), nil).
+		AddImPrices(otetest.Points("2024-10-01", 3, 31), nil)
+	s := coalesce.New(upstream)
+	ctx := context.Background()
+	prices := func(from, to int) []float64 {
+		t.Helper()
+		points, err := s.ImPrices(ctx, "2024-10-01", from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ote.Prices(points)
+	}
+
+	prices(1, 4)
+	// Overlapping the window fetched, the union is fetched
+	if got := prices(3, 6); len(got) != 4 || got[0] != 30 || got[3] != 60 {
+		t.Errorf("prices %v of hours 3 to 6", got)
+	}
+	// and serves the next ones
+	if got := prices(2, 5); len(got) != 4 || got[0] != 20 {
+		t.Errorf("prices %v of hours 2 to 5", got)
+	}
+	calls := upstream.Calls()
+	if len(calls) != 2 || calls[1].Args[1] != 1 || calls[1].Args[2] != 6 {
+		t.Fatalf("calls %v, want hours 1 to 4 then 1 to 6", calls)
+	}
+
+	// A new cycle fetches afresh
+	s.Reset()
+	if got := prices(3, 3); len(got) != 1 || got[0] != 31 || len(upstream.Calls()) != 3 {
+		t.Errorf("prices %v after the reset, calls %v", got, upstream.Calls())
+	}
+}
+
+func TestDayAheadWindows(t *testing.T) {
+	first := otetest.Points("2024-10-01", 1, 10)
+	second := otetest.Points("2024-10-02", 1, 20)
+	// The day-ahead dates may come with the time zone offset
+	second[0].Date = "2024-10-02+02:00"
+	upstream := otetest.NewFake().AddDamPrices(append(first, second...), nil)
+	s := coalesce.New(upstream)
+	var shared []string
+	s.OnShared = func(market string) { shared = append(shared, market) }
+	ctx := context.Background()
+
+	if points, err := s.DamPrices(ctx, "2024-10-01", "2024-10-02"); err != nil || len(points) != 2 {
+		t.Fatalf("points %v, %v", points, err)
+	}
+	if points, err := s.DamPrices(ctx, "2024-10-02", "2024-10-02"); err != nil || len(points) != 1 || points[0].Price != 20 {
+		t.Errorf("points %v, %v of the second day", points, err)
+	}
+	if len(upstream.Calls()) != 1 || len(shared) != 1 || shared[0] != coalesce.MarketDayAhead {
+		t.Errorf("calls %v, shared %v, want one call", upstream.Calls(), shared)
+	}
+}
+
+func TestErrorsNotKept(t *testing.T) {
+	down := e.New("connection refused")
+	upstream := otetest.NewFake().
+		AddImPrices(nil, down).
+		AddImPrices(otetest.Points("2024-10-01", 1, 10), nil)
+	s := coalesce.New(upstream)
+	ctx := context.Background()
+	if _, err := s.ImPrices(ctx, "2024-10-01", 1, 1); !e.Is(err, down) {
+		t.Errorf("error %v, want that of the source", err)
+	}
+	if points, err := s.ImPrices(ctx, "2024-10-01", 1, 1); err != nil || len(points) != 1 || len(upstream.Calls()) != 2 {
+		t.Errorf("points %v, %v after %d calls, want the request retried", points, err, len(upstream.Calls()))
+	}
+}
+
+func TestCancelledWait(t *testing.T) {
+	upstream := &gatedSource{Fake: otetest.NewFake(), gate: make(chan struct{})}
+	defer close(upstream.gate)
+	s := coalesce.New(upstream)
+	go s.ImPrices(context.Background(), "2024-10-01", 1, 24)
+	// Until the first request is pending
+	for upstream.calls.Load() == 0 {
+		runtime.Gosched()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.ImPrices(ctx, "2024-10-01", 1, 2); !e.Is(err, context.Canceled) {
+		t.Errorf("error %v, want the wait cancelled", err)
+	}
+}
@@ -0,0 +1,225 @@
+// Package expr evaluates the small arithmetic expressions of the decision
+// metric, e.g. "0.7*price_pctl + 0.3*price_ewma": numbers, identifiers,
+// + - * / and parentheses, with the usual precedence.
+package expr
+
+import (
+	e "errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrDivisionByZero is returned when an expression divides by zero.
+var ErrDivisionByZero = e.New("division by zero")
+
+// Expr is a parsed expression.
+type Expr struct {
+	src  string
+	root node
+}
+
+type node interface {
+	eval(vars map[string]float64) (float64, error)
+}
+
+type number float64
+
+type identifier string
+
+type negation struct{ operand node }
+
+type binary struct {
+	op          byte
+	left, right node
+}
+
+func (n number) eval(map[string]float64) (float64, error) { return float64(n), nil }
+
+func (n identifier) eval(vars map[string]float64) (float64, error) {
+	v, ok := vars[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("no value of %s", string(n))
+	}
+	return v, nil
+}
+
+func (n negation) eval(vars map[string]float64) (float64, error) {
+	v, err := n.operand.eval(vars)
+	return -v, err
+}
+
+func (n binary) eval(vars map[string]float64) (float64, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	}
+	if right == 0 {
+		return 0, ErrDivisionByZero
+	}
+	return left / right, nil
+}
+
+// Parse parses the expression, accepting only the identifiers in names.
+func Parse(src string, names []string) (*Expr, error) {
+	p := &parser{src: src, names: names}
+	p.next()
+	root, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		return nil, p.errorf("unexpected %q", p.token)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// Eval returns the value of the expression with the values of the
+// identifiers.
+func (x *Expr) Eval(vars map[string]float64) (float64, error) {
+	return x.root.eval(vars)
+}
+
+// String returns the source of the expression.
+func (x *Expr) String() string {
+	return x.src
+}
+
+// parser is a recursive descent parser of the expressions, reading one token
+// ahead.
+type parser struct {
+	src   string
+	names []string
+	pos   int
+	// token is the current token, empty at the end
+	token string
+	// start is the offset of the token
+	start int
+}
+
+// next reads the next token.
+func (p *parser) next() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	p.start = p.pos
+	if p.pos == len(p.src) {
+		p.token = ""
+		return
+	}
+	c := rune(p.src[p.pos])
+	switch {
+	case unicode.IsDigit(c) || c == '.':
+		for p.pos < len(p.src) && (unicode.IsDigit(rune(p.src[p.pos])) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+	case unicode.IsLetter(c) || c == '_':
+		for p.pos < len(p.src) && (unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos])) || p.src[p.pos] == '_') {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.token = p.src[p.start:p.pos]
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s at offset %d of %q", fmt.Sprintf(format, args...), p.start, p.src)
+}
+
+// expression := term (("+" | "-") term)*
+func (p *parser) expression() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.token == "+" || p.token == "-" {
+		op := p.token[0]
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op, left, right}
+	}
+	return left, nil
+}
+
+// term := unary (("*" | "/") unary)*
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.token == "*" || p.token == "/" {
+		op := p.token[0]
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op, left, right}
+	}
+	return left, nil
+}
+
+// unary := "-" unary | primary
+func (p *parser) unary() (node, error) {
+	if p.token == "-" {
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negation{operand}, nil
+	}
+	return p.primary()
+}
+
+// primary := number | identifier | "(" expression ")"
+func (p *parser) primary() (node, error) {
+	token := p.token
+	switch {
+	case token == "":
+		return nil, p.errorf("unexpected end")
+	case token == "(":
+		p.next()
+		inner, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if p.token != ")" {
+			return nil, p.errorf("missing )")
+		}
+		p.next()
+		return inner, nil
+	case unicode.IsDigit(rune(token[0])) || token[0] == '.':
+		v, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", token)
+		}
+		p.next()
+		return number(v), nil
+	case unicode.IsLetter(rune(token[0])) || token[0] == '_':
+		if !slices.Contains(p.names, token) {
+			return nil, p.errorf("unknown identifier %q, expected one of %s", token, strings.Join(p.names, ", "))
+		}
+		p.next()
+		return identifier(token), nil
+	}
+	return nil, p.errorf("unexpected %q", token)
+}
@@ -0,0 +1,84 @@
+package expr_test
+
+import (
+	e "errors"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/expr"
+)
+
+var names = []string{"price", "price_ewma", "price_pctl"}
+
+func TestEval(t *testing.T) {
+	vars := map[string]float64{"price": 100, "price_ewma": 80, "price_pctl": 0.5}
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		{"42", 42},
+		{".5", 0.5},
+		{"price", 100},
+		{"0.7*price_pctl + 0.3*price_ewma", 0.35 + 24},
+		// * and / bind tighter than + and -, each left to right
+		{"1 + 2 * 3", 7},
+		{"10 - 4 - 3", 3},
+		{"64 / 4 / 2", 8},
+		{"2 * 3 / 4", 1.5},
+		{"1 - 2 * 3 + 4", -1},
+		{"(1 + 2) * 3", 9},
+		{"((price - price_ewma)) / 4", 5},
+		{"-price + 150", 50},
+		{"--2", 2},
+		{"-(1 + 1) * -3", 6},
+		{"2 * -3", -6},
+		{"  price_pctl*( 1-price_pctl )  ", 0.25},
+	}
+	for _, test := range tests {
+		x, err := expr.Parse(test.src, names)
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		if got, err := x.Eval(vars); err != nil || got != test.want {
+			t.Errorf("%q: %g, %v, want %g", test.src, got, err, test.want)
+		}
+		if x.String() != test.src {
+			t.Errorf("%q: String %q", test.src, x.String())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"", `unexpected end at offset 0 of ""`},
+		{"carbon_pctl", `unknown identifier "carbon_pctl", expected one of price, price_ewma, price_pctl at offset 0 of "carbon_pctl"`},
+		{"price +", `unexpected end at offset 7 of "price +"`},
+		{"(price", `missing ) at offset 6 of "(price"`},
+		{"price)", `unexpected ")" at offset 5 of "price)"`},
+		{"price price", `unexpected "price" at offset 6 of "price price"`},
+		{"1.2.3", `invalid number "1.2.3" at offset 0 of "1.2.3"`},
+		{"2 ^ 3", `unexpected "^" at offset 2 of "2 ^ 3"`},
+		{"* 2", `unexpected "*" at offset 0 of "* 2"`},
+	}
+	for _, test := range tests {
+		if _, err := expr.Parse(test.src, names); err == nil || err.Error() != test.want {
+			t.Errorf("%q: error %v, want %s", test.src, err, test.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	x, err := expr.Parse("price / (price_pctl - 0.5)", names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x.Eval(map[string]float64{"price": 100, "price_pctl": 0.5}); !e.Is(err, expr.ErrDivisionByZero) {
+		t.Errorf("error %v, want division by zero", err)
+	}
+	if _, err := x.Eval(map[string]float64{"price": 100}); err == nil || !strings.Contains(err.Error(), "no value of price_pctl") {
+		t.Errorf("error %v without a value", err)
+	}
+}
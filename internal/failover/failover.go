@@ -0,0 +1,221 @@
+// Package failover serves the prices from the first healthy of several
+// sources in order of priority, e.g. a peer, OTE and a file.
+//
+// A source failing Failures times in a row is unhealthy: it is skipped, and
+// only tried again, probed, once Probe passed since its last failure. The
+// prices of each source are converted to EUR/MWh before they are returned,
+// so that the policies see the same prices whichever source served them.
+package failover
+
+import (
+	"context"
+	e "errors"
+	"sync"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// Member is a source of the prices.
+type Member struct {
+	Name   string
+	Source ote.PriceSource
+	// Factor converts its prices of both markets, which it serves in the
+	// same unit, to EUR/MWh, 1 when 0
+	Factor float64
+}
+
+// Health is the health of a member.
+type Health struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	// Failures counts the failures in a row
+	Failures    int        `json:"failures,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastFailure *time.Time `json:"lastFailure,omitempty"`
+}
+
+// Source is an ote.PriceSource serving the prices of its members.
+type Source struct {
+	members []Member
+	// Failures in a row mark a member unhealthy, Probe is how long it is
+	// then skipped
+	Failures int
+	Probe    time.Duration
+	// Now returns the current time, time.Now when nil
+	Now func() time.Time
+	// OnSwitch, if set, is called when another member serves the prices
+	// than the last time, with the error of the member it replaces, nil on
+	// a recovery
+	OnSwitch func(from, to string, err error)
+
+	mu     sync.Mutex
+	health []Health
+	active string
+}
+
+var _ ote.PriceSource = (*Source)(nil)
+
+// New returns the source of the members, in order of priority.
+func New(members []Member, failures int, probe time.Duration) *Source {
+	s := &Source{members: members, Failures: max(failures, 1), Probe: probe}
+	for _, m := range members {
+		s.health = append(s.health, Health{Name: m.Name, Healthy: true})
+	}
+	if len(members) != 0 {
+		s.active = members[0].Name
+	}
+	return s
+}
+
+// Active returns the name of the member that served the last request, the
+// first one before any.
+func (s *Source) Active() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+// Health returns the health of the members, in order of priority.
+func (s *Source) Health() []Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Health(nil), s.health...)
+}
+
+// ImPrices returns the intraday prices from the first member serving them.
+func (s *Source) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	var points []ote.PricePoint
+	err := s.try(func(m Member) (err error) {
+		points, err = m.Source.ImPrices(ctx, day, fromHour, toHour)
+		scalePoints(points, m.Factor)
+		return err
+	})
+	return points, err
+}
+
+// DamPrices returns the day-ahead prices from the first member serving them.
+func (s *Source) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	var points []ote.PricePoint
+	err := s.try(func(m Member) (err error) {
+		points, err = m.Source.DamPrices(ctx, from, to)
+		scalePoints(points, m.Factor)
+		return err
+	})
+	return points, err
+}
+
+// DamIndex returns the day-ahead indexes from the first member serving them.
+func (s *Source) DamIndex(ctx context.Context, from, to string) ([]ote.DamIndex, error) {
+	var indexes []ote.DamIndex
+	err := s.try(func(m Member) (err error) {
+		indexes, err = m.Source.DamIndex(ctx, from, to)
+		if f := m.Factor; f != 0 {
+			for i := range indexes {
+				indexes[i].BaseLoad *= f
+				indexes[i].PeakLoad *= f
+				indexes[i].OffpeakLoad *= f
+			}
+		}
+		return err
+	})
+	return indexes, err
+}
+
+// scalePoints converts the prices of the points with the factor.
+func scalePoints(points []ote.PricePoint, factor float64) {
+	if factor == 0 {
+		return
+	}
+	for i := range points {
+		points[i].Price *= factor
+	}
+}
+
+// try calls fn with the members in order of priority until one succeeds, the
+// unhealthy ones only when they are to be probed or all the others failed.
+// ote.ErrNoData is an answer rather than a failure, as another member has no
+// prices the market did not publish either. The error of the first member
+// tried is returned when all fail.
+func (s *Source) try(fn func(Member) error) error {
+	var first error
+	var skipped []int
+	attempt := func(i int) bool {
+		err := fn(s.members[i])
+		if err == nil || e.Is(err, ote.ErrNoData) {
+			s.succeeded(i)
+			first = err
+			return true
+		}
+		s.failed(i, err)
+		if first == nil {
+			first = err
+		}
+		return false
+	}
+	for i := range s.members {
+		if !s.due(i) {
+			skipped = append(skipped, i)
+			continue
+		}
+		if attempt(i) {
+			return first
+		}
+	}
+	for _, i := range skipped {
+		if attempt(i) {
+			return first
+		}
+	}
+	return first
+}
+
+// now returns the current time.
+func (s *Source) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// due reports whether the member is healthy or to be probed.
+func (s *Source) due(i int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.health[i]
+	return h.Healthy || s.now().Sub(*h.LastFailure) >= s.Probe
+}
+
+// succeeded records that the member served a request.
+func (s *Source) succeeded(i int) {
+	s.mu.Lock()
+	h := &s.health[i]
+	h.Healthy, h.Failures, h.LastError = true, 0, ""
+	from, to := s.active, h.Name
+	s.active = to
+	var lastErr error
+	if from != to {
+		for _, other := range s.health {
+			if other.Name == from && other.LastError != "" {
+				lastErr = e.New(other.LastError)
+			}
+		}
+	}
+	s.mu.Unlock()
+	if from != to && s.OnSwitch != nil {
+		s.OnSwitch(from, to, lastErr)
+	}
+}
+
+// failed records the error of the member.
+func (s *Source) failed(i int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := &s.health[i]
+	h.Failures++
+	now := s.now()
+	h.LastError, h.LastFailure = err.Error(), &now
+	if h.Failures >= s.Failures {
+		h.Healthy = false
+	}
+}
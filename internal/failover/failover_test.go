@@ -0,0 +1,130 @@
+package failover_test
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/failover"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+// switchEvent is a call of OnSwitch.
+type switchEvent struct {
+	from, to string
+	err      error
+}
+
+func TestFailover(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	down := e.New("connection refused")
+	primary := otetest.NewFake().
+		AddImPrices(nil, fmt.Errorf("first: %w", down)).
+		AddImPrices(nil, fmt.Errorf("second: %w", down)).
+		AddImPrices(nil, fmt.Errorf("probe: %w", down)).
+		AddImPrices(otetest.Points("2024-10-01", 1, 70), nil)
+	// The secondary prices are in EUR/kWh; each response is a new slice, as
+	// the prices are converted in place
+	secondary := otetest.NewFake()
+	for range 6 {
+		secondary.AddImPrices(otetest.Points("2024-10-01", 1, 0.08), nil)
+	}
+	s := failover.New([]failover.Member{
+		{Name: "ote", Source: primary},
+		{Name: "file", Source: secondary, Factor: 1000},
+	}, 2, 10*time.Minute)
+	s.Now = func() time.Time { return now }
+	var switches []switchEvent
+	s.OnSwitch = func(from, to string, err error) { switches = append(switches, switchEvent{from, to, err}) }
+
+	steps := []struct {
+		name string
+		at   time.Duration
+		// price is that served, primaryCalls the calls of the primary so far
+		price        float64
+		primaryCalls int
+		active       string
+		healthy      bool
+		switches     int
+	}{
+		{"first failure", 0, 80, 1, "file", true, 1},
+		{"unhealthy", time.Minute, 80, 2, "file", false, 1},
+		{"skipped", 2 * time.Minute, 80, 2, "file", false, 1},
+		{"before the probe", 10*time.Minute + 59*time.Second, 80, 2, "file", false, 1},
+		{"failed probe", 11 * time.Minute, 80, 3, "file", false, 1},
+		{"skipped after the probe", 15 * time.Minute, 80, 3, "file", false, 1},
+		{"recovered", 21 * time.Minute, 70, 4, "ote", true, 2},
+	}
+	for _, step := range steps {
+		now = start.Add(step.at)
+		points, err := s.ImPrices(context.Background(), "2024-10-01", 1, 1)
+		if err != nil || len(points) != 1 || points[0].Price != step.price {
+			t.Fatalf("%s: points %v, %v, want price %g", step.name, points, err, step.price)
+		}
+		if n := len(primary.Calls()); n != step.primaryCalls {
+			t.Errorf("%s: %d calls of the primary, want %d", step.name, n, step.primaryCalls)
+		}
+		health := s.Health()
+		if s.Active() != step.active || health[0].Healthy != step.healthy || !health[1].Healthy || len(switches) != step.switches {
+			t.Errorf("%s: active %s, health %+v, switches %v", step.name, s.Active(), health, switches)
+		}
+	}
+	if len(switches) != 2 {
+		t.Fatalf("switches %v, want two", switches)
+	}
+	if sw := switches[0]; sw.from != "ote" || sw.to != "file" || sw.err == nil || sw.err.Error() != "first: connection refused" {
+		t.Errorf("failover %+v, want from ote on its error", sw)
+	}
+	if sw := switches[1]; sw.from != "file" || sw.to != "ote" || sw.err != nil {
+		t.Errorf("recovery %+v, want back to ote without an error", sw)
+	}
+	if h := s.Health()[0]; h.Failures != 0 || h.LastError != "" {
+		t.Errorf("health %+v after the recovery, want the failures reset", h)
+	}
+}
+
+func TestFailoverErrors(t *testing.T) {
+	down := e.New("connection refused")
+	ctx := context.Background()
+
+	// No prices published is an answer, not a failure
+	primary := otetest.NewFake()
+	secondary := otetest.NewFake().AddImPrices(otetest.Points("2024-10-01", 1, 80), nil)
+	var switched bool
+	s := failover.New([]failover.Member{{Name: "ote", Source: primary}, {Name: "file", Source: secondary}}, 1, time.Hour)
+	s.OnSwitch = func(from, to string, err error) { switched = true }
+	if _, err := s.ImPrices(ctx, "2024-10-01", 1, 1); !e.Is(err, ote.ErrNoData) || switched || len(secondary.Calls()) != 0 || !s.Health()[0].Healthy {
+		t.Errorf("error %v, switched %t, health %+v, want no data from the primary", err, switched, s.Health())
+	}
+
+	// When all fail, the error of the first is returned, and the unhealthy
+	// members are tried after the others
+	primary = otetest.NewFake().AddDamPrices(nil, fmt.Errorf("ote: %w", down))
+	secondary = otetest.NewFake().AddDamPrices(nil, e.New("file: gap"))
+	s = failover.New([]failover.Member{{Name: "ote", Source: primary}, {Name: "file", Source: secondary}}, 1, time.Hour)
+	if _, err := s.DamPrices(ctx, "2024-10-01", "2024-10-01"); !e.Is(err, down) {
+		t.Errorf("error %v, want that of the primary", err)
+	}
+	if _, err := s.DamPrices(ctx, "2024-10-01", "2024-10-01"); err == nil || err.Error() != "ote: connection refused" {
+		t.Errorf("error %v of the unhealthy members, want that of the primary", err)
+	}
+	if len(primary.Calls()) != 2 || len(secondary.Calls()) != 2 {
+		t.Errorf("%d and %d calls, want both members tried twice", len(primary.Calls()), len(secondary.Calls()))
+	}
+	for _, h := range s.Health() {
+		if h.Healthy || h.Failures != 2 || h.LastFailure == nil {
+			t.Errorf("health %+v, want unhealthy", h)
+		}
+	}
+
+	// The indexes are converted too
+	indexes := otetest.NewFake().AddDamIndex([]ote.DamIndex{{BaseLoad: 0.1, PeakLoad: 0.12, OffpeakLoad: 0.05}}, nil)
+	s = failover.New([]failover.Member{{Name: "file", Source: indexes, Factor: 1000}}, 1, time.Hour)
+	if got, err := s.DamIndex(ctx, "2024-10-01", "2024-10-01"); err != nil || got[0].BaseLoad != 100 || got[0].PeakLoad != 120 || got[0].OffpeakLoad != 50 {
+		t.Errorf("indexes %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Package fault injects faults into the HTTP transport, the sysfs
+// filesystem, the clock and the price source, to drive the daemon through
+// them and check how it copes.
+//
+// Each wrapper passes everything through to the wrapped one until a Switch
+// turns its fault on. Wrappers nest, so that faults of the same kind can
+// overlap, e.g. a Filesystem going read-only inside one failing for a while.
+package fault
+
+import (
+	e "errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInjected is the cause of the errors of the injected faults.
+var ErrInjected = e.New("injected fault")
+
+// Switch reports whether a fault is injected; a nil Switch never is.
+type Switch func() bool
+
+func (s Switch) on() bool {
+	return s != nil && s()
+}
+
+// Toggle is a Switch turned on and off by hand; its On method is the Switch.
+// The zero value is off.
+type Toggle struct {
+	on atomic.Bool
+}
+
+// Set turns the fault on or off.
+func (t *Toggle) Set(on bool) {
+	t.on.Store(on)
+}
+
+// On reports whether the fault is on.
+func (t *Toggle) On() bool {
+	return t.on.Load()
+}
+
+// Window returns a Switch on from start for d on the clock, or from start
+// on when d is not positive.
+func Window(c Clock, start time.Time, d time.Duration) Switch {
+	return func() bool {
+		now := c.Now()
+		return !now.Before(start) && (d <= 0 || now.Before(start.Add(d)))
+	}
+}
+
+// Clock is the clock of the daemon; the clocks of its cycles and of the
+// simulations implement it.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// JumpingClock is Base set forward by Jump, or back for a negative Jump,
+// while When is on, as when the system clock is set. The timers are those of
+// Base, so that they still fire after the time waited for.
+type JumpingClock struct {
+	Base Clock
+	Jump time.Duration
+	When Switch
+}
+
+func (c *JumpingClock) Now() time.Time {
+	if c.When.on() {
+		return c.Base.Now().Add(c.Jump)
+	}
+	return c.Base.Now()
+}
+
+func (c *JumpingClock) After(d time.Duration) <-chan time.Time {
+	return c.Base.After(d)
+}
@@ -0,0 +1,167 @@
+package fault_test
+
+import (
+	"context"
+	e "errors"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/fault"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+// clock is a fault.Clock set by hand.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.now.Add(d)
+	return ch
+}
+
+func TestWindow(t *testing.T) {
+	start := time.Date(2024, time.March, 31, 1, 0, 0, 0, time.UTC)
+	c := &clock{}
+	tests := []struct {
+		d    time.Duration
+		at   time.Duration
+		want bool
+	}{
+		{time.Hour, -time.Second, false},
+		{time.Hour, 0, true},
+		{time.Hour, 59 * time.Minute, true},
+		{time.Hour, time.Hour, false},
+		// Without a duration the fault stays on
+		{0, -time.Second, false},
+		{0, 1000 * time.Hour, true},
+	}
+	for _, test := range tests {
+		c.now = start.Add(test.at)
+		if got := fault.Window(c, start, test.d)(); got != test.want {
+			t.Errorf("window of %s at %s: %t, want %t", test.d, test.at, got, test.want)
+		}
+	}
+}
+
+func TestJumpingClock(t *testing.T) {
+	now := time.Date(2024, time.March, 31, 1, 30, 0, 0, time.UTC)
+	var toggle fault.Toggle
+	c := &fault.JumpingClock{Base: &clock{now}, Jump: time.Hour, When: toggle.On}
+	if got := c.Now(); !got.Equal(now) {
+		t.Errorf("now %s before the jump, want %s", got, now)
+	}
+	toggle.Set(true)
+	if got := c.Now(); !got.Equal(now.Add(time.Hour)) {
+		t.Errorf("now %s after the jump, want %s", got, now.Add(time.Hour))
+	}
+	// The timers keep to the base clock
+	if got := <-c.After(time.Minute); !got.Equal(now.Add(time.Minute)) {
+		t.Errorf("timer fired at %s, want %s", got, now.Add(time.Minute))
+	}
+	toggle.Set(false)
+	if got := c.Now(); !got.Equal(now) {
+		t.Errorf("now %s after jumping back, want %s", got, now)
+	}
+	// A nil switch never jumps
+	if got := (&fault.JumpingClock{Base: &clock{now}, Jump: time.Hour}).Now(); !got.Equal(now) {
+		t.Errorf("now %s without a switch, want %s", got, now)
+	}
+}
+
+func TestFilesystem(t *testing.T) {
+	const path = "/sys/devices/system/cpu/cpu0/cpufreq/scaling_max_freq"
+	var readOnly, failing fault.Toggle
+	base := actuator.NewMemFS(map[string]string{path: "3200000\n"})
+	fsys := &fault.Filesystem{Filesystem: base, ReadOnly: readOnly.On, Failing: failing.On}
+
+	if err := fsys.Write(path, []byte("2400000")); err != nil {
+		t.Fatal(err)
+	}
+	readOnly.Set(true)
+	err := fsys.Write(path, []byte("800000"))
+	if !e.Is(err, syscall.EROFS) || !e.Is(err, fault.ErrInjected) {
+		t.Errorf("write while read-only: %v, want EROFS", err)
+	}
+	if content, err := actuator.ReadFile(fsys, path); err != nil || content != "2400000" {
+		t.Errorf("read while read-only: %q, %v, want the last write", content, err)
+	}
+
+	// Failing takes precedence over read-only
+	failing.Set(true)
+	if err := fsys.Write(path, []byte("800000")); !e.Is(err, syscall.EIO) || !e.Is(err, fault.ErrInjected) {
+		t.Errorf("write while failing: %v, want EIO", err)
+	}
+	if _, err := fsys.Read(path); !e.Is(err, syscall.EIO) {
+		t.Errorf("read while failing: %v, want EIO", err)
+	}
+	if _, err := fsys.Glob("/sys/devices/system/cpu/cpu*"); !e.Is(err, syscall.EIO) {
+		t.Errorf("glob while failing: %v, want EIO", err)
+	}
+	if _, err := fsys.Stat(path); !e.Is(err, syscall.EIO) {
+		t.Errorf("stat while failing: %v, want EIO", err)
+	}
+
+	readOnly.Set(false)
+	failing.Set(false)
+	if err := fsys.Write(path, []byte("3200000")); err != nil {
+		t.Errorf("write after the faults: %v", err)
+	}
+	if writes := base.Writes(); len(writes) != 2 {
+		t.Errorf("writes %+v, want only those outside the faults", writes)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := otetest.NewServer(otetest.Points("2024-03-30", 1, 90, 100))
+	defer server.Close()
+	var down, unavailable fault.Toggle
+	transport := &fault.Transport{Down: down.On, Unavailable: unavailable.On}
+	client := ote.NewClient(ote.WithEndpoint(server.URL), ote.WithHTTPClient(&http.Client{Transport: transport}))
+	ctx := context.Background()
+
+	if points, err := client.ImPrices(ctx, "2024-03-30", 1, 24); err != nil || len(points) != 2 {
+		t.Fatalf("prices %v, %v, want 2", points, err)
+	}
+	down.Set(true)
+	if _, err := client.ImPrices(ctx, "2024-03-30", 1, 24); !ote.IsNetwork(err) || !e.Is(err, fault.ErrInjected) {
+		t.Errorf("prices while down: %v, want a network error", err)
+	}
+	down.Set(false)
+	unavailable.Set(true)
+	if _, err := client.ImPrices(ctx, "2024-03-30", 1, 24); !ote.IsNetwork(err) || !e.Is(err, ote.ErrHTTPStatus(http.StatusServiceUnavailable)) {
+		t.Errorf("prices while unavailable: %v, want status 503", err)
+	}
+	unavailable.Set(false)
+	if points, err := client.ImPrices(ctx, "2024-03-30", 1, 24); err != nil || len(points) != 2 {
+		t.Errorf("prices after the faults %v, %v, want 2", points, err)
+	}
+}
+
+func TestSource(t *testing.T) {
+	var empty fault.Toggle
+	base := otetest.NewFake().AddDamPrices(otetest.Points("2024-03-30", 1, 90, 100), nil)
+	source := &fault.Source{Base: base, Empty: empty.On}
+	ctx := context.Background()
+
+	empty.Set(true)
+	if _, err := source.DamPrices(ctx, "2024-03-30", "2024-03-30"); !e.Is(err, ote.ErrNoData) {
+		t.Errorf("prices while empty: %v, want ErrNoData", err)
+	}
+	if calls := base.Calls(); len(calls) != 0 {
+		t.Errorf("calls %+v of the base while empty", calls)
+	}
+	empty.Set(false)
+	if points, err := source.DamPrices(ctx, "2024-03-30", "2024-03-30"); err != nil || len(points) != 2 {
+		t.Errorf("prices %v, %v, want 2", points, err)
+	}
+}
@@ -0,0 +1,66 @@
+package fault
+
+import (
+	"io/fs"
+	"syscall"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// Filesystem is an actuator.Filesystem whose writes fail with EROFS while
+// ReadOnly is on, as when sysfs is mounted read-only in a container, and
+// whose every access fails with EIO while Failing is on.
+type Filesystem struct {
+	actuator.Filesystem
+	ReadOnly Switch
+	Failing  Switch
+}
+
+func (f *Filesystem) Read(path string) ([]byte, error) {
+	if f.Failing.on() {
+		return nil, injected("read", path, syscall.EIO)
+	}
+	return f.Filesystem.Read(path)
+}
+
+func (f *Filesystem) Write(path string, data []byte) error {
+	switch {
+	case f.Failing.on():
+		return injected("write", path, syscall.EIO)
+	case f.ReadOnly.on():
+		return injected("write", path, syscall.EROFS)
+	}
+	return f.Filesystem.Write(path, data)
+}
+
+func (f *Filesystem) Glob(pattern string) ([]string, error) {
+	if f.Failing.on() {
+		return nil, injected("glob", pattern, syscall.EIO)
+	}
+	return f.Filesystem.Glob(pattern)
+}
+
+func (f *Filesystem) Stat(path string) (fs.FileInfo, error) {
+	if f.Failing.on() {
+		return nil, injected("stat", path, syscall.EIO)
+	}
+	return f.Filesystem.Stat(path)
+}
+
+// injectedErr is the error of an injected fault, matching both the errno
+// and ErrInjected.
+type injectedErr struct {
+	errno syscall.Errno
+}
+
+func (err injectedErr) Error() string {
+	return err.errno.Error() + " (" + ErrInjected.Error() + ")"
+}
+
+func (err injectedErr) Unwrap() []error {
+	return []error{err.errno, ErrInjected}
+}
+
+func injected(op, path string, errno syscall.Errno) error {
+	return &fs.PathError{Op: op, Path: path, Err: injectedErr{errno}}
+}
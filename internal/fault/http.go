@@ -0,0 +1,84 @@
+package fault
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// Transport is an http.RoundTripper failing the requests of Base while Down
+// is on, as when the service cannot be reached, and answering them with 503
+// Service Unavailable while Unavailable is on. Both are network errors to
+// the OTE client, see ote.IsNetwork.
+type Transport struct {
+	// Base does the requests, http.DefaultTransport when nil
+	Base        http.RoundTripper
+	Down        Switch
+	Unavailable Switch
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch {
+	case t.Down.on():
+		closeBody(req)
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: ErrInjected}
+	case t.Unavailable.on():
+		closeBody(req)
+		return &http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: http.StatusServiceUnavailable,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Body:       io.NopCloser(strings.NewReader(ErrInjected.Error())),
+			Request:    req,
+		}, nil
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// closeBody closes the body of a request not sent, as a RoundTripper must.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// Source is Base answering without prices while Empty is on, as the service
+// does for the days it has not published yet.
+type Source struct {
+	Base  ote.PriceSource
+	Empty Switch
+}
+
+var _ ote.PriceSource = (*Source)(nil)
+
+func (s *Source) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	if s.Empty.on() {
+		return nil, ote.ErrNoData
+	}
+	return s.Base.ImPrices(ctx, day, fromHour, toHour)
+}
+
+func (s *Source) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	if s.Empty.on() {
+		return nil, ote.ErrNoData
+	}
+	return s.Base.DamPrices(ctx, from, to)
+}
+
+func (s *Source) DamIndex(ctx context.Context, from, to string) ([]ote.DamIndex, error) {
+	if s.Empty.on() {
+		return nil, ote.ErrNoData
+	}
+	return s.Base.DamIndex(ctx, from, to)
+}
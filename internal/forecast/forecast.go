@@ -0,0 +1,52 @@
+// Package forecast predicts hourly prices from the history of past prices,
+// for when no market prices can be had.
+package forecast
+
+import (
+	"slices"
+	"time"
+)
+
+// History holds past hourly prices by the Unix time of the start of their
+// hour.
+type History map[int64]float64
+
+// Add records the price of the hour starting at start.
+func (h History) Add(start time.Time, price float64) {
+	h[start.Unix()] = price
+}
+
+// Model predicts the price of the hour starting at start, or reports that
+// the history does not allow it.
+type Model func(h History, start time.Time) (float64, bool)
+
+// Models are the models by name.
+var Models = map[string]Model{
+	"persistence":   Persistence,
+	"weekly_median": WeeklyMedian,
+}
+
+// Persistence predicts the price of the same hour of the previous day.
+func Persistence(h History, start time.Time) (float64, bool) {
+	price, ok := h[start.AddDate(0, 0, -1).Unix()]
+	return price, ok
+}
+
+// WeeklyMedian predicts the median price of the same hour of the previous
+// seven days that are in the history.
+func WeeklyMedian(h History, start time.Time) (float64, bool) {
+	var prices []float64
+	for day := 1; day <= 7; day++ {
+		if price, ok := h[start.AddDate(0, 0, -day).Unix()]; ok {
+			prices = append(prices, price)
+		}
+	}
+	if len(prices) == 0 {
+		return 0, false
+	}
+	slices.Sort(prices)
+	if n := len(prices); n%2 == 0 {
+		return (prices[n/2-1] + prices[n/2]) / 2, true
+	}
+	return prices[len(prices)/2], true
+}
@@ -0,0 +1,51 @@
+package forecast_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/forecast"
+)
+
+func TestModels(t *testing.T) {
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 10:00 on the Sunday the summer time ends, 25 hours after 10:00 of the
+	// day before
+	start := time.Date(2024, time.October, 27, 10, 0, 0, 0, prague)
+	day := func(days int) time.Time { return start.AddDate(0, 0, -days) }
+	history := make(forecast.History)
+	for d, price := range map[int]float64{1: 80, 2: 120, 3: 95, 5: 60, 6: 300} {
+		history.Add(day(d), price)
+	}
+	// Other hours are not used
+	history.Add(start.Add(-24*time.Hour), 1000)
+	history.Add(day(1).Add(time.Hour), 1000)
+
+	tests := []struct {
+		name    string
+		model   forecast.Model
+		history forecast.History
+		want    float64
+		ok      bool
+	}{
+		{"persistence", forecast.Persistence, history, 80, true},
+		{"weekly median", forecast.WeeklyMedian, history, 95, true},
+		{"persistence without yesterday", forecast.Persistence, forecast.History{day(2).Unix(): 120}, 0, false},
+		{"weekly median of even days", forecast.WeeklyMedian, forecast.History{day(3).Unix(): 40, day(7).Unix(): 70}, 55, true},
+		// Eight days ago is beyond the week
+		{"weekly median without the week", forecast.WeeklyMedian, forecast.History{day(8).Unix(): 120}, 0, false},
+		{"empty history", forecast.WeeklyMedian, nil, 0, false},
+	}
+	for _, test := range tests {
+		price, ok := test.model(test.history, start)
+		if price != test.want || ok != test.ok {
+			t.Errorf("%s: %g, %t, want %g, %t", test.name, price, ok, test.want, test.ok)
+		}
+	}
+	if len(forecast.Models) != 2 || forecast.Models["persistence"] == nil || forecast.Models["weekly_median"] == nil {
+		t.Errorf("models %v, want persistence and weekly_median", forecast.Models)
+	}
+}
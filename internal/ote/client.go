@@ -0,0 +1,420 @@
+// Package ote is a client of the public data service of OTE, the Czech
+// electricity market operator.
+// https://www.ote-cr.cz/cs/dokumentace/dokumentace-elektrina/uzivatelsky-manual_webove_sluzby_ote_c.pdf
+package ote
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// DefaultEndpoint is the URL of the public data service.
+const DefaultEndpoint = "https://www.ote-cr.cz/services/PublicDataService"
+
+// PriceSource is the part of the service the simulator uses. Client
+// implements it with the SOAP service and otetest.Fake with scripted
+// responses. The dates are formatted as time.DateOnly.
+type PriceSource interface {
+	// ImPrices returns the intraday prices of the trading hours of the
+	// day, inclusive, numbered from 1, see HourIndex.
+	ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]PricePoint, error)
+	// DamPrices returns the day-ahead prices of the days, inclusive.
+	DamPrices(ctx context.Context, from, to string) ([]PricePoint, error)
+	// DamIndex returns the day-ahead indexes of the days, inclusive.
+	DamIndex(ctx context.Context, from, to string) ([]DamIndex, error)
+}
+
+// Limiter delays requests to respect a rate limit; *rate.Limiter of
+// golang.org/x/time/rate implements it.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// Client calls the SOAP operations of the public data service.
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	timeout    time.Duration
+	currency   string
+	editors    []func(*http.Request)
+	retries    int
+	backoff    time.Duration
+	limiter    Limiter
+	userAgent  string
+	onDrift    func(operation, drift string)
+	onCall     func(context.Context, Call)
+}
+
+var _ PriceSource = (*Client)(nil)
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithEndpoint sets the URL of the service, DefaultEndpoint by default.
+func WithEndpoint(endpoint string) Option {
+	return func(c *Client) {
+		c.endpoint = endpoint
+	}
+}
+
+// WithHTTPClient sets the HTTP client doing the requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout limits the duration of each request, also of those of the
+// HTTP client of WithHTTPClient, whichever option comes first.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithCurrency sets the currency of the day-ahead prices, CZK or EUR. The
+// service returns CZK by default.
+func WithCurrency(currency string) Option {
+	return func(c *Client) {
+		c.currency = strings.ToUpper(currency)
+	}
+}
+
+// WithRetries retries requests failing with a network error, see IsNetwork,
+// up to retries times, waiting backoff before the first retry and twice as
+// long before each next one.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.backoff = retries, backoff
+	}
+}
+
+// WithRateLimiter makes every request, including retries, wait for limiter.
+func WithRateLimiter(limiter Limiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the requests.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRequestEditor lets f modify every request before it is sent, e.g. to
+// add headers.
+func WithRequestEditor(f func(*http.Request)) Option {
+	return func(c *Client) {
+		c.editors = append(c.editors, f)
+	}
+}
+
+// WithDriftHandler calls f when a response is only decoded by ignoring the
+// namespaces of its elements, which means the schema of the service drifted,
+// with a description of the drift, e.g. to warn about it.
+func WithDriftHandler(f func(operation, drift string)) Option {
+	return func(c *Client) {
+		c.onDrift = f
+	}
+}
+
+// WithCallHandler calls f with the context of the caller after each
+// request, including retries, e.g. to log its identifiers and duration.
+func WithCallHandler(f func(context.Context, Call)) Option {
+	return func(c *Client) {
+		c.onCall = f
+	}
+}
+
+// NewClient returns a client of the public data service.
+func NewClient(options ...Option) *Client {
+	c := &Client{endpoint: DefaultEndpoint, httpClient: &http.Client{}, currency: "CZK"}
+	for _, option := range options {
+		option(c)
+	}
+	if c.timeout != 0 {
+		// A copy, not to change the client passed to WithHTTPClient
+		httpClient := *c.httpClient
+		httpClient.Timeout = c.timeout
+		c.httpClient = &httpClient
+	}
+	return c
+}
+
+// Endpoint returns the URL of the service.
+func (c *Client) Endpoint() string {
+	return c.endpoint
+}
+
+// envelope wraps the operation in a SOAP envelope.
+func envelope(operation, parameters string) []byte {
+	return []byte(strings.TrimSpace(fmt.Sprintf(`
+	<?xml version="1.0" encoding="UTF-8" ?>
+    <soapenv:Envelope
+       xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"
+       xmlns:pub="http://www.ote-cr.cz/schema/service/public">
+		<soapenv:Header/>
+        <soapenv:Body>
+            <pub:%[1]s>%[2]s
+            </pub:%[1]s>
+        </soapenv:Body>
+    </soapenv:Envelope>`, operation, parameters),
+	))
+}
+
+// responseLimit bounds the size of the responses read.
+const responseLimit = 16 << 20
+
+// call posts the operation and reads the body of the response into result,
+// a *[]byte, or streams it through result when it is an *itemStream,
+// retrying as configured. It returns the last request, whose identifiers the
+// errors of decoding the response are wrapped with. The errors are those of
+// errors.go, wrapped with the name of the operation and in ErrRequest.
+func (c *Client) call(ctx context.Context, operation, parameters string, result any) (request, error) {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				return request{}, fmt.Errorf("%s: %w", operation, err)
+			}
+		}
+		req := request{id: newRequestID()}
+		start := time.Now()
+		err := c.do(ctx, operation, parameters, result, &req)
+		c.called(ctx, Call{Operation: operation, RequestID: req.id, ServerID: req.serverID, Duration: time.Since(start), Err: err})
+		err = req.wrap(err)
+		if err == nil || attempt >= c.retries || !IsNetwork(err) {
+			return req, err
+		}
+		// The items already streamed cannot be taken back
+		if s, ok := result.(*itemStream); ok && s.items != 0 {
+			return req, err
+		}
+		select {
+		case <-ctx.Done():
+			return req, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// do posts the operation once as the request, recording the identifier the
+// service answered with.
+func (c *Client) do(ctx context.Context, operation, parameters string, result any, r *request) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(envelope(operation, parameters)))
+	if err != nil {
+		return fmt.Errorf("%s: creating request: %w", operation, err)
+	}
+	req.Header.Set("Content-type", "text/xml")
+	req.Header.Set("SOAPAction", "urn:"+operation) // The format is `urn:<soap_action>`
+	req.Header.Set(RequestIDHeader, r.id)
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	for _, edit := range c.editors {
+		edit(req)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		// The caller gave up, which says nothing about the service
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s: %w", operation, ctx.Err())
+		}
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	defer res.Body.Close()
+	if s, ok := result.(*itemStream); ok && res.StatusCode == http.StatusOK {
+		r.serverID = serverID(res.Header, nil)
+		if err := s.decode(res.Body); err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+		return nil
+	}
+	// One byte more than the limit tells a longer response from one as long
+	body, err := io.ReadAll(io.LimitReader(res.Body, responseLimit+1))
+	if err != nil {
+		return fmt.Errorf("%s: reading response: %w", operation, err)
+	}
+	if len(body) > responseLimit {
+		return fmt.Errorf("%s: %w: more than %d bytes", operation, ErrResponseTooLarge, responseLimit)
+	}
+	r.serverID = serverID(res.Header, body)
+	// Faults usually come with status 500, so they are looked for first
+	fault := new(Envelope[*Fault])
+	if xml.Unmarshal(body, fault) == nil && fault.Body.Response != nil {
+		return fmt.Errorf("%s: %w", operation, &ErrSOAPFault{Code: fault.Body.Response.Code, String: fault.Body.Response.String})
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %w", operation, ErrHTTPStatus(res.StatusCode))
+	}
+	*result.(*[]byte) = body
+	return nil
+}
+
+// check returns ErrDecode when the response element is missing, as the
+// decoding ignores unknown elements, and ErrNoData when it has no items.
+func check(operation string, response xml.Name, items int) error {
+	if response.Local == "" {
+		return fmt.Errorf("%s: %w: no %sResponse element", operation, ErrDecode, operation)
+	}
+	if items == 0 {
+		return fmt.Errorf("%s: %w", operation, ErrNoData)
+	}
+	return nil
+}
+
+// PricePoint is the price and traded volume of one trading hour.
+type PricePoint struct {
+	Date string `json:"date"`
+	// Hour is the index of the trading hour, see HourIndex
+	Hour int `json:"hour"`
+	// Start is when the trading hour starts, zero if Date is invalid
+	Start  time.Time `json:"start"`
+	Price  float64   `json:"price"`
+	Volume float64   `json:"volume"`
+	// Source is SourceForecast for predicted prices, SourceProfile for
+	// those of a typical day, empty for prices of the market
+	Source string `json:"source,omitempty"`
+	// Provisional is set on the intraday price of the hour still trading,
+	// which may change until the hour ends
+	Provisional bool `json:"provisional,omitempty"`
+}
+
+// The sources of the points that are not prices of the market.
+const (
+	// SourceForecast marks the points predicted when no prices are
+	// available
+	SourceForecast = "forecast"
+	// SourceProfile marks the points of a typical day, see package profile
+	SourceProfile = "profile"
+)
+
+// newPricePoint returns the point of the item of a response. The dates may
+// come with a time zone offset, which is ignored.
+func newPricePoint(date string, hour int, price, volume float64) PricePoint {
+	start, _ := HourStart(date[:min(len(date), len(time.DateOnly))], hour)
+	return PricePoint{Date: date, Hour: hour, Start: start, Price: price, Volume: volume}
+}
+
+// Prices returns the prices of the points.
+func Prices(points []PricePoint) []float64 {
+	prices := make([]float64, len(points))
+	for i, p := range points {
+		prices[i] = p.Price
+	}
+	return prices
+}
+
+// DamPrices returns the hourly prices of the day-ahead market between the
+// dates, inclusive, in the currency of the client (GetDamPriceE).
+func (c *Client) DamPrices(ctx context.Context, from, to string) ([]PricePoint, error) {
+	if err := checkDays(from, to); err != nil {
+		return nil, fmt.Errorf("GetDamPriceE: %w", err)
+	}
+	var body []byte
+	req, err := c.call(ctx, "GetDamPriceE", c.damPriceParameters(from, to), &body)
+	if err != nil {
+		return nil, err
+	}
+	items, err := decodeItems(c, "GetDamPriceE", body, "Item", func(r *ElectricityDailyForAgentureTrade) (xml.Name, []ItemE) {
+		return r.Body.Response.XMLName, r.Body.Response.Result.Items
+	})
+	if err != nil {
+		return nil, req.wrap(err)
+	}
+	var points []PricePoint
+	for _, item := range items {
+		points = append(points, item.point())
+	}
+	return points, nil
+}
+
+// damPriceParameters returns the parameters of GetDamPriceE.
+func (c *Client) damPriceParameters(from, to string) string {
+	parameters := fmt.Sprintf(`
+				<pub:StartDate>%s</pub:StartDate>
+				<pub:EndDate>%s</pub:EndDate>`, from, to)
+	if c.currency == "EUR" {
+		parameters += `
+				<pub:InEur>true</pub:InEur>`
+	}
+	return parameters
+}
+
+// DamIndex is the daily index of the day-ahead market.
+type DamIndex struct {
+	Date        string
+	EurRate     float64
+	BaseLoad    float64
+	PeakLoad    float64
+	OffpeakLoad float64
+	// Emergency is set on the days of an emergency in the power system.
+	Emergency bool
+}
+
+// DamIndex returns the daily indexes of the day-ahead market between the
+// dates, inclusive (GetDamIndexE).
+func (c *Client) DamIndex(ctx context.Context, from, to string) ([]DamIndex, error) {
+	if err := checkDays(from, to); err != nil {
+		return nil, fmt.Errorf("GetDamIndexE: %w", err)
+	}
+	parameters := fmt.Sprintf(`
+				<pub:StartDate>%s</pub:StartDate>
+				<pub:EndDate>%s</pub:EndDate>`, from, to)
+	var body []byte
+	req, err := c.call(ctx, "GetDamIndexE", parameters, &body)
+	if err != nil {
+		return nil, err
+	}
+	items, err := decodeItems(c, "GetDamIndexE", body, "DamIndex", func(r *ElectricityDayAheadTrade) (xml.Name, []DamIndexItem) {
+		return r.Body.Response.XMLName, r.Body.Response.Result.DamIndex
+	})
+	if err != nil {
+		return nil, req.wrap(err)
+	}
+	var indexes []DamIndex
+	for _, i := range items {
+		indexes = append(indexes, DamIndex{i.Date, i.EurRate, i.BaseLoad, i.PeakLoad, i.OffpeakLoad, i.Emerg != 0})
+	}
+	return indexes, nil
+}
+
+// ImPrices returns the prices and volumes of the intraday market between
+// the trading hours of the day, inclusive (GetImPriceE). The hours are
+// numbered from 1, see HourIndex.
+func (c *Client) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]PricePoint, error) {
+	if err := checkHours(day, fromHour, toHour); err != nil {
+		return nil, fmt.Errorf("GetImPriceE: %w", err)
+	}
+	parameters := fmt.Sprintf(`
+				<pub:StartDate>%[1]s</pub:StartDate>
+				<pub:EndDate>%[1]s</pub:EndDate>
+				<pub:StartHour>%[2]d</pub:StartHour>
+				<pub:EndHour>%[3]d</pub:EndHour>`, day, fromHour, toHour)
+	var body []byte
+	req, err := c.call(ctx, "GetImPriceE", parameters, &body)
+	if err != nil {
+		return nil, err
+	}
+	items, err := decodeItems(c, "GetImPriceE", body, "Item", func(r *ElectricityIntraDayTrade) (xml.Name, []ItemE) {
+		return r.Body.Response.XMLName, r.Body.Response.Result.Items
+	})
+	if err != nil {
+		return nil, req.wrap(err)
+	}
+	var points []PricePoint
+	for _, item := range items {
+		points = append(points, item.point())
+	}
+	return points, nil
+}
@@ -0,0 +1,44 @@
+package ote_test
+
+import (
+	"bytes"
+	"context"
+	e "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+func TestResponseLimit(t *testing.T) {
+	// The client reads up to 16 MiB
+	const limit = 16 << 20
+	tests := []struct {
+		size int
+		want bool
+	}{
+		{limit, false},
+		{limit + 1, true},
+		{2 * limit, true},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(bytes.Repeat([]byte(" "), test.size))
+		}))
+		client := ote.NewClient(ote.WithEndpoint(server.URL))
+		_, err := client.ImPrices(context.Background(), "2024-10-27", 1, 3)
+		server.Close()
+		if err == nil {
+			t.Errorf("%d bytes: no error", test.size)
+			continue
+		}
+		if got := e.Is(err, ote.ErrResponseTooLarge); got != test.want {
+			t.Errorf("%d bytes: got error %v, want ErrResponseTooLarge %t", test.size, err, test.want)
+		}
+		if ote.IsNetwork(err) && test.want {
+			t.Errorf("%d bytes: %v is a network error", test.size, err)
+		}
+	}
+}
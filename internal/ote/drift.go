@@ -0,0 +1,95 @@
+package ote
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// snippetLength bounds the part of a body quoted in the errors.
+const snippetLength = 200
+
+// decodeItems decodes the items of the response of the operation from body.
+// strict returns the name of the response element and the items as decoded
+// by the schema of the service. When it finds no items, the body is decoded
+// again matching the response and item elements by their local names only,
+// whatever their namespaces and the elements around them, as OTE has changed
+// the namespaces of the responses before; finding them only that way is
+// reported to the drift handler of the client. The errors are ErrDecode,
+// quoting the body, when neither finds the response element and ErrNoData
+// when it has no items.
+func decodeItems[R, T any](c *Client, operation string, body []byte, item string, strict func(*Envelope[R]) (xml.Name, []T)) ([]T, error) {
+	var name xml.Name
+	var items []T
+	envelope := new(Envelope[R])
+	if xml.Unmarshal(body, envelope) == nil {
+		if name, items = strict(envelope); len(items) != 0 {
+			return items, nil
+		}
+	}
+	local, items, err := decodeLocal[T](body, operation+"Response", item)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %w in %s", operation, ErrDecode, err, snippet(body))
+	}
+	if local.Local == "" {
+		return nil, fmt.Errorf("%s: %w: no %sResponse element in %s", operation, ErrDecode, operation, snippet(body))
+	}
+	switch {
+	case local.Space != serviceNamespace:
+		c.drift(operation, fmt.Sprintf("the %s element is in %q, expected %q", local.Local, local.Space, serviceNamespace))
+	case name.Local == "" || len(items) != 0:
+		c.drift(operation, fmt.Sprintf("the %s elements are not where the schema has them", item))
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%s: %w", operation, ErrNoData)
+	}
+	return items, nil
+}
+
+// decodeLocal returns the name of the first element of the body named
+// response and the elements named item within it, matching both by their
+// local names only.
+func decodeLocal[T any](body []byte, response, item string) (xml.Name, []T, error) {
+	var name xml.Name
+	var items []T
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return name, items, nil
+		}
+		if err != nil {
+			return name, nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		switch {
+		case !ok:
+		case name.Local == "" && start.Name.Local == response:
+			name = start.Name
+		case name.Local != "" && start.Name.Local == item:
+			var i T
+			if err := decoder.DecodeElement(&i, &start); err != nil {
+				return name, nil, err
+			}
+			items = append(items, i)
+		}
+	}
+}
+
+// drift reports a response of the operation decoded despite the drift of
+// its schema.
+func (c *Client) drift(operation, drift string) {
+	if c.onDrift != nil {
+		c.onDrift(operation, drift)
+	}
+}
+
+// snippet quotes the start of the body for the errors.
+func snippet(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) > snippetLength {
+		return fmt.Sprintf("%q...", body[:snippetLength])
+	}
+	return fmt.Sprintf("%q", body)
+}
@@ -0,0 +1,123 @@
+package ote_test
+
+import (
+	"context"
+	e "errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// fixtureServer serves the response in testdata/drift to every request.
+func fixtureServer(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", "drift", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSchemaDrift(t *testing.T) {
+	const v2 = `the GetDamPriceEResponse element is in "http://www.ote-cr.cz/schema/service/public/v2", expected "http://www.ote-cr.cz/schema/service/public"`
+	tests := []struct {
+		fixture string
+		// prices are those decoded
+		prices []float64
+		err    error
+		// drift is that reported, "" when none is
+		drift string
+	}{
+		{"dam-v2-namespace.xml", []float64{90.5, 85, -3.25}, nil, v2},
+		// Other prefixes of the same namespace and elements the schema
+		// does not know are no drift
+		{"dam-prefixed-extra.xml", []float64{90.5, 85, -3.25}, nil, ""},
+		{"dam-wrapped.xml", []float64{90.5, 85, -3.25}, nil, "the Item elements are not where the schema has them"},
+		{"dam-v2-empty.xml", nil, ote.ErrNoData, v2},
+		{"dam-renamed.xml", nil, ote.ErrDecode, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			var drifts []string
+			client := ote.NewClient(ote.WithEndpoint(fixtureServer(t, test.fixture).URL), ote.WithDriftHandler(func(operation, drift string) {
+				drifts = append(drifts, operation+": "+drift)
+			}))
+			points, err := client.DamPrices(context.Background(), "2024-10-01", "2024-10-01")
+			if !e.Is(err, test.err) || len(points) != len(test.prices) {
+				t.Fatalf("points %v, error %v, want %v, %v", points, err, test.prices, test.err)
+			}
+			for i, p := range points {
+				if p.Price != test.prices[i] || p.Hour != i+1 || p.Date != "2024-10-01" {
+					t.Errorf("point %d %+v, want %g", i, p, test.prices[i])
+				}
+			}
+			if test.drift == "" && len(drifts) != 0 {
+				t.Errorf("drifts %q, want none", drifts)
+			}
+			if test.drift != "" && (len(drifts) != 1 || drifts[0] != "GetDamPriceE: "+test.drift) {
+				t.Errorf("drifts %q, want %q", drifts, test.drift)
+			}
+		})
+	}
+}
+
+func TestSchemaDriftErrors(t *testing.T) {
+	client := ote.NewClient(ote.WithEndpoint(fixtureServer(t, "dam-renamed.xml").URL))
+	_, err := client.DamPrices(context.Background(), "2024-10-01", "2024-10-01")
+	// The error quotes the start of the body, up to 200 bytes
+	if !e.Is(err, ote.ErrDecode) || !strings.HasPrefix(err.Error(), `GetDamPriceE: unexpected response: no GetDamPriceEResponse element in "<?xml version=`) ||
+		!strings.Contains(err.Error(), `/schema/service/pub"...`) {
+		t.Errorf("error %v, want ErrDecode quoting the body", err)
+	}
+}
+
+func TestImPricesSchemaDrift(t *testing.T) {
+	var drifts []string
+	client := ote.NewClient(ote.WithEndpoint(fixtureServer(t, "im-v2-extra.xml").URL), ote.WithDriftHandler(func(operation, drift string) {
+		drifts = append(drifts, operation+": "+drift)
+	}))
+	points, err := client.ImPrices(context.Background(), "2024-10-01", 13, 14)
+	if err != nil || len(points) != 2 || points[0].Hour != 13 || points[0].Price != 110.2 || points[1].Price != 98.75 || points[1].Volume != 290 {
+		t.Fatalf("points %+v, %v, want those of hours 13 and 14", points, err)
+	}
+	want := `GetImPriceE: the GetImPriceEResponse element is in "http://www.ote-cr.cz/schema/service/public/2025", expected "http://www.ote-cr.cz/schema/service/public"`
+	if len(drifts) != 1 || drifts[0] != want {
+		t.Errorf("drifts %q, want %q", drifts, want)
+	}
+}
+
+func TestStreamSchemaDrift(t *testing.T) {
+	tests := []struct {
+		fixture string
+		drifts  int
+	}{
+		{"dam-v2-namespace.xml", 1},
+		{"dam-prefixed-extra.xml", 0},
+		{"dam-wrapped.xml", 0},
+	}
+	for _, test := range tests {
+		drifts := 0
+		client := ote.NewClient(ote.WithEndpoint(fixtureServer(t, test.fixture).URL), ote.WithDriftHandler(func(string, string) { drifts++ }))
+		var prices []float64
+		err := client.StreamDamPrices(context.Background(), "2024-10-01", "2024-10-01", func(p ote.PricePoint) error {
+			prices = append(prices, p.Price)
+			return nil
+		})
+		if err != nil || len(prices) != 3 || prices[2] != -3.25 {
+			t.Errorf("%s: streamed %v, %v, want 3 prices", test.fixture, prices, err)
+		}
+		if drifts != test.drifts {
+			t.Errorf("%s: %d drifts reported, want %d", test.fixture, drifts, test.drifts)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package ote
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+var (
+	// ErrNoData is returned when the service has no data for the requested
+	// window, e.g. the day-ahead prices before they are published.
+	ErrNoData = e.New("no data for the requested window")
+	// ErrDecode is returned when a response does not match the expected
+	// schema, which usually means the service changed.
+	ErrDecode = e.New("unexpected response")
+	// ErrInvalidRequest is returned before calling the service with dates or
+	// hours that do not exist, which it would answer with the wrong data.
+	ErrInvalidRequest = e.New("invalid request")
+	// ErrResponseTooLarge is returned for responses longer than the client
+	// reads, instead of decoding them truncated.
+	ErrResponseTooLarge = e.New("response too large")
+)
+
+// ErrSOAPFault is returned when the service responds with a SOAP fault.
+type ErrSOAPFault struct {
+	Code   string
+	String string
+}
+
+func (f *ErrSOAPFault) Error() string {
+	return fmt.Sprintf("SOAP fault %s: %s", f.Code, f.String)
+}
+
+// ErrHTTPStatus is returned for responses with a status other than 200 OK
+// that are not SOAP faults.
+type ErrHTTPStatus int
+
+func (s ErrHTTPStatus) Error() string {
+	return fmt.Sprintf("status %d %s", int(s), http.StatusText(int(s)))
+}
+
+// IsNetwork reports whether err means the service could not be reached: a
+// transport failure, such as a refused connection, a failed DNS lookup or a
+// timeout of the request, or a server error status. Unlike the other errors,
+// these are expected to go away on their own. A request the caller cancelled
+// or whose context expired is not one, nor is a misconfigured endpoint.
+func IsNetwork(err error) bool {
+	var status ErrHTTPStatus
+	if e.As(err, &status) {
+		return status >= 500
+	}
+	// The client returns the error of the context of the caller as it is,
+	// so a deadline only comes wrapped in *url.Error with WithTimeout
+	var urlErr *url.Error
+	if e.Is(err, context.Canceled) || e.Is(err, context.DeadlineExceeded) && !e.As(err, &urlErr) {
+		return false
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	return e.As(err, &opErr) || e.As(err, &dnsErr) || e.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,158 @@
+package ote_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+// stall answers after the request is cancelled or 5 s elapsed. The body is
+// read first, as the server only notices a closed connection after it.
+func stall(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+	select {
+	case <-r.Context().Done():
+	case <-time.After(5 * time.Second):
+	}
+}
+
+func TestIsNetwork(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		// endpoint replaces the URL of the server running handler
+		endpoint string
+		options  []ote.Option
+		// ctx returns the context of the call, context.Background() if nil
+		ctx  func() (context.Context, context.CancelFunc)
+		want bool
+	}{
+		{
+			name: "503",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			},
+			want: true,
+		},
+		{
+			name: "404",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			},
+		},
+		{
+			name: "SOAP fault",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write(otetest.FaultResponse("soapenv:Server", "invalid date"))
+			},
+		},
+		{
+			name:     "connection refused",
+			endpoint: closed.URL,
+			want:     true,
+		},
+		{
+			name:    "request timeout",
+			handler: stall,
+			options: []ote.Option{ote.WithTimeout(50 * time.Millisecond)},
+			want:    true,
+		},
+		{
+			name:    "request timeout of an HTTP client set after it",
+			handler: stall,
+			options: []ote.Option{ote.WithTimeout(50 * time.Millisecond), ote.WithHTTPClient(&http.Client{})},
+			want:    true,
+		},
+		{
+			name:    "cancelled",
+			handler: stall,
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(50*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+		},
+		{
+			name:    "caller deadline",
+			handler: stall,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+		},
+		{
+			name:    "caller deadline within request timeout",
+			handler: stall,
+			options: []ote.Option{ote.WithTimeout(time.Minute)},
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+		},
+		{
+			name:     "unsupported scheme",
+			endpoint: "ftp://www.ote-cr.cz/services/PublicDataService",
+		},
+		{
+			name:     "malformed URL",
+			endpoint: "http://[::1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			endpoint := test.endpoint
+			if test.handler != nil {
+				server := httptest.NewServer(test.handler)
+				defer server.Close()
+				endpoint = server.URL
+			}
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if test.ctx != nil {
+				ctx, cancel = test.ctx()
+			}
+			defer cancel()
+			client := ote.NewClient(append([]ote.Option{ote.WithEndpoint(endpoint)}, test.options...)...)
+			_, err := client.ImPrices(ctx, "2024-10-27", 1, 3)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if got := ote.IsNetwork(err); got != test.want {
+				t.Errorf("IsNetwork(%v) = %t, want %t", err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsNetworkErrors(t *testing.T) {
+	dns := &url.Error{Op: "Post", URL: ote.DefaultEndpoint, Err: &net.DNSError{Err: "no such host", Name: "www.ote-cr.cz", IsNotFound: true}}
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("GetImPriceE: %w", ote.ErrHTTPStatus(http.StatusBadGateway)), true},
+		{fmt.Errorf("GetImPriceE: %w", ote.ErrHTTPStatus(http.StatusTooManyRequests)), false},
+		{fmt.Errorf("GetImPriceE: %w", dns), true},
+		{&ote.ErrRequest{RequestID: "1", Err: fmt.Errorf("GetImPriceE: %w", dns)}, true},
+		{fmt.Errorf("GetImPriceE: %w", &ote.ErrSOAPFault{Code: "soapenv:Server"}), false},
+		{fmt.Errorf("GetImPriceE: %w", ote.ErrNoData), false},
+		{fmt.Errorf("GetImPriceE: %w", ote.ErrDecode), false},
+		{fmt.Errorf("GetImPriceE: %w", context.Canceled), false},
+		{fmt.Errorf("GetImPriceE: %w", context.DeadlineExceeded), false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := ote.IsNetwork(test.err); got != test.want {
+			t.Errorf("IsNetwork(%v) = %t, want %t", test.err, got, test.want)
+		}
+	}
+}
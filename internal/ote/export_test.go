@@ -0,0 +1,19 @@
+package ote
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// ResolveFailing resolves the market timezone as Location does, with the
+// named resolvers failing.
+func ResolveFailing(failing ...string) (*time.Location, string, error) {
+	rs := slices.Clone(resolvers)
+	for i, r := range rs {
+		if slices.Contains(failing, r.name) {
+			rs[i].load = func(string) (*time.Location, error) { return nil, errors.New("unavailable") }
+		}
+	}
+	return resolveWith(rs)
+}
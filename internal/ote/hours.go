@@ -0,0 +1,107 @@
+package ote
+
+import (
+	"fmt"
+	"time"
+)
+
+// The market numbers the trading hours of a day from 1, for the hour
+// starting at midnight, to 24, or 23 and 25 on the days of the DST changes,
+// when an hour of the clock is skipped or repeated. Go numbers the hours of
+// the clock from 0 to 23, so they are converted with the functions below.
+
+// midnight returns the start of the trading day, given as time.DateOnly.
+func midnight(day string) (time.Time, error) {
+	return time.ParseInLocation(time.DateOnly, day, Location())
+}
+
+// Day returns the trading day t falls in, as time.DateOnly. The requests
+// take their dates from it or AddDays rather than formatting them, as the
+// day of t in another time zone may be another one.
+func Day(t time.Time) string {
+	return t.In(Location()).Format(time.DateOnly)
+}
+
+// AddDays returns the trading day days after day, before it if negative.
+func AddDays(day string, days int) (string, error) {
+	start, err := midnight(day)
+	if err != nil {
+		return "", err
+	}
+	return Day(start.AddDate(0, 0, days)), nil
+}
+
+// HourIndex returns the trading day of t, as time.DateOnly, and the index of
+// the trading hour t falls in.
+func HourIndex(t time.Time) (day string, hour int) {
+	t = t.In(Location())
+	y, m, d := t.Date()
+	start := time.Date(y, m, d, 0, 0, 0, 0, Location())
+	return Day(start), int(t.Sub(start)/time.Hour) + 1
+}
+
+// HourStart returns the start of the trading hour of the day.
+func HourStart(day string, hour int) (time.Time, error) {
+	start, err := midnight(day)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return start.Add(time.Duration(hour-1) * time.Hour), nil
+}
+
+// HoursIn returns the number of trading hours of the day.
+func HoursIn(day string) (int, error) {
+	start, err := midnight(day)
+	if err != nil {
+		return 0, err
+	}
+	y, m, d := start.Date()
+	return int(time.Date(y, m, d+1, 0, 0, 0, 0, Location()).Sub(start) / time.Hour), nil
+}
+
+// EachDay calls fn with every trading day from from to to, inclusive, and
+// its number of trading hours, stopping at the first error.
+func EachDay(from, to string, fn func(day string, hours int) error) error {
+	first, err := midnight(from)
+	if err != nil {
+		return err
+	}
+	for day := first; Day(day) <= to; day = day.AddDate(0, 0, 1) {
+		date := Day(day)
+		hours, err := HoursIn(date)
+		if err != nil {
+			return err
+		}
+		if err := fn(date, hours); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDays returns ErrInvalidRequest unless the days are trading days, as
+// time.DateOnly, and to is not before from.
+func checkDays(from, to string) error {
+	for _, day := range []string{from, to} {
+		if _, err := midnight(day); err != nil {
+			return fmt.Errorf("%w: day %q: %w", ErrInvalidRequest, day, err)
+		}
+	}
+	if to < from {
+		return fmt.Errorf("%w: %s is before %s", ErrInvalidRequest, to, from)
+	}
+	return nil
+}
+
+// checkHours returns ErrInvalidRequest unless the hours are trading hours of
+// the day, from 1 up to 23, 24 or 25, and toHour is not before fromHour.
+func checkHours(day string, fromHour, toHour int) error {
+	hours, err := HoursIn(day)
+	if err != nil {
+		return fmt.Errorf("%w: day %q: %w", ErrInvalidRequest, day, err)
+	}
+	if fromHour < 1 || toHour > hours || toHour < fromHour {
+		return fmt.Errorf("%w: hours %d to %d of %s, which has %d", ErrInvalidRequest, fromHour, toHour, day, hours)
+	}
+	return nil
+}
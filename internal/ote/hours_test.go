@@ -0,0 +1,278 @@
+package ote_test
+
+import (
+	"context"
+	"encoding/xml"
+	e "errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+func TestHourIndex(t *testing.T) {
+	prague := ote.Location()
+	tests := []struct {
+		at   time.Time
+		day  string
+		hour int
+	}{
+		{time.Date(2024, time.March, 4, 0, 0, 0, 0, prague), "2024-03-04", 1},
+		{time.Date(2024, time.March, 4, 0, 59, 59, 0, prague), "2024-03-04", 1},
+		{time.Date(2024, time.March, 4, 23, 0, 0, 0, prague), "2024-03-04", 24},
+		{time.Date(2024, time.March, 4, 23, 59, 59, 0, prague), "2024-03-04", 24},
+		// Midnight in Prague is still the day before in UTC
+		{time.Date(2024, time.March, 4, 23, 30, 0, 0, time.UTC), "2024-03-05", 1},
+		{time.Date(2024, time.March, 4, 22, 30, 0, 0, time.UTC), "2024-03-04", 24},
+		// 02:00 is skipped in spring, 03:00 CEST is the third trading hour
+		{time.Date(2024, time.March, 31, 1, 30, 0, 0, prague), "2024-03-31", 2},
+		{time.Date(2024, time.March, 31, 3, 0, 0, 0, prague), "2024-03-31", 3},
+		{time.Date(2024, time.March, 31, 23, 0, 0, 0, prague), "2024-03-31", 23},
+		// 02:00 is repeated in autumn, first in CEST, then in CET
+		{time.Date(2024, time.October, 27, 0, 0, 0, 0, time.UTC), "2024-10-27", 3},
+		{time.Date(2024, time.October, 27, 1, 0, 0, 0, time.UTC), "2024-10-27", 4},
+		{time.Date(2024, time.October, 27, 23, 0, 0, 0, prague), "2024-10-27", 25},
+	}
+	for _, test := range tests {
+		day, hour := ote.HourIndex(test.at)
+		if day != test.day || hour != test.hour {
+			t.Errorf("HourIndex(%s) = %s hour %d, want %s hour %d", test.at, day, hour, test.day, test.hour)
+		}
+	}
+}
+
+func TestHourStart(t *testing.T) {
+	tests := []struct {
+		day   string
+		hours int
+	}{
+		{"2024-03-04", 24},
+		{"2024-03-31", 23},
+		{"2024-10-27", 25},
+		{"2024-02-29", 24},
+	}
+	for _, test := range tests {
+		hours, err := ote.HoursIn(test.day)
+		if err != nil || hours != test.hours {
+			t.Errorf("HoursIn(%s) = %d, %v, want %d", test.day, hours, err, test.hours)
+		}
+		// Every hour starts an hour after the one before and maps back to it
+		var previous time.Time
+		for hour := 1; hour <= test.hours; hour++ {
+			start, err := ote.HourStart(test.day, hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hour > 1 && start.Sub(previous) != time.Hour {
+				t.Errorf("%s hour %d starts %s after hour %d", test.day, hour, start.Sub(previous), hour-1)
+			}
+			if day, index := ote.HourIndex(start); day != test.day || index != hour {
+				t.Errorf("%s hour %d starts at %s, in %s hour %d", test.day, hour, start, day, index)
+			}
+			previous = start
+		}
+	}
+	if _, err := ote.HourStart("2024-02-30", 1); err == nil {
+		t.Error("HourStart of 2024-02-30: no error")
+	}
+}
+
+func TestAddDays(t *testing.T) {
+	tests := []struct {
+		day  string
+		days int
+		want string
+	}{
+		{"2024-12-31", 1, "2025-01-01"},
+		{"2025-01-01", -1, "2024-12-31"},
+		{"2024-02-28", 1, "2024-02-29"},
+		{"2023-02-28", 1, "2023-03-01"},
+		{"2024-03-30", 1, "2024-03-31"},
+		{"2024-03-31", 1, "2024-04-01"},
+		{"2024-10-27", 1, "2024-10-28"},
+		{"2024-10-28", -1, "2024-10-27"},
+	}
+	for _, test := range tests {
+		if got, err := ote.AddDays(test.day, test.days); err != nil || got != test.want {
+			t.Errorf("AddDays(%s, %d) = %s, %v, want %s", test.day, test.days, got, err, test.want)
+		}
+	}
+}
+
+func TestEachDay(t *testing.T) {
+	var days []string
+	var hours []int
+	err := ote.EachDay("2024-10-26", "2024-10-28", func(day string, n int) error {
+		days = append(days, day)
+		hours = append(hours, n)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2024-10-26", "2024-10-27", "2024-10-28"}
+	if len(days) != len(want) || days[0] != want[0] || days[1] != want[1] || days[2] != want[2] {
+		t.Errorf("days %v, want %v", days, want)
+	}
+	if len(hours) != 3 || hours[0] != 24 || hours[1] != 25 || hours[2] != 24 {
+		t.Errorf("hours %v, want [24 25 24]", hours)
+	}
+}
+
+func TestInvalidRequest(t *testing.T) {
+	// The requests are checked before calling the service
+	client := ote.NewClient(ote.WithEndpoint("http://127.0.0.1:1"))
+	ctx := context.Background()
+	tests := []struct {
+		day              string
+		fromHour, toHour int
+	}{
+		{"2024-03-31", 1, 24},
+		{"2024-03-04", 0, 3},
+		{"2024-03-04", 1, 25},
+		{"2024-03-04", 5, 4},
+		{"2024-13-01", 1, 1},
+	}
+	for _, test := range tests {
+		if _, err := client.ImPrices(ctx, test.day, test.fromHour, test.toHour); !e.Is(err, ote.ErrInvalidRequest) {
+			t.Errorf("%s hours %d to %d: got error %v, want ErrInvalidRequest", test.day, test.fromHour, test.toHour, err)
+		}
+	}
+	if _, err := client.ImPrices(ctx, "2024-10-27", 25, 25); e.Is(err, ote.ErrInvalidRequest) {
+		t.Errorf("hour 25 of the autumn DST day: %v", err)
+	}
+	if _, err := client.DamPrices(ctx, "2024-03-05", "2024-03-04"); !e.Is(err, ote.ErrInvalidRequest) {
+		t.Errorf("days in reverse: got error %v, want ErrInvalidRequest", err)
+	}
+}
+
+func TestDay(t *testing.T) {
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		// Midnight in Prague is an hour or two before midnight in UTC
+		{time.Date(2024, time.December, 31, 22, 59, 59, 0, time.UTC), "2024-12-31"},
+		{time.Date(2024, time.December, 31, 23, 0, 0, 0, time.UTC), "2025-01-01"},
+		{time.Date(2024, time.February, 28, 23, 0, 0, 0, time.UTC), "2024-02-29"},
+		{time.Date(2024, time.February, 29, 23, 0, 0, 0, time.UTC), "2024-03-01"},
+		{time.Date(2024, time.June, 30, 21, 59, 0, 0, time.UTC), "2024-06-30"},
+		{time.Date(2024, time.June, 30, 22, 0, 0, 0, time.UTC), "2024-07-01"},
+		{time.Date(2025, time.January, 1, 0, 30, 0, 0, time.FixedZone("EST", -5*3600)), "2025-01-01"},
+		{time.Date(2024, time.December, 31, 20, 0, 0, 0, time.FixedZone("EST", -5*3600)), "2025-01-01"},
+	}
+	for _, test := range tests {
+		if got := ote.Day(test.at); got != test.want {
+			t.Errorf("Day(%s) = %s, want %s", test.at, got, test.want)
+		}
+	}
+}
+
+// TestHourProperties checks the conversions between instants and trading
+// hours on random instants from 2000 to 2100, in random time zones.
+func TestHourProperties(t *testing.T) {
+	first := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	last := time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	config := &quick.Config{
+		MaxCount: 20000,
+		Values: func(values []reflect.Value, r *rand.Rand) {
+			at := time.Unix(first+r.Int63n(last-first), 0)
+			values[0] = reflect.ValueOf(at.In(time.FixedZone("", (r.Intn(27)-12)*3600)))
+		},
+	}
+	property := func(at time.Time) bool {
+		day, hour := ote.HourIndex(at)
+		hours, err := ote.HoursIn(day)
+		if err != nil || day != ote.Day(at) || hour < 1 || hour > hours || hours < 23 || hours > 25 {
+			t.Logf("%s: %s hour %d of %d, %v", at, day, hour, hours, err)
+			return false
+		}
+		// The instant falls in its trading hour
+		start, err := ote.HourStart(day, hour)
+		if err != nil || at.Before(start) || !at.Before(start.Add(time.Hour)) {
+			t.Logf("%s: hour %d of %s starts at %s, %v", at, hour, day, start, err)
+			return false
+		}
+		// and the days around it are those of the instants a day away
+		next, err := ote.AddDays(day, 1)
+		if err != nil || next != ote.Day(start.Add(time.Duration(hours-hour+1)*time.Hour)) {
+			t.Logf("%s: the day after %s is %s, %v", at, day, next, err)
+			return false
+		}
+		previous, err := ote.AddDays(next, -1)
+		return err == nil && previous == day
+	}
+	if err := quick.Check(property, config); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequestParameters(t *testing.T) {
+	var parameters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Body struct {
+				Operation struct {
+					Parameters []struct {
+						XMLName xml.Name
+						Value   string `xml:",chardata"`
+					} `xml:",any"`
+				} `xml:",any"`
+			}
+		}
+		body, _ := io.ReadAll(r.Body)
+		xml.Unmarshal(body, &request)
+		parameters = parameters[:0]
+		for _, p := range request.Body.Operation.Parameters {
+			parameters = append(parameters, p.XMLName.Local+"="+p.Value)
+		}
+		w.Write(otetest.FaultResponse("soapenv:Server", "recorded"))
+	}))
+	defer server.Close()
+	client := ote.NewClient(ote.WithEndpoint(server.URL))
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		request func() error
+		want    []string
+	}{
+		{"last hour of the year", func() error {
+			_, err := client.ImPrices(ctx, "2024-12-31", 24, 24)
+			return err
+		}, []string{"StartDate=2024-12-31", "EndDate=2024-12-31", "StartHour=24", "EndHour=24"}},
+		{"whole leap day", func() error {
+			_, err := client.ImPrices(ctx, "2024-02-29", 1, 24)
+			return err
+		}, []string{"StartDate=2024-02-29", "EndDate=2024-02-29", "StartHour=1", "EndHour=24"}},
+		{"repeated hour", func() error {
+			_, err := client.ImPrices(ctx, "2024-10-27", 25, 25)
+			return err
+		}, []string{"StartDate=2024-10-27", "EndDate=2024-10-27", "StartHour=25", "EndHour=25"}},
+		{"across the year", func() error {
+			_, err := client.DamPrices(ctx, "2024-12-31", "2025-01-01")
+			return err
+		}, []string{"StartDate=2024-12-31", "EndDate=2025-01-01"}},
+		{"index", func() error {
+			_, err := client.DamIndex(ctx, "2024-02-28", "2024-03-01")
+			return err
+		}, []string{"StartDate=2024-02-28", "EndDate=2024-03-01"}},
+	}
+	for _, test := range tests {
+		var fault *ote.ErrSOAPFault
+		if err := test.request(); !e.As(err, &fault) {
+			t.Errorf("%s: error %v, want the recorded fault", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(parameters[:min(len(parameters), len(test.want))], test.want) {
+			t.Errorf("%s: parameters %v, want %v", test.name, parameters, test.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package otetest provides a scripted ote.PriceSource for tests of code
+// using the ote package, so that they need no HTTP server, and the responses
+// of the service for those that do.
+package otetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// Call is a call of a method of Fake.
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// response is a scripted result of one call.
+type response struct {
+	points  []ote.PricePoint
+	indexes []ote.DamIndex
+	err     error
+}
+
+// Fake is an ote.PriceSource returning scripted responses. Each method
+// returns the responses queued for it in order, repeating the last one when
+// they run out, and ote.ErrNoData when none was queued. It is safe for
+// concurrent use.
+type Fake struct {
+	mu        sync.Mutex
+	responses map[string][]response
+	calls     []Call
+}
+
+var _ ote.PriceSource = (*Fake)(nil)
+
+// NewFake returns a Fake without any responses.
+func NewFake() *Fake {
+	return &Fake{responses: make(map[string][]response)}
+}
+
+// AddImPrices queues a response of ImPrices.
+func (f *Fake) AddImPrices(points []ote.PricePoint, err error) *Fake {
+	return f.add("ImPrices", response{points: points, err: err})
+}
+
+// AddDamPrices queues a response of DamPrices.
+func (f *Fake) AddDamPrices(points []ote.PricePoint, err error) *Fake {
+	return f.add("DamPrices", response{points: points, err: err})
+}
+
+// AddDamIndex queues a response of DamIndex.
+func (f *Fake) AddDamIndex(indexes []ote.DamIndex, err error) *Fake {
+	return f.add("DamIndex", response{indexes: indexes, err: err})
+}
+
+func (f *Fake) add(method string, r response) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[method] = append(f.responses[method], r)
+	return f
+}
+
+// next records the call and returns its response.
+func (f *Fake) next(method string, args ...any) response {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+	queue := f.responses[method]
+	switch len(queue) {
+	case 0:
+		return response{err: fmt.Errorf("%s: %w", method, ote.ErrNoData)}
+	case 1:
+		return queue[0]
+	}
+	f.responses[method] = queue[1:]
+	return queue[0]
+}
+
+// Calls returns the calls made so far.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+func (f *Fake) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	r := f.next("ImPrices", day, fromHour, toHour)
+	return r.points, r.err
+}
+
+func (f *Fake) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	r := f.next("DamPrices", from, to)
+	return r.points, r.err
+}
+
+func (f *Fake) DamIndex(ctx context.Context, from, to string) ([]ote.DamIndex, error) {
+	r := f.next("DamIndex", from, to)
+	return r.indexes, r.err
+}
+
+// Points returns the points of consecutive trading hours of the day
+// starting with the hour index first, priced in order.
+func Points(day string, first int, prices ...float64) []ote.PricePoint {
+	points := make([]ote.PricePoint, len(prices))
+	for i, price := range prices {
+		start, _ := ote.HourStart(day, first+i)
+		points[i] = ote.PricePoint{Date: day, Hour: first + i, Start: start, Price: price}
+	}
+	return points
+}
@@ -0,0 +1,33 @@
+package otetest
+
+import (
+	"encoding/xml"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// Response returns the SOAP response of the service holding the response
+// element, e.g. ote.DamPriceResponse, for an HTTP server standing in for
+// the service. It panics if the element cannot be marshalled.
+func Response[T any](response T) []byte {
+	body, err := xml.Marshal(ote.NewEnvelope(response))
+	if err != nil {
+		panic(err)
+	}
+	return append([]byte(xml.Header), body...)
+}
+
+// DamPriceResponse returns the response of GetDamPriceE with the points.
+func DamPriceResponse(points []ote.PricePoint) []byte {
+	return Response(ote.DamPriceResponse{Result: ote.ItemResult{Items: ote.Items(points)}})
+}
+
+// ImPriceResponse returns the response of GetImPriceE with the points.
+func ImPriceResponse(points []ote.PricePoint) []byte {
+	return Response(ote.ImPriceResponse{Result: ote.ItemResult{Items: ote.Items(points)}})
+}
+
+// FaultResponse returns a SOAP fault.
+func FaultResponse(code, message string) []byte {
+	return Response(&ote.Fault{Code: code, String: message})
+}
@@ -0,0 +1,84 @@
+package otetest
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// soapRequest is the part of the requests of the client the server reads.
+type soapRequest struct {
+	Body struct {
+		Operation struct {
+			XMLName   xml.Name
+			StartDate string `xml:"StartDate"`
+			EndDate   string `xml:"EndDate"`
+			StartHour int    `xml:"StartHour"`
+			EndHour   int    `xml:"EndHour"`
+			InEur     bool   `xml:"InEur"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+// NewServer starts an HTTP server standing in for the service, answering
+// GetImPriceE and GetDamPriceE with the points of the requested days and
+// hours, and the other operations with a SOAP fault. The same points serve
+// both markets. The caller closes the server; its URL is the endpoint of the
+// client, see ote.WithEndpoint.
+func NewServer(points []ote.PricePoint) *httptest.Server {
+	return newServer(points, 0)
+}
+
+// NewCurrencyServer is NewServer answering GetDamPriceE with the prices of
+// the points in EUR when the request sets InEur, and in CZK, converted at
+// the rate eurCzk, otherwise, as the service does.
+func NewCurrencyServer(points []ote.PricePoint, eurCzk float64) *httptest.Server {
+	return newServer(points, eurCzk)
+}
+
+// newServer is NewServer converting the day-ahead prices requested in CZK
+// at the rate eurCzk, unless 0.
+func newServer(points []ote.PricePoint, eurCzk float64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req soapRequest
+		body, err := io.ReadAll(r.Body)
+		if err == nil {
+			err = xml.Unmarshal(body, &req)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(FaultResponse("soapenv:Client", err.Error()))
+			return
+		}
+		op := req.Body.Operation
+		var selected []ote.PricePoint
+		for _, p := range points {
+			day := p.Date[:min(len(p.Date), len(time.DateOnly))]
+			if day < op.StartDate || day > op.EndDate {
+				continue
+			}
+			if op.XMLName.Local == "GetImPriceE" && (p.Hour < op.StartHour || p.Hour > op.EndHour) {
+				continue
+			}
+			if op.XMLName.Local == "GetDamPriceE" && !op.InEur && eurCzk != 0 {
+				p.Price *= eurCzk
+			}
+			selected = append(selected, p)
+		}
+		switch op.XMLName.Local {
+		case "GetImPriceE":
+			w.Write(ImPriceResponse(selected))
+		case "GetDamPriceE":
+			w.Write(DamPriceResponse(selected))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(FaultResponse("soapenv:Server", "unsupported operation "+strings.TrimPrefix(r.Header.Get("SOAPAction"), "urn:")))
+		}
+	}))
+}
@@ -0,0 +1,116 @@
+package ote
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader is the header carrying the identifier of each request, to
+// reference it with OTE support.
+const RequestIDHeader = "X-Request-ID"
+
+// serverIDHeaders are the headers the service may answer with its own
+// identifier of the request in, by preference.
+var serverIDHeaders = []string{"X-Request-ID", "X-Correlation-ID", "X-Message-ID"}
+
+// Call describes a request to the service, see WithCallHandler.
+type Call struct {
+	Operation string
+	// RequestID is the identifier sent in RequestIDHeader
+	RequestID string
+	// ServerID is the identifier the service answered with in a header or
+	// the MessageID of the SOAP header, if any
+	ServerID string
+	Duration time.Duration
+	// Err is the error of the request, before decoding the response
+	Err error
+}
+
+// ErrRequest wraps the errors of a request with its identifiers; each retry
+// is a request of its own, so they are those of the last.
+type ErrRequest struct {
+	RequestID string
+	ServerID  string
+	Err       error
+}
+
+func (r *ErrRequest) Error() string {
+	if r.ServerID != "" && r.ServerID != r.RequestID {
+		return fmt.Sprintf("%s (request %s, server %s)", r.Err.Error(), r.RequestID, r.ServerID)
+	}
+	return fmt.Sprintf("%s (request %s)", r.Err.Error(), r.RequestID)
+}
+
+func (r *ErrRequest) Unwrap() error {
+	return r.Err
+}
+
+// request identifies a request, see ErrRequest.
+type request struct {
+	id, serverID string
+}
+
+// wrap returns err with the identifiers of the request, nil if err is.
+func (r request) wrap(err error) error {
+	if err == nil || r.id == "" {
+		return err
+	}
+	return &ErrRequest{RequestID: r.id, ServerID: r.serverID, Err: err}
+}
+
+// newRequestID returns a random UUID, version 4.
+func newRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// serverID returns the identifier the service answered the request with, in
+// a header or, with a body, in the MessageID element of the SOAP header.
+func serverID(header http.Header, body []byte) string {
+	for _, name := range serverIDHeaders {
+		if id := header.Get(name); id != "" {
+			return id
+		}
+	}
+	if body == nil {
+		return ""
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	inHeader := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		start, ok := token.(xml.StartElement)
+		switch {
+		case !ok:
+		case start.Name.Local == "Header":
+			inHeader = true
+		case start.Name.Local == "Body":
+			return ""
+		case inHeader && start.Name.Local == "MessageID":
+			var id string
+			if decoder.DecodeElement(&id, &start) != nil {
+				return ""
+			}
+			return strings.TrimSpace(id)
+		}
+	}
+}
+
+// called reports the request to the call handler of the client.
+func (c *Client) called(ctx context.Context, call Call) {
+	if c.onCall != nil {
+		c.onCall(ctx, call)
+	}
+}
@@ -0,0 +1,147 @@
+package ote_test
+
+import (
+	"bytes"
+	"context"
+	e "errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+// uuid matches a random UUID, version 4.
+var uuid = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// recordingServer answers with the responses in turn, the last repeated,
+// recording the request IDs it was sent.
+type recordingServer struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (s *recordingServer) start(t *testing.T, responses ...func(w http.ResponseWriter)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.ids = append(s.ids, r.Header.Get(ote.RequestIDHeader))
+		respond := responses[min(len(s.ids), len(responses))-1]
+		s.mu.Unlock()
+		respond(w)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func respondWith(status int, body []byte, header ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(status)
+		w.Write(body)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	points := otetest.Points("2024-10-01", 1, 90, 95)
+	recorder := new(recordingServer)
+	server := recorder.start(t,
+		respondWith(http.StatusServiceUnavailable, []byte("maintenance")),
+		respondWith(http.StatusOK, otetest.DamPriceResponse(points)))
+	var calls []ote.Call
+	client := ote.NewClient(ote.WithEndpoint(server.URL), ote.WithRetries(1, time.Millisecond),
+		ote.WithCallHandler(func(ctx context.Context, call ote.Call) { calls = append(calls, call) }))
+
+	if got, err := client.DamPrices(context.Background(), "2024-10-01", "2024-10-01"); err != nil || len(got) != 2 {
+		t.Fatalf("points %v, %v, want those of the retry", got, err)
+	}
+	// Every attempt is a request of its own
+	if len(recorder.ids) != 2 || recorder.ids[0] == recorder.ids[1] {
+		t.Fatalf("request IDs %q, want two different", recorder.ids)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("calls %+v, want both attempts", calls)
+	}
+	for i, call := range calls {
+		if !uuid.MatchString(recorder.ids[i]) || call.RequestID != recorder.ids[i] || call.Operation != "GetDamPriceE" || call.Duration <= 0 {
+			t.Errorf("call %d %+v, want request %s", i, call, recorder.ids[i])
+		}
+	}
+	var status ote.ErrHTTPStatus
+	if !e.As(calls[0].Err, &status) || status != http.StatusServiceUnavailable || calls[1].Err != nil {
+		t.Errorf("errors of the calls %v and %v, want 503 then none", calls[0].Err, calls[1].Err)
+	}
+}
+
+func TestErrRequest(t *testing.T) {
+	points := otetest.Points("2024-10-01", 1, 90)
+	// The MessageID of the SOAP header
+	withMessageID := bytes.Replace(otetest.DamPriceResponse(nil), []byte("<Envelope>"),
+		[]byte(`<Envelope><Header><MessageID xmlns="http://www.w3.org/2005/08/addressing"> urn:uuid:ote-7 </MessageID></Header>`), 1)
+	tests := []struct {
+		name     string
+		respond  func(w http.ResponseWriter)
+		want     error
+		serverID string
+	}{
+		{"fault", respondWith(http.StatusInternalServerError, otetest.FaultResponse("soapenv:Server", "maintenance")), &ote.ErrSOAPFault{}, ""},
+		{"status", respondWith(http.StatusBadGateway, nil, "X-Correlation-ID", "ote-42"), ote.ErrHTTPStatus(http.StatusBadGateway), "ote-42"},
+		{"no data", respondWith(http.StatusOK, otetest.DamPriceResponse(nil), "X-Message-ID", "ote-43"), ote.ErrNoData, "ote-43"},
+		{"message ID", respondWith(http.StatusOK, withMessageID), ote.ErrNoData, "urn:uuid:ote-7"},
+		{"decode", respondWith(http.StatusOK, otetest.ImPriceResponse(points)), ote.ErrDecode, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := new(recordingServer)
+			client := ote.NewClient(ote.WithEndpoint(recorder.start(t, test.respond).URL))
+			_, err := client.DamPrices(context.Background(), "2024-10-01", "2024-10-01")
+
+			var request *ote.ErrRequest
+			if !e.As(err, &request) || len(recorder.ids) != 1 || request.RequestID != recorder.ids[0] {
+				t.Fatalf("error %v, want ErrRequest of request %q", err, recorder.ids)
+			}
+			if request.ServerID != test.serverID {
+				t.Errorf("server ID %q, want %q", request.ServerID, test.serverID)
+			}
+			// The errors wrapped are still those of the failure
+			switch want := test.want.(type) {
+			case *ote.ErrSOAPFault:
+				if !e.As(err, &want) || want.String != "maintenance" {
+					t.Errorf("error %v, want the SOAP fault", err)
+				}
+			default:
+				if !e.Is(err, want) {
+					t.Errorf("error %v, want %v", err, want)
+				}
+			}
+			suffix := " (request " + recorder.ids[0] + ")"
+			if test.serverID != "" {
+				suffix = " (request " + recorder.ids[0] + ", server " + test.serverID + ")"
+			}
+			if !strings.HasSuffix(err.Error(), suffix) || !strings.HasPrefix(err.Error(), "GetDamPriceE: ") {
+				t.Errorf("error %q, want it ending with %q", err, suffix)
+			}
+		})
+	}
+}
+
+func TestEchoedRequestID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		respondWith(http.StatusOK, otetest.DamPriceResponse(nil), ote.RequestIDHeader, r.Header.Get(ote.RequestIDHeader))(w)
+	}))
+	defer server.Close()
+	_, err := ote.NewClient(ote.WithEndpoint(server.URL)).DamPrices(context.Background(), "2024-10-01", "2024-10-01")
+	// The ID echoed is quoted once
+	var request *ote.ErrRequest
+	if !e.As(err, &request) || request.ServerID != request.RequestID || strings.Contains(err.Error(), "server") {
+		t.Errorf("error %v, want the request ID only", err)
+	}
+}
@@ -0,0 +1,109 @@
+package ote
+
+import (
+	"context"
+	"encoding/xml"
+	e "errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// serviceNamespace is the namespace of the responses of the service.
+const serviceNamespace = "http://www.ote-cr.cz/schema/service/public"
+
+// itemStream decodes the Item elements of a response one at a time as they
+// are read, instead of the whole response at once, passing their points to
+// fn. The memory used does not grow with the number of items. Like
+// decodeItems, it matches the elements by their local names, whatever their
+// namespaces.
+type itemStream struct {
+	// response is the local name of the response element
+	response string
+	fn       func(PricePoint) error
+	// name is that of the response element once it is read
+	name  xml.Name
+	items int
+}
+
+// decode reads the response from r. A SOAP fault is returned as
+// *ErrSOAPFault, a malformed response as ErrDecode and an error of fn as it
+// is.
+func (s *itemStream) decode(r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return decodeError(err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch {
+		case start.Name.Local == "Fault":
+			fault := new(Fault)
+			if err := decoder.DecodeElement(fault, &start); err != nil {
+				return decodeError(err)
+			}
+			return &ErrSOAPFault{Code: fault.Code, String: fault.String}
+		case s.name.Local == "" && start.Name.Local == s.response:
+			s.name = start.Name
+		case start.Name.Local == "Item" && s.name.Local != "":
+			item := new(ItemE)
+			if err := decoder.DecodeElement(item, &start); err != nil {
+				return decodeError(err)
+			}
+			s.items++
+			if err := s.fn(item.point()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// decodeError returns the errors of the XML decoder as ErrDecode, except
+// those of reading, e.g. a connection lost while streaming.
+func decodeError(err error) error {
+	var syntax *xml.SyntaxError
+	var unsupported xml.UnmarshalError
+	var number *strconv.NumError
+	if e.As(err, &syntax) || e.As(err, &unsupported) || e.As(err, &number) || e.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	return err
+}
+
+// DecodeDamPrices decodes a GetDamPriceE response read from r, e.g. saved
+// from a bulk download, calling fn with the point of each item as it is
+// read. It stops at the first error of fn and returns it.
+func DecodeDamPrices(r io.Reader, fn func(PricePoint) error) error {
+	s := &itemStream{response: "GetDamPriceEResponse", fn: fn}
+	if err := s.decode(r); err != nil {
+		return fmt.Errorf("GetDamPriceE: %w", err)
+	}
+	return check("GetDamPriceE", s.name, s.items)
+}
+
+// StreamDamPrices is DamPrices for long windows, e.g. months of history: it
+// calls fn with each point as the response is read instead of returning
+// them all, and does not bound the size of the response. It stops at the
+// first error of fn and returns it. Once a point was passed to fn, a failing
+// request is not retried.
+func (c *Client) StreamDamPrices(ctx context.Context, from, to string, fn func(PricePoint) error) error {
+	if err := checkDays(from, to); err != nil {
+		return fmt.Errorf("GetDamPriceE: %w", err)
+	}
+	s := &itemStream{response: "GetDamPriceEResponse", fn: fn}
+	req, err := c.call(ctx, "GetDamPriceE", c.damPriceParameters(from, to), s)
+	if err != nil {
+		return err
+	}
+	if s.name.Local != "" && s.name.Space != serviceNamespace {
+		c.drift("GetDamPriceE", fmt.Sprintf("the %s element is in %q, expected %q", s.name.Local, s.name.Space, serviceNamespace))
+	}
+	return req.wrap(check("GetDamPriceE", s.name, s.items))
+}
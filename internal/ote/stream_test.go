@@ -0,0 +1,146 @@
+package ote_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	e "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+// longHistory returns the points of consecutive days from 1 January 2023,
+// across changes of the summer time, until there are at least n.
+func longHistory(n int) []ote.PricePoint {
+	var points []ote.PricePoint
+	for day := time.Date(2023, time.January, 1, 12, 0, 0, 0, ote.Location()); len(points) < n; day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		hours, _ := ote.HoursIn(date)
+		prices := make([]float64, hours)
+		for i := range prices {
+			prices[i] = float64(len(points)+i)/4 - 500
+		}
+		points = append(points, otetest.Points(date, 1, prices...)...)
+	}
+	return points
+}
+
+// equalPoints reports whether the points are the same, comparing the
+// starts as instants.
+func equalPoints(a, b []ote.PricePoint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		p, q := a[i], b[i]
+		if p.Date != q.Date || p.Hour != q.Hour || !p.Start.Equal(q.Start) || p.Price != q.Price || p.Volume != q.Volume {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStreamDamPrices(t *testing.T) {
+	points := longHistory(10000)
+	server := otetest.NewServer(points)
+	defer server.Close()
+	client := ote.NewClient(ote.WithEndpoint(server.URL))
+	from, to := points[0].Date, points[len(points)-1].Date
+
+	decoded, err := client.DamPrices(context.Background(), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamed []ote.PricePoint
+	err = client.StreamDamPrices(context.Background(), from, to, func(p ote.PricePoint) error {
+		streamed = append(streamed, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalPoints(streamed, decoded) || !equalPoints(streamed, points) {
+		t.Errorf("streamed %d points, decoded %d, want the same %d", len(streamed), len(decoded), len(points))
+	}
+
+	// The first error of the callback stops the stream
+	stop, n := e.New("stop"), 0
+	err = client.StreamDamPrices(context.Background(), from, to, func(ote.PricePoint) error {
+		if n++; n == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !e.Is(err, stop) || n != 3 {
+		t.Errorf("error %v after %d points, want stop after 3", err, n)
+	}
+}
+
+func TestDecodeDamPrices(t *testing.T) {
+	points := otetest.Points("2024-10-27", 1, 90.5, -3, 0, 120)
+	body := otetest.DamPriceResponse(points)
+
+	// The points are those the whole response decodes to
+	var response ote.ElectricityDailyForAgentureTrade
+	if err := xml.Unmarshal(body, &response); err != nil {
+		t.Fatal(err)
+	}
+	var streamed []ote.PricePoint
+	err := ote.DecodeDamPrices(bytes.NewReader(body), func(p ote.PricePoint) error {
+		streamed = append(streamed, p)
+		return nil
+	})
+	if err != nil || !equalPoints(streamed, points) || len(response.Body.Response.Result.Items) != len(streamed) {
+		t.Errorf("points %v, %v, want %v", streamed, err, points)
+	}
+
+	tests := []struct {
+		name string
+		body []byte
+		want error
+	}{
+		{"empty", otetest.DamPriceResponse(nil), ote.ErrNoData},
+		{"truncated", body[:len(body)/2], ote.ErrDecode},
+		{"malformed price", bytes.Replace(body, []byte(">90.5<"), []byte(">90,5<"), 1), ote.ErrDecode},
+		{"another response", otetest.ImPriceResponse(points), ote.ErrDecode},
+	}
+	for _, test := range tests {
+		err := ote.DecodeDamPrices(bytes.NewReader(test.body), func(ote.PricePoint) error { return nil })
+		if !e.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	var fault *ote.ErrSOAPFault
+	err = ote.DecodeDamPrices(strings.NewReader(string(otetest.FaultResponse("soapenv:Server", "maintenance"))), func(ote.PricePoint) error { return nil })
+	if !e.As(err, &fault) || fault.String != "maintenance" {
+		t.Errorf("error %v, want the SOAP fault", err)
+	}
+}
+
+// BenchmarkDecodeDamPrices compares the allocations of decoding a response
+// of 10k items at once and streaming it.
+func BenchmarkDecodeDamPrices(b *testing.B) {
+	body := otetest.DamPriceResponse(longHistory(10000))
+	b.Run("unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			var response ote.ElectricityDailyForAgentureTrade
+			if err := xml.Unmarshal(body, &response); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			if err := ote.DecodeDamPrices(bytes.NewReader(body), func(ote.PricePoint) error { return nil }); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
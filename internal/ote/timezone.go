@@ -0,0 +1,126 @@
+package ote
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Timezone is the time zone of the market (CET/CEST).
+const Timezone = "Europe/Budapest"
+
+// The ways the market timezone is resolved, in order of preference, see
+// Resolution.
+const (
+	// ResolutionSystem is the time zone database of the system
+	ResolutionSystem = "system"
+	// ResolutionEmbedded is the time zone database embedded in the binary
+	ResolutionEmbedded = "embedded"
+	// ResolutionFixed is CET/CEST by the EU rules, changing on the last
+	// Sundays of March and October
+	ResolutionFixed = "fixed"
+)
+
+// fixedRule is the POSIX TZ rule of ResolutionFixed.
+const fixedRule = "CET-1CEST,M3.5.0,M10.5.0/3"
+
+// zoneDirs are the directories of the system time zone database, as
+// searched by time.LoadLocation.
+var zoneDirs = []string{"/usr/share/zoneinfo", "/usr/share/lib/zoneinfo", "/usr/lib/locale/TZ", "/etc/zoneinfo"}
+
+// resolver loads the market timezone in one of the ways of Resolution.
+type resolver struct {
+	name string
+	load func(name string) (*time.Location, error)
+}
+
+// resolvers load the market timezone in order of preference; the last
+// never fails.
+var resolvers = []resolver{
+	{ResolutionSystem, loadSystem},
+	{ResolutionEmbedded, time.LoadLocation},
+	{ResolutionFixed, loadFixed},
+}
+
+var resolved struct {
+	once sync.Once
+	loc  *time.Location
+	how  string
+	err  error
+}
+
+// resolve loads the market timezone with the resolvers.
+func resolve() {
+	resolved.loc, resolved.how, resolved.err = resolveWith(resolvers)
+}
+
+// resolveWith loads the market timezone with the first of the resolvers
+// that succeeds.
+func resolveWith(resolvers []resolver) (*time.Location, string, error) {
+	var errs []error
+	for _, r := range resolvers {
+		loc, err := r.load(Timezone)
+		if err == nil {
+			return loc, r.name, errors.Join(errs...)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", r.name, err))
+	}
+	// Not reached with loadFixed last
+	return time.FixedZone("CET", 3600), ResolutionFixed, errors.Join(errs...)
+}
+
+// Location returns the time zone of the market, see Resolution.
+func Location() *time.Location {
+	resolved.once.Do(resolve)
+	return resolved.loc
+}
+
+// Resolution returns how the time zone of the market was resolved, one of
+// the Resolution constants, and why the preferred ways failed, if they did.
+func Resolution() (string, error) {
+	resolved.once.Do(resolve)
+	return resolved.how, resolved.err
+}
+
+// loadSystem loads the zone from the system time zone database only, so
+// that falling back on the embedded one shows.
+func loadSystem(name string) (*time.Location, error) {
+	dirs := zoneDirs
+	if dir := os.Getenv("ZONEINFO"); dir != "" {
+		dirs = append([]string{dir}, dirs...)
+	}
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return time.LoadLocationFromTZData(name, data)
+		}
+	}
+	return nil, fmt.Errorf("%s not found in %s", name, dirs)
+}
+
+// loadFixed returns the zone of fixedRule, as TZif data without transitions
+// whose footer carries the rule.
+func loadFixed(name string) (*time.Location, error) {
+	designation := []byte("CET\x00")
+	// The version 1 and 2 blocks are the same without transitions
+	block := func() []byte {
+		b := make([]byte, 0, 44)
+		b = append(b, "TZif2"...)
+		b = append(b, make([]byte, 15)...)
+		// isutcnt, isstdcnt, leapcnt, timecnt, typecnt, charcnt
+		for _, n := range []uint32{0, 0, 0, 0, 1, uint32(len(designation))} {
+			b = binary.BigEndian.AppendUint32(b, n)
+		}
+		// The only local time type: +01:00, not DST, named CET
+		b = binary.BigEndian.AppendUint32(b, 3600)
+		b = append(b, 0, 0)
+		return append(b, designation...)
+	}
+	data := append(block(), block()...)
+	data = append(data, "\n"+fixedRule+"\n"...)
+	return time.LoadLocationFromTZData(name, data)
+}
@@ -0,0 +1,72 @@
+package ote_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+func TestResolution(t *testing.T) {
+	tests := []struct {
+		failing []string
+		want    string
+		err     string
+	}{
+		{nil, ote.ResolutionSystem, ""},
+		{[]string{ote.ResolutionSystem}, ote.ResolutionEmbedded, "system: unavailable"},
+		{[]string{ote.ResolutionSystem, ote.ResolutionEmbedded}, ote.ResolutionFixed, "system: unavailable\nembedded: unavailable"},
+		// The system database is preferred over the embedded one
+		{[]string{ote.ResolutionEmbedded}, ote.ResolutionSystem, ""},
+	}
+	for _, test := range tests {
+		loc, how, err := ote.ResolveFailing(test.failing...)
+		if how != test.want || loc == nil || loc.String() != ote.Timezone {
+			t.Errorf("failing %v: resolved %s as %v, want %s", test.failing, how, loc, test.want)
+		}
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.err {
+			t.Errorf("failing %v: error %q, want %q", test.failing, got, test.err)
+		}
+	}
+
+	// Location resolves once, as without failing resolvers
+	_, want, _ := ote.ResolveFailing()
+	if how, _ := ote.Resolution(); how != want || ote.Location() != ote.Location() {
+		t.Errorf("resolution %s, want %s", how, want)
+	}
+}
+
+func TestFixedResolution(t *testing.T) {
+	fixed, _, err := ote.ResolveFailing(ote.ResolutionSystem, ote.ResolutionEmbedded)
+	if err == nil {
+		t.Fatal("no error of the failed resolvers")
+	}
+	system, _, _ := ote.ResolveFailing()
+	// The EU rules hold for the recent years, hour by hour
+	start := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for at := start; at.Year() < 2027; at = at.Add(time.Hour) {
+		name, offset := at.In(fixed).Zone()
+		wantName, wantOffset := at.In(system).Zone()
+		if name != wantName || offset != wantOffset {
+			t.Fatalf("%s: %s %+d in the fixed zone, want %s %+d", at, name, offset, wantName, wantOffset)
+		}
+	}
+	// On the days the clocks change
+	for _, test := range []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2024, time.March, 31, 0, 59, 0, 0, time.UTC), "01:59 CET"},
+		{time.Date(2024, time.March, 31, 1, 0, 0, 0, time.UTC), "03:00 CEST"},
+		{time.Date(2024, time.October, 27, 0, 59, 0, 0, time.UTC), "02:59 CEST"},
+		{time.Date(2024, time.October, 27, 1, 0, 0, 0, time.UTC), "02:00 CET"},
+	} {
+		if got := test.at.In(fixed).Format("15:04 MST"); got != test.want {
+			t.Errorf("%s: %s in the fixed zone, want %s", test.at, got, test.want)
+		}
+	}
+}
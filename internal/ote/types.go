@@ -0,0 +1,104 @@
+package ote
+
+import "encoding/xml"
+
+// Envelope is the SOAP envelope of a response. The element of Response is
+// named by the XMLName of T.
+type Envelope[T any] struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    Body[T]  `xml:"Body"`
+}
+
+// Body is the SOAP body of a response.
+type Body[T any] struct {
+	XMLName  xml.Name `xml:"Body"`
+	Response T
+}
+
+// NewEnvelope returns the envelope of the response, e.g. to build fixtures
+// with xml.Marshal.
+func NewEnvelope[T any](response T) *Envelope[T] {
+	return &Envelope[T]{Body: Body[T]{Response: response}}
+}
+
+// Fault is the SOAP fault the service responds with on errors.
+type Fault struct {
+	XMLName xml.Name `xml:"Fault"`
+	Code    string   `xml:"faultcode"`
+	String  string   `xml:"faultstring"`
+}
+
+// ItemE is an hour of the prices of a market, in the responses of
+// GetDamPriceE and GetImPriceE.
+type ItemE struct {
+	XMLName xml.Name `xml:"Item"`
+	Date    string   `xml:"Date"`
+	Hour    int      `xml:"Hour"`
+	Price   float64  `xml:"Price"`
+	Volume  float64  `xml:"Volume"`
+}
+
+// Items returns the items of the points.
+func Items(points []PricePoint) []ItemE {
+	items := make([]ItemE, len(points))
+	for i, p := range points {
+		items[i] = ItemE{Date: p.Date, Hour: p.Hour, Price: p.Price, Volume: p.Volume}
+	}
+	return items
+}
+
+// point returns the point of the item.
+func (i ItemE) point() PricePoint {
+	return newPricePoint(i.Date, i.Hour, i.Price, i.Volume)
+}
+
+// ItemResult is the result of GetDamPriceE and GetImPriceE.
+type ItemResult struct {
+	XMLName xml.Name `xml:"Result"`
+	Items   []ItemE  `xml:"Item"`
+}
+
+// DamPriceResponse is the response element of GetDamPriceE.
+type DamPriceResponse struct {
+	XMLName xml.Name   `xml:"http://www.ote-cr.cz/schema/service/public GetDamPriceEResponse"`
+	Result  ItemResult `xml:"Result"`
+}
+
+// ImPriceResponse is the response element of GetImPriceE.
+type ImPriceResponse struct {
+	XMLName xml.Name   `xml:"http://www.ote-cr.cz/schema/service/public GetImPriceEResponse"`
+	Result  ItemResult `xml:"Result"`
+}
+
+// DamIndexItem is the index of a day of the day-ahead market, in the
+// response of GetDamIndexE.
+type DamIndexItem struct {
+	XMLName     xml.Name `xml:"DamIndex"`
+	Date        string   `xml:"Date"`
+	EurRate     float64  `xml:"EurRate"`
+	BaseLoad    float64  `xml:"BaseLoad"`
+	PeakLoad    float64  `xml:"PeakLoad"`
+	OffpeakLoad float64  `xml:"OffpeakLoad"`
+	Emerg       int      `xml:"Emerg"`
+}
+
+// DamIndexResult is the result of GetDamIndexE.
+type DamIndexResult struct {
+	XMLName  xml.Name       `xml:"Result"`
+	DamIndex []DamIndexItem `xml:"DamIndex"`
+}
+
+// DamIndexResponse is the response element of GetDamIndexE.
+type DamIndexResponse struct {
+	XMLName xml.Name       `xml:"http://www.ote-cr.cz/schema/service/public GetDamIndexEResponse"`
+	Result  DamIndexResult `xml:"Result"`
+}
+
+// ElectricityDailyForAgentureTrade is the response of GetDamPriceE.
+type ElectricityDailyForAgentureTrade = Envelope[DamPriceResponse]
+
+// ElectricityDayAheadTrade is the response of GetDamIndexE.
+type ElectricityDayAheadTrade = Envelope[DamIndexResponse]
+
+// ElectricityIntraDayTrade is the response of GetImPriceE.
+type ElectricityIntraDayTrade = Envelope[ImPriceResponse]
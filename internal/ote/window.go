@@ -0,0 +1,64 @@
+package ote
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// FetchWindow returns the intraday prices of the trading hours from the one
+// from falls in to the one to falls in, inclusive, sorted by their start. It
+// calls source once per trading day of the window and stitches the days
+// together; a day without prices is skipped, unless it is the last one, as
+// other errors would recur on the next day. Points outside of the window are
+// dropped and a repeated hour keeps its last point. On an error, the points
+// of the days before it are returned with it.
+func FetchWindow(ctx context.Context, source PriceSource, from, to time.Time) ([]PricePoint, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("window from %s to %s ends before it starts", from, to)
+	}
+	startDay, startHour := HourIndex(from)
+	endDay, endHour := HourIndex(to)
+	first, err := HourStart(startDay, startHour)
+	if err != nil {
+		return nil, err
+	}
+	last, err := HourStart(endDay, endHour)
+	if err != nil {
+		return nil, err
+	}
+	hours := make(map[int64]PricePoint)
+	points := func() []PricePoint {
+		stitched := make([]PricePoint, 0, len(hours))
+		for _, p := range hours {
+			stitched = append(stitched, p)
+		}
+		slices.SortFunc(stitched, func(a, b PricePoint) int { return a.Start.Compare(b.Start) })
+		return stitched
+	}
+	err = EachDay(startDay, endDay, func(day string, dayHours int) error {
+		fromHour, toHour := 1, dayHours
+		if day == startDay {
+			fromHour = startHour
+		}
+		if day == endDay {
+			toHour = endHour
+		}
+		dayPoints, err := source.ImPrices(ctx, day, fromHour, toHour)
+		if err != nil && (day == endDay || !e.Is(err, ErrNoData)) {
+			return err
+		}
+		for _, p := range dayPoints {
+			if p.Start.IsZero() {
+				return fmt.Errorf("%w: invalid date %q", ErrDecode, p.Date)
+			}
+			if !p.Start.Before(first) && !p.Start.After(last) {
+				hours[p.Start.Unix()] = p
+			}
+		}
+		return nil
+	})
+	return points(), err
+}
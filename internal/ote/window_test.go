@@ -0,0 +1,105 @@
+package ote_test
+
+import (
+	"context"
+	e "errors"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+)
+
+// dayPoints returns the points of every trading hour of the days, priced by
+// their hour index.
+func dayPoints(t *testing.T, days ...string) []ote.PricePoint {
+	t.Helper()
+	var points []ote.PricePoint
+	for _, day := range days {
+		hours, err := ote.HoursIn(day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prices := make([]float64, hours)
+		for i := range prices {
+			prices[i] = float64(i + 1)
+		}
+		points = append(points, otetest.Points(day, 1, prices...)...)
+	}
+	return points
+}
+
+func TestFetchWindow(t *testing.T) {
+	server := otetest.NewServer(dayPoints(t, "2024-10-25", "2024-10-26", "2024-10-27", "2024-10-28", "2024-10-29"))
+	defer server.Close()
+	client := ote.NewClient(ote.WithEndpoint(server.URL))
+	prague := ote.Location()
+	tests := []struct {
+		name     string
+		from, to time.Time
+		hours    int
+	}{
+		{"1 day", time.Date(2024, time.October, 25, 0, 0, 0, 0, prague), time.Date(2024, time.October, 25, 23, 0, 0, 0, prague), 24},
+		{"within an hour", time.Date(2024, time.October, 25, 10, 15, 0, 0, prague), time.Date(2024, time.October, 25, 10, 45, 0, 0, prague), 1},
+		{"2 days", time.Date(2024, time.October, 25, 18, 30, 0, 0, prague), time.Date(2024, time.October, 26, 5, 0, 0, 0, prague), 12},
+		// The 25 hours of the day of the switch to winter time are included
+		{"5 days", time.Date(2024, time.October, 25, 0, 0, 0, 0, prague), time.Date(2024, time.October, 29, 23, 0, 0, 0, prague), 5*24 + 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			points, err := ote.FetchWindow(context.Background(), client, test.from, test.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(points) != test.hours {
+				t.Fatalf("got %d points, want %d", len(points), test.hours)
+			}
+			for i, p := range points {
+				if i > 0 && p.Start.Sub(points[i-1].Start) != time.Hour {
+					t.Errorf("point %d starts at %s, %s after the one before", i, p.Start, p.Start.Sub(points[i-1].Start))
+				}
+				if day, hour := ote.HourIndex(p.Start); day != p.Date[:len(time.DateOnly)] || hour != p.Hour {
+					t.Errorf("point %d of %s hour %d starts at %s", i, p.Date, p.Hour, p.Start)
+				}
+			}
+			if first := points[0].Start; first.After(test.from) || first.Add(time.Hour).Before(test.from) {
+				t.Errorf("first point starts at %s, want the hour of %s", first, test.from)
+			}
+			if last := points[len(points)-1].Start; last.After(test.to) || last.Add(time.Hour).Before(test.to) {
+				t.Errorf("last point starts at %s, want the hour of %s", last, test.to)
+			}
+		})
+	}
+}
+
+func TestFetchWindowMissingDays(t *testing.T) {
+	prague := ote.Location()
+	from := time.Date(2024, time.March, 4, 22, 0, 0, 0, prague)
+	to := time.Date(2024, time.March, 6, 1, 0, 0, 0, prague)
+	// A day without prices in the middle is skipped
+	source := otetest.NewFake().
+		AddImPrices(otetest.Points("2024-03-04", 23, 1, 2), nil).
+		AddImPrices(nil, ote.ErrNoData).
+		AddImPrices(otetest.Points("2024-03-06", 1, 3, 4), nil)
+	points, err := ote.FetchWindow(context.Background(), source, from, to)
+	if err != nil || len(points) != 4 {
+		t.Errorf("got %d points and error %v, want 4 and none", len(points), err)
+	}
+	calls := source.Calls()
+	if len(calls) != 3 || calls[0].Args[1] != 23 || calls[1].Args[1] != 1 || calls[1].Args[2] != 24 || calls[2].Args[2] != 2 {
+		t.Errorf("calls %v, want hours 23 to 24, 1 to 24 and 1 to 2", calls)
+	}
+	// The last day is not, nor are other errors
+	for _, want := range []error{ote.ErrNoData, ote.ErrDecode} {
+		source = otetest.NewFake().
+			AddImPrices(otetest.Points("2024-03-04", 23, 1, 2), nil).
+			AddImPrices(otetest.Points("2024-03-05", 1, 3), want)
+		points, err = ote.FetchWindow(context.Background(), source, from, time.Date(2024, time.March, 5, 0, 0, 0, 0, prague))
+		if !e.Is(err, want) || len(points) != 2 {
+			t.Errorf("got %d points and error %v, want the 2 of the first day and %v", len(points), err, want)
+		}
+	}
+	if _, err := ote.FetchWindow(context.Background(), source, to, from); err == nil {
+		t.Error("window ending before it starts: no error")
+	}
+}
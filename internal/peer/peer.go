@@ -0,0 +1,239 @@
+// Package peer shares the intraday prices fetched by one node, the leader,
+// with the other nodes, its followers, so that only the leader calls OTE.
+//
+// The leader serves the prices of its last fetch with Handler, the followers
+// read them with Source, falling back to fetching them themselves while the
+// leader cannot serve fresh ones. With a shared key, the leader signs the
+// responses and the followers reject those it did not sign.
+package peer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// SignatureHeader carries the signature of a response, "sha256=" and the hex
+// HMAC-SHA256 of the body with the shared key.
+const SignatureHeader = "X-Epcp-Signature"
+
+// maxPayload bounds the size of the responses a follower reads.
+const maxPayload = 16 << 20
+
+var (
+	// ErrStale is returned when the prices of the leader are too old.
+	ErrStale = e.New("the prices of the peer are stale")
+	// ErrSignature is returned for a response missing the signature or
+	// not signed with any of the keys.
+	ErrSignature = e.New("invalid signature of the prices of the peer")
+)
+
+// Sign returns the value of SignatureHeader of the body signed with key.
+func Sign(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that the signature is that of the body with one of the keys,
+// so that a key can be rotated by accepting the old and the new one for a
+// while.
+func Verify(keys [][]byte, body []byte, signature string) error {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return fmt.Errorf("%w: expected sha256=...", ErrSignature)
+	}
+	for _, key := range keys {
+		if hmac.Equal([]byte(Sign(key, body)), []byte(signature)) {
+			return nil
+		}
+	}
+	return ErrSignature
+}
+
+// Payload is the response of the prices endpoint of the leader.
+type Payload struct {
+	// Fetched is when the leader fetched the prices
+	Fetched time.Time        `json:"fetched"`
+	Points  []ote.PricePoint `json:"points"`
+}
+
+// Handler serves GET ?from=&to=, RFC 3339 times, with the points of the
+// hours of latest starting from from and before to. latest returns nil
+// before the first fetch. maxAge is how long the prices are kept before the
+// leader fetches them again, advertised in Cache-Control. Unless key is
+// empty, the body, the canonical JSON of the Payload, is signed with it in
+// SignatureHeader.
+func Handler(latest func() *Payload, maxAge time.Duration, key []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		from, err := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		to, err := time.Parse(time.RFC3339, r.URL.Query().Get("to"))
+		if err != nil {
+			http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		payload := latest()
+		if payload == nil {
+			http.Error(w, "no prices fetched yet", http.StatusServiceUnavailable)
+			return
+		}
+		res := Payload{Fetched: payload.Fetched, Points: []ote.PricePoint{}}
+		for _, p := range payload.Points {
+			if !p.Start.Before(from) && p.Start.Before(to) {
+				res.Points = append(res.Points, p)
+			}
+		}
+		if len(res.Points) == 0 {
+			http.Error(w, "no prices of the window", http.StatusNotFound)
+			return
+		}
+		body, err := json.Marshal(res)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		age := max(time.Until(payload.Fetched.Add(maxAge)), 0)
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(age.Seconds())))
+		w.Header().Set("Last-Modified", payload.Fetched.UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/json")
+		if len(key) != 0 {
+			w.Header().Set(SignatureHeader, Sign(key, body))
+		}
+		w.Write(body)
+	})
+}
+
+// Source is an ote.PriceSource reading the intraday prices from the leader.
+// The intraday prices the leader cannot serve, because it cannot be reached,
+// has not fetched them or fetched them more than MaxAge ago, and the
+// day-ahead prices and indexes are read from Fallback instead.
+type Source struct {
+	// URL is that of the prices endpoint of the leader
+	URL      string
+	Client   *http.Client
+	MaxAge   time.Duration
+	Fallback ote.PriceSource
+	// Keys, if any, are those the leader may sign the responses with;
+	// unsigned responses are then rejected
+	Keys [][]byte
+	// OnFallback, if set, is called with the error of the leader before
+	// falling back
+	OnFallback func(err error)
+}
+
+var _ ote.PriceSource = (*Source)(nil)
+
+// ImPrices returns the intraday prices of the hours of the day, from the
+// leader or Fallback.
+func (s *Source) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	points, err := s.leaderPrices(ctx, day, fromHour, toHour)
+	if err == nil {
+		return points, nil
+	}
+	if s.OnFallback != nil {
+		s.OnFallback(err)
+	}
+	return s.Fallback.ImPrices(ctx, day, fromHour, toHour)
+}
+
+// DamPrices returns the day-ahead prices from Fallback.
+func (s *Source) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	return s.Fallback.DamPrices(ctx, from, to)
+}
+
+// DamIndex returns the day-ahead indexes from Fallback.
+func (s *Source) DamIndex(ctx context.Context, from, to string) ([]ote.DamIndex, error) {
+	return s.Fallback.DamIndex(ctx, from, to)
+}
+
+// leaderPrices returns the prices of all the hours from the leader.
+func (s *Source) leaderPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	from, err := ote.HourStart(day, fromHour)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ote.HourStart(day, toHour+1)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := s.fetch(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if age := time.Since(payload.Fetched); age > s.MaxAge {
+		return nil, fmt.Errorf("%w: fetched %s ago", ErrStale, age.Round(time.Second))
+	}
+	byStart := make(map[int64]ote.PricePoint, len(payload.Points))
+	for _, p := range payload.Points {
+		byStart[p.Start.Unix()] = p
+	}
+	points := make([]ote.PricePoint, 0, toHour-fromHour+1)
+	for start := from; start.Before(to); start = start.Add(time.Hour) {
+		p, ok := byStart[start.Unix()]
+		if !ok {
+			return nil, fmt.Errorf("the peer has no price of %s", start.Format(time.RFC3339))
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// fetch requests the payload of the window from the leader.
+func (s *Source) fetch(ctx context.Context, from, to time.Time) (*Payload, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("from", from.Format(time.RFC3339))
+	query.Set("to", to.Format(time.RFC3339))
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPayload))
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Keys) != 0 {
+		if err := Verify(s.Keys, body, resp.Header.Get(SignatureHeader)); err != nil {
+			return nil, err
+		}
+	}
+	payload := new(Payload)
+	if err := json.Unmarshal(body, payload); err != nil {
+		return nil, fmt.Errorf("decoding the prices of the peer: %w", err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,172 @@
+package peer_test
+
+import (
+	"context"
+	e "errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/internal/peer"
+)
+
+func TestHandler(t *testing.T) {
+	points := otetest.Points("2024-10-01", 1, 10, 20, 30, 40)
+	var payload *peer.Payload
+	handler := peer.Handler(func() *peer.Payload { return payload }, time.Hour, nil)
+	request := func(method, from, to string) *httptest.ResponseRecorder {
+		query := url.Values{"from": {from}, "to": {to}}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, "/prices?"+query.Encode(), nil))
+		return recorder
+	}
+	from, to := points[1].Start.Format(time.RFC3339), points[3].Start.Format(time.RFC3339)
+
+	if code := request(http.MethodGet, from, to).Code; code != http.StatusServiceUnavailable {
+		t.Errorf("status %d before the first fetch, want 503", code)
+	}
+	payload = &peer.Payload{Fetched: time.Now().Add(-20 * time.Minute), Points: points}
+	res := request(http.MethodGet, from, to)
+	if res.Code != http.StatusOK || res.Body.String() != `{"fetched":"`+payload.Fetched.Format(time.RFC3339Nano)+`","points":[`+
+		`{"date":"2024-10-01","hour":2,"start":"2024-10-01T01:00:00+02:00","price":20,"volume":0},`+
+		`{"date":"2024-10-01","hour":3,"start":"2024-10-01T02:00:00+02:00","price":30,"volume":0}]}` {
+		t.Errorf("status %d: %s", res.Code, res.Body)
+	}
+	// The followers may keep the prices until the leader fetches again
+	if cache := res.Header().Get("Cache-Control"); cache != "max-age=2399" && cache != "max-age=2400" {
+		t.Errorf("Cache-Control %q, want 40 minutes", cache)
+	}
+	if res.Header().Get(peer.SignatureHeader) != "" {
+		t.Error("signed without a key")
+	}
+
+	tests := []struct {
+		method, from, to string
+		want             int
+	}{
+		{http.MethodPost, from, to, http.StatusMethodNotAllowed},
+		{http.MethodGet, "2024-10-01", to, http.StatusBadRequest},
+		{http.MethodGet, from, "", http.StatusBadRequest},
+		{http.MethodGet, "2024-10-02T00:00:00+02:00", "2024-10-02T03:00:00+02:00", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if code := request(test.method, test.from, test.to).Code; code != test.want {
+			t.Errorf("%s from %q to %q: status %d, want %d", test.method, test.from, test.to, code, test.want)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	var payload atomic.Pointer[peer.Payload]
+	served := otetest.Points("2024-10-01", 1, 10, 20, 30)
+	payload.Store(&peer.Payload{Fetched: time.Now(), Points: served})
+	leader := httptest.NewServer(peer.Handler(payload.Load, time.Hour, nil))
+	defer leader.Close()
+	fallback := otetest.NewFake()
+	var fallbacks []error
+	source := &peer.Source{URL: leader.URL + "/prices", MaxAge: time.Hour, Fallback: fallback,
+		OnFallback: func(err error) { fallbacks = append(fallbacks, err) }}
+	ctx := context.Background()
+
+	points, err := source.ImPrices(ctx, "2024-10-01", 2, 3)
+	if err != nil || len(points) != 2 || points[0].Price != 20 || points[1].Price != 30 || len(fallback.Calls()) != 0 {
+		t.Fatalf("points %v, %v, calls %v, want those of the leader", points, err, fallback.Calls())
+	}
+
+	// An hour the leader does not have is fetched directly, with the others
+	fallback.AddImPrices(otetest.Points("2024-10-01", 3, 31, 41), nil)
+	points, err = source.ImPrices(ctx, "2024-10-01", 3, 4)
+	if err != nil || len(points) != 2 || points[0].Price != 31 || len(fallbacks) != 1 {
+		t.Errorf("points %v, %v, want those of the fallback", points, err)
+	}
+
+	// as are the prices of a leader fetched too long ago
+	payload.Store(&peer.Payload{Fetched: time.Now().Add(-2 * time.Hour), Points: served})
+	source.Fallback = otetest.NewFake().AddImPrices(otetest.Points("2024-10-01", 1, 11), nil)
+	if points, err := source.ImPrices(ctx, "2024-10-01", 1, 1); err != nil || points[0].Price != 11 || !e.Is(fallbacks[len(fallbacks)-1], peer.ErrStale) {
+		t.Errorf("points %v, %v, fallback errors %v, want the prices of the leader stale", points, err, fallbacks)
+	}
+
+	// The day-ahead prices always come from the fallback
+	source.Fallback = otetest.NewFake().AddDamPrices(otetest.Points("2024-10-02", 1, 50), nil)
+	if points, err := source.DamPrices(ctx, "2024-10-02", "2024-10-02"); err != nil || len(points) != 1 || points[0].Price != 50 {
+		t.Errorf("day-ahead points %v, %v", points, err)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	key, body := []byte("shared secret"), []byte(`{"points":[]}`)
+	signature := peer.Sign(key, body)
+	// echo -n '{"points":[]}' | openssl dgst -sha256 -hmac 'shared secret'
+	if signature != "sha256=f5e87b52014145c4d8cd8f9f579782132608d845a28cf772f68c1469cc671d3f" {
+		t.Errorf("signature %s", signature)
+	}
+	tests := []struct {
+		name      string
+		keys      [][]byte
+		body      []byte
+		signature string
+		valid     bool
+	}{
+		{"valid", [][]byte{key}, body, signature, true},
+		{"tampered body", [][]byte{key}, []byte(`{"points":[{}]}`), signature, false},
+		{"another key", [][]byte{[]byte("other secret")}, body, signature, false},
+		{"missing", [][]byte{key}, body, "", false},
+		{"other algorithm", [][]byte{key}, body, "sha1=" + signature[len("sha256="):], false},
+		// While the key is rotated, both are accepted
+		{"previous key", [][]byte{[]byte("new secret"), key}, body, signature, true},
+	}
+	for _, test := range tests {
+		err := peer.Verify(test.keys, test.body, test.signature)
+		if (err == nil) != test.valid || err != nil && !e.Is(err, peer.ErrSignature) {
+			t.Errorf("%s: %v, want valid %t", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestSignedSource(t *testing.T) {
+	payload := &peer.Payload{Fetched: time.Now(), Points: otetest.Points("2024-10-01", 1, 10)}
+	oldKey, newKey := []byte("old secret"), []byte("new secret")
+	leader := func(key []byte) string {
+		server := httptest.NewServer(peer.Handler(func() *peer.Payload { return payload }, time.Hour, key))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	tests := []struct {
+		name string
+		// leaderKey signs the prices, none when nil
+		leaderKey []byte
+		keys      [][]byte
+		// want is the error falling back to OTE, nil for the prices of the
+		// leader
+		want error
+	}{
+		{"signed", oldKey, [][]byte{oldKey}, nil},
+		{"unsigned", nil, [][]byte{oldKey}, peer.ErrSignature},
+		{"wrong key", newKey, [][]byte{oldKey}, peer.ErrSignature},
+		// The followers are given the new key first, then the leader
+		{"rotating followers", oldKey, [][]byte{newKey, oldKey}, nil},
+		{"rotated leader", newKey, [][]byte{newKey, oldKey}, nil},
+		{"rotation done", oldKey, [][]byte{newKey}, peer.ErrSignature},
+		// Followers without a key accept the signed prices
+		{"no keys", oldKey, nil, nil},
+	}
+	for _, test := range tests {
+		var fallback error
+		source := &peer.Source{URL: leader(test.leaderKey), MaxAge: time.Hour, Keys: test.keys,
+			Fallback:   otetest.NewFake().AddImPrices(otetest.Points("2024-10-01", 1, 99), nil),
+			OnFallback: func(err error) { fallback = err }}
+		points, err := source.ImPrices(context.Background(), "2024-10-01", 1, 1)
+		if err != nil || len(points) != 1 {
+			t.Errorf("%s: points %v, %v", test.name, points, err)
+			continue
+		}
+		if !e.Is(fallback, test.want) || test.want == nil && (fallback != nil || points[0].Price != 10) {
+			t.Errorf("%s: price %g, fallback on %v, want %v", test.name, points[0].Price, fallback, test.want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Package policy decides the price band, and from it the CPU frequency, for
+// a series of hourly electricity prices.
+package policy
+
+import (
+	"cmp"
+	e "errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// The bands the prices fall in.
+const (
+	Cheap     = "cheap"
+	Expensive = "expensive"
+)
+
+// ErrInsufficientData is returned when there are too few prices to decide.
+var ErrInsufficientData = e.New("at least two prices are needed")
+
+// Round returns the price rounded to the cent, the precision OTE publishes
+// the prices at.
+func Round(price float64) float64 {
+	return math.Round(price*100) / 100
+}
+
+// Compare compares the prices rounded to the cent, returning -1 when a is
+// lower than b, 0 when they are equal and +1 when a is higher. The policies
+// and the thresholds compare the prices with it only, so that the prices
+// differing by less than the rounding of their conversions fall in the same
+// band.
+func Compare(a, b float64) int {
+	return cmp.Compare(Round(a), Round(b))
+}
+
+// Policy decides the band of the latest of the prices, given in time order.
+type Policy interface {
+	Band(prices []float64) (string, error)
+}
+
+// Parameters lists the parameters accepted by each policy.
+var Parameters = map[string][]string{
+	"trend":        {},
+	"threshold":    {"price"},
+	"linear":       {"slope"},
+	"peak_shaving": {"budget"},
+}
+
+// New returns the policy name configured with the parameters.
+func New(name string, parameters map[string]float64) (Policy, error) {
+	accepted, ok := Parameters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown policy %q", name)
+	}
+	for parameter := range parameters {
+		if !slices.Contains(accepted, parameter) {
+			return nil, fmt.Errorf("unknown parameter %q of policy %s", parameter, name)
+		}
+	}
+	switch name {
+	case "peak_shaving":
+		budget, ok := parameters["budget"]
+		if !ok {
+			budget = DefaultBudget
+		}
+		if budget < 0 || budget != math.Trunc(budget) {
+			return nil, fmt.Errorf("parameter budget of policy %s must be a whole number of hours, got %g", name, budget)
+		}
+		return PeakShaving{Budget: int(budget)}, nil
+	case "threshold":
+		price, ok := parameters["price"]
+		if !ok {
+			price = DefaultThreshold
+		}
+		return Threshold{Price: price}, nil
+	case "linear":
+		return Linear{Slope: parameters["slope"]}, nil
+	}
+	return Trend{}, nil
+}
+
+// Trend is expensive when the prices rose more often than they fell.
+type Trend struct{}
+
+func (Trend) Band(prices []float64) (string, error) {
+	if len(prices) < 2 {
+		return "", ErrInsufficientData
+	}
+	// A stupid basic comparator; will need redesign
+	dec, inc := 0, 0
+	for i := 0; i < len(prices)-1; i++ {
+		if Compare(prices[i+1], prices[i]) <= 0 {
+			dec += 1
+		} else {
+			inc += 1
+		}
+	}
+	if dec < inc {
+		return Expensive, nil
+	}
+	return Cheap, nil
+}
+
+// DefaultThreshold is the price of Threshold when not configured.
+const DefaultThreshold = 100
+
+// Threshold is expensive when the latest price is above Price.
+type Threshold struct {
+	Price float64
+}
+
+func (p Threshold) Band(prices []float64) (string, error) {
+	if len(prices) == 0 {
+		return "", ErrInsufficientData
+	}
+	if Compare(prices[len(prices)-1], p.Price) > 0 {
+		return Expensive, nil
+	}
+	return Cheap, nil
+}
+
+// Linear is expensive when the least-squares line through the prices rises
+// by more than Slope an hour, so that unlike Trend a large rise outweighs
+// several small falls.
+type Linear struct {
+	Slope float64
+}
+
+func (p Linear) Band(prices []float64) (string, error) {
+	if len(prices) < 2 {
+		return "", ErrInsufficientData
+	}
+	n := float64(len(prices))
+	meanHour, meanPrice := (n-1)/2, 0.0
+	for _, price := range prices {
+		meanPrice += price / n
+	}
+	var covariance, variance float64
+	for hour, price := range prices {
+		d := float64(hour) - meanHour
+		covariance += d * (price - meanPrice)
+		variance += d * d
+	}
+	if Compare(covariance/variance, p.Slope) > 0 {
+		return Expensive, nil
+	}
+	return Cheap, nil
+}
+
+// Frequency returns the frequency for the band out of the available ones:
+// the lowest when expensive, the highest when cheap. It is 0 without any.
+func Frequency(band string, available []int) int {
+	if len(available) == 0 {
+		return 0
+	}
+	if band == Expensive {
+		return slices.Min(available)
+	}
+	return slices.Max(available)
+}
+
+// Schedule returns the bands of the hours of a day, expensive above the
+// daily mean.
+func Schedule(prices []float64) []string {
+	bands := make([]string, len(prices))
+	var mean float64
+	for _, p := range prices {
+		mean += p / float64(len(prices))
+	}
+	for i, p := range prices {
+		bands[i] = Cheap
+		if Compare(p, mean) > 0 {
+			bands[i] = Expensive
+		}
+	}
+	return bands
+}
+
+// DefaultBudget is the daily budget of PeakShaving when not configured.
+const DefaultBudget = 4
+
+// PeakShaving is a planner policy throttling at most Budget hours a day, the
+// most expensive ones, see Shave. It plans on the prices of the whole day;
+// on the prices of a window alone it decides as Trend.
+type PeakShaving struct {
+	Budget int
+}
+
+func (PeakShaving) Band(prices []float64) (string, error) {
+	return Trend{}.Band(prices)
+}
+
+// Shave reports whether the hour current, an index of the prices of the
+// hours of a day, is to be throttled, given the indexes of the hours of the
+// day throttled already. An hour throttled already stays so; otherwise the
+// budget left goes to the most expensive hours from current on, the earliest
+// of equal prices first, so that the prices known better as the day goes on
+// reshuffle the hours left without exceeding the budget.
+func (p PeakShaving) Shave(prices []float64, current int, throttled []int) bool {
+	if slices.Contains(throttled, current) {
+		return true
+	}
+	left := p.Budget - len(throttled)
+	if left <= 0 || current < 0 || current >= len(prices) {
+		return false
+	}
+	above := 0
+	for hour := current + 1; hour < len(prices); hour++ {
+		if Compare(prices[hour], prices[current]) > 0 && !slices.Contains(throttled, hour) {
+			above++
+		}
+	}
+	return above < left
+}
+
+// Schedule returns the bands of the hours of a day, expensive for the
+// Budget most expensive ones.
+func (p PeakShaving) Schedule(prices []float64) []string {
+	bands := make([]string, len(prices))
+	var throttled []int
+	for hour := range prices {
+		bands[hour] = Cheap
+		if p.Shave(prices, hour, throttled) {
+			bands[hour] = Expensive
+			throttled = append(throttled, hour)
+		}
+	}
+	return bands
+}
@@ -0,0 +1,234 @@
+package policy_test
+
+import (
+	e "errors"
+	"slices"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b float64
+		want int
+	}{
+		{100, 100, 0},
+		{100.10, 100.1, 0},
+		// The conversions from EUR differ below the cent
+		{0.1 + 0.2, 0.3, 0},
+		{2497.124999, 2497.12, 0},
+		{100.004, 100.001, 0},
+		{100.01, 100, 1},
+		{-0.01, 0, -1},
+		{99.995, 100, 0},
+	}
+	for _, test := range tests {
+		if got := policy.Compare(test.a, test.b); got != test.want {
+			t.Errorf("Compare(%v, %v) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestTrend(t *testing.T) {
+	tests := []struct {
+		name   string
+		prices []float64
+		want   string
+	}{
+		{"rising", []float64{80, 90, 100}, policy.Expensive},
+		{"falling", []float64{100, 90, 80}, policy.Cheap},
+		{"flat", []float64{90, 90, 90}, policy.Cheap},
+		{"mixed", []float64{80, 90, 85, 95}, policy.Expensive},
+		{"even", []float64{80, 90, 85}, policy.Cheap},
+		// Rounding noise is not a rise
+		{"noise", []float64{0.3, 0.1 + 0.2, 0.3000001}, policy.Cheap},
+	}
+	for _, test := range tests {
+		got, err := policy.Trend{}.Band(test.prices)
+		if err != nil || got != test.want {
+			t.Errorf("%s %v: got %s, %v, want %s", test.name, test.prices, got, err, test.want)
+		}
+	}
+	for _, prices := range [][]float64{nil, {100}} {
+		if _, err := (policy.Trend{}).Band(prices); !e.Is(err, policy.ErrInsufficientData) {
+			t.Errorf("%v: got error %v, want ErrInsufficientData", prices, err)
+		}
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	tests := []struct {
+		prices []float64
+		want   string
+	}{
+		{[]float64{80, 120}, policy.Expensive},
+		{[]float64{120, 80}, policy.Cheap},
+		{[]float64{150}, policy.Expensive},
+		// At the threshold but for rounding noise
+		{[]float64{100.004}, policy.Cheap},
+	}
+	for _, test := range tests {
+		got, err := policy.Threshold{Price: 100}.Band(test.prices)
+		if err != nil || got != test.want {
+			t.Errorf("%v: got %s, %v, want %s", test.prices, got, err, test.want)
+		}
+	}
+	if _, err := (policy.Threshold{Price: 100}).Band(nil); !e.Is(err, policy.ErrInsufficientData) {
+		t.Errorf("no prices: got error %v, want ErrInsufficientData", err)
+	}
+}
+
+func TestLinear(t *testing.T) {
+	tests := []struct {
+		name   string
+		prices []float64
+		slope  float64
+		want   string
+	}{
+		{"rising", []float64{80, 90, 100}, 0, policy.Expensive},
+		{"falling", []float64{100, 90, 80}, 0, policy.Cheap},
+		{"flat", []float64{90, 90, 90}, 0, policy.Cheap},
+		// One large rise outweighs two small falls, unlike for Trend
+		{"spike", []float64{80, 79, 78, 120}, 0, policy.Expensive},
+		{"two small rises", []float64{100, 101, 102, 60}, 0, policy.Cheap},
+		{"below the slope", []float64{80, 90, 100}, 10, policy.Cheap},
+		{"above the slope", []float64{80, 90, 100}, 9.99, policy.Expensive},
+	}
+	for _, test := range tests {
+		got, err := policy.Linear{Slope: test.slope}.Band(test.prices)
+		if err != nil || got != test.want {
+			t.Errorf("%s %v: got %s, %v, want %s", test.name, test.prices, got, err, test.want)
+		}
+	}
+	if band, _ := (policy.Trend{}).Band([]float64{80, 79, 78, 120}); band != policy.Cheap {
+		t.Errorf("trend of the spike: %s, want %s", band, policy.Cheap)
+	}
+	if _, err := (policy.Linear{}).Band([]float64{100}); !e.Is(err, policy.ErrInsufficientData) {
+		t.Errorf("single price: got error %v, want ErrInsufficientData", err)
+	}
+}
+
+func TestFrequency(t *testing.T) {
+	available := []int{1600000, 800000, 3200000, 2400000}
+	if got := policy.Frequency(policy.Expensive, available); got != 800000 {
+		t.Errorf("expensive: %d, want 800000", got)
+	}
+	if got := policy.Frequency(policy.Cheap, available); got != 3200000 {
+		t.Errorf("cheap: %d, want 3200000", got)
+	}
+	if got := policy.Frequency(policy.Expensive, nil); got != 0 {
+		t.Errorf("without frequencies: %d, want 0", got)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	prices := []float64{50, 100, 75, 75.004, 120}
+	want := []string{policy.Cheap, policy.Expensive, policy.Cheap, policy.Cheap, policy.Expensive}
+	if got := policy.Schedule(prices); !slices.Equal(got, want) {
+		t.Errorf("Schedule(%v) = %v, want %v", prices, got, want)
+	}
+	// A flat day is not expensive, however the mean is rounded
+	flat := make([]float64, 24)
+	for hour := range flat {
+		flat[hour] = 0.1 + 0.2
+	}
+	for hour, band := range policy.Schedule(flat) {
+		if band != policy.Cheap {
+			t.Errorf("flat day hour %d: %s, want %s", hour+1, band, policy.Cheap)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters map[string]float64
+		want       policy.Policy
+		fails      bool
+	}{
+		{name: "trend", want: policy.Trend{}},
+		{name: "peak_shaving", want: policy.PeakShaving{Budget: policy.DefaultBudget}},
+		{name: "peak_shaving", parameters: map[string]float64{"budget": 6}, want: policy.PeakShaving{Budget: 6}},
+		{name: "peak_shaving", parameters: map[string]float64{"budget": 0}, want: policy.PeakShaving{}},
+		{name: "peak_shaving", parameters: map[string]float64{"budget": 2.5}, fails: true},
+		{name: "peak_shaving", parameters: map[string]float64{"budget": -1}, fails: true},
+		{name: "threshold", want: policy.Threshold{Price: policy.DefaultThreshold}},
+		{name: "threshold", parameters: map[string]float64{"price": 150}, want: policy.Threshold{Price: 150}},
+		{name: "linear", want: policy.Linear{}},
+		{name: "linear", parameters: map[string]float64{"slope": 2.5}, want: policy.Linear{Slope: 2.5}},
+		{name: "linear", parameters: map[string]float64{"price": 150}, fails: true},
+		{name: "trend", parameters: map[string]float64{"budget": 4}, fails: true},
+		{name: "percentile", fails: true},
+	}
+	for _, test := range tests {
+		got, err := policy.New(test.name, test.parameters)
+		if (err != nil) != test.fails || got != test.want {
+			t.Errorf("New(%s, %v) = %v, %v, want %v", test.name, test.parameters, got, err, test.want)
+		}
+	}
+}
+
+func TestPeakShavingSchedule(t *testing.T) {
+	prices := []float64{50, 120, 80, 120, 200, 60, 150, 90}
+	tests := []struct {
+		budget int
+		want   []int
+	}{
+		{0, nil},
+		{1, []int{4}},
+		{3, []int{4, 6, 1}},
+		// Of equal prices, the earliest is throttled first
+		{4, []int{4, 6, 1, 3}},
+		{len(prices) + 2, []int{0, 1, 2, 3, 4, 5, 6, 7}},
+	}
+	for _, test := range tests {
+		bands := policy.PeakShaving{Budget: test.budget}.Schedule(prices)
+		var throttled []int
+		for hour, band := range bands {
+			if band == policy.Expensive {
+				throttled = append(throttled, hour)
+			}
+		}
+		want := slices.Clone(test.want)
+		slices.Sort(want)
+		if !slices.Equal(throttled, want) {
+			t.Errorf("budget %d: throttled hours %v, want %v", test.budget, throttled, want)
+		}
+	}
+}
+
+func TestPeakShavingShave(t *testing.T) {
+	p := policy.PeakShaving{Budget: 2}
+	// The budget is exhausted: only the hours throttled already stay so
+	prices := []float64{100, 200, 300, 400}
+	if p.Shave(prices, 3, []int{0, 1}) {
+		t.Error("the most expensive hour throttled over the exhausted budget")
+	}
+	if !p.Shave(prices, 1, []int{0, 1}) {
+		t.Error("an hour throttled already is not throttled")
+	}
+
+	// The hours are reshuffled as the prices of the hours left change
+	throttled := []int{}
+	day := []float64{300, 100, 250, 200}
+	if !p.Shave(day, 0, throttled) {
+		t.Fatal("hour 0, the most expensive of the day, not throttled")
+	}
+	throttled = append(throttled, 0)
+	day[1], day[3] = 400, 150
+	if !p.Shave(day, 1, throttled) {
+		t.Error("hour 1, repriced the most expensive of those left, not throttled")
+	}
+	throttled = append(throttled, 1)
+	if p.Shave(day, 2, throttled) {
+		t.Error("hour 2 throttled over the budget")
+	}
+
+	// Hours out of the day are never throttled
+	for _, hour := range []int{-1, len(prices)} {
+		if p.Shave(prices, hour, nil) {
+			t.Errorf("hour %d out of the day throttled", hour)
+		}
+	}
+}
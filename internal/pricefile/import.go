@@ -0,0 +1,253 @@
+package pricefile
+
+import (
+	"encoding/csv"
+	e "errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// The formats of the files Import reads.
+const (
+	// FormatOTE is a yearly report of OTE saved as CSV: semicolon separated
+	// rows of the day (D.M.YYYY or YYYY-MM-DD), the trading hour, the price
+	// and optionally the volume, with decimal commas. The title and header
+	// rows before the first day are skipped.
+	FormatOTE = "ote-csv"
+	// FormatGeneric is a CSV file with a header naming the columns of the
+	// time of the start of the hour, the price and optionally the volume.
+	FormatGeneric = "generic"
+	// FormatOTEXML is a GetDamPriceE response of the OTE service saved as
+	// XML, e.g. a bulk download of months of prices. It is decoded as it is
+	// read, see ote.DecodeDamPrices.
+	FormatOTEXML = "ote-xml"
+)
+
+// ImportOptions describe the file read by Import.
+type ImportOptions struct {
+	Format string
+	// TimeColumn, PriceColumn and VolumeColumn name the columns of the
+	// generic format, time, price and volume when empty
+	TimeColumn, PriceColumn, VolumeColumn string
+	// TimeLayout parses the times of the generic format, time.RFC3339 when
+	// empty
+	TimeLayout string
+	// Location is that of the times without an offset in the generic format,
+	// the market timezone when nil
+	Location *time.Location
+	// Comma separates the fields, ';' for the OTE format and ',' for the
+	// generic one when 0
+	Comma rune
+}
+
+// RowError is a malformed row of an imported file.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (r *RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", r.Line, r.Err.Error())
+}
+
+func (r *RowError) Unwrap() error {
+	return r.Err
+}
+
+// Import reads the prices of a file in one of the formats, in the order of
+// the rows. The malformed rows are skipped and returned as RowErrors; only
+// a file that cannot be read at all is an error. An XML response has no
+// rows, so any malformed part of it fails the import.
+func Import(r io.Reader, opts ImportOptions) ([]ote.PricePoint, []*RowError, error) {
+	if opts.Format == FormatOTEXML {
+		var points []ote.PricePoint
+		err := ote.DecodeDamPrices(r, func(p ote.PricePoint) error {
+			points = append(points, p)
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return points, nil, nil
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+	reader.Comma = opts.Comma
+	var parse func(row []string) (ote.PricePoint, error)
+	switch opts.Format {
+	case FormatOTE:
+		if reader.Comma == 0 {
+			reader.Comma = ';'
+		}
+		parse = parseOTERow
+	case FormatGeneric:
+		if reader.Comma == 0 {
+			reader.Comma = ','
+		}
+		header, err := reader.Read()
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading the header: %w", err)
+		}
+		if parse, err = genericParser(slices.Clone(header), opts); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown format %q, expected %s, %s or %s", opts.Format, FormatOTE, FormatOTEXML, FormatGeneric)
+	}
+	var points []ote.PricePoint
+	var rowErrs []*RowError
+	started := opts.Format == FormatGeneric
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return points, rowErrs, nil
+		}
+		var parseErr *csv.ParseError
+		if e.As(err, &parseErr) {
+			// Report the row, not the line the quoted field ran on to
+			rowErrs = append(rowErrs, &RowError{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if blank(row) {
+			continue
+		}
+		if !started {
+			// Skip the title and header rows of the report
+			if _, err := parseDay(row[0]); err != nil {
+				continue
+			}
+			started = true
+		}
+		p, err := parse(row)
+		if err != nil {
+			rowErrs = append(rowErrs, &RowError{Line: line, Err: err})
+			continue
+		}
+		points = append(points, p)
+	}
+}
+
+// blank reports whether the row has no values.
+func blank(row []string) bool {
+	for _, field := range row {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseOTERow parses a row of the OTE format.
+func parseOTERow(row []string) (ote.PricePoint, error) {
+	var p ote.PricePoint
+	if len(row) < 3 {
+		return p, fmt.Errorf("expected at least 3 columns, got %d", len(row))
+	}
+	var err error
+	if p.Date, err = parseDay(row[0]); err != nil {
+		return p, err
+	}
+	hours, err := ote.HoursIn(p.Date)
+	if err != nil {
+		return p, err
+	}
+	if p.Hour, err = strconv.Atoi(strings.TrimSpace(row[1])); err != nil || p.Hour < 1 || p.Hour > hours {
+		return p, fmt.Errorf("invalid hour %q, %s has hours 1 to %d", row[1], p.Date, hours)
+	}
+	if p.Start, err = ote.HourStart(p.Date, p.Hour); err != nil {
+		return p, err
+	}
+	if p.Price, err = parseNumber("price", row[2]); err != nil {
+		return p, err
+	}
+	if len(row) > 3 && strings.TrimSpace(row[3]) != "" {
+		if p.Volume, err = parseNumber("volume", row[3]); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// parseDay parses the day of a row of the OTE format to time.DateOnly.
+func parseDay(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.DateOnly, "2.1.2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format(time.DateOnly), nil
+		}
+	}
+	return "", fmt.Errorf("invalid day %q, expected D.M.YYYY or YYYY-MM-DD", value)
+}
+
+// genericParser returns the parser of the rows of the generic format with
+// the header.
+func genericParser(header []string, opts ImportOptions) (func(row []string) (ote.PricePoint, error), error) {
+	name := func(name, fallback string) string {
+		if name == "" {
+			return fallback
+		}
+		return name
+	}
+	timeName, priceName := name(opts.TimeColumn, "time"), name(opts.PriceColumn, "price")
+	volumeName := name(opts.VolumeColumn, "volume")
+	timeColumn, priceColumn := slices.Index(header, timeName), slices.Index(header, priceName)
+	volumeColumn := slices.Index(header, volumeName)
+	if timeColumn < 0 || priceColumn < 0 {
+		return nil, fmt.Errorf("the header %q must name the time column %q and the price column %q", strings.Join(header, string(opts.Comma)), timeName, priceName)
+	}
+	if opts.VolumeColumn != "" && volumeColumn < 0 {
+		return nil, fmt.Errorf("the header has no volume column %q", volumeName)
+	}
+	layout := name(opts.TimeLayout, time.RFC3339)
+	location := opts.Location
+	if location == nil {
+		location = ote.Location()
+	}
+	return func(row []string) (ote.PricePoint, error) {
+		var p ote.PricePoint
+		if len(row) != len(header) {
+			return p, fmt.Errorf("expected %d columns, got %d", len(header), len(row))
+		}
+		start, err := time.ParseInLocation(layout, strings.TrimSpace(row[timeColumn]), location)
+		if err != nil {
+			return p, fmt.Errorf("invalid time %q, expected the layout %s", row[timeColumn], layout)
+		}
+		if start.Truncate(time.Hour) != start {
+			return p, fmt.Errorf("%s is not the start of an hour", start.Format(time.RFC3339))
+		}
+		p.Date, p.Hour = ote.HourIndex(start)
+		p.Start = start
+		if p.Price, err = parseNumber("price", row[priceColumn]); err != nil {
+			return p, err
+		}
+		if volumeColumn >= 0 && strings.TrimSpace(row[volumeColumn]) != "" {
+			if p.Volume, err = parseNumber("volume", row[volumeColumn]); err != nil {
+				return p, err
+			}
+		}
+		return p, nil
+	}, nil
+}
+
+// parseNumber parses a number with a decimal point or comma, ignoring spaces
+// separating the thousands.
+func parseNumber(what, value string) (float64, error) {
+	clean := strings.NewReplacer(" ", "", " ", "", ",", ".").Replace(value)
+	n, err := strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", what, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,177 @@
+package pricefile_test
+
+import (
+	"bytes"
+	e "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/internal/pricefile"
+)
+
+func TestImportOTE(t *testing.T) {
+	report := `Výsledky denního trhu ČR;;;
+Den;Hodina;Cena (EUR/MWh);Množství (MWh)
+
+26.10.2024;24;95,10;5 432,1
+27.10.2024;1;"80,5";4 100
+2024-10-27;25;-1,25;
+`
+	points, rowErrs, err := pricefile.Import(strings.NewReader(report), pricefile.ImportOptions{Format: pricefile.FormatOTE})
+	if err != nil || len(rowErrs) != 0 {
+		t.Fatalf("errors %v, %v", err, rowErrs)
+	}
+	want := []ote.PricePoint{
+		{Date: "2024-10-26", Hour: 24, Price: 95.1, Volume: 5432.1},
+		{Date: "2024-10-27", Hour: 1, Price: 80.5, Volume: 4100},
+		// The 25th hour of the day the summer time ends
+		{Date: "2024-10-27", Hour: 25, Price: -1.25},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("points %v, want %v", points, want)
+	}
+	for i, p := range points {
+		w := want[i]
+		w.Start, _ = ote.HourStart(w.Date, w.Hour)
+		if p != w {
+			t.Errorf("point %d: %+v, want %+v", i, p, w)
+		}
+	}
+	if want := time.Date(2024, time.October, 27, 23, 0, 0, 0, ote.Location()); !points[2].Start.Equal(want) {
+		t.Errorf("the 25th hour starts at %s, want %s", points[2].Start, want)
+	}
+}
+
+func TestImportOTEXML(t *testing.T) {
+	want := otetest.Points("2024-03-04", 1, 80.5, -1.25, 95.1)
+	response := otetest.DamPriceResponse(want)
+	points, rowErrs, err := pricefile.Import(bytes.NewReader(response), pricefile.ImportOptions{Format: pricefile.FormatOTEXML})
+	if err != nil || len(rowErrs) != 0 {
+		t.Fatalf("errors %v, %v", err, rowErrs)
+	}
+	if len(points) != len(want) {
+		t.Fatalf("points %v, want %v", points, want)
+	}
+	for i, p := range points {
+		if !p.Start.Equal(want[i].Start) || p.Date != want[i].Date || p.Hour != want[i].Hour || p.Price != want[i].Price {
+			t.Errorf("point %d: %+v, want %+v", i, p, want[i])
+		}
+	}
+	// A truncated response fails the import as a whole
+	if _, _, err := pricefile.Import(bytes.NewReader(response[:len(response)/2]), pricefile.ImportOptions{Format: pricefile.FormatOTEXML}); !e.Is(err, ote.ErrDecode) {
+		t.Errorf("truncated response: error %v, want %v", err, ote.ErrDecode)
+	}
+}
+
+func TestImportGeneric(t *testing.T) {
+	file := `when;eur;mwh;note
+2024-12-31 23:00;61,5;120;last of the year
+2025-01-01 00:00;58;;
+`
+	points, rowErrs, err := pricefile.Import(strings.NewReader(file), pricefile.ImportOptions{
+		Format: pricefile.FormatGeneric, TimeColumn: "when", PriceColumn: "eur", VolumeColumn: "mwh",
+		TimeLayout: "2006-01-02 15:04", Location: time.UTC, Comma: ';',
+	})
+	if err != nil || len(rowErrs) != 0 {
+		t.Fatalf("errors %v, %v", err, rowErrs)
+	}
+	// The times are in UTC, the hours those of the market
+	want := []ote.PricePoint{
+		{Date: "2025-01-01", Hour: 1, Start: time.Date(2024, time.December, 31, 23, 0, 0, 0, time.UTC), Price: 61.5, Volume: 120},
+		{Date: "2025-01-01", Hour: 2, Start: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), Price: 58},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("points %v, want %v", points, want)
+	}
+	for i, p := range points {
+		if p.Date != want[i].Date || p.Hour != want[i].Hour || !p.Start.Equal(want[i].Start) || p.Price != want[i].Price || p.Volume != want[i].Volume {
+			t.Errorf("point %d: %+v, want %+v", i, p, want[i])
+		}
+	}
+
+	// By default the columns are time, price and volume, the times RFC 3339
+	// and those without an offset in the market timezone
+	points, _, err = pricefile.Import(strings.NewReader("price,time\n10,2024-03-31T03:00:00+02:00\n"), pricefile.ImportOptions{Format: pricefile.FormatGeneric})
+	if err != nil || len(points) != 1 || points[0].Date != "2024-03-31" || points[0].Hour != 3 {
+		t.Errorf("points %v, %v, want the third hour of 2024-03-31", points, err)
+	}
+	points, _, err = pricefile.Import(strings.NewReader("time,price\n2024-03-04 00:00,10\n"), pricefile.ImportOptions{Format: pricefile.FormatGeneric, TimeLayout: "2006-01-02 15:04"})
+	if err != nil || len(points) != 1 || points[0].Date != "2024-03-04" || points[0].Hour != 1 {
+		t.Errorf("points %v, %v, want the first hour of 2024-03-04", points, err)
+	}
+}
+
+func TestImportRowErrors(t *testing.T) {
+	tests := []struct {
+		name, file string
+		opts       pricefile.ImportOptions
+		// points is the number of rows imported
+		points int
+		want   []string
+	}{
+		{"ote", `Den;Hodina;Cena
+4.3.2024;1;50
+4.3.2024;25;50
+31.3.2024;24;50
+4.3.2024;2
+4.3.2024;3;padesát
+4.3.2024;4;50;many
+4.3.2024;5;50
+`, pricefile.ImportOptions{Format: pricefile.FormatOTE}, 2, []string{
+			`line 3: invalid hour "25", 2024-03-04 has hours 1 to 24`,
+			`line 4: invalid hour "24", 2024-03-31 has hours 1 to 23`,
+			"line 5: expected at least 3 columns, got 2",
+			`line 6: invalid price "padesát"`,
+			`line 7: invalid volume "many"`,
+		}},
+		{"generic", `time,price
+2024-03-04T00:00:00+01:00,50
+2024-03-04T00:30:00+01:00,50
+yesterday,50
+2024-03-04T02:00:00+01:00
+2024-03-04T03:00:00+01:00,"50
+2024-03-04T04:00:00+01:00,50
+`, pricefile.ImportOptions{Format: pricefile.FormatGeneric}, 1, []string{
+			"line 3: 2024-03-04T00:30:00+01:00 is not the start of an hour",
+			`line 4: invalid time "yesterday", expected the layout ` + time.RFC3339,
+			"line 5: expected 2 columns, got 1",
+			"line 6: extraneous or missing \" in quoted-field",
+		}},
+	}
+	for _, test := range tests {
+		points, rowErrs, err := pricefile.Import(strings.NewReader(test.file), test.opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(points) != test.points {
+			t.Errorf("%s: %d points, want %d", test.name, len(points), test.points)
+		}
+		var got []string
+		for _, rowErr := range rowErrs {
+			got = append(got, rowErr.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: errors\n%s\nwant\n%s", test.name, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+
+	// Only a file that cannot be read at all fails the import
+	for _, test := range []struct {
+		file string
+		opts pricefile.ImportOptions
+		want string
+	}{
+		{"", pricefile.ImportOptions{Format: "xls"}, `unknown format "xls"`},
+		{"", pricefile.ImportOptions{Format: pricefile.FormatGeneric}, "reading the header"},
+		{"start,price\n", pricefile.ImportOptions{Format: pricefile.FormatGeneric}, `must name the time column "time"`},
+		{"time,price\n", pricefile.ImportOptions{Format: pricefile.FormatGeneric, VolumeColumn: "mwh"}, `no volume column "mwh"`},
+	} {
+		if _, _, err := pricefile.Import(strings.NewReader(test.file), test.opts); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%+v: error %v, want %q", test.opts, err, test.want)
+		}
+	}
+}
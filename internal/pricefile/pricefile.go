@@ -0,0 +1,190 @@
+// Package pricefile serves prices from a CSV or JSON file instead of the OTE
+// service, for running the simulator offline.
+//
+// A CSV file has a header with the columns time, price and optionally
+// volume; a JSON file is an array of objects with the same keys. The times
+// are RFC 3339 timestamps of the starts of the trading hours, e.g.
+//
+//	time,price,volume
+//	2024-03-04T00:00:00+01:00,61.5,120.4
+package pricefile
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// ErrGap is returned when the file has prices for only some of the hours
+// requested. When it has none, ote.ErrNoData is returned instead.
+var ErrGap = e.New("gap in the prices")
+
+// record is a price of the file.
+type record struct {
+	Time   time.Time `json:"time"`
+	Price  float64   `json:"price"`
+	Volume float64   `json:"volume"`
+}
+
+// Source is an ote.PriceSource serving the prices of a file, both as the
+// intraday and the day-ahead prices. It has no day-ahead indexes.
+type Source struct {
+	path   string
+	prices map[int64]record
+}
+
+var _ ote.PriceSource = (*Source)(nil)
+
+// Load reads the prices of the file at path, in CSV or JSON depending on the
+// extension.
+func Load(path string) (*Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []record
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		records, err = readCSV(f)
+	case ".json":
+		err = json.NewDecoder(f).Decode(&records)
+	default:
+		return nil, fmt.Errorf("%s: unknown price file format, use .csv or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s := &Source{path: path, prices: make(map[int64]record, len(records))}
+	for _, r := range records {
+		if r.Time.IsZero() || r.Time.Truncate(time.Hour) != r.Time {
+			return nil, fmt.Errorf("%s: %s is not the start of an hour", path, r.Time.Format(time.RFC3339))
+		}
+		if _, ok := s.prices[r.Time.Unix()]; ok {
+			return nil, fmt.Errorf("%s: duplicate price for %s", path, r.Time.Format(time.RFC3339))
+		}
+		s.prices[r.Time.Unix()] = r
+	}
+	return s, nil
+}
+
+// readCSV reads the records of a CSV file with a header.
+func readCSV(r io.Reader) ([]record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	column := func(name string) int {
+		return slices.Index(header, name)
+	}
+	timeColumn, priceColumn, volumeColumn := column("time"), column("price"), column("volume")
+	if timeColumn < 0 || priceColumn < 0 {
+		return nil, e.New("the header must name the time and price columns")
+	}
+	var records []record
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(row) != len(header) {
+			return nil, fmt.Errorf("line %d: expected %d columns", line, len(header))
+		}
+		var rec record
+		if rec.Time, err = time.Parse(time.RFC3339, row[timeColumn]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		price, err := strconv.ParseFloat(row[priceColumn], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid price %q", line, row[priceColumn])
+		}
+		rec.Price = price
+		if volumeColumn >= 0 && row[volumeColumn] != "" {
+			volume, err := strconv.ParseFloat(row[volumeColumn], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid volume %q", line, row[volumeColumn])
+			}
+			rec.Volume = volume
+		}
+		records = append(records, rec)
+	}
+}
+
+// hours returns the prices of the trading hours of the day, inclusive.
+func (s *Source) hours(day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	var points []ote.PricePoint
+	var missing []string
+	for hour := fromHour; hour <= toHour; hour++ {
+		start, err := ote.HourStart(day, hour)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := s.prices[start.Unix()]
+		if !ok {
+			missing = append(missing, start.Format(time.RFC3339))
+			continue
+		}
+		points = append(points, ote.PricePoint{Date: day, Hour: hour, Start: start, Price: r.Price, Volume: r.Volume})
+	}
+	switch {
+	case len(points) == 0:
+		return nil, fmt.Errorf("%s: %s hours %d to %d: %w", s.path, day, fromHour, toHour, ote.ErrNoData)
+	case len(missing) != 0:
+		return nil, fmt.Errorf("%s: %w: %d of the hours missing, the first at %s", s.path, ErrGap, len(missing), missing[0])
+	}
+	return points, nil
+}
+
+func (s *Source) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	return s.hours(day, fromHour, toHour)
+}
+
+func (s *Source) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	var points []ote.PricePoint
+	err := ote.EachDay(from, to, func(day string, hours int) error {
+		dayPoints, err := s.hours(day, 1, hours)
+		points = append(points, dayPoints...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+func (s *Source) DamIndex(ctx context.Context, from, to string) ([]ote.DamIndex, error) {
+	return nil, fmt.Errorf("%s: day-ahead indexes: %w", s.path, ote.ErrNoData)
+}
+
+// WriteCSV writes the points in the CSV format read by Load.
+func WriteCSV(w io.Writer, points []ote.PricePoint) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"time", "price", "volume"})
+	for _, p := range points {
+		writer.Write([]string{
+			p.Start.Format(time.RFC3339),
+			strconv.FormatFloat(p.Price, 'f', -1, 64),
+			strconv.FormatFloat(p.Volume, 'f', -1, 64),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
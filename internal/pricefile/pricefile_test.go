@@ -0,0 +1,162 @@
+package pricefile_test
+
+import (
+	"bytes"
+	"context"
+	e "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/pricefile"
+)
+
+// writeFile writes content to the file name in a temporary directory and
+// returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name, content string
+	}{
+		{"prices.csv", `time,price,volume
+2024-03-04T00:00:00+01:00,61.5,120.4
+2024-03-04T01:00:00+01:00,58,
+2024-03-04T02:00:00+01:00,-3.25,80
+`},
+		{"columns.csv", `volume, price, time
+120.4, 61.5, 2024-03-04T00:00:00+01:00
+0, 58, 2024-03-04T00:00:00Z
+80, -3.25, 2024-03-04T02:00:00+01:00
+`},
+		{"prices.json", `[
+{"time": "2024-03-04T00:00:00+01:00", "price": 61.5, "volume": 120.4},
+{"time": "2024-03-04T01:00:00+01:00", "price": 58},
+{"time": "2024-03-04T02:00:00+01:00", "price": -3.25, "volume": 80}
+]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source, err := pricefile.Load(writeFile(t, test.name, test.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			points, err := source.ImPrices(context.Background(), "2024-03-04", 1, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []struct {
+				hour          int
+				price, volume float64
+			}{{1, 61.5, 120.4}, {2, 58, 0}, {3, -3.25, 80}}
+			if len(points) != len(want) {
+				t.Fatalf("got %d points, want %d", len(points), len(want))
+			}
+			for i, p := range points {
+				if p.Hour != want[i].hour || p.Price != want[i].price || p.Volume != want[i].volume {
+					t.Errorf("point %d: hour %d, price %g, volume %g, want %+v", i, p.Hour, p.Price, p.Volume, want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"prices.txt", "", "unknown price file format"},
+		{"header.csv", "start,price\n2024-03-04T00:00:00+01:00,61.5\n", "time and price columns"},
+		{"columns.csv", "time,price\n2024-03-04T00:00:00+01:00,61.5,1\n", "line 2: expected 2 columns"},
+		{"time.csv", "time,price\n2024-03-04 00:00,61.5\n", "line 2"},
+		{"price.csv", "time,price\n2024-03-04T00:00:00+01:00,n/a\n", `line 2: invalid price "n/a"`},
+		{"volume.csv", "time,price,volume\n2024-03-04T00:00:00+01:00,1,many\n", `line 2: invalid volume "many"`},
+		{"hour.csv", "time,price\n2024-03-04T00:15:00+01:00,61.5\n", "is not the start of an hour"},
+		{"duplicate.csv", "time,price\n2024-03-04T00:00:00+01:00,61.5\n2024-03-03T23:00:00Z,60\n", "duplicate price"},
+		{"prices.json", `{"time": "2024-03-04T00:00:00+01:00"}`, "prices.json"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := pricefile.Load(writeFile(t, test.name, test.content))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+	if _, err := pricefile.Load(filepath.Join(t.TempDir(), "missing.csv")); !e.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: got error %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestGaps(t *testing.T) {
+	source, err := pricefile.Load(writeFile(t, "prices.csv", `time,price
+2024-03-04T00:00:00+01:00,1
+2024-03-04T02:00:00+01:00,3
+2024-03-04T03:00:00+01:00,4
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tests := []struct {
+		day              string
+		fromHour, toHour int
+		want             error
+	}{
+		{"2024-03-04", 3, 4, nil},
+		{"2024-03-04", 1, 3, pricefile.ErrGap},
+		{"2024-03-04", 5, 6, ote.ErrNoData},
+		{"2024-03-05", 1, 24, ote.ErrNoData},
+	}
+	for _, test := range tests {
+		_, err := source.ImPrices(ctx, test.day, test.fromHour, test.toHour)
+		if !e.Is(err, test.want) {
+			t.Errorf("%s hours %d to %d: got error %v, want %v", test.day, test.fromHour, test.toHour, err, test.want)
+		}
+	}
+	if _, err := source.DamPrices(ctx, "2024-03-04", "2024-03-04"); !e.Is(err, pricefile.ErrGap) {
+		t.Errorf("day-ahead prices: got error %v, want %v", err, pricefile.ErrGap)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	// The day of the switch to winter time has 25 trading hours
+	from := time.Date(2024, time.October, 27, 0, 0, 0, 0, ote.Location())
+	var points []ote.PricePoint
+	for i := 0; i < 25; i++ {
+		start := from.Add(time.Duration(i) * time.Hour)
+		day, hour := ote.HourIndex(start)
+		points = append(points, ote.PricePoint{Date: day, Hour: hour, Start: start, Price: float64(i) + 0.5, Volume: 10})
+	}
+	var buf bytes.Buffer
+	if err := pricefile.WriteCSV(&buf, points); err != nil {
+		t.Fatal(err)
+	}
+	source, err := pricefile.Load(writeFile(t, "prices.csv", buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := source.DamPrices(context.Background(), "2024-10-27", "2024-10-27")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(points) {
+		t.Fatalf("read %d points, want %d", len(read), len(points))
+	}
+	for i, p := range read {
+		if p.Hour != points[i].Hour || !p.Start.Equal(points[i].Start) || p.Price != points[i].Price {
+			t.Errorf("point %d: hour %d at %s, price %g, want hour %d at %s, price %g", i,
+				p.Hour, p.Start, p.Price, points[i].Hour, points[i].Start, points[i].Price)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package profile serves the prices of a typical day, for running without
+// any price source, e.g. on edge nodes offline for days.
+//
+// A profile is a CSV file with the columns hour and price: the price in
+// EUR/MWh of each hour of the clock, 0 to 23, in the market timezone. The
+// embedded default has cheap nights and midday and expensive mornings and
+// evenings.
+package profile
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+//go:embed default.csv
+var defaultCSV []byte
+
+// Source is an ote.PriceSource serving the profile as the intraday and the
+// day-ahead prices of every day, marked with ote.SourceProfile. It has no
+// day-ahead indexes.
+type Source struct {
+	prices [24]float64
+}
+
+var _ ote.PriceSource = (*Source)(nil)
+
+// Default returns the source of the embedded profile.
+func Default() *Source {
+	s, err := parse(bytes.NewReader(defaultCSV))
+	if err != nil {
+		panic("embedded profile: " + err.Error())
+	}
+	return s
+}
+
+// Load reads the profile of the CSV file at path.
+func Load(path string) (*Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// parse reads a profile, which must price each hour of the clock once.
+func parse(r io.Reader) (*Source, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) < 2 || strings.TrimSpace(rows[0][0]) != "hour" || strings.TrimSpace(rows[0][1]) != "price" {
+		return nil, fmt.Errorf("expected the header hour,price")
+	}
+	s := new(Source)
+	var seen [24]bool
+	for i, row := range rows[1:] {
+		line := i + 2
+		if len(row) < 2 {
+			return nil, fmt.Errorf("line %d: expected hour and price", line)
+		}
+		hour, err := strconv.Atoi(strings.TrimSpace(row[0]))
+		if err != nil || hour < 0 || hour > 23 {
+			return nil, fmt.Errorf("line %d: invalid hour %q, expected 0 to 23", line, row[0])
+		}
+		if seen[hour] {
+			return nil, fmt.Errorf("line %d: hour %d priced twice", line, hour)
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid price %q", line, row[1])
+		}
+		s.prices[hour], seen[hour] = price, true
+	}
+	for hour, ok := range seen {
+		if !ok {
+			return nil, fmt.Errorf("no price of hour %d", hour)
+		}
+	}
+	return s, nil
+}
+
+// hours returns the prices of the trading hours of the day, inclusive, by
+// the hour of the clock they start at; on the day the clocks go back, both
+// hours starting at 2:00 get its price.
+func (s *Source) hours(day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	loc := ote.Location()
+	var points []ote.PricePoint
+	for hour := fromHour; hour <= toHour; hour++ {
+		start, err := ote.HourStart(day, hour)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, ote.PricePoint{Date: day, Hour: hour, Start: start,
+			Price: s.prices[start.In(loc).Hour()], Source: ote.SourceProfile})
+	}
+	return points, nil
+}
+
+func (s *Source) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	return s.hours(day, fromHour, toHour)
+}
+
+func (s *Source) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	var points []ote.PricePoint
+	err := ote.EachDay(from, to, func(day string, hours int) error {
+		dayPoints, err := s.hours(day, 1, hours)
+		points = append(points, dayPoints...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+func (s *Source) DamIndex(ctx context.Context, from, to string) ([]ote.DamIndex, error) {
+	return nil, fmt.Errorf("profile day-ahead indexes: %w", ote.ErrNoData)
+}
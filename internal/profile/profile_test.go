@@ -0,0 +1,121 @@
+package profile_test
+
+import (
+	"context"
+	e "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/profile"
+)
+
+func TestDefault(t *testing.T) {
+	points, err := profile.Default().DamPrices(context.Background(), "2024-10-01", "2024-10-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 48 {
+		t.Fatalf("%d points of two days, want 48", len(points))
+	}
+	for i, p := range points {
+		if p.Source != ote.SourceProfile || p.Start.In(ote.Location()).Hour() != i%24 || p.Price != points[i%24].Price {
+			t.Errorf("point %d %+v, want the price of hour %d of the profile", i, p, i%24)
+		}
+	}
+	// Cheap at night, expensive in the evening
+	if night, evening := points[3].Price, points[18].Price; night != 66 || evening != 152 {
+		t.Errorf("prices %g at 3:00 and %g at 18:00, want 66 and 152", night, evening)
+	}
+	if _, err := profile.Default().DamIndex(context.Background(), "2024-10-01", "2024-10-01"); !e.Is(err, ote.ErrNoData) {
+		t.Errorf("day-ahead indexes error %v, want ErrNoData", err)
+	}
+}
+
+func TestDST(t *testing.T) {
+	tests := []struct {
+		day string
+		// prices are those of the trading hours 1 to 5
+		prices []float64
+		hours  int
+	}{
+		// The clocks skip 2:00, the third hour starts at 3:00
+		{"2024-03-31", []float64{78, 72, 66, 67, 74}, 23},
+		// Both hours starting at 2:00 get its price
+		{"2024-10-27", []float64{78, 72, 68, 68, 66}, 25},
+	}
+	for _, test := range tests {
+		points, err := profile.Default().DamPrices(context.Background(), test.day, test.day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != test.hours {
+			t.Errorf("%s: %d points, want %d", test.day, len(points), test.hours)
+			continue
+		}
+		for i, want := range test.prices {
+			if points[i].Hour != i+1 || points[i].Price != want {
+				t.Errorf("%s: point %d %+v, want %g", test.day, i, points[i], want)
+			}
+		}
+		if last := points[len(points)-1]; last.Price != 84 {
+			t.Errorf("%s: last point %+v, want that of 23:00", test.day, last)
+		}
+	}
+
+	// The intraday prices are those of the same hours
+	points, err := profile.Default().ImPrices(context.Background(), "2024-10-27", 3, 4)
+	if err != nil || len(points) != 2 || points[0].Price != 68 || points[1].Price != 68 || points[1].Start.Sub(points[0].Start).Hours() != 1 {
+		t.Errorf("intraday points %+v, %v, want both hours at 2:00", points, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	var rows []string
+	for hour := range 24 {
+		rows = append(rows, strings.Repeat(" ", hour%2)+fmt.Sprintf("%d,%d", hour, 100+hour))
+	}
+	valid := "hour,price\n" + strings.Join(rows, "\n") + "\n"
+	tests := []struct {
+		name, csv, err string
+	}{
+		{"valid", valid, ""},
+		{"header", "price,hour\n", "expected the header hour,price"},
+		{"empty", "", "expected the header hour,price"},
+		{"invalid hour", "hour,price\n24,10\n", `line 2: invalid hour "24", expected 0 to 23`},
+		{"invalid price", "hour,price\n0,cheap\n", `line 2: invalid price "cheap"`},
+		{"twice", "hour,price\n0,10\n0,20\n", "line 3: hour 0 priced twice"},
+		{"missing", "hour,price\n0,10\n1,20\n", "no price of hour 2"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "profile.csv")
+		if err := os.WriteFile(path, []byte(test.csv), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		source, err := profile.Load(path)
+		if test.err != "" {
+			if err == nil || err.Error() != path+": "+test.err {
+				t.Errorf("%s: error %v, want %s", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		points, err := source.ImPrices(context.Background(), "2024-10-01", 1, 24)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, p := range points {
+			if p.Price != float64(100+i) {
+				t.Errorf("%s: point %d %+v, want %d", test.name, i, p, 100+i)
+			}
+		}
+	}
+	if _, err := profile.Load(filepath.Join(t.TempDir(), "missing.csv")); !e.Is(err, os.ErrNotExist) {
+		t.Errorf("error %v loading a missing file", err)
+	}
+}
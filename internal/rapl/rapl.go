@@ -0,0 +1,98 @@
+// Package rapl measures the energy consumed by the CPU packages with the RAPL
+// counters of the powercap interface, /sys/class/powercap/intel-rapl:N.
+package rapl
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+)
+
+// Zone is the RAPL zone of a CPU package.
+type Zone struct {
+	Name string
+	Path string
+	// MaxRange is the value energy_uj wraps around at
+	MaxRange uint64
+}
+
+// Zones returns the package zones under root, where sysfs is mounted. Their
+// subzones, e.g. the cores or the DRAM, are part of the packages and left
+// out.
+func Zones(fsys actuator.Filesystem, root string) ([]Zone, error) {
+	paths, err := fsys.Glob(actuator.Path(root, "class", "powercap", "intel-rapl:*"))
+	if err != nil {
+		return nil, err
+	}
+	var zones []Zone
+	for _, path := range paths {
+		if strings.Count(filepath.Base(path), ":") != 1 {
+			continue
+		}
+		name, err := actuator.ReadFile(fsys, filepath.Join(path, "name"))
+		if err != nil {
+			return nil, err
+		}
+		maxRange, err := readCounter(fsys, filepath.Join(path, "max_energy_range_uj"))
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, Zone{Name: strings.TrimSpace(name), Path: path, MaxRange: maxRange})
+	}
+	return zones, nil
+}
+
+// Delta returns the microjoules counted from prev to cur by a counter
+// wrapping around at maxRange.
+func Delta(prev, cur, maxRange uint64) uint64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	return maxRange - prev + cur
+}
+
+// Meter measures the energy of the zones between its samples.
+type Meter struct {
+	FS    actuator.Filesystem
+	Zones []Zone
+	last  map[string]uint64
+}
+
+// Sample returns the joules the zones consumed since the last sample, and
+// false on the first one, which only starts the measurement.
+func (m *Meter) Sample() (float64, bool, error) {
+	counters := make(map[string]uint64, len(m.Zones))
+	for _, z := range m.Zones {
+		counter, err := readCounter(m.FS, filepath.Join(z.Path, "energy_uj"))
+		if err != nil {
+			return 0, false, err
+		}
+		counters[z.Path] = counter
+	}
+	last := m.last
+	m.last = counters
+	if last == nil {
+		return 0, false, nil
+	}
+	var microjoules uint64
+	for _, z := range m.Zones {
+		microjoules += Delta(last[z.Path], counters[z.Path], z.MaxRange)
+	}
+	return float64(microjoules) / 1e6, true, nil
+}
+
+// readCounter reads a counter file.
+func readCounter(fsys actuator.Filesystem, path string) (uint64, error) {
+	content, err := actuator.ReadFile(fsys, path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(content), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected %s %q", filepath.Base(path), strings.TrimSpace(content))
+	}
+	return n, nil
+}
@@ -0,0 +1,113 @@
+package rapl_test
+
+import (
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/actuator"
+	"github.com/CERIT-SC/epcp-simulator/internal/rapl"
+)
+
+// maxRange is that of the zones of raplTree, in microjoules.
+const maxRange = 262143328850
+
+// raplTree returns the powercap tree of two packages, with a core subzone.
+func raplTree() *actuator.MemFS {
+	return actuator.NewMemFS(map[string]string{
+		"/sys/class/powercap/intel-rapl:0/name":                  "package-0\n",
+		"/sys/class/powercap/intel-rapl:0/max_energy_range_uj":   "262143328850\n",
+		"/sys/class/powercap/intel-rapl:0/energy_uj":             "1000\n",
+		"/sys/class/powercap/intel-rapl:0:0/name":                "core\n",
+		"/sys/class/powercap/intel-rapl:0:0/max_energy_range_uj": "262143328850\n",
+		"/sys/class/powercap/intel-rapl:0:0/energy_uj":           "500\n",
+		"/sys/class/powercap/intel-rapl:1/name":                  "package-1\n",
+		"/sys/class/powercap/intel-rapl:1/max_energy_range_uj":   "262143328850\n",
+		"/sys/class/powercap/intel-rapl:1/energy_uj":             "262143000000\n",
+	})
+}
+
+func TestZones(t *testing.T) {
+	zones, err := rapl.Zones(raplTree(), "/sys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []rapl.Zone{
+		{Name: "package-0", Path: "/sys/class/powercap/intel-rapl:0", MaxRange: maxRange},
+		{Name: "package-1", Path: "/sys/class/powercap/intel-rapl:1", MaxRange: maxRange},
+	}
+	if len(zones) != len(want) {
+		t.Fatalf("zones %+v, want %+v", zones, want)
+	}
+	for i := range want {
+		if zones[i] != want[i] {
+			t.Errorf("zone %d %+v, want %+v", i, zones[i], want[i])
+		}
+	}
+
+	zones, err = rapl.Zones(actuator.NewMemFS(nil), "/sys")
+	if err != nil || len(zones) != 0 {
+		t.Errorf("zones %+v, %v without RAPL", zones, err)
+	}
+	broken := actuator.NewMemFS(map[string]string{
+		"/sys/class/powercap/intel-rapl:0/name":                "package-0\n",
+		"/sys/class/powercap/intel-rapl:0/max_energy_range_uj": "unlimited\n",
+	})
+	if _, err := rapl.Zones(broken, "/sys"); err == nil || err.Error() != `unexpected max_energy_range_uj "unlimited"` {
+		t.Errorf("error %v", err)
+	}
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		prev, cur, want uint64
+	}{
+		{1000, 5000, 4000},
+		{5000, 5000, 0},
+		// Wrapped around
+		{maxRange - 1000, 500, 1500},
+		{maxRange - 1000, 0, 1000},
+	}
+	for _, test := range tests {
+		if got := rapl.Delta(test.prev, test.cur, maxRange); got != test.want {
+			t.Errorf("Delta(%d, %d): %d, want %d", test.prev, test.cur, got, test.want)
+		}
+	}
+}
+
+func TestMeter(t *testing.T) {
+	tree := raplTree()
+	zones, err := rapl.Zones(tree, "/sys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meter := &rapl.Meter{FS: tree, Zones: zones}
+	if joules, ok, err := meter.Sample(); joules != 0 || ok || err != nil {
+		t.Fatalf("first sample %g, %t, %v, want only the start", joules, ok, err)
+	}
+	set := func(zone, value string) {
+		t.Helper()
+		if err := tree.Write("/sys/class/powercap/intel-rapl:"+zone+"/energy_uj", []byte(value+"\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Package 1 wraps around while package 0 counts on; the core subzone
+	// is part of package 0
+	set("0", "3000001000")
+	set("0:0", "999999999")
+	set("1", "1671150")
+	joules, ok, err := meter.Sample()
+	if !ok || err != nil || joules != 3000+2 {
+		t.Errorf("sample %g J, %t, %v, want 3002 J", joules, ok, err)
+	}
+	// Twice in a row
+	set("1", "1000")
+	joules, ok, err = meter.Sample()
+	if !ok || err != nil || joules != float64(maxRange-1671150+1000)/1e6 {
+		t.Errorf("sample %g J, %t, %v", joules, ok, err)
+	}
+
+	set("1", "garbage")
+	if _, _, err := meter.Sample(); err == nil {
+		t.Error("a malformed counter accepted")
+	}
+}
@@ -0,0 +1,119 @@
+// Package solar estimates the production of an on-site photovoltaic plant
+// with the forecast.solar API and lowers the grid prices by the value of the
+// production consumed on site.
+package solar
+
+import (
+	"context"
+	"encoding/json"
+	e "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultURL is the public forecast.solar API.
+const DefaultURL = "https://api.forecast.solar"
+
+// ErrRateLimited is returned when the API refuses the request because too
+// many were made, 12 per hour on the free tier.
+var ErrRateLimited = e.New("forecast.solar rate limit reached")
+
+// Site is a PV plant: its location in degrees, the declination of its
+// panels from the horizontal, their azimuth from the south, west positive,
+// and its peak power in kW.
+type Site struct {
+	Latitude    float64
+	Longitude   float64
+	Declination float64
+	Azimuth     float64
+	KWp         float64
+}
+
+// Forecast is the estimated production in kWh of each hour, by the Unix
+// time of its start.
+type Forecast struct {
+	Energy map[int64]float64 `json:"energy"`
+}
+
+// Fetch returns the forecast of the site from the API at base, DefaultURL if
+// empty.
+func Fetch(ctx context.Context, client *http.Client, base string, site Site) (*Forecast, error) {
+	if base == "" {
+		base = DefaultURL
+	}
+	url := fmt.Sprintf("%s/estimate/%g/%g/%g/%g/%g", strings.TrimSuffix(base, "/"),
+		site.Latitude, site.Longitude, site.Declination, site.Azimuth, site.KWp)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, ErrRateLimited
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("forecast.solar: HTTP status %d", resp.StatusCode)
+	}
+	return Decode(io.LimitReader(resp.Body, 1<<20))
+}
+
+// Decode reads a forecast.solar estimate. Its watt_hours_period holds the
+// production of the periods ending at local times of the site, which are
+// summed by the hour they start in.
+func Decode(r io.Reader) (*Forecast, error) {
+	var response struct {
+		Result struct {
+			Periods map[string]float64 `json:"watt_hours_period"`
+		} `json:"result"`
+		Message struct {
+			Info struct {
+				Timezone string `json:"timezone"`
+			} `json:"info"`
+		} `json:"message"`
+	}
+	if err := json.NewDecoder(r).Decode(&response); err != nil {
+		return nil, err
+	}
+	location := time.UTC
+	if name := response.Message.Info.Timezone; name != "" {
+		var err error
+		if location, err = time.LoadLocation(name); err != nil {
+			return nil, err
+		}
+	}
+	f := &Forecast{Energy: make(map[int64]float64)}
+	for period, wh := range response.Result.Periods {
+		end, err := time.ParseInLocation(time.DateTime, period, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid period %q: %w", period, err)
+		}
+		start := end.Add(-time.Second).Truncate(time.Hour)
+		f.Energy[start.Unix()] += wh / 1000
+	}
+	return f, nil
+}
+
+// Hour returns the production in kWh of the hour starting at start.
+func (f *Forecast) Hour(start time.Time) float64 {
+	return f.Energy[start.Truncate(time.Hour).Unix()]
+}
+
+// Adjust lowers the price by the share of the load in kWh the production in
+// kWh covers, which does not have to be bought from the grid.
+func Adjust(price, production, load float64) float64 {
+	if load <= 0 {
+		return price
+	}
+	return price * (1 - min(production, load)/load)
+}
@@ -0,0 +1,111 @@
+package solar_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/solar"
+)
+
+// estimate returns a forecast.solar estimate for a 6 kWp plant in Brno on
+// 1 June 2024.
+func estimate(t *testing.T) []byte {
+	t.Helper()
+	content, err := os.ReadFile("testdata/estimate.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestDecode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/estimate/49.1951/16.6068/35/-10/6" {
+			t.Errorf("requested %s", r.URL.Path)
+		}
+		w.Write(estimate(t))
+	}))
+	defer server.Close()
+	site := solar.Site{Latitude: 49.1951, Longitude: 16.6068, Declination: 35, Azimuth: -10, KWp: 6}
+	forecast, err := solar.Fetch(context.Background(), server.Client(), server.URL+"/", site)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Skip(err)
+	}
+	hour := func(h int) time.Time { return time.Date(2024, time.June, 1, h, 0, 0, 0, prague) }
+	tests := []struct {
+		start time.Time
+		want  float64
+	}{
+		// The period ending at 05:00 local time is the hour from 04:00,
+		// together with the one ending at sunrise
+		{hour(4), 0.007},
+		{hour(11), 4.379},
+		{hour(11).Add(30 * time.Minute), 4.379},
+		// The sunset period is the hour it ends in
+		{hour(19), 0.176},
+		{hour(20), 0.020},
+		{hour(21), 0},
+		{hour(2), 0},
+	}
+	for _, test := range tests {
+		if got := forecast.Hour(test.start); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: %g kWh, want %g", test.start, got, test.want)
+		}
+	}
+	if n := len(forecast.Energy); n != 17 {
+		t.Errorf("%d hours forecast, want 17", n)
+	}
+	var total float64
+	for _, kWh := range forecast.Energy {
+		total += kWh
+	}
+	if math.Abs(total-37.710) > 1e-9 {
+		t.Errorf("%g kWh in the day, want the 37.710 kWh of watt_hours_day", total)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	status := http.StatusTooManyRequests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	if _, err := solar.Fetch(context.Background(), server.Client(), server.URL, solar.Site{}); !errors.Is(err, solar.ErrRateLimited) {
+		t.Errorf("rate limited: got error %v, want ErrRateLimited", err)
+	}
+	status = http.StatusBadRequest
+	if _, err := solar.Fetch(context.Background(), server.Client(), server.URL, solar.Site{}); err == nil || errors.Is(err, solar.ErrRateLimited) {
+		t.Errorf("bad request: got error %v", err)
+	}
+}
+
+func TestAdjust(t *testing.T) {
+	tests := []struct {
+		price, production, load, want float64
+	}{
+		{120, 0, 2, 120},
+		{120, 1, 2, 60},
+		{120, 0.5, 2, 90},
+		{120, 2, 2, 0},
+		// Production beyond the load is not consumed on site
+		{120, 5, 2, 0},
+		{-20, 1, 2, -10},
+		{120, 1, 0, 120},
+	}
+	for _, test := range tests {
+		if got := solar.Adjust(test.price, test.production, test.load); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("Adjust(%g, %g, %g) = %g, want %g", test.price, test.production, test.load, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	e "errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrLocked is returned by Acquire when another instance holds the lock.
+var ErrLocked = e.New("another instance is running")
+
+// Lock is an exclusive file lock preventing concurrent runs.
+type Lock struct {
+	file *os.File
+}
+
+// Acquire takes the lock at path, waiting up to wait for another instance
+// to release it. ErrLocked is returned when the lock is still held.
+func Acquire(ctx context.Context, path string, wait time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if locked {
+			return &Lock{file: f}, nil
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, ErrLocked
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Release unlocks and closes the lock file.
+func (l *Lock) Release() {
+	unlock(l.file)
+	l.file.Close()
+}
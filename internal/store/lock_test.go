@@ -0,0 +1,51 @@
+package store_test
+
+import (
+	"context"
+	e "errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/store"
+)
+
+func TestAcquire(t *testing.T) {
+	// The directory of the lock is created
+	path := filepath.Join(t.TempDir(), "state", "epcp.lock")
+	ctx := context.Background()
+	first, err := store.Acquire(ctx, path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Acquire(ctx, path, 0); !e.Is(err, store.ErrLocked) {
+		t.Errorf("second instance without waiting: got error %v, want ErrLocked", err)
+	}
+	start := time.Now()
+	if _, err := store.Acquire(ctx, path, 300*time.Millisecond); !e.Is(err, store.ErrLocked) {
+		t.Errorf("second instance waiting: got error %v, want ErrLocked", err)
+	}
+	if waited := time.Since(start); waited < 300*time.Millisecond {
+		t.Errorf("second instance gave up after %s, want 300ms", waited)
+	}
+
+	// A cancelled wait returns the error of the context
+	cancelled, cancel := context.WithCancel(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := store.Acquire(cancelled, path, time.Minute); !e.Is(err, context.Canceled) {
+		t.Errorf("cancelled wait: got error %v, want context.Canceled", err)
+	}
+
+	// A waiting instance gets the lock once it is released
+	time.AfterFunc(100*time.Millisecond, first.Release)
+	second, err := store.Acquire(ctx, path, 5*time.Second)
+	if err != nil {
+		t.Fatalf("waiting for the release: %s", err)
+	}
+	second.Release()
+	third, err := store.Acquire(ctx, path, 0)
+	if err != nil {
+		t.Fatalf("after the release: %s", err)
+	}
+	third.Release()
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package store
+
+import (
+	e "errors"
+	"os"
+	"syscall"
+)
+
+// tryLock takes an exclusive flock without blocking and reports whether it
+// succeeded.
+func tryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if e.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlock(f *os.File) {
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
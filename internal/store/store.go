@@ -0,0 +1,71 @@
+// Package store persists the simulator state: JSON documents replaced
+// atomically, append-only JSON lines logs and the instance lock.
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// LoadJSON decodes the JSON document at path into v. A missing file is
+// reported as os.ErrNotExist and leaves v untouched.
+func LoadJSON(path string, v any) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// SaveJSON writes v to path atomically via a temporary file, creating the
+// directory if needed.
+func SaveJSON(path string, v any) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Log is an append-only JSON lines file.
+type Log struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// OpenLog opens the log at path for appending, creating it if needed.
+func OpenLog(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{file: f, writer: bufio.NewWriter(f)}, nil
+}
+
+// Append writes v as one line and flushes it to the file.
+func (l *Log) Append(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	l.writer.Write(append(line, '\n'))
+	return l.writer.Flush()
+}
+
+// Close flushes buffered lines and closes the file.
+func (l *Log) Close() error {
+	if err := l.writer.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
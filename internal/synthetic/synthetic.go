@@ -0,0 +1,111 @@
+// Package synthetic generates hourly prices following a daily curve, for
+// demos and tests without the OTE service.
+package synthetic
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+)
+
+// Params shape the generated prices: a sinusoid around Base, Amplitude above
+// it at PeakHour and below it twelve hours later, with normally distributed
+// noise of deviation Noise. With probability Spikes, the price of an hour is
+// SpikeFactor times higher.
+type Params struct {
+	Base      float64
+	Amplitude float64
+	PeakHour  float64
+	Noise     float64
+	Spikes    float64
+	Seed      int64
+}
+
+// SpikeFactor multiplies the price of the spiking hours.
+const SpikeFactor = 3
+
+// DefaultParams resemble the intraday prices in EUR/MWh on a working day.
+var DefaultParams = Params{Base: 100, Amplitude: 40, PeakHour: 18, Noise: 5, Spikes: 0.01}
+
+// Source is an ote.PriceSource of generated prices, both as the intraday
+// and the day-ahead prices. It has no day-ahead indexes.
+type Source struct {
+	params Params
+}
+
+var _ ote.PriceSource = (*Source)(nil)
+
+// New returns a source generating prices with the params.
+func New(params Params) *Source {
+	return &Source{params: params}
+}
+
+// Price returns the price and volume of the hour starting at start. The
+// noise depends only on the seed and start, so the same hour is priced the
+// same in every run and whatever the window it is requested in.
+func (s *Source) Price(start time.Time) (price, volume float64) {
+	p := s.params
+	r := rand.New(rand.NewPCG(uint64(p.Seed), uint64(start.Unix())))
+	local := start.In(ote.Location())
+	hour := float64(local.Hour()) + float64(local.Minute())/60
+	price = p.Base + p.Amplitude*math.Cos(2*math.Pi*(hour-p.PeakHour)/24) + p.Noise*r.NormFloat64()
+	if r.Float64() < p.Spikes {
+		price *= SpikeFactor
+	}
+	volume = math.Max(0, 100+20*r.NormFloat64())
+	return math.Round(price*100) / 100, math.Round(volume*10) / 10
+}
+
+// hours returns the prices of the trading hours of the day, inclusive.
+func (s *Source) hours(day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	var points []ote.PricePoint
+	for hour := fromHour; hour <= toHour; hour++ {
+		start, err := ote.HourStart(day, hour)
+		if err != nil {
+			return nil, err
+		}
+		price, volume := s.Price(start)
+		points = append(points, ote.PricePoint{Date: day, Hour: hour, Start: start, Price: price, Volume: volume})
+	}
+	return points, nil
+}
+
+func (s *Source) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	return s.hours(day, fromHour, toHour)
+}
+
+func (s *Source) DamPrices(ctx context.Context, from, to string) ([]ote.PricePoint, error) {
+	var points []ote.PricePoint
+	err := ote.EachDay(from, to, func(day string, hours int) error {
+		dayPoints, err := s.hours(day, 1, hours)
+		points = append(points, dayPoints...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+func (s *Source) DamIndex(ctx context.Context, from, to string) ([]ote.DamIndex, error) {
+	return nil, fmt.Errorf("synthetic day-ahead indexes: %w", ote.ErrNoData)
+}
+
+// Perturb returns a realization of the prices with normally distributed
+// noise of deviation noise added and, with probability spikes, the price of
+// an hour SpikeFactor times higher, drawn from r.
+func Perturb(prices []float64, noise, spikes float64, r *rand.Rand) []float64 {
+	perturbed := make([]float64, len(prices))
+	for i, price := range prices {
+		p := price + noise*r.NormFloat64()
+		if r.Float64() < spikes {
+			p *= SpikeFactor
+		}
+		perturbed[i] = math.Round(p*100) / 100
+	}
+	return perturbed
+}
@@ -0,0 +1,108 @@
+package synthetic_test
+
+import (
+	"bytes"
+	"context"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/pricefile"
+	"github.com/CERIT-SC/epcp-simulator/internal/synthetic"
+)
+
+func TestDeterminism(t *testing.T) {
+	params := synthetic.DefaultParams
+	params.Seed = 42
+	week := func(params synthetic.Params) []ote.PricePoint {
+		points, err := synthetic.New(params).DamPrices(context.Background(), "2024-03-04", "2024-03-10")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return points
+	}
+	first, second := week(params), week(params)
+	if len(first) != 7*24 || !slices.Equal(first, second) {
+		t.Fatalf("%d and %d points differ with the same seed", len(first), len(second))
+	}
+	params.Seed = 43
+	if slices.Equal(first, week(params)) {
+		t.Error("the same prices with another seed")
+	}
+
+	// An hour is priced the same whatever the window it is requested in
+	params.Seed = 42
+	points, err := synthetic.New(params).ImPrices(context.Background(), "2024-03-06", 10, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := first[2*24+9 : 2*24+12]; !slices.Equal(points, want) {
+		t.Errorf("intraday hours 10 to 12 %v, want the day-ahead %v", points, want)
+	}
+
+	r1, r2 := rand.New(rand.NewPCG(1, 2)), rand.New(rand.NewPCG(1, 2))
+	prices := []float64{100, 120, 80}
+	if a, b := synthetic.Perturb(prices, 5, 0.1, r1), synthetic.Perturb(prices, 5, 0.1, r2); !slices.Equal(a, b) {
+		t.Errorf("Perturb %v and %v differ with the same seed", a, b)
+	}
+}
+
+func TestShape(t *testing.T) {
+	for _, peak := range []float64{6, 18} {
+		params := synthetic.Params{Base: 100, Amplitude: 40, PeakHour: peak, Noise: 5, Spikes: 0.01, Seed: 7}
+		points, err := synthetic.New(params).DamPrices(context.Background(), "2024-01-01", "2024-03-31")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sums [24]float64
+		var counts [24]int
+		for _, p := range points {
+			hour := p.Start.In(ote.Location()).Hour()
+			sums[hour] += p.Price
+			counts[hour]++
+		}
+		top := 0
+		for hour := range sums {
+			if sums[hour]/float64(counts[hour]) > sums[top]/float64(counts[top]) {
+				top = hour
+			}
+		}
+		if top != int(peak) {
+			t.Errorf("peak hour %g: the highest mean price at %d", peak, top)
+		}
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	source := synthetic.New(synthetic.Params{Base: 100, Amplitude: 40, PeakHour: 18, Noise: 5, Seed: 1})
+	points, err := source.DamPrices(context.Background(), "2024-03-30", "2024-03-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The generated prices can be read back by the file source, over the
+	// short day of the switch to summer time
+	var csv bytes.Buffer
+	if err := pricefile.WriteCSV(&csv, points); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "prices.csv")
+	if err := os.WriteFile(path, csv.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := pricefile.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := file.DamPrices(context.Background(), "2024-03-30", "2024-03-31")
+	if err != nil || len(loaded) != 24+23 {
+		t.Fatalf("loaded %d points, %v, want 47", len(loaded), err)
+	}
+	for i, p := range loaded {
+		if p.Price != points[i].Price || !p.Start.Equal(points[i].Start) {
+			t.Errorf("point %d: %v, want %v", i, p, points[i])
+		}
+	}
+}
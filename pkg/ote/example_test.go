@@ -0,0 +1,83 @@
+package ote_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/pkg/ote"
+	"github.com/CERIT-SC/epcp-simulator/pkg/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/pkg/pricing"
+)
+
+func ExampleFetchWindow() {
+	from := time.Date(2024, time.October, 27, 0, 0, 0, 0, ote.Location())
+	to := from.Add(3 * time.Hour)
+	var points []pricing.PricePoint
+	for t, price := from, 80.0; !t.After(to); t, price = t.Add(time.Hour), price+10 {
+		date, hour := ote.HourIndex(t)
+		points = append(points, pricing.PricePoint{Date: date, Hour: hour, Start: t, Price: price})
+	}
+	server := otetest.NewServer(points)
+	defer server.Close()
+
+	client := ote.NewClient(ote.WithEndpoint(server.URL))
+	window, err := ote.FetchWindow(context.Background(), client, from, to)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, p := range window {
+		fmt.Printf("%s hour %d from %s: %.2f\n", p.Date, p.Hour, p.Start.In(ote.Location()).Format("15:04 MST"), p.Price)
+	}
+	// Output:
+	// 2024-10-27 hour 1 from 00:00 CEST: 80.00
+	// 2024-10-27 hour 2 from 01:00 CEST: 90.00
+	// 2024-10-27 hour 3 from 02:00 CEST: 100.00
+	// 2024-10-27 hour 4 from 02:00 CET: 110.00
+}
+
+// flatPrices is a source of its price for every hour, e.g. a fixed tariff.
+type flatPrices float64
+
+func (f flatPrices) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]pricing.PricePoint, error) {
+	var points []pricing.PricePoint
+	for hour := fromHour; hour <= toHour; hour++ {
+		points = append(points, pricing.PricePoint{Date: day, Hour: hour, Price: float64(f)})
+	}
+	return points, nil
+}
+
+// Windows of the prices of other sources than the service are stitched
+// alike.
+func ExampleFetchWindow_source() {
+	from := time.Date(2024, time.October, 1, 22, 0, 0, 0, ote.Location())
+	window, err := ote.FetchWindow(context.Background(), flatPrices(95), from, from.Add(3*time.Hour))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, p := range window {
+		fmt.Printf("%s hour %d: %.2f\n", p.Date, p.Hour, p.Price)
+	}
+	// Output:
+	// 2024-10-01 hour 23: 95.00
+	// 2024-10-01 hour 24: 95.00
+	// 2024-10-02 hour 1: 95.00
+	// 2024-10-02 hour 2: 95.00
+}
+
+func ExampleHourIndex() {
+	for _, t := range []time.Time{
+		time.Date(2024, time.March, 31, 4, 0, 0, 0, ote.Location()),
+		time.Date(2024, time.October, 27, 4, 0, 0, 0, ote.Location()),
+		time.Date(2024, time.November, 1, 23, 30, 0, 0, ote.Location()),
+	} {
+		day, hour := ote.HourIndex(t)
+		fmt.Println(day, hour)
+	}
+	// Output:
+	// 2024-03-31 4
+	// 2024-10-27 6
+	// 2024-11-01 24
+}
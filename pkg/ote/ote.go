@@ -0,0 +1,169 @@
+// Package ote is the public API of the client of the public data service of
+// OTE, the Czech electricity market operator, see package pricing for the
+// stability it commits to.
+package ote
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/pkg/pricing"
+)
+
+// DefaultEndpoint is the URL of the public data service.
+const DefaultEndpoint = ote.DefaultEndpoint
+
+// ErrNoData is returned, wrapped, when the service has no prices for the
+// requested window.
+var ErrNoData = ote.ErrNoData
+
+// Client calls the SOAP operations of the public data service. It is safe
+// for concurrent use.
+type Client struct {
+	client *ote.Client
+}
+
+// Option configures a Client.
+type Option struct {
+	apply ote.Option
+}
+
+// PriceSource is the part of the service FetchWindow reads; Client
+// implements it.
+type PriceSource interface {
+	// ImPrices returns the intraday prices of the trading hours of the
+	// day, inclusive, numbered from 1, see HourIndex. A point without a
+	// Start starts with its hour.
+	ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]pricing.PricePoint, error)
+}
+
+var _ PriceSource = (*Client)(nil)
+
+// Limiter delays the requests to respect a rate limit; *rate.Limiter of
+// golang.org/x/time/rate implements it.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// NewClient returns a client of the service.
+func NewClient(options ...Option) *Client {
+	applied := make([]ote.Option, len(options))
+	for i, o := range options {
+		applied[i] = o.apply
+	}
+	return &Client{client: ote.NewClient(applied...)}
+}
+
+// ImPrices returns the hourly prices of the intraday market of the trading
+// hours of the day, inclusive, in EUR/MWh.
+func (c *Client) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]pricing.PricePoint, error) {
+	points, err := c.client.ImPrices(ctx, day, fromHour, toHour)
+	return publicPoints(points), err
+}
+
+// DamPrices returns the hourly prices of the day-ahead market between the
+// dates, inclusive, in CZK/MWh unless WithCurrency asks for EUR.
+func (c *Client) DamPrices(ctx context.Context, from, to string) ([]pricing.PricePoint, error) {
+	points, err := c.client.DamPrices(ctx, from, to)
+	return publicPoints(points), err
+}
+
+// WithEndpoint sets the URL of the service, DefaultEndpoint by default.
+func WithEndpoint(endpoint string) Option {
+	return Option{ote.WithEndpoint(endpoint)}
+}
+
+// WithHTTPClient sets the HTTP client of the requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return Option{ote.WithHTTPClient(httpClient)}
+}
+
+// WithTimeout bounds each request, whether it comes before or after
+// WithHTTPClient.
+func WithTimeout(timeout time.Duration) Option {
+	return Option{ote.WithTimeout(timeout)}
+}
+
+// WithCurrency sets the currency of the day-ahead prices, CZK or EUR. The
+// service returns CZK by default; the intraday prices are always in EUR.
+func WithCurrency(currency string) Option {
+	return Option{ote.WithCurrency(currency)}
+}
+
+// WithRetries retries the requests failing on the network, waiting backoff
+// before the first retry and twice as long before each next one.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return Option{ote.WithRetries(retries, backoff)}
+}
+
+// WithRateLimiter makes every request, retries included, wait for the
+// limiter.
+func WithRateLimiter(limiter Limiter) Option {
+	return Option{ote.WithRateLimiter(limiter)}
+}
+
+// WithUserAgent sets the User-Agent header of the requests.
+func WithUserAgent(userAgent string) Option {
+	return Option{ote.WithUserAgent(userAgent)}
+}
+
+// FetchWindow returns the intraday prices of the trading hours from the one
+// from falls in to the one to falls in, inclusive, sorted by their start. A
+// day of the window without prices is skipped, unless it is the last one.
+func FetchWindow(ctx context.Context, source PriceSource, from, to time.Time) ([]pricing.PricePoint, error) {
+	points, err := ote.FetchWindow(ctx, windowSource{source}, from, to)
+	return publicPoints(points), err
+}
+
+// HourIndex returns the trading day of t and the index of its trading hour,
+// from 1 at midnight; the days of the clock changes have 23 or 25 hours.
+func HourIndex(t time.Time) (day string, hour int) {
+	return ote.HourIndex(t)
+}
+
+// Location returns the timezone of the market, in which the trading days
+// and hours are counted.
+func Location() *time.Location {
+	return ote.Location()
+}
+
+// windowSource serves the intraday prices of a PriceSource to the
+// FetchWindow of internal/ote, which reads nothing else. The points without
+// a start start at the start of their trading hour.
+type windowSource struct {
+	source PriceSource
+}
+
+func (s windowSource) ImPrices(ctx context.Context, day string, fromHour, toHour int) ([]ote.PricePoint, error) {
+	points, err := s.source.ImPrices(ctx, day, fromHour, toHour)
+	internal := make([]ote.PricePoint, len(points))
+	for i, p := range points {
+		internal[i] = ote.PricePoint{Date: p.Date, Hour: p.Hour, Start: p.Start, Price: p.Price, Volume: p.Volume, Provisional: p.Provisional}
+		if p.Start.IsZero() {
+			internal[i].Start, _ = ote.HourStart(p.Date, p.Hour)
+		}
+	}
+	return internal, err
+}
+
+func (windowSource) DamPrices(context.Context, string, string) ([]ote.PricePoint, error) {
+	return nil, ErrNoData
+}
+
+func (windowSource) DamIndex(context.Context, string, string) ([]ote.DamIndex, error) {
+	return nil, ErrNoData
+}
+
+// publicPoints converts the points of internal/ote to those of the API.
+func publicPoints(points []ote.PricePoint) []pricing.PricePoint {
+	if points == nil {
+		return nil
+	}
+	public := make([]pricing.PricePoint, len(points))
+	for i, p := range points {
+		public[i] = pricing.PricePoint{Date: p.Date, Hour: p.Hour, Start: p.Start, Price: p.Price, Volume: p.Volume, Provisional: p.Provisional}
+	}
+	return public
+}
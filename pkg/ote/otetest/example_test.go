@@ -0,0 +1,28 @@
+package otetest_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/pkg/ote"
+	"github.com/CERIT-SC/epcp-simulator/pkg/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/pkg/pricing"
+)
+
+func ExampleNewServer() {
+	start := time.Date(2024, time.June, 1, 12, 0, 0, 0, ote.Location())
+	date, hour := ote.HourIndex(start)
+	server := otetest.NewServer([]pricing.PricePoint{{Date: date, Hour: hour, Start: start, Price: 42.5, Volume: 120}})
+	defer server.Close()
+
+	client := ote.NewClient(ote.WithEndpoint(server.URL))
+	points, err := client.ImPrices(context.Background(), date, hour, hour)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%d point, %.2f EUR/MWh, %.0f MWh\n", len(points), points[0].Price, points[0].Volume)
+	// Output:
+	// 1 point, 42.50 EUR/MWh, 120 MWh
+}
@@ -0,0 +1,23 @@
+// Package otetest stands in for the public data service of OTE in the tests
+// of code using package ote.
+package otetest
+
+import (
+	"net/http/httptest"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/ote"
+	"github.com/CERIT-SC/epcp-simulator/internal/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/pkg/pricing"
+)
+
+// NewServer starts an HTTP server standing in for the service, answering
+// the intraday and day-ahead prices with the points of the requested days
+// and hours. The caller closes the server; its URL is the endpoint of the
+// client, see ote.WithEndpoint.
+func NewServer(points []pricing.PricePoint) *httptest.Server {
+	internal := make([]ote.PricePoint, len(points))
+	for i, p := range points {
+		internal[i] = ote.PricePoint{Date: p.Date, Hour: p.Hour, Start: p.Start, Price: p.Price, Volume: p.Volume, Provisional: p.Provisional}
+	}
+	return otetest.NewServer(internal)
+}
@@ -0,0 +1,80 @@
+package policy_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/pkg/ote"
+	"github.com/CERIT-SC/epcp-simulator/pkg/ote/otetest"
+	"github.com/CERIT-SC/epcp-simulator/pkg/policy"
+	"github.com/CERIT-SC/epcp-simulator/pkg/pricing"
+)
+
+// Fetches a window of intraday prices from a stand-in of the OTE service and
+// decides the band of its latest hour, as an embedding tool would.
+func Example() {
+	from := time.Date(2024, time.October, 1, 6, 0, 0, 0, ote.Location())
+	to := from.Add(3 * time.Hour)
+	var published []pricing.PricePoint
+	for i, price := range []float64{120, 100, 105, 90} {
+		t := from.Add(time.Duration(i) * time.Hour)
+		date, hour := ote.HourIndex(t)
+		published = append(published, pricing.PricePoint{Date: date, Hour: hour, Start: t, Price: price})
+	}
+	server := otetest.NewServer(published)
+	defer server.Close()
+
+	client := ote.NewClient(ote.WithEndpoint(server.URL))
+	points, err := ote.FetchWindow(context.Background(), client, from, to)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	decision, err := policy.Decide(policy.Trend{}, points)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%d hours, the one from %s is %s at %.2f\n", len(points), decision.Time.In(ote.Location()).Format("15:04"), decision.Band, decision.Price)
+	// Output:
+	// 4 hours, the one from 09:00 is cheap at 90.00
+}
+
+func ExampleDecide() {
+	start := time.Date(2024, time.October, 1, 6, 0, 0, 0, ote.Location())
+	var points []pricing.PricePoint
+	for i, price := range []float64{80, 95, 90, 110, 130} {
+		t := start.Add(time.Duration(i) * time.Hour)
+		date, hour := ote.HourIndex(t)
+		points = append(points, pricing.PricePoint{Date: date, Hour: hour, Start: t, Price: price})
+	}
+
+	decision, err := policy.Decide(policy.Trend{}, points)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%s: %s at %.2f\n", decision.Time.In(ote.Location()).Format("2006-01-02 15:04"), decision.Band, decision.Price)
+	// Output:
+	// 2024-10-01 10:00: expensive at 130.00
+}
+
+func ExampleDecide_insufficientData() {
+	_, err := policy.Decide(policy.Trend{}, nil)
+	fmt.Println(err == policy.ErrInsufficientData)
+	// Output:
+	// true
+}
+
+func ExampleNew() {
+	p, err := policy.New("trend", nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	band, err := p.Band([]float64{120, 100, 90})
+	fmt.Println(band, err)
+	// Output:
+	// cheap <nil>
+}
@@ -0,0 +1,60 @@
+// Package policy is the public API of the policies deciding the price band
+// of the latest of a series of hourly prices, see package pricing for the
+// stability it commits to.
+package policy
+
+import (
+	"time"
+
+	"github.com/CERIT-SC/epcp-simulator/internal/policy"
+	"github.com/CERIT-SC/epcp-simulator/pkg/pricing"
+)
+
+// The bands the prices fall in.
+const (
+	Cheap     = policy.Cheap
+	Expensive = policy.Expensive
+)
+
+// ErrInsufficientData is returned when there are too few prices to decide.
+var ErrInsufficientData = policy.ErrInsufficientData
+
+// Policy decides the band of the latest of the prices, given in time order.
+type Policy interface {
+	Band(prices []float64) (string, error)
+}
+
+// Trend is expensive when the prices rose more often than they fell.
+type Trend struct{}
+
+func (Trend) Band(prices []float64) (string, error) {
+	return policy.Trend{}.Band(prices)
+}
+
+// New returns the policy name, trend, threshold, linear or peak_shaving,
+// configured with the parameters.
+func New(name string, parameters map[string]float64) (Policy, error) {
+	return policy.New(name, parameters)
+}
+
+// Decision is the band a policy decided for the latest of the prices.
+type Decision struct {
+	// Time is the start of the trading hour of the latest price
+	Time  time.Time
+	Band  string
+	Price float64
+}
+
+// Decide evaluates the policy against the points, in time order, returning
+// its decision on the latest of them.
+func Decide(p Policy, points []pricing.PricePoint) (Decision, error) {
+	if len(points) == 0 {
+		return Decision{}, ErrInsufficientData
+	}
+	band, err := p.Band(pricing.Prices(points))
+	if err != nil {
+		return Decision{}, err
+	}
+	last := points[len(points)-1]
+	return Decision{Time: last.Start, Band: band, Price: last.Price}, nil
+}
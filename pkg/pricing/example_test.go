@@ -0,0 +1,14 @@
+package pricing_test
+
+import (
+	"fmt"
+
+	"github.com/CERIT-SC/epcp-simulator/pkg/pricing"
+)
+
+func ExamplePrices() {
+	points := []pricing.PricePoint{{Hour: 1, Price: 85.2}, {Hour: 2, Price: 79.9}, {Hour: 3, Price: -3.5}}
+	fmt.Println(pricing.Prices(points))
+	// Output:
+	// [85.2 79.9 -3.5]
+}
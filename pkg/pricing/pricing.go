@@ -0,0 +1,38 @@
+// Package pricing holds the hourly prices of the electricity market shared
+// by the packages of the public API, see package ote.
+//
+// The packages under pkg are the stable API of epcp for embedding its OTE
+// client and policies in other tools: their identifiers keep their meaning
+// and signatures within a major version. Everything else stays under
+// internal and may change with any release; the packages under pkg own
+// their types and convert from those of internal.
+package pricing
+
+import "time"
+
+// PricePoint is the price and traded volume of one trading hour. The
+// intraday prices are in EUR/MWh, the day-ahead ones in CZK/MWh unless the
+// client fetches them in EUR, see ote.WithCurrency.
+type PricePoint struct {
+	// Date is the trading day, as YYYY-MM-DD
+	Date string `json:"date"`
+	// Hour is the index of the trading hour in the day, from 1 at midnight,
+	// see ote.HourIndex
+	Hour int `json:"hour"`
+	// Start is when the trading hour starts
+	Start  time.Time `json:"start"`
+	Price  float64   `json:"price"`
+	Volume float64   `json:"volume"`
+	// Provisional is set on the intraday price of the hour still trading,
+	// which may change until the hour ends
+	Provisional bool `json:"provisional,omitempty"`
+}
+
+// Prices returns the prices of the points.
+func Prices(points []PricePoint) []float64 {
+	prices := make([]float64, len(points))
+	for i, p := range points {
+		prices[i] = p.Price
+	}
+	return prices
+}